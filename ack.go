@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+)
+
+// Ways of acknowledging a successful change.
+const (
+	// ackReply answers with a message describing the change.
+	ackReply = "reply"
+	// ackReaction reacts with ackEmoji to the command instead.
+	ackReaction = "reaction"
+)
+
+// ackEmoji is the reaction acknowledging a change in ackReaction mode.
+const ackEmoji = "✅"
+
+// ackModes are the modes `!settings ack` accepts.
+var ackModes = []string{ackReply, ackReaction}
+
+// ackMode returns how successful changes are acknowledged.
+func (cfg GuildConfig) ackMode() string {
+	if cfg.Ack == "" {
+		return ackReply
+	}
+	return cfg.Ack
+}
+
+// Ack confirms a successful change made by a command. Guilds preferring
+// reactions get ackEmoji on the command instead of the message, which is
+// still sent when the reaction can't be added. Errors are never
+// acknowledged this way, so they always get a reply.
+func (c *Context) Ack(key string, args Args) {
+	if c.Config.ackMode() == ackReaction && c.Interaction == nil {
+		err := c.Session.MessageReactionAdd(c.Message.ChannelID, c.Message.ID, ackEmoji)
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to add reaction to %s: %v", c.Message.ID, err)
+	}
+	c.Reply(key, args)
+}
+
+// handleAckSetting implements `!settings ack [reply|reaction]`.
+func handleAckSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.ack", Args{"value": c.Config.ackMode()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	mode := strings.ToLower(fields[0])
+	if len(fields) != 1 || !slices.Contains(ackModes, mode) {
+		c.Reply("settings.ack_invalid", Args{"values": strings.Join(ackModes, ", ")})
+		return
+	}
+	stored := mode
+	if mode == ackReply {
+		stored = ""
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.Ack = stored
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save acknowledgement mode: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.Ack = stored
+	c.Reply("settings.ack_set", Args{"value": mode})
+}
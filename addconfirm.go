@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// addConfirmTimeout is how long the buttons of a similar-name warning stay valid.
+const addConfirmTimeout = 60 * time.Second
+
+// pendingAdd is an add held back because similar entries exist.
+type pendingAdd struct {
+	guildID string
+	by      Contributor
+	name    string
+	similar []string
+	expires time.Time
+}
+
+var (
+	// pendingAdds stores adds waiting for "Add anyway" or "Cancel", keyed by token.
+	pendingAdds      = make(map[string]*pendingAdd)
+	pendingAddsMutex sync.Mutex
+)
+
+// FindSimilar returns the names of existing restaurants similar to name, most similar first.
+func FindSimilar(guildID, name string) ([]string, error) {
+	var similar []string
+	err := viewGuild(guildID, func(g *GuildData) error {
+		similar = g.similarNames(name)
+		return nil
+	})
+	return similar, err
+}
+
+// askAddAnyway lists the entries similar to a new name and lets the invoker add it anyway.
+func askAddAnyway(c *Context, name string, similar []string) {
+	token := newToken()
+	pendingAddsMutex.Lock()
+	pendingAdds[token] = &pendingAdd{
+		guildID: c.GuildID,
+		by:      c.Author(),
+		name:    name,
+		similar: similar,
+		expires: time.Now().Add(addConfirmTimeout),
+	}
+	pendingAddsMutex.Unlock()
+
+	id := func(action string) string { return fmt.Sprintf("addsim:%s:%s", token, action) }
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content: c.T("add.similar", Args{"name": name, "similar": quoteNames(similar), "count": len(similar), "seconds": int(addConfirmTimeout.Seconds())}),
+		Components: []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: c.T("button.add_anyway", nil), Style: discordgo.PrimaryButton, CustomID: id("add")},
+			discordgo.Button{Label: c.T("button.cancel", nil), Style: discordgo.SecondaryButton, CustomID: id("cancel")},
+		)},
+	})
+	if err != nil {
+		log.Printf("Failed to send similar name warning: %v", err)
+		return
+	}
+
+	time.AfterFunc(addConfirmTimeout, func() {
+		pendingAddsMutex.Lock()
+		_, pending := pendingAdds[token]
+		delete(pendingAdds, token)
+		pendingAddsMutex.Unlock()
+		if !pending {
+			return
+		}
+		content := c.T("add.similar_expired", Args{"name": name})
+		components := []discordgo.MessageComponent{}
+		if _, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: msg.ID, Channel: msg.ChannelID, Content: &content, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to expire similar name warning: %v", err)
+		}
+	})
+}
+
+// handleAddSimilarComponent handles the "Add anyway" and "Cancel" buttons.
+func handleAddSimilarComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pendingAddsMutex.Lock()
+	add, ok := pendingAdds[token]
+	if ok && time.Now().After(add.expires) {
+		delete(pendingAdds, token)
+		ok = false
+	}
+	if !ok {
+		pendingAddsMutex.Unlock()
+		i.Update(i.T("add.similar_expired_generic", nil), nil)
+		return
+	}
+	if i.UserID() != add.by.ID {
+		pendingAddsMutex.Unlock()
+		i.Ephemeral("add.not_yours", nil)
+		return
+	}
+	delete(pendingAdds, token)
+	pendingAddsMutex.Unlock()
+
+	switch action {
+	case "cancel":
+		i.Update(i.T("add.similar_cancelled", Args{"name": add.name}), nil)
+	case "add":
+		count, err := ForceAddRestaurant(add.guildID, add.name, add.by)
+		if errors.Is(err, ErrListFull) {
+			i.Update(i.T("add.list_full", Args{"count": i.Config.maxRestaurants()}), nil)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to force-add restaurant: %v", err)
+			i.Update(i.T("add.failed", nil), nil)
+			return
+		}
+		i.Update(i.T("add.done", Args{"name": add.name, "count": count}), nil)
+		offerTags(i.Session, i.Event.ChannelID, add.guildID, i.Config, add.by.ID, add.name)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// maxAliases is the number of nicknames a restaurant may have.
+const maxAliases = 10
+
+var (
+	// ErrAliasNotFound is returned when removing a nickname a restaurant doesn't have.
+	ErrAliasNotFound = errors.New("nickname not found")
+	// ErrTooManyAliases is returned when a restaurant has maxAliases nicknames already.
+	ErrTooManyAliases = errors.New("too many nicknames")
+)
+
+// AliasTakenError is returned for a nickname that is already the name or a
+// nickname of another restaurant.
+type AliasTakenError struct {
+	Alias string
+	// Owner is the name of the restaurant the nickname refers to.
+	Owner string
+}
+
+func (e *AliasTakenError) Error() string {
+	return fmt.Sprintf("%q already refers to %q", e.Alias, e.Owner)
+}
+
+// hasAlias reports whether the restaurant has a nickname, ignoring case.
+func (r *Restaurant) hasAlias(alias string) bool {
+	return slices.ContainsFunc(r.Aliases, func(a string) bool { return strings.EqualFold(a, alias) })
+}
+
+// allNames returns the restaurant's name followed by its nicknames.
+func (r *Restaurant) allNames() []string {
+	return append([]string{r.Name}, r.Aliases...)
+}
+
+// aliasOwner returns the index of the restaurant other than skip whose name
+// or nickname is alias, comparing like find, or -1.
+func (g *GuildData) aliasOwner(alias string, skip int) int {
+	normalized := normalizeName(alias)
+	for i, r := range g.Restaurants {
+		if i == skip || r.Deleted() {
+			continue
+		}
+		for _, name := range r.allNames() {
+			if strings.EqualFold(name, alias) || normalized != "" && normalizeName(name) == normalized {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// AliasRestaurant adds a nickname to a restaurant, or removes it, returning
+// the restaurant's canonical name and resulting nicknames. Nicknames are
+// unique across the guild's names and nicknames.
+func AliasRestaurant(guildID, name, alias string, remove bool) (string, []string, error) {
+	var canonical string
+	var aliases []string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		canonical = r.Name
+		switch {
+		case remove && !r.hasAlias(alias):
+			return ErrAliasNotFound
+		case remove:
+			r.Aliases = slices.DeleteFunc(r.Aliases, func(a string) bool { return strings.EqualFold(a, alias) })
+		case r.hasAlias(alias):
+			aliases = r.Aliases
+			return errNoChange
+		case len(r.Aliases) >= maxAliases:
+			return ErrTooManyAliases
+		default:
+			if owner := g.aliasOwner(alias, i); owner >= 0 {
+				return &AliasTakenError{Alias: alias, Owner: g.Restaurants[owner].Name}
+			}
+			if strings.EqualFold(alias, r.Name) {
+				aliases = r.Aliases
+				return errNoChange
+			}
+			r.Aliases = append(r.Aliases, alias)
+		}
+		aliases = r.Aliases
+		return nil
+	})
+	if errors.Is(err, errNoChange) {
+		err = nil
+	}
+	return canonical, aliases, err
+}
+
+// handleNickname implements `!nickname "Name" [nickname|-nickname]`, listing,
+// adding or removing the nicknames members may refer to a restaurant by.
+func handleNickname(c *Context) {
+	name, rest, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("nickname.usage", nil)
+		return
+	}
+	if rest == "" {
+		r, err := GetRestaurant(c.GuildID, name)
+		if err != nil {
+			log.Printf("Failed to get restaurant: %v", err)
+			c.replyError("nickname.failed", err, name)
+			return
+		}
+		if len(r.Aliases) == 0 {
+			c.Reply("nickname.none", Args{"name": r.Name})
+			return
+		}
+		c.Reply("nickname.list", Args{"name": r.Name, "aliases": quoteNames(r.Aliases)})
+		return
+	}
+
+	remove := strings.HasPrefix(rest, "-")
+	alias := strings.TrimPrefix(rest, "-")
+	if quoted, after, ok := parseQuoted(alias); ok && after == "" {
+		alias = quoted
+	}
+	alias = strings.TrimSpace(alias)
+	if alias == "" {
+		c.Reply("nickname.usage", nil)
+		return
+	}
+	if !remove {
+		if strings.HasPrefix(strings.ToLower(alias), idPrefix) {
+			c.Reply("nickname.invalid", Args{"prefix": idPrefix})
+			return
+		}
+		if err := validateName(alias, c.Config.maxNameLength()); err != nil {
+			c.replyNameError(err)
+			return
+		}
+	}
+
+	canonical, aliases, err := AliasRestaurant(c.GuildID, name, alias, remove)
+	var taken *AliasTakenError
+	switch {
+	case errors.As(err, &taken):
+		c.Reply("nickname.taken", Args{"alias": echoName(taken.Alias), "name": taken.Owner})
+	case errors.Is(err, ErrAliasNotFound):
+		c.Reply("nickname.not_found", Args{"alias": echoName(alias), "name": canonical})
+	case errors.Is(err, ErrTooManyAliases):
+		c.Reply("nickname.too_many", Args{"name": canonical, "count": maxAliases})
+	case err != nil:
+		log.Printf("Failed to update nicknames: %v", err)
+		c.replyError("nickname.failed", err, name)
+	case len(aliases) == 0:
+		c.Ack("nickname.none", Args{"name": canonical})
+	default:
+		c.Ack("nickname.done", Args{"name": canonical, "aliases": quoteNames(aliases)})
+	}
+}
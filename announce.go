@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// announceChannel looks up a channel, from the state cache when it has it.
+func announceChannel(s *discordgo.Session, channelID string) (*discordgo.Channel, error) {
+	ch, err := s.State.Channel(channelID)
+	if err != nil {
+		ch, err = s.Channel(channelID)
+	}
+	return ch, err
+}
+
+// announceChannelProblem checks that decisions can be announced in a channel
+// of the guild, returning the catalog key of the problem, "" if there is none.
+func announceChannelProblem(s *discordgo.Session, guildID, channelID string) string {
+	ch, err := announceChannel(s, channelID)
+	switch {
+	case err != nil || ch.GuildID != guildID:
+		return "settings.announce_unknown"
+	case ch.Type != discordgo.ChannelTypeGuildText && ch.Type != discordgo.ChannelTypeGuildNews:
+		return "settings.announce_type"
+	}
+	perms, err := s.UserChannelPermissions(s.State.User.ID, channelID)
+	need := int64(discordgo.PermissionViewChannel | discordgo.PermissionSendMessages)
+	if err != nil || perms&need != need {
+		return "settings.announce_permissions"
+	}
+	return ""
+}
+
+// announceDecision cross-posts a lunch decision made in channelID to the
+// guild's announcement channel, publishing it to following servers when it
+// is an announcement channel. Missing permissions are reported once to the
+// admin who chose the channel.
+func announceDecision(s *discordgo.Session, guildID, channelID string, cfg GuildConfig, name, source string) {
+	target := cfg.AnnounceChannelID
+	if target == "" || target == channelID {
+		return
+	}
+	key := "announce.poll"
+	if source == decisionPick {
+		key = "announce.pick"
+	}
+	msg, err := s.ChannelMessageSendComplex(target, &discordgo.MessageSend{
+		Content:         cfg.T(key, Args{"name": name, "channel": "<#" + channelID + ">"}),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to announce decision in %s: %v", target, err)
+		if channelInaccessible(err) {
+			reportAnnounceFailure(s, guildID, cfg, "announce.failed_post")
+		}
+		return
+	}
+	ch, err := announceChannel(s, target)
+	if err != nil || ch.Type != discordgo.ChannelTypeGuildNews {
+		return
+	}
+	if _, err := s.ChannelMessageCrosspost(target, msg.ID); err != nil {
+		log.Printf("Failed to publish decision in %s: %v", target, err)
+		if channelInaccessible(err) {
+			reportAnnounceFailure(s, guildID, cfg, "announce.failed_publish")
+		}
+	}
+}
+
+// reportAnnounceFailure tells the admin who chose the announcement channel
+// that the bot lacks permissions there, unless they were told since.
+func reportAnnounceFailure(s *discordgo.Session, guildID string, cfg GuildConfig, key string) {
+	var adminID string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		if g.AnnounceWarned || g.AnnounceAdminID == "" {
+			return errNoChange
+		}
+		g.AnnounceWarned = true
+		adminID = g.AnnounceAdminID
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errNoChange) {
+			log.Printf("Failed to save announcement failure in guild %s: %v", guildID, err)
+		}
+		return
+	}
+	dm, err := s.UserChannelCreate(adminID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(dm.ID, cfg.T(key, Args{"channel": "<#" + cfg.AnnounceChannelID + ">"}))
+	}
+	if err != nil {
+		log.Printf("Failed to report announcement failure to %s: %v", adminID, err)
+	}
+}
+
+// handleAnnounceSetting implements `!settings announce [#channel|off]`,
+// the channel final lunch decisions are cross-posted to.
+func handleAnnounceSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Send(announceSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	channelID := ""
+	if !strings.EqualFold(fields[0], "off") {
+		var ok bool
+		if channelID, ok = parseChannelMention(fields[0]); !ok || len(fields) != 1 {
+			c.Reply("settings.announce_usage", nil)
+			return
+		}
+		if problem := announceChannelProblem(c.Session, c.GuildID, channelID); problem != "" {
+			c.Reply(problem, Args{"channel": "<#" + channelID + ">"})
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.AnnounceChannelID = channelID
+		g.AnnounceAdminID, g.AnnounceWarned = "", false
+		if channelID != "" {
+			g.AnnounceAdminID = c.Message.Author.ID
+		}
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save announcement channel: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.AnnounceChannelID = channelID
+	c.Send(announceSettingLine(c.Config))
+}
+
+// announceSettingLine describes where lunch decisions are cross-posted.
+func announceSettingLine(cfg GuildConfig) string {
+	if cfg.AnnounceChannelID == "" {
+		return cfg.T("settings.announce_off", nil)
+	}
+	return cfg.T("settings.announce", Args{"channel": "<#" + cfg.AnnounceChannelID + ">"})
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxAPIBodySize bounds the request bodies the API accepts.
+const maxAPIBodySize = 4 << 10
+
+// sourcePattern matches the source names API clients may give.
+var sourcePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// ErrSimilarExists is returned when an API client adds a name similar to an existing entry.
+var ErrSimilarExists = errors.New("a similar restaurant is already on the list")
+
+// apiRestaurant is the JSON form of a restaurant in API responses.
+type apiRestaurant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Emoji     string    `json:"emoji,omitempty"`
+	Tags      []string  `json:"tags"`
+	Price     int       `json:"price,omitempty"`
+	Diet      []string  `json:"diet,omitempty"`
+	Rating    *float64  `json:"rating,omitempty"`
+	Ratings   int       `json:"ratings"`
+	Visits    int       `json:"visits"`
+	LastVisit time.Time `json:"last_visit,omitzero"`
+	Location  *Location `json:"location,omitempty"`
+	Link      string    `json:"link,omitempty"`
+	AddedAt   time.Time `json:"added_at,omitzero"`
+}
+
+// newAPIRestaurant converts a restaurant, leaving out who added and rated it.
+func newAPIRestaurant(r Restaurant) apiRestaurant {
+	out := apiRestaurant{
+		ID:        r.ID,
+		Name:      r.Name,
+		Emoji:     r.Emoji,
+		Tags:      r.Tags,
+		Price:     r.Price,
+		Diet:      r.Diet,
+		Ratings:   len(r.Ratings),
+		Visits:    len(r.Visits),
+		LastVisit: r.LastVisit(),
+		Location:  r.Location,
+		Link:      r.Link,
+		AddedAt:   r.AddedAt,
+	}
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	if avg, ok := r.AverageRating(); ok {
+		out.Rating = &avg
+	}
+	return out
+}
+
+// apiQuery holds the query parameters shared by the API endpoints.
+type apiQuery struct {
+	// Tags must all be carried by a restaurant.
+	Tags []string
+	// Limit caps the number of results, 0 for no limit.
+	Limit int
+}
+
+// keep reports whether a restaurant carries every requested tag.
+func (q apiQuery) keep(r *Restaurant) bool {
+	for _, tag := range q.Tags {
+		if !r.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAPIQuery reads ?tag= (repeatable) and ?limit=.
+func parseAPIQuery(r *http.Request) (apiQuery, error) {
+	var q apiQuery
+	for _, value := range r.URL.Query()["tag"] {
+		tag, ok := parseTag("#" + strings.TrimPrefix(value, "#"))
+		if !ok {
+			return q, fmt.Errorf("invalid tag %q", value)
+		}
+		q.Tags = append(q.Tags, tag)
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// registerAPI adds the API to mux when API_TOKEN is set. Restaurants added
+// through it are announced with s.
+func registerAPI(mux *http.ServeMux, s *discordgo.Session) {
+	token := os.Getenv("API_TOKEN")
+	if token == "" {
+		log.Println("API_TOKEN not set, the HTTP API is disabled.")
+		return
+	}
+	mux.Handle("GET /api/guilds/{id}/restaurants", requireToken(token, requireOwnedGuild(apiRestaurants)))
+	mux.Handle("GET /api/guilds/{id}/suggestion", requireToken(token, requireOwnedGuild(apiSuggestion)))
+	mux.Handle("GET /api/guilds/{id}/stats", requireToken(token, requireOwnedGuild(apiStats)))
+	mux.Handle("GET /api/metrics", requireToken(token, apiMetrics))
+	mux.Handle("POST /api/guilds/{id}/restaurants", requireToken(token, requireOwnedGuild(func(w http.ResponseWriter, r *http.Request) {
+		apiAddRestaurant(s, w, r)
+	})))
+}
+
+// apiMetrics reports the bot's error counters and the shards it runs.
+func apiMetrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"handler_panics": handlerPanics.Load(), "shard": gatewayShards})
+}
+
+// requireToken rejects requests without the bearer token.
+func requireToken(token string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// requireOwnedGuild answers 421 Misdirected Request for guilds another shard
+// process owns, naming their shard, as this process's copy of them may be
+// outdated and its changes would be lost.
+func requireOwnedGuild(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if guildID := r.PathValue("id"); !ownsGuild(guildID) {
+			writeJSON(w, http.StatusMisdirectedRequest, map[string]any{"error": "guild is served by another shard", "shard": guildShardID(guildID, gatewayShards.Count)})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeJSON sends v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write API response: %v", err)
+	}
+}
+
+// writeAPIError sends an error response.
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// viewAPIGuild runs fn on the guild named in the path with the request's
+// query, answering with the matching error status if that isn't possible.
+func viewAPIGuild(w http.ResponseWriter, r *http.Request, fn func(g *GuildData, q apiQuery)) bool {
+	q, err := parseAPIQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	err = viewKnownGuild(r.PathValue("id"), func(g *GuildData) error {
+		fn(g, q)
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrUnknownGuild):
+		writeAPIError(w, http.StatusNotFound, "unknown guild")
+		return false
+	case err != nil:
+		log.Printf("API failed to load guild %s: %v", r.PathValue("id"), err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to load the guild")
+		return false
+	}
+	return true
+}
+
+// candidates returns the open restaurants matching the query.
+func (q apiQuery) candidates(g *GuildData) []Restaurant {
+	var matches []Restaurant
+	for _, r := range g.open() {
+		if q.keep(&r) {
+			matches = append(matches, r)
+		}
+	}
+	return matches
+}
+
+// apiRestaurants serves GET /api/guilds/{id}/restaurants.
+func apiRestaurants(w http.ResponseWriter, r *http.Request) {
+	var restaurants []apiRestaurant
+	var total int
+	ok := viewAPIGuild(w, r, func(g *GuildData, q apiQuery) {
+		matches := q.candidates(g)
+		total = len(matches)
+		if q.Limit > 0 && len(matches) > q.Limit {
+			matches = matches[:q.Limit]
+		}
+		restaurants = []apiRestaurant{}
+		for _, m := range matches {
+			restaurants = append(restaurants, newAPIRestaurant(m))
+		}
+	})
+	if ok {
+		writeJSON(w, http.StatusOK, map[string]any{"total": total, "restaurants": restaurants})
+	}
+}
+
+// apiSuggestion serves GET /api/guilds/{id}/suggestion, picking like !random
+// without recording anything.
+func apiSuggestion(w http.ResponseWriter, r *http.Request) {
+	var candidates, restaurants []Restaurant
+	var cfg GuildConfig
+	if !viewAPIGuild(w, r, func(g *GuildData, q apiQuery) {
+		candidates, restaurants, cfg = q.candidates(g), g.Restaurants, g.Config
+	}) {
+		return
+	}
+	if len(candidates) == 0 {
+		writeAPIError(w, http.StatusNotFound, "no matching restaurants")
+		return
+	}
+	if candidates = available(candidates, cfg, time.Now()); len(candidates) == 0 {
+		writeAPIError(w, http.StatusNotFound, "no matching restaurants")
+		return
+	}
+	pick := weightedSample(candidates, 1, cfg.pickWeight(restaurants, time.Now()))[0]
+	writeJSON(w, http.StatusOK, map[string]any{"suggestion": newAPIRestaurant(pick)})
+}
+
+// apiStats serves GET /api/guilds/{id}/stats.
+func apiStats(w http.ResponseWriter, r *http.Request) {
+	var stats guildStats
+	if viewAPIGuild(w, r, func(g *GuildData, q apiQuery) { stats = g.stats(q.keep) }) {
+		writeJSON(w, http.StatusOK, stats)
+	}
+}
+
+// apiAddRequest is the body of POST /api/guilds/{id}/restaurants.
+type apiAddRequest struct {
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags"`
+	Source string   `json:"source"`
+}
+
+// AddRestaurantFromAPI adds a restaurant sent by an API client with the same
+// checks as !add. Nobody can confirm a similar name, so those are rejected
+// with ErrSimilarExists and returned. It returns the new entry and the list's
+// size after the add.
+func AddRestaurantFromAPI(ctx context.Context, guildID, name string, tags []string, source string) (Restaurant, int, []string, error) {
+	var added Restaurant
+	var count int
+	var similar []string
+	check := func(g *GuildData) error {
+		if err := validateName(name, g.Config.maxNameLength()); err != nil {
+			return err
+		}
+		if similar = g.similarNames(name); len(similar) > 0 {
+			return ErrSimilarExists
+		}
+		if g.count() >= g.Config.maxRestaurants() {
+			return ErrListFull
+		}
+		return nil
+	}
+	// Fail fast before asking the ML API, then check again under the lock
+	// the add is made with, in case the list changed in the meantime.
+	if err := viewKnownGuild(guildID, check); err != nil {
+		return added, 0, similar, err
+	}
+	duplicate, err := CheckForDuplicate(ctx, guildID, name)
+	if err != nil {
+		return added, 0, nil, fmt.Errorf("failed to check for duplicates: %w", err)
+	}
+	if duplicate.IsDuplicate {
+		return added, 0, []string{duplicate.MatchedName}, ErrSimilarExists
+	}
+	err = updateKnownGuild(guildID, func(g *GuildData) error {
+		if err := check(g); err != nil {
+			return err
+		}
+		added = Restaurant{ID: g.nextID(), Name: name, AddedAt: time.Now().UTC(), Tags: tags}
+		g.Restaurants = append(g.Restaurants, added)
+		g.audit(auditAdd, name, nil, source)
+		count = g.count()
+		return nil
+	})
+	return added, count, similar, err
+}
+
+// apiAddRestaurant serves POST /api/guilds/{id}/restaurants and announces the
+// new restaurant in the guild's API channel, if one is set.
+func apiAddRestaurant(s *discordgo.Session, w http.ResponseWriter, r *http.Request) {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	dec.DisallowUnknownFields()
+	var req apiAddRequest
+	if err := dec.Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("request body is larger than %d bytes", maxAPIBodySize))
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if dec.More() {
+		writeAPIError(w, http.StatusBadRequest, "invalid request body: unexpected data after the object")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		writeAPIError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	var tags []string
+	for _, value := range req.Tags {
+		tag, ok := parseTag("#" + strings.TrimPrefix(value, "#"))
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid tag %q", value))
+			return
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	source := strings.ToLower(req.Source)
+	if source == "" {
+		source = sourceAPI
+	}
+	if !sourcePattern.MatchString(source) {
+		writeAPIError(w, http.StatusBadRequest, "source must be 1-32 lowercase letters, digits, '-' or '_'")
+		return
+	}
+
+	guildID := r.PathValue("id")
+	added, count, similar, err := AddRestaurantFromAPI(r.Context(), guildID, name, tags, source)
+	switch {
+	case errors.Is(err, ErrUnknownGuild):
+		writeAPIError(w, http.StatusNotFound, "unknown guild")
+		return
+	case errors.Is(err, ErrSimilarExists):
+		writeJSON(w, http.StatusConflict, map[string]any{"error": err.Error(), "similar": similar})
+		return
+	case errors.Is(err, ErrListFull):
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, ErrNameTooLong), errors.Is(err, ErrNameLineBreak), errors.Is(err, ErrNameCodeBlock):
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Printf("API failed to add %q to guild %s: %v", name, guildID, err)
+		writeAPIError(w, http.StatusInternalServerError, "failed to add the restaurant")
+		return
+	}
+	log.Printf("API added %q to guild %s from %s", name, guildID, source)
+
+	if cfg, err := GetGuildConfig(guildID); err != nil {
+		log.Printf("Failed to load config for guild %s: %v", guildID, err)
+	} else if cfg.APIChannelID != "" {
+		text := cfg.T("api.announce", Args{"name": name, "source": source})
+		if len(tags) > 0 {
+			text += " " + formatTags(tags)
+		}
+		if _, err := s.ChannelMessageSend(cfg.APIChannelID, text); err != nil {
+			log.Printf("Failed to announce API add in %s: %v", cfg.APIChannelID, err)
+		}
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"restaurant": newAPIRestaurant(added), "count": count})
+}
+
+// handleAPISetting implements `!settings api [#channel|off]`, the channel
+// announcing restaurants added through the HTTP API.
+func handleAPISetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Send(apiSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	channelID := ""
+	if !strings.EqualFold(fields[0], "off") {
+		var ok bool
+		if channelID, ok = parseChannelMention(fields[0]); !ok || len(fields) != 1 {
+			c.Reply("settings.api_usage", nil)
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.APIChannelID = channelID
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save API channel: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.APIChannelID = channelID
+	c.Send(apiSettingLine(c.Config))
+}
+
+// apiSettingLine describes where API adds are announced.
+func apiSettingLine(cfg GuildConfig) string {
+	if cfg.APIChannelID == "" {
+		return cfg.T("settings.api_off", nil)
+	}
+	return cfg.T("settings.api", Args{"channel": "<#" + cfg.APIChannelID + ">"})
+}
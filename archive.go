@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrAlreadyArchived is returned when archiving an archived restaurant.
+	ErrAlreadyArchived = errors.New("restaurant is already archived")
+	// ErrNotArchived is returned when unarchiving a restaurant that isn't archived.
+	ErrNotArchived = errors.New("restaurant is not archived")
+)
+
+// ArchiveRestaurant marks a restaurant as closed, or reopens it when archive is false.
+// It returns the restaurant's canonical name.
+func ArchiveRestaurant(guildID, name string, archive bool, reason string) (string, error) {
+	var canonical string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		canonical = r.Name
+		switch {
+		case archive && r.IsArchived():
+			return ErrAlreadyArchived
+		case !archive && !r.IsArchived():
+			return ErrNotArchived
+		case !archive && g.count() >= g.Config.maxRestaurants():
+			return ErrListFull
+		}
+		if archive {
+			r.Archived = &Archive{At: time.Now().UTC(), Reason: reason}
+		} else {
+			r.Archived = nil
+		}
+		return nil
+	})
+	return canonical, err
+}
+
+// handleArchive implements `!archive "Name" [reason]`.
+func handleArchive(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	name, reason, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("archive.usage", nil)
+		return
+	}
+	canonical, err := ArchiveRestaurant(c.GuildID, name, true, reason)
+	switch {
+	case errors.Is(err, ErrAlreadyArchived):
+		c.Reply("archive.already", Args{"name": canonical})
+	case err != nil:
+		log.Printf("Failed to archive restaurant: %v", err)
+		c.replyError("archive.failed", err, name)
+	default:
+		c.Ack("archive.done", Args{"name": canonical})
+	}
+}
+
+// handleUnarchive implements `!unarchive "Name"`.
+func handleUnarchive(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	name, _, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("archive.unarchive_usage", nil)
+		return
+	}
+	canonical, err := ArchiveRestaurant(c.GuildID, name, false, "")
+	switch {
+	case errors.Is(err, ErrNotArchived):
+		c.Reply("archive.not_archived", Args{"name": canonical})
+	case errors.Is(err, ErrListFull):
+		c.Reply("add.list_full", Args{"count": c.Config.maxRestaurants()})
+	case err != nil:
+		log.Printf("Failed to unarchive restaurant: %v", err)
+		c.replyError("archive.failed", err, name)
+	default:
+		c.Ack("archive.unarchived", Args{"name": canonical})
+	}
+}
+
+// archiveLine describes when and why a restaurant was archived.
+func archiveLine(cfg GuildConfig, a *Archive) string {
+	date := a.At.Format("2006-01-02")
+	if a.Reason == "" {
+		return cfg.T("archive.info", Args{"date": date})
+	}
+	return cfg.T("archive.info_reason", Args{"date": date, "reason": a.Reason})
+}
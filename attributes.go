@@ -0,0 +1,667 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxPrice is the most expensive price level.
+	maxPrice = 4
+	// maxCapacity bounds the group size limit of a restaurant.
+	maxCapacity = 1000
+	// maxWait bounds the wait of a restaurant, in minutes.
+	maxWait = 240
+	// maxLinkLength bounds the length of a restaurant's link.
+	maxLinkLength = 2000
+	// maxAddressLength bounds the length of a restaurant's address.
+	maxAddressLength = 200
+)
+
+// dietFlags are the dietary options a restaurant can be marked with.
+var dietFlags = []string{"vegetarian", "vegan", "gluten-free", "dairy-free", "halal", "kosher"}
+
+// parsePrice parses a price level written as "$" to "$$$$" or "1" to "4".
+func parsePrice(s string) (int, bool) {
+	if s != "" && strings.Trim(s, "$") == "" && len(s) <= maxPrice {
+		return len(s), true
+	}
+	if len(s) == 1 && s[0] >= '1' && s[0] <= '0'+maxPrice {
+		return int(s[0] - '0'), true
+	}
+	return 0, false
+}
+
+// formatPrice renders a price level as dollar signs, or "" when unknown.
+func formatPrice(level int) string {
+	return strings.Repeat("$", level)
+}
+
+// parseDiet normalizes a dietary flag, reporting whether it is known.
+func parseDiet(s string) (string, bool) {
+	s = strings.ToLower(s)
+	for _, flag := range dietFlags {
+		if s == flag {
+			return flag, true
+		}
+	}
+	return "", false
+}
+
+// HasDiet reports whether the entry is marked with a dietary flag.
+func (r *Restaurant) HasDiet(flag string) bool {
+	for _, d := range r.Diet {
+		if d == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// validLink reports whether s is an absolute http or https URL.
+func validLink(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// seats reports whether a group of size people fits at the restaurant.
+func (r *Restaurant) seats(size int) bool {
+	return r.Capacity == 0 || r.Capacity >= size
+}
+
+// attributeKind is the type of an attribute's values.
+type attributeKind int
+
+const (
+	// kindBool values are yes or no, held as bool.
+	kindBool attributeKind = iota
+	// kindInt values are whole numbers from Min to Max, held as int, 0 when unset.
+	kindInt
+	// kindEnum values are one of Options, held as string, or a set of them
+	// written comma-separated when Multi, held as a sorted []string.
+	kindEnum
+	// kindString values are text of at most MaxLen runes, held as string.
+	kindString
+	// kindLocation values are coordinates written as lat,lon, held as *Location.
+	kindLocation
+)
+
+// attributeFilter is how filter expressions select restaurants by an attribute.
+type attributeFilter int
+
+const (
+	// filterNone leaves the attribute out of filters.
+	filterNone attributeFilter = iota
+	// filterEqual matches key:value, or the restaurants whose set of options
+	// has every option listed.
+	filterEqual
+	// filterCompare also accepts key:<value, key:<=value, key:>value and
+	// key:>=value. Restaurants without the attribute never match.
+	filterCompare
+)
+
+// attribute declares a per-restaurant attribute. !set, bulk edits, imports,
+// filters, !info and !attributes all go by these declarations, so a new
+// attribute only needs an entry in attributeRegistry.
+type attribute struct {
+	Key  string
+	Kind attributeKind
+	// Min and Max bound kindInt values.
+	Min, Max int
+	// Options are the values of a kindEnum attribute, a set of them when Multi.
+	Options []string
+	Multi   bool
+	// MaxLen bounds kindString values, in runes.
+	MaxLen int
+	// Hint is the catalog key describing the values when the kind's own
+	// description doesn't fit, e.g. $ to $$$$.
+	Hint string
+	// Example is a valid value, shown by !attributes.
+	Example string
+	Filter  attributeFilter
+	// FilterKey is the key of filter terms when it isn't Key.
+	FilterKey string
+	// Private attributes come from the guild's own visits and are left out of shared lists.
+	Private bool
+
+	get func(r *Restaurant) any
+	set func(r *Restaurant, value any)
+	// parse replaces the kind's syntax of values, e.g. $$ for price.
+	parse func(s string) (any, bool)
+	// format replaces the kind's rendering of values.
+	format func(value any) string
+	// node builds the filter node of a value instead of the filter's own.
+	node func(value any) filterNode
+	// info renders the !info line instead of "Name: value", "" to leave it out.
+	info func(cfg GuildConfig, r *Restaurant) string
+}
+
+// attributeRegistry declares the restaurant attributes in display order.
+var attributeRegistry = []*attribute{
+	{
+		Key: "price", Kind: kindInt, Min: 1, Max: maxPrice, Hint: "attributes.hint_price", Example: "$$", Filter: filterCompare,
+		get:    func(r *Restaurant) any { return r.Price },
+		set:    func(r *Restaurant, v any) { r.Price = v.(int) },
+		parse:  func(s string) (any, bool) { return parsePrice(s) },
+		format: func(v any) string { return formatPrice(v.(int)) },
+	},
+	{
+		Key: "diet", Kind: kindEnum, Options: dietFlags, Multi: true, Example: "vegan,halal", Filter: filterEqual,
+		get: func(r *Restaurant) any { return r.Diet },
+		set: func(r *Restaurant, v any) { r.Diet = slices.Clone(v.([]string)) },
+	},
+	{
+		Key: "location", Kind: kindLocation, Example: "52.520,13.405",
+		get: func(r *Restaurant) any { return r.Location },
+		set: func(r *Restaurant, v any) { r.Location = v.(*Location) },
+		info: func(cfg GuildConfig, r *Restaurant) string {
+			switch {
+			case r.Location == nil:
+				return ""
+			case cfg.Office != nil:
+				return cfg.T("info.location_distance", Args{"location": r.Location.String(), "km": strconv.FormatFloat(cfg.Office.DistanceKm(*r.Location), 'f', 1, 64)})
+			}
+			return cfg.T("info.location", Args{"location": r.Location.String()})
+		},
+	},
+	{
+		Key: "address", Kind: kindString, MaxLen: maxAddressLength, Example: `"Main Street 1"`,
+		get: func(r *Restaurant) any { return r.Address },
+		set: func(r *Restaurant, v any) { r.Address = v.(string) },
+	},
+	{
+		Key: "link", Kind: kindString, MaxLen: maxLinkLength, Hint: "attributes.hint_link", Example: "https://example.com",
+		get: func(r *Restaurant) any { return r.Link },
+		set: func(r *Restaurant, v any) {
+			if r.Link != v.(string) {
+				r.Preview = nil
+			}
+			r.Link = v.(string)
+		},
+		parse: func(s string) (any, bool) { return s, validLink(s) && utf8.RuneCountInString(s) <= maxLinkLength },
+		info: func(cfg GuildConfig, r *Restaurant) string {
+			if r.Link == "" {
+				return ""
+			}
+			return cfg.T("info.link", Args{"link": "<" + r.Link + ">"})
+		},
+	},
+	{
+		Key: "reservation", Kind: kindBool, Example: "yes", Filter: filterEqual,
+		get: func(r *Restaurant) any { return r.Reservation },
+		set: func(r *Restaurant, v any) { r.Reservation = v.(bool) },
+		info: func(cfg GuildConfig, r *Restaurant) string {
+			if !r.Reservation {
+				return ""
+			}
+			return cfg.T("info.reservation", nil)
+		},
+	},
+	{
+		Key: "delivery", Kind: kindBool, Example: "yes", Filter: filterEqual,
+		get: func(r *Restaurant) any { return r.Delivery },
+		set: func(r *Restaurant, v any) { r.Delivery = v.(bool) },
+	},
+	{
+		Key: "capacity", Kind: kindInt, Min: 1, Max: maxCapacity, Example: "8", Filter: filterEqual, FilterKey: "party",
+		get:  func(r *Restaurant) any { return r.Capacity },
+		set:  func(r *Restaurant, v any) { r.Capacity = v.(int) },
+		node: func(v any) filterNode { return partyNode{v.(int)} },
+		info: func(cfg GuildConfig, r *Restaurant) string {
+			if r.Capacity == 0 {
+				return ""
+			}
+			return cfg.T("info.capacity", Args{"count": r.Capacity})
+		},
+	},
+	{
+		Key: "wait", Kind: kindInt, Min: 1, Max: maxWait, Example: "15", Filter: filterEqual, FilterKey: "max-wait", Private: true,
+		get: func(r *Restaurant) any { return r.Wait },
+		// A wait set by hand replaces the attendees' reports.
+		set: func(r *Restaurant, v any) { r.Wait, r.WaitReports = v.(int), nil },
+		parse: func(s string) (any, bool) {
+			n, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(s), "min"))
+			return n, err == nil && n >= 1 && n <= maxWait
+		},
+		node: func(v any) filterNode { return waitNode{max: v.(int)} },
+		info: func(cfg GuildConfig, r *Restaurant) string {
+			wait, ok := r.WaitTime()
+			switch {
+			case !ok:
+				return ""
+			case len(r.WaitReports) > 0:
+				return cfg.T("info.wait_reported", Args{"minutes": wait, "count": len(r.WaitReports)})
+			}
+			return cfg.T("info.wait", Args{"minutes": wait})
+		},
+	},
+	{
+		Key: "payment", Kind: kindEnum, Options: paymentMethods, Multi: true, Example: "cards,vouchers", Filter: filterEqual,
+		get: func(r *Restaurant) any { return r.Payment },
+		set: func(r *Restaurant, v any) { r.Payment = slices.Clone(v.([]string)) },
+	},
+}
+
+// attributeByKey returns the attribute with a key, nil when there is none.
+func attributeByKey(key string) *attribute {
+	for _, a := range attributeRegistry {
+		if strings.EqualFold(a.Key, key) {
+			return a
+		}
+	}
+	return nil
+}
+
+// filterAttribute returns the attribute filtered by terms with a key, nil when there is none.
+func filterAttribute(key string) *attribute {
+	for _, a := range attributeRegistry {
+		if a.Filter != filterNone && strings.EqualFold(a.filterKey(), key) {
+			return a
+		}
+	}
+	return nil
+}
+
+// filterKey returns the key of the attribute's filter terms.
+func (a *attribute) filterKey() string {
+	if a.FilterKey != "" {
+		return a.FilterKey
+	}
+	return a.Key
+}
+
+// zero returns the value of an unset attribute.
+func (a *attribute) zero() any {
+	switch a.Kind {
+	case kindBool:
+		return false
+	case kindInt:
+		return 0
+	case kindLocation:
+		return (*Location)(nil)
+	case kindEnum:
+		if a.Multi {
+			return []string(nil)
+		}
+	}
+	return ""
+}
+
+// hasValue reports whether an attribute value is set.
+func hasValue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	case *Location:
+		return v != nil
+	}
+	return false
+}
+
+// option returns the option of a kindEnum attribute written as s.
+func (a *attribute) option(s string) (string, bool) {
+	for _, option := range a.Options {
+		if strings.EqualFold(strings.TrimSpace(s), option) {
+			return option, true
+		}
+	}
+	return "", false
+}
+
+// parseValue parses a value as written for !set, where none clears the attribute.
+func (a *attribute) parseValue(s string) (any, bool) {
+	if strings.EqualFold(s, "none") {
+		return a.zero(), true
+	}
+	if a.parse != nil {
+		return a.parse(s)
+	}
+	switch a.Kind {
+	case kindBool:
+		switch strings.ToLower(s) {
+		case "yes", "true", "on":
+			return true, true
+		case "no", "false", "off":
+			return false, true
+		}
+	case kindInt:
+		n, err := strconv.Atoi(s)
+		if err == nil && n >= a.Min && n <= a.Max {
+			return n, true
+		}
+	case kindEnum:
+		if !a.Multi {
+			return a.option(s)
+		}
+		var options []string
+		for _, part := range strings.Split(s, ",") {
+			option, ok := a.option(part)
+			if !ok {
+				return nil, false
+			}
+			if !slices.Contains(options, option) {
+				options = append(options, option)
+			}
+		}
+		sort.Strings(options)
+		return options, true
+	case kindString:
+		if utf8.RuneCountInString(s) <= a.MaxLen {
+			return s, true
+		}
+	case kindLocation:
+		if l, ok := parseLocation(s); ok {
+			return l, true
+		}
+	}
+	return nil, false
+}
+
+// valid reports whether a stored value is one the attribute accepts, as
+// values from imports and shared lists haven't been through parseValue.
+func (a *attribute) valid(value any) bool {
+	if !hasValue(value) {
+		return true
+	}
+	switch a.Kind {
+	case kindInt:
+		n := value.(int)
+		return n >= a.Min && n <= a.Max
+	case kindEnum:
+		if !a.Multi {
+			return slices.Contains(a.Options, value.(string))
+		}
+		for _, option := range value.([]string) {
+			if !slices.Contains(a.Options, option) {
+				return false
+			}
+		}
+	case kindString:
+		if a.parse != nil {
+			_, ok := a.parse(value.(string))
+			return ok
+		}
+		return utf8.RuneCountInString(value.(string)) <= a.MaxLen
+	case kindLocation:
+		_, ok := parseLocation(value.(*Location).String())
+		return ok
+	}
+	return true
+}
+
+// formatValue renders a value the way parseValue accepts it, "" when unset.
+func (a *attribute) formatValue(value any) string {
+	if !hasValue(value) && a.Kind != kindBool {
+		return ""
+	}
+	if a.format != nil {
+		return a.format(value)
+	}
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case *Location:
+		return v.String()
+	}
+	return ""
+}
+
+// name returns the attribute's display name.
+func (a *attribute) name(cfg GuildConfig) string {
+	return cfg.T("attribute."+a.Key, nil)
+}
+
+// hint describes the values the attribute accepts.
+func (a *attribute) hint(cfg GuildConfig) string {
+	if a.Hint != "" {
+		return cfg.T(a.Hint, nil)
+	}
+	switch a.Kind {
+	case kindBool:
+		return cfg.T("attributes.hint_bool", nil)
+	case kindInt:
+		return cfg.T("attributes.hint_int", Args{"min": a.Min, "max": a.Max})
+	case kindEnum:
+		if a.Multi {
+			return cfg.T("attributes.hint_options", Args{"options": strings.Join(a.Options, ", ")})
+		}
+		return cfg.T("attributes.hint_option", Args{"options": strings.Join(a.Options, ", ")})
+	case kindLocation:
+		return cfg.T("attributes.hint_location", nil)
+	}
+	return cfg.T("attributes.hint_string", Args{"count": a.MaxLen})
+}
+
+// infoLine renders the attribute's !info line, "" when it isn't set.
+func (a *attribute) infoLine(cfg GuildConfig, r *Restaurant) string {
+	if a.info != nil {
+		return a.info(cfg, r)
+	}
+	value := a.get(r)
+	if !hasValue(value) {
+		return ""
+	}
+	if a.Kind == kindBool {
+		return cfg.T("info.attribute_yes", Args{"name": a.name(cfg)})
+	}
+	return cfg.T("info.attribute", Args{"name": a.name(cfg), "value": a.formatValue(value)})
+}
+
+// attributeNode matches restaurants by the value of an attribute, as
+// declared by its Filter.
+type attributeNode struct {
+	attr  *attribute
+	op    string
+	value any
+}
+
+func (n attributeNode) match(r *Restaurant) bool {
+	got := n.attr.get(r)
+	switch {
+	case n.op != "":
+		have, want := got.(int), n.value.(int)
+		if have == 0 {
+			return false
+		}
+		switch n.op {
+		case "<":
+			return have < want
+		case "<=":
+			return have <= want
+		case ">":
+			return have > want
+		}
+		return have >= want
+	case n.attr.Multi:
+		want := n.value.([]string)
+		if len(want) == 0 {
+			return !hasValue(got)
+		}
+		for _, option := range want {
+			if !slices.Contains(got.([]string), option) {
+				return false
+			}
+		}
+		return true
+	}
+	return got == n.value
+}
+
+// filterTerm parses the value of the attribute's filter term, as in price:<=$$.
+func (a *attribute) filterTerm(value string) (filterNode, bool) {
+	op := ""
+	if a.Filter == filterCompare {
+		for _, candidate := range []string{"<=", ">=", "<", ">"} {
+			if strings.HasPrefix(value, candidate) {
+				op, value = candidate, strings.TrimPrefix(value, candidate)
+				break
+			}
+		}
+	}
+	parsed, ok := a.parseValue(value)
+	if !ok || (op != "" && !hasValue(parsed)) {
+		return nil, false
+	}
+	if a.node != nil {
+		if !hasValue(parsed) {
+			return nil, false
+		}
+		return a.node(parsed), true
+	}
+	return attributeNode{attr: a, op: op, value: parsed}, true
+}
+
+// dropInvalidAttributes clears the attributes whose value the registry
+// rejects, reporting whether there were any.
+func (r *Restaurant) dropInvalidAttributes() bool {
+	dropped := false
+	for _, a := range attributeRegistry {
+		if !a.valid(a.get(r)) {
+			a.set(r, a.zero())
+			dropped = true
+		}
+	}
+	return dropped
+}
+
+// attributeChange maps the keys of the attributes `!set` changes to their new
+// values, the zero value clearing an attribute. Other attributes are left alone.
+type attributeChange map[string]any
+
+// SetAttributes changes a restaurant's attributes on behalf of by and returns
+// the updated entry.
+func SetAttributes(guildID, name string, change attributeChange, by *Contributor) (Restaurant, error) {
+	var updated Restaurant
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		details := r.details()
+		change.apply(r)
+		r.revise(details, by)
+		updated = *r
+		return nil
+	})
+	return updated, err
+}
+
+// apply makes the change to r.
+func (change attributeChange) apply(r *Restaurant) {
+	for _, a := range attributeRegistry {
+		if value, ok := change[a.Key]; ok {
+			a.set(r, value)
+		}
+	}
+}
+
+// parseAttributes parses `key=value` pairs of `!set`. On error it returns the
+// offending pair and its attribute, nil when the key is unknown.
+func parseAttributes(fields []string) (attributeChange, string, *attribute) {
+	change := attributeChange{}
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		a := attributeByKey(key)
+		if a == nil {
+			return change, field, nil
+		}
+		parsed, ok := a.parseValue(value)
+		if !ok {
+			return change, field, a
+		}
+		change[a.Key] = parsed
+	}
+	return change, "", nil
+}
+
+// setFields splits the key=value pairs of !set at spaces, except within a
+// quoted value like address="Main Street 1", whose quotes are dropped.
+func setFields(s string) []string {
+	var fields []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key, rest, _ := strings.Cut(s, "=")
+		if !strings.ContainsFunc(key, unicode.IsSpace) {
+			if value, after, ok := parseQuoted(rest); ok {
+				fields = append(fields, key+"="+value)
+				s = after
+				continue
+			}
+		}
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			end = len(s)
+		}
+		fields = append(fields, s[:end])
+		s = s[end:]
+	}
+	return fields
+}
+
+// handleSet implements `!set "Name" key=value…` for the attributes of attributeRegistry.
+func handleSet(c *Context) {
+	name, rest, ok := parseRef(c.Args)
+	if !ok || name == "" || rest == "" {
+		c.Reply("set.usage", nil)
+		return
+	}
+	change, invalid, a := parseAttributes(setFields(rest))
+	if invalid != "" {
+		if a == nil {
+			c.Reply("set.unknown", Args{"field": invalid})
+			return
+		}
+		c.Reply("set.invalid", Args{"field": invalid, "name": a.name(c.Config), "hint": a.hint(c.Config)})
+		return
+	}
+
+	by := contributorFor(c.Message.Author)
+	r, err := SetAttributes(c.GuildID, name, change, &by)
+	if err != nil {
+		log.Printf("Failed to set attributes: %v", err)
+		c.replyError("set.failed", err, name)
+		return
+	}
+	c.Ack("set.done", Args{"name": r.Name, "entry": listEntry(r)})
+	if _, ok := change["link"]; ok {
+		schedulePreview(c.GuildID, r, time.Now())
+	}
+}
+
+// handleAttributes implements `!attributes`, listing what `!set` and filters accept.
+func handleAttributes(c *Context) {
+	lines := []string{c.T("attributes.header", nil)}
+	for _, a := range attributeRegistry {
+		line := c.T("attributes.line", Args{"name": a.name(c.Config), "key": a.Key, "example": a.Example, "hint": a.hint(c.Config)})
+		switch a.Filter {
+		case filterEqual:
+			line += " · " + c.T("attributes.filter", Args{"term": a.filterKey() + ":" + strings.Split(a.Example, ",")[0]})
+		case filterCompare:
+			line += " · " + c.T("attributes.filter", Args{"term": a.filterKey() + ":<=" + a.Example})
+		}
+		lines = append(lines, line)
+	}
+	c.Send(strings.Join(lines, "\n"))
+}
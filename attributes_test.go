@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestAttributeRegistry checks every declaration: its example is accepted
+// and renders back to itself, its zero value is valid and unset, and its
+// display name and hint are in the catalog.
+func TestAttributeRegistry(t *testing.T) {
+	keys, filterKeys := map[string]bool{}, map[string]bool{}
+	for _, a := range attributeRegistry {
+		if keys[a.Key] {
+			t.Errorf("%s: declared twice", a.Key)
+		}
+		keys[a.Key] = true
+		if a.Filter != filterNone {
+			if filterKeys[a.filterKey()] {
+				t.Errorf("%s: filter key %s taken", a.Key, a.filterKey())
+			}
+			filterKeys[a.filterKey()] = true
+		}
+		if a.get == nil || a.set == nil {
+			t.Errorf("%s: missing get or set", a.Key)
+			continue
+		}
+		if a.Filter == filterCompare && a.Kind != kindInt {
+			t.Errorf("%s: comparisons need whole numbers", a.Key)
+		}
+
+		example, ok := a.parseValue(strings.Trim(a.Example, `"`))
+		if !ok || !hasValue(example) || !a.valid(example) {
+			t.Errorf("%s: example %s = %v, %v", a.Key, a.Example, example, ok)
+			continue
+		}
+		again, ok := a.parseValue(a.formatValue(example))
+		if !ok || !reflect.DeepEqual(again, example) {
+			t.Errorf("%s: %v renders as %q, which parses as %v", a.Key, example, a.formatValue(example), again)
+		}
+		var r Restaurant
+		a.set(&r, example)
+		if got := a.get(&r); !reflect.DeepEqual(got, example) {
+			t.Errorf("%s: set %v, got %v", a.Key, example, got)
+		}
+
+		zero := a.zero()
+		if hasValue(zero) || !a.valid(zero) {
+			t.Errorf("%s: zero value %#v is set or invalid", a.Key, zero)
+		}
+		if cleared, ok := a.parseValue("none"); !ok || !reflect.DeepEqual(cleared, zero) {
+			t.Errorf("%s: none parses as %#v, want %#v", a.Key, cleared, zero)
+		}
+		if got := a.get(&Restaurant{}); !reflect.DeepEqual(got, zero) {
+			t.Errorf("%s: new restaurant has %#v, want %#v", a.Key, got, zero)
+		}
+
+		for _, key := range []string{"attribute." + a.Key, a.Hint} {
+			if _, _, ok := translator.lookup(defaultLanguage, key); key != "" && !ok {
+				t.Errorf("%s: missing catalog key %q", a.Key, key)
+			}
+		}
+	}
+}
+
+func TestAttributeParseValue(t *testing.T) {
+	tests := []struct {
+		key, input string
+		want       any
+		ok         bool
+	}{
+		// kindBool
+		{"delivery", "yes", true, true},
+		{"delivery", "ON", true, true},
+		{"delivery", "false", false, true},
+		{"delivery", "maybe", nil, false},
+		// kindInt
+		{"capacity", "8", 8, true},
+		{"capacity", "1", 1, true},
+		{"capacity", "1000", 1000, true},
+		{"capacity", "0", nil, false},
+		{"capacity", "1001", nil, false},
+		{"capacity", "eight", nil, false},
+		{"capacity", "none", 0, true},
+		// kindInt with its own syntax
+		{"price", "$$", 2, true},
+		{"price", "$$$$", 4, true},
+		{"price", "$$$$$", 0, false},
+		{"wait", "15min", 15, true},
+		{"wait", "241", 0, false},
+		// kindEnum sets
+		{"diet", "vegan", []string{"vegan"}, true},
+		{"diet", "Vegan, halal,vegan", []string{"halal", "vegan"}, true},
+		{"diet", "vegan,paleo", nil, false},
+		{"diet", "none", []string(nil), true},
+		{"payment", "cards", []string{"cards"}, true},
+		// kindString
+		{"address", "Main Street 1", "Main Street 1", true},
+		{"address", strings.Repeat("a", maxAddressLength), strings.Repeat("a", maxAddressLength), true},
+		{"address", strings.Repeat("a", maxAddressLength+1), nil, false},
+		{"address", strings.Repeat("ß", maxAddressLength), strings.Repeat("ß", maxAddressLength), true},
+		{"link", "https://example.com/menu", "https://example.com/menu", true},
+		{"link", "ftp://example.com", "ftp://example.com", false},
+		{"link", "example.com", "example.com", false},
+		// kindLocation
+		{"location", "52.52,13.405", &Location{Lat: 52.52, Lon: 13.405}, true},
+		{"location", "91,0", nil, false},
+		{"location", "0,181", nil, false},
+		{"location", "52.52", nil, false},
+		{"location", "none", (*Location)(nil), true},
+	}
+	for _, tt := range tests {
+		a := attributeByKey(tt.key)
+		if a == nil {
+			t.Fatalf("no attribute %s", tt.key)
+		}
+		got, ok := a.parseValue(tt.input)
+		if ok != tt.ok || ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseValue(%q) = %#v, %v, want %#v, %v", tt.key, tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAttributeValid(t *testing.T) {
+	tests := []struct {
+		key   string
+		value any
+		want  bool
+	}{
+		{"price", 4, true},
+		{"price", 5, false},
+		{"price", -1, false},
+		{"capacity", 0, true},
+		{"capacity", 1001, false},
+		{"diet", []string{"vegan", "halal"}, true},
+		{"diet", []string{"vegan", "paleo"}, false},
+		{"payment", []string{"bitcoin"}, false},
+		{"address", strings.Repeat("a", maxAddressLength+1), false},
+		{"link", "javascript:alert(1)", false},
+		{"link", "", true},
+		{"location", &Location{Lat: 52, Lon: 13}, true},
+		{"location", &Location{Lat: 95, Lon: 13}, false},
+		{"location", (*Location)(nil), true},
+		{"delivery", true, true},
+	}
+	for _, tt := range tests {
+		if got := attributeByKey(tt.key).valid(tt.value); got != tt.want {
+			t.Errorf("%s: valid(%#v) = %v, want %v", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDropInvalidAttributes(t *testing.T) {
+	r := Restaurant{Price: 9, Diet: []string{"vegan"}, Payment: []string{"bitcoin"}, Link: "ftp://x", Capacity: 8}
+	if !r.dropInvalidAttributes() {
+		t.Fatal("nothing dropped")
+	}
+	want := Restaurant{Diet: []string{"vegan"}, Capacity: 8}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("after dropping: %+v, want %+v", r, want)
+	}
+	if r.dropInvalidAttributes() {
+		t.Error("dropped again")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// attributionMention renders contributors as mentions that don't ping.
+	attributionMention = "mention"
+	// attributionName renders contributors by their name.
+	attributionName = "name"
+)
+
+// maxContributors is the number of members shown by !contributors.
+const maxContributors = 10
+
+// Contributor identifies the member who made a change.
+type Contributor struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Author returns the member who sent the command.
+func (c *Context) Author() Contributor {
+	return contributorFor(c.Message.Author)
+}
+
+// contributorFor identifies a user by ID and display name.
+func contributorFor(u *discordgo.User) Contributor {
+	name := u.GlobalName
+	if name == "" {
+		name = u.Username
+	}
+	return Contributor{ID: u.ID, Name: name}
+}
+
+// SendQuiet sends text that may contain user mentions without pinging anyone.
+func (c *Context) SendQuiet(text string) {
+	_, err := c.SendComplex(&discordgo.MessageSend{
+		Content:         text,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to send message to %s: %v", c.Message.ChannelID, err)
+	}
+}
+
+// formatContributor renders a contributor according to the guild's attribution style.
+func formatContributor(cfg GuildConfig, by *Contributor) string {
+	switch {
+	case by == nil:
+		return cfg.T("attribution.unknown", nil)
+	case by.ID == "":
+		// Members removed with !forget-me.
+		return cfg.T("attribution.deleted", nil)
+	case cfg.AttributionStyle == attributionName:
+		return by.Name
+	}
+	return "<@" + by.ID + ">"
+}
+
+// attributionLine describes who added a restaurant and when.
+func attributionLine(cfg GuildConfig, r Restaurant) string {
+	by := formatContributor(cfg, r.AddedBy)
+	if r.AddedAt.IsZero() {
+		return cfg.T("attribution.added_undated", Args{"by": by})
+	}
+	return cfg.T("attribution.added", Args{"by": by, "date": r.AddedAt.Format("2006-01-02")})
+}
+
+// contribution is a member's number of adds.
+type contribution struct {
+	By   *Contributor
+	Adds int
+}
+
+// contributions counts the adds per member, most active first, with
+// unattributed entries last. Removed entries still count.
+func (g *GuildData) contributions() []contribution {
+	byID := map[string]*contribution{}
+	var unknown contribution
+	for _, r := range g.Restaurants {
+		if r.AddedBy == nil {
+			unknown.Adds++
+			continue
+		}
+		entry, ok := byID[r.AddedBy.ID]
+		if !ok {
+			entry = &contribution{By: r.AddedBy}
+			byID[r.AddedBy.ID] = entry
+		}
+		// Keep the most recent name the member added under.
+		entry.By = r.AddedBy
+		entry.Adds++
+	}
+
+	var list []contribution
+	for _, entry := range byID {
+		list = append(list, *entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Adds != list[j].Adds {
+			return list[i].Adds > list[j].Adds
+		}
+		return lessFold(list[i].By.Name, list[j].By.Name)
+	})
+	if unknown.Adds > 0 {
+		list = append(list, unknown)
+	}
+	return list
+}
+
+// handleWhoAdded implements `!who-added "Name"`.
+func handleWhoAdded(c *Context) {
+	name, _, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("attribution.usage", nil)
+		return
+	}
+	r, err := GetRestaurant(c.GuildID, name)
+	if err != nil {
+		log.Printf("Failed to get restaurant: %v", err)
+		c.replyError("info.failed", err, name)
+		return
+	}
+	c.SendQuiet("**" + r.Name + "**: " + attributionLine(c.Config, r))
+}
+
+// handleContributors implements `!contributors`.
+func handleContributors(c *Context) {
+	var list []contribution
+	err := viewGuild(c.GuildID, func(g *GuildData) error {
+		list = g.contributions()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to count contributions: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	if len(list) == 0 {
+		c.Reply("list.empty", nil)
+		return
+	}
+
+	lines := []string{c.T("attribution.contributors_header", nil)}
+	more := 0
+	for i, entry := range list {
+		switch {
+		case entry.By == nil:
+			lines = append(lines, c.T("attribution.contributors_unknown", Args{"count": entry.Adds}))
+		case i < maxContributors:
+			lines = append(lines, c.T("attribution.contributors_line", Args{"rank": i + 1, "by": formatContributor(c.Config, entry.By), "count": entry.Adds}))
+		default:
+			more++
+		}
+	}
+	if more > 0 {
+		lines = append(lines, c.T("attribution.contributors_more", Args{"count": more}))
+	}
+	c.SendQuiet(strings.Join(lines, "\n"))
+}
+
+// handleAttributionSetting implements `!settings attribution mention|name`.
+func handleAttributionSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.attribution", Args{"value": c.Config.attributionStyle()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	style := strings.ToLower(fields[0])
+	if len(fields) != 1 || (style != attributionMention && style != attributionName) {
+		c.Reply("settings.attribution_invalid", nil)
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.AttributionStyle = style
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save attribution style: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Reply("settings.attribution_set", Args{"value": style})
+}
+
+// attributionStyle returns how contributors are rendered.
+func (cfg GuildConfig) attributionStyle() string {
+	if cfg.AttributionStyle == "" {
+		return attributionMention
+	}
+	return cfg.AttributionStyle
+}
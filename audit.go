@@ -0,0 +1,99 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxAuditEntries is the number of audit log entries kept per guild.
+	maxAuditEntries = 1000
+	// auditPageSize is the number of entries !audit shows by default.
+	auditPageSize = 10
+)
+
+// Audit actions.
+const (
+	auditAdd    = "add"
+	auditRemove = "remove"
+	auditMerge  = "merge"
+	auditEdit   = "edit"
+	auditUndo   = "undo"
+)
+
+// Audit sources.
+const (
+	sourceDiscord   = "discord"
+	sourceAPI       = "api"
+	sourceDirectory = "directory"
+)
+
+// AuditEntry records a change to a guild's list.
+type AuditEntry struct {
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+	Name   string    `json:"name"`
+	// By is the member who made the change, nil for changes from outside Discord.
+	By *Contributor `json:"by,omitempty"`
+	// Source is where the change came from: discord, or the source an API client gave.
+	Source string `json:"source"`
+	// Voters are the members who voted for a change decided by a vote.
+	Voters []Contributor `json:"voters,omitempty"`
+	// Origin is the ID of the guild an entry imported from the directory came from.
+	Origin string `json:"origin,omitempty"`
+}
+
+// audit appends an entry to the guild's audit log, dropping the oldest
+// entries beyond maxAuditEntries.
+func (g *GuildData) audit(action, name string, by *Contributor, source string) {
+	g.Audit = append(g.Audit, AuditEntry{At: time.Now().UTC(), Action: action, Name: name, By: by, Source: source})
+	if extra := len(g.Audit) - maxAuditEntries; extra > 0 {
+		g.Audit = g.Audit[extra:]
+	}
+}
+
+// handleAudit implements `!audit [N]`, listing the most recent changes.
+func handleAudit(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	n := auditPageSize
+	if c.Args != "" {
+		var err error
+		if n, err = strconv.Atoi(c.Args); err != nil || n < 1 {
+			c.Reply("audit.usage", nil)
+			return
+		}
+	}
+	var entries []AuditEntry
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		entries = g.Audit[max(len(g.Audit)-n, 0):]
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load audit log: %v", err)
+		c.Reply("audit.failed", nil)
+		return
+	}
+	if len(entries) == 0 {
+		c.Reply("audit.empty", nil)
+		return
+	}
+
+	var lines []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		line := c.T("audit.line", Args{
+			"date":   e.At.In(c.Config.location()).Format("2006-01-02 15:04"),
+			"action": e.Action,
+			"name":   e.Name,
+			"by":     formatContributor(c.Config, e.By),
+			"source": e.Source,
+		})
+		if e.Origin != "" {
+			line += " " + c.T("audit.origin", Args{"guild": e.Origin})
+		}
+		lines = append(lines, line)
+	}
+	c.SendPages(c.T("audit.header", Args{"count": len(entries)}), lines)
+}
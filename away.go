@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// away reports whether the member is away on a day formatted as YYYY-MM-DD.
+// Members are away up to and including AwayUntil.
+func (m MemberSettings) away(today string) bool {
+	return m.AwayUntil != "" && today <= m.AwayUntil
+}
+
+// awayMembers returns the IDs of the members away on a day, sorted.
+func (g *GuildData) awayMembers(today string) []string {
+	var ids []string
+	for id, m := range g.Members {
+		if m.away(today) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SetAway marks a member away until a day formatted as YYYY-MM-DD, or back when until is empty.
+func SetAway(guildID, userID, until string) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		g.updateMember(userID, func(m *MemberSettings) { m.AwayUntil = until })
+		return nil
+	})
+}
+
+// handleAway implements `!away until YYYY-MM-DD` and `!away who`.
+func handleAway(c *Context) {
+	fields := strings.Fields(c.Args)
+	today := localDate(time.Now(), c.Config.location())
+	if len(fields) == 1 && strings.EqualFold(fields[0], "who") {
+		var away []string
+		var until map[string]string
+		if err := viewGuild(c.GuildID, func(g *GuildData) error {
+			away = g.awayMembers(today)
+			until = map[string]string{}
+			for _, id := range away {
+				until[id] = g.Members[id].AwayUntil
+			}
+			return nil
+		}); err != nil {
+			log.Printf("Failed to load away members: %v", err)
+			c.Reply("away.failed", nil)
+			return
+		}
+		if len(away) == 0 {
+			c.Reply("away.nobody", nil)
+			return
+		}
+		lines := []string{c.T("away.header", Args{"count": len(away)})}
+		for _, id := range away {
+			lines = append(lines, c.T("away.line", Args{"user": "<@" + id + ">", "date": until[id]}))
+		}
+		c.SendQuiet(strings.Join(lines, "\n"))
+		return
+	}
+
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "until") {
+		c.Reply("away.usage", nil)
+		return
+	}
+	date, err := time.Parse("2006-01-02", fields[1])
+	if err != nil {
+		c.Reply("away.usage", nil)
+		return
+	}
+	until := date.Format("2006-01-02")
+	if until < today {
+		c.Reply("away.past", Args{"date": until})
+		return
+	}
+	if err := SetAway(c.GuildID, c.Message.Author.ID, until); err != nil {
+		log.Printf("Failed to save away state: %v", err)
+		c.Reply("away.failed", nil)
+		return
+	}
+	c.Reply("away.set", Args{"date": until})
+}
+
+// handleBack implements `!back`, ending the author's time away early.
+func handleBack(c *Context) {
+	if err := SetAway(c.GuildID, c.Message.Author.ID, ""); err != nil {
+		log.Printf("Failed to save away state: %v", err)
+		c.Reply("away.failed", nil)
+		return
+	}
+	c.Reply("away.back", nil)
+}
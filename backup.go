@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// defaultBackupIntervalDays is used when a guild enables backups without an interval.
+	defaultBackupIntervalDays = 7
+	// backupRetryDelay is how long to wait after a failed backup before trying again.
+	backupRetryDelay = 24 * time.Hour
+	// maxBackupSize bounds the attachments !restore is willing to download.
+	maxBackupSize = 8 << 20
+	// encryptedBackupSuffix is appended to the names of encrypted backups.
+	encryptedBackupSuffix = ".enc"
+)
+
+// BackupRecord describes the last successful backup of a guild.
+type BackupRecord struct {
+	At        time.Time `json:"at,omitzero"`
+	ChannelID string    `json:"channel_id,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	// FailedAt is set when the latest attempt failed, so the next one is delayed.
+	FailedAt time.Time `json:"failed_at,omitzero"`
+}
+
+// backupFile is the content of a backup attachment.
+type backupFile struct {
+	Version   int        `json:"version"`
+	GuildID   string     `json:"guild_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Data      *GuildData `json:"data"`
+}
+
+// attachmentClient downloads attachments such as backups and imports.
+var attachmentClient = &http.Client{Timeout: 30 * time.Second}
+
+// messageLinkPattern matches links to Discord messages.
+var messageLinkPattern = regexp.MustCompile(`https://(?:(?:ptb|canary)\.)?discord(?:app)?\.com/channels/(\d+)/(\d+)/(\d+)`)
+
+// backupIntervalDays returns the configured backup interval.
+func (cfg GuildConfig) backupIntervalDays() int {
+	if cfg.BackupIntervalDays > 0 {
+		return cfg.BackupIntervalDays
+	}
+	return defaultBackupIntervalDays
+}
+
+// postBackup uploads a snapshot of a guild's data to a channel.
+func postBackup(s *discordgo.Session, guildID, channelID string, cfg GuildConfig, g *GuildData, key string) (*discordgo.Message, error) {
+	now := time.Now().UTC()
+	data, err := json.MarshalIndent(backupFile{Version: schemaVersion, GuildID: guildID, CreatedAt: now, Data: g}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// Backups are encrypted like the database file.
+	file := &discordgo.File{Name: fmt.Sprintf("backup-%s.json", now.Format("2006-01-02")), ContentType: "application/json"}
+	if currentKey != nil {
+		if data, err = encryptPayload(data); err != nil {
+			return nil, err
+		}
+		file.Name += encryptedBackupSuffix
+		file.ContentType = "application/octet-stream"
+	}
+	file.Reader = bytes.NewReader(data)
+	return s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: cfg.T(key, Args{"date": now.Format("2006-01-02"), "count": g.count()}),
+		Files:   []*discordgo.File{file},
+	})
+}
+
+// RunBackup posts a backup of a guild to its backup channel, retrying once on failure.
+func RunBackup(s *discordgo.Session, guildID string) error {
+	var cfg GuildConfig
+	var snapshot GuildData
+	if err := viewGuild(guildID, func(g *GuildData) error {
+		cfg, snapshot = g.Config, *g
+		return nil
+	}); err != nil {
+		return err
+	}
+	if cfg.BackupChannelID == "" {
+		return errors.New("no backup channel configured")
+	}
+
+	msg, err := postBackup(s, guildID, cfg.BackupChannelID, cfg, &snapshot, "backup.message")
+	if err != nil {
+		log.Printf("Backup for guild %s failed, retrying: %v", guildID, err)
+		msg, err = postBackup(s, guildID, cfg.BackupChannelID, cfg, &snapshot, "backup.message")
+	}
+
+	now := time.Now().UTC()
+	if saveErr := updateGuild(guildID, func(g *GuildData) error {
+		if err != nil {
+			// Keep the last successful backup visible in !stats.
+			if g.LastBackup == nil {
+				g.LastBackup = &BackupRecord{}
+			}
+			g.LastBackup.FailedAt = now
+			return nil
+		}
+		g.LastBackup = &BackupRecord{At: now, ChannelID: msg.ChannelID, MessageID: msg.ID}
+		return nil
+	}); saveErr != nil {
+		log.Printf("Failed to record backup for guild %s: %v", guildID, saveErr)
+	}
+	return err
+}
+
+// runScheduledBackups backs up every guild whose backup is due.
+func runScheduledBackups(s *discordgo.Session, now time.Time) {
+	var due []string
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if g.Config.BackupChannelID == "" {
+			return
+		}
+		if last := g.LastBackup; last != nil {
+			if !last.FailedAt.IsZero() && now.Sub(last.FailedAt) < backupRetryDelay {
+				return
+			}
+			if now.Sub(last.At) < time.Duration(g.Config.backupIntervalDays())*24*time.Hour {
+				return
+			}
+		}
+		due = append(due, guildID)
+	})
+	if err != nil {
+		log.Printf("Failed to check scheduled backups: %v", err)
+		return
+	}
+
+	for _, guildID := range due {
+		if err := RunBackup(s, guildID); err != nil {
+			reportError(s, "Scheduled backup for guild %s failed: %v", guildID, err)
+		}
+	}
+}
+
+// handleBackupSetting implements `!settings backup [#channel|off|now]` and
+// `!settings backup interval <days>`.
+func handleBackupSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		if c.Config.BackupChannelID == "" {
+			c.Reply("backup.setting_off", nil)
+		} else {
+			c.Reply("backup.setting_on", Args{"channel": "<#" + c.Config.BackupChannelID + ">", "count": c.Config.backupIntervalDays()})
+		}
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+
+	var update func(cfg *GuildConfig)
+	switch arg := strings.ToLower(fields[0]); {
+	case arg == "now":
+		if c.Config.BackupChannelID == "" {
+			c.Reply("backup.setting_off", nil)
+			return
+		}
+		if err := RunBackup(c.Session, c.GuildID); err != nil {
+			log.Printf("Manual backup failed: %v", err)
+			c.Reply("backup.failed", nil)
+			return
+		}
+		c.Reply("backup.done", Args{"channel": "<#" + c.Config.BackupChannelID + ">"})
+		return
+	case arg == "off":
+		update = func(cfg *GuildConfig) { cfg.BackupChannelID = "" }
+	case arg == "interval":
+		days := 0
+		if len(fields) == 2 {
+			days, _ = strconv.Atoi(strings.TrimSuffix(fields[1], "d"))
+		}
+		if days < 1 || days > 90 {
+			c.Reply("backup.interval_usage", nil)
+			return
+		}
+		update = func(cfg *GuildConfig) { cfg.BackupIntervalDays = days }
+	default:
+		channelID, ok := parseChannelMention(fields[0])
+		if !ok {
+			c.Reply("backup.usage", nil)
+			return
+		}
+		update = func(cfg *GuildConfig) { cfg.BackupChannelID = channelID }
+	}
+
+	var cfg GuildConfig
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		update(&g.Config)
+		cfg = g.Config
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save backup setting: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config = cfg
+	handleBackupSetting(c, nil)
+}
+
+// parseChannelMention extracts the ID from a <#id> channel mention.
+func parseChannelMention(s string) (string, bool) {
+	if !strings.HasPrefix(s, "<#") || !strings.HasSuffix(s, ">") {
+		return "", false
+	}
+	id := s[2 : len(s)-1]
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// handleRestore implements `!restore <message link>` and `!restore` sent as a
+// reply to a backup message.
+func handleRestore(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+
+	channelID, messageID := "", ""
+	if match := messageLinkPattern.FindStringSubmatch(c.Args); match != nil {
+		if match[1] != c.GuildID {
+			c.Reply("restore.other_guild", nil)
+			return
+		}
+		channelID, messageID = match[2], match[3]
+	} else if ref := c.Message.MessageReference; ref != nil {
+		channelID, messageID = ref.ChannelID, ref.MessageID
+	} else {
+		c.Reply("restore.usage", nil)
+		return
+	}
+
+	msg, err := c.Session.ChannelMessage(channelID, messageID)
+	if err != nil {
+		log.Printf("Failed to fetch backup message: %v", err)
+		c.Reply("restore.fetch_failed", nil)
+		return
+	}
+	if msg.Author == nil || msg.Author.ID != c.Session.State.User.ID || len(msg.Attachments) != 1 ||
+		!strings.HasSuffix(strings.TrimSuffix(msg.Attachments[0].Filename, encryptedBackupSuffix), ".json") {
+		c.Reply("restore.not_backup", nil)
+		return
+	}
+
+	backup, err := downloadBackup(c.Ctx, msg.Attachments[0])
+	if err != nil {
+		log.Printf("Failed to read backup %s: %v", msg.Attachments[0].URL, err)
+		if !c.timedOut(err) {
+			c.Reply("restore.invalid", Args{"error": err})
+		}
+		return
+	}
+	if backup.GuildID != c.GuildID {
+		c.Reply("restore.other_guild", nil)
+		return
+	}
+
+	// Take a safety backup of the current data before replacing it.
+	var current GuildData
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		current = *g
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load guild for safety backup: %v", err)
+		c.Reply("restore.failed", nil)
+		return
+	}
+	safetyChannel := c.Config.BackupChannelID
+	if safetyChannel == "" {
+		safetyChannel = c.Message.ChannelID
+	}
+	if _, err := postBackup(c.Session, c.GuildID, safetyChannel, c.Config, &current, "backup.safety_message"); err != nil {
+		log.Printf("Safety backup failed: %v", err)
+		c.Reply("restore.safety_failed", nil)
+		return
+	}
+
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		restored := *backup.Data
+		restored.LastBackup = g.LastBackup
+		*g = restored
+		return nil
+	}, syncSave); err != nil {
+		log.Printf("Failed to restore backup: %v", err)
+		c.Reply("restore.failed", nil)
+		return
+	}
+	c.Reply("restore.done", Args{"date": backup.CreatedAt.Format("2006-01-02"), "count": backup.Data.count()})
+}
+
+// downloadAttachment fetches an attachment of at most maxSize bytes.
+func downloadAttachment(ctx context.Context, a *discordgo.MessageAttachment, maxSize int) ([]byte, error) {
+	if a.Size > maxSize {
+		return nil, errors.New("the attachment is too large")
+	}
+	defer enterStage(ctx, "attachment download")()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := attachmentClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)))
+}
+
+// downloadBackup fetches and validates a backup attachment.
+func downloadBackup(ctx context.Context, a *discordgo.MessageAttachment) (*backupFile, error) {
+	data, err := downloadAttachment(ctx, a, maxBackupSize)
+	if err == nil {
+		data, err = decryptPayload(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backup backupFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&backup); err != nil {
+		return nil, fmt.Errorf("not a valid backup file: %w", err)
+	}
+	if backup.Version < 2 || backup.Version > schemaVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", backup.Version)
+	}
+	if backup.Data == nil {
+		return nil, errors.New("the backup contains no data")
+	}
+	for i, r := range backup.Data.Restaurants {
+		if strings.TrimSpace(r.Name) == "" {
+			return nil, fmt.Errorf("restaurant %d has no name", i+1)
+		}
+	}
+	if backup.Data.Restaurants == nil {
+		backup.Data.Restaurants = []Restaurant{}
+	}
+	return &backup, nil
+}
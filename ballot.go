@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxBallotLabel bounds the length of a ballot button's label, in runes.
+const maxBallotLabel = 80
+
+// ErrPollClosed is returned when voting in a poll that is no longer open.
+var ErrPollClosed = errors.New("poll closed")
+
+// ballotTally counts the votes of an anonymous poll for each option.
+func ballotTally(poll Poll) []int {
+	votes := make([]int, len(poll.Options))
+	for _, option := range poll.Ballots {
+		if option >= 0 && option < len(votes) {
+			votes[option]++
+		}
+	}
+	return votes
+}
+
+// ballotButtons is the row of buttons voting in an anonymous poll. The guild
+// ID is part of the custom ID since the buttons are sent in direct messages.
+func ballotButtons(guildID string, poll Poll) discordgo.MessageComponent {
+	var buttons []discordgo.Button
+	for i, name := range poll.Options {
+		emoji := restaurantEmoji(poll.emoji(i))
+		buttons = append(buttons, discordgo.Button{
+			Label:    truncateRunes(name, maxBallotLabel),
+			Emoji:    &discordgo.ComponentEmoji{Name: emoji.Name, ID: emoji.ID, Animated: emoji.Animated},
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("ballot:%s:%s:%d", guildID, poll.MessageID, i),
+		})
+	}
+	return buttonRow(buttons...)
+}
+
+// sendBallots sends the ballot of an anonymous poll to each participant and
+// returns how many of them couldn't be reached by direct message.
+func sendBallots(s *discordgo.Session, guildID string, cfg GuildConfig, poll Poll, participants []string) int {
+	unreachable := 0
+	ballot := &discordgo.MessageSend{
+		Content:    cfg.T("ballot.dm", Args{"channel": "<#" + poll.ChannelID + ">", "time": fmt.Sprintf("<t:%d:R>", poll.ClosesAt.Unix())}),
+		Components: []discordgo.MessageComponent{ballotButtons(guildID, poll)},
+	}
+	for _, id := range participants {
+		dm, err := s.UserChannelCreate(id)
+		if err == nil {
+			_, err = s.ChannelMessageSendComplex(dm.ID, ballot)
+		}
+		if err != nil {
+			log.Printf("Failed to send ballot to %s: %v", id, err)
+			unreachable++
+		}
+	}
+	return unreachable
+}
+
+// RecordBallot stores a member's vote in an anonymous poll, replacing any
+// earlier vote. It returns the name of the option voted for.
+func RecordBallot(guildID, messageID, userID string, option int) (string, error) {
+	var name string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		for i := range g.Polls {
+			p := &g.Polls[i]
+			if p.MessageID != messageID || !p.Anonymous {
+				continue
+			}
+			if option < 0 || option >= len(p.Options) {
+				return ErrPollClosed
+			}
+			if p.Ballots == nil {
+				p.Ballots = map[string]int{}
+			}
+			p.Ballots[userID] = option
+			name = p.Options[option]
+			return nil
+		}
+		return ErrPollClosed
+	})
+	return name, err
+}
+
+// handleBallotComponent handles the buttons of an anonymous poll's ballot.
+func handleBallotComponent(i *Interaction) {
+	if len(i.Args) != 3 || i.Args[0] != i.GuildID {
+		return
+	}
+	option, err := strconv.Atoi(i.Args[2])
+	if err != nil {
+		return
+	}
+	name, err := RecordBallot(i.GuildID, i.Args[1], i.UserID(), option)
+	switch {
+	case errors.Is(err, ErrPollClosed):
+		i.Ephemeral("ballot.closed", nil)
+	case err != nil:
+		log.Printf("Failed to record ballot: %v", err)
+		i.Ephemeral("ballot.failed", nil)
+	default:
+		i.Ephemeral("ballot.recorded", Args{"name": name})
+	}
+}
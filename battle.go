@@ -0,0 +1,376 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// eloBaseline is the score of a restaurant that hasn't been in a battle.
+	eloBaseline = 1500
+	// eloK is how far a single battle moves the scores.
+	eloK = 32
+	// battleDuration is how long a battle collects votes.
+	battleDuration = 2 * time.Minute
+	// rankingsSize is the number of restaurants !rankings shows.
+	rankingsSize = 10
+)
+
+// Pick weightings.
+const (
+	pickWeightRecency  = "recency"
+	pickWeightElo      = "elo"
+	pickWeightUniform  = "uniform"
+	pickWeightRating   = "rating"
+	pickWeightCombined = "combined"
+)
+
+// pickWeights are the weightings `!settings random-weighting` accepts.
+var pickWeights = []string{pickWeightRecency, pickWeightRating, pickWeightCombined, pickWeightUniform, pickWeightElo}
+
+// ErrBattleClosed is returned when voting on a battle that has ended.
+var ErrBattleClosed = errors.New("the battle has ended")
+
+// Battle is an open head-to-head vote between two restaurants.
+type Battle struct {
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+	// IDs and Names are the two restaurants, by stable ID and as shown.
+	IDs   [2]string `json:"ids"`
+	Names [2]string `json:"names"`
+	// Votes holds each member's choice, 0 or 1, keyed by user ID.
+	Votes    map[string]int `json:"votes,omitempty"`
+	ClosesAt time.Time      `json:"closes_at"`
+}
+
+// tally counts the votes for each side.
+func (b Battle) tally() [2]int {
+	var votes [2]int
+	for _, v := range b.Votes {
+		votes[v]++
+	}
+	return votes
+}
+
+// elo returns the restaurant's Elo score.
+func (r *Restaurant) elo() float64 {
+	if r.Battles == 0 {
+		return eloBaseline
+	}
+	return r.Elo
+}
+
+// eloExpected returns the score a player rated a is expected to make against one rated b.
+func eloExpected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// eloUpdate returns the new scores of a and b after a game in which a scored
+// scoreA: 1 for a win, 0.5 for a draw and 0 for a loss.
+func eloUpdate(a, b, scoreA float64) (float64, float64) {
+	delta := eloK * (scoreA - eloExpected(a, b))
+	return a + delta, b - delta
+}
+
+// eloWeight scales the recency weight by the odds the Elo scores imply, so
+// that a restaurant 400 points ahead is ten times as likely to be picked.
+func eloWeight(r Restaurant, now time.Time) float64 {
+	return recencyWeight(r, now) * math.Pow(10, (r.elo()-eloBaseline)/400)
+}
+
+// pickWeight returns the weighting the guild's random picker uses. The
+// rating weightings rate unrated restaurants at the median of restaurants.
+func (cfg GuildConfig) pickWeight(restaurants []Restaurant, now time.Time) func(Restaurant) float64 {
+	rating := func() func(Restaurant) float64 {
+		median := medianRating(restaurants, cfg, now)
+		return func(r Restaurant) float64 {
+			avg, ok := r.Rating(cfg, now)
+			if !ok {
+				avg = median
+			}
+			return ratingWeight(avg)
+		}
+	}
+	switch cfg.PickWeight {
+	case pickWeightElo:
+		return func(r Restaurant) float64 { return eloWeight(r, now) }
+	case pickWeightUniform:
+		return uniformWeight
+	case pickWeightRating:
+		return rating()
+	case pickWeightCombined:
+		weight := rating()
+		return func(r Restaurant) float64 { return weight(r) * recencyWeight(r, now) }
+	}
+	return func(r Restaurant) float64 { return recencyWeight(r, now) }
+}
+
+// handleBattle implements `!battle [filter]`, pitting two random restaurants against each other.
+func handleBattle(c *Context) {
+	query, ok := parsePickQuery(c)
+	if !ok {
+		return
+	}
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	pair := weightedSample(query.Apply(restaurants), 2, uniformWeight)
+	if len(pair) < 2 {
+		c.Reply("battle.too_few", nil)
+		return
+	}
+
+	battle := Battle{
+		ChannelID: c.Message.ChannelID,
+		IDs:       [2]string{pair[0].ID, pair[1].ID},
+		Names:     [2]string{pair[0].Name, pair[1].Name},
+		ClosesAt:  time.Now().UTC().Add(battleDuration),
+	}
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content: c.T("battle.header", Args{"a": pair[0].Name, "b": pair[1].Name, "minutes": int(battleDuration.Minutes())}),
+		Components: []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: "A: " + pair[0].Name, Style: discordgo.PrimaryButton, CustomID: "battle:0"},
+			discordgo.Button{Label: "B: " + pair[1].Name, Style: discordgo.PrimaryButton, CustomID: "battle:1"},
+		)},
+	})
+	if err != nil {
+		log.Printf("Failed to send battle: %v", err)
+		return
+	}
+	battle.MessageID = msg.ID
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Battles = append(g.Battles, battle)
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save battle: %v", err)
+		return
+	}
+	// The scheduler closes battles left open by a restart.
+	time.AfterFunc(battleDuration, func() { closeBattle(c.Session, c.GuildID, c.Config, msg.ID) })
+}
+
+// VoteInBattle records a member's vote, replacing an earlier vote of theirs.
+func VoteInBattle(guildID, messageID, userID string, side int, now time.Time) (string, error) {
+	var name string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		for i := range g.Battles {
+			b := &g.Battles[i]
+			if b.MessageID != messageID {
+				continue
+			}
+			if !now.Before(b.ClosesAt) {
+				return ErrBattleClosed
+			}
+			if b.Votes == nil {
+				b.Votes = map[string]int{}
+			}
+			b.Votes[userID] = side
+			name = b.Names[side]
+			return nil
+		}
+		return ErrBattleClosed
+	})
+	return name, err
+}
+
+// handleBattleComponent handles the A and B buttons of a battle.
+func handleBattleComponent(i *Interaction) {
+	if len(i.Args) != 1 || (i.Args[0] != "0" && i.Args[0] != "1") {
+		return
+	}
+	side := int(i.Args[0][0] - '0')
+	name, err := VoteInBattle(i.Event.GuildID, i.Event.Message.ID, i.UserID(), side, time.Now())
+	switch {
+	case errors.Is(err, ErrBattleClosed):
+		i.Ephemeral("battle.closed", nil)
+	case err != nil:
+		log.Printf("Failed to record battle vote: %v", err)
+		i.Ephemeral("battle.vote_failed", nil)
+	default:
+		i.Ephemeral("battle.voted", Args{"name": name})
+	}
+}
+
+// battleOutcome is the result of a closed battle.
+type battleOutcome struct {
+	Battle Battle
+	Votes  [2]int
+	// Before and After are the scores of both restaurants around the update.
+	Before, After [2]float64
+	// Scored is false when nobody voted or a restaurant is gone.
+	Scored bool
+}
+
+// FinishBattle closes a battle and updates the Elo scores of both restaurants.
+// It returns false if the battle had already been closed.
+func FinishBattle(guildID, messageID string) (battleOutcome, bool, error) {
+	var out battleOutcome
+	found := false
+	err := updateGuild(guildID, func(g *GuildData) error {
+		for bi, b := range g.Battles {
+			if b.MessageID != messageID {
+				continue
+			}
+			found = true
+			g.Battles = append(g.Battles[:bi], g.Battles[bi+1:]...)
+			out.Battle, out.Votes = b, b.tally()
+			ai, bj := g.findID(b.IDs[0]), g.findID(b.IDs[1])
+			if ai < 0 || bj < 0 || out.Votes[0]+out.Votes[1] == 0 {
+				return nil
+			}
+			ra, rb := &g.Restaurants[ai], &g.Restaurants[bj]
+			score := 0.5
+			if out.Votes[0] > out.Votes[1] {
+				score = 1
+			} else if out.Votes[0] < out.Votes[1] {
+				score = 0
+			}
+			out.Before = [2]float64{ra.elo(), rb.elo()}
+			ra.Elo, rb.Elo = eloUpdate(out.Before[0], out.Before[1], score)
+			ra.Battles++
+			rb.Battles++
+			out.After = [2]float64{ra.Elo, rb.Elo}
+			out.Scored = true
+			return nil
+		}
+		return nil
+	})
+	return out, found, err
+}
+
+// battleResult announces the outcome of a battle.
+func battleResult(cfg GuildConfig, out battleOutcome) string {
+	b, v := out.Battle, out.Votes
+	if !out.Scored {
+		return cfg.T("battle.no_votes", nil)
+	}
+	change := func(side int) string {
+		return fmt.Sprintf("%s %.0f (%+.0f)", b.Names[side], out.After[side], out.After[side]-out.Before[side])
+	}
+	args := Args{"a": b.Names[0], "b": b.Names[1], "votes_a": v[0], "votes_b": v[1], "scores": change(0) + ", " + change(1)}
+	switch {
+	case v[0] > v[1]:
+		args["winner"], args["loser"], args["won"], args["lost"] = b.Names[0], b.Names[1], v[0], v[1]
+	case v[1] > v[0]:
+		args["winner"], args["loser"], args["won"], args["lost"] = b.Names[1], b.Names[0], v[1], v[0]
+	default:
+		return cfg.T("battle.draw", args)
+	}
+	return cfg.T("battle.winner", args)
+}
+
+// closeBattle finishes a battle and replaces its buttons with the result.
+func closeBattle(s *discordgo.Session, guildID string, cfg GuildConfig, messageID string) {
+	out, found, err := FinishBattle(guildID, messageID)
+	if err != nil {
+		log.Printf("Failed to close battle %s: %v", messageID, err)
+		return
+	}
+	if !found {
+		return
+	}
+	content := cfg.T("battle.header_closed", Args{"a": out.Battle.Names[0], "b": out.Battle.Names[1]}) + "\n" + battleResult(cfg, out)
+	components := []discordgo.MessageComponent{}
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID: messageID, Channel: out.Battle.ChannelID, Content: &content, Components: &components,
+	}); err != nil {
+		log.Printf("Failed to close battle message %s: %v", messageID, err)
+	}
+}
+
+// closeDueBattles closes every battle whose time is up.
+func closeDueBattles(s *discordgo.Session, now time.Time) {
+	type dueBattle struct {
+		guildID   string
+		cfg       GuildConfig
+		messageID string
+	}
+	var due []dueBattle
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		for _, b := range g.Battles {
+			if !now.Before(b.ClosesAt) {
+				due = append(due, dueBattle{guildID, g.Config, b.MessageID})
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check open battles: %v", err)
+		return
+	}
+	for _, d := range due {
+		closeBattle(s, d.guildID, d.cfg, d.messageID)
+	}
+}
+
+// handleRankings implements `!rankings`, the Elo leaderboard of battles.
+func handleRankings(c *Context) {
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	var ranked []Restaurant
+	for _, r := range restaurants {
+		if r.Battles > 0 && !r.IsArchived() {
+			ranked = append(ranked, r)
+		}
+	}
+	if len(ranked) == 0 {
+		c.Reply("rankings.empty", nil)
+		return
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].elo() > ranked[j].elo() })
+	ranked = ranked[:min(len(ranked), rankingsSize)]
+
+	lines := []string{c.T("rankings.header", Args{"count": len(ranked)})}
+	for i, r := range ranked {
+		lines = append(lines, c.T("rankings.line", Args{
+			"rank": i + 1, "name": r.Name, "score": fmt.Sprintf("%.0f", r.elo()), "count": r.Battles,
+		}))
+	}
+	c.Send(strings.Join(lines, "\n"))
+}
+
+// handlePickWeightSetting implements `!settings random-weighting
+// [recency|rating|combined|uniform|elo]`, also known as pick-weight.
+func handlePickWeightSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.pick_weight", Args{"value": cmp.Or(c.Config.PickWeight, pickWeightRecency)})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	weight := strings.ToLower(fields[0])
+	if len(fields) != 1 || !slices.Contains(pickWeights, weight) {
+		c.Reply("settings.pick_weight_invalid", Args{"values": strings.Join(pickWeights, "|")})
+		return
+	}
+	stored := weight
+	if stored == pickWeightRecency {
+		stored = ""
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.PickWeight = stored
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save pick weight: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.PickWeight = stored
+	c.Reply("settings.pick_weight_set", Args{"value": weight})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandSource describes who sent a message that may run a command: "" for
+// a member, or "bot", "webhook" or "system".
+func commandSource(m *discordgo.Message) string {
+	switch {
+	case m.Type != discordgo.MessageTypeDefault && m.Type != discordgo.MessageTypeReply:
+		return "system"
+	case m.WebhookID != "":
+		return "webhook"
+	case m.Author == nil || m.Author.Bot:
+		return "bot"
+	}
+	return ""
+}
+
+// acceptCommand reports whether a message may run a command. System messages
+// never do, and messages from other bots and webhooks only where the guild
+// allows them, so that a bot echoing `!add` can't trigger us.
+func acceptCommand(m *discordgo.Message, cfg GuildConfig) bool {
+	switch source := commandSource(m); {
+	case source == "":
+		return true
+	case source == "system" || !cfg.AllowBots:
+		log.Printf("Ignored command from %s message %s in guild %s", source, m.ID, m.GuildID)
+		return false
+	}
+	return true
+}
+
+// handleAllowBotsSetting implements `!settings allow-bots [on|off]`.
+func handleAllowBotsSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply(allowBotsSettingKey(c.Config), nil)
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	var allow bool
+	switch value := strings.ToLower(fields[0]); {
+	case len(fields) != 1:
+		c.Reply("settings.allow_bots_invalid", nil)
+		return
+	case value == "on":
+		allow = true
+	case value != "off":
+		c.Reply("settings.allow_bots_invalid", nil)
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.AllowBots = allow
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save bot setting: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.AllowBots = allow
+	c.Reply(allowBotsSettingKey(c.Config), nil)
+}
+
+// allowBotsSettingKey returns the catalog key describing whether other bots
+// may run commands.
+func allowBotsSettingKey(cfg GuildConfig) string {
+	if cfg.AllowBots {
+		return "settings.allow_bots_on"
+	}
+	return "settings.allow_bots_off"
+}
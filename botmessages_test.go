@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestAcceptCommand(t *testing.T) {
+	member := &discordgo.User{ID: "1"}
+	bot := &discordgo.User{ID: "2", Bot: true}
+	tests := []struct {
+		name      string
+		msg       discordgo.Message
+		allowBots bool
+		want      bool
+	}{
+		{"member", discordgo.Message{Author: member}, false, true},
+		{"member reply", discordgo.Message{Author: member, Type: discordgo.MessageTypeReply}, false, true},
+		{"bot", discordgo.Message{Author: bot}, false, false},
+		{"bot allowed", discordgo.Message{Author: bot}, true, true},
+		{"no author", discordgo.Message{}, false, false},
+		{"webhook", discordgo.Message{Author: bot, WebhookID: "3"}, false, false},
+		{"webhook allowed", discordgo.Message{Author: bot, WebhookID: "3"}, true, true},
+		{"webhook as member", discordgo.Message{Author: member, WebhookID: "3"}, false, false},
+		{"system", discordgo.Message{Author: member, Type: discordgo.MessageTypeGuildMemberJoin}, false, false},
+		{"system with bots allowed", discordgo.Message{Author: member, Type: discordgo.MessageTypeChannelPinnedMessage}, true, false},
+		{"system from bot", discordgo.Message{Author: bot, Type: discordgo.MessageTypeUserPremiumGuildSubscription}, true, false},
+	}
+	for _, tt := range tests {
+		if got := acceptCommand(&tt.msg, GuildConfig{AllowBots: tt.allowBots}); got != tt.want {
+			t.Errorf("%s: acceptCommand = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
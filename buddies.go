@@ -0,0 +1,219 @@
+package main
+
+import (
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxBuddyGroupSize bounds the group size of !buddies.
+	maxBuddyGroupSize = 25
+	// buddyShuffles is how many shuffles !buddies tries to avoid repeating groups.
+	buddyShuffles = 200
+)
+
+// BuddyRound records the groups of the last !buddies in a guild.
+type BuddyRound struct {
+	// Date is the day in the guild's timezone as YYYY-MM-DD.
+	Date   string     `json:"date"`
+	Groups [][]string `json:"groups"`
+}
+
+// groupSizes splits n people into groups of about size, as evenly as
+// possible, so that no group is smaller than half of size.
+func groupSizes(n, size int) []int {
+	count := max((n+size-1)/size, 1)
+	sizes := make([]int, count)
+	for i := range sizes {
+		sizes[i] = n / count
+		if i < n%count {
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// repeatedPairs counts the pairs of people grouped together again since the last round.
+func repeatedPairs(groups, last [][]string) int {
+	together := map[[2]string]bool{}
+	for _, g := range last {
+		for i, a := range g {
+			for _, b := range g[i+1:] {
+				together[[2]string{min(a, b), max(a, b)}] = true
+			}
+		}
+	}
+	n := 0
+	for _, g := range groups {
+		for i, a := range g {
+			for _, b := range g[i+1:] {
+				if together[[2]string{min(a, b), max(a, b)}] {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// shuffleGroups splits people into random groups of about size. Given the
+// groups of an earlier round, it tries several shuffles and keeps the one
+// that repeats the fewest pairs.
+func shuffleGroups(people []string, size int, last [][]string) [][]string {
+	sizes := groupSizes(len(people), size)
+	var best [][]string
+	bestRepeats := -1
+	for try := 0; try < buddyShuffles && bestRepeats != 0; try++ {
+		shuffled := slices.Clone(people)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		groups := make([][]string, 0, len(sizes))
+		for _, n := range sizes {
+			groups = append(groups, shuffled[:n])
+			shuffled = shuffled[n:]
+		}
+		if repeats := repeatedPairs(groups, last); bestRepeats < 0 || repeats < bestRepeats {
+			best, bestRepeats = groups, repeats
+		}
+		if len(last) == 0 {
+			break
+		}
+	}
+	return best
+}
+
+// groupDiet returns the dietary options every member of a group needs.
+func groupDiet(group []string, members map[string]MemberSettings) []string {
+	var diet []string
+	for _, id := range group {
+		for _, d := range members[id].Diet {
+			if !slices.Contains(diet, d) {
+				diet = append(diet, d)
+			}
+		}
+	}
+	return diet
+}
+
+// assignRestaurants gives each group a different restaurant that caters for
+// all of its members. Groups with the most needs choose first; a group that
+// nothing fits gets nil.
+func assignRestaurants(groups [][]string, members map[string]MemberSettings, restaurants []Restaurant, weight func(Restaurant) float64) []*Restaurant {
+	diets := make([][]string, len(groups))
+	order := make([]int, len(groups))
+	for i, g := range groups {
+		diets[i] = groupDiet(g, members)
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(diets[order[a]]) > len(diets[order[b]]) })
+
+	assigned := make([]*Restaurant, len(groups))
+	used := map[string]bool{}
+	for _, gi := range order {
+		var fits []Restaurant
+		for _, r := range restaurants {
+			if used[r.ID] {
+				continue
+			}
+			ok := true
+			for _, d := range diets[gi] {
+				ok = ok && r.HasDiet(d)
+			}
+			if ok {
+				fits = append(fits, r)
+			}
+		}
+		if pick := weightedSample(fits, 1, weight); len(pick) == 1 {
+			assigned[gi] = &pick[0]
+			used[pick[0].ID] = true
+		}
+	}
+	return assigned
+}
+
+// handleBuddies implements `!buddies N @member...`, splitting the mentioned
+// members into lunch groups of about N, each with its own restaurant.
+func handleBuddies(c *Context) {
+	field, _, _ := strings.Cut(c.Args, " ")
+	size, err := strconv.Atoi(field)
+	var people []string
+	for _, u := range c.Message.Mentions {
+		if !u.Bot && !slices.Contains(people, u.ID) {
+			people = append(people, u.ID)
+		}
+	}
+	if err != nil || size < 2 || size > maxBuddyGroupSize || len(people) < 2 {
+		c.Reply("buddies.usage", Args{"max": maxBuddyGroupSize})
+		return
+	}
+
+	var restaurants []Restaurant
+	var members map[string]MemberSettings
+	var last *BuddyRound
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		restaurants, members, last = available(g.open(), g.Config, time.Now()), g.Members, g.LastBuddies
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load buddies data: %v", err)
+		c.Reply("buddies.failed", nil)
+		return
+	}
+
+	now := time.Now()
+	today := localDate(now, c.Config.location())
+	// Members who are away don't join, so their needs don't constrain the groups.
+	var skipped []string
+	people = slices.DeleteFunc(people, func(id string) bool {
+		if members[id].away(today) {
+			skipped = append(skipped, "<@"+id+">")
+			return true
+		}
+		return false
+	})
+	if len(people) < 2 {
+		c.SendQuiet(c.T("buddies.too_few_present", Args{"away": strings.Join(skipped, " ")}))
+		return
+	}
+	var previous [][]string
+	if last != nil && last.Date == today {
+		previous = last.Groups
+	}
+	groups := shuffleGroups(people, size, previous)
+	assigned := assignRestaurants(groups, members, restaurants, c.Config.pickWeight(restaurants, now))
+
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.LastBuddies = &BuddyRound{Date: today, Groups: groups}
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save buddies: %v", err)
+	}
+
+	lines := []string{c.T("buddies.header", Args{"count": len(groups)})}
+	for i, g := range groups {
+		mentions := make([]string, len(g))
+		for j, id := range g {
+			mentions[j] = "<@" + id + ">"
+		}
+		place := c.T("buddies.no_restaurant", nil)
+		if r := assigned[i]; r != nil {
+			place = r.Name
+		}
+		lines = append(lines, c.T("buddies.group", Args{"number": i + 1, "restaurant": place, "members": strings.Join(mentions, " ")}))
+	}
+	if len(skipped) > 0 {
+		lines = append(lines, c.T("buddies.skipped_away", Args{"away": strings.Join(skipped, " ")}))
+	}
+	// Only ping the members who are grouped, not the ones away.
+	if _, err := c.SendComplex(&discordgo.MessageSend{
+		Content:         strings.Join(lines, "\n"),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: people},
+	}); err != nil {
+		log.Printf("Failed to send buddies: %v", err)
+	}
+}
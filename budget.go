@@ -0,0 +1,301 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxExpenseNote bounds the length of an expense note, in runes.
+	maxExpenseNote = 200
+	// maxExpenseCents bounds a single expense, to catch typos like 8450 for 84.50.
+	maxExpenseCents = 10000_00
+	// maxBudgetCents bounds the monthly budget.
+	maxBudgetCents = 1000000_00
+	// expenseRetention is how long expenses are kept.
+	expenseRetention = 13 * 30 * 24 * time.Hour
+	// defaultCurrency is the currency symbol used until a guild sets one.
+	defaultCurrency = "€"
+)
+
+// ErrNoExpense is returned when undoing an expense a member never recorded.
+var ErrNoExpense = errors.New("no expense recorded")
+
+// Expense is money spent on a team lunch.
+type Expense struct {
+	// Cents is the amount in hundredths of the currency.
+	Cents        int       `json:"cents"`
+	RestaurantID string    `json:"restaurant_id,omitempty"`
+	Restaurant   string    `json:"restaurant"`
+	PayerID      string    `json:"payer_id"`
+	Note         string    `json:"note,omitempty"`
+	At           time.Time `json:"at"`
+	// Attendees is the number of people the expense was for, 0 when unknown.
+	Attendees int `json:"attendees,omitempty"`
+}
+
+// currency returns the guild's currency symbol.
+func (cfg GuildConfig) currency() string {
+	return cmp.Or(cfg.Currency, defaultCurrency)
+}
+
+// parseAmount parses an amount like 84.50, 84,50 or €84.50 into cents,
+// rejecting amounts that aren't positive or exceed max.
+func parseAmount(s, symbol string, max int) (int, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(s, symbol), symbol))
+	s = strings.Replace(s, ",", ".", 1)
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	if whole == "" || strings.Trim(whole, "0123456789") != "" || (hasFrac && (len(frac) == 0 || len(frac) > 2 || strings.Trim(frac, "0123456789") != "")) {
+		return 0, false
+	}
+	units, err := strconv.Atoi(whole)
+	if err != nil || units > max/100 {
+		return 0, false
+	}
+	cents := units * 100
+	if hasFrac {
+		f, _ := strconv.Atoi(frac)
+		if len(frac) == 1 {
+			f *= 10
+		}
+		cents += f
+	}
+	if cents <= 0 || cents > max {
+		return 0, false
+	}
+	return cents, true
+}
+
+// formatAmount renders cents with the currency symbol, e.g. €84.50.
+func formatAmount(cents int, symbol string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%s%d.%02d", sign, symbol, cents/100, cents%100)
+}
+
+// restaurantSpend is the money spent at one restaurant.
+type restaurantSpend struct {
+	Name  string
+	Cents int
+}
+
+// monthSpend totals the expenses between start and end, returning the total
+// and the spend per restaurant, largest first.
+func monthSpend(expenses []Expense, start, end time.Time) (int, []restaurantSpend) {
+	total := 0
+	byName := map[string]int{}
+	for _, e := range expenses {
+		if e.At.Before(start) || !e.At.Before(end) {
+			continue
+		}
+		total += e.Cents
+		byName[e.Restaurant] += e.Cents
+	}
+	var breakdown []restaurantSpend
+	for name, cents := range byName {
+		breakdown = append(breakdown, restaurantSpend{name, cents})
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Cents != breakdown[j].Cents {
+			return breakdown[i].Cents > breakdown[j].Cents
+		}
+		return breakdown[i].Name < breakdown[j].Name
+	})
+	return total, breakdown
+}
+
+// AddExpense records an expense at a restaurant, dropping expenses past
+// expenseRetention. Without a head count it is taken from that day's visit.
+func AddExpense(guildID, name string, e Expense) (Expense, error) {
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		e.Restaurant, e.RestaurantID = r.Name, r.ID
+		if e.Attendees == 0 {
+			e.Attendees = r.visitAttendees(e.At, g.Config.location())
+		}
+		g.Expenses = slices.DeleteFunc(g.Expenses, func(old Expense) bool { return e.At.Sub(old.At) > expenseRetention })
+		g.Expenses = append(g.Expenses, e)
+		g.updateCost(e.RestaurantID)
+		return nil
+	})
+	return e, err
+}
+
+// UndoExpense removes the last expense a member recorded and returns it.
+func UndoExpense(guildID, payerID string) (Expense, error) {
+	var removed Expense
+	err := updateGuild(guildID, func(g *GuildData) error {
+		last := -1
+		for i, e := range g.Expenses {
+			if e.PayerID == payerID && (last < 0 || !e.At.Before(g.Expenses[last].At)) {
+				last = i
+			}
+		}
+		if last < 0 {
+			return ErrNoExpense
+		}
+		removed = g.Expenses[last]
+		g.Expenses = slices.Delete(g.Expenses, last, last+1)
+		g.updateCost(removed.RestaurantID)
+		return nil
+	})
+	return removed, err
+}
+
+// handleSpend implements `!spend AMOUNT "Name" [people=N] [note]` and `!spend undo`.
+func handleSpend(c *Context) {
+	symbol := c.Config.currency()
+	if strings.EqualFold(c.Args, "undo") {
+		e, err := UndoExpense(c.GuildID, c.Message.Author.ID)
+		switch {
+		case errors.Is(err, ErrNoExpense):
+			c.Reply("spend.nothing_to_undo", nil)
+		case err != nil:
+			log.Printf("Failed to undo expense: %v", err)
+			c.Reply("spend.failed", nil)
+		default:
+			c.Reply("spend.undone", Args{"amount": formatAmount(e.Cents, symbol), "name": e.Restaurant})
+		}
+		return
+	}
+
+	amount, rest, _ := strings.Cut(c.Args, " ")
+	name, note, ok := parseRef(strings.TrimSpace(rest))
+	if !ok || name == "" {
+		c.Reply("spend.usage", nil)
+		return
+	}
+	attendees, note, ok := parseExpenseAttendees(note)
+	if !ok {
+		c.Reply("spend.invalid_people", Args{"max": maxExpenseAttendees})
+		return
+	}
+	if len([]rune(note)) > maxExpenseNote {
+		c.Reply("spend.note_too_long", Args{"count": maxExpenseNote})
+		return
+	}
+	cents, ok := parseAmount(amount, symbol, maxExpenseCents)
+	if !ok {
+		c.Reply("spend.invalid_amount", Args{"amount": amount, "max": formatAmount(maxExpenseCents, symbol)})
+		return
+	}
+	e, err := AddExpense(c.GuildID, name, Expense{Cents: cents, PayerID: c.Message.Author.ID, Note: note, At: time.Now().UTC(), Attendees: attendees})
+	if err != nil {
+		log.Printf("Failed to record expense: %v", err)
+		c.replyError("spend.failed", err, name)
+		return
+	}
+	if per, ok := e.perPerson(); ok {
+		c.Ack("spend.recorded_people", Args{"amount": formatAmount(e.Cents, symbol), "name": e.Restaurant, "count": e.Attendees, "per": formatAmount(per, symbol)})
+		return
+	}
+	c.Ack("spend.recorded", Args{"amount": formatAmount(e.Cents, symbol), "name": e.Restaurant})
+}
+
+// handleBudget implements `!budget` and `!budget set AMOUNT|off`.
+func handleBudget(c *Context) {
+	symbol := c.Config.currency()
+	fields := strings.Fields(c.Args)
+	if len(fields) > 0 {
+		if len(fields) != 2 || !strings.EqualFold(fields[0], "set") {
+			c.Reply("budget.usage", nil)
+			return
+		}
+		if !c.RequireAdmin() {
+			return
+		}
+		cents := 0
+		if !strings.EqualFold(fields[1], "off") {
+			var ok bool
+			if cents, ok = parseAmount(fields[1], symbol, maxBudgetCents); !ok {
+				c.Reply("spend.invalid_amount", Args{"amount": fields[1], "max": formatAmount(maxBudgetCents, symbol)})
+				return
+			}
+		}
+		if err := updateGuild(c.GuildID, func(g *GuildData) error {
+			g.Config.BudgetCents = cents
+			return nil
+		}); err != nil {
+			log.Printf("Failed to save budget: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		if cents == 0 {
+			c.Reply("budget.set_off", nil)
+		} else {
+			c.Reply("budget.set", Args{"amount": formatAmount(cents, symbol)})
+		}
+		return
+	}
+
+	var expenses []Expense
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		expenses = g.Expenses
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load expenses: %v", err)
+		c.Reply("spend.failed", nil)
+		return
+	}
+	start, end := monthRange(time.Now().In(c.Config.location()))
+	total, breakdown := monthSpend(expenses, start, end)
+	lines := []string{c.T("budget.header", Args{"month": start.Format("2006-01"), "amount": formatAmount(total, symbol)})}
+	if budget := c.Config.BudgetCents; budget > 0 {
+		key := "budget.remaining"
+		if total > budget {
+			key = "budget.over"
+		}
+		lines = append(lines, c.T(key, Args{"amount": formatAmount(budget-total, symbol), "over": formatAmount(total-budget, symbol), "budget": formatAmount(budget, symbol)}))
+	} else {
+		lines = append(lines, c.T("budget.no_cap", nil))
+	}
+	for _, s := range breakdown {
+		lines = append(lines, "- "+s.Name+": "+formatAmount(s.Cents, symbol))
+	}
+	c.Send(strings.Join(lines, "\n"))
+}
+
+// validCurrency reports whether a symbol is short and can't be mistaken for part of an amount.
+func validCurrency(symbol string) bool {
+	return len([]rune(symbol)) <= 3 && !strings.ContainsAny(symbol, "0123456789.,-\"`")
+}
+
+// handleCurrencySetting implements `!settings currency [SYMBOL]`.
+func handleCurrencySetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.currency", Args{"value": c.Config.currency()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	symbol := fields[0]
+	if len(fields) != 1 || !validCurrency(symbol) {
+		c.Reply("settings.currency_invalid", nil)
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.Currency = symbol
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save currency: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.Currency = symbol
+	c.Reply("settings.currency_set", Args{"value": symbol})
+}
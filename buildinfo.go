@@ -0,0 +1,135 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Build information, set with -ldflags "-X main.version=... -X main.commit=... -X main.buildTime=...".
+var (
+	version   = "dev"
+	commit    string
+	buildTime string
+)
+
+// startedAt is when the process started.
+var startedAt = time.Now()
+
+// gateway tracks the bot's gateway connections since start.
+var gateway struct {
+	sync.Mutex
+	connectedAt time.Time
+	connects    int
+}
+
+// buildInfo describes the running build. Commit and build time fall back to
+// the VCS stamp of the Go toolchain when not set at link time.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Go        string `json:"go"`
+	Discordgo string `json:"discordgo"`
+}
+
+// currentBuild returns the running build's information.
+func currentBuild() buildInfo {
+	info := buildInfo{Version: version, Commit: commit, BuildTime: buildTime, Go: runtime.Version(), Discordgo: discordgo.VERSION}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = cmp.Or(info.Commit, s.Value)
+			case "vcs.time":
+				info.BuildTime = cmp.Or(info.BuildTime, s.Value)
+			}
+		}
+	}
+	return info
+}
+
+// uptimeInfo describes how long the bot has been running and connected.
+type uptimeInfo struct {
+	StartedAt   time.Time `json:"started_at"`
+	ConnectedAt time.Time `json:"connected_at,omitzero"`
+	Reconnects  int       `json:"reconnects"`
+}
+
+// currentUptime returns the process and gateway uptime.
+func currentUptime() uptimeInfo {
+	gateway.Lock()
+	defer gateway.Unlock()
+	return uptimeInfo{StartedAt: startedAt, ConnectedAt: gateway.connectedAt, Reconnects: max(gateway.connects-1, 0)}
+}
+
+// HandleConnect records each gateway connection, the first and every reconnect.
+func (h *Handler) HandleConnect(s *discordgo.Session, c *discordgo.Connect) {
+	gateway.Lock()
+	defer gateway.Unlock()
+	gateway.connectedAt = time.Now()
+	gateway.connects++
+}
+
+// shortCommit abbreviates a commit hash for display.
+func shortCommit(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return cmp.Or(hash, "unknown")
+}
+
+// handleVersion implements `!version`.
+func handleVersion(c *Context) {
+	b := currentBuild()
+	c.Reply("version.info", Args{
+		"version":   b.Version,
+		"commit":    shortCommit(b.Commit),
+		"built":     cmp.Or(b.BuildTime, "unknown"),
+		"go":        b.Go,
+		"discordgo": b.Discordgo,
+	})
+}
+
+// handleUptime implements `!uptime`.
+func handleUptime(c *Context) {
+	u := currentUptime()
+	now := time.Now()
+	connected := c.T("uptime.not_connected", nil)
+	if !u.ConnectedAt.IsZero() {
+		connected = formatUptime(now.Sub(u.ConnectedAt))
+	}
+	c.Reply("uptime.info", Args{"uptime": formatUptime(now.Sub(u.StartedAt)), "connected": connected, "count": u.Reconnects})
+}
+
+// formatUptime renders a duration to the second, e.g. 3d4h5m6s.
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	if days == 0 {
+		return d.String()
+	}
+	return fmt.Sprintf("%dd%s", days, (d - days*24*time.Hour).String())
+}
+
+// handleHealth serves GET /health with the build and uptime information. The
+// status is degraded in read-only mode.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	status, ro := "ok", currentReadOnly()
+	if ro != nil {
+		status = "degraded"
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Status   string        `json:"status"`
+		Shard    shardInfo     `json:"shard"`
+		ReadOnly *readOnlyInfo `json:"read_only,omitempty"`
+		buildInfo
+		uptimeInfo
+	}{status, gatewayShards, ro, currentBuild(), currentUptime()})
+}
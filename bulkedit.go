@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxBulkEditSize bounds the attachments !bulk-edit is willing to download.
+const maxBulkEditSize = 1 << 20
+
+// errBulkInvalid aborts a bulk edit that has invalid operations.
+var errBulkInvalid = errors.New("the bulk edit has invalid operations")
+
+// bulkOp is one operation of a bulk edit file.
+type bulkOp struct {
+	ID  string                     `json:"id"`
+	Set map[string]json.RawMessage `json:"set"`
+
+	// line is where the operation starts in the file.
+	line int
+}
+
+// bulkProblem is an invalid operation, reported by line.
+type bulkProblem struct {
+	Line int
+	Key  string
+	Args Args
+}
+
+// bulkDiff is the change a bulk edit made to one restaurant.
+type bulkDiff struct {
+	Before Restaurant
+	After  Restaurant
+}
+
+// lineAt returns the line of the first value at or after offset in data.
+func lineAt(data []byte, offset int) int {
+	for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// parseBulkOps reads a JSON array of operations. Operations that don't match
+// the expected shape are reported as problems; a file that isn't valid JSON
+// is an error.
+func parseBulkOps(data []byte) ([]bulkOp, []bulkProblem, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, nil, errors.New("expected a JSON array of operations")
+	}
+	var ops []bulkOp
+	var problems []bulkProblem
+	for dec.More() {
+		line := lineAt(data, int(dec.InputOffset()))
+		var op bulkOp
+		if err := dec.Decode(&op); err != nil {
+			var syntax *json.SyntaxError
+			if errors.As(err, &syntax) {
+				return nil, nil, fmt.Errorf("line %d: %v", lineAt(data, int(syntax.Offset)-1), err)
+			}
+			problems = append(problems, bulkProblem{Line: line, Key: "bulkedit.bad_operation", Args: Args{"error": err}})
+			continue
+		}
+		op.line = line
+		ops = append(ops, op)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	return ops, problems, nil
+}
+
+// bulkChange validates the fields of an operation, translating them into the
+// `key=value` form of !set. Tags replace the entry's tags when present.
+func bulkChange(set map[string]json.RawMessage) (change attributeChange, tags []string, setTags bool, problem *bulkProblem) {
+	var fields []string
+	for _, key := range slices.Sorted(maps.Keys(set)) {
+		raw := set[key]
+		if key == "tags" {
+			var tokens []string
+			if err := json.Unmarshal(raw, &tokens); err != nil {
+				return change, nil, false, &bulkProblem{Key: "bulkedit.invalid_value", Args: Args{"field": key}}
+			}
+			for i, t := range tokens {
+				if !strings.HasPrefix(t, "#") {
+					tokens[i] = "#" + t
+				}
+			}
+			parsed, invalid := parseTags(tokens)
+			if invalid != "" {
+				return change, nil, false, &bulkProblem{Key: "bulkedit.invalid_value", Args: Args{"field": key}}
+			}
+			tags, setTags = parsed, true
+			continue
+		}
+
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return change, nil, false, &bulkProblem{Key: "bulkedit.invalid_value", Args: Args{"field": key}}
+		}
+		var text string
+		switch v := value.(type) {
+		case nil:
+			text = "none"
+		case string:
+			text = v
+		case float64:
+			text = fmt.Sprint(v)
+		case bool:
+			text = strconv.FormatBool(v)
+		case []any:
+			parts := make([]string, len(v))
+			for i, p := range v {
+				s, ok := p.(string)
+				if !ok {
+					return change, nil, false, &bulkProblem{Key: "bulkedit.invalid_value", Args: Args{"field": key}}
+				}
+				parts[i] = s
+			}
+			text = strings.Join(parts, ",")
+			if text == "" {
+				text = "none"
+			}
+		default:
+			return change, nil, false, &bulkProblem{Key: "bulkedit.invalid_value", Args: Args{"field": key}}
+		}
+		fields = append(fields, key+"="+text)
+	}
+	change, invalid, a := parseAttributes(fields)
+	if invalid != "" {
+		key, _, _ := strings.Cut(invalid, "=")
+		if a == nil {
+			return change, nil, false, &bulkProblem{Key: "bulkedit.unknown_field", Args: Args{"field": key}}
+		}
+		return change, nil, false, &bulkProblem{Key: "bulkedit.invalid_value", Args: Args{"field": key}}
+	}
+	return change, tags, setTags, nil
+}
+
+// BulkEdit validates every operation against the guild's list and, if all of
+// them are valid and dryRun is false, applies them in a single write. It
+// returns the entries that changed, or the problems if any operation is invalid.
+func BulkEdit(guildID string, ops []bulkOp, dryRun bool, by Contributor) ([]bulkDiff, []bulkProblem, error) {
+	var diffs []bulkDiff
+	var problems []bulkProblem
+	edit := func(g *GuildData) error {
+		seen := make(map[int]int, len(ops))
+		for _, op := range ops {
+			id := strings.TrimPrefix(strings.ToLower(op.ID), idPrefix)
+			if id == "" {
+				problems = append(problems, bulkProblem{Line: op.line, Key: "bulkedit.missing_id"})
+				continue
+			}
+			i := g.findID(id)
+			if i < 0 {
+				problems = append(problems, bulkProblem{Line: op.line, Key: "bulkedit.unknown_id", Args: Args{"id": idPrefix + id}})
+				continue
+			}
+			if first, ok := seen[i]; ok {
+				problems = append(problems, bulkProblem{Line: op.line, Key: "bulkedit.duplicate_id", Args: Args{"id": idPrefix + id, "first": first}})
+				continue
+			}
+			seen[i] = op.line
+			if len(op.Set) == 0 {
+				problems = append(problems, bulkProblem{Line: op.line, Key: "bulkedit.no_changes"})
+				continue
+			}
+			change, tags, setTags, problem := bulkChange(op.Set)
+			if problem != nil {
+				problem.Line = op.line
+				problems = append(problems, *problem)
+				continue
+			}
+
+			r := &g.Restaurants[i]
+			before := *r
+			before.Tags, before.Diet = slices.Clone(r.Tags), slices.Clone(r.Diet)
+			change.apply(r)
+			if setTags {
+				r.Tags = tags
+				sort.Strings(r.Tags)
+				r.Tags = slices.Compact(r.Tags)
+			}
+			if !sameState(before, *r) {
+				r.revise(before.details(), &by)
+				diffs = append(diffs, bulkDiff{Before: before, After: *r})
+				g.audit(auditEdit, r.Name, &by, sourceDiscord)
+			}
+		}
+		if len(problems) > 0 {
+			return errBulkInvalid
+		}
+		return nil
+	}
+
+	var err error
+	if dryRun {
+		err = viewGuild(guildID, edit)
+	} else {
+		err = updateGuild(guildID, edit)
+	}
+	if errors.Is(err, errBulkInvalid) {
+		return nil, problems, nil
+	}
+	return diffs, nil, err
+}
+
+// diffLine describes what a bulk edit changed about one restaurant.
+func diffLine(d bulkDiff) string {
+	return fmt.Sprintf("- `%s%s` %s: %s", idPrefix, d.After.ID, d.After.Name, strings.Join(diffChanges(d), "; "))
+}
+
+// diffChanges describes each detail of a restaurant that changed, as
+// "field before → after".
+func diffChanges(d bulkDiff) []string {
+	var changes []string
+	for _, c := range changedFields(d.Before.details(), d.After.details()) {
+		changes = append(changes, fieldChangeText(c))
+	}
+	return changes
+}
+
+// handleBulkEdit implements `!bulk-edit [dry-run]` with an attached JSON file
+// of `{"id": "4f", "set": {"tags": [...], "price": "$$"}}` operations.
+func handleBulkEdit(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	dryRun := strings.EqualFold(c.Args, "dry-run")
+	if len(c.Message.Attachments) == 0 || (c.Args != "" && !dryRun) {
+		c.Reply("bulkedit.usage", nil)
+		return
+	}
+	data, err := downloadAttachment(c.Ctx, c.Message.Attachments[0], maxBulkEditSize)
+	if err != nil {
+		log.Printf("Failed to download bulk edit: %v", err)
+		if !c.timedOut(err) {
+			c.Reply("import.download_failed", nil)
+		}
+		return
+	}
+	ops, problems, err := parseBulkOps(data)
+	if err != nil {
+		c.Reply("import.invalid", Args{"error": err})
+		return
+	}
+	if len(ops) == 0 && len(problems) == 0 {
+		c.Reply("bulkedit.empty", nil)
+		return
+	}
+
+	// A file with malformed operations is still checked against the list, so
+	// that every problem is reported at once.
+	diffs, more, err := BulkEdit(c.GuildID, ops, dryRun || len(problems) > 0, c.Author())
+	if err != nil {
+		log.Printf("Failed to apply bulk edit: %v", err)
+		c.Reply("bulkedit.failed", nil)
+		return
+	}
+	problems = append(problems, more...)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+
+	var lines []string
+	if len(problems) > 0 {
+		lines = append(lines, c.T("bulkedit.rejected", Args{"count": len(problems)}))
+		for _, p := range problems {
+			lines = append(lines, c.T("bulkedit.problem", Args{"line": p.Line, "problem": c.T(p.Key, p.Args)}))
+		}
+	} else {
+		key := "bulkedit.done"
+		if dryRun {
+			key = "bulkedit.dry_run"
+		}
+		lines = append(lines, c.T(key, Args{"count": len(diffs), "total": len(ops)}))
+		for _, d := range diffs {
+			lines = append(lines, diffLine(d))
+			if !dryRun && d.After.Link != d.Before.Link {
+				schedulePreview(c.GuildID, d.After, time.Now())
+			}
+		}
+	}
+
+	text := strings.Join(lines, "\n")
+	if len(text) <= maxInlineExport {
+		c.SendQuiet(text)
+		return
+	}
+	c.SendFile(lines[0], &discordgo.File{
+		Name:        "bulk-edit.txt",
+		ContentType: "text/plain",
+		Reader:      strings.NewReader(strings.Join(lines[1:], "\n")),
+	})
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// bulkRemoveTimeout is how long the confirm button of a bulk removal stays valid.
+	bulkRemoveTimeout = 60 * time.Second
+	// bulkRemovePageSize is the number of entries shown per preview page.
+	bulkRemovePageSize = 15
+)
+
+// bulkRemoval is a bulk removal waiting for confirmation.
+type bulkRemoval struct {
+	guildID string
+	userID  string
+	// filter describes what was matched, e.g. "#downtown" or "Sushi*".
+	filter  string
+	names   []string
+	page    int
+	expires time.Time
+}
+
+var (
+	// pendingBulkRemovals stores bulk removals waiting for confirmation, keyed by token.
+	pendingBulkRemovals      = make(map[string]*bulkRemoval)
+	pendingBulkRemovalsMutex sync.Mutex
+)
+
+// SoftDeleteRestaurants marks every active restaurant with one of the given names
+// as deleted in a single write, returning the deleted entries before and after.
+func SoftDeleteRestaurants(guildID string, names []string, by Contributor) (snapshot, error) {
+	remove := make(map[string]bool, len(names))
+	for _, n := range names {
+		remove[strings.ToLower(n)] = true
+	}
+	var change snapshot
+	err := updateGuild(guildID, func(g *GuildData) error {
+		now := time.Now().UTC()
+		for i := range g.Restaurants {
+			r := &g.Restaurants[i]
+			if !r.Deleted() && remove[strings.ToLower(r.Name)] {
+				change.Before = append(change.Before, *r)
+				r.DeletedAt = now
+				change.After = append(change.After, *r)
+				g.audit(auditRemove, r.Name, &by, sourceDiscord)
+			}
+		}
+		return nil
+	})
+	return change, err
+}
+
+// globPattern compiles a case-insensitive glob where * matches any run of
+// characters and ? a single character.
+func globPattern(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// handleRemoveAll implements `!remove-all #tag`.
+func handleRemoveAll(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	tag, ok := parseTag(c.Args)
+	if !ok {
+		c.Reply("bulkremove.tag_usage", nil)
+		return
+	}
+	startBulkRemoval(c, "#"+tag, func(r Restaurant) bool { return r.HasTag(tag) })
+}
+
+// handleRemoveMatching implements `!remove-matching "pattern"`.
+func handleRemoveMatching(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	glob, _, ok := parseQuoted(c.Args)
+	if !ok || glob == "" {
+		c.Reply("bulkremove.pattern_usage", nil)
+		return
+	}
+	pattern, err := globPattern(glob)
+	if err != nil {
+		c.Reply("bulkremove.pattern_usage", nil)
+		return
+	}
+	startBulkRemoval(c, glob, func(r Restaurant) bool { return pattern.MatchString(r.Name) })
+}
+
+// startBulkRemoval previews the entries matching a filter and asks for confirmation.
+func startBulkRemoval(c *Context, filter string, match func(Restaurant) bool) {
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	var names []string
+	for _, r := range restaurants {
+		if match(r) {
+			names = append(names, r.Name)
+		}
+	}
+	if len(names) == 0 {
+		c.Reply("bulkremove.nothing", Args{"filter": filter})
+		return
+	}
+
+	token := newToken()
+	op := &bulkRemoval{
+		guildID: c.GuildID,
+		userID:  c.Message.Author.ID,
+		filter:  filter,
+		names:   names,
+		expires: time.Now().Add(bulkRemoveTimeout),
+	}
+	pendingBulkRemovalsMutex.Lock()
+	pendingBulkRemovals[token] = op
+	pendingBulkRemovalsMutex.Unlock()
+
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content:    bulkRemovePreview(c.Config, op),
+		Components: bulkRemoveComponents(c.Config, token, op),
+	})
+	if err != nil {
+		log.Printf("Failed to send bulk removal preview: %v", err)
+		return
+	}
+
+	time.AfterFunc(bulkRemoveTimeout, func() {
+		pendingBulkRemovalsMutex.Lock()
+		_, pending := pendingBulkRemovals[token]
+		delete(pendingBulkRemovals, token)
+		pendingBulkRemovalsMutex.Unlock()
+		if !pending {
+			return
+		}
+		content := c.T("bulkremove.expired", Args{"filter": filter})
+		components := []discordgo.MessageComponent{}
+		if _, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: msg.ID, Channel: msg.ChannelID, Content: &content, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to expire bulk removal preview: %v", err)
+		}
+	})
+}
+
+// bulkRemovePages returns the number of preview pages of a bulk removal.
+func bulkRemovePages(op *bulkRemoval) int {
+	return (len(op.names) + bulkRemovePageSize - 1) / bulkRemovePageSize
+}
+
+// bulkRemovePreview renders the current preview page of a bulk removal.
+func bulkRemovePreview(cfg GuildConfig, op *bulkRemoval) string {
+	start := op.page * bulkRemovePageSize
+	end := min(start+bulkRemovePageSize, len(op.names))
+	lines := []string{cfg.T("bulkremove.preview", Args{"count": len(op.names), "filter": op.filter})}
+	for _, name := range op.names[start:end] {
+		lines = append(lines, "- "+name)
+	}
+	if pages := bulkRemovePages(op); pages > 1 {
+		lines = append(lines, cfg.T("bulkremove.page", Args{"page": op.page + 1, "pages": pages}))
+	}
+	lines = append(lines, cfg.T("bulkremove.confirm_hint", Args{"seconds": int(bulkRemoveTimeout.Seconds())}))
+	return strings.Join(lines, "\n")
+}
+
+// bulkRemoveComponents builds the paging and confirmation buttons of a bulk removal.
+func bulkRemoveComponents(cfg GuildConfig, token string, op *bulkRemoval) []discordgo.MessageComponent {
+	id := func(action string) string { return fmt.Sprintf("bulkrm:%s:%s", token, action) }
+	var components []discordgo.MessageComponent
+	if pages := bulkRemovePages(op); pages > 1 {
+		components = append(components, buttonRow(
+			discordgo.Button{Label: "◀", Style: discordgo.SecondaryButton, CustomID: id("prev"), Disabled: op.page == 0},
+			discordgo.Button{Label: "▶", Style: discordgo.SecondaryButton, CustomID: id("next"), Disabled: op.page == pages-1},
+		))
+	}
+	components = append(components, buttonRow(
+		discordgo.Button{Label: cfg.T("button.confirm", nil), Style: discordgo.DangerButton, CustomID: id("confirm")},
+		discordgo.Button{Label: cfg.T("button.cancel", nil), Style: discordgo.SecondaryButton, CustomID: id("cancel")},
+	))
+	return components
+}
+
+// handleBulkRemoveComponent handles the buttons of a bulk removal preview.
+func handleBulkRemoveComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pendingBulkRemovalsMutex.Lock()
+	op, ok := pendingBulkRemovals[token]
+	if ok && time.Now().After(op.expires) {
+		delete(pendingBulkRemovals, token)
+		ok = false
+	}
+	if !ok {
+		pendingBulkRemovalsMutex.Unlock()
+		i.Update(i.T("bulkremove.expired_generic", nil), nil)
+		return
+	}
+	if action == "confirm" || action == "cancel" {
+		if i.UserID() != op.userID {
+			pendingBulkRemovalsMutex.Unlock()
+			i.Ephemeral("bulkremove.not_yours", nil)
+			return
+		}
+		delete(pendingBulkRemovals, token)
+	}
+	switch action {
+	case "prev":
+		op.page = max(op.page-1, 0)
+	case "next":
+		op.page = min(op.page+1, bulkRemovePages(op)-1)
+	}
+	pendingBulkRemovalsMutex.Unlock()
+
+	switch action {
+	case "prev", "next":
+		i.Update(bulkRemovePreview(i.Config, op), bulkRemoveComponents(i.Config, token, op))
+	case "cancel":
+		i.Update(i.T("bulkremove.cancelled", Args{"filter": op.filter}), nil)
+	case "confirm":
+		change, err := SoftDeleteRestaurants(op.guildID, op.names, contributorFor(i.Event.Member.User))
+		if err != nil {
+			log.Printf("Failed to bulk remove restaurants: %v", err)
+			i.Update(i.T("bulkremove.failed", nil), nil)
+			return
+		}
+		text := i.T("bulkremove.done", Args{"count": len(change.After), "filter": op.filter}) + "\n" +
+			i.T("undo.hint", Args{"minutes": int(undoTimeout.Minutes())})
+		i.Update(text, []discordgo.MessageComponent{undoButton(i.Config, op.guildID, op.userID, change)})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+)
+
+// deepCopy returns a copy of v sharing no memory with it, for the decoded
+// guilds the store hands out. Only exported fields are copied deeply, so
+// values like time.Time, whose fields are unexported, are copied as they
+// are, as their JSON encoding would be.
+func deepCopy[T any](v *T) *T {
+	dst := new(T)
+	src := reflect.ValueOf(v).Elem()
+	if c := copierFor(src.Type()); c != nil {
+		c(reflect.ValueOf(dst).Elem(), src)
+	} else {
+		*dst = *v
+	}
+	return dst
+}
+
+// copier deep copies src into dst, which is settable and holds either the
+// zero value or src itself.
+type copier func(dst, src reflect.Value)
+
+// copiers caches the copier of each type, nil for types that can be copied
+// by assignment. Looking types up while copying is what would make copies
+// slow, so the copiers hold the ones of the types they contain.
+var copiers = struct {
+	sync.Mutex
+	m map[reflect.Type]copier
+}{m: map[reflect.Type]copier{}}
+
+// copierFor returns the copier of t, nil if assignment copies it deeply.
+func copierFor(t reflect.Type) copier {
+	copiers.Lock()
+	defer copiers.Unlock()
+	return buildCopier(t)
+}
+
+// buildCopier implements copierFor. The caller must hold copiers.
+func buildCopier(t reflect.Type) copier {
+	if c, ok := copiers.m[t]; ok {
+		return c
+	}
+	// Recursive types call the copier through this entry until it is built.
+	// They contain pointers, slices or maps, so theirs is never nil.
+	var built copier
+	copiers.m[t] = func(dst, src reflect.Value) { built(dst, src) }
+	built = newCopier(t)
+	copiers.m[t] = built
+	return built
+}
+
+// newCopier builds the copier of t. The caller must hold copiers.
+func newCopier(t reflect.Type) copier {
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := buildCopier(t.Elem())
+		return func(dst, src reflect.Value) {
+			if src.IsNil() {
+				return
+			}
+			p := reflect.New(t.Elem())
+			if elem != nil {
+				elem(p.Elem(), src.Elem())
+			} else {
+				p.Elem().Set(src.Elem())
+			}
+			dst.Set(p)
+		}
+	case reflect.Slice:
+		elem := buildCopier(t.Elem())
+		return func(dst, src reflect.Value) {
+			if src.IsNil() {
+				return
+			}
+			dst.Set(reflect.MakeSlice(t, src.Len(), src.Len()))
+			if elem == nil {
+				reflect.Copy(dst, src)
+				return
+			}
+			for i := range src.Len() {
+				elem(dst.Index(i), src.Index(i))
+			}
+		}
+	case reflect.Map:
+		elem := buildCopier(t.Elem())
+		return func(dst, src reflect.Value) {
+			if src.IsNil() {
+				return
+			}
+			dst.Set(reflect.MakeMapWithSize(t, src.Len()))
+			iter := src.MapRange()
+			for iter.Next() {
+				if elem == nil {
+					dst.SetMapIndex(iter.Key(), iter.Value())
+					continue
+				}
+				v := reflect.New(t.Elem()).Elem()
+				elem(v, iter.Value())
+				dst.SetMapIndex(iter.Key(), v)
+			}
+		}
+	case reflect.Interface:
+		return func(dst, src reflect.Value) {
+			if src.IsNil() {
+				return
+			}
+			v := reflect.New(src.Elem().Type()).Elem()
+			if c := copierFor(v.Type()); c != nil {
+				c(v, src.Elem())
+			} else {
+				v.Set(src.Elem())
+			}
+			dst.Set(v)
+		}
+	case reflect.Array:
+		elem := buildCopier(t.Elem())
+		if elem == nil {
+			return nil
+		}
+		return func(dst, src reflect.Value) {
+			for i := range src.Len() {
+				elem(dst.Index(i), src.Index(i))
+			}
+		}
+	case reflect.Struct:
+		type field struct {
+			index int
+			copy  copier
+		}
+		var fields []field
+		for i := range t.NumField() {
+			if f := t.Field(i); f.IsExported() {
+				if c := buildCopier(f.Type); c != nil {
+					fields = append(fields, field{i, c})
+				}
+			}
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		return func(dst, src reflect.Value) {
+			dst.Set(src)
+			for _, f := range fields {
+				f.copy(dst.Field(f.index), src.Field(f.index))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// commandPrefix starts every text command.
+const commandPrefix = "!"
+
+// Context carries everything a command handler needs to answer a message.
+type Context struct {
+	Session *discordgo.Session
+	Message *discordgo.MessageCreate
+	GuildID string
+	// Args is the text following the command name, without surrounding spaces.
+	Args   string
+	Config GuildConfig
+	// Interaction is the slash command the command was run through, nil for
+	// commands sent as messages.
+	Interaction *discordgo.InteractionCreate
+	// Ctx ends when the command's deadline passes or the bot shuts down. Calls
+	// to the ML API and downloads are made with it.
+	Ctx context.Context
+}
+
+// commands maps command names to their handlers.
+var commands map[string]func(c *Context)
+
+func init() {
+	commands = map[string]func(c *Context){
+		"ping":        handlePing,
+		"list":        handleList,
+		"ml":          handleML,
+		"add":         handleAdd,
+		"remove":      handleRemove,
+		"visited":     handleVisited,
+		"spotlight":   handleSpotlight,
+		"settings":    handleSettings,
+		"stats":       handleStats,
+		"restore":     handleRestore,
+		"tag":         handleTag,
+		"nickname":    handleNickname,
+		"photo":       handlePhoto,
+		"untag":       handleUntag,
+		"set":         handleSet,
+		"edit":        handleEdit,
+		"history-of":  handleHistoryOf,
+		"revert":      handleRevert,
+		"discover":    handleDiscover,
+		"rate":        handleRate,
+		"info":        handleInfo,
+		"search":      handleSearch,
+		"emoji":       handleEmoji,
+		"archive":     handleArchive,
+		"unarchive":   handleUnarchive,
+		"untried":     handleUntried,
+		"attributes":  handleAttributes,
+		"unavailable": handleUnavailable,
+		"available":   handleAvailable,
+		"random":      handleRandom,
+		"suggest":     handleSuggest,
+		"poll":        handlePoll,
+		"export":      handleExport,
+		"schedule":    handleSchedule,
+		"audit":       handleAudit,
+		"usage":       handleUsage,
+		"merge":       handleMerge,
+		"clear":       handleClear,
+		"bulk-edit":   handleBulkEdit,
+		"battle":      handleBattle,
+		"rankings":    handleRankings,
+		"tournament":  handleTournament,
+		"my-visits":   handleMyVisits,
+		"not-yet":     handleNotYet,
+		"buddies":     handleBuddies,
+		"me":          handleMe,
+		"recap":       handleRecap,
+		"reminders":   handleReminders,
+		"snooze":      handleSnooze,
+		"holidays":    handleHolidays,
+		"away":        handleAway,
+		"back":        handleBack,
+		"spend":       handleSpend,
+		"budget":      handleBudget,
+		"refresh":     handleRefresh,
+		"version":     handleVersion,
+		"uptime":      handleUptime,
+		"debug":       handleDebug,
+
+		"who-added":       handleWhoAdded,
+		"contributors":    handleContributors,
+		"leaderboard":     handleLeaderboard,
+		"import":          handleImport,
+		"propose-remove":  handleProposeRemove,
+		"remove-all":      handleRemoveAll,
+		"remove-matching": handleRemoveMatching,
+		"seed":            handleSeed,
+		"share":           handleShare,
+		"forget-me":       handleForgetMe,
+		"forget":          handleForget,
+		"flavor":          handleFlavor,
+		"dedupe":          handleDedupe,
+		"lunch":           handleLunch,
+		"readonly":        handleReadOnly,
+	}
+}
+
+// dispatch runs the command contained in a message, if any. slash is the
+// slash command interaction the message was made from, nil for messages.
+func dispatch(s *discordgo.Session, m *discordgo.MessageCreate, slash *discordgo.InteractionCreate) {
+	name, args, ok := parseCommand(m.Content)
+	if !ok {
+		return
+	}
+	run, ok := commands[name]
+	if !ok {
+		return
+	}
+
+	c := newContext(s, m, args)
+	if !acceptCommand(m.Message, c.Config) {
+		return
+	}
+	recordUsage(m.GuildID, name, m.Author.ID, time.Now())
+	if slash != nil {
+		c.Interaction, c.Config = slash, c.Config.forLocale(slash.Locale)
+	}
+	if c.refuseReadOnly(name) {
+		return
+	}
+	defer recoverHandler(s, "!"+name, m.Content, func() { c.Reply("error.internal", nil) })
+	runWithDeadline(c, name, run)
+}
+
+// parseCommand splits a message into the lowercased command name and its
+// arguments, which are kept as written. A single space may follow the
+// prefix, as in `! list`, which phone keyboards like to insert.
+func parseCommand(content string) (name, args string, ok bool) {
+	content, ok = strings.CutPrefix(content, commandPrefix)
+	if !ok {
+		return "", "", false
+	}
+	content = strings.TrimPrefix(content, " ")
+	name = content
+	if i := strings.IndexAny(content, " \n\t"); i >= 0 {
+		name, args = content[:i], content[i+1:]
+	}
+	return strings.ToLower(name), args, name != ""
+}
+
+// newContext builds the context for a message, loading the guild's config.
+func newContext(s *discordgo.Session, m *discordgo.MessageCreate, args string) *Context {
+	cfg, err := GetGuildConfig(m.GuildID)
+	if err != nil {
+		log.Printf("Failed to load config for guild %s: %v", m.GuildID, err)
+	}
+	return &Context{Session: s, Message: m, GuildID: m.GuildID, Args: strings.TrimSpace(args), Config: cfg, Ctx: shutdownCtx}
+}
+
+// Lang returns the language replies should be written in.
+func (c *Context) Lang() string {
+	return c.Config.Lang()
+}
+
+// T formats a message from the catalog in the guild's language.
+func (c *Context) T(key string, args Args) string {
+	return c.Config.T(key, args)
+}
+
+// Reply sends a catalog message to the channel the command came from.
+func (c *Context) Reply(key string, args Args) {
+	c.Send(c.T(key, args))
+}
+
+// Send sends already formatted text to the channel the command came from.
+func (c *Context) Send(text string) {
+	if _, err := c.SendComplex(&discordgo.MessageSend{Content: text}); err != nil {
+		log.Printf("Failed to send message to %s: %v", c.Message.ChannelID, err)
+	}
+}
+
+// SendPrivate sends text to the author in a direct message, telling the
+// channel if that isn't possible. It reports whether the message was sent.
+func (c *Context) SendPrivate(text string) bool {
+	return c.SendPrivateComplex(&discordgo.MessageSend{Content: text})
+}
+
+// SendPrivateComplex is SendPrivate for messages with files or embeds.
+func (c *Context) SendPrivateComplex(msg *discordgo.MessageSend) bool {
+	dm, err := c.Session.UserChannelCreate(c.Message.Author.ID)
+	if err == nil {
+		_, err = c.Session.ChannelMessageSendComplex(dm.ID, msg)
+	}
+	if err != nil {
+		log.Printf("Failed to send direct message to %s: %v", c.Message.Author.ID, err)
+		c.Reply("dm.failed", nil)
+		return false
+	}
+	return true
+}
+
+// replyError explains a failed operation on a named restaurant, using the
+// dedicated message for a missing restaurant and key otherwise.
+func (c *Context) replyError(key string, err error, name string) {
+	name = echoName(name)
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) && len(notFound.Suggestions) > 0 {
+		c.Reply("restaurant.not_found_suggest", Args{"name": name, "suggestions": quoteNames(notFound.Suggestions)})
+		return
+	}
+	if errors.Is(err, ErrRestaurantNotFound) {
+		c.Reply("restaurant.not_found", Args{"name": name})
+		return
+	}
+	if errors.Is(err, ErrReadOnly) {
+		c.replyReadOnly()
+		return
+	}
+	c.Reply(key, Args{"name": name})
+}
+
+// quoteNames renders restaurant names as a quoted, comma-separated list.
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = "\"" + n + "\""
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// RequireAdmin replies with an error and returns false unless the author may manage the bot.
+func (c *Context) RequireAdmin() bool {
+	if isAdmin(c.Session, c.Message.ChannelID, c.Message.Author.ID) {
+		return true
+	}
+	c.Reply("error.admin_only", nil)
+	return false
+}
+
+// RequireOwner replies with an error and returns false unless the author runs the bot.
+func (c *Context) RequireOwner() bool {
+	if isBotOwner(c.Message.Author.ID) {
+		return true
+	}
+	c.Reply("error.owner_only", nil)
+	return false
+}
+
+// isBotOwner reports whether a user is the bot's operator, named by OWNER_ID.
+func isBotOwner(userID string) bool {
+	owner := currentConfig().OwnerID
+	return owner != "" && userID == owner
+}
+
+// isAdmin reports whether a user may manage the bot's settings in a channel's guild.
+func isAdmin(s *discordgo.Session, channelID, userID string) bool {
+	perms, err := s.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		log.Printf("Failed to get permissions for user %s: %v", userID, err)
+		return false
+	}
+	return perms&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0
+}
+
+// idPrefix marks a restaurant reference by ID, like id:4f2. A '#' would be
+// mistaken for a tag filter.
+const idPrefix = "id:"
+
+// parseRef splits `"Some name" rest` or `id:xyz rest` into the restaurant
+// reference and the remaining text. Lookups resolve either form.
+func parseRef(args string) (ref, rest string, ok bool) {
+	if !strings.HasPrefix(strings.ToLower(args), idPrefix) {
+		return parseQuoted(args)
+	}
+	ref, rest, _ = strings.Cut(args, " ")
+	if len(ref) == len(idPrefix) {
+		return "", args, false
+	}
+	return idPrefix + strings.ToLower(ref[len(idPrefix):]), strings.TrimSpace(rest), true
+}
+
+// parseQuoted splits `"Some name" rest` into the quoted name and the remaining text.
+func parseQuoted(args string) (name, rest string, ok bool) {
+	if !strings.HasPrefix(args, "\"") {
+		return "", args, false
+	}
+	end := strings.Index(args[1:], "\"")
+	if end < 0 {
+		return "", args, false
+	}
+	return args[1 : end+1], strings.TrimSpace(args[end+2:]), true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// testMessage returns a message from a member in a guild channel.
+func testMessage(content string) *discordgo.MessageCreate {
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "100",
+		ChannelID: "200",
+		GuildID:   "300",
+		Content:   content,
+		Author:    &discordgo.User{ID: "400", Username: "member"},
+	}}
+}
+
+func TestDispatchRecoversPanics(t *testing.T) {
+	newTestDB(t)
+	s, stub := newStubSession(t)
+	commands["test-panic"] = func(c *Context) { panic("boom") }
+	t.Cleanup(func() { delete(commands, "test-panic") })
+
+	before := handlerPanics.Load()
+	dispatch(s, testMessage("!test-panic now"), nil)
+
+	if got := handlerPanics.Load() - before; got != 1 {
+		t.Errorf("handlerPanics grew by %d, want 1", got)
+	}
+	want := GuildConfig{}.T("error.internal", nil)
+	sent := stub.messages()
+	if len(sent) != 1 || sent[0].ChannelID != "200" || sent[0].Content != want {
+		t.Errorf("sent %+v, want %q in channel 200", sent, want)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		content    string
+		name, args string
+		ok         bool
+	}{
+		{"!list", "list", "", true},
+		{"!LIST", "list", "", true},
+		{"!LiSt #Sushi", "list", "#Sushi", true},
+		{"! list", "list", "", true},
+		{"! List sort:rating", "list", "sort:rating", true},
+		{"!add Thai PALACE", "add", "Thai PALACE", true},
+		{"!ADD \"The Big Easy\"", "add", "\"The Big Easy\"", true},
+		{"!add\nPizza Place", "add", "Pizza Place", true},
+		{"!add\tPizza", "add", "Pizza", true},
+		{"!add  two spaces", "add", " two spaces", true},
+		{"!", "", "", false},
+		{"! ", "", "", false},
+		{"!  list", "", "", false},
+		{"list", "", "", false},
+		{"?list", "", "", false},
+		{" !list", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := parseCommand(tt.content)
+		if !ok && !tt.ok {
+			continue
+		}
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("parseCommand(%q) = %q, %q, %v, want %q, %q, %v", tt.content, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestMutatingCommandsExist(t *testing.T) {
+	for name := range mutatingCommands {
+		if _, ok := commands[name]; !ok {
+			t.Errorf("read-only mode refuses !%s, which isn't a command", name)
+		}
+	}
+}
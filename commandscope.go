@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Scopes the slash command is registered in, chosen with COMMAND_SCOPE.
+const (
+	// commandScopeGlobal registers the command once for every guild when the
+	// bot can't read messages. Discord takes up to an hour to show it.
+	commandScopeGlobal = "global"
+	// commandScopeGuild registers the command in each guild as the bot joins
+	// it, where it is available at once.
+	commandScopeGuild = "guild"
+)
+
+// guildCommandInterval spaces the queued registrations, so that joining many
+// guilds at startup doesn't run into Discord's rate limits.
+const guildCommandInterval = 500 * time.Millisecond
+
+// commandScope returns the scope COMMAND_SCOPE chooses, global by default.
+func commandScope() string {
+	if strings.EqualFold(os.Getenv("COMMAND_SCOPE"), commandScopeGuild) {
+		return commandScopeGuild
+	}
+	return commandScopeGlobal
+}
+
+// checkCommandScope reports a COMMAND_SCOPE that is neither global nor guild.
+func checkCommandScope() error {
+	switch v := strings.ToLower(os.Getenv("COMMAND_SCOPE")); v {
+	case "", commandScopeGlobal, commandScopeGuild:
+		return nil
+	default:
+		return fmt.Errorf("COMMAND_SCOPE %q is not a command scope. Use global, or guild to register the slash command in each server.", v)
+	}
+}
+
+// guildCommands is the queue of guilds whose slash command is to be
+// registered (true) or removed (false). A guild is queued once, with the
+// latest change asked for.
+var guildCommands = struct {
+	sync.Mutex
+	pending map[string]bool
+	order   []string
+	wake    chan struct{}
+	start   sync.Once
+}{pending: map[string]bool{}, wake: make(chan struct{}, 1)}
+
+// HandleGuildCreate registers the slash command in a guild the bot joined or
+// that became available, in the guild scope. In the global scope it removes
+// a command registered there before, so that it doesn't show up twice. The
+// development guild's commands are left to reconcileDevCommands.
+func (h *Handler) HandleGuildCreate(s *discordgo.Session, g *discordgo.GuildCreate) {
+	if g.ID == devGuildID() {
+		return
+	}
+	queueGuildCommand(s, g.ID, commandScope() == commandScopeGuild)
+}
+
+// HandleGuildDelete removes the slash command of a guild the bot left. Guilds
+// that are only unavailable during an outage keep it.
+func (h *Handler) HandleGuildDelete(s *discordgo.Session, g *discordgo.GuildDelete) {
+	if g.Unavailable || g.ID == devGuildID() {
+		return
+	}
+	queueGuildCommand(s, g.ID, false)
+}
+
+// queueGuildCommand queues registering or removing a guild's slash command,
+// starting the worker that processes the queue on first use.
+func queueGuildCommand(s *discordgo.Session, guildID string, register bool) {
+	guildCommands.start.Do(func() { go runGuildCommands(s) })
+	guildCommands.Lock()
+	if _, queued := guildCommands.pending[guildID]; !queued {
+		guildCommands.order = append(guildCommands.order, guildID)
+	}
+	guildCommands.pending[guildID] = register
+	guildCommands.Unlock()
+	select {
+	case guildCommands.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextGuildCommand takes the oldest guild off the queue.
+func nextGuildCommand() (guildID string, register, ok bool) {
+	guildCommands.Lock()
+	defer guildCommands.Unlock()
+	if len(guildCommands.order) == 0 {
+		return "", false, false
+	}
+	guildID, guildCommands.order = guildCommands.order[0], guildCommands.order[1:]
+	register = guildCommands.pending[guildID]
+	delete(guildCommands.pending, guildID)
+	return guildID, register, true
+}
+
+// runGuildCommands works through the queue one guild at a time. In the guild
+// scope it first removes the global command, which would duplicate the
+// guilds' commands.
+func runGuildCommands(s *discordgo.Session) {
+	if commandScope() == commandScopeGuild {
+		removeGlobalCommand(s)
+	}
+	for range guildCommands.wake {
+		for {
+			guildID, register, ok := nextGuildCommand()
+			if !ok {
+				break
+			}
+			var called bool
+			if register {
+				called = registerGuildCommand(s, guildID)
+			} else {
+				called = removeGuildCommand(s, guildID)
+			}
+			if called {
+				time.Sleep(guildCommandInterval)
+			}
+		}
+	}
+}
+
+// registerGuildCommand registers the slash commands in a guild unless those
+// registered before have the same definitions, reporting whether it asked
+// Discord. Unlike the global commands they aren't looked up, as that would
+// double the requests for every guild.
+func registerGuildCommand(s *discordgo.Session, guildID string) bool {
+	cmds := slashCommands()
+	hash := commandHash(cmds)
+
+	slashRegistrationsMutex.Lock()
+	defer slashRegistrationsMutex.Unlock()
+	regs := loadSlashRegistrations()
+	if regs.Guilds[guildID].Hash == hash {
+		return false
+	}
+	created, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, guildID, cmds)
+	if err != nil || len(created) == 0 {
+		log.Printf("Failed to register the slash commands in guild %s: %v", guildID, err)
+		return true
+	}
+	regs.Guilds[guildID] = slashRegistration{ID: created[0].ID, Hash: hash}
+	saveSlashRegistrations(regs)
+	return true
+}
+
+// removeGuildCommand removes the slash commands registered in a guild, if any,
+// reporting whether it asked Discord. The registration is forgotten even when
+// Discord refuses, as it does for guilds the bot was removed from.
+func removeGuildCommand(s *discordgo.Session, guildID string) bool {
+	slashRegistrationsMutex.Lock()
+	defer slashRegistrationsMutex.Unlock()
+	regs := loadSlashRegistrations()
+	if _, ok := regs.Guilds[guildID]; !ok {
+		return false
+	}
+	if _, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, guildID, []*discordgo.ApplicationCommand{}); err != nil {
+		log.Printf("Failed to remove the slash commands from guild %s: %v", guildID, err)
+	}
+	delete(regs.Guilds, guildID)
+	saveSlashRegistrations(regs)
+	return true
+}
+
+// removeGlobalCommand removes the global slash commands, if they were registered.
+func removeGlobalCommand(s *discordgo.Session) {
+	slashRegistrationsMutex.Lock()
+	defer slashRegistrationsMutex.Unlock()
+	regs := loadSlashRegistrations()
+	if regs.ID == "" {
+		return
+	}
+	if _, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", []*discordgo.ApplicationCommand{}); err != nil {
+		log.Printf("Failed to remove the global slash commands: %v", err)
+		return
+	}
+	regs.slashRegistration = slashRegistration{}
+	saveSlashRegistrations(regs)
+}
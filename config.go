@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/joho/godotenv"
+)
+
+// botConfig is the part of the configuration that SIGHUP can change while
+// the bot runs. Handlers read it through currentConfig, so that a reload
+// never shows them half of the new values.
+type botConfig struct {
+	OwnerID        string
+	ErrorChannelID string
+	MLAPIURL       string
+	HTTPAddr       string
+	// LogLevel is the least severe level logged, from LOG_LEVEL.
+	LogLevel slog.Level
+}
+
+// restartOnlyVars are the variables read once at startup. A reload reports
+// their changes but leaves them to the next restart.
+var restartOnlyVars = []string{
+	"DISCORD_TOKEN", "DB_PATH", "DB_OPLOG", "DB_ENCRYPTION_KEY", "DB_ENCRYPTION_OLD_KEY", "API_TOKEN",
+	"SHARD_ID", "SHARD_COUNT", "COMMAND_SCOPE", "DEV_GUILD_ID", "DEV_CLEANUP", "CONNECT_MAX_WAIT", "TZ",
+}
+
+var runningConfig atomic.Pointer[botConfig]
+
+// processEnv is the environment the bot was started with, before the .env
+// file was loaded. Its variables win over the file's, on reload as well.
+var processEnv map[string]string
+
+// loadProcessEnv records the environment, loads the .env file if it exists
+// and reads the configuration.
+func loadProcessEnv() {
+	processEnv = map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			processEnv[k] = v
+		}
+	}
+	// Don't fail if there is no .env file.
+	godotenv.Load()
+	cfg := readConfig(os.Getenv)
+	runningConfig.Store(cfg)
+	logLevel.Set(cfg.LogLevel)
+}
+
+// currentConfig returns the configuration in effect, empty before it is read.
+func currentConfig() *botConfig {
+	if cfg := runningConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return &botConfig{}
+}
+
+// readConfig reads the configuration with getenv.
+// An invalid LOG_LEVEL, which the startup checks refuse, reads as info.
+func readConfig(getenv func(string) string) *botConfig {
+	level, _ := parseLogLevel(getenv("LOG_LEVEL"))
+	return &botConfig{
+		OwnerID:        getenv("OWNER_ID"),
+		ErrorChannelID: getenv("ERROR_CHANNEL_ID"),
+		MLAPIURL:       getenv("ML_API_URL"),
+		HTTPAddr:       getenv("HTTP_ADDR"),
+		LogLevel:       level,
+	}
+}
+
+// parseLogLevel reads a LOG_LEVEL of debug, info, warn or error, info when
+// unset.
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("LOG_LEVEL %q is not a log level. Use debug, info, warn or error.", value)
+	}
+	return level, nil
+}
+
+// reloadEnv returns the variables as a restart would see them: from the
+// environment the bot was started with, or else from the .env file as it is
+// now.
+func reloadEnv() (func(string) string, error) {
+	file, err := godotenv.Read()
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func(name string) string {
+		if v, ok := processEnv[name]; ok {
+			return v
+		}
+		return file[name]
+	}, nil
+}
+
+// reloadConfig rereads the configuration, applying the changes that are safe
+// while running and logging those that need a restart. The HTTP server can
+// be switched on, but changing or removing its address needs a restart.
+func reloadConfig(s *discordgo.Session) {
+	getenv, err := reloadEnv()
+	if err != nil {
+		log.Printf("Failed to reload the configuration: %v", err)
+		return
+	}
+	old, next := currentConfig(), readConfig(getenv)
+	for _, id := range []struct{ name, value string }{{"OWNER_ID", next.OwnerID}, {"ERROR_CHANNEL_ID", next.ErrorChannelID}} {
+		if err := checkDiscordID(id.name, id.value); err != nil {
+			log.Printf("Failed to reload the configuration: %v", err)
+			return
+		}
+	}
+	if _, err := parseLogLevel(getenv("LOG_LEVEL")); err != nil {
+		log.Printf("Failed to reload the configuration: %v", err)
+		return
+	}
+
+	var applied, restart []string
+	for _, f := range []struct {
+		name     string
+		old, new string
+	}{
+		{"OWNER_ID", old.OwnerID, next.OwnerID},
+		{"ERROR_CHANNEL_ID", old.ErrorChannelID, next.ErrorChannelID},
+		{"ML_API_URL", old.MLAPIURL, next.MLAPIURL},
+	} {
+		if f.old != f.new {
+			applied = append(applied, f.name)
+		}
+	}
+	if old.LogLevel != next.LogLevel {
+		applied = append(applied, "LOG_LEVEL")
+	}
+	startHTTP := false
+	switch {
+	case old.HTTPAddr == next.HTTPAddr:
+	case old.HTTPAddr == "":
+		applied = append(applied, "HTTP_ADDR")
+		startHTTP = true
+	default:
+		restart = append(restart, "HTTP_ADDR")
+		next.HTTPAddr = old.HTTPAddr
+	}
+	for _, name := range restartOnlyVars {
+		if os.Getenv(name) != getenv(name) {
+			restart = append(restart, name)
+		}
+	}
+
+	runningConfig.Store(next)
+	logLevel.Set(next.LogLevel)
+	if startHTTP {
+		startHTTPServer(s)
+	}
+	switch {
+	case len(applied) > 0:
+		log.Printf("Reloaded the configuration, changed: %s", strings.Join(applied, ", "))
+	case len(restart) == 0:
+		log.Printf("Reloaded the configuration, nothing changed")
+	}
+	if len(restart) > 0 {
+		log.Printf("Changes that need a restart to apply: %s", strings.Join(restart, ", "))
+	}
+}
+
+// reloadOnSIGHUP reloads the configuration whenever the process gets SIGHUP.
+func reloadOnSIGHUP(s *discordgo.Session) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(s)
+		}
+	}()
+}
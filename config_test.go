@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  slog.Level
+		ok    bool
+	}{
+		{"", slog.LevelInfo, true},
+		{"debug", slog.LevelDebug, true},
+		{"INFO", slog.LevelInfo, true},
+		{"warn", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"loud", slog.LevelInfo, false},
+	}
+	for _, tt := range tests {
+		got, err := parseLogLevel(tt.value)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("parseLogLevel(%q) = %v, %v, want %v, ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// withLogLevel sets logLevel until the test ends.
+func withLogLevel(t *testing.T, level slog.Level) {
+	t.Helper()
+	saved := logLevel.Level()
+	logLevel.Set(level)
+	t.Cleanup(func() { logLevel.Set(saved) })
+}
+
+func TestErrorRingHandlerLevel(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(errorRingHandler{slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})})
+	logged := func(log func()) bool {
+		out.Reset()
+		log()
+		return out.Len() > 0
+	}
+
+	tests := []struct {
+		level slog.Level
+		// want is whether a debug, an info, a failure, a warning and an
+		// error record are logged.
+		want [5]bool
+	}{
+		{slog.LevelDebug, [5]bool{true, true, true, true, true}},
+		{slog.LevelInfo, [5]bool{false, true, true, true, true}},
+		{slog.LevelWarn, [5]bool{false, false, true, true, true}},
+		{slog.LevelError, [5]bool{false, false, true, false, true}},
+	}
+	for _, tt := range tests {
+		withLogLevel(t, tt.level)
+		got := [5]bool{
+			logged(func() { logger.Debug("Checking the cache") }),
+			logged(func() { logger.Info("Database file is ready.") }),
+			logged(func() { logger.Info("Failed to save database: disk full") }),
+			logged(func() { logger.Warn("Discord is slow") }),
+			logged(func() { logger.Error("Shard lost") }),
+		}
+		if got != tt.want {
+			t.Errorf("at %v, logged %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestReloadConfigLogLevel(t *testing.T) {
+	savedEnv, savedConfig := processEnv, runningConfig.Load()
+	t.Cleanup(func() {
+		processEnv = savedEnv
+		runningConfig.Store(savedConfig)
+	})
+	withLogLevel(t, slog.LevelInfo)
+	runningConfig.Store(&botConfig{LogLevel: slog.LevelInfo})
+
+	processEnv = map[string]string{"LOG_LEVEL": "warn"}
+	reloadConfig(nil)
+	if got := logLevel.Level(); got != slog.LevelWarn {
+		t.Errorf("log level after reload = %v, want WARN", got)
+	}
+	if got := currentConfig().LogLevel; got != slog.LevelWarn {
+		t.Errorf("config log level after reload = %v, want WARN", got)
+	}
+
+	processEnv = map[string]string{"LOG_LEVEL": "loud"}
+	reloadConfig(nil)
+	if got := logLevel.Level(); got != slog.LevelWarn {
+		t.Errorf("invalid LOG_LEVEL changed the level to %v", got)
+	}
+	if got := currentConfig().LogLevel; got != slog.LevelWarn {
+		t.Errorf("invalid LOG_LEVEL changed the config to %v", got)
+	}
+}
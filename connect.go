@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// connectFirstDelay and connectMaxDelay bound the wait between connection attempts.
+	connectFirstDelay = time.Second
+	connectMaxDelay   = 5 * time.Minute
+	// defaultConnectMaxWait is how long the bot keeps trying to connect at startup,
+	// unless CONNECT_MAX_WAIT says otherwise.
+	defaultConnectMaxWait = 30 * time.Minute
+)
+
+// errConnectAborted is returned when a signal arrives while waiting to retry.
+var errConnectAborted = errors.New("connection aborted")
+
+// authenticationFailed reports whether the gateway rejected the token, which
+// it does with close code 4004. Retrying can't help then.
+func authenticationFailed(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "4004")
+}
+
+// connectMaxWait returns how long to keep retrying the initial connection.
+func connectMaxWait() time.Duration {
+	v := os.Getenv("CONNECT_MAX_WAIT")
+	if v == "" {
+		return defaultConnectMaxWait
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("Ignoring invalid CONNECT_MAX_WAIT %q, using %s", v, defaultConnectMaxWait)
+		return defaultConnectMaxWait
+	}
+	return d
+}
+
+// backoffDelay returns the wait before retry number attempt, starting at 1:
+// doubling from connectFirstDelay up to connectMaxDelay, with the upper half
+// jittered so that many restarting bots don't retry in lockstep.
+func backoffDelay(attempt int) time.Duration {
+	d := connectMaxDelay
+	if attempt < 20 {
+		d = min(connectFirstDelay<<(attempt-1), connectMaxDelay)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// connectWithBackoff opens the gateway connection, retrying with exponential
+// backoff for up to maxWait. It gives up at once on a rejected token and
+// returns errConnectAborted if stop receives while waiting.
+func connectWithBackoff(s *discordgo.Session, maxWait time.Duration, stop <-chan os.Signal) error {
+	deadline := time.Now().Add(maxWait)
+	for attempt := 1; ; attempt++ {
+		err := openSession(s)
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("Connected to the Discord gateway after %d attempts", attempt)
+			}
+			return nil
+		}
+		if authenticationFailed(err) {
+			return err
+		}
+		delay := backoffDelay(attempt)
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		log.Printf("Connection attempt %d to the Discord gateway failed: %v. Retrying in %s.", attempt, err, delay.Round(time.Second))
+		select {
+		case <-time.After(delay):
+		case sig := <-stop:
+			log.Printf("Received %v while waiting to reconnect, exiting", sig)
+			return errConnectAborted
+		}
+	}
+}
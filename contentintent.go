@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Application flags telling whether the bot may read message content.
+const (
+	appFlagGatewayMessageContent        = 1 << 18
+	appFlagGatewayMessageContentLimited = 1 << 19
+)
+
+// slashCommandName is the slash command that runs prefix commands when the
+// bot can't read messages.
+const slashCommandName = "lunch"
+
+// slashOnly is set when the Message Content intent is unavailable, so prefix
+// commands arrive empty and only the slash command works.
+var slashOnly atomic.Bool
+
+// contentIntentNotice makes sure the operator is told once per start.
+var contentIntentNotice sync.Once
+
+// disallowedIntents reports whether the gateway refused the requested
+// privileged intents, which it does with close code 4014.
+func disallowedIntents(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "4014")
+}
+
+// openSession connects to the gateway. When the Message Content intent isn't
+// enabled for the application, it reconnects without it in slash-only mode.
+func openSession(s *discordgo.Session) error {
+	if slashOnly.Load() {
+		// Another shard found the intent missing already.
+		s.Identify.Intents &^= discordgo.IntentsMessageContent
+	}
+	err := s.Open()
+	if !disallowedIntents(err) {
+		return err
+	}
+	log.Printf("Gateway refused the requested intents (%v), reconnecting without Message Content", err)
+	s.Identify.Intents &^= discordgo.IntentsMessageContent
+	slashOnly.Store(true)
+	return s.Open()
+}
+
+// HandleReady checks on every connection whether the bot may read message
+// content. It relies on the application's flags rather than on the messages
+// received, so quiet servers don't look like a missing intent.
+func (h *Handler) HandleReady(s *discordgo.Session, r *discordgo.Ready) {
+	if !slashOnly.Load() {
+		app, err := s.Application("@me")
+		if err != nil {
+			log.Printf("Failed to check the application's flags: %v", err)
+			return
+		}
+		if app.Flags&(appFlagGatewayMessageContent|appFlagGatewayMessageContentLimited) != 0 {
+			return
+		}
+		slashOnly.Store(true)
+	}
+	contentIntentNotice.Do(func() { enterSlashOnlyMode(s) })
+}
+
+// enterSlashOnlyMode registers the slash command, unless it is registered per
+// guild anyway, and tells the operator why prefix commands stopped working.
+func enterSlashOnlyMode(s *discordgo.Session) {
+	log.Print("************************************************************")
+	log.Print("WARNING: the Message Content intent is not enabled for this bot.")
+	log.Print("Prefix commands can't be read and only /" + slashCommandName + " works.")
+	log.Print("Enable it under Bot > Privileged Gateway Intents in the developer portal.")
+	log.Print("************************************************************")
+
+	if commandScope() == commandScopeGlobal {
+		registerSlashCommands(s)
+	}
+
+	text := translator.T(defaultLanguage, "intent.missing", Args{"command": slashCommandName})
+	reportError(s, "%s", text)
+	if owner := currentConfig().OwnerID; owner != "" {
+		dm, err := s.UserChannelCreate(owner)
+		if err == nil {
+			_, err = s.ChannelMessageSend(dm.ID, "⚠️ "+text)
+		}
+		if err != nil {
+			log.Printf("Failed to tell the owner about the missing intent: %v", err)
+		}
+	}
+}
+
+// userMentionPattern matches <@id> and <@!id> user mentions.
+var userMentionPattern = regexp.MustCompile(`<@!?(\d+)>`)
+
+// handleSlashCommand runs `/lunch command:...` as if the member had sent the
+// prefix command, answering the interaction with the command so the channel
+// sees what was run.
+func handleSlashCommand(s *discordgo.Session, ic *discordgo.InteractionCreate) {
+	if ic.Member == nil || ic.GuildID == "" {
+		return
+	}
+	data := ic.ApplicationCommandData()
+	var text string
+	var attachments []*discordgo.MessageAttachment
+	for _, o := range data.Options {
+		switch o.Name {
+		case "command":
+			text = strings.TrimPrefix(strings.TrimSpace(o.StringValue()), commandPrefix)
+		case "file":
+			if id, ok := o.Value.(string); ok && data.Resolved != nil && data.Resolved.Attachments[id] != nil {
+				attachments = append(attachments, data.Resolved.Attachments[id])
+			}
+		}
+	}
+	content := commandPrefix + text
+	if err := s.InteractionRespond(ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: "`" + content + "`", AllowedMentions: &discordgo.MessageAllowedMentions{}},
+	}); err != nil {
+		log.Printf("Failed to respond to /%s: %v", slashCommandName, err)
+	}
+
+	var mentions []*discordgo.User
+	for _, m := range userMentionPattern.FindAllStringSubmatch(text, -1) {
+		if member, err := s.State.Member(ic.GuildID, m[1]); err == nil {
+			mentions = append(mentions, member.User)
+		} else if u, err := s.User(m[1]); err == nil {
+			mentions = append(mentions, u)
+		}
+	}
+	dispatch(s, &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:          ic.ID,
+		ChannelID:   ic.ChannelID,
+		GuildID:     ic.GuildID,
+		Content:     content,
+		Author:      ic.Member.User,
+		Member:      ic.Member,
+		Mentions:    mentions,
+		Attachments: attachments,
+	}}, ic)
+}
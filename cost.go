@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// maxCostExpenses is how many of a restaurant's latest expenses with a
+	// head count its cost per person is averaged over.
+	maxCostExpenses = 10
+	// maxPersonCents bounds the cost per person of an expense counted in the
+	// average, leaving out typos and expenses with a wrong head count.
+	maxPersonCents = 200_00
+	// maxExpenseAttendees bounds the head count of an expense.
+	maxExpenseAttendees = 100
+)
+
+// tierPersonCents is the cost per person assumed for each price level of
+// restaurants without expenses, from $ to $$$$.
+var tierPersonCents = [maxPrice + 1]int{0, 10_00, 20_00, 35_00, 60_00}
+
+// perPerson returns an expense's cost per person, reporting false when it
+// has no head count.
+func (e Expense) perPerson() (int, bool) {
+	if e.Attendees <= 0 {
+		return 0, false
+	}
+	return (e.Cents + e.Attendees/2) / e.Attendees, true
+}
+
+// updateCost recomputes the cost per person of the restaurant with the given
+// ID from the latest of the guild's expenses there, leaving out outliers.
+func (g *GuildData) updateCost(restaurantID string) {
+	i := g.findID(restaurantID)
+	if i < 0 {
+		return
+	}
+	r := &g.Restaurants[i]
+	r.CostCents, r.CostExpenses = 0, 0
+	sum := 0
+	for j := len(g.Expenses) - 1; j >= 0 && r.CostExpenses < maxCostExpenses; j-- {
+		e := g.Expenses[j]
+		cents, ok := e.perPerson()
+		if e.RestaurantID != restaurantID || !ok || cents > maxPersonCents {
+			continue
+		}
+		sum += cents
+		r.CostExpenses++
+	}
+	if r.CostExpenses > 0 {
+		r.CostCents = (sum + r.CostExpenses/2) / r.CostExpenses
+	}
+}
+
+// visitAttendees returns the number of attendees of the restaurant's visit
+// on the day of at, 0 when none was recorded that day.
+func (r *Restaurant) visitAttendees(at time.Time, loc *time.Location) int {
+	day := at.In(loc).Format("2006-01-02")
+	for i := len(r.Visits) - 1; i >= 0; i-- {
+		if v := r.Visits[i]; v.Date.In(loc).Format("2006-01-02") == day {
+			return len(v.Attendees)
+		}
+	}
+	return 0
+}
+
+// parseExpenseAttendees takes a people=N head count out of an expense note.
+func parseExpenseAttendees(note string) (int, string, bool) {
+	fields := strings.Fields(note)
+	for i, f := range fields {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || !strings.EqualFold(key, "people") {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxExpenseAttendees {
+			return 0, note, false
+		}
+		return n, strings.Join(append(fields[:i:i], fields[i+1:]...), " "), true
+	}
+	return 0, note, true
+}
+
+// budgetNode matches restaurants whose cost per person is at most cents,
+// judged by the price level of restaurants without expenses.
+type budgetNode struct{ cents int }
+
+func (n budgetNode) match(r *Restaurant) bool {
+	switch {
+	case r.CostExpenses > 0:
+		return r.CostCents <= n.cents
+	case r.Price > 0:
+		return tierPersonCents[r.Price] <= n.cents
+	}
+	return false
+}
+
+// parseBudget parses the amount of a budget: term, with or without a
+// currency symbol, as the filter doesn't know the guild's.
+func parseBudget(s string) (int, bool) {
+	notDigit := func(r rune) bool { return !unicode.IsDigit(r) }
+	return parseAmount(strings.TrimRightFunc(strings.TrimLeftFunc(s, notDigit), notDigit), "", maxPersonCents)
+}
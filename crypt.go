@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedMagic starts encrypted payloads. It is followed by the key ID, the
+// nonce and the AES-GCM sealed data, and together with the key ID it is
+// authenticated as additional data.
+const encryptedMagic = "LBENC1"
+
+// keyIDSize is the length of the key ID, the start of the key's SHA-256 hash.
+const keyIDSize = 8
+
+// encryptionKey is an AES-256-GCM key for the database file, its operation
+// log and backups.
+type encryptionKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+var (
+	// currentKey encrypts everything written. It is nil without
+	// DB_ENCRYPTION_KEY, and data is written in plain text.
+	currentKey *encryptionKey
+	// oldKey only decrypts, for rotating keys with -reencrypt and restoring
+	// backups taken before the rotation.
+	oldKey *encryptionKey
+)
+
+// loadEncryptionKeys reads DB_ENCRYPTION_KEY and DB_ENCRYPTION_OLD_KEY.
+func loadEncryptionKeys() error {
+	var err error
+	if currentKey, err = parseEncryptionKey("DB_ENCRYPTION_KEY"); err != nil {
+		return err
+	}
+	oldKey, err = parseEncryptionKey("DB_ENCRYPTION_OLD_KEY")
+	return err
+}
+
+// parseEncryptionKey parses the base64 key in the environment variable name.
+func parseEncryptionKey(name string) (*encryptionKey, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return nil, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		raw, err = base64.RawStdEncoding.DecodeString(value)
+	}
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%s must be 32 bytes in base64, e.g. from `openssl rand -base64 32`.", name)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &encryptionKey{id: sum[:keyIDSize], aead: aead}, nil
+}
+
+// encryptPayload encrypts data with the current key, or returns it as is
+// without one.
+func encryptPayload(data []byte) ([]byte, error) {
+	if currentKey == nil {
+		return data, nil
+	}
+	header := append([]byte(encryptedMagic), currentKey.id...)
+	nonce := make([]byte, currentKey.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return currentKey.aead.Seal(out, nonce, data, header), nil
+}
+
+// errUnknownKey is returned for data encrypted with a key that isn't set.
+var errUnknownKey = errors.New("unknown encryption key")
+
+// isEncrypted reports whether data was written by encryptPayload with a key.
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+// decryptPayload decrypts data written by encryptPayload, with whichever
+// configured key it was encrypted with. Plain text is returned as is.
+func decryptPayload(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return data, nil
+	}
+	headerSize := len(encryptedMagic) + keyIDSize
+	if len(data) < headerSize {
+		return nil, errors.New("the encrypted data is truncated")
+	}
+	header, id := data[:headerSize], data[len(encryptedMagic):headerSize]
+	var key *encryptionKey
+	for _, k := range []*encryptionKey{currentKey, oldKey} {
+		if k != nil && bytes.Equal(k.id, id) {
+			key = k
+			break
+		}
+	}
+	switch {
+	case key == nil && currentKey == nil:
+		return nil, fmt.Errorf("%w: the data is encrypted with key %s, but DB_ENCRYPTION_KEY is not set", errUnknownKey, hex.EncodeToString(id))
+	case key == nil:
+		return nil, fmt.Errorf("%w: the data is encrypted with key %s, but DB_ENCRYPTION_KEY is key %s. Set the key it was written with, or set it as DB_ENCRYPTION_OLD_KEY and run with -reencrypt to switch to the new one", errUnknownKey, hex.EncodeToString(id), hex.EncodeToString(currentKey.id))
+	}
+	nonceSize := key.aead.NonceSize()
+	if len(data) < headerSize+nonceSize {
+		return nil, errors.New("the encrypted data is truncated")
+	}
+	nonce := data[headerSize : headerSize+nonceSize]
+	plain, err := key.aead.Open(nil, nonce, data[headerSize+nonceSize:], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with key %s, the data is damaged", hex.EncodeToString(id))
+	}
+	return plain, nil
+}
@@ -2,69 +2,572 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"sync"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// schemaVersion is the current on-disk format of the database file. Version 3
+// gave every restaurant a stable ID.
+const schemaVersion = 3
+
+var dbFilePath = "restaurants.json"
+
 var (
-	dbFilePath = "restaurants.json"
-	fileMutex  = &sync.Mutex{}
+	// ErrRestaurantNotFound is returned when a named restaurant isn't on the list.
+	ErrRestaurantNotFound = errors.New("restaurant not found")
+	// ErrNoRestaurants is returned when an operation needs a non-empty list.
+	ErrNoRestaurants = errors.New("no restaurants on the list")
+	// ErrListFull is returned when an add would exceed the guild's maximum list size.
+	ErrListFull = errors.New("the restaurant list is full")
+	// ErrUnknownGuild is returned when a guild has no data in the database.
+	ErrUnknownGuild = errors.New("unknown guild")
 )
 
+// defaultMaxRestaurants is the list size limit of guilds without a custom limit.
+const defaultMaxRestaurants = 500
+
+// maxSuggestions is the number of similar names offered when a lookup fails.
+const maxSuggestions = 3
+
+// NotFoundError is returned when a named restaurant isn't on the list. It
+// matches ErrRestaurantNotFound with errors.Is.
+type NotFoundError struct {
+	Name string
+	// Suggestions are similarly named entries, most similar first.
+	Suggestions []string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("restaurant %q not found", e.Name)
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrRestaurantNotFound
+}
+
 // DuplicateCheckResponse defines the structure for the duplicate check result from the ML API.
 type DuplicateCheckResponse struct {
-	IsDuplicate    bool    `json:"is_duplicate"`
-	MatchedName    string  `json:"matched_name"`
+	IsDuplicate     bool    `json:"is_duplicate"`
+	MatchedName     string  `json:"matched_name"`
 	SimilarityScore float64 `json:"similarity_score"`
 }
 
-// initDB ensures the JSON database file exists.
-func initDB(filepath string) {
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
+// Restaurant is a single entry on a guild's list.
+type Restaurant struct {
+	// ID is the entry's short stable ID, unique within the guild and never reused.
+	ID      string    `json:"id,omitempty"`
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"added_at,omitzero"`
+	// Aliases are the nicknames the restaurant can also be referred to by,
+	// unique across the guild's names and nicknames.
+	Aliases []string `json:"aliases,omitempty"`
+	// AddedBy is the member who added the entry, nil for entries from before attribution.
+	AddedBy *Contributor `json:"added_by,omitempty"`
+	Visits  []Visit      `json:"visits,omitempty"`
+	// Tags are lowercase and stored without the leading '#'.
+	Tags []string `json:"tags,omitempty"`
+	// Price is the price level from 1 ($) to 4 ($$$$), 0 when unknown.
+	Price int `json:"price,omitempty"`
+	// CostCents is the average cost per person of the latest expenses with a
+	// head count, meaningful once CostExpenses > 0.
+	CostCents    int `json:"cost_cents,omitempty"`
+	CostExpenses int `json:"cost_expenses,omitempty"`
+	// Diet lists the dietary options the restaurant caters for, e.g. "vegan".
+	Diet []string `json:"diet,omitempty"`
+	// Ratings holds each member's rating from 1 to 5, keyed by user ID.
+	Ratings map[string]int `json:"ratings,omitempty"`
+	// RatedAt is when each member last rated, keyed by user ID. Ratings given
+	// before it was recorded have no entry.
+	RatedAt map[string]time.Time `json:"rated_at,omitempty"`
+	// GuestRatings marks the ratings given from a visit's prompt by members
+	// who weren't among its attendees, keyed by user ID.
+	GuestRatings map[string]bool `json:"guest_ratings,omitempty"`
+	Location     *Location       `json:"location,omitempty"`
+	// Emoji is a unicode emoji or a custom emoji reference like <:name:id>.
+	Emoji string `json:"emoji,omitempty"`
+	// Address is the restaurant's street address.
+	Address string `json:"address,omitempty"`
+	// Link is the restaurant's website or map link.
+	Link string `json:"link,omitempty"`
+	// Preview is the metadata fetched from Link, if any.
+	Preview *LinkPreview `json:"preview,omitempty"`
+	// Photo is the URL of the restaurant's photo, archived in the guild's photo channel.
+	Photo string `json:"photo,omitempty"`
+	// Reservation is set when the restaurant needs a table booked in advance.
+	Reservation bool `json:"reservation,omitempty"`
+	// Delivery is set when the restaurant delivers.
+	Delivery bool `json:"delivery,omitempty"`
+	// Capacity is the largest group the restaurant seats comfortably, 0 when unlimited.
+	Capacity int `json:"capacity,omitempty"`
+	// Wait is the usual wait in minutes set with !set, 0 when unknown.
+	Wait int `json:"wait,omitempty"`
+	// WaitReports are the latest answers of attendees to the wait question
+	// of rating prompts, oldest first. Their average takes precedence over Wait.
+	WaitReports []WaitReport `json:"wait_reports,omitempty"`
+	// Payment lists the payment options the restaurant accepts, e.g. "vouchers".
+	Payment []string `json:"payment,omitempty"`
+	// Elo is the head-to-head score from !battle, meaningful once Battles > 0.
+	Elo     float64 `json:"elo,omitempty"`
+	Battles int     `json:"battles,omitempty"`
+	// Archived is set when the restaurant closed for good. Archived entries keep
+	// their history but are left out of lists, picks and polls.
+	Archived *Archive `json:"archived,omitempty"`
+	// Unavailable is set while the restaurant is closed for a while.
+	Unavailable *Unavailability `json:"unavailable,omitempty"`
+	// DeletedAt is set when the entry was soft-deleted by a bulk removal.
+	DeletedAt time.Time `json:"deleted_at,omitzero"`
+	// Revision counts the changes to the entry's details, see revise.
+	Revision int `json:"revision,omitempty"`
+	// History holds the latest revisions, oldest first.
+	History []RevisionEntry `json:"history,omitempty"`
+}
+
+// Deleted reports whether the entry has been soft-deleted.
+func (r *Restaurant) Deleted() bool {
+	return !r.DeletedAt.IsZero()
+}
+
+// IsArchived reports whether the restaurant has been archived as closed.
+func (r *Restaurant) IsArchived() bool {
+	return r.Archived != nil
+}
+
+// Archive records when and why a restaurant was archived.
+type Archive struct {
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason,omitempty"`
+}
 
-	dbFilePath = filepath
-	if _, err := os.Stat(dbFilePath); os.IsNotExist(err) {
-		log.Println("Creating database file:", dbFilePath)
-		// Create an empty JSON array `[]`
-		if err := os.WriteFile(dbFilePath, []byte("[]"), 0644); err != nil {
-			log.Fatalf("Failed to create database file: %v", err)
+// HasTag reports whether the entry carries a tag.
+func (r *Restaurant) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
 		}
 	}
-	log.Println("Database file is ready.")
+	return false
 }
 
-// GetAllRestaurants retrieves all restaurants from the JSON file.
-func GetAllRestaurants() ([]string, error) {
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
+// Visit records one lunch at a restaurant.
+type Visit struct {
+	Date time.Time `json:"date"`
+	// Attendees are the user IDs of the members who went, leaving out those
+	// who opted out of tracking.
+	Attendees []string `json:"attendees,omitempty"`
+	// RecordedBy is the user ID of the member who recorded the visit, empty
+	// for visits from before it was tracked.
+	RecordedBy string `json:"recorded_by,omitempty"`
+}
+
+// LastVisit returns the time of the most recent visit, or the zero time if there is none.
+func (r *Restaurant) LastVisit() time.Time {
+	var last time.Time
+	for _, v := range r.Visits {
+		if v.Date.After(last) {
+			last = v.Date
+		}
+	}
+	return last
+}
+
+// GuildData holds everything the bot stores for a single guild.
+type GuildData struct {
+	Restaurants []Restaurant      `json:"restaurants"`
+	Config      GuildConfig       `json:"config"`
+	Spotlight   *Spotlight        `json:"spotlight,omitempty"`
+	LastBackup  *BackupRecord     `json:"last_backup,omitempty"`
+	Polls       []Poll            `json:"polls,omitempty"`
+	Picks       []Pick            `json:"picks,omitempty"`
+	Schedules   []Schedule        `json:"schedules,omitempty"`
+	Audit       []AuditEntry      `json:"audit,omitempty"`
+	Usage       []UsageDay        `json:"usage,omitempty"`
+	Proposals   []RemovalProposal `json:"proposals,omitempty"`
+	Reminders   []Reminder        `json:"reminders,omitempty"`
+	Battles     []Battle          `json:"battles,omitempty"`
+	Tournament  *Tournament       `json:"tournament,omitempty"`
+	Champions   []Champion        `json:"champions,omitempty"`
+	// Members holds per-member preferences keyed by user ID.
+	Members     map[string]MemberSettings `json:"members,omitempty"`
+	LastBuddies *BuddyRound               `json:"last_buddies,omitempty"`
+	// LastRecap is the last month, as YYYY-MM, whose recap was posted.
+	LastRecap string `json:"last_recap,omitempty"`
+	// SnoozedOn is the day, as YYYY-MM-DD in the guild's timezone, whose schedules are snoozed.
+	SnoozedOn string    `json:"snoozed_on,omitempty"`
+	Holidays  []Holiday `json:"holidays,omitempty"`
+	// HolidayNotice is the last holiday, as YYYY-MM-DD, on which skipped schedules were announced.
+	HolidayNotice string    `json:"holiday_notice,omitempty"`
+	Expenses      []Expense `json:"expenses,omitempty"`
+	// Decisions are the recent poll winners and accepted picks, for the weekly summary.
+	Decisions []Decision `json:"decisions,omitempty"`
+	// LastPolls are the last closed poll of each channel, kept for `!poll again`.
+	LastPolls []Poll `json:"last_polls,omitempty"`
+	// PollHistory records the participation in closed polls, for /stats.
+	PollHistory []PollRecord `json:"poll_history,omitempty"`
+	// AnnounceAdminID is the admin who chose the announcement channel, told
+	// when the bot can't post there. AnnounceWarned is set once they were.
+	AnnounceAdminID string `json:"announce_admin_id,omitempty"`
+	AnnounceWarned  bool   `json:"announce_warned,omitempty"`
+	// RatingPrompts are the visits whose attendees will be asked for a rating.
+	RatingPrompts []RatingPrompt `json:"rating_prompts,omitempty"`
+	// OnboardedAt is when the onboarding wizard was posted, zero for guilds
+	// that never got one.
+	OnboardedAt time.Time `json:"onboarded_at,omitzero"`
+	// LunchFlows are the lunches being organized with !lunch.
+	LunchFlows []LunchFlow `json:"lunch_flows,omitempty"`
+	// DistinctPairs are the pairs of restaurant IDs, as "a:b" in order, that
+	// `!dedupe` was told aren't duplicates.
+	DistinctPairs []string `json:"distinct_pairs,omitempty"`
+	// NextID is the counter the next restaurant ID is taken from.
+	NextID int `json:"next_id,omitempty"`
+}
+
+// GuildConfig holds the per-guild options.
+type GuildConfig struct {
+	// Language is the message catalog used for replies, empty for English.
+	Language string `json:"language,omitempty"`
+	// Templates holds custom response templates keyed by template name.
+	Templates map[string]string `json:"templates,omitempty"`
+	// Flavors are the custom flavor texts of random picks, empty for the built-in ones.
+	Flavors []string `json:"flavors,omitempty"`
+	// SpotlightMode is either "pin" or "topic".
+	SpotlightMode string `json:"spotlight_mode,omitempty"`
+	// SpotlightChannelID is the channel that receives the weekly spotlight, empty when disabled.
+	SpotlightChannelID string `json:"spotlight_channel_id,omitempty"`
+	// BackupChannelID is the private channel that receives scheduled backups, empty when disabled.
+	BackupChannelID string `json:"backup_channel_id,omitempty"`
+	// BackupIntervalDays is the number of days between backups, 0 for the default.
+	BackupIntervalDays int `json:"backup_interval_days,omitempty"`
+	// Office is where the team starts from, used to sort by distance.
+	Office *Location `json:"office,omitempty"`
+	// AttributionStyle is "mention" or "name", empty for mentions.
+	AttributionStyle string `json:"attribution_style,omitempty"`
+	// MaxRestaurants limits the list size, 0 for the default. Only the bot owner may change it.
+	MaxRestaurants int `json:"max_restaurants,omitempty"`
+	// Timezone is the IANA name of the guild's timezone, empty for UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// APIChannelID is the channel announcing restaurants added through the HTTP API, empty when disabled.
+	APIChannelID string `json:"api_channel_id,omitempty"`
+	// PhotoChannelID is the channel !photo archives images in, empty when photos are disabled.
+	PhotoChannelID string `json:"photo_channel_id,omitempty"`
+	// RemovalVotes is the number of votes a removal proposal needs, 0 for the default.
+	RemovalVotes int `json:"removal_votes,omitempty"`
+	// PickWeight is how the random picker weights restaurants: empty for
+	// recency, "rating", "combined", "uniform" or "elo".
+	PickWeight string `json:"pick_weight,omitempty"`
+	// RecapChannelID is the channel that receives the monthly recap, empty when disabled.
+	RecapChannelID string `json:"recap_channel_id,omitempty"`
+	// ReopenChannelID is the channel told when unavailable restaurants become available again, empty when disabled.
+	ReopenChannelID string `json:"reopen_channel_id,omitempty"`
+	// RequiredPayments are payment options every random pick and poll candidate must accept.
+	RequiredPayments []string `json:"required_payments,omitempty"`
+	// HolidayCountry is the country whose public holidays schedules skip, empty for none.
+	HolidayCountry string `json:"holiday_country,omitempty"`
+	// BudgetCents is the monthly lunch budget in hundredths of the currency, 0 for none.
+	BudgetCents int `json:"budget_cents,omitempty"`
+	// Currency is the symbol amounts are written with, empty for defaultCurrency.
+	Currency string `json:"currency,omitempty"`
+	// FinanceRoleID is the role allowed to export expenses.
+	FinanceRoleID string `json:"finance_role_id,omitempty"`
+	// RatingHalfLifeMonths is the half-life of rating weights in months, 0 for plain averages.
+	RatingHalfLifeMonths int `json:"rating_half_life_months,omitempty"`
+	// UntriedEvery draws every Nth scheduled suggestion from the restaurants never visited, 0 when disabled.
+	UntriedEvery int `json:"untried_every,omitempty"`
+	// RatingPrompt is how attendees are asked to rate a visit: empty for the channel, "dm" or "off".
+	RatingPrompt string `json:"rating_prompt,omitempty"`
+	// PollDuration is how long polls stay open, 0 for pollDuration.
+	PollDuration time.Duration `json:"poll_duration,omitempty"`
+	// PollQuorum is the number of voters polls need by default, 0 for none.
+	PollQuorum int `json:"poll_quorum,omitempty"`
+	// VisitRetentionDays, AuditRetentionDays and UsageRetentionDays are how
+	// many days of visits, audit log entries and usage counts are kept: 0 for
+	// the default, retentionOff to keep them forever.
+	VisitRetentionDays int `json:"visit_retention_days,omitempty"`
+	AuditRetentionDays int `json:"audit_retention_days,omitempty"`
+	UsageRetentionDays int `json:"usage_retention_days,omitempty"`
+	// ReplyStyle is how command responses refer to the command: empty for
+	// replies without a ping, "plain" or "mention".
+	ReplyStyle string `json:"reply_style,omitempty"`
+	// AllowBots lets other bots and webhooks run commands, for servers
+	// bridging messages from elsewhere.
+	AllowBots bool `json:"allow_bots,omitempty"`
+	// AnnounceChannelID is the channel final lunch decisions are cross-posted to.
+	AnnounceChannelID string `json:"announce_channel_id,omitempty"`
+	// QuietHours is the range of local time, as HH:MM-HH:MM, during which
+	// scheduled posts, reminders and announcements are held.
+	QuietHours string `json:"quiet_hours,omitempty"`
+	// Directory shares the list's names, tags and addresses with other
+	// guilds through `!discover`.
+	Directory bool `json:"directory,omitempty"`
+	// MaxNameLength is the longest restaurant name accepted, 0 for defaultMaxNameLength.
+	MaxNameLength int `json:"max_name_length,omitempty"`
+	// Ack is how successful changes are acknowledged: empty for a reply,
+	// "reaction" for a reaction on the command.
+	Ack string `json:"ack,omitempty"`
+
+	// userLanguage is the language of the member being answered, used when
+	// the guild hasn't chosen one. It is never saved.
+	userLanguage string
+}
+
+// Lang returns the guild's reply language.
+func (cfg GuildConfig) Lang() string {
+	if cfg.Language != "" {
+		return cfg.Language
+	}
+	if cfg.userLanguage != "" {
+		return cfg.userLanguage
+	}
+	return defaultLanguage
+}
+
+// maxRestaurants returns the maximum number of restaurants on the guild's list.
+func (cfg GuildConfig) maxRestaurants() int {
+	if cfg.MaxRestaurants > 0 {
+		return cfg.MaxRestaurants
+	}
+	return defaultMaxRestaurants
+}
 
-	data, err := os.ReadFile(dbFilePath)
+// location returns the guild's timezone, UTC when unset or unknown.
+func (cfg GuildConfig) location() *time.Location {
+	if cfg.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
 	if err != nil {
-		return nil, err
+		return time.UTC
+	}
+	return loc
+}
+
+// database is the root of the JSON file.
+type database struct {
+	Version int                   `json:"version"`
+	Guilds  map[string]*GuildData `json:"guilds"`
+	// Unclaimed holds entries migrated from the original single-list format. They
+	// are handed to the first guild that touches the database after the upgrade.
+	Unclaimed []Restaurant `json:"unclaimed,omitempty"`
+	// Shares holds the list snapshots of `!share export-code`, keyed by code.
+	Shares map[string]*Share `json:"shares,omitempty"`
+	// Directory holds what the guilds that opted in contribute to the
+	// directory of `!discover`, keyed by guild ID.
+	Directory map[string]*DirectoryContribution `json:"directory,omitempty"`
+	// LogSeq is the last operation of the operation log the file includes.
+	LogSeq int64 `json:"log_seq,omitempty"`
+}
+
+// decodeDB parses a database file in any supported format.
+func decodeDB(data []byte) (*database, error) {
+	// Version 1 was a bare JSON array of names.
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var names []string
+		if err := json.Unmarshal(trimmed, &names); err != nil {
+			return nil, err
+		}
+		db := &database{Version: schemaVersion, Guilds: map[string]*GuildData{}}
+		for _, name := range names {
+			db.Unclaimed = append(db.Unclaimed, Restaurant{Name: name})
+		}
+		return db, nil
 	}
 
-	var restaurants []string
-	if err := json.Unmarshal(data, &restaurants); err != nil {
+	var db database
+	if err := json.Unmarshal(data, &db); err != nil {
 		return nil, err
 	}
+	if db.Version > schemaVersion {
+		return nil, fmt.Errorf("database version %d is newer than supported version %d", db.Version, schemaVersion)
+	}
+	if db.Guilds == nil {
+		db.Guilds = map[string]*GuildData{}
+	}
+	for _, g := range db.Guilds {
+		g.assignIDs()
+	}
+	db.Version = schemaVersion
+	return &db, nil
+}
+
+// guild returns the data for guildID, creating it if necessary.
+func (db *database) guild(guildID string) *GuildData {
+	g, ok := db.Guilds[guildID]
+	if !ok {
+		g = &GuildData{Restaurants: db.Unclaimed}
+		if len(db.Unclaimed) > 0 {
+			log.Printf("Guild %s claimed %d restaurants from the legacy list", guildID, len(db.Unclaimed))
+		}
+		db.Unclaimed = nil
+		db.Guilds[guildID] = g
+		g.assignIDs()
+	}
+	if g.Restaurants == nil {
+		g.Restaurants = []Restaurant{}
+	}
+	return g
+}
+
+// find returns the index of the restaurant with the given name or nickname,
+// or -1. Names match case-insensitively, then nicknames, then both ignoring
+// accents and punctuation.
+func (g *GuildData) find(name string) int {
+	for i, r := range g.Restaurants {
+		if !r.Deleted() && strings.EqualFold(r.Name, name) {
+			return i
+		}
+	}
+	for i, r := range g.Restaurants {
+		if !r.Deleted() && r.hasAlias(name) {
+			return i
+		}
+	}
+	normalized := normalizeName(name)
+	if normalized == "" {
+		return -1
+	}
+	for i, r := range g.Restaurants {
+		if !r.Deleted() && slices.ContainsFunc(r.allNames(), func(n string) bool { return normalizeName(n) == normalized }) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextID returns a new restaurant ID. IDs count up in base 36 and are never
+// handed out twice, even after the entry is removed.
+func (g *GuildData) nextID() string {
+	g.NextID++
+	return strconv.FormatInt(int64(g.NextID), 36)
+}
+
+// assignIDs gives entries from before stable IDs one, in list order so that
+// the same file always migrates to the same IDs.
+func (g *GuildData) assignIDs() {
+	for i := range g.Restaurants {
+		if g.Restaurants[i].ID == "" {
+			g.Restaurants[i].ID = g.nextID()
+		}
+	}
+}
 
-	return restaurants, nil
+// findID returns the index of the restaurant with the given ID, or -1.
+func (g *GuildData) findID(id string) int {
+	for i, r := range g.Restaurants {
+		if !r.Deleted() && strings.EqualFold(r.ID, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookup returns the index of the named restaurant, or a *NotFoundError
+// suggesting similarly named entries. A name of the form id:xyz refers to the
+// entry with that ID.
+func (g *GuildData) lookup(name string) (int, error) {
+	if id, ok := strings.CutPrefix(name, idPrefix); ok {
+		if i := g.findID(id); i >= 0 {
+			return i, nil
+		}
+		return -1, &NotFoundError{Name: name}
+	}
+	if i := g.find(name); i >= 0 {
+		return i, nil
+	}
+	suggestions := g.similarNames(name)
+	return -1, &NotFoundError{Name: name, Suggestions: suggestions[:min(len(suggestions), maxSuggestions)]}
+}
+
+// active returns the restaurants that haven't been deleted, in list order.
+func (g *GuildData) active() []Restaurant {
+	active := make([]Restaurant, 0, len(g.Restaurants))
+	for _, r := range g.Restaurants {
+		if !r.Deleted() {
+			active = append(active, r)
+		}
+	}
+	return active
+}
+
+// open returns the restaurants that are neither deleted nor archived, in list order.
+func (g *GuildData) open() []Restaurant {
+	var open []Restaurant
+	for _, r := range g.Restaurants {
+		if !r.Deleted() && !r.IsArchived() {
+			open = append(open, r)
+		}
+	}
+	return open
+}
+
+// count returns the number of restaurants that are neither deleted nor
+// archived. This is what the list size limit applies to.
+func (g *GuildData) count() int {
+	n := 0
+	for _, r := range g.Restaurants {
+		if !r.Deleted() && !r.IsArchived() {
+			n++
+		}
+	}
+	return n
+}
+
+// names returns the names of all restaurants in list order.
+func (g *GuildData) names() []string {
+	var names []string
+	for _, r := range g.active() {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// GetAllRestaurants retrieves the names of all of a guild's restaurants.
+func GetAllRestaurants(guildID string) ([]string, error) {
+	var names []string
+	err := viewGuild(guildID, func(g *GuildData) error {
+		names = g.names()
+		return nil
+	})
+	return names, err
+}
+
+// GetRestaurants retrieves all of a guild's restaurants that haven't been
+// deleted, including archived ones.
+func GetRestaurants(guildID string) ([]Restaurant, error) {
+	var restaurants []Restaurant
+	err := viewGuild(guildID, func(g *GuildData) error {
+		restaurants = g.active()
+		return nil
+	})
+	return restaurants, err
+}
+
+// GetGuildConfig returns a guild's options.
+func GetGuildConfig(guildID string) (GuildConfig, error) {
+	var cfg GuildConfig
+	err := viewGuild(guildID, func(g *GuildData) error {
+		cfg = g.Config
+		return nil
+	})
+	return cfg, err
 }
 
 // CheckForDuplicate calls the ML API to check for duplicate restaurant names.
-func CheckForDuplicate(name string) (*DuplicateCheckResponse, error) {
-	restaurants, err := GetAllRestaurants()
+func CheckForDuplicate(ctx context.Context, guildID, name string) (*DuplicateCheckResponse, error) {
+	restaurants, err := GetAllRestaurants(guildID)
 	if err != nil {
 		return nil, err
 	}
 
-	mlApiURL := os.Getenv("ML_API_URL")
+	mlApiURL := currentConfig().MLAPIURL
 	if mlApiURL == "" {
 		mlApiURL = "http://localhost:8000/process-message"
 	}
@@ -82,7 +585,13 @@ func CheckForDuplicate(name string) (*DuplicateCheckResponse, error) {
 		return nil, err
 	}
 
-	resp, err := http.Post(mlApiURL, "application/json", bytes.NewBuffer(jsonData))
+	defer enterStage(ctx, "ML API duplicate check")()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mlApiURL, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -103,11 +612,11 @@ func CheckForDuplicate(name string) (*DuplicateCheckResponse, error) {
 	return &apiResp.Result, nil
 }
 
-
 // AddRestaurant first checks for duplicates, then adds a new restaurant if none are found.
-// It returns an error if a duplicate is found.
-func AddRestaurant(name string) (int, *DuplicateCheckResponse, error) {
-	duplicateInfo, err := CheckForDuplicate(name)
+// It returns the duplicate info instead of adding when a likely duplicate is found,
+// and ErrListFull when the list has reached the guild's limit.
+func AddRestaurant(ctx context.Context, guildID, name string, by Contributor) (int, *DuplicateCheckResponse, error) {
+	duplicateInfo, err := CheckForDuplicate(ctx, guildID, name)
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to check for duplicates: %w", err)
 	}
@@ -117,78 +626,82 @@ func AddRestaurant(name string) (int, *DuplicateCheckResponse, error) {
 	}
 
 	// If no duplicate, add the restaurant
-	count, err := ForceAddRestaurant(name)
+	count, err := ForceAddRestaurant(guildID, name, by)
 	return count, nil, err
 }
 
-// ForceAddRestaurant adds a new restaurant to the JSON file without checking for duplicates.
-func ForceAddRestaurant(name string) (int, error) {
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
-
-	data, err := os.ReadFile(dbFilePath)
-	if err != nil {
-		return 0, err
-	}
-
-	var restaurants []string
-	if err := json.Unmarshal(data, &restaurants); err != nil {
-		return 0, err
-	}
-
-	restaurants = append(restaurants, name)
-
-	newData, err := json.MarshalIndent(restaurants, "", "  ")
-	if err != nil {
-		return 0, err
-	}
-
-	if err := os.WriteFile(dbFilePath, newData, 0644); err != nil {
-		return 0, err
-	}
-
-	return len(restaurants), nil
+// ForceAddRestaurant adds a new restaurant without checking for duplicates.
+// It returns ErrListFull when the list has reached the guild's limit, and
+// the error of validateName for a name the guild doesn't accept.
+func ForceAddRestaurant(guildID, name string, by Contributor) (int, error) {
+	var count int
+	err := updateGuild(guildID, func(g *GuildData) error {
+		if err := validateName(name, g.Config.maxNameLength()); err != nil {
+			return err
+		}
+		if g.count() >= g.Config.maxRestaurants() {
+			return ErrListFull
+		}
+		g.Restaurants = append(g.Restaurants, Restaurant{ID: g.nextID(), Name: name, AddedAt: time.Now().UTC(), AddedBy: &by})
+		g.audit(auditAdd, name, &by, sourceDiscord)
+		count = g.count()
+		return nil
+	})
+	return count, err
 }
 
-
-// RemoveRestaurant removes a restaurant from the JSON file.
-// It returns the total number of restaurants after removal, and an error if not found.
-func RemoveRestaurant(name string) (int, error) {
-	fileMutex.Lock()
-	defer fileMutex.Unlock()
-
-	data, err := os.ReadFile(dbFilePath)
-	if err != nil {
-		return 0, err
-	}
-
-	var restaurants []string
-	if err := json.Unmarshal(data, &restaurants); err != nil {
-		return 0, err
-	}
-
-	found := false
-	newRestaurants := []string{}
-	for _, r := range restaurants {
-		if r == name {
-			found = true
-		} else {
-			newRestaurants = append(newRestaurants, r)
+// RemoveRestaurant removes a restaurant from a guild's list.
+// It returns the removed restaurant and the total number of restaurants
+// after removal, and an error if not found.
+func RemoveRestaurant(guildID, name string, by Contributor) (Restaurant, int, error) {
+	var removed Restaurant
+	var count int
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			count = g.count()
+			return err
 		}
-	}
-
-	if !found {
-		return len(restaurants), fmt.Errorf("restaurant '%s' not found", name)
-	}
-
-	newData, err := json.MarshalIndent(newRestaurants, "", "  ")
-	if err != nil {
-		return 0, err
-	}
+		removed = g.Restaurants[i]
+		g.Restaurants = append(g.Restaurants[:i], g.Restaurants[i+1:]...)
+		g.audit(auditRemove, removed.Name, &by, sourceDiscord)
+		count = g.count()
+		return nil
+	})
+	return removed, count, err
+}
 
-	if err := os.WriteFile(dbFilePath, newData, 0644); err != nil {
-		return 0, err
-	}
+// RecordVisit records a visit to a restaurant at the given time by the given
+// members on behalf of recordedBy, asking them to rate it later in channelID.
+// It returns the restaurant's canonical name and its total number of visits.
+func RecordVisit(guildID, name string, at time.Time, attendees []string, recordedBy, channelID string) (string, int, error) {
+	var canonical string
+	var visits int
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		visit := Visit{Date: at.UTC(), Attendees: g.tracked(attendees), RecordedBy: recordedBy}
+		r.Visits = append(r.Visits, visit)
+		g.promptRating(r, visit, channelID)
+		canonical, visits = r.Name, len(r.Visits)
+		return nil
+	})
+	return canonical, visits, err
+}
 
-	return len(newRestaurants), nil
+// leastRecentlyVisited orders restaurants so that never-visited and
+// longest-unvisited entries come first. Ties are broken by age on the list.
+func leastRecentlyVisited(restaurants []Restaurant) []Restaurant {
+	sorted := append([]Restaurant(nil), restaurants...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		li, lj := sorted[i].LastVisit(), sorted[j].LastVisit()
+		if !li.Equal(lj) {
+			return li.Before(lj)
+		}
+		return sorted[i].AddedAt.Before(sorted[j].AddedAt)
+	})
+	return sorted
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// errorRingSize is the number of error records `!debug` shows.
+	errorRingSize = 50
+	// maxDebugMessage is the longest dump sent as a message rather than a file.
+	maxDebugMessage = 1900
+)
+
+// errorRecord is a logged error kept for `!debug`.
+type errorRecord struct {
+	At      time.Time
+	Message string
+}
+
+// recentErrors holds the last errorRingSize error records, oldest first once full.
+var recentErrors = struct {
+	sync.Mutex
+	records [errorRingSize]errorRecord
+	next    int
+	total   int
+}{}
+
+// rememberError adds a record to the ring buffer, overwriting the oldest.
+func rememberError(r errorRecord) {
+	recentErrors.Lock()
+	defer recentErrors.Unlock()
+	recentErrors.records[recentErrors.next] = r
+	recentErrors.next = (recentErrors.next + 1) % errorRingSize
+	recentErrors.total++
+}
+
+// errorHistory returns the records in the ring buffer, oldest first, and how
+// many errors were logged in total.
+func errorHistory() ([]errorRecord, int) {
+	recentErrors.Lock()
+	defer recentErrors.Unlock()
+	n := min(recentErrors.total, errorRingSize)
+	records := make([]errorRecord, 0, n)
+	for i := range n {
+		records = append(records, recentErrors.records[(recentErrors.next-n+i+errorRingSize)%errorRingSize])
+	}
+	return records, recentErrors.total
+}
+
+// logLevel is the least severe level logged. SIGHUP sets it from LOG_LEVEL.
+var logLevel slog.LevelVar
+
+// errorRingHandler passes records at logLevel or above on to another
+// handler, keeping the errors in recentErrors. Records from the log package
+// all arrive at the info level, so their messages are recognized by the
+// "Failed" and "Panic" prefixes this code base logs failures with, and those
+// are logged at any level.
+type errorRingHandler struct {
+	slog.Handler
+}
+
+// isErrorRecord reports whether a record reports a failure.
+func isErrorRecord(r slog.Record) bool {
+	return r.Level >= slog.LevelWarn || isFailureMessage(r.Message)
+}
+
+// isFailureMessage reports whether a message logged with the log package
+// reports a failure.
+func isFailureMessage(message string) bool {
+	return strings.HasPrefix(message, "Failed") || strings.HasPrefix(message, "Panic")
+}
+
+// Enabled lets through the info records of the log package, which may be
+// failures, whatever logLevel is.
+func (h errorRingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= min(logLevel.Level(), slog.LevelInfo)
+}
+
+func (h errorRingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if isErrorRecord(r) {
+		rememberError(errorRecord{At: r.Time, Message: r.Message})
+	}
+	if r.Level < logLevel.Level() && !isFailureMessage(r.Message) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h errorRingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return errorRingHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h errorRingHandler) WithGroup(name string) slog.Handler {
+	return errorRingHandler{h.Handler.WithGroup(name)}
+}
+
+// installErrorRing routes the log package and slog through errorRingHandler.
+func installErrorRing() {
+	slog.SetDefault(slog.New(errorRingHandler{slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})}))
+}
+
+// redactSecrets hides the tokens and encryption keys wherever they appear.
+func redactSecrets(text string) string {
+	for _, name := range []string{"DISCORD_TOKEN", "API_TOKEN", "DB_ENCRYPTION_KEY", "DB_ENCRYPTION_OLD_KEY"} {
+		if secret := os.Getenv(name); len(secret) >= 8 {
+			text = strings.ReplaceAll(text, secret, "[redacted "+name+"]")
+		}
+	}
+	return text
+}
+
+// debugDump describes the bot's state for a guild.
+func debugDump(guildID string, now time.Time) (string, error) {
+	var b strings.Builder
+	bi, up := currentBuild(), currentUptime()
+	fmt.Fprintf(&b, "Debug dump for guild %s at %s\n", guildID, now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Build: %s (%s), %s, discordgo %s\n", bi.Version, shortCommit(bi.Commit), bi.Go, bi.Discordgo)
+	fmt.Fprintf(&b, "Uptime: %s, %d reconnects, slash-only: %v\n", formatUptime(now.Sub(up.StartedAt)), up.Reconnects, slashOnly.Load())
+	fmt.Fprintf(&b, "Shards: %s, guild on shard %d\n", gatewayShards, guildShardID(guildID, gatewayShards.Count))
+	if at := lastDBWrite(); at.IsZero() {
+		fmt.Fprintf(&b, "Last database write: none since start\n")
+	} else {
+		fmt.Fprintf(&b, "Last database write: %s (%s ago)\n", at.UTC().Format(time.RFC3339), formatUptime(now.Sub(at)))
+	}
+	fmt.Fprintf(&b, "Unsaved changes: %v\n", dirty.Load())
+
+	err := viewGuild(guildID, func(g *GuildData) error {
+		fmt.Fprintf(&b, "\nRestaurants: %d open, %d incl. archived, %d entries in total\n", g.count(), len(g.active()), len(g.Restaurants))
+		fmt.Fprintf(&b, "Polls: %d open\n", len(g.Polls))
+		for _, p := range g.Polls {
+			fmt.Fprintf(&b, "  - message %s in %s, %d options, closes %s\n", p.MessageID, p.ChannelID, len(p.Options), p.ClosesAt.UTC().Format(time.RFC3339))
+		}
+		fmt.Fprintf(&b, "Reminders: %d pending\n", len(g.Reminders))
+		for _, r := range g.Reminders {
+			fmt.Fprintf(&b, "  - %s for %s in %s at %s\n", r.ID, r.UserID, r.ChannelID, r.At.UTC().Format(time.RFC3339))
+		}
+		fmt.Fprintf(&b, "Schedules: %d\n", len(g.Schedules))
+		for _, s := range g.Schedules {
+			fmt.Fprintf(&b, "  - %s: %s at %s in %s\n", s.ID, s.Kind, s.Time, s.ChannelID)
+		}
+		fmt.Fprintf(&b, "Rating prompts: %d, removal proposals: %d, picks: %d\n", len(g.RatingPrompts), len(g.Proposals), len(g.Picks))
+		settings, err := json.MarshalIndent(g.Config, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\nSettings:\n%s\n", settings)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	b.WriteString("\nCaches:\n")
+	previewFetches.Lock()
+	fmt.Fprintf(&b, "  link preview fetches: %d\n", len(previewFetches.at))
+	previewFetches.Unlock()
+	pendingUsageMutex.Lock()
+	fmt.Fprintf(&b, "  guilds with unsaved usage: %d\n", len(pendingUsage))
+	pendingUsageMutex.Unlock()
+	pendingAddsMutex.Lock()
+	pendingBulkRemovalsMutex.Lock()
+	pendingSeedsMutex.Lock()
+	pendingSettingsImportsMutex.Lock()
+	pendingForgetsMutex.Lock()
+	fmt.Fprintf(&b, "  pending confirmations: %d adds, %d bulk removals, %d seeds, %d settings imports, %d forget requests\n",
+		len(pendingAdds), len(pendingBulkRemovals), len(pendingSeeds), len(pendingSettingsImports), len(pendingForgets))
+	pendingForgetsMutex.Unlock()
+	pendingSettingsImportsMutex.Unlock()
+	pendingSeedsMutex.Unlock()
+	pendingBulkRemovalsMutex.Unlock()
+	pendingAddsMutex.Unlock()
+	fmt.Fprintf(&b, "  handler panics: %d\n", handlerPanics.Load())
+
+	records, total := errorHistory()
+	fmt.Fprintf(&b, "\nRecent errors (%d of %d since start):\n", len(records), total)
+	for _, r := range records {
+		fmt.Fprintf(&b, "  %s %s\n", r.At.UTC().Format(time.RFC3339), r.Message)
+	}
+	return redactSecrets(b.String()), nil
+}
+
+// handleDebug implements `!debug`, sending the bot owner a state dump by
+// direct message, as a file when it is too long for a message.
+func handleDebug(c *Context) {
+	if !c.RequireOwner() {
+		return
+	}
+	dump, err := debugDump(c.GuildID, time.Now())
+	if err != nil {
+		log.Printf("Failed to build debug dump: %v", err)
+		c.Reply("debug.failed", nil)
+		return
+	}
+	msg := &discordgo.MessageSend{Content: "```\n" + dump + "```"}
+	if len(msg.Content) > maxDebugMessage {
+		msg = &discordgo.MessageSend{
+			Content: c.T("debug.attached", nil),
+			Files:   []*discordgo.File{{Name: "debug-" + c.GuildID + ".txt", ContentType: "text/plain", Reader: strings.NewReader(dump)}},
+		}
+	}
+	if c.SendPrivateComplex(msg) {
+		c.Reply("debug.sent", nil)
+	}
+}
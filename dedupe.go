@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// minDuplicateScore is the duplicateScore from which !dedupe suggests a pair.
+	minDuplicateScore = 0.7
+	// minSpellingScore is the edit similarity at which two names count as
+	// the same name misspelled, whatever their words.
+	minSpellingScore = 0.85
+	// maxDedupePairs is the number of pairs !dedupe shows at once.
+	maxDedupePairs = 10
+	// maxDedupeComparisons caps the pairs one scan compares, enough for a
+	// list of 700 entries.
+	maxDedupeComparisons = 250000
+)
+
+var (
+	// dedupeScans holds the guilds with a scan running, so that a second
+	// !dedupe doesn't start another one.
+	dedupeScans      = map[string]bool{}
+	dedupeScansMutex sync.Mutex
+)
+
+// duplicatePair is a pair of restaurants that may be the same place.
+type duplicatePair struct {
+	A, B  Restaurant
+	Score float64
+}
+
+// pairKey identifies a pair of restaurants regardless of their order.
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + ":" + b
+}
+
+// nameTokens returns the set of words of a normalized name.
+func nameTokens(name string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(name) {
+		set[w] = true
+	}
+	return set
+}
+
+// duplicateScore scores how likely two names are the same restaurant, from 0
+// to 1. It averages the normalized edit distance, ignoring spaces, with the
+// share of words the shorter name has in common with the longer one. A close
+// enough spelling alone counts too, so that "Pho 24" and "Pho24" match as
+// well as "Thai Palace" and "Thai Palace Restaurant".
+func duplicateScore(a, b string) float64 {
+	return normalizedDuplicateScore(normalizeName(a), normalizeName(b))
+}
+
+// normalizedDuplicateScore is duplicateScore for names already normalized.
+func normalizedDuplicateScore(na, nb string) float64 {
+	ca, cb := strings.ReplaceAll(na, " ", ""), strings.ReplaceAll(nb, " ", "")
+	longest := max(len([]rune(ca)), len([]rune(cb)))
+	if longest == 0 {
+		return 0
+	}
+	edit := 1 - float64(levenshtein(ca, cb))/float64(longest)
+	ta, tb := nameTokens(na), nameTokens(nb)
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	overlap := 0.0
+	if fewest := min(len(ta), len(tb)); fewest > 0 {
+		overlap = float64(shared) / float64(fewest)
+	}
+	if edit >= minSpellingScore {
+		return edit
+	}
+	return (edit + overlap) / 2
+}
+
+// findDuplicates compares the restaurants pairwise and returns the pairs
+// scoring at least minDuplicateScore, best first, leaving out the pairs in
+// distinct. It compares at most maxDedupeComparisons pairs and reports
+// whether it had to stop early.
+func findDuplicates(restaurants []Restaurant, distinct []string) ([]duplicatePair, bool) {
+	names := make([]string, len(restaurants))
+	lengths := make([]int, len(restaurants))
+	for i, r := range restaurants {
+		names[i] = normalizeName(r.Name)
+		lengths[i] = len([]rune(strings.ReplaceAll(names[i], " ", "")))
+	}
+	skip := map[string]bool{}
+	for _, key := range distinct {
+		skip[key] = true
+	}
+	var pairs []duplicatePair
+	comparisons := 0
+	for i := range restaurants {
+		for j := i + 1; j < len(restaurants); j++ {
+			if comparisons == maxDedupeComparisons {
+				return sortDuplicates(pairs), true
+			}
+			comparisons++
+			// The edit distance is at least the difference in length, so names
+			// of very different lengths can't reach the threshold even with
+			// all their words in common.
+			longest, shortest := max(lengths[i], lengths[j]), min(lengths[i], lengths[j])
+			if longest > 0 && 1-float64(longest-shortest)/float64(longest) < 2*minDuplicateScore-1 {
+				continue
+			}
+			if skip[pairKey(restaurants[i].ID, restaurants[j].ID)] {
+				continue
+			}
+			if score := normalizedDuplicateScore(names[i], names[j]); score >= minDuplicateScore {
+				pairs = append(pairs, duplicatePair{restaurants[i], restaurants[j], score})
+			}
+		}
+	}
+	return sortDuplicates(pairs), false
+}
+
+// sortDuplicates orders pairs by score, then by name.
+func sortDuplicates(pairs []duplicatePair) []duplicatePair {
+	sort.SliceStable(pairs, func(i, j int) bool {
+		if pairs[i].Score != pairs[j].Score {
+			return pairs[i].Score > pairs[j].Score
+		}
+		return pairs[i].A.Name < pairs[j].A.Name
+	})
+	return pairs
+}
+
+// handleDedupe implements `!dedupe`, suggesting restaurants that may be
+// listed twice with buttons to merge them. The scan runs in the background.
+func handleDedupe(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	dedupeScansMutex.Lock()
+	running := dedupeScans[c.GuildID]
+	dedupeScans[c.GuildID] = true
+	dedupeScansMutex.Unlock()
+	if running {
+		c.Reply("dedupe.running", nil)
+		return
+	}
+
+	go func() {
+		defer func() {
+			dedupeScansMutex.Lock()
+			delete(dedupeScans, c.GuildID)
+			dedupeScansMutex.Unlock()
+		}()
+		var restaurants []Restaurant
+		var distinct []string
+		if err := viewGuild(c.GuildID, func(g *GuildData) error {
+			restaurants, distinct = g.active(), g.DistinctPairs
+			return nil
+		}); err != nil {
+			log.Printf("Failed to load restaurants: %v", err)
+			c.Reply("list.failed", nil)
+			return
+		}
+		pairs, partial := findDuplicates(restaurants, distinct)
+		if len(pairs) == 0 {
+			c.Reply("dedupe.none", nil)
+			return
+		}
+		header := []string{c.T("dedupe.header", Args{"count": len(pairs), "shown": min(len(pairs), maxDedupePairs)})}
+		if partial {
+			header = append(header, c.T("dedupe.partial", Args{"count": maxDedupeComparisons}))
+		}
+		c.Send(strings.Join(header, "\n"))
+		for _, p := range pairs[:min(len(pairs), maxDedupePairs)] {
+			if _, err := c.SendComplex(&discordgo.MessageSend{
+				Embeds:     []*discordgo.MessageEmbed{duplicateEmbed(c.Config, p)},
+				Components: duplicateButtons(c.Config, p),
+			}); err != nil {
+				log.Printf("Failed to send duplicate pair: %v", err)
+				return
+			}
+		}
+	}()
+}
+
+// duplicateEmbed shows the two restaurants of a pair side by side.
+func duplicateEmbed(cfg GuildConfig, p duplicatePair) *discordgo.MessageEmbed {
+	field := func(label string, r Restaurant) *discordgo.MessageEmbedField {
+		added := "-"
+		if !r.AddedAt.IsZero() {
+			added = r.AddedAt.In(cfg.location()).Format("2006-01-02")
+		}
+		return &discordgo.MessageEmbedField{
+			Name:   label + ": " + truncateRunes(r.Name, 200),
+			Value:  listEntry(r) + "\n" + cfg.T("dedupe.details", Args{"id": idPrefix + r.ID, "count": len(r.Visits), "added": added}),
+			Inline: true,
+		}
+	}
+	return &discordgo.MessageEmbed{
+		Color:  previewColor,
+		Fields: []*discordgo.MessageEmbedField{field("A", p.A), field("B", p.B)},
+	}
+}
+
+// duplicateButtons builds the Merge A←B, Merge B←A and Not duplicates buttons.
+// Their custom IDs name the restaurant kept first.
+func duplicateButtons(cfg GuildConfig, p duplicatePair) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{buttonRow(
+		discordgo.Button{Label: cfg.T("button.merge_into_a", nil), Style: discordgo.PrimaryButton, CustomID: "dedupe:merge:" + p.A.ID + ":" + p.B.ID},
+		discordgo.Button{Label: cfg.T("button.merge_into_b", nil), Style: discordgo.PrimaryButton, CustomID: "dedupe:merge:" + p.B.ID + ":" + p.A.ID},
+		discordgo.Button{Label: cfg.T("button.not_duplicates", nil), Style: discordgo.SecondaryButton, CustomID: "dedupe:distinct:" + p.A.ID + ":" + p.B.ID},
+	)}
+}
+
+// MarkDistinct records that two restaurants aren't duplicates, so that
+// !dedupe doesn't suggest them again.
+func MarkDistinct(guildID, a, b string) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		if key := pairKey(a, b); !slices.Contains(g.DistinctPairs, key) {
+			g.DistinctPairs = append(g.DistinctPairs, key)
+		}
+		return nil
+	})
+}
+
+// handleDedupeComponent handles the buttons of a suggested duplicate pair.
+func handleDedupeComponent(i *Interaction) {
+	if len(i.Args) != 3 {
+		return
+	}
+	action, a, b := i.Args[0], i.Args[1], i.Args[2]
+	if !isAdmin(i.Session, i.Event.ChannelID, i.UserID()) {
+		i.Ephemeral("error.admin_only", nil)
+		return
+	}
+	switch action {
+	case "merge":
+		// Merge B into A, keeping A.
+		change, err := MergeRestaurants(i.GuildID, idPrefix+b, idPrefix+a, contributorFor(i.Event.Member.User))
+		switch {
+		case errors.Is(err, ErrRestaurantNotFound):
+			i.Update(i.T("dedupe.gone", nil), nil)
+		case err != nil:
+			log.Printf("Failed to merge restaurants: %v", err)
+			i.Ephemeral("merge.failed", Args{"name": idPrefix + b})
+		default:
+			source, target := change.Before[0], change.After[0]
+			i.Update(i.T("merge.done", Args{"from": source.Name, "into": target.Name, "count": len(target.Visits)}), nil)
+		}
+	case "distinct":
+		if err := MarkDistinct(i.GuildID, a, b); err != nil {
+			log.Printf("Failed to save distinct pair: %v", err)
+			i.Ephemeral("settings.save_failed", nil)
+			return
+		}
+		i.Update(i.T("dedupe.distinct", nil), nil)
+	}
+}
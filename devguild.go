@@ -0,0 +1,149 @@
+package main
+
+import (
+	"cmp"
+	"log"
+	"maps"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// devGuildID returns the guild named by DEV_GUILD_ID, where the slash
+// commands are kept in step with the code while working on them.
+func devGuildID() string {
+	return os.Getenv("DEV_GUILD_ID")
+}
+
+// devCleanupEnabled reports whether DEV_CLEANUP asks for the development
+// guild's commands to be deleted on shutdown.
+func devCleanupEnabled() bool {
+	on, _ := strconv.ParseBool(os.Getenv("DEV_CLEANUP"))
+	return on
+}
+
+// slashCommands are the application commands the code defines.
+func slashCommands() []*discordgo.ApplicationCommand {
+	return []*discordgo.ApplicationCommand{slashCommand(), editCommand(), statsCommand()}
+}
+
+// commandChanges names the parts of a registered command that differ from
+// its definition, none when it is up to date.
+func commandChanges(registered, defined *discordgo.ApplicationCommand) []string {
+	localizations := func(m *map[discordgo.Locale]string) map[discordgo.Locale]string {
+		if m == nil {
+			return nil
+		}
+		return *m
+	}
+	var changes []string
+	if cmp.Or(registered.Type, discordgo.ChatApplicationCommand) != cmp.Or(defined.Type, discordgo.ChatApplicationCommand) {
+		changes = append(changes, "type")
+	}
+	if !maps.Equal(localizations(registered.NameLocalizations), localizations(defined.NameLocalizations)) {
+		changes = append(changes, "name localizations")
+	}
+	if registered.Description != defined.Description {
+		changes = append(changes, "description")
+	}
+	if !maps.Equal(localizations(registered.DescriptionLocalizations), localizations(defined.DescriptionLocalizations)) {
+		changes = append(changes, "description localizations")
+	}
+	if len(registered.Options) != len(defined.Options) {
+		changes = append(changes, "options")
+		return changes
+	}
+	for i, o := range registered.Options {
+		d := defined.Options[i]
+		if o.Type != d.Type || o.Name != d.Name || o.Description != d.Description || o.Required != d.Required ||
+			!maps.Equal(o.NameLocalizations, d.NameLocalizations) || !maps.Equal(o.DescriptionLocalizations, d.DescriptionLocalizations) ||
+			len(o.Choices) != len(d.Choices) || len(o.Choices) > 0 && !reflect.DeepEqual(o.Choices, d.Choices) {
+			changes = append(changes, "options")
+			break
+		}
+	}
+	return changes
+}
+
+// reconcileDevCommands makes the development guild's commands match the
+// code: missing commands are created, changed ones updated and the others
+// deleted, logging every change. Global commands and other guilds'
+// commands are left alone, and only the process owning the guild's shard
+// touches it.
+func reconcileDevCommands(s *discordgo.Session) {
+	guildID := devGuildID()
+	if guildID == "" || !ownsGuild(guildID) {
+		return
+	}
+	appID := s.State.User.ID
+	registered, err := s.ApplicationCommands(appID, guildID)
+	if err != nil {
+		log.Printf("Failed to list the commands of development guild %s: %v", guildID, err)
+		return
+	}
+	byName := make(map[string]*discordgo.ApplicationCommand, len(registered))
+	for _, cmd := range registered {
+		byName[cmd.Name] = cmd
+	}
+
+	changed := false
+	for _, cmd := range slashCommands() {
+		existing, ok := byName[cmd.Name]
+		delete(byName, cmd.Name)
+		if !ok {
+			if _, err := s.ApplicationCommandCreate(appID, guildID, cmd); err != nil {
+				log.Printf("Failed to create /%s in development guild %s: %v", cmd.Name, guildID, err)
+				continue
+			}
+			log.Printf("Development guild %s: created /%s", guildID, cmd.Name)
+			changed = true
+			continue
+		}
+		changes := commandChanges(existing, cmd)
+		if len(changes) == 0 {
+			continue
+		}
+		if _, err := s.ApplicationCommandEdit(appID, guildID, existing.ID, cmd); err != nil {
+			log.Printf("Failed to update /%s in development guild %s: %v", cmd.Name, guildID, err)
+			continue
+		}
+		log.Printf("Development guild %s: updated /%s (%s)", guildID, cmd.Name, strings.Join(changes, ", "))
+		changed = true
+	}
+	for name, cmd := range byName {
+		if err := s.ApplicationCommandDelete(appID, guildID, cmd.ID); err != nil {
+			log.Printf("Failed to delete /%s from development guild %s: %v", name, guildID, err)
+			continue
+		}
+		log.Printf("Development guild %s: deleted /%s", guildID, name)
+		changed = true
+	}
+	if !changed {
+		log.Printf("Development guild %s: commands are up to date", guildID)
+	}
+}
+
+// cleanupDevCommands deletes all of the development guild's commands when
+// DEV_CLEANUP is set, so that none are left behind after a session.
+func cleanupDevCommands(s *discordgo.Session) {
+	guildID := devGuildID()
+	if guildID == "" || !devCleanupEnabled() || !ownsGuild(guildID) {
+		return
+	}
+	appID := s.State.User.ID
+	registered, err := s.ApplicationCommands(appID, guildID)
+	if err != nil {
+		log.Printf("Failed to list the commands of development guild %s: %v", guildID, err)
+		return
+	}
+	for _, cmd := range registered {
+		if err := s.ApplicationCommandDelete(appID, guildID, cmd.ID); err != nil {
+			log.Printf("Failed to delete /%s from development guild %s: %v", cmd.Name, guildID, err)
+			continue
+		}
+		log.Printf("Development guild %s: deleted /%s", guildID, cmd.Name)
+	}
+}
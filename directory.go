@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxDiscoverResults is how many directory entries !discover shows, one row of buttons.
+	maxDiscoverResults = 5
+	// discoverTimeout is how long the import buttons of !discover stay valid.
+	discoverTimeout = 10 * time.Minute
+)
+
+// lastDirectoryRefresh is the UTC day, as YYYY-MM-DD, the contributions were
+// last refreshed. Refreshing again after a restart is harmless.
+var lastDirectoryRefresh string
+
+// DirectoryContribution is what a guild that opted in with `!settings
+// directory on` shares with the others: its open restaurants' names, tags
+// and addresses, and nothing about its members or visits.
+type DirectoryContribution struct {
+	UpdatedAt time.Time        `json:"updated_at"`
+	Entries   []DirectoryEntry `json:"entries"`
+}
+
+// DirectoryEntry is a restaurant in the directory.
+type DirectoryEntry struct {
+	Name    string   `json:"name"`
+	Tags    []string `json:"tags,omitempty"`
+	Address string   `json:"address,omitempty"`
+}
+
+// contribution builds what the guild contributes to the directory.
+func (g *GuildData) contribution(now time.Time) *DirectoryContribution {
+	c := &DirectoryContribution{UpdatedAt: now.UTC()}
+	for _, r := range g.open() {
+		c.Entries = append(c.Entries, DirectoryEntry{Name: r.Name, Tags: slices.Clone(r.Tags), Address: r.Address})
+	}
+	return c
+}
+
+// refreshDirectory replaces the contributions of the guilds this process
+// owns, dropping those of guilds that opted out or are gone.
+func (db *database) refreshDirectory(now time.Time) {
+	for id := range db.Directory {
+		if g, ok := db.Guilds[id]; ownsGuild(id) && (!ok || !g.Config.Directory) {
+			delete(db.Directory, id)
+		}
+	}
+	for id, g := range db.Guilds {
+		if !ownsGuild(id) || !g.Config.Directory {
+			continue
+		}
+		if db.Directory == nil {
+			db.Directory = map[string]*DirectoryContribution{}
+		}
+		db.Directory[id] = g.contribution(now)
+	}
+}
+
+// syncDirectory contributes a guild's list to the directory or withdraws
+// it, following its setting.
+func syncDirectory(guildID string, now time.Time) error {
+	err := updateDB(func(db *database) error {
+		g, ok := db.Guilds[guildID]
+		if !ok || !g.Config.Directory {
+			if _, ok := db.Directory[guildID]; !ok {
+				return errNoChange
+			}
+			delete(db.Directory, guildID)
+			return nil
+		}
+		if db.Directory == nil {
+			db.Directory = map[string]*DirectoryContribution{}
+		}
+		db.Directory[guildID] = g.contribution(now)
+		return nil
+	})
+	if errors.Is(err, errNoChange) {
+		return nil
+	}
+	return err
+}
+
+// runDirectoryRefresh refreshes the contributions once a day, so that the
+// directory follows the lists and settings of the guilds.
+func runDirectoryRefresh(s *discordgo.Session, now time.Time) {
+	today := now.UTC().Format("2006-01-02")
+	if lastDirectoryRefresh == today {
+		return
+	}
+	lastDirectoryRefresh = today
+	if err := updateDB(func(db *database) error {
+		db.refreshDirectory(now)
+		return nil
+	}); err != nil {
+		log.Printf("Failed to refresh the restaurant directory: %v", err)
+	}
+}
+
+// directoryHit is a restaurant found in the directory, merged across the
+// guilds that list it.
+type directoryHit struct {
+	Entry DirectoryEntry
+	// Origins are the IDs of the guilds listing it.
+	Origins []string
+}
+
+// searchDirectory finds the entries of other guilds' contributions matching
+// every word of the query in their name, tags or address. Entries with the
+// same name and address are merged, those on the most lists first.
+func searchDirectory(directory map[string]*DirectoryContribution, guildID, query string) []directoryHit {
+	words := strings.Fields(normalizeName(strings.ReplaceAll(query, "#", " ")))
+	if len(words) == 0 {
+		return nil
+	}
+	matches := func(e DirectoryEntry) bool {
+		text := normalizeName(e.Name) + " " + normalizeName(e.Address)
+		for _, w := range words {
+			if !strings.Contains(text, w) && !slices.Contains(e.Tags, w) {
+				return false
+			}
+		}
+		return true
+	}
+
+	ids := make([]string, 0, len(directory))
+	for id := range directory {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	index := map[string]int{}
+	var hits []directoryHit
+	for _, id := range ids {
+		if id == guildID {
+			continue
+		}
+		for _, e := range directory[id].Entries {
+			if !matches(e) {
+				continue
+			}
+			key := normalizeName(e.Name) + "|" + normalizeName(e.Address)
+			n, ok := index[key]
+			if !ok {
+				n = len(hits)
+				index[key] = n
+				hits = append(hits, directoryHit{Entry: DirectoryEntry{Name: e.Name, Tags: slices.Clone(e.Tags), Address: e.Address}})
+			}
+			h := &hits[n]
+			if !slices.Contains(h.Origins, id) {
+				h.Origins = append(h.Origins, id)
+			}
+			for _, t := range e.Tags {
+				if !slices.Contains(h.Entry.Tags, t) {
+					h.Entry.Tags = append(h.Entry.Tags, t)
+				}
+			}
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if len(hits[i].Origins) != len(hits[j].Origins) {
+			return len(hits[i].Origins) > len(hits[j].Origins)
+		}
+		return lessFold(hits[i].Entry.Name, hits[j].Entry.Name)
+	})
+	for i := range hits {
+		sort.Strings(hits[i].Entry.Tags)
+	}
+	return hits
+}
+
+// directorySnapshot returns the contributions as last loaded or written.
+// The snapshot must not be modified.
+func directorySnapshot() map[string]*DirectoryContribution {
+	store.Lock()
+	defer store.Unlock()
+	return store.root.Directory
+}
+
+// pendingDiscover is a !discover result whose entries can still be imported.
+type pendingDiscover struct {
+	guildID string
+	hits    []directoryHit
+	expires time.Time
+}
+
+var (
+	// pendingDiscovers stores the import buttons of !discover, keyed by token.
+	pendingDiscovers      = make(map[string]*pendingDiscover)
+	pendingDiscoversMutex sync.Mutex
+)
+
+// handleDiscover implements `!discover <query>`, searching the restaurants
+// other guilds share in the directory.
+func handleDiscover(c *Context) {
+	query := strings.TrimSpace(c.Args)
+	if query == "" {
+		c.Reply("discover.usage", nil)
+		return
+	}
+	if separateShardProcesses() {
+		// Other processes' guilds contribute too.
+		if err := syncSharedDB(); err != nil {
+			log.Printf("Failed to sync the database: %v", err)
+		}
+	}
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("discover.failed", nil)
+		return
+	}
+	hits := searchDirectory(directorySnapshot(), c.GuildID, query)
+	if len(hits) == 0 {
+		c.Reply("discover.none", Args{"query": query})
+		return
+	}
+	hits = hits[:min(len(hits), maxDiscoverResults)]
+
+	token := newToken()
+	lines := []string{c.T("discover.header", Args{"query": query})}
+	var buttons []discordgo.Button
+	for n, h := range hits {
+		line := fmt.Sprintf("%d. **%s**", n+1, h.Entry.Name)
+		if len(h.Entry.Tags) > 0 {
+			line += " " + formatTags(h.Entry.Tags)
+		}
+		if h.Entry.Address != "" {
+			line += " · " + h.Entry.Address
+		}
+		line += " · " + c.T("discover.lists", Args{"count": len(h.Origins)})
+		if slices.ContainsFunc(restaurants, func(r Restaurant) bool { return normalizeName(r.Name) == normalizeName(h.Entry.Name) }) {
+			line += " · " + c.T("discover.on_list", nil)
+		} else {
+			buttons = append(buttons, discordgo.Button{
+				Label: c.T("button.discover_add", Args{"n": n + 1}), Style: discordgo.SecondaryButton,
+				CustomID: "discover:" + token + ":" + strconv.Itoa(n),
+			})
+		}
+		lines = append(lines, line)
+	}
+	msg := &discordgo.MessageSend{Content: strings.Join(lines, "\n"), AllowedMentions: &discordgo.MessageAllowedMentions{}}
+	if len(buttons) > 0 {
+		msg.Components = []discordgo.MessageComponent{buttonRow(buttons...)}
+		pendingDiscoversMutex.Lock()
+		pendingDiscovers[token] = &pendingDiscover{guildID: c.GuildID, hits: hits, expires: time.Now().Add(discoverTimeout)}
+		pendingDiscoversMutex.Unlock()
+		time.AfterFunc(discoverTimeout, func() {
+			pendingDiscoversMutex.Lock()
+			delete(pendingDiscovers, token)
+			pendingDiscoversMutex.Unlock()
+		})
+	}
+	c.SendComplex(msg)
+}
+
+// handleDiscoverComponent imports the directory entry of a !discover button
+// into the guild's list.
+func handleDiscoverComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	n, err := strconv.Atoi(i.Args[1])
+	pendingDiscoversMutex.Lock()
+	p, ok := pendingDiscovers[i.Args[0]]
+	if ok && time.Now().After(p.expires) {
+		delete(pendingDiscovers, i.Args[0])
+		ok = false
+	}
+	pendingDiscoversMutex.Unlock()
+	if !ok || p.guildID != i.GuildID {
+		i.Ephemeral("discover.expired", nil)
+		return
+	}
+	if err != nil || n < 0 || n >= len(p.hits) {
+		return
+	}
+	h := p.hits[n]
+
+	result, err := ImportDiscovered(i.GuildID, h, contributorFor(i.Event.Member.User))
+	switch {
+	case errors.Is(err, ErrReadOnly):
+		i.Ephemeral("readonly.active", Args{"reason": i.T(activeReadOnlyReason(), nil)})
+	case err != nil:
+		log.Printf("Failed to import a directory entry: %v", err)
+		i.Ephemeral("discover.import_failed", Args{"name": h.Entry.Name})
+	case result.Duplicates > 0:
+		i.Ephemeral("discover.already", Args{"name": h.Entry.Name})
+	case result.Skipped > 0:
+		i.Ephemeral("import.skipped", Args{"count": 1, "max": i.Config.maxRestaurants()})
+	case result.Invalid > 0:
+		i.Ephemeral("import.invalid", Args{"count": 1, "max": i.Config.maxNameLength()})
+	default:
+		i.Ephemeral("discover.imported", Args{"name": h.Entry.Name})
+	}
+}
+
+// ImportDiscovered adds a directory entry to a guild's list like an import.
+// The guild it came from is only recorded in the audit log.
+func ImportDiscovered(guildID string, h directoryHit, by Contributor) (importResult, error) {
+	var result importResult
+	err := updateGuild(guildID, func(g *GuildData) error {
+		e := h.Entry
+		result = g.importEntries([]Restaurant{{Name: e.Name, Tags: slices.Clone(e.Tags), Address: e.Address}}, by)
+		if result.Added == 0 {
+			return errNoChange
+		}
+		last := &g.Audit[len(g.Audit)-1]
+		last.Source, last.Origin = sourceDirectory, h.Origins[0]
+		return nil
+	})
+	if errors.Is(err, errNoChange) {
+		err = nil
+	}
+	return result, err
+}
+
+// handleDirectorySetting implements `!settings directory on|off`. Opting in
+// shares the names, tags and addresses of the open restaurants with every
+// guild using `!discover`; opting out withdraws them at once.
+func handleDirectorySetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply(directorySettingKey(c.Config), nil)
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	var on bool
+	switch value := strings.ToLower(fields[0]); {
+	case len(fields) != 1:
+		c.Reply("settings.directory_invalid", nil)
+		return
+	case value == "on":
+		on = true
+	case value != "off":
+		c.Reply("settings.directory_invalid", nil)
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.Directory = on
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save directory setting: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.Directory = on
+	if err := syncDirectory(c.GuildID, time.Now()); err != nil {
+		log.Printf("Failed to update the restaurant directory: %v", err)
+	}
+	c.Reply(directorySettingKey(c.Config), nil)
+}
+
+// directorySettingKey returns the message describing the directory setting.
+func directorySettingKey(cfg GuildConfig) string {
+	if cfg.Directory {
+		return "settings.directory_on"
+	}
+	return "settings.directory_off"
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// editCommandName is the name of the slash command opening the edit form.
+	editCommandName = "edit"
+	// maxModalTitle is the longest title Discord accepts for a modal.
+	maxModalTitle = 45
+	// maxTagsInput bounds the tags field of the edit form.
+	maxTagsInput = 400
+)
+
+// ErrEditConflict is returned when a restaurant changed since its edit form was opened.
+var ErrEditConflict = errors.New("the restaurant changed since the form was opened")
+
+// NameTakenError is returned when renaming a restaurant to the name or a
+// nickname of another one.
+type NameTakenError struct {
+	Name string
+	// Owner is the name of the restaurant the name refers to.
+	Owner string
+}
+
+func (e *NameTakenError) Error() string {
+	return fmt.Sprintf("%q already refers to %q", e.Name, e.Owner)
+}
+
+// editFields are the attributes the edit form offers after the name and tags.
+var editFields = []string{"price", "address", "link"}
+
+// editCommand builds the /edit command, with its names and descriptions
+// translated from the message catalogs.
+func editCommand() *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:                     editCommandName,
+		NameLocalizations:        ptrTo(commandLocalizations("slash.edit_name", nil, true)),
+		Description:              translator.T(defaultLanguage, "slash.edit_description", nil),
+		DescriptionLocalizations: ptrTo(commandLocalizations("slash.edit_description", nil, false)),
+		Options: []*discordgo.ApplicationCommandOption{{
+			Type:                     discordgo.ApplicationCommandOptionString,
+			Name:                     translator.T(defaultLanguage, "slash.edit_option_name_name", nil),
+			NameLocalizations:        commandLocalizations("slash.edit_option_name_name", nil, true),
+			Description:              translator.T(defaultLanguage, "slash.edit_option_name", nil),
+			DescriptionLocalizations: commandLocalizations("slash.edit_option_name", nil, false),
+			Required:                 true,
+		}},
+	}
+}
+
+// editDetails are the details of a restaurant the edit form changes.
+type editDetails struct {
+	Name   string
+	Tags   []string
+	Change attributeChange
+}
+
+// handleEditCommand opens the edit form for `/edit name:...`.
+func handleEditCommand(i *Interaction) {
+	var ref string
+	for _, o := range i.Event.ApplicationCommandData().Options {
+		if o.Name == "name" {
+			ref = strings.TrimSpace(o.StringValue())
+		}
+	}
+	openEditForm(i, ref)
+}
+
+// handleEdit implements `!edit "Name"`, which posts a button opening the
+// edit form, as forms can only be opened in answer to an interaction.
+func handleEdit(c *Context) {
+	name, _, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("edit.usage", nil)
+		return
+	}
+	var r Restaurant
+	err := viewGuild(c.GuildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r = g.Restaurants[i]
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to look up restaurant: %v", err)
+		c.replyError("edit.failed", err, name)
+		return
+	}
+	c.SendComplex(&discordgo.MessageSend{
+		Content: c.T("edit.prompt", Args{"name": r.Name}),
+		Components: []discordgo.MessageComponent{buttonRow(discordgo.Button{
+			Label: c.T("button.edit", nil), Style: discordgo.PrimaryButton, CustomID: "edit:open:" + r.ID,
+		})},
+	})
+}
+
+// handleEditComponent handles /edit, the button of `!edit`, custom ID
+// edit:open:<id>, and the submitted form, custom ID edit:save:<id>:<revision>.
+func handleEditComponent(i *Interaction) {
+	if len(i.Args) == 1 && i.Args[0] == "command" {
+		handleEditCommand(i)
+		return
+	}
+	if len(i.Args) < 2 {
+		return
+	}
+	switch i.Args[0] {
+	case "open":
+		openEditForm(i, idPrefix+i.Args[1])
+	case "save":
+		if len(i.Args) != 3 {
+			return
+		}
+		revision, err := strconv.Atoi(i.Args[2])
+		if err != nil {
+			return
+		}
+		saveEditForm(i, i.Args[1], revision)
+	}
+}
+
+// openEditForm answers the interaction with the edit form of a restaurant,
+// filled in with its current details.
+func openEditForm(i *Interaction, ref string) {
+	if ref == "" {
+		i.Ephemeral("edit.usage", nil)
+		return
+	}
+	var r Restaurant
+	err := viewGuild(i.GuildID, func(g *GuildData) error {
+		n, err := g.lookup(ref)
+		if err != nil {
+			return err
+		}
+		r = g.Restaurants[n]
+		return nil
+	})
+	var notFound *NotFoundError
+	switch {
+	case errors.As(err, &notFound):
+		i.Ephemeral("restaurant.not_found", Args{"name": echoName(strings.TrimPrefix(ref, idPrefix))})
+		return
+	case err != nil:
+		log.Printf("Failed to look up restaurant: %v", err)
+		i.Ephemeral("edit.failed", Args{"name": echoName(ref)})
+		return
+	}
+
+	input := func(id, label, value string, maxLen int, required bool) discordgo.MessageComponent {
+		return discordgo.ActionsRow{Components: []discordgo.MessageComponent{discordgo.TextInput{
+			CustomID: id, Label: truncateRunes(label, maxModalTitle), Style: discordgo.TextInputShort,
+			Value: value, Required: required, MaxLength: maxLen,
+		}}}
+	}
+	components := []discordgo.MessageComponent{
+		input("name", i.T("edit.field_name", nil), r.Name, i.Config.maxNameLength(), true),
+		input("tags", i.T("edit.field_tags", nil), formatTags(r.Tags), maxTagsInput, false),
+	}
+	for _, key := range editFields {
+		a := attributeByKey(key)
+		components = append(components, input(key, a.name(i.Config), a.formatValue(a.get(&r)), a.MaxLen, false))
+	}
+	err = i.Session.InteractionRespond(i.Event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseModal,
+		Data: &discordgo.InteractionResponseData{
+			CustomID:   fmt.Sprintf("edit:save:%s:%d", r.ID, r.Revision),
+			Title:      truncateRunes(i.T("edit.title", Args{"name": r.Name}), maxModalTitle),
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to open the edit form: %v", err)
+	}
+}
+
+// saveEditForm validates and applies a submitted edit form, answering with
+// what changed.
+func saveEditForm(i *Interaction, id string, revision int) {
+	values := map[string]string{}
+	for _, row := range i.Event.ModalSubmitData().Components {
+		if row, ok := row.(*discordgo.ActionsRow); ok {
+			for _, c := range row.Components {
+				if input, ok := c.(*discordgo.TextInput); ok {
+					values[input.CustomID] = strings.TrimSpace(input.Value)
+				}
+			}
+		}
+	}
+
+	details, problem, args := parseEditForm(i.Config, values)
+	if problem != "" {
+		i.Ephemeral(problem, args)
+		return
+	}
+	diff, err := EditRestaurant(i.GuildID, id, revision, details, contributorFor(i.Event.Member.User))
+	var taken *NameTakenError
+	switch {
+	case errors.Is(err, ErrEditConflict):
+		i.Ephemeral("edit.conflict", nil)
+	case errors.As(err, &taken):
+		i.Ephemeral("edit.name_taken", Args{"name": taken.Name, "owner": taken.Owner})
+	case errors.Is(err, ErrNameTooLong):
+		i.Ephemeral("name.too_long", Args{"count": i.Config.maxNameLength()})
+	case errors.Is(err, ErrNameLineBreak):
+		i.Ephemeral("name.line_break", nil)
+	case errors.Is(err, ErrNameCodeBlock):
+		i.Ephemeral("name.code_block", nil)
+	case errors.Is(err, ErrRestaurantNotFound):
+		i.Ephemeral("edit.gone", nil)
+	case errors.Is(err, ErrReadOnly):
+		i.Ephemeral("readonly.active", Args{"reason": i.T(activeReadOnlyReason(), nil)})
+	case errors.Is(err, errNoChange):
+		i.Ephemeral("edit.unchanged", Args{"name": diff.After.Name})
+	case err != nil:
+		log.Printf("Failed to edit restaurant: %v", err)
+		i.Ephemeral("edit.failed", Args{"name": details.Name})
+	default:
+		var lines []string
+		for _, change := range diffChanges(diff) {
+			lines = append(lines, "- "+change)
+		}
+		i.Ephemeral("edit.done", Args{"name": diff.After.Name, "changes": strings.Join(lines, "\n")})
+		if diff.Before.Link != diff.After.Link && diff.After.Link != "" {
+			schedulePreview(i.GuildID, diff.After, time.Now())
+		}
+	}
+}
+
+// parseEditForm parses the fields of a submitted edit form. On error it
+// returns the catalog key and arguments of the problem. Empty attribute
+// fields clear the attribute.
+func parseEditForm(cfg GuildConfig, values map[string]string) (editDetails, string, Args) {
+	details := editDetails{Name: values["name"], Change: attributeChange{}}
+	if details.Name == "" {
+		return details, "edit.name_missing", nil
+	}
+	var tokens []string
+	for _, token := range strings.FieldsFunc(values["tags"], func(r rune) bool { return r == ' ' || r == ',' }) {
+		if !strings.HasPrefix(token, "#") {
+			token = "#" + token
+		}
+		tokens = append(tokens, token)
+	}
+	tags, invalid := parseTags(tokens)
+	if invalid != "" {
+		return details, "tag.invalid", Args{"tag": invalid}
+	}
+	details.Tags = tags
+	for _, key := range editFields {
+		a := attributeByKey(key)
+		value := values[key]
+		if value == "" {
+			details.Change[key] = a.zero()
+			continue
+		}
+		parsed, ok := a.parseValue(value)
+		if !ok {
+			return details, "edit.invalid", Args{"value": value, "name": a.name(cfg), "hint": a.hint(cfg)}
+		}
+		details.Change[key] = parsed
+	}
+	return details, "", nil
+}
+
+// EditRestaurant applies the details of an edit form to the restaurant with
+// the given ID, unless it was changed since the form was opened at revision.
+// It returns the entry before and after the edit, with errNoChange when the
+// form changed nothing.
+func EditRestaurant(guildID, id string, revision int, d editDetails, by Contributor) (bulkDiff, error) {
+	var diff bulkDiff
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i := g.findID(id)
+		if i < 0 {
+			return ErrRestaurantNotFound
+		}
+		r := &g.Restaurants[i]
+		if r.Revision != revision {
+			return ErrEditConflict
+		}
+		if d.Name != r.Name {
+			if err := validateName(d.Name, g.Config.maxNameLength()); err != nil {
+				return err
+			}
+			if j := g.find(d.Name); j >= 0 && j != i {
+				return &NameTakenError{Name: d.Name, Owner: g.Restaurants[j].Name}
+			}
+		}
+
+		before := *r
+		before.Tags, before.Diet, before.Aliases = slices.Clone(r.Tags), slices.Clone(r.Diet), slices.Clone(r.Aliases)
+		details := r.details()
+		r.Name = d.Name
+		// A nickname the restaurant is renamed to is its name now.
+		r.Aliases = slices.DeleteFunc(r.Aliases, func(a string) bool { return strings.EqualFold(a, d.Name) })
+		r.Tags = slices.Clone(d.Tags)
+		sort.Strings(r.Tags)
+		r.Tags = slices.Compact(r.Tags)
+		d.Change.apply(r)
+		diff = bulkDiff{Before: before, After: *r}
+		if r.revise(details, &by) == nil {
+			return errNoChange
+		}
+		diff.After = *r
+		name := r.Name
+		if before.Name != r.Name {
+			name = before.Name + " → " + r.Name
+		}
+		g.audit(auditEdit, name, &by, sourceDiscord)
+		return nil
+	})
+	return diff, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// closeTo reports whether two scores agree to well within a rounding error.
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEloExpected(t *testing.T) {
+	tests := []struct {
+		a, b, want float64
+	}{
+		{1500, 1500, 0.5},
+		{1900, 1500, 10.0 / 11},
+		{1500, 1900, 1.0 / 11},
+		{2300, 1500, 100.0 / 101},
+	}
+	for _, tt := range tests {
+		if got := eloExpected(tt.a, tt.b); !closeTo(got, tt.want) {
+			t.Errorf("eloExpected(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := eloExpected(tt.a, tt.b) + eloExpected(tt.b, tt.a); !closeTo(got, 1) {
+			t.Errorf("eloExpected(%v, %v) and its reverse add up to %v, want 1", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestEloUpdate(t *testing.T) {
+	tests := []struct {
+		name                 string
+		a, b, score          float64
+		wantDeltaA, maxDelta float64
+	}{
+		{"equal ratings, a wins", 1500, 1500, 1, eloK / 2, eloK},
+		{"equal ratings, a loses", 1500, 1500, 0, -eloK / 2, eloK},
+		{"equal ratings, draw", 1500, 1500, 0.5, 0, eloK},
+		{"favourite wins", 1900, 1500, 1, eloK / 11.0, 3},
+		{"favourite loses", 1900, 1500, 0, -eloK * 10 / 11.0, eloK},
+		{"underdog loses", 1500, 2300, 0, -eloK / 101.0, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newA, newB := eloUpdate(tt.a, tt.b, tt.score)
+			deltaA, deltaB := newA-tt.a, newB-tt.b
+			if !closeTo(deltaA, tt.wantDeltaA) {
+				t.Errorf("a moved by %v, want %v", deltaA, tt.wantDeltaA)
+			}
+			if !closeTo(deltaA+deltaB, 0) {
+				t.Errorf("update isn't zero-sum: a moved by %v, b by %v", deltaA, deltaB)
+			}
+			if math.Abs(deltaA) > tt.maxDelta {
+				t.Errorf("a moved by %v, want at most %v", deltaA, tt.maxDelta)
+			}
+		})
+	}
+}
+
+func TestEloBaseline(t *testing.T) {
+	fresh := Restaurant{Name: "Alpha"}
+	if got := fresh.elo(); got != eloBaseline {
+		t.Errorf("new restaurant scores %v, want %v", got, eloBaseline)
+	}
+	fought := Restaurant{Name: "Bravo", Elo: 1516, Battles: 1}
+	if got := fought.elo(); got != 1516 {
+		t.Errorf("restaurant after a battle scores %v, want 1516", got)
+	}
+
+	// Two new restaurants meet as equals, so the winner gains K/2.
+	winner, loser := eloUpdate(fresh.elo(), fresh.elo(), 1)
+	if !closeTo(winner, eloBaseline+eloK/2) || !closeTo(loser, eloBaseline-eloK/2) {
+		t.Errorf("first battle scores %v and %v, want %v and %v", winner, loser, eloBaseline+eloK/2, eloBaseline-eloK/2)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	zeroWidthJoiner   = '\u200d'
+	variationSelector = '\ufe0f'
+	keycapCombiner    = '\u20e3'
+)
+
+// customEmojiPattern matches a custom emoji reference such as <:name:id> or <a:name:id>.
+var customEmojiPattern = regexp.MustCompile(`^<(a?):(\w{2,32}):(\d{17,20})>$`)
+
+// isEmojiBase reports whether r can start a standard emoji.
+func isEmojiBase(r rune) bool {
+	switch {
+	case r >= 0x1f000 && r <= 0x1faff, // pictographs, emoticons, transport, symbols
+		r >= 0x2600 && r <= 0x27bf, // miscellaneous symbols and dingbats
+		r >= 0x2300 && r <= 0x23ff, // technical, e.g. ⌚ and ⏰
+		r >= 0x2b00 && r <= 0x2bff, // arrows and stars, e.g. ⭐
+		r >= 0x2190 && r <= 0x21ff, // arrows
+		r >= 0x25aa && r <= 0x25fe, // geometric shapes
+		r == 0x00a9, r == 0x00ae, r == 0x203c, r == 0x2049, r == 0x2122, r == 0x2139,
+		r == 0x24c2, r == 0x2934, r == 0x2935, r == 0x3030, r == 0x303d, r == 0x3297, r == 0x3299:
+		return true
+	}
+	return false
+}
+
+// isSingleEmoji reports whether s is exactly one standard emoji, including
+// ZWJ sequences, skin tones, keycaps and flags.
+func isSingleEmoji(s string) bool {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return false
+	}
+	regional := func(r rune) bool { return r >= 0x1f1e6 && r <= 0x1f1ff }
+	if regional(runes[0]) {
+		return len(runes) == 2 && regional(runes[1])
+	}
+	if strings.ContainsRune("0123456789#*", runes[0]) {
+		return strings.TrimLeft(string(runes[1:]), string(variationSelector)) == string(keycapCombiner)
+	}
+
+	// A sequence of base emoji, each optionally followed by modifiers, joined by ZWJ.
+	expectBase := true
+	for _, r := range runes {
+		switch {
+		case expectBase:
+			if !isEmojiBase(r) {
+				return false
+			}
+			expectBase = false
+		case r == zeroWidthJoiner:
+			expectBase = true
+		case r == variationSelector,
+			r >= 0x1f3fb && r <= 0x1f3ff, // skin tones
+			r >= 0xe0020 && r <= 0xe007f: // tag sequences of subdivision flags
+		default:
+			return false
+		}
+	}
+	return !expectBase
+}
+
+// restaurantEmoji returns the emoji to react with for a stored emoji reference.
+func restaurantEmoji(stored string) *discordgo.Emoji {
+	if m := customEmojiPattern.FindStringSubmatch(stored); m != nil {
+		return &discordgo.Emoji{Name: m[2], ID: m[3], Animated: m[1] == "a"}
+	}
+	return &discordgo.Emoji{Name: stored}
+}
+
+// sameEmoji reports whether two emoji are the same, ignoring variation selectors.
+func sameEmoji(a, b *discordgo.Emoji) bool {
+	if a.ID != "" || b.ID != "" {
+		return a.ID == b.ID
+	}
+	strip := func(s string) string { return strings.ReplaceAll(s, string(variationSelector), "") }
+	return strip(a.Name) == strip(b.Name)
+}
+
+// validateEmoji checks that an emoji can be used by the bot in a guild,
+// returning the catalog key explaining why not.
+func validateEmoji(s *discordgo.Session, guildID, text string) string {
+	m := customEmojiPattern.FindStringSubmatch(text)
+	if m == nil {
+		if !isSingleEmoji(text) {
+			return "emoji.invalid"
+		}
+		return ""
+	}
+	emoji, err := s.GuildEmoji(guildID, m[3])
+	if err != nil {
+		log.Printf("Custom emoji %s is not available in guild %s: %v", m[3], guildID, err)
+		return "emoji.foreign"
+	}
+	if !emoji.Available {
+		return "emoji.unavailable"
+	}
+	return ""
+}
+
+// SetEmoji stores a restaurant's emoji, or clears it when emoji is empty.
+// It returns the restaurant's canonical name.
+func SetEmoji(guildID, name, emoji string) (string, error) {
+	var canonical string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		g.Restaurants[i].Emoji = emoji
+		canonical = g.Restaurants[i].Name
+		return nil
+	})
+	return canonical, err
+}
+
+// handleEmoji implements `!emoji "Name" 🍣` and `!emoji "Name" none`.
+func handleEmoji(c *Context) {
+	name, emoji, ok := parseRef(c.Args)
+	if !ok || name == "" || emoji == "" {
+		c.Reply("emoji.usage", nil)
+		return
+	}
+	if strings.EqualFold(emoji, "none") {
+		emoji = ""
+	} else if key := validateEmoji(c.Session, c.GuildID, emoji); key != "" {
+		c.Reply(key, Args{"emoji": emoji})
+		return
+	}
+
+	canonical, err := SetEmoji(c.GuildID, name, emoji)
+	if err != nil {
+		log.Printf("Failed to set emoji: %v", err)
+		c.replyError("emoji.failed", err, name)
+		return
+	}
+	if emoji == "" {
+		c.Ack("emoji.cleared", Args{"name": canonical})
+		return
+	}
+	c.Ack("emoji.done", Args{"name": canonical, "emoji": emoji})
+}
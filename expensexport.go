@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// expensesCSV renders the expenses as CSV with a totals row. payer names the
+// member who paid; loc is the timezone dates are written in.
+func expensesCSV(expenses []Expense, payer func(id string) string, loc *time.Location) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"date", "restaurant", "amount", "payer", "note"})
+	total := 0
+	for _, e := range expenses {
+		total += e.Cents
+		w.Write([]string{e.At.In(loc).Format("2006-01-02"), csvText(e.Restaurant), formatAmount(e.Cents, ""), csvText(payer(e.PayerID)), csvText(e.Note)})
+	}
+	w.Write([]string{"total", "", formatAmount(total, ""), "", ""})
+	w.Flush()
+	return buf.Bytes()
+}
+
+// csvText keeps spreadsheets from evaluating free text as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// parseRoleMention extracts the ID from a <@&id> role mention.
+func parseRoleMention(s string) (string, bool) {
+	if !strings.HasPrefix(s, "<@&") || !strings.HasSuffix(s, ">") {
+		return "", false
+	}
+	id := s[3 : len(s)-1]
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// exportExpenses implements `!export expenses [YYYY-MM]`, restricted to the finance role.
+func exportExpenses(c *Context, options []string) {
+	role := c.Config.FinanceRoleID
+	if role == "" {
+		c.Reply("export.expenses_no_role", nil)
+		return
+	}
+	if c.Message.Member == nil || !slices.Contains(c.Message.Member.Roles, role) {
+		c.SendQuiet(c.T("export.expenses_forbidden", Args{"role": "<@&" + role + ">"}))
+		return
+	}
+	loc := c.Config.location()
+	start, end := monthRange(time.Now().In(loc))
+	if len(options) > 1 {
+		c.Reply("export.usage", nil)
+		return
+	}
+	if len(options) == 1 {
+		month, err := time.ParseInLocation("2006-01", options[0], loc)
+		if err != nil {
+			c.Reply("export.usage", nil)
+			return
+		}
+		start, end = monthRange(month)
+	}
+
+	var expenses []Expense
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		for _, e := range g.Expenses {
+			if !e.At.Before(start) && e.At.Before(end) {
+				expenses = append(expenses, e)
+			}
+		}
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load expenses: %v", err)
+		c.Reply("spend.failed", nil)
+		return
+	}
+	month := start.Format("2006-01")
+	if len(expenses) == 0 {
+		c.Reply("export.expenses_none", Args{"month": month})
+		return
+	}
+	sort.SliceStable(expenses, func(i, j int) bool { return expenses[i].At.Before(expenses[j].At) })
+
+	names := map[string]string{}
+	payer := func(id string) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		name := id
+		if m, err := c.Session.GuildMember(c.GuildID, id); err == nil {
+			name = cmp.Or(m.Nick, m.User.Username)
+		}
+		names[id] = name
+		return name
+	}
+	c.SendFile(c.T("export.expenses_attached", Args{"count": len(expenses), "month": month}), &discordgo.File{
+		Name:        fmt.Sprintf("expenses-%s.csv", month),
+		ContentType: "text/csv",
+		Reader:      bytes.NewReader(expensesCSV(expenses, payer, loc)),
+	})
+}
+
+// handleFinanceRoleSetting implements `!settings finance-role [@role|off]`.
+func handleFinanceRoleSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.SendQuiet(financeRoleSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	role := ""
+	if !strings.EqualFold(fields[0], "off") {
+		var ok bool
+		if role, ok = parseRoleMention(fields[0]); !ok || len(fields) != 1 {
+			c.Reply("settings.finance_role_usage", nil)
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.FinanceRoleID = role
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save finance role: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.FinanceRoleID = role
+	c.SendQuiet(financeRoleSettingLine(c.Config))
+}
+
+// financeRoleSettingLine describes who may export expenses.
+func financeRoleSettingLine(cfg GuildConfig) string {
+	if cfg.FinanceRoleID == "" {
+		return cfg.T("settings.finance_role_off", nil)
+	}
+	return cfg.T("settings.finance_role", Args{"role": "<@&" + cfg.FinanceRoleID + ">"})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxInlineExport is the longest export pasted into the channel instead of attached.
+const maxInlineExport = 1900
+
+// exportColumn is a column of the Markdown export.
+type exportColumn struct {
+	Name string
+	// Header is the catalog key of the column header.
+	Header string
+	value  func(r Restaurant) string
+}
+
+// exportColumns are the columns of the Markdown export in display order.
+var exportColumns = []exportColumn{
+	{"name", "export.col_name", func(r Restaurant) string { return r.Name }},
+	{"tags", "export.col_tags", func(r Restaurant) string { return formatTags(r.Tags) }},
+	{"price", "export.col_price", func(r Restaurant) string { return formatPrice(r.Price) }},
+	{"rating", "export.col_rating", func(r Restaurant) string {
+		if avg, ok := r.AverageRating(); ok {
+			return fmt.Sprintf("%.1f", avg)
+		}
+		return ""
+	}},
+	{"last-visit", "export.col_last_visit", func(r Restaurant) string {
+		if last := r.LastVisit(); !last.IsZero() {
+			return last.Format("2006-01-02")
+		}
+		return ""
+	}},
+	{"link", "export.col_link", func(r Restaurant) string { return r.Link }},
+}
+
+// markdownEscaper escapes the characters that would break a table cell or format its content.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "\n", " ",
+)
+
+// exportColumnNames returns the names accepted by cols:.
+func exportColumnNames() []string {
+	names := make([]string, len(exportColumns))
+	for i, col := range exportColumns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// parseExportColumns parses "cols:name,rating", returning the unknown column if any.
+func parseExportColumns(value string) ([]exportColumn, string) {
+	var cols []exportColumn
+	for _, name := range strings.Split(strings.ToLower(value), ",") {
+		i := slices.IndexFunc(exportColumns, func(col exportColumn) bool { return col.Name == name })
+		if i < 0 {
+			return nil, name
+		}
+		cols = append(cols, exportColumns[i])
+	}
+	return cols, ""
+}
+
+// markdownTable renders restaurants as a Markdown table. Without explicit
+// columns, columns that are empty for every restaurant are left out.
+func markdownTable(cfg GuildConfig, restaurants []Restaurant, cols []exportColumn) string {
+	if cols == nil {
+		for _, col := range exportColumns {
+			if slices.ContainsFunc(restaurants, func(r Restaurant) bool { return col.value(r) != "" }) {
+				cols = append(cols, col)
+			}
+		}
+	}
+
+	var b strings.Builder
+	row := func(cells []string) {
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	header := make([]string, len(cols))
+	separator := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = cfg.T(col.Header, nil)
+		separator[i] = "---"
+	}
+	row(header)
+	row(separator)
+	for _, r := range restaurants {
+		cells := make([]string, len(cols))
+		for i, col := range cols {
+			cells[i] = markdownEscaper.Replace(col.value(r))
+		}
+		row(cells)
+	}
+	return b.String()
+}
+
+// historySection renders the revision histories of restaurants as Markdown,
+// with contributors by name, "" when none has a history.
+func historySection(cfg GuildConfig, restaurants []Restaurant) string {
+	cfg.AttributionStyle = attributionName
+	var b strings.Builder
+	for _, r := range restaurants {
+		if len(r.History) == 0 {
+			continue
+		}
+		b.WriteString("\n### " + markdownEscaper.Replace(r.Name) + "\n\n")
+		for n := len(r.History) - 1; n >= 0; n-- {
+			b.WriteString("- " + revisionLine(cfg, r.History[n]) + "\n")
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n## " + cfg.T("export.history", nil) + "\n" + b.String()
+}
+
+// handleExport implements `!export md [cols:a,b] [history]`, `!export ical` and `!export expenses [YYYY-MM]`.
+func handleExport(c *Context) {
+	fields := strings.Fields(c.Args)
+	if len(fields) == 0 {
+		c.Reply("export.usage", nil)
+		return
+	}
+	switch strings.ToLower(fields[0]) {
+	case "md", "markdown":
+		exportMarkdown(c, fields[1:])
+	case "ical", "ics":
+		exportICal(c)
+	case "expenses":
+		exportExpenses(c, fields[1:])
+	default:
+		c.Reply("export.usage", nil)
+	}
+}
+
+// exportMarkdown pastes the table inline when it fits in a message and
+// attaches it otherwise. The revision histories are only included when the
+// history option asks for them.
+func exportMarkdown(c *Context, options []string) {
+	var cols []exportColumn
+	withHistory := false
+	for _, option := range options {
+		if strings.EqualFold(option, "history") {
+			withHistory = true
+			continue
+		}
+		value, ok := strings.CutPrefix(strings.ToLower(option), "cols:")
+		if !ok {
+			c.Reply("export.usage", nil)
+			return
+		}
+		var unknown string
+		if cols, unknown = parseExportColumns(value); unknown != "" {
+			c.Reply("export.unknown_column", Args{"column": unknown, "columns": strings.Join(exportColumnNames(), ", ")})
+			return
+		}
+	}
+
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	restaurants = slices.DeleteFunc(restaurants, func(r Restaurant) bool { return r.IsArchived() })
+	if len(restaurants) == 0 {
+		c.Reply("list.empty", nil)
+		return
+	}
+	sort.SliceStable(restaurants, func(i, j int) bool {
+		return lessFold(restaurants[i].Name, restaurants[j].Name)
+	})
+
+	table := markdownTable(c.Config, restaurants, cols)
+	if withHistory {
+		table += historySection(c.Config, restaurants)
+	}
+	if inline := "```md\n" + table + "```"; len(inline) <= maxInlineExport {
+		c.Send(inline)
+		return
+	}
+	c.SendFile(c.T("export.attached", Args{"count": len(restaurants)}), &discordgo.File{
+		Name:        fmt.Sprintf("restaurants-%s.md", time.Now().UTC().Format("2006-01-02")),
+		ContentType: "text/markdown",
+		Reader:      strings.NewReader(table),
+	})
+}
+
+// SendFile sends text with an attached file to the channel the command came from.
+func (c *Context) SendFile(text string, file *discordgo.File) {
+	_, err := c.SendComplex(&discordgo.MessageSend{
+		Content: text,
+		Files:   []*discordgo.File{file},
+	})
+	if err != nil {
+		log.Printf("Failed to send file to %s: %v", c.Message.ChannelID, err)
+	}
+}
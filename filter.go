@@ -0,0 +1,566 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter expressions select restaurants by their attributes, e.g.
+//
+//	#japanese or #korean not #expensive
+//	(#sushi -#downtown) or price:<=$$
+//	party:12 diet:vegan vouchers
+//	fast or max-wait:20
+//	budget:12 #lunch
+//	delivery:yes reservation:no
+//
+// Terms are combined with AND unless separated by OR. NOT (or a leading '-')
+// binds tighter than AND, which binds tighter than OR. Parentheses group.
+
+// filterNode is a node of a parsed filter expression.
+type filterNode interface {
+	match(r *Restaurant) bool
+}
+
+type andNode struct{ left, right filterNode }
+type orNode struct{ left, right filterNode }
+type notNode struct{ inner filterNode }
+type tagNode struct{ tag string }
+type partyNode struct{ size int }
+type paymentNode struct{ method string }
+
+func (n andNode) match(r *Restaurant) bool     { return n.left.match(r) && n.right.match(r) }
+func (n orNode) match(r *Restaurant) bool      { return n.left.match(r) || n.right.match(r) }
+func (n notNode) match(r *Restaurant) bool     { return !n.inner.match(r) }
+func (n tagNode) match(r *Restaurant) bool     { return r.HasTag(n.tag) }
+func (n partyNode) match(r *Restaurant) bool   { return r.seats(n.size) }
+func (n paymentNode) match(r *Restaurant) bool { return r.HasPayment(n.method) }
+
+// FilterError is a filter parse error at a rune offset of the input.
+type FilterError struct {
+	Input string
+	Pos   int
+	Key   string
+	Args  Args
+}
+
+func (e *FilterError) Error() string {
+	return translator.T(defaultLanguage, e.Key, e.Args)
+}
+
+// Caret renders the input with a marker under the position of the error.
+func (e *FilterError) Caret() string {
+	return "```\n" + e.Input + "\n" + strings.Repeat(" ", e.Pos) + "^\n```"
+}
+
+// token is a lexical token of a query with its rune offset.
+type token struct {
+	text string
+	pos  int
+}
+
+// tokenize splits a query into words and parentheses. Double quotes keep
+// spaces and parentheses inside a word, e.g. exclude:"Thai Palace".
+func tokenize(input string) ([]token, *FilterError) {
+	var tokens []token
+	var current strings.Builder
+	start, inQuote, quotePos := 0, false, 0
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, token{text: current.String(), pos: start})
+			current.Reset()
+		}
+	}
+	pos := 0
+	for _, r := range input {
+		switch {
+		case inQuote:
+			current.WriteRune(r)
+			if r == '"' {
+				inQuote = false
+			}
+		case r == '"':
+			if current.Len() == 0 {
+				start = pos
+			}
+			current.WriteRune(r)
+			inQuote, quotePos = true, pos
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, token{text: string(r), pos: pos})
+		default:
+			if current.Len() == 0 {
+				start = pos
+			}
+			current.WriteRune(r)
+		}
+		pos++
+	}
+	if inQuote {
+		return nil, &FilterError{Input: input, Pos: quotePos, Key: "filter.error_quote"}
+	}
+	flush()
+	return tokens, nil
+}
+
+// filterParser is a recursive descent parser over query tokens.
+type filterParser struct {
+	input  string
+	tokens []token
+	next   int
+}
+
+// parseFilter parses a filter expression. An empty token list yields a nil
+// filter, which matches everything.
+func parseFilter(input string, tokens []token) (filterNode, *FilterError) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &filterParser{input: input, tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.next < len(p.tokens) {
+		return nil, p.errorAt(p.tokens[p.next].pos, "filter.error_unexpected", Args{"token": p.tokens[p.next].text})
+	}
+	return node, nil
+}
+
+func (p *filterParser) peek() (token, bool) {
+	if p.next >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.next], true
+}
+
+func (p *filterParser) peekKeyword(keyword string) bool {
+	t, ok := p.peek()
+	return ok && strings.EqualFold(t.text, keyword)
+}
+
+func (p *filterParser) errorAt(pos int, key string, args Args) *FilterError {
+	return &FilterError{Input: p.input, Pos: pos, Key: key, Args: args}
+}
+
+// endPos is the offset just past the input, for errors at the end.
+func (p *filterParser) endPos() int {
+	return utf8.RuneCountInString(p.input)
+}
+
+func (p *filterParser) parseOr() (filterNode, *FilterError) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.next++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, *FilterError) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.peek()
+		if !ok || t.text == ")" || strings.EqualFold(t.text, "or") {
+			return left, nil
+		}
+		if strings.EqualFold(t.text, "and") {
+			p.next++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (p *filterParser) parseUnary() (filterNode, *FilterError) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorAt(p.endPos(), "filter.error_end", nil)
+	}
+	if strings.EqualFold(t.text, "not") {
+		p.next++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	if strings.HasPrefix(t.text, "-") {
+		if t.text == "-" {
+			p.next++
+		} else {
+			p.tokens[p.next] = token{text: t.text[1:], pos: t.pos + 1}
+		}
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, *FilterError) {
+	t, _ := p.peek()
+	switch {
+	case t.text == "(":
+		p.next++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return nil, p.errorAt(t.pos, "filter.error_paren", nil)
+		}
+		p.next++
+		return inner, nil
+	case t.text == ")":
+		return nil, p.errorAt(t.pos, "filter.error_unexpected", Args{"token": t.text})
+	case strings.EqualFold(t.text, "and") || strings.EqualFold(t.text, "or"):
+		return nil, p.errorAt(t.pos, "filter.error_operator", Args{"token": t.text})
+	}
+
+	p.next++
+	return parseFilterTerm(p, t)
+}
+
+// parseFilterTerm parses a single term such as #tag, or a filter term of
+// attributeRegistry such as price:$$.
+func parseFilterTerm(p *filterParser, t token) (filterNode, *FilterError) {
+	if strings.HasPrefix(t.text, "#") {
+		tag, ok := parseTag(t.text)
+		if !ok {
+			return nil, p.errorAt(t.pos, "filter.error_tag", Args{"token": t.text})
+		}
+		return tagNode{tag}, nil
+	}
+	if method, ok := parsePayment(t.text); ok {
+		return paymentNode{method}, nil
+	}
+	if strings.EqualFold(t.text, "fast") {
+		return waitNode{max: fastWait}, nil
+	}
+
+	key, value, ok := strings.Cut(t.text, ":")
+	if !ok {
+		return nil, p.errorAt(t.pos, "filter.error_unknown", Args{"token": t.text})
+	}
+	valuePos := t.pos + utf8.RuneCountInString(key) + 1
+	if strings.EqualFold(key, "budget") {
+		cents, ok := parseBudget(value)
+		if !ok {
+			return nil, p.errorAt(valuePos, "filter.error_budget", Args{"token": value})
+		}
+		return budgetNode{cents}, nil
+	}
+	if a := filterAttribute(key); a != nil {
+		node, ok := a.filterTerm(value)
+		if !ok {
+			return nil, p.errorAt(valuePos, "filter.error_value", Args{"token": value, "key": a.filterKey()})
+		}
+		return node, nil
+	}
+	return nil, p.errorAt(t.pos, "filter.error_unknown", Args{"token": t.text})
+}
+
+// sortKeys are the orders accepted by `sort:`. The empty key is alphabetical.
+var sortKeys = []string{"name", "rating", "added", "visits", "last-visit", "distance"}
+
+// Query is a parsed filter expression with its options, as accepted by !list,
+// !random and !poll.
+type Query struct {
+	Input  string
+	Filter filterNode
+	// Sort is one of sortKeys, empty for alphabetical order.
+	Sort string
+	Desc bool
+	// Archived selects archived restaurants instead of open ones.
+	Archived bool
+	// Any lifts the guild's required payment options.
+	Any bool
+	// Untried selects the restaurants the guild has never been to.
+	Untried bool
+	// AvailableOn leaves out the restaurants unavailable on that day, given
+	// as YYYY-MM-DD. Picks and polls set it; listings show every restaurant.
+	AvailableOn string
+	// Exclude are restaurant names left out of this query only.
+	Exclude []string
+	// Members are the IDs of the members mentioned in the query, the group a pick is for.
+	Members []string
+	// Needs maps the dietary options the group requires to the members needing them.
+	Needs map[string][]string
+	// Duration and Quorum are poll options, 0 for the guild defaults.
+	Duration time.Duration
+	Quorum   int
+	// Anonymous asks for a poll voted on by direct message.
+	Anonymous bool
+	// Flow is the !lunch a poll is drawn for, if any.
+	Flow string
+}
+
+// parseNameList splits a comma-separated list of names, any of which may be
+// double-quoted, e.g. "Thai Palace","Burger Joint".
+func parseNameList(s string) []string {
+	var names []string
+	var current strings.Builder
+	inQuote := false
+	flush := func() {
+		if name := strings.TrimSpace(current.String()); name != "" {
+			names = append(names, name)
+		}
+		current.Reset()
+	}
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == ',' && !inQuote:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return names
+}
+
+// parseUserMention returns the user ID of a mention like <@123> or <@!123>.
+func parseUserMention(s string) (string, bool) {
+	id, ok := strings.CutPrefix(s, "<@")
+	id = strings.TrimPrefix(id, "!")
+	id, closed := strings.CutSuffix(id, ">")
+	if !ok || !closed || id == "" || strings.Trim(id, "0123456789") != "" {
+		return "", false
+	}
+	return id, true
+}
+
+// parseQuery parses the arguments of a listing command. Options such as
+// sort:rating, archived, any, untried, exclude:"Name", the poll options duration:20m,
+// quorum:4 and anonymous, and member mentions may appear anywhere between the filter terms.
+func parseQuery(input string) (*Query, *FilterError) {
+	input = strings.TrimSpace(input)
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{Input: input}
+	var terms []token
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if strings.EqualFold(t.text, "archived") {
+			q.Archived = true
+			continue
+		}
+		if strings.EqualFold(t.text, "any") {
+			q.Any = true
+			continue
+		}
+		if strings.EqualFold(t.text, "untried") {
+			q.Untried = true
+			continue
+		}
+		if strings.EqualFold(t.text, "anonymous") {
+			q.Anonymous = true
+			continue
+		}
+		if id, ok := parseUserMention(t.text); ok {
+			if !slices.Contains(q.Members, id) {
+				q.Members = append(q.Members, id)
+			}
+			continue
+		}
+		key, value, _ := strings.Cut(t.text, ":")
+		if strings.EqualFold(key, "exclude") && strings.Contains(t.text, ":") {
+			names := parseNameList(value)
+			if len(names) == 0 {
+				return nil, &FilterError{Input: input, Pos: t.pos + len("exclude:"), Key: "filter.error_exclude"}
+			}
+			q.Exclude = append(q.Exclude, names...)
+			continue
+		}
+		if strings.EqualFold(key, "duration") && strings.Contains(t.text, ":") {
+			d, ok := parsePollDuration(value)
+			if !ok {
+				return nil, &FilterError{Input: input, Pos: t.pos + len("duration:"), Key: "filter.error_duration", Args: Args{"token": value}}
+			}
+			q.Duration = d
+			continue
+		}
+		if strings.EqualFold(key, "quorum") && strings.Contains(t.text, ":") {
+			n, ok := parsePollQuorum(value)
+			if !ok {
+				return nil, &FilterError{Input: input, Pos: t.pos + len("quorum:"), Key: "filter.error_quorum", Args: Args{"token": value, "max": maxPollQuorum}}
+			}
+			q.Quorum = n
+			continue
+		}
+		if !strings.EqualFold(key, "sort") || !strings.Contains(t.text, ":") {
+			terms = append(terms, t)
+			continue
+		}
+		value = strings.ToLower(value)
+		if !slices.Contains(sortKeys, value) {
+			return nil, &FilterError{Input: input, Pos: t.pos + len("sort:"), Key: "filter.error_sort", Args: Args{"token": value, "keys": strings.Join(sortKeys, ", ")}}
+		}
+		q.Sort = value
+		if i+1 < len(tokens) && (strings.EqualFold(tokens[i+1].text, "desc") || strings.EqualFold(tokens[i+1].text, "asc")) {
+			q.Desc = strings.EqualFold(tokens[i+1].text, "desc")
+			i++
+		}
+	}
+
+	if q.Filter, err = parseFilter(input, terms); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Match reports whether a restaurant satisfies the query. Archived
+// restaurants only match queries for archived entries.
+func (q *Query) Match(r *Restaurant) bool {
+	if r.IsArchived() != q.Archived {
+		return false
+	}
+	for _, name := range q.Exclude {
+		if strings.EqualFold(r.Name, name) {
+			return false
+		}
+	}
+	for flag := range q.Needs {
+		if !r.HasDiet(flag) {
+			return false
+		}
+	}
+	if q.Untried && !r.untried() {
+		return false
+	}
+	if q.AvailableOn != "" && r.unavailableOn(q.AvailableOn) {
+		return false
+	}
+	return q.Filter == nil || q.Filter.match(r)
+}
+
+// Apply returns the restaurants satisfying the query, in their original order.
+func (q *Query) Apply(restaurants []Restaurant) []Restaurant {
+	var matched []Restaurant
+	for i := range restaurants {
+		if q.Match(&restaurants[i]) {
+			matched = append(matched, restaurants[i])
+		}
+	}
+	return matched
+}
+
+// sortValue returns the value a restaurant is ordered by for a sort key,
+// reporting false when the restaurant lacks the attribute.
+func sortValue(r *Restaurant, key string, cfg GuildConfig, now time.Time) (float64, bool) {
+	switch key {
+	case "rating":
+		return r.Rating(cfg, now)
+	case "added":
+		return float64(r.AddedAt.Unix()), !r.AddedAt.IsZero()
+	case "visits":
+		return float64(len(r.Visits)), true
+	case "last-visit":
+		last := r.LastVisit()
+		return float64(last.Unix()), !last.IsZero()
+	case "distance":
+		if r.Location == nil || cfg.Office == nil {
+			return 0, false
+		}
+		return cfg.Office.DistanceKm(*r.Location), true
+	}
+	return 0, false
+}
+
+// lessFold reports whether a sorts before b ignoring case, like comparing
+// strings.ToLower of both without allocating, which matters when sorting
+// thousands of names.
+func lessFold(a, b string) bool {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra, rb = unicode.ToLower(ra), unicode.ToLower(rb); ra != rb {
+			return ra < rb
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return a == "" && b != ""
+}
+
+// Order sorts restaurants by the query's sort key. Restaurants lacking the
+// attribute come last in either direction, and ties are broken by name.
+func (q *Query) Order(restaurants []Restaurant, cfg GuildConfig) {
+	byName := func(a, b *Restaurant) bool {
+		return lessFold(a.Name, b.Name)
+	}
+	now := time.Now()
+	less := func(a, b *Restaurant) bool {
+		if q.Sort == "" || q.Sort == "name" {
+			if q.Desc {
+				return byName(b, a)
+			}
+			return byName(a, b)
+		}
+		va, okA := sortValue(a, q.Sort, cfg, now)
+		vb, okB := sortValue(b, q.Sort, cfg, now)
+		switch {
+		case okA != okB:
+			return okA
+		case !okA || va == vb:
+			return byName(a, b)
+		case q.Desc:
+			return va > vb
+		}
+		return va < vb
+	}
+	// Sorting indices moves ints instead of whole restaurants, which are
+	// large enough for the swaps to dominate on long lists.
+	order := make([]int, len(restaurants))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(&restaurants[order[i]], &restaurants[order[j]])
+	})
+	sorted := make([]Restaurant, len(restaurants))
+	for i, k := range order {
+		sorted[i] = restaurants[k]
+	}
+	copy(restaurants, sorted)
+}
+
+// replyFilterError explains a filter parse error, pointing at its position.
+func (c *Context) replyFilterError(err *FilterError) {
+	c.Send(c.T("filter.error", Args{"error": c.T(err.Key, err.Args)}) + "\n" + err.Caret())
+}
+
+// replyNoMatch explains that no restaurant satisfies a query.
+func (c *Context) replyNoMatch(q *Query) {
+	if q.Input == "" {
+		c.Reply("list.empty", nil)
+		return
+	}
+	c.Reply("filter.no_match", Args{"filter": q.Input})
+}
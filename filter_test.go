@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// formatFilter renders a filter tree with explicit grouping, tags as #tag.
+func formatFilter(n filterNode) string {
+	switch n := n.(type) {
+	case nil:
+		return ""
+	case andNode:
+		return "(" + formatFilter(n.left) + " & " + formatFilter(n.right) + ")"
+	case orNode:
+		return "(" + formatFilter(n.left) + " | " + formatFilter(n.right) + ")"
+	case notNode:
+		return "!" + formatFilter(n.inner)
+	case tagNode:
+		return "#" + n.tag
+	}
+	return fmt.Sprintf("%v", n)
+}
+
+func TestParseQueryPrecedence(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"", ""},
+		{"#a", "#a"},
+		{"#a #b", "(#a & #b)"},
+		{"#a and #b", "(#a & #b)"},
+		{"#a or #b", "(#a | #b)"},
+		{"#a #b or #c", "((#a & #b) | #c)"},
+		{"#a or #b #c", "(#a | (#b & #c))"},
+		{"#a or #b or #c", "((#a | #b) | #c)"},
+		{"(#a or #b) #c", "((#a | #b) & #c)"},
+		{"#a (#b or #c)", "(#a & (#b | #c))"},
+		{"((#a))", "#a"},
+		{"#japanese or #korean not #expensive", "(#japanese | (#korean & !#expensive))"},
+		{"#A OR #B AND #C", "(#a | (#b & #c))"},
+		{"sort:rating #a or #b", "(#a | #b)"},
+	}
+	for _, tt := range tests {
+		q, err := parseQuery(tt.input)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.input, err)
+			continue
+		}
+		if got := formatFilter(q.Filter); got != tt.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryNegation(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"not #a", "!#a"},
+		{"NOT #a", "!#a"},
+		{"-#a", "!#a"},
+		{"- #a", "!#a"},
+		{"not not #a", "!!#a"},
+		{"--#a", "!!#a"},
+		{"not #a #b", "(!#a & #b)"},
+		{"not #a or #b", "(!#a | #b)"},
+		{"#a -#b", "(#a & !#b)"},
+		{"not (#a or #b)", "!(#a | #b)"},
+		{"-(#a #b)", "!(#a & #b)"},
+		{"(#sushi -#downtown) or #cheap", "((#sushi & !#downtown) | #cheap)"},
+	}
+	for _, tt := range tests {
+		q, err := parseQuery(tt.input)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.input, err)
+			continue
+		}
+		if got := formatFilter(q.Filter); got != tt.want {
+			t.Errorf("parseQuery(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryMatch(t *testing.T) {
+	restaurants := []Restaurant{
+		{Name: "Sushi Bar", Tags: []string{"japanese", "sushi"}},
+		{Name: "Kimchi House", Tags: []string{"korean", "expensive"}},
+		{Name: "Taco Truck", Tags: []string{"mexican"}},
+	}
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"#japanese or #korean not #expensive", []string{"Sushi Bar"}},
+		{"(#japanese or #korean) not #expensive", []string{"Sushi Bar"}},
+		{"not (#japanese or #korean)", []string{"Taco Truck"}},
+		{"-#japanese -#korean", []string{"Taco Truck"}},
+		{"not #expensive or #korean", []string{"Sushi Bar", "Kimchi House", "Taco Truck"}},
+	}
+	for _, tt := range tests {
+		q, err := parseQuery(tt.input)
+		if err != nil {
+			t.Errorf("parseQuery(%q): %v", tt.input, err)
+			continue
+		}
+		var got []string
+		for _, r := range q.Apply(restaurants) {
+			got = append(got, r.Name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseQuery(%q) matches %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		key   string
+		pos   int
+	}{
+		{"#a or", "filter.error_end", 5},
+		{"not", "filter.error_end", 3},
+		{"-", "filter.error_end", 1},
+		{"(#a", "filter.error_paren", 0},
+		{"#a )", "filter.error_unexpected", 3},
+		{"or #a", "filter.error_operator", 0},
+		{"#a and or #b", "filter.error_operator", 7},
+		{"#a bogus", "filter.error_unknown", 3},
+		{"-bogus", "filter.error_unknown", 1},
+		{`exclude:"Thai`, "filter.error_quote", 8},
+	}
+	for _, tt := range tests {
+		_, err := parseQuery(tt.input)
+		if err == nil {
+			t.Errorf("parseQuery(%q) succeeded, want %s", tt.input, tt.key)
+			continue
+		}
+		if err.Key != tt.key || err.Pos != tt.pos {
+			t.Errorf("parseQuery(%q) = %s at %d, want %s at %d", tt.input, err.Key, err.Pos, tt.key, tt.pos)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxFlavors bounds the number of custom flavor texts a guild can add.
+	maxFlavors = 50
+	// maxFlavorLength bounds custom flavor texts, in characters.
+	maxFlavorLength = 200
+)
+
+var (
+	// ErrTooManyFlavors is returned when a guild already has maxFlavors flavor texts.
+	ErrTooManyFlavors = errors.New("too many flavor texts")
+	// ErrFlavorNotFound is returned when removing a flavor text that isn't on the list.
+	ErrFlavorNotFound = errors.New("flavor text not found")
+)
+
+// builtinFlavors are the catalog keys of the flavor texts random picks use
+// when a guild has no custom ones.
+var builtinFlavors = []string{
+	"random.pick",
+	"flavor.dice",
+	"flavor.destiny",
+	"flavor.stars",
+	"flavor.oracle",
+	"flavor.stomach",
+	"flavor.coin",
+}
+
+// pickMessage announces a random pick of the restaurant name, with a flavor
+// text chosen from the guild's custom ones, or the built-in ones without any.
+// A custom random_pick template replaces the flavor texts.
+func pickMessage(cfg GuildConfig, name string) string {
+	if _, ok := cfg.Templates["random_pick"]; ok {
+		return cfg.T("random.pick", Args{"name": name})
+	}
+	if len(cfg.Flavors) == 0 {
+		return cfg.T(builtinFlavors[rand.IntN(len(builtinFlavors))], Args{"name": name})
+	}
+	text := cfg.Flavors[rand.IntN(len(cfg.Flavors))]
+	if !strings.Contains(text, "{name}") {
+		text += " **{name}**"
+	}
+	return formatMessage(text, Args{"name": name})
+}
+
+// validateFlavor checks a custom flavor text, which may only use the {name}
+// placeholder.
+func validateFlavor(text string) *templateError {
+	if strings.TrimSpace(text) == "" {
+		return &templateError{Key: "flavor.error_empty"}
+	}
+	if utf8.RuneCountInString(text) > maxFlavorLength {
+		return &templateError{Key: "flavor.error_length", Args: Args{"max": maxFlavorLength}}
+	}
+	return checkPlaceholders(text, []string{"name"})
+}
+
+// AddFlavor adds a custom flavor text to the guild.
+func AddFlavor(guildID, text string) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		if len(g.Config.Flavors) >= maxFlavors {
+			return ErrTooManyFlavors
+		}
+		g.Config.Flavors = append(g.Config.Flavors, text)
+		return nil
+	})
+}
+
+// RemoveFlavor removes the guild's custom flavor text at index, counted from
+// 1, returning it.
+func RemoveFlavor(guildID string, index int) (string, error) {
+	var removed string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		if index < 1 || index > len(g.Config.Flavors) {
+			return ErrFlavorNotFound
+		}
+		removed = g.Config.Flavors[index-1]
+		g.Config.Flavors = slices.Delete(g.Config.Flavors, index-1, index)
+		return nil
+	})
+	return removed, err
+}
+
+// handleFlavor implements `!flavor [list]`, `!flavor add <text>` and
+// `!flavor remove <index>`.
+func handleFlavor(c *Context) {
+	sub, rest, _ := strings.Cut(strings.TrimSpace(c.Args), " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(sub) {
+	case "", "list":
+		listFlavors(c)
+
+	case "add":
+		if !c.RequireAdmin() {
+			return
+		}
+		if err := validateFlavor(rest); err != nil {
+			c.Reply("flavor.invalid", Args{"error": c.T(err.Key, err.Args)})
+			return
+		}
+		text := escapeMentions(rest)
+		err := AddFlavor(c.GuildID, text)
+		switch {
+		case errors.Is(err, ErrTooManyFlavors):
+			c.Reply("flavor.too_many", Args{"count": maxFlavors})
+		case err != nil:
+			log.Printf("Failed to add flavor text: %v", err)
+			c.Reply("settings.save_failed", nil)
+		default:
+			c.Config.Flavors = append(c.Config.Flavors, text)
+			c.SendQuiet(c.T("flavor.added", Args{"index": len(c.Config.Flavors), "text": text}))
+		}
+
+	case "remove":
+		if !c.RequireAdmin() {
+			return
+		}
+		index, err := strconv.Atoi(rest)
+		if err != nil {
+			c.Reply("flavor.usage", nil)
+			return
+		}
+		text, err := RemoveFlavor(c.GuildID, index)
+		switch {
+		case errors.Is(err, ErrFlavorNotFound):
+			c.Reply("flavor.not_found", Args{"index": index})
+		case err != nil:
+			log.Printf("Failed to remove flavor text: %v", err)
+			c.Reply("settings.save_failed", nil)
+		default:
+			c.SendQuiet(c.T("flavor.removed", Args{"text": text}))
+		}
+
+	default:
+		c.Reply("flavor.usage", nil)
+	}
+}
+
+// listFlavors replies with the guild's custom flavor texts.
+func listFlavors(c *Context) {
+	if len(c.Config.Flavors) == 0 {
+		c.Reply("flavor.none", nil)
+		return
+	}
+	lines := []string{c.T("flavor.header", Args{"count": len(c.Config.Flavors)})}
+	for i, text := range c.Config.Flavors {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, text))
+	}
+	c.SendQuiet(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// forgetTimeout is how long the confirm button of a forget request stays valid.
+const forgetTimeout = 60 * time.Second
+
+// deletedUserName replaces the name of forgotten members where a record
+// needs someone to be attributed to.
+const deletedUserName = "deleted user"
+
+// forgetCategory is a kind of member data removed by `!forget-me`. Each is
+// removed in its own update, so a failure leaves the others done.
+type forgetCategory struct {
+	// key names the category in the summary, as "forget.count_<key>".
+	key string
+	// forget removes userID's data of this kind, returning how many records
+	// it removed or anonymized.
+	forget func(g *GuildData, userID string) int
+}
+
+// forgetCategories lists every kind of member data the bot stores.
+var forgetCategories = []forgetCategory{
+	{"ratings", forgetRatings},
+	{"visits", forgetVisits},
+	{"profile", forgetProfile},
+	{"reminders", forgetReminders},
+	{"votes", forgetVotes},
+	{"usage", forgetUsage},
+	{"attributions", forgetAttributions},
+}
+
+// forgetRatings removes the member's ratings and anonymizes their answers
+// to wait questions.
+func forgetRatings(g *GuildData, userID string) int {
+	n := 0
+	for i := range g.Restaurants {
+		r := &g.Restaurants[i]
+		if _, ok := r.Ratings[userID]; ok {
+			n++
+		}
+		delete(r.Ratings, userID)
+		delete(r.RatedAt, userID)
+		delete(r.GuestRatings, userID)
+		for w := range r.WaitReports {
+			if r.WaitReports[w].UserID == userID {
+				r.WaitReports[w].UserID = ""
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// forgetVisits removes the member from the attendees of visits and from
+// the visits they recorded.
+func forgetVisits(g *GuildData, userID string) int {
+	n := 0
+	for i := range g.Restaurants {
+		for v := range g.Restaurants[i].Visits {
+			visit := &g.Restaurants[i].Visits[v]
+			attended := slices.Contains(visit.Attendees, userID)
+			visit.Attendees = slices.DeleteFunc(visit.Attendees, func(id string) bool { return id == userID })
+			if attended || visit.RecordedBy == userID {
+				n++
+			}
+			if visit.RecordedBy == userID {
+				visit.RecordedBy = ""
+			}
+		}
+	}
+	return n
+}
+
+// forgetProfile removes the member's settings, such as their diet and
+// absences, their place in the last lunch buddy groups and in the lunches
+// being organized.
+func forgetProfile(g *GuildData, userID string) int {
+	n := 0
+	if _, ok := g.Members[userID]; ok {
+		delete(g.Members, userID)
+		n++
+	}
+	if b := g.LastBuddies; b != nil {
+		for i, group := range b.Groups {
+			if slices.Contains(group, userID) {
+				b.Groups[i] = slices.DeleteFunc(group, func(id string) bool { return id == userID })
+				n++
+			}
+		}
+	}
+	for i := range g.LunchFlows {
+		f := &g.LunchFlows[i]
+		if slices.Contains(f.Participants, userID) {
+			f.Participants = slices.DeleteFunc(f.Participants, func(id string) bool { return id == userID })
+			n++
+		}
+	}
+	return n
+}
+
+// forgetReminders removes the member's reminders.
+func forgetReminders(g *GuildData, userID string) int {
+	before := len(g.Reminders)
+	g.Reminders = slices.DeleteFunc(g.Reminders, func(r Reminder) bool { return r.UserID == userID })
+	return before - len(g.Reminders)
+}
+
+// forgetVotes removes the member's votes in open battles and their ballots
+// in anonymous polls, both open and kept for `!poll again`.
+func forgetVotes(g *GuildData, userID string) int {
+	n := 0
+	for _, b := range g.Battles {
+		if _, ok := b.Votes[userID]; ok {
+			delete(b.Votes, userID)
+			n++
+		}
+	}
+	for _, polls := range [][]Poll{g.Polls, g.LastPolls} {
+		for i := range polls {
+			p := &polls[i]
+			if _, ok := p.Ballots[userID]; ok {
+				delete(p.Ballots, userID)
+				n++
+			}
+			p.Participants = slices.DeleteFunc(p.Participants, func(id string) bool { return id == userID })
+		}
+	}
+	return n
+}
+
+// forgetUsage removes the member from the saved command usage counts.
+func forgetUsage(g *GuildData, userID string) int {
+	n := 0
+	for i := range g.Usage {
+		if _, ok := g.Usage[i].Users[userID]; ok {
+			delete(g.Usage[i].Users, userID)
+			n++
+		}
+	}
+	return n
+}
+
+// forgetAttributions replaces the member with a deleted user in the audit
+// log, in who added and revised restaurants, accepted picks, proposed
+// removals and started the tournament, as the payer of expenses and as the
+// admin told about announcement failures.
+func forgetAttributions(g *GuildData, userID string) int {
+	n := 0
+	anonymize := func(c *Contributor) {
+		if c != nil && c.ID == userID {
+			*c = Contributor{Name: deletedUserName}
+			n++
+		}
+	}
+	for i := range g.Audit {
+		anonymize(g.Audit[i].By)
+		for v := range g.Audit[i].Voters {
+			anonymize(&g.Audit[i].Voters[v])
+		}
+	}
+	for i := range g.Restaurants {
+		anonymize(g.Restaurants[i].AddedBy)
+		for h := range g.Restaurants[i].History {
+			anonymize(g.Restaurants[i].History[h].By)
+		}
+	}
+	for i := range g.Picks {
+		anonymize(g.Picks[i].AcceptedBy)
+	}
+	for i := range g.Proposals {
+		anonymize(&g.Proposals[i].By)
+	}
+	if g.Tournament != nil {
+		anonymize(&g.Tournament.StartedBy)
+	}
+	for i := range g.Expenses {
+		if g.Expenses[i].PayerID == userID {
+			g.Expenses[i].PayerID = ""
+			n++
+		}
+	}
+	for i := range g.LunchFlows {
+		if g.LunchFlows[i].OrganizerID == userID {
+			g.LunchFlows[i].OrganizerID = ""
+			n++
+		}
+	}
+	if g.AnnounceAdminID == userID {
+		g.AnnounceAdminID = ""
+		n++
+	}
+	return n
+}
+
+// ForgetMember removes a member's data from a guild, one category at a time.
+// It returns the number of records removed per category, and the categories
+// that failed.
+func ForgetMember(guildID, userID string) (map[string]int, []string) {
+	counts := map[string]int{}
+	var failed []string
+	// Usage not flushed yet is dropped first so that it can't be saved after
+	// the saved usage is forgotten.
+	pending := forgetPendingUsage(guildID, userID)
+	for _, cat := range forgetCategories {
+		err := updateGuild(guildID, func(g *GuildData) error {
+			counts[cat.key] = cat.forget(g, userID)
+			if cat.key == "usage" {
+				counts[cat.key] += pending
+			}
+			return nil
+		}, syncSave)
+		if err != nil {
+			log.Printf("Failed to forget %s of %s: %v", cat.key, userID, err)
+			delete(counts, cat.key)
+			failed = append(failed, cat.key)
+		}
+	}
+	return counts, failed
+}
+
+// pendingForget is a forget request waiting for confirmation.
+type pendingForget struct {
+	guildID string
+	// userID is the member who asked, targetID the member to forget.
+	userID   string
+	targetID string
+	expires  time.Time
+}
+
+var (
+	// pendingForgets stores forget requests waiting for confirmation, keyed by token.
+	pendingForgets      = make(map[string]*pendingForget)
+	pendingForgetsMutex sync.Mutex
+)
+
+// userIDPattern matches a user mention or a bare user ID.
+var userIDPattern = regexp.MustCompile(`^(?:<@!?(\d+)>|(\d+))$`)
+
+// handleForgetMe implements `!forget-me`.
+func handleForgetMe(c *Context) {
+	startForget(c, c.Message.Author.ID)
+}
+
+// handleForget implements `!forget @user`, for members who already left.
+func handleForget(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	m := userIDPattern.FindStringSubmatch(strings.TrimSpace(c.Args))
+	if m == nil {
+		c.Reply("forget.usage", nil)
+		return
+	}
+	startForget(c, m[1]+m[2])
+}
+
+// startForget asks the member to confirm forgetting targetID.
+func startForget(c *Context, targetID string) {
+	token := newToken()
+	op := &pendingForget{guildID: c.GuildID, userID: c.Message.Author.ID, targetID: targetID, expires: time.Now().Add(forgetTimeout)}
+	pendingForgetsMutex.Lock()
+	pendingForgets[token] = op
+	pendingForgetsMutex.Unlock()
+
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content:         c.T("forget.preview", Args{"user": "<@" + targetID + ">", "seconds": int(forgetTimeout.Seconds())}),
+		Components:      forgetComponents(c.Config, token),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to send forget preview: %v", err)
+		return
+	}
+
+	time.AfterFunc(forgetTimeout, func() {
+		pendingForgetsMutex.Lock()
+		_, pending := pendingForgets[token]
+		delete(pendingForgets, token)
+		pendingForgetsMutex.Unlock()
+		if !pending {
+			return
+		}
+		content := c.T("forget.expired", nil)
+		components := []discordgo.MessageComponent{}
+		if _, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: msg.ID, Channel: msg.ChannelID, Content: &content, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to expire forget preview: %v", err)
+		}
+	})
+}
+
+// forgetComponents builds the confirmation buttons of a forget request.
+func forgetComponents(cfg GuildConfig, token string) []discordgo.MessageComponent {
+	id := func(action string) string { return fmt.Sprintf("forget:%s:%s", token, action) }
+	return []discordgo.MessageComponent{buttonRow(
+		discordgo.Button{Label: cfg.T("button.confirm", nil), Style: discordgo.DangerButton, CustomID: id("confirm")},
+		discordgo.Button{Label: cfg.T("button.cancel", nil), Style: discordgo.SecondaryButton, CustomID: id("cancel")},
+	)}
+}
+
+// handleForgetComponent handles the buttons of a forget request.
+func handleForgetComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pendingForgetsMutex.Lock()
+	op, ok := pendingForgets[token]
+	if ok && time.Now().After(op.expires) {
+		delete(pendingForgets, token)
+		ok = false
+	}
+	if !ok {
+		pendingForgetsMutex.Unlock()
+		i.Update(i.T("forget.expired", nil), nil)
+		return
+	}
+	if i.UserID() != op.userID {
+		pendingForgetsMutex.Unlock()
+		i.Ephemeral("forget.not_yours", nil)
+		return
+	}
+	delete(pendingForgets, token)
+	pendingForgetsMutex.Unlock()
+
+	if action != "confirm" {
+		i.Update(i.T("forget.cancelled", nil), nil)
+		return
+	}
+	counts, failed := ForgetMember(op.guildID, op.targetID)
+	var parts []string
+	for _, cat := range forgetCategories {
+		if n, ok := counts[cat.key]; ok {
+			parts = append(parts, i.T("forget.count_"+cat.key, Args{"count": n}))
+		}
+	}
+	lines := []string{i.T("forget.done", Args{"user": "<@" + op.targetID + ">", "counts": strings.Join(parts, ", ")})}
+	if len(failed) > 0 {
+		var names []string
+		for _, key := range failed {
+			names = append(names, i.T("forget.category_"+key, nil))
+		}
+		lines = append(lines, i.T("forget.partial", Args{"categories": strings.Join(names, ", ")}))
+	}
+	i.Update(strings.Join(lines, "\n"), nil)
+}
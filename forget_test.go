@@ -0,0 +1,68 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForgetMemberUsageBallotsAndLunches(t *testing.T) {
+	newTestDB(t)
+	now := time.Now()
+	err := updateGuild("g1", func(g *GuildData) error {
+		g.Usage = []UsageDay{{Date: now.UTC().AddDate(0, 0, -1).Format("2006-01-02"), Users: map[string]int{"1": 2, "2": 1}}}
+		g.Polls = []Poll{{Options: []string{"A", "B"}, Ballots: map[string]int{"1": 0, "2": 1}, Participants: []string{"1", "2"}}}
+		g.LastPolls = []Poll{{Options: []string{"A"}, Participants: []string{"2", "1"}}}
+		g.LunchFlows = []LunchFlow{{ID: "l1", ChannelID: "c1", OrganizerID: "1", Stage: lunchRollCall, Participants: []string{"1", "2"}, Until: now.Add(time.Hour)}}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordUsage("g1", "list", "1", now)
+	recordUsage("g1", "list", "2", now)
+	t.Cleanup(func() { flushUsage(now) })
+
+	counts, failed := ForgetMember("g1", "1")
+	if len(failed) > 0 {
+		t.Fatalf("failed to forget %v", failed)
+	}
+	if counts["usage"] != 2 || counts["votes"] != 1 || counts["profile"] != 1 || counts["attributions"] != 1 {
+		t.Errorf("counts = %v, want 2 usage days, 1 vote, 1 lunch joined and 1 lunch organized", counts)
+	}
+
+	flushUsage(now)
+	err = viewKnownGuild("g1", func(g *GuildData) error {
+		if len(g.Usage) != 2 {
+			t.Errorf("usage = %v, want yesterday and today", g.Usage)
+		}
+		for _, day := range g.Usage {
+			if _, ok := day.Users["1"]; ok {
+				t.Errorf("usage of %s still counts the member", day.Date)
+			}
+			if day.Users["2"] == 0 {
+				t.Errorf("usage of %s lost the other member", day.Date)
+			}
+		}
+		if _, ok := g.Polls[0].Ballots["1"]; ok || g.Polls[0].Ballots["2"] != 1 {
+			t.Errorf("ballots = %v", g.Polls[0].Ballots)
+		}
+		for _, p := range append(g.Polls, g.LastPolls...) {
+			if slices.Contains(p.Participants, "1") || !slices.Contains(p.Participants, "2") {
+				t.Errorf("participants = %v", p.Participants)
+			}
+		}
+		f := g.LunchFlows[0]
+		if f.OrganizerID != "" || !slices.Equal(f.Participants, []string{"2"}) {
+			t.Errorf("lunch organized by %q with %v, want the organizer forgotten and only 2 left", f.OrganizerID, f.Participants)
+		}
+		if content := lunchContent(g.Config, f); strings.Contains(content, "<@1>") || strings.Contains(content, "<@>") {
+			t.Errorf("roll call still mentions the organizer: %s", content)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
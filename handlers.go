@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+func handlePing(c *Context) {
+	c.Reply("ping.pong", nil)
+}
+
+func handleList(c *Context) {
+	query, ferr := parseQuery(c.Args)
+	if ferr != nil {
+		c.replyFilterError(ferr)
+		return
+	}
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+
+	if len(restaurants) == 0 {
+		c.Reply("list.empty", nil)
+		return
+	}
+	if query.Sort == "distance" && c.Config.Office == nil {
+		c.Reply("list.no_office", nil)
+		return
+	}
+	note := query.skippedNoWaitNote(c.Config, restaurants)
+	restaurants = query.Apply(restaurants)
+	if len(restaurants) == 0 {
+		c.replyNoMatch(query)
+		if note != "" {
+			c.Send(note)
+		}
+		return
+	}
+	query.Order(restaurants, c.Config)
+
+	lines := listLines(c.Config, query, restaurants, time.Now())
+	rememberList(c.GuildID, c.Message.ChannelID, restaurants, time.Now())
+	header := c.T("list.header", Args{"count": len(restaurants)})
+	if note != "" {
+		header += "\n" + note
+	}
+	c.SendPages(header, lines)
+}
+
+// listLines formats the numbered lines of `!list` for restaurants ordered by query.
+func listLines(cfg GuildConfig, query *Query, restaurants []Restaurant, now time.Time) []string {
+	today := localDate(now, cfg.location())
+	lines := make([]string, 0, len(restaurants))
+	for i, r := range restaurants {
+		line := fmt.Sprintf("%d. %s `%s%s`", i+1, listEntry(r), idPrefix, r.ID)
+		if r.IsArchived() {
+			line += " · " + archiveLine(cfg, r.Archived)
+		}
+		if r.unavailableOn(today) {
+			line += " · " + unavailableLine(cfg, r.Unavailable)
+		}
+		if query.Sort == "distance" && r.Location != nil {
+			line += " · " + cfg.T("list.distance", Args{"km": fmt.Sprintf("%.1f", cfg.Office.DistanceKm(*r.Location))})
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// listEntry formats a restaurant for a list line.
+func listEntry(r Restaurant) string {
+	parts := []string{r.Name}
+	if r.Emoji != "" {
+		parts = []string{r.Emoji, r.Name}
+	}
+	if r.Price > 0 {
+		parts = append(parts, formatPrice(r.Price))
+	}
+	if avg, ok := r.AverageRating(); ok {
+		parts = append(parts, formatRating(avg))
+	}
+	if len(r.Tags) > 0 {
+		parts = append(parts, formatTags(r.Tags))
+	}
+	if len(r.Diet) > 0 {
+		parts = append(parts, "("+strings.Join(r.Diet, ", ")+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+func handleML(c *Context) {
+	err := HealthCheckMLAPI(c.Ctx)
+	if err != nil {
+		log.Printf("ML API health check failed: %v", err)
+		if !c.timedOut(err) {
+			c.Reply("ml.failed", Args{"error": err})
+		}
+	} else {
+		c.Reply("ml.ok", nil)
+	}
+}
+
+func handleRemove(c *Context) {
+	restaurantName, _, ok, failed := c.parseListRef(c.Args)
+	if failed {
+		return
+	}
+	if !ok || restaurantName == "" {
+		c.Reply("remove.usage", nil)
+		return
+	}
+
+	removed, count, err := RemoveRestaurant(c.GuildID, restaurantName, c.Author())
+	if err != nil {
+		log.Printf("Failed to remove restaurant: %v", err)
+		c.replyError("remove.failed", err, restaurantName)
+		return
+	}
+
+	c.sendWithUndo(c.T("remove.done", Args{"name": removed.Name, "count": count}), snapshot{Before: []Restaurant{removed}})
+}
+
+func handleAdd(c *Context) {
+	restaurantName, _, ok := parseQuoted(c.Args)
+	if !ok || restaurantName == "" {
+		c.Reply("add.usage", nil)
+		return
+	}
+	if err := validateName(restaurantName, c.Config.maxNameLength()); err != nil {
+		c.replyNameError(err)
+		return
+	}
+
+	similar, err := FindSimilar(c.GuildID, restaurantName)
+	if err != nil {
+		log.Printf("Error checking for similar restaurants: %v", err)
+		c.Reply("add.failed", nil)
+		return
+	}
+	if len(similar) > 0 {
+		askAddAnyway(c, restaurantName, similar)
+		return
+	}
+
+	count, duplicateInfo, err := AddRestaurant(c.Ctx, c.GuildID, restaurantName, c.Author())
+	if errors.Is(err, ErrListFull) {
+		c.Reply("add.list_full", Args{"count": c.Config.maxRestaurants()})
+		return
+	}
+	if c.replyNameError(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error adding restaurant: %v", err)
+		if !c.timedOut(err) {
+			c.Reply("add.failed", nil)
+		}
+		return
+	}
+
+	if duplicateInfo != nil {
+		// The ML API found a likely duplicate the name comparison missed.
+		askAddAnyway(c, restaurantName, []string{duplicateInfo.MatchedName})
+		return
+	}
+
+	c.Ack("add.done", Args{"name": restaurantName, "count": count})
+	offerTags(c.Session, c.Message.ChannelID, c.GuildID, c.Config, c.Message.Author.ID, restaurantName)
+}
+
+func handleVisited(c *Context) {
+	restaurantName, _, ok := parseRef(c.Args)
+	if !ok || restaurantName == "" {
+		c.Reply("visited.usage", nil)
+		return
+	}
+
+	name, visits, err := RecordVisit(c.GuildID, restaurantName, time.Now(), visitAttendees(c), c.Message.Author.ID, c.Message.ChannelID)
+	if err != nil {
+		log.Printf("Failed to record visit: %v", err)
+		c.replyError("visited.failed", err, restaurantName)
+		return
+	}
+
+	c.Ack("visited.done", Args{"name": name, "count": visits})
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// notYetSize is the number of restaurants !not-yet lists.
+	notYetSize = 25
+)
+
+// MemberSettings holds a member's own preferences.
+type MemberSettings struct {
+	// NoTracking leaves the member out of the attendees of visits.
+	NoTracking bool `json:"no_tracking,omitempty"`
+	// Diet lists the dietary options the member needs, e.g. "vegan".
+	Diet []string `json:"diet,omitempty"`
+	// AwayUntil is the last day, as YYYY-MM-DD in the guild's timezone, the member is away.
+	AwayUntil string `json:"away_until,omitempty"`
+	// NoLeaderboard leaves the member out of !leaderboard.
+	NoLeaderboard bool `json:"no_leaderboard,omitempty"`
+}
+
+// empty reports whether the settings are all defaults.
+func (m MemberSettings) empty() bool {
+	return !m.NoTracking && len(m.Diet) == 0 && m.AwayUntil == "" && !m.NoLeaderboard
+}
+
+// updateMember changes a member's settings, dropping them once they are all defaults.
+func (g *GuildData) updateMember(userID string, fn func(m *MemberSettings)) {
+	settings := g.Members[userID]
+	fn(&settings)
+	if settings.empty() {
+		delete(g.Members, userID)
+		return
+	}
+	if g.Members == nil {
+		g.Members = map[string]MemberSettings{}
+	}
+	g.Members[userID] = settings
+}
+
+// tracked returns the attendees who haven't opted out of tracking, without duplicates.
+func (g *GuildData) tracked(userIDs []string) []string {
+	var kept []string
+	for _, id := range userIDs {
+		if id != "" && !g.Members[id].NoTracking && !slices.Contains(kept, id) {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// visitAttendees returns the members a visit command is recorded for: the
+// mentioned members, or the author when nobody is mentioned.
+func visitAttendees(c *Context) []string {
+	var ids []string
+	for _, u := range c.Message.Mentions {
+		if !u.Bot {
+			ids = append(ids, u.ID)
+		}
+	}
+	if len(ids) == 0 {
+		ids = []string{c.Message.Author.ID}
+	}
+	return ids
+}
+
+// SetTracking opts a member in or out of attendee tracking. Opting out also
+// removes the member from the visits already recorded.
+func SetTracking(guildID, userID string, track bool) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		g.updateMember(userID, func(m *MemberSettings) { m.NoTracking = !track })
+		if track {
+			return nil
+		}
+		for i := range g.Restaurants {
+			for j := range g.Restaurants[i].Visits {
+				v := &g.Restaurants[i].Visits[j]
+				v.Attendees = slices.DeleteFunc(v.Attendees, func(id string) bool { return id == userID })
+			}
+		}
+		return nil
+	})
+}
+
+// handleMeSetting implements `!settings me track [on|off]`, `!settings me
+// diet [flags|clear]` and `!settings me leaderboard [on|off]`.
+func handleMeSetting(c *Context, fields []string) {
+	if len(fields) > 0 && strings.EqualFold(fields[0], "diet") {
+		handleMeDietSetting(c, fields[1:])
+		return
+	}
+	if len(fields) > 0 && strings.EqualFold(fields[0], "leaderboard") {
+		handleMeLeaderboardSetting(c, fields[1:])
+		return
+	}
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "track") || len(fields) > 2 {
+		c.Reply("settings.me_usage", Args{"flags": strings.Join(dietFlags, ", ")})
+		return
+	}
+	if len(fields) == 1 {
+		var tracked bool
+		if err := viewGuild(c.GuildID, func(g *GuildData) error {
+			tracked = !g.Members[c.Message.Author.ID].NoTracking
+			return nil
+		}); err != nil {
+			log.Printf("Failed to load member settings: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		key := "settings.me_track_off"
+		if tracked {
+			key = "settings.me_track_on"
+		}
+		c.Reply(key, nil)
+		return
+	}
+
+	var track bool
+	switch strings.ToLower(fields[1]) {
+	case "on":
+		track = true
+	case "off":
+	default:
+		c.Reply("settings.me_usage", Args{"flags": strings.Join(dietFlags, ", ")})
+		return
+	}
+	if err := SetTracking(c.GuildID, c.Message.Author.ID, track); err != nil {
+		log.Printf("Failed to save tracking preference: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	if track {
+		c.Reply("settings.me_track_set_on", nil)
+	} else {
+		c.Reply("settings.me_track_set_off", nil)
+	}
+}
+
+// handleMeDietSetting implements `!settings me diet [flags|clear]`. The
+// profile is only ever shown to the member, in a direct message.
+func handleMeDietSetting(c *Context, fields []string) {
+	userID := c.Message.Author.ID
+	if len(fields) == 0 {
+		var diet []string
+		if err := viewGuild(c.GuildID, func(g *GuildData) error {
+			diet = g.Members[userID].Diet
+			return nil
+		}); err != nil {
+			log.Printf("Failed to load member settings: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		c.SendPrivate(dietProfileLine(c.Config, diet))
+		return
+	}
+
+	var diet []string
+	if len(fields) != 1 || (!strings.EqualFold(fields[0], "none") && !strings.EqualFold(fields[0], "clear")) {
+		for _, d := range strings.Split(strings.Join(fields, ","), ",") {
+			if d = strings.TrimSpace(d); d == "" {
+				continue
+			}
+			flag, ok := parseDiet(d)
+			if !ok {
+				c.Reply("settings.me_usage", Args{"flags": strings.Join(dietFlags, ", ")})
+				return
+			}
+			if !slices.Contains(diet, flag) {
+				diet = append(diet, flag)
+			}
+		}
+		sort.Strings(diet)
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.updateMember(userID, func(m *MemberSettings) { m.Diet = diet })
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save dietary needs: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Reply("settings.me_diet_saved", nil)
+	c.SendPrivate(dietProfileLine(c.Config, diet))
+}
+
+// dietProfileLine describes a member's dietary needs to them.
+func dietProfileLine(cfg GuildConfig, diet []string) string {
+	if len(diet) == 0 {
+		return cfg.T("settings.me_diet_none", nil)
+	}
+	return cfg.T("settings.me_diet", Args{"diet": strings.Join(diet, ", ")})
+}
+
+// handleMe implements `!me`, a shorthand for `!settings me`.
+func handleMe(c *Context) {
+	handleMeSetting(c, strings.Fields(c.Args))
+}
+
+// visitedBy reports whether a member attended any visit to the restaurant.
+func (r *Restaurant) visitedBy(userID string) bool {
+	for _, v := range r.Visits {
+		if slices.Contains(v.Attendees, userID) {
+			return true
+		}
+	}
+	return false
+}
+
+// memberHistory loads the restaurants for a member's history, replying and
+// returning false if it can't be shown.
+func memberHistory(c *Context, userID string) ([]Restaurant, bool) {
+	var restaurants []Restaurant
+	var optedOut bool
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		restaurants = g.active()
+		optedOut = g.Members[userID].NoTracking
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load visit history: %v", err)
+		c.Reply("history.failed", nil)
+		return nil, false
+	}
+	if optedOut {
+		c.Reply("history.opted_out", nil)
+		return nil, false
+	}
+	return restaurants, true
+}
+
+// handleMyVisits implements `!my-visits`, the author's recent visits and favourite place.
+func handleMyVisits(c *Context) {
+	userID := c.Message.Author.ID
+	restaurants, ok := memberHistory(c, userID)
+	if !ok {
+		return
+	}
+	type visit struct {
+		name string
+		date time.Time
+	}
+	var visits []visit
+	counts := map[string]int{}
+	for _, r := range restaurants {
+		for _, v := range r.Visits {
+			if slices.Contains(v.Attendees, userID) {
+				visits = append(visits, visit{r.Name, v.Date})
+				counts[r.Name]++
+			}
+		}
+	}
+	if len(visits) == 0 {
+		c.Reply("history.none", nil)
+		return
+	}
+	sort.SliceStable(visits, func(i, j int) bool { return visits[i].date.After(visits[j].date) })
+	favourite, favouriteCount := busiest(counts)
+
+	header := c.T("history.header", Args{"count": len(visits)}) + "\n" +
+		c.T("history.favourite", Args{"name": favourite, "count": favouriteCount})
+	var lines []string
+	loc := c.Config.location()
+	for _, v := range visits {
+		lines = append(lines, "- "+v.date.In(loc).Format("2006-01-02")+" "+v.name)
+	}
+	c.SendPages(header, lines)
+}
+
+// handleNotYet implements `!not-yet [@member]`, the open restaurants a member has never been to.
+func handleNotYet(c *Context) {
+	userID := c.Message.Author.ID
+	for _, u := range c.Message.Mentions {
+		if !u.Bot {
+			userID = u.ID
+			break
+		}
+	}
+	restaurants, ok := memberHistory(c, userID)
+	if !ok {
+		return
+	}
+	var names []string
+	for _, r := range restaurants {
+		if !r.IsArchived() && !r.visitedBy(userID) {
+			names = append(names, r.Name)
+		}
+	}
+	if len(names) == 0 {
+		c.Reply("history.not_yet_none", nil)
+		return
+	}
+	sort.Strings(names)
+	lines := []string{c.T("history.not_yet_header", Args{"count": len(names), "user": "<@" + userID + ">"})}
+	for _, name := range names[:min(len(names), notYetSize)] {
+		lines = append(lines, "- "+name)
+	}
+	if extra := len(names) - notYetSize; extra > 0 {
+		lines = append(lines, c.T("history.more", Args{"count": extra}))
+	}
+	c.SendQuiet(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxHolidays bounds the number of holidays a guild can add.
+const maxHolidays = 100
+
+var (
+	// ErrTooManyHolidays is returned when a guild already has maxHolidays holidays.
+	ErrTooManyHolidays = errors.New("too many holidays")
+	// ErrHolidayNotFound is returned when removing a holiday that isn't on the list.
+	ErrHolidayNotFound = errors.New("holiday not found")
+)
+
+// Holiday is a day without lunch plans, on which schedules don't run.
+type Holiday struct {
+	// Date is the day as YYYY-MM-DD. Yearly holidays only use the month and day.
+	Date   string `json:"date"`
+	Name   string `json:"name"`
+	Yearly bool   `json:"yearly,omitempty"`
+}
+
+// on reports whether the holiday falls on a date formatted as YYYY-MM-DD.
+func (h Holiday) on(date string) bool {
+	if h.Yearly {
+		return h.Date[4:] == date[4:]
+	}
+	return h.Date == date
+}
+
+// holidayRule describes a public holiday in the embedded dataset: a fixed
+// date, a day relative to Easter Sunday, or the nth weekday of a month.
+type holidayRule struct {
+	Name string `json:"name"`
+	// Date is a fixed month and day as MM-DD.
+	Date string `json:"date,omitempty"`
+	// Easter is the offset in days from Easter Sunday.
+	Easter *int `json:"easter,omitempty"`
+	// Month, Weekday and Week select e.g. the last ("week": -1) Monday of May.
+	Month   int    `json:"month,omitempty"`
+	Weekday string `json:"weekday,omitempty"`
+	Week    int    `json:"week,omitempty"`
+}
+
+//go:embed holidays/public.json
+var publicHolidayData []byte
+
+// publicHolidays maps a country code to its public holidays.
+var publicHolidays = mustLoadPublicHolidays()
+
+func mustLoadPublicHolidays() map[string][]holidayRule {
+	var rules map[string][]holidayRule
+	if err := json.Unmarshal(publicHolidayData, &rules); err != nil {
+		log.Fatalf("Failed to load public holidays: %v", err)
+	}
+	return rules
+}
+
+// holidayCountries returns the country codes with public holidays, sorted.
+func holidayCountries() []string {
+	var codes []string
+	for code := range publicHolidays {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// easterSunday returns the date of Easter Sunday in a year of the Gregorian calendar.
+func easterSunday(year int) time.Time {
+	a, b, c := year%19, year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// date returns the day the rule falls on in a year.
+func (r holidayRule) date(year int) (time.Time, bool) {
+	switch {
+	case r.Date != "":
+		t, err := time.Parse("2006-01-02", fmt.Sprintf("%04d-%s", year, r.Date))
+		return t, err == nil
+	case r.Easter != nil:
+		return easterSunday(year).AddDate(0, 0, *r.Easter), true
+	case r.Month >= 1 && r.Month <= 12 && r.Week != 0:
+		weekday := slices.Index(weekdayNames, r.Weekday)
+		if weekday < 0 {
+			return time.Time{}, false
+		}
+		if r.Week < 0 {
+			last := time.Date(year, time.Month(r.Month)+1, 0, 0, 0, 0, 0, time.UTC)
+			offset := (int(last.Weekday()) - weekday + 7) % 7
+			return last.AddDate(0, 0, -offset-7*(-r.Week-1)), true
+		}
+		first := time.Date(year, time.Month(r.Month), 1, 0, 0, 0, 0, time.UTC)
+		offset := (weekday - int(first.Weekday()) + 7) % 7
+		return first.AddDate(0, 0, offset+7*(r.Week-1)), true
+	}
+	return time.Time{}, false
+}
+
+// countryHolidays returns the public holidays of a country in a year, in date order.
+func countryHolidays(country string, year int) []Holiday {
+	var holidays []Holiday
+	for _, rule := range publicHolidays[country] {
+		if t, ok := rule.date(year); ok {
+			holidays = append(holidays, Holiday{Date: t.Format("2006-01-02"), Name: rule.Name})
+		}
+	}
+	sort.SliceStable(holidays, func(i, j int) bool { return holidays[i].Date < holidays[j].Date })
+	return holidays
+}
+
+// holiday returns the name of the guild's holiday on the local day of t, if any.
+func (g *GuildData) holiday(t time.Time) (string, bool) {
+	date := localDate(t, g.Config.location())
+	for _, h := range g.Holidays {
+		if h.on(date) {
+			return h.Name, true
+		}
+	}
+	if g.Config.HolidayCountry != "" {
+		for _, h := range countryHolidays(g.Config.HolidayCountry, t.In(g.Config.location()).Year()) {
+			if h.Date == date {
+				return h.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// nextWorkday returns the first time at the same local clock time as t, from
+// t on, that isn't on one of the guild's holidays.
+func (g *GuildData) nextWorkday(t time.Time) time.Time {
+	for d := 0; d < 366; d++ {
+		at := t.In(g.Config.location()).AddDate(0, 0, d)
+		if _, ok := g.holiday(at); !ok {
+			return at
+		}
+	}
+	return t
+}
+
+// AddHoliday adds a holiday, replacing any other holiday on the same date.
+func AddHoliday(guildID string, h Holiday) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		g.Holidays = slices.DeleteFunc(g.Holidays, func(other Holiday) bool { return other.Date == h.Date })
+		if len(g.Holidays) >= maxHolidays {
+			return ErrTooManyHolidays
+		}
+		g.Holidays = append(g.Holidays, h)
+		sort.SliceStable(g.Holidays, func(i, j int) bool { return g.Holidays[i].Date < g.Holidays[j].Date })
+		return nil
+	})
+}
+
+// RemoveHoliday removes the guild's holiday on a date, returning it.
+func RemoveHoliday(guildID, date string) (Holiday, error) {
+	var removed Holiday
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i := slices.IndexFunc(g.Holidays, func(h Holiday) bool { return h.on(date) })
+		if i < 0 {
+			return ErrHolidayNotFound
+		}
+		removed = g.Holidays[i]
+		g.Holidays = slices.Delete(g.Holidays, i, i+1)
+		return nil
+	})
+	return removed, err
+}
+
+// announceHoliday tells a channel once per holiday that schedules are skipped.
+func announceHoliday(s *discordgo.Session, guildID, channelID string, cfg GuildConfig, date, name string) {
+	announced := false
+	if err := updateGuild(guildID, func(g *GuildData) error {
+		announced = g.HolidayNotice == date
+		g.HolidayNotice = date
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save holiday notice for guild %s: %v", guildID, err)
+		return
+	}
+	if announced {
+		return
+	}
+	if _, err := s.ChannelMessageSend(channelID, cfg.T("holidays.skipped", Args{"name": name})); err != nil {
+		log.Printf("Failed to announce holiday: %v", err)
+	}
+}
+
+// handleHolidays implements `!holidays [list]`, `!holidays add YYYY-MM-DD "Name" [yearly]`
+// and `!holidays remove YYYY-MM-DD`.
+func handleHolidays(c *Context) {
+	sub, rest, _ := strings.Cut(c.Args, " ")
+	rest = strings.TrimSpace(rest)
+	switch strings.ToLower(sub) {
+	case "", "list":
+		listHolidays(c)
+
+	case "add":
+		if !c.RequireAdmin() {
+			return
+		}
+		date, rest, _ := strings.Cut(rest, " ")
+		name, flags, ok := parseQuoted(strings.TrimSpace(rest))
+		if _, err := time.Parse("2006-01-02", date); err != nil || !ok || name == "" || (flags != "" && !strings.EqualFold(flags, "yearly")) {
+			c.Reply("holidays.usage", nil)
+			return
+		}
+		h := Holiday{Date: date, Name: name, Yearly: flags != ""}
+		err := AddHoliday(c.GuildID, h)
+		switch {
+		case errors.Is(err, ErrTooManyHolidays):
+			c.Reply("holidays.too_many", Args{"count": maxHolidays})
+		case err != nil:
+			log.Printf("Failed to add holiday: %v", err)
+			c.Reply("holidays.failed", nil)
+		default:
+			c.Reply("holidays.added", Args{"holiday": holidayLine(c.Config, h)})
+		}
+
+	case "remove":
+		if !c.RequireAdmin() {
+			return
+		}
+		if _, err := time.Parse("2006-01-02", rest); err != nil {
+			c.Reply("holidays.usage", nil)
+			return
+		}
+		h, err := RemoveHoliday(c.GuildID, rest)
+		switch {
+		case errors.Is(err, ErrHolidayNotFound):
+			c.Reply("holidays.not_found", Args{"date": rest})
+		case err != nil:
+			log.Printf("Failed to remove holiday: %v", err)
+			c.Reply("holidays.failed", nil)
+		default:
+			c.Reply("holidays.removed", Args{"holiday": holidayLine(c.Config, h)})
+		}
+
+	default:
+		c.Reply("holidays.usage", nil)
+	}
+}
+
+// listHolidays replies with the guild's holidays and this year's public holidays.
+func listHolidays(c *Context) {
+	var holidays []Holiday
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		holidays = g.Holidays
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load holidays: %v", err)
+		c.Reply("holidays.failed", nil)
+		return
+	}
+	country := c.Config.HolidayCountry
+	if len(holidays) == 0 && country == "" {
+		c.Reply("holidays.none", nil)
+		return
+	}
+	var lines []string
+	if len(holidays) > 0 {
+		lines = append(lines, c.T("holidays.header", Args{"count": len(holidays)}))
+		for _, h := range holidays {
+			lines = append(lines, "- "+holidayLine(c.Config, h))
+		}
+	}
+	if country != "" {
+		year := time.Now().In(c.Config.location()).Year()
+		lines = append(lines, c.T("holidays.public_header", Args{"country": country, "year": year}))
+		for _, h := range countryHolidays(country, year) {
+			lines = append(lines, "- "+holidayLine(c.Config, h))
+		}
+	}
+	c.SendQuiet(strings.Join(lines, "\n"))
+}
+
+// holidayLine describes a holiday in !holidays.
+func holidayLine(cfg GuildConfig, h Holiday) string {
+	if h.Yearly {
+		return cfg.T("holidays.line_yearly", Args{"date": h.Date[5:], "name": h.Name})
+	}
+	return cfg.T("holidays.line", Args{"date": h.Date, "name": h.Name})
+}
+
+// handleHolidaysSetting implements `!settings holidays [COUNTRY|off]`.
+func handleHolidaysSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Send(holidaysSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	country := strings.ToUpper(fields[0])
+	if country == "OFF" {
+		country = ""
+	}
+	if _, ok := publicHolidays[country]; (!ok && country != "") || len(fields) != 1 {
+		c.Reply("settings.holidays_invalid", Args{"countries": strings.Join(holidayCountries(), ", ")})
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.HolidayCountry = country
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save holiday country: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.HolidayCountry = country
+	c.Send(holidaysSettingLine(c.Config))
+}
+
+// holidaysSettingLine describes which country's public holidays are observed.
+func holidaysSettingLine(cfg GuildConfig) string {
+	if cfg.HolidayCountry == "" {
+		return cfg.T("settings.holidays_off", nil)
+	}
+	return cfg.T("settings.holidays", Args{"country": cfg.HolidayCountry})
+}
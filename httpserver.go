@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// startHTTPServer serves the HTTP endpoints on HTTP_ADDR, if set.
+func startHTTPServer(s *discordgo.Session) {
+	addr := currentConfig().HTTPAddr
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", handleHealth)
+	registerAPI(mux, s)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Printf("HTTP server listening on %s", addr)
+		if err := server.ListenAndServe(); err != nil {
+			log.Printf("HTTP server stopped: %v", err)
+		}
+	}()
+}
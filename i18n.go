@@ -0,0 +1,162 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultLanguage is used when a guild hasn't chosen a language and for keys
+// missing from another catalog.
+const defaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// Args holds the named placeholder values of a message, e.g. {name}.
+// The "count" argument also selects the plural form.
+type Args map[string]any
+
+// message is a catalog entry. Plain strings have only the "other" form.
+type message map[string]string
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*m = message{"other": s}
+		return nil
+	}
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return err
+	}
+	if _, ok := forms["other"]; !ok {
+		return fmt.Errorf("plural message is missing the \"other\" form")
+	}
+	*m = forms
+	return nil
+}
+
+// pluralRules maps a language to the function selecting the plural form for a count.
+var pluralRules = map[string]func(n int) string{
+	"en": oneOther,
+	"de": oneOther,
+}
+
+// oneOther is the plural rule of languages that only distinguish singular and plural.
+func oneOther(n int) string {
+	if n == 1 || n == -1 {
+		return "one"
+	}
+	return "other"
+}
+
+// Translator formats messages from the embedded per-language catalogs.
+type Translator struct {
+	catalogs map[string]map[string]message
+}
+
+// translator is the bot-wide translator loaded from the embedded catalogs.
+var translator = mustLoadTranslator()
+
+func mustLoadTranslator() *Translator {
+	tr, err := loadTranslator()
+	if err != nil {
+		log.Fatalf("Failed to load message catalogs: %v", err)
+	}
+	return tr
+}
+
+func loadTranslator() (*Translator, error) {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+	tr := &Translator{catalogs: map[string]map[string]message{}}
+	for _, f := range files {
+		data, err := localeFiles.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var catalog map[string]message
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		tr.catalogs[strings.TrimSuffix(f.Name(), ".json")] = catalog
+	}
+	if _, ok := tr.catalogs[defaultLanguage]; !ok {
+		return nil, fmt.Errorf("missing %s catalog", defaultLanguage)
+	}
+	return tr, nil
+}
+
+// Languages returns the available language codes in sorted order.
+func (tr *Translator) Languages() []string {
+	var langs []string
+	for lang := range tr.catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// HasLanguage reports whether a catalog exists for lang.
+func (tr *Translator) HasLanguage(lang string) bool {
+	_, ok := tr.catalogs[lang]
+	return ok
+}
+
+// lookup finds the message for key, falling back to English.
+func (tr *Translator) lookup(lang, key string) (message, string, bool) {
+	if msg, ok := tr.catalogs[lang][key]; ok {
+		return msg, lang, true
+	}
+	msg, ok := tr.catalogs[defaultLanguage][key]
+	return msg, defaultLanguage, ok
+}
+
+// translated formats the message key in lang, reporting false when the
+// catalog of lang doesn't have it.
+func (tr *Translator) translated(lang, key string, args Args) (string, bool) {
+	if _, ok := tr.catalogs[lang][key]; !ok {
+		return "", false
+	}
+	return tr.T(lang, key, args), true
+}
+
+// T formats the message key in lang. Unknown keys are returned as-is so that
+// a missing entry is visible instead of producing an empty reply.
+func (tr *Translator) T(lang, key string, args Args) string {
+	msg, lang, ok := tr.lookup(lang, key)
+	if !ok {
+		log.Printf("Missing message catalog key %q", key)
+		return key
+	}
+	form := "other"
+	if n, ok := args["count"].(int); ok {
+		if rule, ok := pluralRules[lang]; ok {
+			form = rule(n)
+		}
+	}
+	text, ok := msg[form]
+	if !ok {
+		text = msg["other"]
+	}
+	return formatMessage(text, args)
+}
+
+// formatMessage replaces {placeholder} occurrences with their argument values.
+func formatMessage(text string, args Args) string {
+	if len(args) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, len(args)*2)
+	for k, v := range args {
+		pairs = append(pairs, "{"+k+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
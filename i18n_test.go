@@ -0,0 +1,176 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// argumentPattern matches the {argument} placeholders of a message.
+var argumentPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// TestCatalogParity checks that every catalog has the keys of the English
+// one, with the same plural forms and placeholders.
+func TestCatalogParity(t *testing.T) {
+	en := translator.catalogs[defaultLanguage]
+	for lang, catalog := range translator.catalogs {
+		if lang == defaultLanguage {
+			continue
+		}
+		for key, want := range en {
+			got, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s: missing key %q", lang, key)
+				continue
+			}
+			for form, text := range want {
+				translated, ok := got[form]
+				if !ok {
+					t.Errorf("%s: key %q lacks the %q form", lang, key, form)
+					continue
+				}
+				if a, b := placeholders(text), placeholders(translated); !slices.Equal(a, b) {
+					t.Errorf("%s: key %q %s form has placeholders %v, want %v", lang, key, form, b, a)
+				}
+			}
+		}
+		for key := range catalog {
+			if _, ok := en[key]; !ok {
+				t.Errorf("%s: key %q isn't in the %s catalog", lang, key, defaultLanguage)
+			}
+		}
+	}
+}
+
+// placeholders returns the sorted distinct placeholders of a message.
+func placeholders(text string) []string {
+	var names []string
+	for _, m := range argumentPattern.FindAllStringSubmatch(text, -1) {
+		names = append(names, m[1])
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// markupPattern matches the verbs of fmt format strings and the language
+// of code blocks, which aren't text.
+var markupPattern = regexp.MustCompile("%[-+# 0-9.]*[a-zA-Z%]|```\\w*")
+
+// TestNoHardCodedReplies scans the sources for text written into what the
+// bot sends instead of taken from the message catalog: string literals with
+// letters in the content passed to Send, ChannelMessageSend and the Content
+// of messages and interaction responses. Literals assigned to a local
+// variable that is sent count as well. Markdown, emoji and mentions around
+// catalog text are fine.
+func TestNoHardCodedReplies(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := gotoken.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := func(e ast.Expr) {
+			for _, lit := range textLiterals(e, map[*ast.Object]bool{}) {
+				t.Errorf("%s: hard-coded text %s sent to Discord, use the message catalog", fset.Position(lit.Pos()), lit.Value)
+			}
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				sel, ok := n.Fun.(*ast.SelectorExpr)
+				if !ok {
+					break
+				}
+				switch {
+				case sel.Sel.Name == "Send" && len(n.Args) == 1:
+					report(n.Args[0])
+				case sel.Sel.Name == "ChannelMessageSend" && len(n.Args) >= 2:
+					report(n.Args[1])
+				}
+			case *ast.CompositeLit:
+				if !isMessageType(n.Type) {
+					break
+				}
+				for _, elt := range n.Elts {
+					if kv, ok := elt.(*ast.KeyValueExpr); ok {
+						if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Content" {
+							report(kv.Value)
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+// isMessageType reports whether a composite literal's type is one of the
+// discordgo types carrying message content.
+func isMessageType(e ast.Expr) bool {
+	sel, ok := e.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	switch sel.Sel.Name {
+	case "MessageSend", "MessageEdit", "InteractionResponseData", "WebhookParams", "WebhookEdit":
+		return true
+	}
+	return false
+}
+
+// textLiterals returns the string literals containing letters that make up
+// e, following concatenations, fmt.Sprintf and local variables.
+func textLiterals(e ast.Expr, seen map[*ast.Object]bool) []*ast.BasicLit {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind != gotoken.STRING {
+			return nil
+		}
+		s, err := strconv.Unquote(e.Value)
+		if err != nil {
+			return nil
+		}
+		if strings.ContainsFunc(markupPattern.ReplaceAllString(s, ""), unicode.IsLetter) {
+			return []*ast.BasicLit{e}
+		}
+	case *ast.ParenExpr:
+		return textLiterals(e.X, seen)
+	case *ast.BinaryExpr:
+		return append(textLiterals(e.X, seen), textLiterals(e.Y, seen)...)
+	case *ast.CallExpr:
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Sprintf" {
+			var lits []*ast.BasicLit
+			for _, arg := range e.Args {
+				lits = append(lits, textLiterals(arg, seen)...)
+			}
+			return lits
+		}
+	case *ast.Ident:
+		if e.Obj == nil || e.Obj.Kind != ast.Var || seen[e.Obj] {
+			return nil
+		}
+		seen[e.Obj] = true
+		if assign, ok := e.Obj.Decl.(*ast.AssignStmt); ok && len(assign.Lhs) == len(assign.Rhs) {
+			for i, lhs := range assign.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Obj == e.Obj {
+					return textLiterals(assign.Rhs[i], seen)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// icalWindow is how far ahead !export ical looks.
+	icalWindow = 30 * 24 * time.Hour
+	// lunchDuration is the length of the calendar event of an accepted pick.
+	lunchDuration = time.Hour
+	// icalLineLength is the maximum length of a line in octets before it is folded.
+	icalLineLength = 75
+)
+
+// icalDays are the RRULE names of the weekdays, indexed by time.Weekday.
+var icalDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// icalTextEscaper escapes TEXT property values.
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`, "\r", "")
+
+// calendar builds an iCalendar file with folded CRLF-terminated lines.
+type calendar struct {
+	b   strings.Builder
+	loc *time.Location
+	// events is the number of events written.
+	events int
+}
+
+// line writes a content line, folding it at icalLineLength octets.
+func (cal *calendar) line(name, value string) {
+	s := name + ":" + value
+	width := icalLineLength
+	for len(s) > width {
+		cut := width
+		for !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		cal.b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts towards their length.
+		width = icalLineLength - 1
+	}
+	cal.b.WriteString(s + "\r\n")
+}
+
+// text writes a TEXT property.
+func (cal *calendar) text(name, value string) {
+	cal.line(name, icalTextEscaper.Replace(value))
+}
+
+// time writes a DATE-TIME property in the calendar's timezone.
+func (cal *calendar) time(name string, t time.Time) {
+	if cal.loc == time.UTC {
+		cal.line(name, t.UTC().Format("20060102T150405Z"))
+		return
+	}
+	cal.line(name+";TZID="+cal.loc.String(), t.In(cal.loc).Format("20060102T150405"))
+}
+
+// icalOffset formats a UTC offset in seconds as ±HHMM.
+func icalOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+}
+
+// timezone writes a VTIMEZONE describing the calendar's timezone from the
+// zone in effect at from up to the last transition before to.
+func (cal *calendar) timezone(from, to time.Time) {
+	if cal.loc == time.UTC {
+		return
+	}
+	cal.line("BEGIN", "VTIMEZONE")
+	cal.line("TZID", cal.loc.String())
+	t := from.In(cal.loc)
+	for {
+		start, end := t.ZoneBounds()
+		name, offset := t.Zone()
+		previous := offset
+		if start.IsZero() {
+			start = time.Date(1970, 1, 1, 0, 0, 0, 0, cal.loc)
+		} else {
+			_, previous = start.Add(-time.Second).Zone()
+		}
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		cal.line("BEGIN", kind)
+		// The onset is given in the local time of the zone being left.
+		cal.line("DTSTART", start.UTC().Add(time.Duration(previous)*time.Second).Format("20060102T150405"))
+		cal.line("TZOFFSETFROM", icalOffset(previous))
+		cal.line("TZOFFSETTO", icalOffset(offset))
+		cal.line("TZNAME", name)
+		cal.line("END", kind)
+		if end.IsZero() || !end.Before(to) {
+			break
+		}
+		t = end
+	}
+	cal.line("END", "VTIMEZONE")
+}
+
+// event writes a VEVENT. A zero end leaves the event without a duration and
+// an empty rrule makes it a single occurrence.
+func (cal *calendar) event(uid string, stamp, start, end time.Time, rrule, summary, description string) {
+	cal.events++
+	cal.line("BEGIN", "VEVENT")
+	cal.line("UID", uid)
+	cal.line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+	cal.time("DTSTART", start)
+	if !end.IsZero() {
+		cal.time("DTEND", end)
+	}
+	if rrule != "" {
+		cal.line("RRULE", rrule)
+	}
+	cal.text("SUMMARY", summary)
+	if description != "" {
+		cal.text("DESCRIPTION", description)
+	}
+	cal.line("END", "VEVENT")
+}
+
+// scheduleRule returns the RRULE of a schedule, ending at until.
+func scheduleRule(sc Schedule, until time.Time) string {
+	rule := "FREQ=DAILY"
+	if len(sc.Days) > 0 {
+		days := make([]string, len(sc.Days))
+		for i, d := range sc.Days {
+			days[i] = icalDays[d]
+		}
+		rule = "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ",")
+	}
+	return rule + ";UNTIL=" + until.UTC().Format("20060102T150405Z")
+}
+
+// guildCalendar renders a guild's schedules and accepted picks from now
+// until the end of the export window as an iCalendar file. It also returns
+// the number of events.
+func guildCalendar(guildID string, g *GuildData, now time.Time) (string, int) {
+	cfg := g.Config
+	until := now.Add(icalWindow)
+	cal := &calendar{loc: cfg.location()}
+	cal.line("BEGIN", "VCALENDAR")
+	cal.line("VERSION", "2.0")
+	cal.line("PRODID", "-//discord-bot//lunch schedule//EN")
+	cal.line("CALSCALE", "GREGORIAN")
+	cal.timezone(now, until)
+
+	for _, sc := range g.Schedules {
+		start, ok := sc.next(now, cal.loc)
+		if !ok || start.After(until) {
+			continue
+		}
+		uid := fmt.Sprintf("schedule-%s-%s@discord-bot", sc.ID, guildID)
+		summary, end := cfg.T("ical.suggestion", nil), time.Time{}
+		if sc.Kind == schedulePoll {
+			duration := cmp.Or(cfg.PollDuration, pollDuration)
+			if q, err := parseQuery(sc.Filter); err == nil {
+				duration, _ = q.pollOptions(cfg)
+			}
+			summary, end = cfg.T("ical.poll", nil), start.Add(duration)
+		}
+		description := ""
+		if sc.Filter != "" {
+			description = cfg.T("ical.filter", Args{"filter": sc.Filter})
+		}
+		cal.event(uid, now, start, end, scheduleRule(sc, until), summary, description)
+	}
+
+	today := now.In(cal.loc)
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, cal.loc)
+	for _, p := range g.Picks {
+		if !p.accepted() || p.AcceptedAt.Before(today) {
+			continue
+		}
+		uid := fmt.Sprintf("pick-%s@discord-bot", p.MessageID)
+		description := cfg.T("ical.accepted_by", Args{"user": p.AcceptedBy.Name})
+		cal.event(uid, now, p.AcceptedAt, p.AcceptedAt.Add(lunchDuration), "", cfg.T("ical.pick", Args{"name": p.Name}), description)
+	}
+
+	cal.line("END", "VCALENDAR")
+	return cal.b.String(), cal.events
+}
+
+// exportICal uploads the guild's upcoming lunches as an .ics attachment.
+func exportICal(c *Context) {
+	var ics string
+	var events int
+	now := time.Now()
+	err := viewGuild(c.GuildID, func(g *GuildData) error {
+		ics, events = guildCalendar(c.GuildID, g, now)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to export calendar: %v", err)
+		c.Reply("export.failed", nil)
+		return
+	}
+	if events == 0 {
+		c.Reply("export.ical_empty", nil)
+		return
+	}
+	c.SendFile(c.T("export.ical_attached", Args{"count": events, "timezone": c.Config.location().String()}), &discordgo.File{
+		Name:        fmt.Sprintf("lunch-%s.ics", now.UTC().Format("2006-01-02")),
+		ContentType: "text/calendar",
+		Reader:      strings.NewReader(ics),
+	})
+}
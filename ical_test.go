@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// icsProperty is a content line of an iCalendar file.
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icsComponent is a BEGIN/END block of an iCalendar file.
+type icsComponent struct {
+	Name       string
+	Properties []icsProperty
+	Children   []*icsComponent
+}
+
+// get returns the first property with a name.
+func (c *icsComponent) get(name string) (icsProperty, bool) {
+	for _, p := range c.Properties {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return icsProperty{}, false
+}
+
+var (
+	icsNamePattern   = regexp.MustCompile(`^[A-Z0-9-]+$`)
+	icsOffsetPattern = regexp.MustCompile(`^[+-]\d{4}$`)
+)
+
+// parseICS parses an iCalendar file strictly as RFC 5545 describes it:
+// CRLF line ends, lines of at most 75 octets, folding with a leading space,
+// and balanced BEGIN and END lines.
+func parseICS(data string) (*icsComponent, error) {
+	if !strings.HasSuffix(data, "\r\n") {
+		return nil, fmt.Errorf("file doesn't end with CRLF")
+	}
+	var lines []string
+	for n, raw := range strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n") {
+		switch {
+		case strings.ContainsAny(raw, "\r\n"):
+			return nil, fmt.Errorf("line %d: bare CR or LF", n+1)
+		case len(raw) > icalLineLength:
+			return nil, fmt.Errorf("line %d: %d octets", n+1, len(raw))
+		case strings.HasPrefix(raw, " ") || strings.HasPrefix(raw, "\t"):
+			if len(lines) == 0 {
+				return nil, fmt.Errorf("line %d: continuation of nothing", n+1)
+			}
+			lines[len(lines)-1] += raw[1:]
+		default:
+			lines = append(lines, raw)
+		}
+	}
+
+	var stack []*icsComponent
+	var root *icsComponent
+	for n, line := range lines {
+		head, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: no value: %q", n+1, line)
+		}
+		parts := strings.Split(head, ";")
+		p := icsProperty{Name: parts[0], Params: map[string]string{}, Value: value}
+		if !icsNamePattern.MatchString(p.Name) {
+			return nil, fmt.Errorf("line %d: bad name %q", n+1, p.Name)
+		}
+		for _, param := range parts[1:] {
+			k, v, ok := strings.Cut(param, "=")
+			if !ok || !icsNamePattern.MatchString(k) {
+				return nil, fmt.Errorf("line %d: bad parameter %q", n+1, param)
+			}
+			p.Params[k] = v
+		}
+		switch p.Name {
+		case "BEGIN":
+			c := &icsComponent{Name: value}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, c)
+			} else if root != nil {
+				return nil, fmt.Errorf("line %d: second root component", n+1)
+			} else {
+				root = c
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != value {
+				return nil, fmt.Errorf("line %d: unbalanced END:%s", n+1, value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside a component", n+1)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, p)
+		}
+	}
+	if len(stack) > 0 || root == nil {
+		return nil, fmt.Errorf("unterminated or missing component")
+	}
+	return root, nil
+}
+
+// unescapeICSText decodes a TEXT value, rejecting unescaped separators and
+// unknown escapes.
+func unescapeICSText(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ',', ';':
+			return "", fmt.Errorf("unescaped %q in %q", c, s)
+		case '\\':
+			if i+1 == len(s) {
+				return "", fmt.Errorf("trailing backslash in %q", s)
+			}
+			i++
+			switch s[i] {
+			case '\\', ';', ',':
+				b.WriteByte(s[i])
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				return "", fmt.Errorf("unknown escape \\%c in %q", s[i], s)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// icsTime parses a DATE-TIME property, resolving TZID against the
+// calendar's timezones.
+func icsTime(p icsProperty, timezones map[string]bool) (time.Time, error) {
+	if tzid, ok := p.Params["TZID"]; ok {
+		if !timezones[tzid] {
+			return time.Time{}, fmt.Errorf("%s refers to undefined timezone %q", p.Name, tzid)
+		}
+		loc, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.ParseInLocation("20060102T150405", p.Value, loc)
+	}
+	if !strings.HasSuffix(p.Value, "Z") {
+		return time.Time{}, fmt.Errorf("%s is floating: %q", p.Name, p.Value)
+	}
+	return time.Parse("20060102T150405Z", p.Value)
+}
+
+// validateICS checks the calendar's structure and the properties the bot's
+// events need, returning the events.
+func validateICS(t *testing.T, data string) []*icsComponent {
+	t.Helper()
+	cal, err := parseICS(data)
+	if err != nil {
+		t.Fatalf("invalid iCalendar: %v\n%s", err, data)
+	}
+	if cal.Name != "VCALENDAR" {
+		t.Fatalf("root component %s", cal.Name)
+	}
+	if v, _ := cal.get("VERSION"); v.Value != "2.0" {
+		t.Errorf("VERSION = %q", v.Value)
+	}
+	if _, ok := cal.get("PRODID"); !ok {
+		t.Error("no PRODID")
+	}
+	timezones := map[string]bool{}
+	var events []*icsComponent
+	uids := map[string]bool{}
+	for _, c := range cal.Children {
+		switch c.Name {
+		case "VTIMEZONE":
+			id, _ := c.get("TZID")
+			timezones[id.Value] = true
+			if len(c.Children) == 0 {
+				t.Errorf("timezone %s has no observances", id.Value)
+			}
+			for _, o := range c.Children {
+				if o.Name != "STANDARD" && o.Name != "DAYLIGHT" {
+					t.Errorf("timezone %s: component %s", id.Value, o.Name)
+				}
+				start, _ := o.get("DTSTART")
+				if _, err := time.Parse("20060102T150405", start.Value); err != nil {
+					t.Errorf("timezone %s: DTSTART %q", id.Value, start.Value)
+				}
+				for _, name := range []string{"TZOFFSETFROM", "TZOFFSETTO"} {
+					if p, _ := o.get(name); !icsOffsetPattern.MatchString(p.Value) {
+						t.Errorf("timezone %s: %s %q", id.Value, name, p.Value)
+					}
+				}
+			}
+		case "VEVENT":
+			events = append(events, c)
+		default:
+			t.Errorf("unexpected component %s", c.Name)
+		}
+	}
+	for _, e := range events {
+		uid, ok := e.get("UID")
+		if !ok || uids[uid.Value] {
+			t.Errorf("missing or duplicate UID %q", uid.Value)
+		}
+		uids[uid.Value] = true
+		if stamp, ok := e.get("DTSTAMP"); !ok {
+			t.Errorf("%s: no DTSTAMP", uid.Value)
+		} else if _, err := time.Parse("20060102T150405Z", stamp.Value); err != nil {
+			t.Errorf("%s: DTSTAMP %v", uid.Value, err)
+		}
+		startProp, ok := e.get("DTSTART")
+		if !ok {
+			t.Errorf("%s: no DTSTART", uid.Value)
+			continue
+		}
+		start, err := icsTime(startProp, timezones)
+		if err != nil {
+			t.Errorf("%s: %v", uid.Value, err)
+		}
+		if endProp, ok := e.get("DTEND"); ok {
+			if end, err := icsTime(endProp, timezones); err != nil || !end.After(start) {
+				t.Errorf("%s: DTEND %q before DTSTART %q (%v)", uid.Value, endProp.Value, startProp.Value, err)
+			}
+		}
+		if rule, ok := e.get("RRULE"); ok {
+			parts := map[string]string{}
+			for _, part := range strings.Split(rule.Value, ";") {
+				k, v, ok := strings.Cut(part, "=")
+				if !ok {
+					t.Errorf("%s: RRULE part %q", uid.Value, part)
+				}
+				parts[k] = v
+			}
+			if parts["FREQ"] != "DAILY" && parts["FREQ"] != "WEEKLY" {
+				t.Errorf("%s: RRULE FREQ %q", uid.Value, parts["FREQ"])
+			}
+			if _, err := time.Parse("20060102T150405Z", parts["UNTIL"]); err != nil {
+				t.Errorf("%s: RRULE UNTIL %v", uid.Value, err)
+			}
+		}
+		for _, name := range []string{"SUMMARY", "DESCRIPTION"} {
+			if p, ok := e.get(name); ok {
+				if _, err := unescapeICSText(p.Value); err != nil {
+					t.Errorf("%s: %s %v", uid.Value, name, err)
+				}
+			}
+		}
+	}
+	return events
+}
+
+func TestGuildCalendar(t *testing.T) {
+	now := time.Date(2026, 3, 20, 9, 0, 0, 0, time.UTC)
+	name := `Müller's "Bistro", Bar; Grill \ Café ` + strings.Repeat("寿司", 30)
+	for _, tz := range []string{"", "Europe/Berlin", "America/New_York", "Asia/Kolkata"} {
+		t.Run(tz, func(t *testing.T) {
+			g := &GuildData{Config: GuildConfig{Timezone: tz}}
+			g.Schedules = []Schedule{
+				{ID: "1", Kind: scheduleSuggest, Time: "11:30", Days: []time.Weekday{time.Monday, time.Friday}},
+				{ID: "2", Kind: schedulePoll, Time: "11:00", Filter: "#japanese, price:<=$$"},
+			}
+			g.Picks = []Pick{
+				{Name: name, MessageID: "10", AcceptedBy: &Contributor{ID: "1", Name: "Ann; B"}, AcceptedAt: now.Add(3 * time.Hour)},
+				{Name: "Open pick", MessageID: "11"},
+			}
+			ics, n := guildCalendar("300", g, now)
+			events := validateICS(t, ics)
+			if n != 3 || len(events) != 3 {
+				t.Fatalf("%d events reported and %d written, want 3", n, len(events))
+			}
+			summary, _ := events[2].get("SUMMARY")
+			got, err := unescapeICSText(summary.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := g.Config.T("ical.pick", Args{"name": name}); got != want {
+				t.Errorf("SUMMARY = %q, want %q", got, want)
+			}
+			description, _ := events[1].get("DESCRIPTION")
+			if got, _ := unescapeICSText(description.Value); got != g.Config.T("ical.filter", Args{"filter": g.Schedules[1].Filter}) {
+				t.Errorf("DESCRIPTION = %q", got)
+			}
+		})
+	}
+}
+
+func TestParseICSRejectsBrokenFiles(t *testing.T) {
+	for _, data := range []string{
+		"BEGIN:VCALENDAR\nEND:VCALENDAR\n",
+		"BEGIN:VCALENDAR\r\nEND:VEVENT\r\n",
+		"BEGIN:VCALENDAR\r\nSUMMARY:" + strings.Repeat("a", 80) + "\r\nEND:VCALENDAR\r\n",
+		"BEGIN:VCALENDAR\r\n",
+	} {
+		if _, err := parseICS(data); err == nil {
+			t.Errorf("parseICS(%q) succeeded", data)
+		}
+	}
+	if _, err := unescapeICSText(`a,b`); err == nil {
+		t.Error("unescaped comma accepted")
+	}
+}
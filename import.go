@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxImportSize bounds the attachments !import is willing to download.
+const maxImportSize = 1 << 20
+
+// importResult summarizes an import.
+type importResult struct {
+	Added int
+	// Duplicates were already on the list.
+	Duplicates int
+	// Skipped didn't fit under the list size limit.
+	Skipped int
+	// Invalid had names validateName rejects.
+	Invalid int
+	// Cleared were added without the attribute values the registry rejects.
+	Cleared int
+}
+
+// ImportRestaurants adds every name not already on the list, up to the guild's
+// list size limit, in a single write.
+func ImportRestaurants(guildID string, names []string, by Contributor) (importResult, error) {
+	entries := make([]Restaurant, len(names))
+	for i, name := range names {
+		entries[i] = Restaurant{Name: name}
+	}
+	var result importResult
+	err := updateGuild(guildID, func(g *GuildData) error {
+		result = g.importEntries(entries, by)
+		return nil
+	}, syncSave)
+	return result, err
+}
+
+// importEntries adds every entry with a valid name that isn't already on the
+// list, up to the guild's list size limit, giving each a new ID and attributing it to by.
+func (g *GuildData) importEntries(entries []Restaurant, by Contributor) importResult {
+	var result importResult
+	now := time.Now().UTC()
+	limit := g.Config.maxRestaurants()
+	for _, r := range entries {
+		if validateName(r.Name, g.Config.maxNameLength()) != nil {
+			result.Invalid++
+			continue
+		}
+		if g.find(r.Name) >= 0 {
+			result.Duplicates++
+			continue
+		}
+		if g.count() >= limit {
+			result.Skipped++
+			continue
+		}
+		if r.dropInvalidAttributes() {
+			result.Cleared++
+		}
+		r.ID, r.AddedAt, r.AddedBy = g.nextID(), now, &by
+		g.Restaurants = append(g.Restaurants, r)
+		g.audit(auditAdd, r.Name, &by, sourceDiscord)
+		result.Added++
+	}
+	return result
+}
+
+// importSummary follows the done line of an import with what was left out.
+func importSummary(cfg GuildConfig, done string, result importResult) string {
+	lines := []string{done}
+	if result.Duplicates > 0 {
+		lines = append(lines, cfg.T("import.duplicates", Args{"count": result.Duplicates}))
+	}
+	if result.Skipped > 0 {
+		lines = append(lines, cfg.T("import.skipped", Args{"count": result.Skipped, "max": cfg.maxRestaurants()}))
+	}
+	if result.Invalid > 0 {
+		lines = append(lines, cfg.T("import.invalid", Args{"count": result.Invalid, "max": cfg.maxNameLength()}))
+	}
+	if result.Cleared > 0 {
+		lines = append(lines, cfg.T("import.cleared", Args{"count": result.Cleared}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseImportNames reads one name per line, or the first column of a CSV file.
+// Blank lines, comments starting with '#' and a "name" header are ignored.
+func parseImportNames(data []byte, csvFile bool) ([]string, error) {
+	var lines []string
+	if csvFile {
+		r := csv.NewReader(bytes.NewReader(data))
+		r.FieldsPerRecord = -1
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			lines = append(lines, record[0])
+		}
+	} else {
+		lines = strings.Split(string(data), "\n")
+	}
+
+	var names []string
+	for i, line := range lines {
+		name := strings.Trim(strings.TrimSpace(line), "\"")
+		if name == "" || strings.HasPrefix(name, "#") || (i == 0 && strings.EqualFold(name, "name")) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// handleImport implements `!import` with an attached .txt or .csv file, or
+// with one name per line after the command.
+func handleImport(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+
+	var names []string
+	if len(c.Message.Attachments) > 0 {
+		a := c.Message.Attachments[0]
+		data, err := downloadAttachment(c.Ctx, a, maxImportSize)
+		if err != nil {
+			log.Printf("Failed to download import: %v", err)
+			if !c.timedOut(err) {
+				c.Reply("import.download_failed", nil)
+			}
+			return
+		}
+		if names, err = parseImportNames(data, strings.EqualFold(filepath.Ext(a.Filename), ".csv")); err != nil {
+			c.Reply("import.invalid", Args{"error": err})
+			return
+		}
+	} else {
+		names, _ = parseImportNames([]byte(c.Args), false)
+	}
+	if len(names) == 0 {
+		c.Reply("import.usage", nil)
+		return
+	}
+
+	result, err := ImportRestaurants(c.GuildID, names, c.Author())
+	if err != nil {
+		log.Printf("Failed to import restaurants: %v", err)
+		c.Reply("import.failed", nil)
+		return
+	}
+	c.Send(importSummary(c.Config, c.T("import.done", Args{"count": result.Added}), result))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// GetRestaurant looks up a single restaurant by name, tolerating small differences in spelling.
+func GetRestaurant(guildID, name string) (Restaurant, error) {
+	var r Restaurant
+	err := viewGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r = g.Restaurants[i]
+		return nil
+	})
+	return r, err
+}
+
+// handleInfo implements `!info "Name"` and `!info id:xyz`.
+func handleInfo(c *Context) {
+	name, _, ok, failed := c.parseListRef(c.Args)
+	if failed {
+		return
+	}
+	if !ok || name == "" {
+		c.Reply("info.usage", nil)
+		return
+	}
+	r, err := GetRestaurant(c.GuildID, name)
+	if err != nil {
+		log.Printf("Failed to get restaurant: %v", err)
+		c.replyError("info.failed", err, name)
+		return
+	}
+	msg := &discordgo.MessageSend{
+		Content:         strings.Join(restaurantInfo(c.Config, r), "\n"),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}
+	if embed := previewEmbed(r); embed != nil {
+		msg.Embeds = []*discordgo.MessageEmbed{embed}
+	}
+	if _, err := c.SendComplex(msg); err != nil {
+		log.Printf("Failed to send info: %v", err)
+	}
+}
+
+// restaurantInfo renders the detail lines shown by !info.
+func restaurantInfo(cfg GuildConfig, r Restaurant) []string {
+	title := "**" + r.Name + "**"
+	if r.Emoji != "" {
+		title = r.Emoji + " " + title
+	}
+	lines := []string{title}
+	if r.ID != "" {
+		lines = append(lines, cfg.T("info.id", Args{"id": "`" + idPrefix + r.ID + "`"}))
+	}
+	if len(r.Aliases) > 0 {
+		lines = append(lines, cfg.T("info.aliases", Args{"aliases": quoteNames(r.Aliases)}))
+	}
+	if r.IsArchived() {
+		lines = append(lines, archiveLine(cfg, r.Archived))
+	}
+	if r.unavailableOn(localDate(time.Now(), cfg.location())) {
+		lines = append(lines, unavailableLine(cfg, r.Unavailable))
+	}
+	if r.CostExpenses > 0 {
+		lines = append(lines, cfg.T("info.cost", Args{"amount": formatAmount(r.CostCents, cfg.currency()), "count": r.CostExpenses}))
+	}
+	if avg, ok := r.AverageRating(); ok {
+		if cfg.RatingHalfLifeMonths > 0 {
+			decayed, _ := r.Rating(cfg, time.Now())
+			lines = append(lines, cfg.T("info.rating_decayed", Args{"rating": formatRating(decayed), "raw": formatRating(avg), "count": len(r.Ratings)}))
+		} else {
+			lines = append(lines, cfg.T("info.rating", Args{"rating": formatRating(avg), "count": len(r.Ratings)}))
+		}
+	} else {
+		lines = append(lines, cfg.T("info.unrated", nil))
+	}
+	if len(r.Tags) > 0 {
+		lines = append(lines, cfg.T("info.tags", Args{"tags": formatTags(r.Tags)}))
+	}
+	for _, a := range attributeRegistry {
+		if line := a.infoLine(cfg, &r); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, attributionLine(cfg, r))
+	if last := r.LastVisit(); !last.IsZero() {
+		lines = append(lines, cfg.T("info.visits", Args{"count": len(r.Visits), "date": last.Format("2006-01-02")}))
+	} else {
+		lines = append(lines, cfg.T("info.never_visited", nil))
+	}
+	return lines
+}
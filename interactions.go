@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Interaction is the context of a button press or other message component
+// interaction, a submitted form or /edit.
+type Interaction struct {
+	Session *discordgo.Session
+	Event   *discordgo.InteractionCreate
+	// GuildID is the guild the component belongs to, also for components in direct messages.
+	GuildID string
+	// Args are the parts of the custom ID after the handler prefix.
+	Args   []string
+	Config GuildConfig
+}
+
+// componentHandlers maps the prefix of a component's custom ID to its handler.
+// Custom IDs have the form "prefix:arg1:arg2".
+var componentHandlers map[string]func(i *Interaction)
+
+func init() {
+	componentHandlers = map[string]func(i *Interaction){
+		"bulkrm":    handleBulkRemoveComponent,
+		"addsim":    handleAddSimilarComponent,
+		"tagsug":    handleTagSuggestComponent,
+		"discover":  handleDiscoverComponent,
+		"pick":      handlePickComponent,
+		"undo":      handleUndoComponent,
+		"battle":    handleBattleComponent,
+		"remind":    handleRemindComponent,
+		"reserve":   handleReserveComponent,
+		"rate":      handleRateComponent,
+		"wait":      handleWaitComponent,
+		"ballot":    handleBallotComponent,
+		"seed":      handleSeedComponent,
+		"setimport": handleSettingsImportComponent,
+		"forget":    handleForgetComponent,
+		"polladj":   handlePollAdjustComponent,
+		"page":      handlePageComponent,
+		"dedupe":    handleDedupeComponent,
+		"lunch":     handleLunchComponent,
+		"suggest":   handleSuggestComponent,
+		"onboard":   handleOnboardComponent,
+		"edit":      handleEditComponent,
+		"stats":     handleStatsComponent,
+	}
+}
+
+// directComponents are the handlers whose components may be sent in direct
+// messages. Their custom IDs name the guild right after the prefix.
+var directComponents = map[string]bool{"rate": true, "wait": true, "ballot": true}
+
+// HandleInteraction routes message component interactions and submitted
+// forms to their handlers, /lunch to the prefix commands, /edit to the
+// handler of the edit form and /stats to its handler.
+func (h *Handler) HandleInteraction(s *discordgo.Session, ic *discordgo.InteractionCreate) {
+	var customID string
+	switch ic.Type {
+	case discordgo.InteractionApplicationCommand:
+		switch ic.ApplicationCommandData().Name {
+		case slashCommandName:
+			handleSlashCommand(s, ic)
+			return
+		case editCommandName:
+			if ic.GuildID == "" {
+				return
+			}
+			// /edit is answered like the button of !edit.
+			customID = "edit:command"
+		case statsCommandName:
+			if ic.GuildID == "" {
+				return
+			}
+			customID = "stats:command"
+		default:
+			return
+		}
+	case discordgo.InteractionMessageComponent:
+		customID = ic.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		customID = ic.ModalSubmitData().CustomID
+	default:
+		return
+	}
+	parts := strings.Split(customID, ":")
+	run, ok := componentHandlers[parts[0]]
+	if !ok {
+		log.Printf("Unknown component %q", customID)
+		return
+	}
+	guildID := ic.GuildID
+	if guildID == "" {
+		if !directComponents[parts[0]] || len(parts) < 2 {
+			return
+		}
+		guildID = parts[1]
+	}
+
+	cfg, err := GetGuildConfig(guildID)
+	if err != nil {
+		log.Printf("Failed to load config for guild %s: %v", guildID, err)
+	}
+	i := &Interaction{Session: s, Event: ic, GuildID: guildID, Args: parts[1:], Config: cfg.forLocale(ic.Locale)}
+	defer recoverHandler(s, "component "+parts[0], customID, func() { i.Ephemeral("error.internal", nil) })
+	run(i)
+}
+
+// UserID returns the ID of the member who triggered the interaction.
+func (i *Interaction) UserID() string {
+	if i.Event.Member != nil {
+		return i.Event.Member.User.ID
+	}
+	return i.Event.User.ID
+}
+
+// T formats a catalog message in the guild's language, or the user's when
+// the guild hasn't chosen one.
+func (i *Interaction) T(key string, args Args) string {
+	return i.Config.T(key, args)
+}
+
+// Update replaces the content and components of the message the component belongs to.
+func (i *Interaction) Update(content string, components []discordgo.MessageComponent) {
+	if components == nil {
+		components = []discordgo.MessageComponent{}
+	}
+	err := i.Session.InteractionRespond(i.Event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Content: content, Components: components},
+	})
+	if err != nil {
+		log.Printf("Failed to update interaction message: %v", err)
+	}
+}
+
+// Ephemeral answers the interaction with a catalog message only the user can see.
+func (i *Interaction) Ephemeral(key string, args Args) {
+	err := i.Session.InteractionRespond(i.Event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: i.T(key, args), Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+}
+
+// EphemeralComponents answers the interaction with a message and components only the user can see.
+func (i *Interaction) EphemeralComponents(content string, components []discordgo.MessageComponent) {
+	err := i.Session.InteractionRespond(i.Event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Content: content, Components: components, Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+}
+
+// newToken returns a random identifier for pending interactive operations.
+func newToken() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// buttonRow builds an action row from buttons.
+func buttonRow(buttons ...discordgo.Button) discordgo.ActionsRow {
+	row := discordgo.ActionsRow{}
+	for _, b := range buttons {
+		row.Components = append(row.Components, b)
+	}
+	return row
+}
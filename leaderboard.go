@@ -0,0 +1,209 @@
+package main
+
+import (
+	"cmp"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Points awarded for each kind of contribution.
+const (
+	pointsVisitedAdd = 3
+	pointsRating     = 1
+	pointsVisit      = 1
+)
+
+// maxLeaderboard is the number of members shown by !leaderboard.
+const maxLeaderboard = 10
+
+// score is a member's points and what they were earned for.
+type score struct {
+	UserID string
+	// VisitedAdds are the restaurants the member added that were visited since.
+	VisitedAdds int
+	Ratings     int
+	Visits      int
+}
+
+// Points returns the member's total points.
+func (s score) Points() int {
+	return s.VisitedAdds*pointsVisitedAdd + s.Ratings*pointsRating + s.Visits*pointsVisit
+}
+
+// scores computes the points earned between start and end from the list
+// itself, so that corrections to the data correct the scores too. A zero
+// start and end cover all time. Adds score once the restaurant's first visit
+// after being added happens; ratings from before their time was recorded only
+// count for all time. Deleted entries and members who opted out are left out.
+func (g *GuildData) scores(start, end time.Time) []score {
+	allTime := start.IsZero() && end.IsZero()
+	within := func(t time.Time) bool {
+		return allTime || (!t.IsZero() && !t.Before(start) && t.Before(end))
+	}
+	byID := map[string]*score{}
+	get := func(id string) *score {
+		if byID[id] == nil {
+			byID[id] = &score{UserID: id}
+		}
+		return byID[id]
+	}
+
+	for _, r := range g.Restaurants {
+		if r.Deleted() {
+			continue
+		}
+		var firstVisit time.Time
+		for _, v := range r.Visits {
+			if !v.Date.Before(r.AddedAt) && (firstVisit.IsZero() || v.Date.Before(firstVisit)) {
+				firstVisit = v.Date
+			}
+			if v.RecordedBy != "" && within(v.Date) {
+				get(v.RecordedBy).Visits++
+			}
+		}
+		if r.AddedBy != nil && !firstVisit.IsZero() && within(firstVisit) {
+			get(r.AddedBy.ID).VisitedAdds++
+		}
+		for id := range r.Ratings {
+			if within(r.RatedAt[id]) {
+				get(id).Ratings++
+			}
+		}
+	}
+
+	var list []score
+	for id, s := range byID {
+		if !g.Members[id].NoLeaderboard && id != "" {
+			list = append(list, *s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Points() != list[j].Points() {
+			return list[i].Points() > list[j].Points()
+		}
+		return list[i].UserID < list[j].UserID
+	})
+	return list
+}
+
+// handleLeaderboard implements `!leaderboard [month [YYYY-MM]]`, ranking
+// members by points for all time or for a month.
+func handleLeaderboard(c *Context) {
+	fields := strings.Fields(c.Args)
+	var start, end time.Time
+	period := c.T("leaderboard.all_time", nil)
+	switch {
+	case len(fields) == 0 || (len(fields) == 1 && strings.EqualFold(fields[0], "all")):
+	case strings.EqualFold(fields[0], "month") && len(fields) <= 2:
+		loc := c.Config.location()
+		month := time.Now().In(loc)
+		if len(fields) == 2 {
+			var err error
+			if month, err = time.ParseInLocation("2006-01", fields[1], loc); err != nil {
+				c.Reply("leaderboard.usage", nil)
+				return
+			}
+		}
+		start, end = monthRange(month)
+		period = start.Format("2006-01")
+	default:
+		c.Reply("leaderboard.usage", nil)
+		return
+	}
+
+	var list []score
+	names := map[string]string{}
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		list = g.scores(start, end)
+		for _, r := range g.Restaurants {
+			if r.AddedBy != nil {
+				names[r.AddedBy.ID] = r.AddedBy.Name
+			}
+		}
+		return nil
+	}); err != nil {
+		log.Printf("Failed to compute leaderboard: %v", err)
+		c.Reply("leaderboard.failed", nil)
+		return
+	}
+	if len(list) == 0 {
+		c.Reply("leaderboard.empty", Args{"period": period})
+		return
+	}
+
+	lines := []string{c.T("leaderboard.header", Args{"period": period})}
+	for i, s := range list[:min(len(list), maxLeaderboard)] {
+		name, ok := names[s.UserID]
+		if !ok && c.Config.attributionStyle() == attributionName {
+			name = s.UserID
+			if m, err := c.Session.GuildMember(c.GuildID, s.UserID); err == nil {
+				name = cmp.Or(m.Nick, m.User.GlobalName, m.User.Username)
+			}
+		}
+		lines = append(lines, c.T("leaderboard.line", Args{
+			"rank":    i + 1,
+			"by":      formatContributor(c.Config, &Contributor{ID: s.UserID, Name: name}),
+			"count":   s.Points(),
+			"adds":    s.VisitedAdds,
+			"ratings": s.Ratings,
+			"visits":  s.Visits,
+		}))
+	}
+	lines = append(lines, c.T("leaderboard.footer", nil))
+	c.SendQuiet(strings.Join(lines, "\n"))
+}
+
+// SetLeaderboard opts a member in or out of appearing on the leaderboard.
+func SetLeaderboard(guildID, userID string, show bool) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		g.updateMember(userID, func(m *MemberSettings) { m.NoLeaderboard = !show })
+		return nil
+	})
+}
+
+// handleMeLeaderboardSetting implements `!settings me leaderboard [on|off]`.
+func handleMeLeaderboardSetting(c *Context, fields []string) {
+	userID := c.Message.Author.ID
+	if len(fields) == 0 {
+		var hidden bool
+		if err := viewGuild(c.GuildID, func(g *GuildData) error {
+			hidden = g.Members[userID].NoLeaderboard
+			return nil
+		}); err != nil {
+			log.Printf("Failed to load member settings: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		if hidden {
+			c.Reply("settings.me_leaderboard_off", nil)
+		} else {
+			c.Reply("settings.me_leaderboard_on", nil)
+		}
+		return
+	}
+	var show bool
+	switch strings.ToLower(fields[0]) {
+	case "on":
+		show = true
+	case "off":
+	default:
+		c.Reply("settings.me_usage", Args{"flags": strings.Join(dietFlags, ", ")})
+		return
+	}
+	if len(fields) != 1 {
+		c.Reply("settings.me_usage", Args{"flags": strings.Join(dietFlags, ", ")})
+		return
+	}
+	if err := SetLeaderboard(c.GuildID, userID, show); err != nil {
+		log.Printf("Failed to save leaderboard preference: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	if show {
+		c.Reply("settings.me_leaderboard_on", nil)
+	} else {
+		c.Reply("settings.me_leaderboard_off", nil)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listRefTimeout is how long the numbers of a !list keep referring to its entries.
+const listRefTimeout = 15 * time.Minute
+
+// errListChanged is returned when entries were added or removed since a list was shown.
+var errListChanged = errors.New("list changed")
+
+// shownList is the order of the entries of the last !list in a channel.
+type shownList struct {
+	guildID string
+	ids     []string
+	// version fingerprints the guild's entries when the list was shown, so
+	// that the numbers stop working once entries are added or removed.
+	version uint64
+	at      time.Time
+}
+
+var (
+	// shownLists stores the last !list of each channel, keyed by channel ID.
+	shownLists      = make(map[string]shownList)
+	shownListsMutex sync.Mutex
+)
+
+// listVersion fingerprints which entries a guild has and which are archived
+// or removed.
+func listVersion(g *GuildData) uint64 {
+	h := fnv.New64a()
+	for _, r := range g.Restaurants {
+		h.Write([]byte(r.ID))
+		if r.IsArchived() {
+			h.Write([]byte{'a'})
+		}
+		if r.Deleted() {
+			h.Write([]byte{'d'})
+		}
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// rememberList stores the entries a !list showed in a channel, in order.
+func rememberList(guildID, channelID string, restaurants []Restaurant, now time.Time) {
+	var version uint64
+	if err := viewGuild(guildID, func(g *GuildData) error {
+		version = listVersion(g)
+		return nil
+	}); err != nil {
+		log.Printf("Failed to remember list: %v", err)
+		return
+	}
+	ids := make([]string, len(restaurants))
+	for i, r := range restaurants {
+		ids[i] = r.ID
+	}
+	shownListsMutex.Lock()
+	defer shownListsMutex.Unlock()
+	for id, l := range shownLists {
+		if now.Sub(l.at) > listRefTimeout {
+			delete(shownLists, id)
+		}
+	}
+	shownLists[channelID] = shownList{guildID: guildID, ids: ids, version: version, at: now}
+}
+
+// parseListRef is parseRef also accepting the number of an entry in the
+// channel's last !list, announcing which entry the number stands for. When
+// the number doesn't refer to an entry it explains why and reports failed.
+func (c *Context) parseListRef(args string) (ref, rest string, ok, failed bool) {
+	word, rest, _ := strings.Cut(args, " ")
+	n, err := strconv.Atoi(word)
+	if err != nil {
+		ref, rest, ok = parseRef(args)
+		return ref, rest, ok, false
+	}
+
+	shownListsMutex.Lock()
+	l, shown := shownLists[c.Message.ChannelID]
+	shownListsMutex.Unlock()
+	if !shown || l.guildID != c.GuildID || time.Since(l.at) > listRefTimeout {
+		c.Reply("listref.no_list", nil)
+		return "", "", false, true
+	}
+	if n < 1 || n > len(l.ids) {
+		c.Reply("listref.out_of_range", Args{"number": n, "count": len(l.ids)})
+		return "", "", false, true
+	}
+	var name string
+	err = viewGuild(c.GuildID, func(g *GuildData) error {
+		if listVersion(g) != l.version {
+			return errListChanged
+		}
+		i := g.findID(l.ids[n-1])
+		if i < 0 {
+			return errListChanged
+		}
+		name = g.Restaurants[i].Name
+		return nil
+	})
+	switch {
+	case errors.Is(err, errListChanged):
+		c.Reply("listref.changed", nil)
+		return "", "", false, true
+	case err != nil:
+		log.Printf("Failed to resolve list number: %v", err)
+		c.Reply("list.failed", nil)
+		return "", "", false, true
+	}
+	c.SendQuiet(c.T("listref.resolved", Args{"number": n, "name": name}))
+	return idPrefix + l.ids[n-1], strings.TrimSpace(rest), true, false
+}
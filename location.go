@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusKm is the mean radius of the Earth used for distances.
+const earthRadiusKm = 6371.0
+
+// Location is a point given by latitude and longitude in degrees.
+type Location struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// parseLocation parses "lat,lon" in decimal degrees.
+func parseLocation(s string) (*Location, bool) {
+	latText, lonText, ok := strings.Cut(s, ",")
+	if !ok {
+		return nil, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonText), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return nil, false
+	}
+	return &Location{Lat: lat, Lon: lon}, true
+}
+
+// String renders the location the way parseLocation accepts it.
+func (l Location) String() string {
+	return fmt.Sprintf("%.5f,%.5f", l.Lat, l.Lon)
+}
+
+// DistanceKm returns the great-circle distance to another location.
+func (l Location) DistanceKm(other Location) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat, dLon := rad(other.Lat-l.Lat), rad(other.Lon-l.Lon)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(l.Lat))*math.Cos(rad(other.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// handleOfficeSetting implements `!settings office [lat,lon|off]`.
+func handleOfficeSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		if c.Config.Office == nil {
+			c.Reply("settings.office_none", nil)
+			return
+		}
+		c.Reply("settings.office", Args{"value": c.Config.Office.String()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+
+	var office *Location
+	if !strings.EqualFold(fields[0], "off") {
+		var ok bool
+		if office, ok = parseLocation(strings.Join(fields, "")); !ok {
+			c.Reply("settings.office_invalid", nil)
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.Office = office
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save office location: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	if office == nil {
+		c.Reply("settings.office_cleared", nil)
+		return
+	}
+	c.Reply("settings.office_set", Args{"value": office.String()})
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// rollCallWindow is how long members can join a lunch before its poll starts.
+	rollCallWindow = 10 * time.Minute
+	// lunchPollGrace is how long a lunch may wait for its poll to be posted
+	// before it is given up on.
+	lunchPollGrace = 5 * time.Minute
+)
+
+// Stages of a !lunch flow.
+const (
+	lunchRollCall = "rollcall"
+	lunchVoting   = "poll"
+	lunchDecided  = "decided"
+)
+
+var (
+	// ErrLunchActive is returned when starting a lunch in a channel that already has one.
+	ErrLunchActive = errors.New("lunch already being organized")
+	// ErrLunchNotFound is returned when a lunch is over or in another stage.
+	ErrLunchNotFound = errors.New("lunch not found")
+)
+
+// LunchFlow is a lunch organized with !lunch, going from a roll call to a
+// poll among the members who joined and then to recording their visit.
+type LunchFlow struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	// OrganizerID is empty once the organizer has been forgotten.
+	OrganizerID string `json:"organizer_id"`
+	// MessageID is the message showing the stage with its buttons.
+	MessageID string `json:"message_id"`
+	// Filter is the filter expression candidates are drawn with, if any.
+	Filter       string   `json:"filter,omitempty"`
+	Stage        string   `json:"stage"`
+	Participants []string `json:"participants"`
+	// Until is when the stage ends: the end of the roll call, the latest the
+	// poll is posted by, or when the We went button stops working.
+	Until time.Time `json:"until"`
+	// Winner is the restaurant chosen by the poll.
+	Winner string `json:"winner,omitempty"`
+}
+
+// lunchFlow returns the index of the lunch with the given ID, or -1.
+func (g *GuildData) lunchFlow(id string) int {
+	return slices.IndexFunc(g.LunchFlows, func(f LunchFlow) bool { return f.ID == id })
+}
+
+// StartLunch saves a new lunch, unless its channel already has one.
+func StartLunch(guildID string, f LunchFlow) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		if slices.ContainsFunc(g.LunchFlows, func(old LunchFlow) bool { return old.ChannelID == f.ChannelID }) {
+			return ErrLunchActive
+		}
+		g.LunchFlows = append(g.LunchFlows, f)
+		return nil
+	})
+}
+
+// updateLunch calls fn with the lunch with the given ID, if it is in stage,
+// and returns the lunch as fn left it.
+func updateLunch(guildID, id, stage string, fn func(f *LunchFlow) error) (LunchFlow, error) {
+	var updated LunchFlow
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i := g.lunchFlow(id)
+		if i < 0 || g.LunchFlows[i].Stage != stage {
+			return ErrLunchNotFound
+		}
+		if err := fn(&g.LunchFlows[i]); err != nil {
+			return err
+		}
+		updated = g.LunchFlows[i]
+		return nil
+	})
+	return updated, err
+}
+
+// EndLunch removes a lunch and the poll it may have open, returning the lunch.
+func EndLunch(guildID, id string) (LunchFlow, error) {
+	var ended LunchFlow
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i := g.lunchFlow(id)
+		if i < 0 {
+			return ErrLunchNotFound
+		}
+		ended = g.LunchFlows[i]
+		g.LunchFlows = slices.Delete(g.LunchFlows, i, i+1)
+		g.Polls = slices.DeleteFunc(g.Polls, func(p Poll) bool { return p.Flow == id })
+		return nil
+	})
+	return ended, err
+}
+
+// RecordLunch ends a decided lunch and records the visit to its restaurant
+// for everyone who joined and the member recording it.
+func RecordLunch(guildID, id, recordedBy string, now time.Time) (LunchFlow, int, error) {
+	var ended LunchFlow
+	var attendees int
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i := g.lunchFlow(id)
+		if i < 0 || g.LunchFlows[i].Stage != lunchDecided {
+			return ErrLunchNotFound
+		}
+		ended = g.LunchFlows[i]
+		r, err := g.lookup(ended.Winner)
+		if err != nil {
+			return err
+		}
+		people := append(slices.Clone(ended.Participants), recordedBy)
+		visit := Visit{Date: now.UTC(), Attendees: g.tracked(people), RecordedBy: recordedBy}
+		g.Restaurants[r].Visits = append(g.Restaurants[r].Visits, visit)
+		g.promptRating(&g.Restaurants[r], visit, ended.ChannelID)
+		ended.Winner = g.Restaurants[r].Name
+		attendees = len(visit.Attendees)
+		g.LunchFlows = slices.Delete(g.LunchFlows, i, i+1)
+		return nil
+	})
+	return ended, attendees, err
+}
+
+// handleLunch implements `!lunch [filter]`, which runs a roll call, a poll
+// among the restaurants suiting everyone who joined and records the visit.
+func handleLunch(c *Context) {
+	query, ok := parsePickQuery(c)
+	if !ok {
+		return
+	}
+	f := LunchFlow{
+		ID: newToken(), ChannelID: c.Message.ChannelID, OrganizerID: c.Message.Author.ID,
+		Filter: query.Input, Stage: lunchRollCall, Participants: []string{c.Message.Author.ID},
+		Until: time.Now().UTC().Add(rollCallWindow),
+	}
+	err := StartLunch(c.GuildID, f)
+	switch {
+	case errors.Is(err, ErrLunchActive):
+		c.Reply("lunch.active", nil)
+		return
+	case err != nil:
+		log.Printf("Failed to start lunch: %v", err)
+		c.Reply("lunch.failed", nil)
+		return
+	}
+
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content:         lunchContent(c.Config, f),
+		Components:      lunchButtons(c.Config, f),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err == nil {
+		_, err = updateLunch(c.GuildID, f.ID, lunchRollCall, func(f *LunchFlow) error {
+			f.MessageID = msg.ID
+			return nil
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to post lunch roll call: %v", err)
+		if _, err := EndLunch(c.GuildID, f.ID); err != nil {
+			log.Printf("Failed to end lunch: %v", err)
+		}
+		c.Reply("lunch.failed", nil)
+	}
+}
+
+// mentionList mentions the given members.
+func mentionList(ids []string) string {
+	mentions := make([]string, len(ids))
+	for i, id := range ids {
+		mentions[i] = "<@" + id + ">"
+	}
+	return strings.Join(mentions, ", ")
+}
+
+// lunchContent describes the stage of a lunch.
+func lunchContent(cfg GuildConfig, f LunchFlow) string {
+	var lines []string
+	switch f.Stage {
+	case lunchRollCall:
+		organizer := cfg.T("attribution.deleted", nil)
+		if f.OrganizerID != "" {
+			organizer = "<@" + f.OrganizerID + ">"
+		}
+		lines = append(lines, cfg.T("lunch.rollcall", Args{"user": organizer, "time": fmt.Sprintf("<t:%d:R>", f.Until.Unix())}))
+	case lunchVoting:
+		lines = append(lines, cfg.T("lunch.voting", nil))
+	case lunchDecided:
+		lines = append(lines, cfg.T("lunch.decided", Args{"name": f.Winner}))
+	}
+	lines = append(lines, cfg.T("lunch.participants", Args{"count": len(f.Participants), "users": mentionList(f.Participants)}))
+	return strings.Join(lines, "\n")
+}
+
+// lunchButtons builds the buttons of a lunch's stage. The ones skipping the
+// stage and canceling are for the organizer.
+func lunchButtons(cfg GuildConfig, f LunchFlow) []discordgo.MessageComponent {
+	id := func(action string) string { return "lunch:" + f.ID + ":" + action }
+	cancel := discordgo.Button{Label: cfg.T("button.cancel", nil), Style: discordgo.DangerButton, CustomID: id("cancel")}
+	switch f.Stage {
+	case lunchRollCall:
+		return []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: cfg.T("button.join", nil), Style: discordgo.SuccessButton, CustomID: id("join")},
+			discordgo.Button{Label: cfg.T("button.leave", nil), Style: discordgo.SecondaryButton, CustomID: id("leave")},
+			discordgo.Button{Label: cfg.T("button.start_poll", nil), Style: discordgo.PrimaryButton, CustomID: id("skip")},
+			cancel,
+		)}
+	case lunchVoting:
+		return []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: cfg.T("button.close_poll", nil), Style: discordgo.PrimaryButton, CustomID: id("skip")},
+			cancel,
+		)}
+	case lunchDecided:
+		return []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: cfg.T("button.we_went", nil), Style: discordgo.SuccessButton, CustomID: id("went")},
+			cancel,
+		)}
+	}
+	return nil
+}
+
+// editLunchMessage replaces the message of a lunch, without buttons when
+// components is nil.
+func editLunchMessage(s *discordgo.Session, f LunchFlow, content string, components []discordgo.MessageComponent) {
+	if f.MessageID == "" {
+		return
+	}
+	if components == nil {
+		components = []discordgo.MessageComponent{}
+	}
+	if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID: f.MessageID, Channel: f.ChannelID, Content: &content, Components: &components,
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}); err != nil {
+		log.Printf("Failed to update lunch message: %v", err)
+	}
+}
+
+// endLunchWith ends a lunch, replacing its message with a catalog message.
+func endLunchWith(s *discordgo.Session, guildID string, cfg GuildConfig, id, key string, args Args) {
+	f, err := EndLunch(guildID, id)
+	if err != nil {
+		if !errors.Is(err, ErrLunchNotFound) {
+			log.Printf("Failed to end lunch: %v", err)
+		}
+		return
+	}
+	editLunchMessage(s, f, cfg.T(key, args), nil)
+}
+
+// openLunchPoll moves a lunch from its roll call to a poll among the
+// restaurants suiting everyone who joined.
+func openLunchPoll(s *discordgo.Session, guildID string, cfg GuildConfig, id string, now time.Time) {
+	f, err := updateLunch(guildID, id, lunchRollCall, func(f *LunchFlow) error {
+		f.Stage, f.Until = lunchVoting, now.UTC().Add(lunchPollGrace)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrLunchNotFound) {
+			log.Printf("Failed to start lunch poll: %v", err)
+		}
+		return
+	}
+	editLunchMessage(s, f, lunchContent(cfg, f), lunchButtons(cfg, f))
+
+	query, ferr := parseQuery(f.Filter)
+	if ferr != nil {
+		log.Printf("Failed to parse lunch filter %q: %v", f.Filter, ferr)
+		endLunchWith(s, guildID, cfg, id, "lunch.failed", nil)
+		return
+	}
+	query.require(cfg)
+	query.Members, query.Flow = f.Participants, f.ID
+	today := localDate(now, cfg.location())
+	var restaurants []Restaurant
+	if err := viewGuild(guildID, func(g *GuildData) error {
+		query.Needs = groupNeeds(g.Members, f.Participants, today)
+		restaurants = g.active()
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load restaurants for lunch: %v", err)
+		endLunchWith(s, guildID, cfg, id, "lunch.failed", nil)
+		return
+	}
+	candidates := pollCandidates(restaurants, query, now)
+	if len(candidates) < 2 {
+		endLunchWith(s, guildID, cfg, id, "lunch.too_few", Args{"count": len(candidates)})
+		return
+	}
+	if err := postPoll(s, guildID, f.ChannelID, cfg, candidates, query, now); err != nil {
+		log.Printf("Failed to post lunch poll: %v", err)
+		endLunchWith(s, guildID, cfg, id, "lunch.failed", nil)
+	}
+}
+
+// lunchPollClosed moves the lunch a poll belongs to on to recording the
+// visit to its winner, breaking ties at random. A poll without a winner ends
+// the lunch.
+func lunchPollClosed(s *discordgo.Session, guildID string, cfg GuildConfig, poll Poll, winners []string, now time.Time) {
+	if poll.Flow == "" {
+		return
+	}
+	if len(winners) == 0 {
+		endLunchWith(s, guildID, cfg, poll.Flow, "lunch.no_winner", nil)
+		return
+	}
+	winner := winners[rand.IntN(len(winners))]
+	f, err := updateLunch(guildID, poll.Flow, lunchVoting, func(f *LunchFlow) error {
+		f.Stage, f.Winner, f.Until = lunchDecided, winner, now.UTC().Add(pickAcceptWindow)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrLunchNotFound) {
+			log.Printf("Failed to decide lunch: %v", err)
+		}
+		return
+	}
+	if len(winners) > 1 {
+		// A single winner was already followed up on with the poll's result.
+		if _, err := s.ChannelMessageSend(f.ChannelID, cfg.T("lunch.tiebreak", Args{"name": winner})); err != nil {
+			log.Printf("Failed to announce lunch tiebreak: %v", err)
+		}
+		followUpReservation(s, guildID, f.ChannelID, cfg, winner)
+		noteDecision(s, guildID, f.ChannelID, cfg, winner, decisionPoll)
+	}
+	editLunchMessage(s, f, lunchContent(cfg, f), lunchButtons(cfg, f))
+}
+
+// advanceLunches ends roll calls whose time is up, gives up on lunches whose
+// poll went missing and expires the We went button of decided lunches.
+func advanceLunches(s *discordgo.Session, now time.Time) {
+	type dueLunch struct {
+		guildID string
+		cfg     GuildConfig
+		flow    LunchFlow
+	}
+	var due []dueLunch
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		for _, f := range g.LunchFlows {
+			if now.Before(f.Until) {
+				continue
+			}
+			if f.Stage == lunchVoting && slices.ContainsFunc(g.Polls, func(p Poll) bool { return p.Flow == f.ID }) {
+				continue
+			}
+			due = append(due, dueLunch{guildID, g.Config, f})
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check lunches: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		switch d.flow.Stage {
+		case lunchRollCall:
+			openLunchPoll(s, d.guildID, d.cfg, d.flow.ID, now)
+		case lunchVoting:
+			endLunchWith(s, d.guildID, d.cfg, d.flow.ID, "lunch.failed", nil)
+		case lunchDecided:
+			endLunchWith(s, d.guildID, d.cfg, d.flow.ID, "lunch.expired", Args{"name": d.flow.Winner})
+		}
+	}
+}
+
+// handleLunchComponent handles the buttons of a lunch.
+func handleLunchComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	id, action := i.Args[0], i.Args[1]
+	userID := i.UserID()
+	var f LunchFlow
+	if err := viewGuild(i.GuildID, func(g *GuildData) error {
+		idx := g.lunchFlow(id)
+		if idx < 0 {
+			return ErrLunchNotFound
+		}
+		f = g.LunchFlows[idx]
+		return nil
+	}); err != nil {
+		if !errors.Is(err, ErrLunchNotFound) {
+			log.Printf("Failed to load lunch: %v", err)
+		}
+		i.Ephemeral("lunch.over", nil)
+		return
+	}
+	if (action == "skip" || action == "cancel") && userID != f.OrganizerID {
+		i.Ephemeral("lunch.not_organizer", nil)
+		return
+	}
+
+	switch action {
+	case "join", "leave":
+		f, err := updateLunch(i.GuildID, id, lunchRollCall, func(f *LunchFlow) error {
+			joined := slices.Contains(f.Participants, userID)
+			switch {
+			case action == "join" && !joined:
+				f.Participants = append(f.Participants, userID)
+			case action == "leave" && joined:
+				f.Participants = slices.DeleteFunc(f.Participants, func(p string) bool { return p == userID })
+			default:
+				return errNoChange
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, errNoChange):
+			i.Ephemeral("lunch.unchanged", nil)
+		case errors.Is(err, ErrLunchNotFound):
+			i.Ephemeral("lunch.rollcall_over", nil)
+		case err != nil:
+			log.Printf("Failed to update lunch: %v", err)
+			i.Ephemeral("lunch.failed", nil)
+		default:
+			i.Update(lunchContent(i.Config, f), lunchButtons(i.Config, f))
+		}
+
+	case "skip":
+		switch f.Stage {
+		case lunchRollCall:
+			i.Ephemeral("lunch.starting", nil)
+			openLunchPoll(i.Session, i.GuildID, i.Config, id, time.Now())
+		case lunchVoting:
+			if err := updateGuild(i.GuildID, func(g *GuildData) error {
+				for p := range g.Polls {
+					if g.Polls[p].Flow == id {
+						// The scheduler closes it on its next run.
+						g.Polls[p].ClosesAt = time.Now().UTC()
+					}
+				}
+				return nil
+			}); err != nil {
+				log.Printf("Failed to close lunch poll: %v", err)
+				i.Ephemeral("lunch.failed", nil)
+				return
+			}
+			i.Ephemeral("lunch.closing", nil)
+		default:
+			i.Ephemeral("lunch.over", nil)
+		}
+
+	case "went":
+		ended, attendees, err := RecordLunch(i.GuildID, id, userID, time.Now())
+		switch {
+		case errors.Is(err, ErrLunchNotFound):
+			i.Ephemeral("lunch.over", nil)
+		case errors.Is(err, ErrRestaurantNotFound):
+			i.Ephemeral("lunch.gone", Args{"name": f.Winner})
+		case err != nil:
+			log.Printf("Failed to record lunch: %v", err)
+			i.Ephemeral("lunch.failed", nil)
+		default:
+			i.Update(i.T("lunch.done", Args{"name": ended.Winner, "count": attendees}), nil)
+		}
+
+	case "cancel":
+		if _, err := EndLunch(i.GuildID, id); err != nil {
+			if !errors.Is(err, ErrLunchNotFound) {
+				log.Printf("Failed to cancel lunch: %v", err)
+			}
+			i.Ephemeral("lunch.over", nil)
+			return
+		}
+		i.Update(i.T("lunch.canceled", Args{"user": "<@" + userID + ">"}), nil)
+	}
+}
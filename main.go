@@ -1,30 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strings"
-	"sync"
 	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/bwmarrin/discordgo"
-	"github.com/joho/godotenv"
-)
-
-// PendingConfirmation holds the state for a pending user confirmation.
-type PendingConfirmation struct {
-	NewName     string
-	MatchedName string
-}
-
-var (
-	// pendingConfirmations stores pending duplicate confirmations, keyed by channel ID.
-	pendingConfirmations      = make(map[string]PendingConfirmation)
-	pendingConfirmationsMutex sync.Mutex
 )
 
 // Handler is now an empty struct as it doesn't need to hold a database connection.
@@ -32,128 +22,26 @@ type Handler struct{}
 
 // HandleMessage is a method of the Handler struct that handles incoming messages.
 func (h *Handler) HandleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
-	if m.Author.ID == s.State.User.ID {
-		return
-	}
-
-	// Check for a pending confirmation first.
-	pendingConfirmationsMutex.Lock()
-	if confirmation, ok := pendingConfirmations[m.ChannelID]; ok {
-		switch strings.ToLower(m.Content) {
-		case "!yes":
-			delete(pendingConfirmations, m.ChannelID)
-			pendingConfirmationsMutex.Unlock()
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Okay, I will not add '%s'.", confirmation.NewName))
-			return
-		case "!no":
-			delete(pendingConfirmations, m.ChannelID)
-			pendingConfirmationsMutex.Unlock()
-			count, err := ForceAddRestaurant(confirmation.NewName)
-			if err != nil {
-				log.Printf("Failed to force-add restaurant: %v", err)
-				s.ChannelMessageSend(m.ChannelID, "Something went wrong while adding the restaurant.")
-			} else {
-				s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Okay, I've added '%s'. Total count: %d.", confirmation.NewName, count))
-			}
-			return
-		default:
-			s.ChannelMessageSend(m.ChannelID, "Please respond with `!yes` or `!no`.")
-			pendingConfirmationsMutex.Unlock()
-			return
-		}
-	}
-	pendingConfirmationsMutex.Unlock()
-
-
-	if m.Content == "!ping" {
-		s.ChannelMessageSend(m.ChannelID, "Pong!")
-		return
-	}
-
-	if m.Content == "!list" {
-		restaurants, err := GetAllRestaurants()
-		if err != nil {
-			log.Printf("Failed to get restaurants: %v", err)
-			s.ChannelMessageSend(m.ChannelID, "Failed to get restaurants.")
-			return
-		}
-
-		if len(restaurants) == 0 {
-			s.ChannelMessageSend(m.ChannelID, "No restaurants found.")
-			return
-		}
-
-		s.ChannelMessageSend(m.ChannelID, "Restaurants:\n- "+strings.Join(restaurants, "\n- "))
-		return
-	}
-
-	if m.Content == "!ml" {
-		err := HealthCheckMLAPI()
-		if err != nil {
-			log.Printf("ML API health check failed: %v", err)
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("ML API health check failed: %v", err))
-		} else {
-			s.ChannelMessageSend(m.ChannelID, "Milinda, present!")
-		}
-		return
-	}
-
-	if strings.HasPrefix(m.Content, "!remove \"") && strings.HasSuffix(m.Content, "\"") {
-		restaurantName := strings.TrimSuffix(strings.TrimPrefix(m.Content, "!remove \""), "\"")
-		if restaurantName == "" {
-			s.ChannelMessageSend(m.ChannelID, "Please provide a restaurant name to remove.")
-			return
-		}
-
-		count, err := RemoveRestaurant(restaurantName)
-		if err != nil {
-			log.Printf("Failed to remove restaurant: %v", err)
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Failed to remove restaurant: %v", err))
-			return
-		}
-
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Removed restaurant \"%s\". Total count: %d.", restaurantName, count))
+	if m.Author.ID == s.State.User.ID || m.GuildID == "" {
 		return
 	}
 
-	if strings.HasPrefix(m.Content, "!add \"") && strings.HasSuffix(m.Content, "\"") {
-		restaurantName := strings.TrimSuffix(strings.TrimPrefix(m.Content, "!add \""), "\"")
-		if restaurantName == "" {
-			s.ChannelMessageSend(m.ChannelID, "Please provide a restaurant name.")
-			return
-		}
-
-		count, duplicateInfo, err := AddRestaurant(restaurantName)
-		if err != nil {
-			log.Printf("Error adding restaurant: %v", err)
-			s.ChannelMessageSend(m.ChannelID, "An error occurred while trying to add the restaurant.")
-			return
-		}
-
-		if duplicateInfo != nil {
-			// A potential duplicate was found, ask for confirmation.
-			pendingConfirmationsMutex.Lock()
-			pendingConfirmations[m.ChannelID] = PendingConfirmation{
-				NewName:     restaurantName,
-				MatchedName: duplicateInfo.MatchedName,
-			}
-			pendingConfirmationsMutex.Unlock()
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Is '%s' the same as '%s'? (Please respond with `!yes` or `!no`)", restaurantName, duplicateInfo.MatchedName))
-			return
-		}
-
-		s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Added restaurant \"%s\". Total count: %d.", restaurantName, count))
-	}
+	dispatch(s, m, nil)
 }
 
 // HealthCheckMLAPI checks the status of the ML API.
-func HealthCheckMLAPI() error {
-	mlApiURL := os.Getenv("ML_API_URL")
+func HealthCheckMLAPI(ctx context.Context) error {
+	mlApiURL := currentConfig().MLAPIURL
 	if mlApiURL == "" {
 		mlApiURL = "http://localhost:8000/"
 	}
 
-	resp, err := http.Get(mlApiURL)
+	defer enterStage(ctx, "ML API health check")()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mlApiURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -167,13 +55,13 @@ func HealthCheckMLAPI() error {
 }
 
 func main() {
-	// Load .env file if it exists, but don't fail if it doesn't.
-	godotenv.Load()
+	reencrypt := flag.Bool("reencrypt", false, "rewrite the database file with DB_ENCRYPTION_KEY, or in plain text without it, and exit")
+	flag.Parse()
+
+	loadProcessEnv()
+	installErrorRing()
 
 	token := os.Getenv("DISCORD_TOKEN")
-	if token == "" {
-		log.Fatal("Error: DISCORD_TOKEN environment variable not set.")
-	}
 
 	// Get the database path from the environment variable, with a default
 	dbPath := os.Getenv("DB_PATH")
@@ -185,8 +73,39 @@ func main() {
 		dbPath = filepath.Join(homeDir, "restaurants.json")
 	}
 
-	// Initialize the database file
-	initDB(dbPath)
+	if *reencrypt {
+		if err := loadEncryptionKeys(); err != nil {
+			log.Fatal(err)
+		}
+		lock, err := acquireProcessLock(dbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer lock.Release()
+		initDB(dbPath)
+		if currentKey != nil {
+			log.Printf("Rewrote %s encrypted with key %x", dbPath, currentKey.id)
+		} else {
+			log.Printf("Rewrote %s in plain text", dbPath)
+		}
+		return
+	}
+
+	// Report every configuration problem at once before connecting.
+	if problems := checkStartup(token, dbPath); len(problems) > 0 {
+		log.Printf("Startup check failed with %d problem(s):", len(problems))
+		for _, p := range problems {
+			log.Printf("  - %s", p)
+		}
+		os.Exit(1)
+	}
+
+	// Refuse to run next to another process writing the same database.
+	lock, err := acquireProcessLock(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer lock.Release()
 
 	dg, err := discordgo.New("Bot " + token)
 	if err != nil {
@@ -194,24 +113,74 @@ func main() {
 		return
 	}
 
-	// Specify the necessary intents.
-	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsMessageContent
+	// The shards decide how the database is written, so they are known
+	// before the database is loaded and first written.
+	if err := configureShards(dg); err != nil {
+		log.Fatal(err)
+	}
+
+	// Initialize the database file
+	initDB(dbPath)
+	sessions, err := shardSessions(dg)
+	if err != nil {
+		log.Fatalf("Failed to create the shard sessions: %v", err)
+	}
 
 	// Create a new handler
 	h := &Handler{}
 
-	dg.AddHandler(h.HandleMessage)
-
-	err = dg.Open()
-	if err != nil {
-		fmt.Println("error opening connection,", err)
-		return
+	for _, s := range sessions {
+		// Specify the necessary intents.
+		s.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsMessageContent
+
+		s.AddHandler(h.HandleMessage)
+		s.AddHandler(h.HandleInteraction)
+		s.AddHandler(h.HandleReady)
+		s.AddHandler(h.HandleConnect)
+		s.AddHandler(h.HandleGuildCreate)
+		s.AddHandler(h.HandleGuildJoin)
+		s.AddHandler(h.HandleGuildDelete)
 	}
 
-	fmt.Println("Bot is now running.  Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
+
+	for i, s := range sessions {
+		if i > 0 {
+			select {
+			case <-time.After(identifyInterval):
+			case <-sc:
+				return
+			}
+		}
+		err = connectWithBackoff(s, connectMaxWait(), sc)
+		switch {
+		case errors.Is(err, errConnectAborted):
+			return
+		case authenticationFailed(err):
+			log.Fatalf("Discord rejected DISCORD_TOKEN when connecting to the gateway (%v). Copy a new token from the developer portal.", err)
+		case err != nil:
+			log.Fatalf("Failed to connect to the Discord gateway: %v. Check the network connection and https://discordstatus.com.", err)
+		}
+	}
+
+	// REST requests work for every guild from any shard's session, so the
+	// jobs and the API use the first.
+	reconcileDevCommands(dg)
+	startScheduler(dg)
+	startHTTPServer(dg)
+	reloadOnSIGHUP(dg)
+
+	fmt.Println("Bot is now running.  Press CTRL-C to exit.")
 	<-sc
+	stopShutdown()
 
-	dg.Close()
-}
\ No newline at end of file
+	flushUsage(time.Now())
+	cleanupDevCommands(dg)
+	for _, s := range sessions {
+		s.Close()
+	}
+	if err := Flush(); err != nil {
+		log.Printf("Failed to save database: %v", err)
+	}
+}
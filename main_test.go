@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// checkGolden compares got with the golden file testdata/name, rewriting
+// the file instead with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\n%s", path, got)
+	}
+}
+
+// TestMain keeps the bot's logging out of the test output unless -v is set.
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestDB points the store at an empty database in a temporary directory,
+// returning the path of its file.
+func newTestDB(t testing.TB) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db.json")
+	initDB(path)
+	t.Cleanup(closeTestDB)
+	return path
+}
+
+// closeTestDB writes what a test left unsaved before its directory is
+// removed, and closes the operation log it opened, so that the next test
+// starts without one.
+func closeTestDB() {
+	Flush()
+	closeTestDBLog()
+}
+
+// closeTestDBLog closes the operation log without writing the database.
+func closeTestDBLog() {
+	opLog.Lock()
+	defer opLog.Unlock()
+	if opLog.file != nil {
+		opLog.file.Close()
+		opLog.file, opLog.size = nil, 0
+	}
+}
+
+// stubDiscord answers the session's REST requests in place of Discord,
+// recording the messages sent. Other requests get an empty object.
+type stubDiscord struct {
+	mu   sync.Mutex
+	sent []sentMessage
+}
+
+// sentMessage is a message a test sent to a channel.
+type sentMessage struct {
+	ChannelID string
+	Content   string
+}
+
+// newStubSession returns a session whose requests go to a stubDiscord.
+func newStubSession(t testing.TB) (*discordgo.Session, *stubDiscord) {
+	t.Helper()
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := &stubDiscord{}
+	s.Client = &http.Client{Transport: stub}
+	s.State.User = &discordgo.User{ID: "bot", Username: "bot"}
+	return s, stub
+}
+
+func (d *stubDiscord) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := []byte("{}")
+	path := strings.TrimPrefix(req.URL.Path, "/api/v"+discordgo.APIVersion)
+	if channelID, ok := strings.CutPrefix(path, "/channels/"); ok && req.Method == http.MethodPost && strings.HasSuffix(channelID, "/messages") {
+		channelID = strings.TrimSuffix(channelID, "/messages")
+		var msg discordgo.MessageSend
+		if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+			return nil, err
+		}
+		d.mu.Lock()
+		d.sent = append(d.sent, sentMessage{channelID, msg.Content})
+		d.mu.Unlock()
+		body, _ = json.Marshal(discordgo.Message{ID: "1", ChannelID: channelID, Content: msg.Content})
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// messages returns the messages sent so far.
+func (d *stubDiscord) messages() []sentMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]sentMessage(nil), d.sent...)
+}
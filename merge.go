@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrMergeSelf is returned when merging a restaurant into itself.
+var ErrMergeSelf = errors.New("cannot merge a restaurant into itself")
+
+// mergeInto combines the history of from into into. Visits, tags, nicknames
+// and ratings are combined, and attributes into doesn't have are taken from
+// from.
+func mergeInto(into *Restaurant, from Restaurant) {
+	into.Visits = append(slices.Clone(into.Visits), from.Visits...)
+	sort.SliceStable(into.Visits, func(i, j int) bool { return into.Visits[i].Date.Before(into.Visits[j].Date) })
+	for _, t := range from.Tags {
+		if !into.HasTag(t) {
+			into.Tags = append(into.Tags, t)
+		}
+	}
+	for _, a := range from.Aliases {
+		if !into.hasAlias(a) && !strings.EqualFold(a, into.Name) {
+			into.Aliases = append(into.Aliases, a)
+		}
+	}
+	if len(from.Ratings) > 0 {
+		ratings := make(map[string]int, len(into.Ratings)+len(from.Ratings))
+		for user, rating := range from.Ratings {
+			ratings[user] = rating
+		}
+		ratedAt := make(map[string]time.Time, len(ratings))
+		for user, at := range from.RatedAt {
+			ratedAt[user] = at
+		}
+		guests := map[string]bool{}
+		for user := range from.GuestRatings {
+			guests[user] = true
+		}
+		// A member who rated both keeps the rating of the surviving entry.
+		for user, rating := range into.Ratings {
+			ratings[user] = rating
+			delete(ratedAt, user)
+			if at, ok := into.RatedAt[user]; ok {
+				ratedAt[user] = at
+			}
+			delete(guests, user)
+			if into.GuestRatings[user] {
+				guests[user] = true
+			}
+		}
+		into.Ratings, into.RatedAt, into.GuestRatings = ratings, ratedAt, guests
+	}
+	for _, d := range from.Diet {
+		if !into.HasDiet(d) {
+			into.Diet = append(into.Diet, d)
+		}
+	}
+	if into.Price == 0 {
+		into.Price = from.Price
+	}
+	if into.CostExpenses == 0 {
+		into.CostCents, into.CostExpenses = from.CostCents, from.CostExpenses
+	}
+	if into.Location == nil {
+		into.Location = from.Location
+	}
+	if into.Address == "" {
+		into.Address = from.Address
+	}
+	if into.Link == "" {
+		into.Link, into.Preview = from.Link, from.Preview
+	}
+	into.Reservation = into.Reservation || from.Reservation
+	into.Delivery = into.Delivery || from.Delivery
+	for _, p := range from.Payment {
+		if !into.HasPayment(p) {
+			into.Payment = append(into.Payment, p)
+		}
+	}
+	sort.Strings(into.Payment)
+	if into.Capacity == 0 {
+		into.Capacity = from.Capacity
+	}
+	if into.Wait == 0 {
+		into.Wait = from.Wait
+	}
+	// The latest reports of both are kept, as if they had been given to one.
+	into.WaitReports = append(into.WaitReports, from.WaitReports...)
+	slices.SortStableFunc(into.WaitReports, func(a, b WaitReport) int { return a.VisitAt.Compare(b.VisitAt) })
+	into.WaitReports = into.WaitReports[max(0, len(into.WaitReports)-maxWaitReports):]
+	if into.Emoji == "" {
+		into.Emoji = from.Emoji
+	}
+	if into.Photo == "" {
+		into.Photo = from.Photo
+	}
+}
+
+// MergeRestaurants merges the restaurant named from into the one named into
+// and removes from. It returns both entries before and the merged one after.
+func MergeRestaurants(guildID, from, into string, by Contributor) (snapshot, error) {
+	var change snapshot
+	err := updateGuild(guildID, func(g *GuildData) error {
+		fi, err := g.lookup(from)
+		if err != nil {
+			return err
+		}
+		ii, err := g.lookup(into)
+		if err != nil {
+			return err
+		}
+		if fi == ii {
+			return ErrMergeSelf
+		}
+		source, target := g.Restaurants[fi], &g.Restaurants[ii]
+		change.Before = []Restaurant{source, *target}
+		details := target.details()
+		mergeInto(target, source)
+		target.revise(details, &by)
+		change.After = []Restaurant{*target}
+		g.audit(auditMerge, source.Name+" → "+target.Name, &by, sourceDiscord)
+		g.Restaurants = slices.Delete(g.Restaurants, fi, fi+1)
+		return nil
+	})
+	return change, err
+}
+
+// handleMerge implements `!merge "Duplicate" "Original"`.
+func handleMerge(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	from, rest, ok := parseRef(c.Args)
+	into, _, ok2 := parseRef(rest)
+	if !ok || !ok2 || from == "" || into == "" {
+		c.Reply("merge.usage", nil)
+		return
+	}
+	change, err := MergeRestaurants(c.GuildID, from, into, c.Author())
+	switch {
+	case errors.Is(err, ErrMergeSelf):
+		c.Reply("merge.self", nil)
+	case errors.Is(err, ErrRestaurantNotFound):
+		name := into
+		var notFound *NotFoundError
+		if errors.As(err, &notFound) {
+			name = notFound.Name
+		}
+		c.replyError("merge.failed", err, name)
+	case err != nil:
+		log.Printf("Failed to merge restaurants: %v", err)
+		c.Reply("merge.failed", Args{"name": from})
+	default:
+		source, target := change.Before[0], change.After[0]
+		c.sendWithUndo(c.T("merge.done", Args{
+			"from": source.Name, "into": target.Name, "count": len(target.Visits),
+		}), change)
+	}
+}
+
+// handleClear implements `!clear`, removing the whole list after confirmation.
+func handleClear(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	startBulkRemoval(c, "*", func(Restaurant) bool { return true })
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMigrations decodes a database file of every format in
+// testdata/migrations and compares the result with its golden file. Run
+// `go test -run TestMigrations -update` to rewrite the golden files.
+func TestMigrations(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "migrations", "v*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no migration fixtures")
+	}
+	for _, input := range inputs {
+		if strings.HasSuffix(input, ".golden.json") {
+			continue
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, err := decodeDB(data)
+			if err != nil {
+				t.Fatalf("decodeDB: %v", err)
+			}
+			if db.Version != schemaVersion {
+				t.Errorf("version = %d, want %d", db.Version, schemaVersion)
+			}
+			got := encodeTestDB(t, db)
+			checkGolden(t, filepath.Join("migrations", strings.TrimSuffix(filepath.Base(input), ".json")+".golden.json"), got)
+
+			again, err := decodeDB(got)
+			if err != nil {
+				t.Fatalf("decodeDB of the migrated database: %v", err)
+			}
+			if resaved := encodeTestDB(t, again); !bytes.Equal(resaved, got) {
+				t.Errorf("decoding the migrated database changed it:\n%s", resaved)
+			}
+		})
+	}
+}
+
+// TestMigrationsClaimUnclaimed checks that the entries of the original
+// format go to the first guild, with IDs in list order.
+func TestMigrationsClaimUnclaimed(t *testing.T) {
+	db, err := decodeDB([]byte(`["Pizza Place", "Sushi Bar"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := db.guild("111")
+	if len(g.Restaurants) != 2 || g.Restaurants[0].ID != "1" || g.Restaurants[1].ID != "2" {
+		t.Fatalf("claimed restaurants = %+v, want Pizza Place and Sushi Bar with IDs 1 and 2", g.Restaurants)
+	}
+	if len(db.Unclaimed) != 0 {
+		t.Errorf("unclaimed = %+v after the first guild claimed them", db.Unclaimed)
+	}
+	if other := db.guild("222"); len(other.Restaurants) != 0 {
+		t.Errorf("second guild got %+v", other.Restaurants)
+	}
+}
+
+// TestSaveReload checks that loading a migrated file and saving it again is
+// idempotent: the second save writes the same file as the first.
+func TestSaveReload(t *testing.T) {
+	for _, name := range []string{"v1.json", "v2.json", "v3.json"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "migrations", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "db.json")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(closeTestDB)
+			initDB(path)
+			first, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			initDB(path)
+			second, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first, second) {
+				t.Errorf("reloading changed the file:\n%s\nwant:\n%s", second, first)
+			}
+		})
+	}
+}
+
+// encodeTestDB encodes db the way golden files store it.
+func encodeTestDB(t *testing.T, db *database) []byte {
+	t.Helper()
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(data, '\n')
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// defaultMaxNameLength is the longest restaurant name accepted unless the
+	// guild says otherwise, in characters.
+	defaultMaxNameLength = 100
+	// minNameLengthLimit and maxNameLengthLimit bound `!settings name-length`.
+	minNameLengthLimit = 10
+	maxNameLengthLimit = 200
+	// maxEchoedName bounds names repeated back in error messages, so that a
+	// pasted menu isn't posted again.
+	maxEchoedName = 60
+)
+
+var (
+	// ErrNameTooLong is returned for a restaurant name longer than the guild allows.
+	ErrNameTooLong = errors.New("name is too long")
+	// ErrNameLineBreak is returned for a restaurant name spanning several lines.
+	ErrNameLineBreak = errors.New("name contains a line break")
+	// ErrNameCodeBlock is returned for a restaurant name containing a code block fence.
+	ErrNameCodeBlock = errors.New("name contains a code block")
+)
+
+// maxNameLength returns the longest restaurant name the guild accepts.
+func (cfg GuildConfig) maxNameLength() int {
+	if cfg.MaxNameLength > 0 {
+		return cfg.MaxNameLength
+	}
+	return defaultMaxNameLength
+}
+
+// validateName checks a new restaurant name. Every way of adding a
+// restaurant goes through it, so that the list stays readable.
+func validateName(name string, maxLength int) error {
+	switch {
+	case strings.ContainsAny(name, "\r\n"):
+		return ErrNameLineBreak
+	case strings.Contains(name, "```"):
+		return ErrNameCodeBlock
+	case utf8.RuneCountInString(name) > maxLength:
+		return fmt.Errorf("%w: more than %d characters", ErrNameTooLong, maxLength)
+	}
+	return nil
+}
+
+// echoName shortens a name the user typed for repeating it in a reply.
+func echoName(name string) string {
+	return truncateRunes(name, maxEchoedName)
+}
+
+// replyNameError explains why a restaurant name was rejected, reporting
+// false when err isn't a validation error.
+func (c *Context) replyNameError(err error) bool {
+	switch {
+	case errors.Is(err, ErrNameTooLong):
+		c.Reply("name.too_long", Args{"count": c.Config.maxNameLength()})
+	case errors.Is(err, ErrNameLineBreak):
+		c.Reply("name.line_break", nil)
+	case errors.Is(err, ErrNameCodeBlock):
+		c.Reply("name.code_block", nil)
+	default:
+		return false
+	}
+	return true
+}
+
+// handleNameLengthSetting implements `!settings name-length [N|default]`.
+func handleNameLengthSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.name_length", Args{"count": c.Config.maxNameLength()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	length := 0
+	if value := strings.ToLower(fields[0]); len(fields) != 1 || value != "default" {
+		n, err := strconv.Atoi(value)
+		if len(fields) != 1 || err != nil || n < minNameLengthLimit || n > maxNameLengthLimit {
+			c.Reply("settings.name_length_invalid", Args{"min": minNameLengthLimit, "max": maxNameLengthLimit})
+			return
+		}
+		length = n
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.MaxNameLength = length
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save name length: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.MaxNameLength = length
+	c.Reply("settings.name_length", Args{"count": c.Config.maxNameLength()})
+}
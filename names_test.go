@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxLength int
+		want      error
+	}{
+		{"short", "Pizza Place", 100, nil},
+		{"exactly the limit", strings.Repeat("a", 100), 100, nil},
+		{"one over the limit", strings.Repeat("a", 101), 100, ErrNameTooLong},
+		{"custom limit", strings.Repeat("a", 10), 10, nil},
+		{"over a custom limit", strings.Repeat("a", 11), 10, ErrNameTooLong},
+		// Limits count characters, not bytes.
+		{"multi-byte at the limit", strings.Repeat("ü", 10), 10, nil},
+		{"multi-byte over the limit", strings.Repeat("ü", 11), 10, ErrNameTooLong},
+		{"emoji at the limit", strings.Repeat("🍣", 10), 10, nil},
+		{"emoji over the limit", strings.Repeat("🍣", 11), 10, ErrNameTooLong},
+		{"CJK at the limit", strings.Repeat("寿", 10), 10, nil},
+		{"mixed at the limit", "Café " + strings.Repeat("寿", 5), 10, nil},
+		{"empty", "", 10, nil},
+		{"line break", "Pizza\nPlace", 100, ErrNameLineBreak},
+		{"carriage return", "Pizza\rPlace", 100, ErrNameLineBreak},
+		{"code block", "```Pizza```", 100, ErrNameCodeBlock},
+		{"inline code", "`Pizza`", 100, nil},
+	}
+	for _, tt := range tests {
+		err := validateName(tt.input, tt.maxLength)
+		if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+			t.Errorf("%s: validateName = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
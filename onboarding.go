@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// onboardingWindow is how recently the bot must have joined a guild for
+	// its GuildCreate to count as a new guild rather than a reconnect.
+	onboardingWindow = 10 * time.Minute
+	// onboardingPollTime is when the lunch poll set up by the wizard runs.
+	onboardingPollTime = "11:30"
+)
+
+// onboardingTimezones are the timezones offered by the wizard, which
+// `!settings timezone` extends to every IANA name.
+var onboardingTimezones = []string{
+	"UTC", "Europe/London", "Europe/Lisbon", "Europe/Paris", "Europe/Berlin", "Europe/Vienna", "Europe/Madrid",
+	"Europe/Amsterdam", "Europe/Warsaw", "Europe/Helsinki", "Europe/Istanbul", "America/New_York", "America/Chicago",
+	"America/Denver", "America/Los_Angeles", "America/Sao_Paulo", "Asia/Dubai", "Asia/Kolkata", "Asia/Singapore",
+	"Asia/Tokyo", "Australia/Sydney",
+}
+
+// HandleGuildJoin welcomes a guild the bot was just added to with the
+// onboarding wizard. The guild's data records that it was welcomed, so the
+// wizard is posted once even if the bot rejoins.
+func (h *Handler) HandleGuildJoin(s *discordgo.Session, g *discordgo.GuildCreate) {
+	if g.Unavailable || g.JoinedAt.IsZero() || time.Since(g.JoinedAt) > onboardingWindow || !ownsGuild(g.ID) {
+		return
+	}
+	err := updateGuild(g.ID, func(data *GuildData) error {
+		if !data.OnboardedAt.IsZero() {
+			return errNoChange
+		}
+		data.OnboardedAt = time.Now().UTC()
+		return nil
+	})
+	if errors.Is(err, errNoChange) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record onboarding of guild %s: %v", g.ID, err)
+		return
+	}
+	cfg, err := GetGuildConfig(g.ID)
+	if err != nil {
+		log.Printf("Failed to load config for guild %s: %v", g.ID, err)
+	}
+	channelID := onboardingChannel(s, g.Guild)
+	if channelID == "" {
+		log.Printf("No channel to post the onboarding message in guild %s", g.ID)
+		return
+	}
+	if _, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:    cfg.T("onboarding.welcome", nil),
+		Components: onboardingButtons(cfg),
+	}); err != nil {
+		log.Printf("Failed to post the onboarding message in guild %s: %v", g.ID, err)
+	}
+}
+
+// onboardingChannel returns the guild's system channel, or else its first
+// text channel the bot can write in, "" when there is none.
+func onboardingChannel(s *discordgo.Session, g *discordgo.Guild) string {
+	writable := func(channelID string) bool {
+		perms, err := s.UserChannelPermissions(s.State.User.ID, channelID)
+		need := int64(discordgo.PermissionViewChannel | discordgo.PermissionSendMessages)
+		return err == nil && perms&need == need
+	}
+	if g.SystemChannelID != "" && writable(g.SystemChannelID) {
+		return g.SystemChannelID
+	}
+	channels := make([]*discordgo.Channel, 0, len(g.Channels))
+	for _, ch := range g.Channels {
+		if ch.Type == discordgo.ChannelTypeGuildText {
+			channels = append(channels, ch)
+		}
+	}
+	sort.SliceStable(channels, func(i, j int) bool { return channels[i].Position < channels[j].Position })
+	for _, ch := range channels {
+		if writable(ch.ID) {
+			return ch.ID
+		}
+	}
+	return ""
+}
+
+// onboardingButtons builds the wizard's buttons, each starting one step.
+func onboardingButtons(cfg GuildConfig) []discordgo.MessageComponent {
+	button := func(key, action string, style discordgo.ButtonStyle) discordgo.Button {
+		return discordgo.Button{Label: cfg.T(key, nil), Style: style, CustomID: "onboard:" + action}
+	}
+	return []discordgo.MessageComponent{
+		buttonRow(
+			button("button.onboard_channel", "channel", discordgo.PrimaryButton),
+			button("button.onboard_timezone", "timezone", discordgo.PrimaryButton),
+			button("button.onboard_seed", "seed", discordgo.PrimaryButton),
+			button("button.onboard_commands", "commands", discordgo.SecondaryButton),
+		),
+		buttonRow(button("button.dismiss", "dismiss", discordgo.SecondaryButton)),
+	}
+}
+
+// selectRow wraps a select menu in an action row.
+func selectRow(menu discordgo.SelectMenu) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}}}
+}
+
+// handleOnboardComponent handles the buttons of the onboarding message and
+// the menus they open. Only admins may configure the bot; showing the
+// commands is open to everyone.
+func handleOnboardComponent(i *Interaction) {
+	if len(i.Args) != 1 {
+		return
+	}
+	action := i.Args[0]
+	if action == "commands" {
+		i.Ephemeral("onboarding.commands", nil)
+		return
+	}
+	if !isAdmin(i.Session, i.Event.ChannelID, i.UserID()) {
+		i.Ephemeral("error.admin_only", nil)
+		return
+	}
+
+	switch action {
+	case "dismiss":
+		i.Update(i.T("onboarding.dismissed", nil), nil)
+	case "channel":
+		i.EphemeralComponents(i.T("onboarding.channel_prompt", Args{"time": onboardingPollTime}), selectRow(discordgo.SelectMenu{
+			MenuType:     discordgo.ChannelSelectMenu,
+			CustomID:     "onboard:pick-channel",
+			Placeholder:  i.T("onboarding.channel_placeholder", nil),
+			ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+		}))
+	case "timezone":
+		options := make([]discordgo.SelectMenuOption, len(onboardingTimezones))
+		for n, tz := range onboardingTimezones {
+			options[n] = discordgo.SelectMenuOption{Label: tz, Value: tz, Default: tz == i.Config.location().String()}
+		}
+		i.EphemeralComponents(i.T("onboarding.timezone_prompt", nil), selectRow(discordgo.SelectMenu{
+			MenuType:    discordgo.StringSelectMenu,
+			CustomID:    "onboard:pick-timezone",
+			Placeholder: i.T("onboarding.timezone_placeholder", nil),
+			Options:     options,
+		}))
+	case "seed":
+		var options []discordgo.SelectMenuOption
+		for _, city := range starterCities() {
+			options = append(options, discordgo.SelectMenuOption{Label: city, Value: city})
+		}
+		i.EphemeralComponents(i.T("onboarding.seed_prompt", nil), selectRow(discordgo.SelectMenu{
+			MenuType:    discordgo.StringSelectMenu,
+			CustomID:    "onboard:pick-city",
+			Placeholder: i.T("onboarding.seed_placeholder", nil),
+			Options:     options,
+		}))
+	case "pick-channel", "pick-timezone", "pick-city":
+		values := i.Event.MessageComponentData().Values
+		if len(values) != 1 {
+			return
+		}
+		switch action {
+		case "pick-channel":
+			onboardChannel(i, values[0])
+		case "pick-timezone":
+			onboardTimezone(i, values[0])
+		default:
+			onboardSeed(i, values[0])
+		}
+	}
+}
+
+// onboardChannel schedules a weekday lunch poll in the chosen channel.
+func onboardChannel(i *Interaction, channelID string) {
+	sc := Schedule{
+		ID:        newToken()[:6],
+		Kind:      schedulePoll,
+		ChannelID: channelID,
+		Time:      onboardingPollTime,
+		Days:      []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		LastRun:   time.Now().UTC(),
+	}
+	if err := AddSchedule(i.GuildID, sc); err != nil {
+		if errors.Is(err, ErrTooManySchedules) {
+			i.Update(i.T("schedule.too_many", Args{"count": maxSchedules}), nil)
+			return
+		}
+		log.Printf("Failed to save schedule: %v", err)
+		i.Update(i.T("schedule.failed", nil), nil)
+		return
+	}
+	i.Update(i.T("onboarding.channel_done", Args{"schedule": scheduleLine(i.Config, sc)}), nil)
+}
+
+// onboardTimezone sets the guild's timezone.
+func onboardTimezone(i *Interaction, name string) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Failed to load timezone %s: %v", name, err)
+		i.Update(i.T("settings.timezone_invalid", Args{"value": name}), nil)
+		return
+	}
+	timezone := loc.String()
+	if timezone == "UTC" {
+		timezone = ""
+	}
+	if err := updateGuild(i.GuildID, func(g *GuildData) error {
+		g.Config.Timezone = timezone
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save timezone: %v", err)
+		i.Update(i.T("settings.save_failed", nil), nil)
+		return
+	}
+	i.Update(i.T("settings.timezone_set", Args{"value": loc.String()}), nil)
+}
+
+// onboardSeed previews a starter list, to be confirmed with the buttons of
+// `!seed`.
+func onboardSeed(i *Interaction, city string) {
+	entries, ok := starterLists[city]
+	if !ok {
+		return
+	}
+	restaurants, err := GetRestaurants(i.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		i.Update(i.T("list.failed", nil), nil)
+		return
+	}
+	token := newToken()
+	op := &pendingSeed{guildID: i.GuildID, userID: i.UserID(), city: city, entries: entries, expires: time.Now().Add(seedTimeout)}
+	pendingSeedsMutex.Lock()
+	pendingSeeds[token] = op
+	pendingSeedsMutex.Unlock()
+	time.AfterFunc(seedTimeout, func() {
+		pendingSeedsMutex.Lock()
+		delete(pendingSeeds, token)
+		pendingSeedsMutex.Unlock()
+	})
+	i.Update(seedPreview(i.Config, op, restaurants), seedComponents(i.Config, token))
+}
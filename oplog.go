@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxOpLogSize is the operation log size at which the next database write
+// truncates it.
+const maxOpLogSize = 4 << 20
+
+// opLogEntry is a line of the operation log: the data of the guilds an
+// operation changed, and the rest of the database if it changed that too.
+type opLogEntry struct {
+	Seq    int64                      `json:"seq"`
+	At     time.Time                  `json:"at"`
+	Guilds map[string]json.RawMessage `json:"guilds,omitempty"`
+	Root   *opLogRoot                 `json:"root,omitempty"`
+}
+
+// opLogRoot is the database apart from its guilds.
+type opLogRoot struct {
+	Unclaimed []Restaurant                      `json:"unclaimed,omitempty"`
+	Shares    map[string]*Share                 `json:"shares,omitempty"`
+	Directory map[string]*DirectoryContribution `json:"directory,omitempty"`
+}
+
+// opLog is the optional operation log. With DB_OPLOG set, every change is
+// appended and synced to it before it is applied, so that a crash before the
+// next database write loses nothing. Startup replays the operations newer
+// than the database file.
+var opLog struct {
+	// Mutex orders appends with the database writes that truncate the log.
+	sync.Mutex
+	file *os.File
+	size int64
+	// seq is the sequence number of the last operation.
+	seq int64
+}
+
+// opLogEnabled reports whether DB_OPLOG turns the operation log on.
+func opLogEnabled() bool {
+	on, _ := strconv.ParseBool(os.Getenv("DB_OPLOG"))
+	return on
+}
+
+// opLogPath returns the path of the operation log, the database file's with
+// the extension .jsonl.
+func opLogPath() string {
+	return strings.TrimSuffix(dbFilePath, filepath.Ext(dbFilePath)) + ".jsonl"
+}
+
+// appendOp logs a change when the operation log is on. The caller must hold
+// opLog.
+func appendOp(guilds map[string][]byte, root *database) error {
+	if opLog.file == nil {
+		return nil
+	}
+	entry := opLogEntry{Seq: opLog.seq + 1, At: time.Now().UTC(), Guilds: map[string]json.RawMessage{}}
+	for id, data := range guilds {
+		entry.Guilds[id] = data
+	}
+	if root != nil {
+		entry.Root = &opLogRoot{Unclaimed: root.Unclaimed, Shares: root.Shares, Directory: root.Directory}
+	}
+	line, err := json.Marshal(entry)
+	if err == nil && currentKey != nil {
+		var sealed []byte
+		sealed, err = encryptPayload(line)
+		line = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if _, err := opLog.file.Write(line); err != nil {
+		return fmt.Errorf("failed to append to the operation log: %w", err)
+	}
+	if err := opLog.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the operation log: %w", err)
+	}
+	opLog.seq = entry.Seq
+	opLog.size += int64(len(line))
+	return nil
+}
+
+// truncateOpLog empties the operation log once the database file holds all
+// of it. The caller must hold opLog.
+func truncateOpLog() error {
+	if err := opLog.file.Truncate(0); err != nil {
+		return err
+	}
+	opLog.size = 0
+	return nil
+}
+
+// replayOpLog applies the operations in the log at path that are newer than
+// db, returning how many it applied. A line that can't be read ends the
+// replay, as it is left by a crash while appending.
+func replayOpLog(db *database, path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	applied := 0
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return applied, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var entry opLogEntry
+			if err := decodeOp(line, &entry); errors.Is(err, errUnknownKey) {
+				return applied, err
+			} else if err != nil {
+				log.Printf("Ignoring the operation log from line %d on: %v", n, err)
+				return applied, nil
+			}
+			if entry.Seq > db.LogSeq {
+				for id, data := range entry.Guilds {
+					g := &GuildData{}
+					if err := json.Unmarshal(data, g); err != nil {
+						return applied, fmt.Errorf("line %d: %w", n, err)
+					}
+					db.Guilds[id] = g
+				}
+				if entry.Root != nil {
+					db.Unclaimed, db.Shares, db.Directory = entry.Root.Unclaimed, entry.Root.Shares, entry.Root.Directory
+				}
+				db.LogSeq = entry.Seq
+				applied++
+			}
+		}
+		if err == io.EOF {
+			return applied, nil
+		}
+	}
+}
+
+// decodeOp parses a line of the operation log, which is base64 when encrypted.
+func decodeOp(line []byte, entry *opLogEntry) error {
+	if line[0] != '{' {
+		sealed, err := base64.StdEncoding.DecodeString(string(line))
+		if err != nil {
+			return err
+		}
+		if line, err = decryptPayload(sealed); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(line, entry)
+}
+
+// recoverOpLog applies the operations the database file is missing, which
+// happens after a crash with the operation log on. The log is read even
+// without DB_OPLOG, so that turning it off after a crash loses nothing.
+func recoverOpLog(db *database) {
+	path := opLogPath()
+	n, err := replayOpLog(db, path)
+	if err != nil {
+		log.Fatalf("Failed to replay the operation log %s: %v", path, err)
+	}
+	if n > 0 {
+		log.Printf("Replayed %d operations from %s", n, path)
+	}
+	opLog.seq = db.LogSeq
+}
+
+// openOpLog starts a fresh operation log if DB_OPLOG is set, once the
+// database file holds everything the old log did.
+func openOpLog() {
+	path := opLogPath()
+	if !opLogEnabled() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove the operation log %s: %v", path, err)
+		}
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatalf("Failed to open the operation log %s: %v", path, err)
+	}
+	opLog.Lock()
+	opLog.file, opLog.size = f, 0
+	opLog.Unlock()
+	log.Println("Operation log is on:", path)
+}
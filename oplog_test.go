@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newOpLogTestDB starts a database with the operation log on, returning the
+// path of the database file and its contents before any operation.
+func newOpLogTestDB(t *testing.T) (string, []byte) {
+	t.Helper()
+	t.Setenv("DB_OPLOG", "1")
+	path := newTestDB(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+// addTestEntries adds n restaurants to a guild, one operation each.
+func addTestEntries(t *testing.T, guildID string, n int, name string) {
+	t.Helper()
+	for i := range n {
+		err := updateGuild(guildID, func(g *GuildData) error {
+			g.Restaurants = append(g.Restaurants, Restaurant{ID: g.nextID(), Name: name + strconv.Itoa(i)})
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// crash simulates the bot dying before it wrote the database file: the file
+// is put back to stale contents, the log is closed as it is and the unsaved
+// changes are dropped.
+func crash(t *testing.T, path string, stale []byte) {
+	t.Helper()
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	if err := os.WriteFile(path, stale, 0644); err != nil {
+		t.Fatal(err)
+	}
+	closeTestDBLog()
+	dirty.Store(false)
+}
+
+// checkEntries fails unless the guild holds exactly the named restaurants.
+func checkEntries(t *testing.T, guildID string, want []string) {
+	t.Helper()
+	err := viewKnownGuild(guildID, func(g *GuildData) error {
+		var got []string
+		for _, r := range g.Restaurants {
+			got = append(got, r.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("restaurants = %v, want %v", got, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testNames(prefix string, n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = prefix + strconv.Itoa(i)
+	}
+	return names
+}
+
+func TestOpLogRecoversAfterCrash(t *testing.T) {
+	path, stale := newOpLogTestDB(t)
+	addTestEntries(t, "g1", 20, "a")
+	addTestEntries(t, "g2", 5, "b")
+	crash(t, path, stale)
+
+	initDB(path)
+	checkEntries(t, "g1", testNames("a", 20))
+	checkEntries(t, "g2", testNames("b", 5))
+}
+
+func TestOpLogIgnoresTornLine(t *testing.T) {
+	path, stale := newOpLogTestDB(t)
+	addTestEntries(t, "g1", 3, "a")
+	crash(t, path, stale)
+	f, err := os.OpenFile(opLogPath(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"seq":4,"guilds":{"g1":{"restaurants":[{"name":"tor`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	initDB(path)
+	checkEntries(t, "g1", testNames("a", 3))
+}
+
+func TestWriteDBCompactsOpLog(t *testing.T) {
+	path, _ := newOpLogTestDB(t)
+	// Large entries grow the log past maxOpLogSize in a few operations.
+	padding := strings.Repeat("x", 64<<10)
+	for opLogSize() < maxOpLogSize {
+		err := updateGuild("g1", func(g *GuildData) error {
+			g.Restaurants = append(g.Restaurants, Restaurant{ID: g.nextID(), Name: "r" + strconv.Itoa(g.NextID), Address: padding})
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(opLogPath()); err != nil || info.Size() != 0 || opLogSize() != 0 {
+		t.Fatalf("operation log not truncated: %v, %v", info, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file dbFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	opLog.Lock()
+	seq := opLog.seq
+	opLog.Unlock()
+	if file.LogSeq != seq {
+		t.Errorf("file includes operation %d, log is at %d", file.LogSeq, seq)
+	}
+
+	// Operations after the compaction are recovered on top of the file.
+	var before []string
+	err = viewKnownGuild("g1", func(g *GuildData) error {
+		for _, r := range g.Restaurants {
+			before = append(before, r.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestEntries(t, "g1", 2, "after")
+	crash(t, path, data)
+	initDB(path)
+	checkEntries(t, "g1", append(before, testNames("after", 2)...))
+}
+
+// opLogSize returns the current size of the operation log.
+func opLogSize() int64 {
+	opLog.Lock()
+	defer opLog.Unlock()
+	return opLog.size
+}
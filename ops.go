@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxPanicContent bounds how much of the offending message a panic report quotes, in runes.
+const maxPanicContent = 200
+
+// handlerPanics counts the panics recovered from command and component handlers.
+var handlerPanics atomic.Int64
+
+// reportError logs an operational failure and posts it to the channel named by
+// ERROR_CHANNEL_ID, if set.
+func reportError(s *discordgo.Session, format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	log.Print(text)
+
+	channelID := currentConfig().ErrorChannelID
+	if channelID == "" {
+		return
+	}
+	if _, err := s.ChannelMessageSend(channelID, "🚨 "+text); err != nil {
+		log.Printf("Failed to post to the error channel: %v", err)
+	}
+}
+
+// recoverHandler recovers from a panic in the handler of what, so that one
+// bad command can't take the bot down. It logs the stack trace, reports the
+// panic with the offending content and calls reply to tell the user. It must
+// be called directly by defer.
+func recoverHandler(s *discordgo.Session, what, content string, reply func()) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	handlerPanics.Add(1)
+	log.Printf("Panic in %s: %v\n%s", what, v, debug.Stack())
+	reportError(s, "Panic in %s: %v (message: %q)", what, v, truncateRunes(content, maxPanicContent))
+	reply()
+}
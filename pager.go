@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// pageLines is the number of lines on a page of a long result.
+	pageLines = 15
+	// maxPageLength bounds a page below the 4096 characters of an embed description.
+	maxPageLength = 3900
+	// pagerTimeout is how long the buttons of a paged result keep working.
+	pagerTimeout = 10 * time.Minute
+)
+
+// pager is a long result shown one page at a time. The pages are rendered
+// when the result is sent, so browsing shows the data as it was then.
+type pager struct {
+	pages []string
+	cfg   GuildConfig
+	// page is the index of the page shown.
+	page int
+}
+
+var (
+	// pagers stores the paged results whose buttons still work, keyed by token.
+	pagers      = make(map[string]*pager)
+	pagersMutex sync.Mutex
+)
+
+// paginate splits lines into pages of at most pageLines lines and
+// maxPageLength characters.
+func paginate(lines []string) []string {
+	var pages []string
+	page, n := "", 0
+	for _, line := range lines {
+		line = truncateRunes(line, maxPageLength)
+		if n > 0 && (n == pageLines || len(page)+1+len(line) > maxPageLength) {
+			pages = append(pages, page)
+			page, n = "", 0
+		}
+		if n > 0 {
+			page += "\n"
+		}
+		page += line
+		n++
+	}
+	return append(pages, page)
+}
+
+// SendPages sends a header and lines, with previous and next buttons when
+// they don't fit on one page. Anyone may turn the pages.
+func (c *Context) SendPages(header string, lines []string) {
+	pages := paginate(lines)
+	if len(pages) == 1 {
+		c.SendQuiet(header + "\n" + pages[0])
+		return
+	}
+	token := newToken()
+	p := &pager{pages: pages, cfg: c.Config}
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content:         header,
+		Embeds:          []*discordgo.MessageEmbed{p.embed()},
+		Components:      p.components(token, false),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to send message to %s: %v", c.Message.ChannelID, err)
+		return
+	}
+	pagersMutex.Lock()
+	pagers[token] = p
+	pagersMutex.Unlock()
+
+	time.AfterFunc(pagerTimeout, func() {
+		pagersMutex.Lock()
+		delete(pagers, token)
+		components := p.components(token, true)
+		pagersMutex.Unlock()
+		if _, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: msg.ID, Channel: msg.ChannelID, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to expire page buttons: %v", err)
+		}
+	})
+}
+
+// embed renders the page shown.
+func (p *pager) embed() *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Description: p.pages[p.page],
+		Color:       previewColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: p.cfg.T("pager.footer", Args{"page": p.page + 1, "count": len(p.pages)})},
+	}
+}
+
+// components builds the previous and next buttons around the page
+// indicator, all disabled once the pager expired.
+func (p *pager) components(token string, expired bool) []discordgo.MessageComponent {
+	id := func(action string) string { return "page:" + token + ":" + action }
+	return []discordgo.MessageComponent{buttonRow(
+		discordgo.Button{Emoji: &discordgo.ComponentEmoji{Name: "◀️"}, Style: discordgo.SecondaryButton, CustomID: id("prev"), Disabled: expired || p.page == 0},
+		discordgo.Button{Label: fmt.Sprintf("%d/%d", p.page+1, len(p.pages)), Style: discordgo.SecondaryButton, CustomID: id("page"), Disabled: true},
+		discordgo.Button{Emoji: &discordgo.ComponentEmoji{Name: "▶️"}, Style: discordgo.SecondaryButton, CustomID: id("next"), Disabled: expired || p.page == len(p.pages)-1},
+	)}
+}
+
+// handlePageComponent turns the pages of a paged result.
+func handlePageComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pagersMutex.Lock()
+	p, ok := pagers[token]
+	if !ok {
+		pagersMutex.Unlock()
+		// The result is gone after a restart or once it expired, so only the
+		// buttons are disabled and the page shown is kept.
+		respondPage(i, nil, expiredPageButtons(i.Event.Message.Components))
+		return
+	}
+	switch action {
+	case "prev":
+		p.page = max(p.page-1, 0)
+	case "next":
+		p.page = min(p.page+1, len(p.pages)-1)
+	}
+	embed, components := p.embed(), p.components(token, false)
+	pagersMutex.Unlock()
+	respondPage(i, []*discordgo.MessageEmbed{embed}, components)
+}
+
+// expiredPageButtons disables the buttons of a paged result.
+func expiredPageButtons(rows []discordgo.MessageComponent) []discordgo.MessageComponent {
+	disabled := []discordgo.MessageComponent{}
+	for _, row := range rows {
+		r, ok := row.(*discordgo.ActionsRow)
+		if !ok {
+			continue
+		}
+		var buttons []discordgo.Button
+		for _, c := range r.Components {
+			if b, ok := c.(*discordgo.Button); ok {
+				b.Disabled = true
+				buttons = append(buttons, *b)
+			}
+		}
+		disabled = append(disabled, buttonRow(buttons...))
+	}
+	return disabled
+}
+
+// respondPage updates the message of a paged result, keeping its header,
+// and its embed when embeds is nil.
+func respondPage(i *Interaction, embeds []*discordgo.MessageEmbed, components []discordgo.MessageComponent) {
+	if embeds == nil {
+		embeds = i.Event.Message.Embeds
+	}
+	err := i.Session.InteractionRespond(i.Event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Content:         i.Event.Message.Content,
+			Embeds:          embeds,
+			Components:      components,
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to turn page: %v", err)
+	}
+}
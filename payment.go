@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// paymentMethods are the payment options a restaurant can be marked with.
+var paymentMethods = []string{"cash-only", "cards", "vouchers"}
+
+// parsePayment normalizes a payment option, reporting false for unknown options.
+func parsePayment(s string) (string, bool) {
+	s = strings.ToLower(s)
+	if slices.Contains(paymentMethods, s) {
+		return s, true
+	}
+	return "", false
+}
+
+// parsePayments parses a comma-separated list of payment options, sorted and
+// without duplicates. "none" yields an empty list.
+func parsePayments(s string) ([]string, bool) {
+	if strings.EqualFold(s, "none") {
+		return nil, true
+	}
+	var methods []string
+	for _, p := range strings.Split(s, ",") {
+		method, ok := parsePayment(strings.TrimSpace(p))
+		if !ok {
+			return nil, false
+		}
+		if !slices.Contains(methods, method) {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods, true
+}
+
+// HasPayment reports whether the entry accepts a payment option.
+func (r *Restaurant) HasPayment(method string) bool {
+	return slices.Contains(r.Payment, method)
+}
+
+// require restricts a pick or poll query to the restaurants available
+// today and, unless it was written with `any`, to the guild's required
+// payment options.
+func (q *Query) require(cfg GuildConfig) {
+	q.AvailableOn = localDate(time.Now(), cfg.location())
+	if q.Any {
+		return
+	}
+	for _, method := range cfg.RequiredPayments {
+		var node filterNode = paymentNode{method}
+		if q.Filter != nil {
+			node = andNode{node, q.Filter}
+		}
+		q.Filter = node
+	}
+}
+
+// handleRequireSetting implements `!settings require [option,...|off]`.
+func handleRequireSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Send(requireSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	var methods []string
+	if !strings.EqualFold(fields[0], "off") || len(fields) != 1 {
+		var ok bool
+		if methods, ok = parsePayments(strings.Join(fields, ",")); !ok || len(methods) == 0 {
+			c.Reply("settings.require_invalid", Args{"options": strings.Join(paymentMethods, ", ")})
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.RequiredPayments = methods
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save required payment options: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.RequiredPayments = methods
+	c.Send(requireSettingLine(c.Config))
+}
+
+// requireSettingLine describes the payment options picks and polls require.
+func requireSettingLine(cfg GuildConfig) string {
+	if len(cfg.RequiredPayments) == 0 {
+		return cfg.T("settings.require_off", nil)
+	}
+	return cfg.T("settings.require", Args{"options": strings.Join(cfg.RequiredPayments, ", ")})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxPhotoSize is the largest photo accepted, below Discord's upload limit.
+const maxPhotoSize = 8 << 20
+
+// photoTypes are the image content types a photo may have.
+var photoTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// SetPhoto stores the URL of a restaurant's photo, or clears it when url is
+// empty. It returns the restaurant's canonical name.
+func SetPhoto(guildID, name, url string) (string, error) {
+	var canonical string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		g.Restaurants[i].Photo = url
+		canonical = g.Restaurants[i].Name
+		return nil
+	})
+	return canonical, err
+}
+
+// photoAttachment returns the image attached to the command, or to the
+// message it replies to.
+func photoAttachment(m *discordgo.Message) *discordgo.MessageAttachment {
+	for _, msg := range []*discordgo.Message{m, m.ReferencedMessage} {
+		if msg != nil && len(msg.Attachments) > 0 {
+			return msg.Attachments[0]
+		}
+	}
+	return nil
+}
+
+// photoType returns an attachment's content type without parameters, sniffed
+// from data when Discord didn't report one.
+func photoType(a *discordgo.MessageAttachment, data []byte) string {
+	if a.ContentType != "" {
+		if t, _, err := mime.ParseMediaType(a.ContentType); err == nil {
+			return t
+		}
+	}
+	return http.DetectContentType(data)
+}
+
+// archivePhoto uploads a photo to the guild's photo channel, so that its URL
+// doesn't expire with the message it was attached to, and returns that URL.
+func archivePhoto(c *Context, r Restaurant, a *discordgo.MessageAttachment, contentType string, data []byte) (string, error) {
+	defer enterStage(c.Ctx, "photo upload")()
+	msg, err := c.Session.ChannelMessageSendComplex(c.Config.PhotoChannelID, &discordgo.MessageSend{
+		Content:         r.Name,
+		Files:           []*discordgo.File{{Name: a.Filename, ContentType: contentType, Reader: bytes.NewReader(data)}},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(msg.Attachments) == 0 {
+		return "", errors.New("the archived message has no attachment")
+	}
+	return msg.Attachments[0].URL, nil
+}
+
+// channelInaccessible reports whether err is Discord refusing access to a
+// channel, or not knowing it.
+func channelInaccessible(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) || restErr.Response == nil {
+		return false
+	}
+	switch restErr.Response.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// handlePhoto implements `!photo "Name"` with an attached image, and
+// `!photo "Name" remove`. The image is archived in the photo channel and
+// shown with the restaurant's info and poll entries.
+func handlePhoto(c *Context) {
+	name, rest, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("photo.usage", nil)
+		return
+	}
+	if strings.EqualFold(rest, "remove") {
+		canonical, err := SetPhoto(c.GuildID, name, "")
+		if err != nil {
+			log.Printf("Failed to remove photo: %v", err)
+			c.replyError("photo.failed", err, name)
+			return
+		}
+		c.Ack("photo.removed", Args{"name": canonical})
+		return
+	}
+	a := photoAttachment(c.Message.Message)
+	if rest != "" || a == nil {
+		c.Reply("photo.usage", nil)
+		return
+	}
+	if c.Config.PhotoChannelID == "" {
+		c.Reply("photo.no_channel", nil)
+		return
+	}
+	if a.Size > maxPhotoSize {
+		c.Reply("photo.too_large", Args{"size": maxPhotoSize >> 20})
+		return
+	}
+	r, err := GetRestaurant(c.GuildID, name)
+	if err != nil {
+		log.Printf("Failed to get restaurant: %v", err)
+		c.replyError("photo.failed", err, name)
+		return
+	}
+
+	data, err := downloadAttachment(c.Ctx, a, maxPhotoSize)
+	if err != nil {
+		if c.timedOut(err) {
+			return
+		}
+		log.Printf("Failed to download photo %s: %v", a.URL, err)
+		c.Reply("photo.download_failed", nil)
+		return
+	}
+	contentType := photoType(a, data)
+	if !photoTypes[contentType] {
+		c.Reply("photo.invalid_type", Args{"type": contentType})
+		return
+	}
+	url, err := archivePhoto(c, r, a, contentType, data)
+	if err != nil {
+		if c.timedOut(err) {
+			return
+		}
+		log.Printf("Failed to archive photo in %s: %v", c.Config.PhotoChannelID, err)
+		if channelInaccessible(err) {
+			c.Reply("photo.channel_inaccessible", Args{"channel": "<#" + c.Config.PhotoChannelID + ">"})
+		} else {
+			c.Reply("photo.upload_failed", nil)
+		}
+		return
+	}
+	canonical, err := SetPhoto(c.GuildID, r.Name, url)
+	if err != nil {
+		log.Printf("Failed to set photo: %v", err)
+		c.replyError("photo.failed", err, name)
+		return
+	}
+	c.Ack("photo.done", Args{"name": canonical})
+}
+
+// handlePhotoSetting implements `!settings photos #channel|off`, choosing the
+// channel photos are archived in.
+func handlePhotoSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Send(photoSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	channelID := ""
+	if !strings.EqualFold(fields[0], "off") {
+		var ok bool
+		if channelID, ok = parseChannelMention(fields[0]); !ok || len(fields) != 1 {
+			c.Reply("settings.photos_usage", nil)
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.PhotoChannelID = channelID
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save photo channel: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.PhotoChannelID = channelID
+	c.Send(photoSettingLine(c.Config))
+}
+
+// photoSettingLine describes where photos are archived.
+func photoSettingLine(cfg GuildConfig) string {
+	if cfg.PhotoChannelID == "" {
+		return cfg.T("settings.photos_off", nil)
+	}
+	return cfg.T("settings.photos", Args{"channel": "<#" + cfg.PhotoChannelID + ">"})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// pickAcceptWindow is how long a suggestion can be accepted after it was made.
+	pickAcceptWindow = 12 * time.Hour
+	// pickRetention is how long accepted picks are kept.
+	pickRetention = 90 * 24 * time.Hour
+)
+
+var (
+	// ErrPickNotFound is returned when accepting a suggestion that isn't stored or has expired.
+	ErrPickNotFound = errors.New("suggestion not found")
+	// ErrPickAccepted is returned when accepting a suggestion twice.
+	ErrPickAccepted = errors.New("suggestion already accepted")
+)
+
+// Pick is a restaurant suggested by !random or a scheduled suggestion.
+type Pick struct {
+	Name      string    `json:"name"`
+	ChannelID string    `json:"channel_id"`
+	MessageID string    `json:"message_id"`
+	At        time.Time `json:"at"`
+	// AcceptedBy is the member who accepted the suggestion, nil while it is open.
+	AcceptedBy *Contributor `json:"accepted_by,omitempty"`
+	AcceptedAt time.Time    `json:"accepted_at,omitzero"`
+}
+
+// accepted reports whether the suggestion was accepted.
+func (p Pick) accepted() bool {
+	return p.AcceptedBy != nil
+}
+
+// prunePicks drops suggestions that can no longer be accepted and old accepted picks.
+func (g *GuildData) prunePicks(now time.Time) {
+	kept := g.Picks[:0]
+	for _, p := range g.Picks {
+		if (p.accepted() && now.Sub(p.AcceptedAt) < pickRetention) || now.Sub(p.At) < pickAcceptWindow {
+			kept = append(kept, p)
+		}
+	}
+	g.Picks = kept
+}
+
+// postPick suggests a restaurant in a channel with a button to accept it,
+// below a label when one is given.
+func postPick(s *discordgo.Session, guildID, channelID string, cfg GuildConfig, r Restaurant, label string) error {
+	content := pickMessage(cfg, r.Name)
+	if label != "" {
+		content = label + "\n" + content
+	}
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: content,
+		Components: []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: cfg.T("button.accept", nil), Style: discordgo.SuccessButton, CustomID: "pick:accept"},
+		)},
+	})
+	if err != nil {
+		return err
+	}
+	return updateGuild(guildID, func(g *GuildData) error {
+		now := time.Now().UTC()
+		g.prunePicks(now)
+		g.Picks = append(g.Picks, Pick{Name: r.Name, ChannelID: channelID, MessageID: msg.ID, At: now})
+		return nil
+	})
+}
+
+// AcceptPick accepts the suggestion made in a message and records a visit to
+// its restaurant. It returns the accepted pick.
+func AcceptPick(guildID, messageID string, by Contributor, now time.Time) (Pick, error) {
+	var pick Pick
+	err := updateGuild(guildID, func(g *GuildData) error {
+		g.prunePicks(now)
+		p := -1
+		for i := range g.Picks {
+			if g.Picks[i].MessageID == messageID {
+				p = i
+			}
+		}
+		if p < 0 {
+			return ErrPickNotFound
+		}
+		if g.Picks[p].accepted() {
+			return ErrPickAccepted
+		}
+		i, err := g.lookup(g.Picks[p].Name)
+		if err != nil {
+			return err
+		}
+		visit := Visit{Date: now.UTC(), Attendees: g.tracked([]string{by.ID}), RecordedBy: by.ID}
+		g.Restaurants[i].Visits = append(g.Restaurants[i].Visits, visit)
+		g.promptRating(&g.Restaurants[i], visit, g.Picks[p].ChannelID)
+		g.Picks[p].AcceptedBy = &by
+		g.Picks[p].AcceptedAt = now.UTC()
+		pick = g.Picks[p]
+		return nil
+	})
+	return pick, err
+}
+
+// handlePickComponent handles the Accept button of a suggestion.
+func handlePickComponent(i *Interaction) {
+	by := contributorFor(i.Event.Member.User)
+	pick, err := AcceptPick(i.Event.GuildID, i.Event.Message.ID, by, time.Now())
+	switch {
+	case errors.Is(err, ErrPickAccepted):
+		i.Ephemeral("pick.already_accepted", nil)
+	case errors.Is(err, ErrPickNotFound):
+		i.Update(i.Event.Message.Content+"\n"+i.T("pick.expired", nil), nil)
+	case err != nil:
+		log.Printf("Failed to accept pick: %v", err)
+		i.Ephemeral("pick.failed", nil)
+	default:
+		i.Update(i.Event.Message.Content+"\n"+i.T("pick.accepted", Args{"name": pick.Name, "user": by.Name}), nil)
+		followUpReservation(i.Session, i.Event.GuildID, i.Event.ChannelID, i.Config, pick.Name)
+		noteDecision(i.Session, i.Event.GuildID, i.Event.ChannelID, i.Config, pick.Name, decisionPick)
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// pollSize is the number of candidates offered by a poll.
+	pollSize = 4
+	// pollDuration is how long a poll stays open unless the poll or guild says otherwise.
+	pollDuration = 30 * time.Minute
+	// minPollDuration and maxPollDuration bound the duration of a poll.
+	minPollDuration = time.Minute
+	maxPollDuration = 24 * time.Hour
+	// maxPollQuorum bounds the quorum of a poll. It is the most voters
+	// Discord lists per reaction in one request.
+	maxPollQuorum = 100
+)
+
+// pollEmojis are the reactions members vote with, one per candidate.
+var pollEmojis = []string{"1️⃣", "2️⃣", "3️⃣", "4️⃣"}
+
+// Poll is an open lunch poll.
+type Poll struct {
+	ChannelID string   `json:"channel_id"`
+	MessageID string   `json:"message_id"`
+	Options   []string `json:"options"`
+	// Emojis are the reactions voting for each option, the restaurant's own
+	// emoji where it has one and a number otherwise.
+	Emojis []string `json:"emojis,omitempty"`
+	// Filter is the filter expression the candidates were drawn with, if any.
+	Filter   string    `json:"filter,omitempty"`
+	ClosesAt time.Time `json:"closes_at"`
+	// Duration is how long the poll was opened for, 0 for polls from before it was recorded.
+	Duration time.Duration `json:"duration,omitempty"`
+	// Quorum is the number of distinct voters needed to declare a winner, 0 for none.
+	Quorum int `json:"quorum,omitempty"`
+	// Extended is set once the poll was kept open for lack of a quorum.
+	Extended bool `json:"extended,omitempty"`
+	// Anonymous polls collect ballots by direct message instead of reactions.
+	Anonymous bool `json:"anonymous,omitempty"`
+	// Ballots maps the members who voted in an anonymous poll to the option
+	// they chose. They are deleted with the poll once its result is out.
+	Ballots map[string]int `json:"ballots,omitempty"`
+	// Participants are the members an anonymous poll sent ballots to.
+	Participants []string `json:"participants,omitempty"`
+	// Flow is the ID of the !lunch the poll belongs to, if any.
+	Flow string `json:"flow,omitempty"`
+}
+
+// parsePollDuration parses a poll duration like 20m or 2h, reporting false
+// when it is outside minPollDuration and maxPollDuration.
+func parsePollDuration(s string) (time.Duration, bool) {
+	d, err := time.ParseDuration(strings.ToLower(s))
+	if err != nil || d < minPollDuration || d > maxPollDuration {
+		return 0, false
+	}
+	return d, true
+}
+
+// parsePollQuorum parses a poll quorum from 1 to maxPollQuorum.
+func parsePollQuorum(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxPollQuorum {
+		return 0, false
+	}
+	return n, true
+}
+
+// pollOptions returns the duration and quorum of a poll drawn with the
+// query, falling back to the guild defaults.
+func (q *Query) pollOptions(cfg GuildConfig) (time.Duration, int) {
+	return cmp.Or(q.Duration, cfg.PollDuration, pollDuration), cmp.Or(q.Quorum, cfg.PollQuorum)
+}
+
+// emoji returns the reaction that votes for option i.
+func (p Poll) emoji(i int) string {
+	if i < len(p.Emojis) {
+		return p.Emojis[i]
+	}
+	return pollEmojis[i]
+}
+
+// pollCandidates draws the candidates of a poll, favouring restaurants that
+// haven't been visited for a while.
+func pollCandidates(restaurants []Restaurant, query *Query, now time.Time) []Restaurant {
+	return weightedSample(query.Apply(restaurants), pollSize, func(r Restaurant) float64 { return recencyWeight(r, now) })
+}
+
+// handlePoll implements `!poll [anonymous] [filter] [@member...]`, honouring
+// the dietary profiles of the mentioned members. Anonymous polls send ballots
+// to the author and the mentioned members.
+func handlePoll(c *Context) {
+	if first, rest, _ := strings.Cut(c.Args, " "); strings.EqualFold(first, "again") {
+		handlePollAgain(c, strings.TrimSpace(rest))
+		return
+	}
+	query, ok := parsePickQuery(c)
+	if !ok {
+		return
+	}
+	query.require(c.Config)
+	if !c.applyGroup(query) {
+		return
+	}
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	now := time.Now().UTC()
+	candidates := pollCandidates(restaurants, query, now)
+	if len(candidates) == 0 && len(query.Needs) > 0 {
+		c.replyGroupNoMatch(query, restaurants)
+		return
+	}
+	if len(candidates) < 2 {
+		c.Reply("poll.too_few", Args{"count": len(candidates)})
+		return
+	}
+
+	if query.Anonymous {
+		query.Members = append([]string{c.Message.Author.ID}, slices.DeleteFunc(query.Members, func(id string) bool { return id == c.Message.Author.ID })...)
+		if len(query.Members) < 2 {
+			c.Reply("ballot.no_participants", nil)
+			return
+		}
+	}
+	startPollAdjust(c, query.Apply(restaurants), candidates, query)
+}
+
+// postPoll sends a poll between candidates to a channel, adds the voting
+// reactions or sends the ballots of an anonymous poll, and saves the poll so
+// that it is closed when its time is up.
+func postPoll(s *discordgo.Session, guildID, channelID string, cfg GuildConfig, candidates []Restaurant, query *Query, now time.Time) error {
+	duration, quorum := query.pollOptions(cfg)
+	poll := Poll{ChannelID: channelID, Filter: query.Input, ClosesAt: now.Add(duration), Duration: duration, Quorum: quorum, Anonymous: query.Anonymous, Flow: query.Flow}
+	lines := []string{cfg.T("poll.header", Args{"time": fmt.Sprintf("<t:%d:R>", poll.ClosesAt.Unix())})}
+	if poll.Anonymous {
+		poll.Participants = query.Members
+		lines[0] = cfg.T("ballot.header", Args{"time": fmt.Sprintf("<t:%d:R>", poll.ClosesAt.Unix()), "count": len(query.Members)})
+	}
+	if quorum > 0 {
+		lines = append(lines, cfg.T("poll.quorum", Args{"count": quorum}))
+	}
+	used := map[string]bool{}
+	var embeds []*discordgo.MessageEmbed
+	for _, r := range candidates {
+		if embed := previewEmbed(r); embed != nil {
+			embeds = append(embeds, embed)
+		}
+		emoji := r.Emoji
+		for n := 0; emoji == "" || used[emoji]; n++ {
+			emoji = pollEmojis[n]
+		}
+		used[emoji] = true
+		poll.Options = append(poll.Options, r.Name)
+		poll.Emojis = append(poll.Emojis, emoji)
+		line := emoji + " " + r.Name
+		if len(r.Payment) > 0 {
+			line += " (" + strings.Join(r.Payment, ", ") + ")"
+		}
+		lines = append(lines, line)
+	}
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Content: strings.Join(lines, "\n"), Embeds: embeds})
+	if err != nil {
+		return err
+	}
+	poll.MessageID = msg.ID
+	if poll.Anonymous {
+		// The poll is saved first so that early ballots find it.
+		if err := updateGuild(guildID, func(g *GuildData) error {
+			g.Polls = append(g.Polls, poll)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if unreachable := sendBallots(s, guildID, cfg, poll, query.Members); unreachable > 0 {
+			if _, err := s.ChannelMessageSend(channelID, cfg.T("ballot.unreachable", Args{"count": unreachable})); err != nil {
+				log.Printf("Failed to report unreachable voters: %v", err)
+			}
+		}
+		return nil
+	}
+	for i := range poll.Options {
+		if err := s.MessageReactionAdd(msg.ChannelID, msg.ID, restaurantEmoji(poll.emoji(i)).APIName()); err != nil {
+			log.Printf("Failed to add poll reaction: %v", err)
+		}
+	}
+
+	return updateGuild(guildID, func(g *GuildData) error {
+		g.Polls = append(g.Polls, poll)
+		return nil
+	})
+}
+
+// tallyPoll counts the votes on a poll message, not counting the bot's own reactions.
+func tallyPoll(msg *discordgo.Message, poll Poll) []int {
+	votes := make([]int, len(poll.Options))
+	for _, reaction := range msg.Reactions {
+		for i := range poll.Options {
+			if reaction.Emoji != nil && sameEmoji(reaction.Emoji, restaurantEmoji(poll.emoji(i))) {
+				votes[i] = reaction.Count
+				if reaction.Me {
+					votes[i]--
+				}
+			}
+		}
+	}
+	return votes
+}
+
+// countVoters returns the number of distinct members who reacted with a
+// voting emoji, not counting bots. Only the first maxPollQuorum voters of each
+// option are seen, which is enough to decide any quorum.
+func countVoters(s *discordgo.Session, poll Poll) (int, error) {
+	voters := map[string]bool{}
+	for i := range poll.Options {
+		users, err := s.MessageReactions(poll.ChannelID, poll.MessageID, restaurantEmoji(poll.emoji(i)).APIName(), maxPollQuorum, "", "")
+		if err != nil {
+			return 0, err
+		}
+		for _, u := range users {
+			if !u.Bot {
+				voters[u.ID] = true
+			}
+		}
+	}
+	return len(voters), nil
+}
+
+// pollVotes returns the votes for each option of a poll and the number of
+// distinct voters, which is only counted when the poll has a quorum.
+func pollVotes(s *discordgo.Session, poll Poll) ([]int, int, error) {
+	if poll.Anonymous {
+		votes := ballotTally(poll)
+		return votes, len(poll.Ballots), nil
+	}
+	msg, err := s.ChannelMessage(poll.ChannelID, poll.MessageID)
+	if err != nil {
+		return nil, 0, err
+	}
+	votes := tallyPoll(msg, poll)
+	if poll.Quorum == 0 {
+		return votes, 0, nil
+	}
+	voters, err := countVoters(s, poll)
+	if err != nil {
+		// Fall back to the reaction counts, which overcount members voting twice.
+		log.Printf("Failed to count voters of poll %s: %v", poll.MessageID, err)
+		voters = 0
+		for _, v := range votes {
+			voters += v
+		}
+	}
+	return votes, voters, nil
+}
+
+// announcePollResult posts the outcome of a closed poll with its chart.
+func announcePollResult(s *discordgo.Session, cfg GuildConfig, poll Poll, text string, votes []int, highlight bool) {
+	if _, err := s.ChannelMessageSendComplex(poll.ChannelID, &discordgo.MessageSend{
+		Content: text,
+		Embeds:  []*discordgo.MessageEmbed{pollChartEmbed(cfg, poll, votes, highlight)},
+	}); err != nil {
+		log.Printf("Failed to announce poll result: %v", err)
+	}
+}
+
+// extendPoll keeps a poll that lacks a quorum open for half its duration
+// more, once. It reports false when the poll is gone or was extended before.
+func extendPoll(guildID, messageID string, now time.Time) (Poll, bool, error) {
+	var extended Poll
+	var ok bool
+	err := updateGuild(guildID, func(g *GuildData) error {
+		for i := range g.Polls {
+			p := &g.Polls[i]
+			if p.MessageID != messageID || p.Extended {
+				continue
+			}
+			p.Extended = true
+			p.ClosesAt = now.UTC().Add(cmp.Or(p.Duration, pollDuration) / 2)
+			extended, ok = *p, true
+		}
+		return nil
+	})
+	return extended, ok, err
+}
+
+// pollWinners returns the options with the most votes and their vote count.
+func pollWinners(poll Poll, votes []int) ([]string, int) {
+	best := 0
+	for _, v := range votes {
+		best = max(best, v)
+	}
+	if best == 0 {
+		return nil, 0
+	}
+	var winners []string
+	for i, v := range votes {
+		if v == best {
+			winners = append(winners, poll.Options[i])
+		}
+	}
+	return winners, best
+}
+
+// pollResult announces the outcome of a poll from its votes.
+func pollResult(cfg GuildConfig, poll Poll, votes []int) string {
+	winners, best := pollWinners(poll, votes)
+	if len(winners) == 0 {
+		return cfg.T("poll.no_votes", nil)
+	}
+	if len(winners) > 1 {
+		return cfg.T("poll.tie", Args{"names": strings.Join(winners, ", "), "count": best})
+	}
+	return cfg.T("poll.winner", Args{"name": winners[0], "count": best})
+}
+
+// closeDuePolls announces the results of every poll whose time is up.
+func closeDuePolls(s *discordgo.Session, now time.Time) {
+	type duePoll struct {
+		guildID string
+		cfg     GuildConfig
+		poll    Poll
+	}
+	var due []duePoll
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		for _, p := range g.Polls {
+			if !now.Before(p.ClosesAt) {
+				due = append(due, duePoll{guildID, g.Config, p})
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check open polls: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		var record *PollRecord
+		if votes, voters, err := pollVotes(s, d.poll); err != nil {
+			log.Printf("Failed to load poll %s: %v", d.poll.MessageID, err)
+		} else {
+			record = &PollRecord{ClosedAt: now.UTC(), Voters: pollParticipants(d.poll, votes, voters)}
+			switch {
+			case voters < d.poll.Quorum && !d.poll.Extended:
+				// The extension is saved before it is announced, so a restart
+				// in between can't extend the poll twice.
+				extended, ok, err := extendPoll(d.guildID, d.poll.MessageID, now)
+				if err != nil {
+					log.Printf("Failed to extend poll %s: %v", d.poll.MessageID, err)
+				}
+				if ok {
+					text := d.cfg.T("poll.extended", Args{"count": voters, "quorum": d.poll.Quorum, "time": fmt.Sprintf("<t:%d:R>", extended.ClosesAt.Unix())})
+					if _, err := s.ChannelMessageSend(d.poll.ChannelID, text); err != nil {
+						log.Printf("Failed to announce poll extension: %v", err)
+					}
+				}
+				continue
+			case voters < d.poll.Quorum:
+				text := d.cfg.T("poll.no_quorum", Args{"count": voters, "quorum": d.poll.Quorum})
+				announcePollResult(s, d.cfg, d.poll, text, votes, false)
+				lunchPollClosed(s, d.guildID, d.cfg, d.poll, nil, now)
+			default:
+				text := pollResult(d.cfg, d.poll, votes)
+				if d.poll.Anonymous {
+					text += "\n" + d.cfg.T("ballot.count", Args{"count": voters})
+				}
+				announcePollResult(s, d.cfg, d.poll, text, votes, true)
+				winners, _ := pollWinners(d.poll, votes)
+				if len(winners) == 1 {
+					followUpReservation(s, d.guildID, d.poll.ChannelID, d.cfg, winners[0])
+					noteDecision(s, d.guildID, d.poll.ChannelID, d.cfg, winners[0], decisionPoll)
+				}
+				lunchPollClosed(s, d.guildID, d.cfg, d.poll, winners, now)
+			}
+		}
+
+		err := updateGuild(d.guildID, func(g *GuildData) error {
+			kept := g.Polls[:0]
+			for _, p := range g.Polls {
+				if p.MessageID != d.poll.MessageID {
+					kept = append(kept, p)
+				}
+			}
+			g.Polls = kept
+			g.rememberPoll(d.poll, now)
+			if record != nil {
+				g.recordPoll(*record)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to close poll %s: %v", d.poll.MessageID, err)
+		}
+	}
+}
+
+// handlePollSetting implements `!settings poll [duration:D|default] [quorum:N|off]`.
+func handlePollSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.SendQuiet(pollSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	duration, quorum := c.Config.PollDuration, c.Config.PollQuorum
+	for _, f := range fields {
+		key, value, _ := strings.Cut(strings.ToLower(f), ":")
+		var ok bool
+		switch {
+		case key == "duration" && value == "default":
+			duration, ok = 0, true
+		case key == "duration":
+			duration, ok = parsePollDuration(value)
+		case key == "quorum" && value == "off":
+			quorum, ok = 0, true
+		case key == "quorum":
+			quorum, ok = parsePollQuorum(value)
+		}
+		if !ok {
+			c.Reply("settings.poll_usage", Args{"max": maxPollQuorum})
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.PollDuration, g.Config.PollQuorum = duration, quorum
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save poll defaults: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.PollDuration, c.Config.PollQuorum = duration, quorum
+	c.SendQuiet(pollSettingLine(c.Config))
+}
+
+// pollSettingLine describes the guild's poll defaults.
+func pollSettingLine(cfg GuildConfig) string {
+	minutes := int(cmp.Or(cfg.PollDuration, pollDuration).Minutes())
+	if cfg.PollQuorum == 0 {
+		return cfg.T("settings.poll_no_quorum", Args{"count": minutes})
+	}
+	return cfg.T("settings.poll", Args{"count": minutes, "quorum": cfg.PollQuorum})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pollAdjustWindow is how long the organizer of a poll may adjust its
+// candidates before voting opens.
+const pollAdjustWindow = 30 * time.Second
+
+// pendingPoll is a poll whose candidates are drawn but whose voting hasn't
+// opened yet.
+type pendingPoll struct {
+	guildID   string
+	channelID string
+	// userID is the organizer, the only member who may adjust the poll.
+	userID string
+	cfg    GuildConfig
+	query  *Query
+	// pool holds every restaurant matching the poll's filter, which
+	// replacements are drawn from.
+	pool       []Restaurant
+	candidates []Restaurant
+	// dropped are the IDs of the restaurants removed from the poll, never
+	// drawn again.
+	dropped   []string
+	messageID string
+	expires   time.Time
+}
+
+var (
+	// pendingPolls stores polls in their adjustment window, keyed by token.
+	pendingPolls      = make(map[string]*pendingPoll)
+	pendingPollsMutex sync.Mutex
+)
+
+// startPollAdjust shows the drawn candidates to the organizer, who can drop
+// and replace some of them or start the poll right away. Voting opens when
+// the window ends.
+func startPollAdjust(c *Context, pool, candidates []Restaurant, query *Query) {
+	token := newToken()
+	op := &pendingPoll{
+		guildID: c.GuildID, channelID: c.Message.ChannelID, userID: c.Message.Author.ID,
+		cfg: c.Config, query: query, pool: pool, candidates: candidates,
+		expires: time.Now().Add(pollAdjustWindow),
+	}
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content:         pollAdjustContent(op),
+		Components:      pollAdjustButtons(op.cfg, token),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to send poll candidates: %v", err)
+		return
+	}
+	op.messageID = msg.ID
+	pendingPollsMutex.Lock()
+	pendingPolls[token] = op
+	pendingPollsMutex.Unlock()
+
+	time.AfterFunc(pollAdjustWindow, func() {
+		op := takePendingPoll(token)
+		if op == nil {
+			return
+		}
+		content := op.cfg.T("poll.adjust_started", nil)
+		components := []discordgo.MessageComponent{}
+		if _, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: op.messageID, Channel: op.channelID, Content: &content, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to close poll candidates: %v", err)
+		}
+		openPendingPoll(c.Session, op)
+	})
+}
+
+// takePendingPoll removes a pending poll, returning nil if it already started.
+func takePendingPoll(token string) *pendingPoll {
+	pendingPollsMutex.Lock()
+	defer pendingPollsMutex.Unlock()
+	op := pendingPolls[token]
+	delete(pendingPolls, token)
+	return op
+}
+
+// openPendingPoll opens voting on a pending poll.
+func openPendingPoll(s *discordgo.Session, op *pendingPoll) {
+	if err := postPoll(s, op.guildID, op.channelID, op.cfg, op.candidates, op.query, time.Now().UTC()); err != nil {
+		log.Printf("Failed to start poll: %v", err)
+		if _, err := s.ChannelMessageSend(op.channelID, op.cfg.T("poll.failed", nil)); err != nil {
+			log.Printf("Failed to report poll failure: %v", err)
+		}
+	}
+}
+
+// pollAdjustContent lists the candidates of a pending poll.
+func pollAdjustContent(op *pendingPoll) string {
+	lines := []string{op.cfg.T("poll.adjust_header", Args{"time": fmt.Sprintf("<t:%d:R>", op.expires.Unix())})}
+	for _, r := range op.candidates {
+		lines = append(lines, "- "+r.Name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pollAdjustButtons builds the Adjust candidates and Start now buttons.
+func pollAdjustButtons(cfg GuildConfig, token string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{buttonRow(
+		discordgo.Button{Label: cfg.T("button.adjust_candidates", nil), Style: discordgo.SecondaryButton, CustomID: "polladj:" + token + ":adjust"},
+		discordgo.Button{Label: cfg.T("button.start_now", nil), Style: discordgo.PrimaryButton, CustomID: "polladj:" + token + ":start"},
+	)}
+}
+
+// pollAdjustMenu builds the menu of candidates to drop, followed by the buttons.
+func pollAdjustMenu(op *pendingPoll, token string) []discordgo.MessageComponent {
+	var options []discordgo.SelectMenuOption
+	for _, r := range op.candidates {
+		options = append(options, discordgo.SelectMenuOption{Label: truncateRunes(r.Name, 100), Value: r.ID})
+	}
+	one := 1
+	menu := discordgo.SelectMenu{
+		MenuType:    discordgo.StringSelectMenu,
+		CustomID:    "polladj:" + token + ":drop",
+		Placeholder: op.cfg.T("poll.adjust_placeholder", nil),
+		MinValues:   &one,
+		MaxValues:   len(options),
+		Options:     options,
+	}
+	return append([]discordgo.MessageComponent{discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}}}, pollAdjustButtons(op.cfg, token)...)
+}
+
+// dropCandidates replaces the candidates with the given IDs by others drawn
+// from the pool the same way, never drawing a dropped restaurant again.
+func (op *pendingPoll) dropCandidates(ids []string) {
+	n := len(op.candidates)
+	op.candidates = slices.DeleteFunc(op.candidates, func(r Restaurant) bool { return slices.Contains(ids, r.ID) })
+	op.dropped = append(op.dropped, ids...)
+	rest := slices.DeleteFunc(slices.Clone(op.pool), func(r Restaurant) bool {
+		return slices.Contains(op.dropped, r.ID) || slices.ContainsFunc(op.candidates, func(c Restaurant) bool { return c.ID == r.ID })
+	})
+	now := time.Now()
+	replacements := weightedSample(rest, n-len(op.candidates), func(r Restaurant) float64 { return recencyWeight(r, now) })
+	op.candidates = append(op.candidates, replacements...)
+}
+
+// handlePollAdjustComponent handles the buttons and menu of a poll's
+// adjustment window.
+func handlePollAdjustComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pendingPollsMutex.Lock()
+	op, ok := pendingPolls[token]
+	if !ok {
+		pendingPollsMutex.Unlock()
+		i.Ephemeral("poll.adjust_closed", nil)
+		return
+	}
+	if i.UserID() != op.userID {
+		pendingPollsMutex.Unlock()
+		i.Ephemeral("poll.adjust_not_yours", nil)
+		return
+	}
+
+	switch action {
+	case "adjust":
+		content, components := pollAdjustContent(op), pollAdjustMenu(op, token)
+		pendingPollsMutex.Unlock()
+		i.Update(content, components)
+
+	case "drop":
+		ids := i.Event.MessageComponentData().Values
+		prev := slices.Clone(op.candidates)
+		prevDropped := len(op.dropped)
+		if op.dropCandidates(ids); len(op.candidates) < 2 {
+			// Too few restaurants are left to replace them.
+			op.candidates, op.dropped = prev, op.dropped[:prevDropped]
+			pendingPollsMutex.Unlock()
+			i.Ephemeral("poll.adjust_too_few", nil)
+			return
+		}
+		content := pollAdjustContent(op)
+		pendingPollsMutex.Unlock()
+		i.Update(content, pollAdjustButtons(op.cfg, token))
+
+	case "start":
+		delete(pendingPolls, token)
+		pendingPollsMutex.Unlock()
+		i.Update(i.T("poll.adjust_started", nil), nil)
+		openPendingPoll(i.Session, op)
+
+	default:
+		pendingPollsMutex.Unlock()
+	}
+}
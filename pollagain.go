@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pollRerunWindow is how long after closing a poll can be run again.
+const pollRerunWindow = 24 * time.Hour
+
+var (
+	// ErrNoLastPoll is returned when a channel had no poll within pollRerunWindow.
+	ErrNoLastPoll = errors.New("no recent poll")
+	// ErrNotCandidate is returned when leaving out a restaurant the last poll didn't offer.
+	ErrNotCandidate = errors.New("not a candidate")
+)
+
+// rememberPoll keeps a closed poll as the last one of its channel, without
+// its ballots, and forgets polls closed more than pollRerunWindow ago.
+func (g *GuildData) rememberPoll(p Poll, now time.Time) {
+	p.Ballots = nil
+	g.LastPolls = slices.DeleteFunc(g.LastPolls, func(old Poll) bool {
+		return old.ChannelID == p.ChannelID || now.Sub(old.ClosesAt) > pollRerunWindow
+	})
+	g.LastPolls = append(g.LastPolls, p)
+}
+
+// lastPoll returns the last poll closed in a channel within pollRerunWindow.
+func (g *GuildData) lastPoll(channelID string, now time.Time) (Poll, bool) {
+	for _, p := range g.LastPolls {
+		if p.ChannelID == channelID && now.Sub(p.ClosesAt) <= pollRerunWindow {
+			return p, true
+		}
+	}
+	return Poll{}, false
+}
+
+// handlePollAgain implements `!poll again [-"Name"]`, running the channel's
+// last poll again with the same candidates, optionally leaving one out.
+func handlePollAgain(c *Context, args string) {
+	var drop string
+	if args != "" {
+		ref, rest, ok := parseRef(strings.TrimPrefix(args, "-"))
+		if !strings.HasPrefix(args, "-") || !ok || ref == "" || rest != "" {
+			c.Reply("poll.again_usage", nil)
+			return
+		}
+		drop = ref
+	}
+
+	now := time.Now().UTC()
+	var last Poll
+	var candidates []Restaurant
+	var dropName string
+	err := viewGuild(c.GuildID, func(g *GuildData) error {
+		var ok bool
+		if last, ok = g.lastPoll(c.Message.ChannelID, now); !ok {
+			return ErrNoLastPoll
+		}
+		dropped := -1
+		if drop != "" {
+			i, err := g.lookup(drop)
+			if err != nil {
+				return err
+			}
+			dropped, dropName = i, g.Restaurants[i].Name
+		}
+		found := false
+		for _, name := range last.Options {
+			i, err := g.lookup(name)
+			if err != nil || g.Restaurants[i].IsArchived() || g.Restaurants[i].unavailableOn(localDate(now, g.Config.location())) {
+				continue
+			}
+			if i == dropped {
+				found = true
+				continue
+			}
+			candidates = append(candidates, g.Restaurants[i])
+		}
+		if dropped >= 0 && !found {
+			return ErrNotCandidate
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrNoLastPoll):
+		c.Reply("poll.again_none", Args{"hours": int(pollRerunWindow.Hours())})
+		return
+	case errors.Is(err, ErrNotCandidate):
+		c.Reply("poll.again_not_candidate", Args{"name": dropName})
+		return
+	case err != nil:
+		log.Printf("Failed to load last poll: %v", err)
+		c.replyError("poll.failed", err, drop)
+		return
+	}
+	if len(candidates) < 2 {
+		c.Reply("poll.too_few", Args{"count": len(candidates)})
+		return
+	}
+
+	query := &Query{Input: last.Filter, Duration: last.Duration, Quorum: last.Quorum, Anonymous: last.Anonymous, Members: last.Participants}
+	if err := postPoll(c.Session, c.GuildID, c.Message.ChannelID, c.Config, candidates, query, now); err != nil {
+		log.Printf("Failed to start poll: %v", err)
+		c.Reply("poll.failed", nil)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// pollBarWidth is the number of blocks in a full result bar, narrow enough
+// to fit an embed on a phone.
+const pollBarWidth = 10
+
+// pollChart renders a poll's votes as one bar per option, most votes first.
+// Bars show each option's share of all votes; with highlight, the options
+// with the most votes are marked as winners. For example:
+//
+//	🏆 **Pizza Place**
+//	`████████░░` 8 (80%)
+func pollChart(poll Poll, votes []int, highlight bool) string {
+	total, best := 0, 0
+	for _, v := range votes {
+		total += v
+		best = max(best, v)
+	}
+	order := make([]int, len(poll.Options))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return votes[order[a]] > votes[order[b]] })
+
+	var lines []string
+	for _, i := range order {
+		filled, percent := 0, 0
+		if total > 0 {
+			filled = (votes[i]*pollBarWidth + total/2) / total
+			percent = (votes[i]*100 + total/2) / total
+		}
+		name := poll.emoji(i) + " " + poll.Options[i]
+		if highlight && best > 0 && votes[i] == best {
+			name = "🏆 **" + poll.Options[i] + "**"
+		}
+		bar := strings.Repeat("█", filled) + strings.Repeat("░", pollBarWidth-filled)
+		lines = append(lines, name, fmt.Sprintf("`%s` %d (%d%%)", bar, votes[i], percent))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pollChartEmbed wraps a poll's chart in an embed.
+func pollChartEmbed(cfg GuildConfig, poll Poll, votes []int, highlight bool) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       cfg.T("poll.chart_title", nil),
+		Description: pollChart(poll, votes, highlight),
+		Color:       previewColor,
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestPollChart(t *testing.T) {
+	poll := Poll{Options: []string{"Pizza Place", "Sushi Bar", "Taco Truck"}}
+	tests := []struct {
+		name      string
+		votes     []int
+		highlight bool
+	}{
+		{"zero-votes", []int{0, 0, 0}, true},
+		{"tie", []int{3, 1, 3}, true},
+		{"tie-plain", []int{3, 1, 3}, false},
+		{"full-bar", []int{0, 7, 0}, true},
+		{"rounding", []int{1, 1, 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pollChart(poll, tt.votes, tt.highlight)
+			checkGolden(t, "pollchart/"+tt.name+".golden", []byte(got+"\n"))
+		})
+	}
+}
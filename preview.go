@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// previewFetchLimit bounds how much of a page is read for its metadata.
+	previewFetchLimit = 512 << 10
+	// previewInterval is how often a link is fetched at most.
+	previewInterval = 24 * time.Hour
+	// maxPreviewTitle and maxPreviewDescription bound the stored metadata, in runes.
+	maxPreviewTitle       = 200
+	maxPreviewDescription = 300
+	// previewColor is the accent color of link preview embeds.
+	previewColor = 0x2a9d8f
+)
+
+// LinkPreview is the Open Graph metadata of a restaurant's link.
+type LinkPreview struct {
+	// URL is the link the metadata was fetched from.
+	URL         string    `json:"url"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// previewClient fetches link previews. It is short on patience, since
+// previews are a nicety, and won't connect to private addresses.
+var previewClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 3 * time.Second, Control: publicAddressOnly}).DialContext,
+	},
+}
+
+// publicAddressOnly refuses connections to loopback, private and link-local addresses.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("refusing to connect to %s", host)
+	}
+	return nil
+}
+
+var (
+	metaTagPattern   = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?is)([a-z:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	titleTagPattern  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// previewFetches remembers when each URL was last fetched, whether or not it worked.
+var previewFetches = struct {
+	sync.Mutex
+	at map[string]time.Time
+}{at: map[string]time.Time{}}
+
+// claimPreviewFetch reports whether a URL may be fetched now, recording the
+// fetch if so. Each URL is fetched at most once per previewInterval.
+func claimPreviewFetch(url string, now time.Time) bool {
+	previewFetches.Lock()
+	defer previewFetches.Unlock()
+	if last, ok := previewFetches.at[url]; ok && now.Sub(last) < previewInterval {
+		return false
+	}
+	previewFetches.at[url] = now
+	return true
+}
+
+// truncateRunes shortens s to at most n runes, marking the cut with an ellipsis.
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// parsePreview extracts the Open Graph title, description and image of an
+// HTML page, falling back to its <title> and description meta tag.
+func parsePreview(page string) LinkPreview {
+	meta := map[string]string{}
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, m := range attributePattern.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3]
+		}
+		key := strings.ToLower(attrs["property"])
+		if key == "" {
+			key = strings.ToLower(attrs["name"])
+		}
+		if _, seen := meta[key]; key != "" && !seen {
+			meta[key] = strings.TrimSpace(html.UnescapeString(attrs["content"]))
+		}
+	}
+	clean := func(s string, n int) string {
+		return truncateRunes(strings.Join(strings.Fields(s), " "), n)
+	}
+
+	p := LinkPreview{Title: meta["og:title"], Description: meta["og:description"], Image: meta["og:image"]}
+	if p.Title == "" {
+		if m := titleTagPattern.FindStringSubmatch(page); m != nil {
+			p.Title = html.UnescapeString(m[1])
+		}
+	}
+	if p.Description == "" {
+		p.Description = meta["description"]
+	}
+	p.Title, p.Description = clean(p.Title, maxPreviewTitle), clean(p.Description, maxPreviewDescription)
+	if !validLink(p.Image) {
+		p.Image = ""
+	}
+	return p
+}
+
+// fetchPreview downloads the start of a page and parses its metadata.
+func fetchPreview(ctx context.Context, url string) (LinkPreview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	req.Header.Set("User-Agent", "discord-bot link preview (+once a day)")
+	req.Header.Set("Accept", "text/html")
+	resp, err := previewClient.Do(req)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return LinkPreview{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return LinkPreview{}, fmt.Errorf("not a web page: %q", mediaType)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, previewFetchLimit))
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	p := parsePreview(string(page))
+	if p.Title == "" && p.Description == "" && p.Image == "" {
+		return LinkPreview{}, errors.New("no metadata found")
+	}
+	return p, nil
+}
+
+// refreshPreview fetches the metadata of a restaurant's link in the
+// background and stores it, unless the link changed meanwhile. Failures
+// keep the metadata already stored.
+func refreshPreview(guildID, restaurantID, link string) {
+	go func() {
+		p, err := fetchPreview(shutdownCtx, link)
+		if err != nil {
+			log.Printf("Failed to fetch preview of %s: %v", link, err)
+			return
+		}
+		p.URL, p.FetchedAt = link, time.Now().UTC()
+		if err := updateGuild(guildID, func(g *GuildData) error {
+			if i := g.findID(restaurantID); i >= 0 && g.Restaurants[i].Link == link {
+				g.Restaurants[i].Preview = &p
+			}
+			return nil
+		}); err != nil {
+			log.Printf("Failed to save preview of %s: %v", link, err)
+		}
+	}()
+}
+
+// schedulePreview starts a background fetch of a restaurant's link unless
+// it was fetched within previewInterval, reporting whether it started one.
+func schedulePreview(guildID string, r Restaurant, now time.Time) bool {
+	if r.Link == "" || r.ID == "" {
+		return false
+	}
+	if p := r.Preview; p != nil && p.URL == r.Link && now.Sub(p.FetchedAt) < previewInterval {
+		return false
+	}
+	if !claimPreviewFetch(r.Link, now) {
+		return false
+	}
+	refreshPreview(guildID, r.ID, r.Link)
+	return true
+}
+
+// previewEmbed renders a restaurant's link preview and photo, or nil if it
+// has neither.
+func previewEmbed(r Restaurant) *discordgo.MessageEmbed {
+	p := r.Preview
+	if p != nil && p.URL != r.Link {
+		p = nil
+	}
+	if p == nil && r.Photo == "" {
+		return nil
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:  r.Name,
+		Color:  previewColor,
+		Footer: &discordgo.MessageEmbedFooter{Text: r.Name},
+	}
+	if p != nil {
+		embed.URL, embed.Description = p.URL, p.Description
+		if p.Title != "" {
+			embed.Title = p.Title
+		}
+		if p.Image != "" {
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: p.Image}
+		}
+	}
+	if r.Photo != "" {
+		embed.Image = &discordgo.MessageEmbedImage{URL: r.Photo}
+	}
+	return embed
+}
+
+// handleRefresh implements `!refresh "Name"`, fetching the preview of a restaurant's link.
+func handleRefresh(c *Context) {
+	name, _, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("refresh.usage", nil)
+		return
+	}
+	r, err := GetRestaurant(c.GuildID, name)
+	if err != nil {
+		log.Printf("Failed to get restaurant: %v", err)
+		c.replyError("refresh.failed", err, name)
+		return
+	}
+	switch {
+	case r.Link == "":
+		c.Reply("refresh.no_link", Args{"name": r.Name})
+	case schedulePreview(c.GuildID, r, time.Now()):
+		c.Reply("refresh.started", Args{"name": r.Name})
+	default:
+		c.Reply("refresh.recent", Args{"name": r.Name})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errLockHeld is returned by tryLockFile when another process holds the lock.
+var errLockHeld = errors.New("the lock is held by another process")
+
+// processLock is the lock file a bot process holds on its database, so that
+// a second copy started by mistake doesn't overwrite the first one's changes.
+type processLock struct {
+	f    *os.File
+	path string
+}
+
+// processLockPath returns the lock file next to the database. Shard processes
+// started with SHARD_ID share the database, so each locks its own shard.
+func processLockPath(dbPath string) string {
+	if id, _, err := parseShardEnv(); err == nil && id >= 0 {
+		return fmt.Sprintf("%s.shard-%d.pid", dbPath, id)
+	}
+	return dbPath + ".pid"
+}
+
+// acquireProcessLock takes the lock file of the database and writes this
+// process's PID into it. It fails naming the PID of the process holding it.
+// A lock file left behind by a process that is gone is taken over, as the
+// operating system releases the lock itself when a process exits.
+func acquireProcessLock(dbPath string) (*processLock, error) {
+	path := processLockPath(dbPath)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("can't open the lock file %s: %v", path, err)
+	}
+	data, _ := io.ReadAll(f)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+
+	if err := tryLockFile(f); err != nil {
+		f.Close()
+		if !errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("can't lock %s: %v", path, err)
+		}
+		if pid > 0 && !processAlive(pid) {
+			return nil, fmt.Errorf("another bot process uses %s: the lock file %s is held, and names process %d, which isn't running here. It may run on another host or container sharing the directory. Stop it before starting this one.", dbPath, path, pid)
+		}
+		if pid > 0 {
+			return nil, fmt.Errorf("another bot process uses %s: process %d holds the lock file %s. Stop it before starting this one.", dbPath, pid, path)
+		}
+		return nil, fmt.Errorf("another bot process uses %s: the lock file %s is held. Stop it before starting this one.", dbPath, path)
+	}
+	if pid > 0 && pid != os.Getpid() {
+		log.Printf("Taking over the stale lock file %s of process %d, which didn't shut down cleanly", path, pid)
+	}
+
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, fmt.Errorf("can't write the lock file %s: %v", path, err)
+	}
+	return &processLock{f: f, path: path}, nil
+}
+
+// Release clears the PID from the lock file and releases the lock. The file
+// is left in place, as removing it could race with a process starting.
+func (l *processLock) Release() {
+	if err := l.f.Truncate(0); err != nil {
+		log.Printf("Failed to clear the lock file %s: %v", l.path, err)
+	}
+	if err := unlockFile(l.f); err != nil {
+		log.Printf("Failed to release the lock file %s: %v", l.path, err)
+	}
+	l.f.Close()
+}
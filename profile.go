@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxEliminatedNames bounds the restaurants named per member when no place suits a group.
+const maxEliminatedNames = 5
+
+// groupNeeds maps each dietary option the members need to the members needing
+// it. Members who are away on today don't count.
+func groupNeeds(members map[string]MemberSettings, ids []string, today string) map[string][]string {
+	needs := map[string][]string{}
+	for _, id := range ids {
+		m := members[id]
+		if m.away(today) {
+			continue
+		}
+		for _, d := range m.Diet {
+			needs[d] = append(needs[d], id)
+		}
+	}
+	return needs
+}
+
+// eliminatedBy returns, for each member with dietary needs, the restaurants
+// otherwise matching the query that fail those needs, sorted by name.
+func eliminatedBy(restaurants []Restaurant, q *Query) map[string][]string {
+	unconstrained := *q
+	unconstrained.Needs = nil
+	out := map[string][]string{}
+	for _, r := range unconstrained.Apply(restaurants) {
+		for flag, ids := range q.Needs {
+			if r.HasDiet(flag) {
+				continue
+			}
+			for _, id := range ids {
+				if !slices.Contains(out[id], r.Name) {
+					out[id] = append(out[id], r.Name)
+				}
+			}
+		}
+	}
+	for _, names := range out {
+		sort.Strings(names)
+	}
+	return out
+}
+
+// applyGroup restricts a pick query to restaurants catering for the dietary
+// profiles of the members it mentions, replying and returning false on failure.
+func (c *Context) applyGroup(q *Query) bool {
+	if len(q.Members) == 0 {
+		return true
+	}
+	today := localDate(time.Now(), c.Config.location())
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		q.Needs = groupNeeds(g.Members, q.Members, today)
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load dietary profiles: %v", err)
+		c.Reply("list.failed", nil)
+		return false
+	}
+	return true
+}
+
+// replyGroupNoMatch explains whose dietary needs ruled out which restaurants,
+// without revealing the needs themselves.
+func (c *Context) replyGroupNoMatch(q *Query, restaurants []Restaurant) {
+	eliminated := eliminatedBy(restaurants, q)
+	if len(q.Needs) == 0 || len(eliminated) == 0 {
+		c.replyNoMatch(q)
+		return
+	}
+	ids := make([]string, 0, len(eliminated))
+	for id := range eliminated {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	lines := []string{c.T("diet.group_none", nil)}
+	for _, id := range ids {
+		names := eliminated[id]
+		shown := strings.Join(names[:min(len(names), maxEliminatedNames)], ", ")
+		if extra := len(names) - maxEliminatedNames; extra > 0 {
+			shown += " " + c.T("diet.more", Args{"count": extra})
+		}
+		lines = append(lines, c.T("diet.eliminated", Args{"user": "<@" + id + ">", "count": len(names), "names": shown}))
+	}
+	c.SendQuiet(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// proposalDuration is how long a removal proposal collects votes.
+	proposalDuration = 24 * time.Hour
+	// defaultRemovalVotes is the number of votes that removes a restaurant by default.
+	defaultRemovalVotes = 3
+	// maxRemovalVotes bounds the configurable number of votes.
+	maxRemovalVotes = 50
+	// proposalEmoji is the reaction members vote for a removal with.
+	proposalEmoji = "👍"
+)
+
+// ErrProposalOpen is returned when a restaurant already has an open removal proposal.
+var ErrProposalOpen = errors.New("a removal proposal is already open for this restaurant")
+
+// RemovalProposal is an open vote to remove a restaurant.
+type RemovalProposal struct {
+	Name string `json:"name"`
+	// AddedAt identifies the restaurant together with its name, so that a
+	// proposal doesn't carry over to an entry re-added under the same name.
+	AddedAt   time.Time   `json:"added_at"`
+	ChannelID string      `json:"channel_id"`
+	MessageID string      `json:"message_id"`
+	By        Contributor `json:"by"`
+	// Votes is the number of votes needed, fixed when the proposal is made.
+	Votes     int       `json:"votes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// removalVotes returns the number of votes needed to remove a restaurant.
+func (cfg GuildConfig) removalVotes() int {
+	if cfg.RemovalVotes > 0 {
+		return cfg.RemovalVotes
+	}
+	return defaultRemovalVotes
+}
+
+// target returns the index of the restaurant a proposal is about, or -1 if it
+// has been removed or renamed since.
+func (g *GuildData) target(p RemovalProposal) int {
+	for i := range g.Restaurants {
+		r := &g.Restaurants[i]
+		if !r.Deleted() && r.Name == p.Name && r.AddedAt.Equal(p.AddedAt) {
+			return i
+		}
+	}
+	return -1
+}
+
+// proposalIndex returns the index of the open proposal posted as messageID, or -1.
+func (g *GuildData) proposalIndex(messageID string) int {
+	return slices.IndexFunc(g.Proposals, func(p RemovalProposal) bool { return p.MessageID == messageID })
+}
+
+// handleProposeRemove implements `!propose-remove "Name"`.
+func handleProposeRemove(c *Context) {
+	name, _, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("propose.usage", nil)
+		return
+	}
+
+	var proposal RemovalProposal
+	err := viewGuild(c.GuildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := g.Restaurants[i]
+		proposal = RemovalProposal{
+			Name:      r.Name,
+			AddedAt:   r.AddedAt,
+			ChannelID: c.Message.ChannelID,
+			By:        c.Author(),
+			Votes:     g.Config.removalVotes(),
+			ExpiresAt: time.Now().UTC().Add(proposalDuration),
+		}
+		if slices.ContainsFunc(g.Proposals, func(p RemovalProposal) bool { return g.target(p) == i }) {
+			return ErrProposalOpen
+		}
+		return nil
+	})
+	if errors.Is(err, ErrProposalOpen) {
+		c.Reply("propose.already_open", Args{"name": proposal.Name})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to propose removal: %v", err)
+		c.replyError("propose.failed", err, name)
+		return
+	}
+
+	msg, err := c.SendComplex(&discordgo.MessageSend{Content: c.T("propose.message", Args{
+		"name": proposal.Name, "user": proposal.By.Name, "emoji": proposalEmoji,
+		"count": proposal.Votes, "hours": int(proposalDuration.Hours()),
+	})})
+	if err != nil {
+		log.Printf("Failed to send removal proposal: %v", err)
+		return
+	}
+	proposal.MessageID = msg.ID
+	if err := c.Session.MessageReactionAdd(msg.ChannelID, msg.ID, proposalEmoji); err != nil {
+		log.Printf("Failed to add proposal reaction: %v", err)
+	}
+
+	// Check again under the write lock in case another proposal raced this one.
+	err = updateGuild(c.GuildID, func(g *GuildData) error {
+		i := g.target(proposal)
+		if i < 0 {
+			return ErrRestaurantNotFound
+		}
+		if slices.ContainsFunc(g.Proposals, func(p RemovalProposal) bool { return g.target(p) == i }) {
+			return ErrProposalOpen
+		}
+		g.Proposals = append(g.Proposals, proposal)
+		return nil
+	})
+	if err != nil {
+		if delErr := c.Session.ChannelMessageDelete(msg.ChannelID, msg.ID); delErr != nil {
+			log.Printf("Failed to delete abandoned proposal: %v", delErr)
+		}
+		if errors.Is(err, ErrProposalOpen) {
+			c.Reply("propose.already_open", Args{"name": proposal.Name})
+			return
+		}
+		log.Printf("Failed to save removal proposal: %v", err)
+		c.replyError("propose.failed", err, name)
+	}
+}
+
+// proposalVoters returns the members other than the bot who voted for a proposal.
+func proposalVoters(s *discordgo.Session, p RemovalProposal) ([]Contributor, error) {
+	users, err := s.MessageReactions(p.ChannelID, p.MessageID, proposalEmoji, 100, "", "")
+	if err != nil {
+		return nil, err
+	}
+	var voters []Contributor
+	for _, u := range users {
+		if !u.Bot {
+			voters = append(voters, contributorFor(u))
+		}
+	}
+	return voters, nil
+}
+
+// proposalOutcome is what happened to a proposal when it was checked.
+type proposalOutcome int
+
+const (
+	proposalPending proposalOutcome = iota
+	proposalPassed
+	proposalExpired
+	proposalInvalid
+)
+
+// resolveProposal removes the restaurant if the proposal has enough votes and
+// closes the proposal if it passed, expired or lost its restaurant.
+func resolveProposal(guildID string, p RemovalProposal, voters []Contributor, now time.Time) (proposalOutcome, error) {
+	outcome := proposalPending
+	err := updateGuild(guildID, func(g *GuildData) error {
+		pi := g.proposalIndex(p.MessageID)
+		if pi < 0 {
+			return nil
+		}
+		i := g.target(p)
+		switch {
+		case i < 0:
+			outcome = proposalInvalid
+		case len(voters) >= p.Votes:
+			outcome = proposalPassed
+			g.Restaurants = append(g.Restaurants[:i], g.Restaurants[i+1:]...)
+			by := p.By
+			g.audit(auditRemove, p.Name, &by, sourceDiscord)
+			g.Audit[len(g.Audit)-1].Voters = voters
+		case !now.Before(p.ExpiresAt):
+			outcome = proposalExpired
+		default:
+			return nil
+		}
+		g.Proposals = slices.Delete(g.Proposals, pi, pi+1)
+		return nil
+	})
+	return outcome, err
+}
+
+// checkProposals counts the votes on open removal proposals and resolves them.
+func checkProposals(s *discordgo.Session, now time.Time) {
+	type openProposal struct {
+		guildID  string
+		cfg      GuildConfig
+		proposal RemovalProposal
+	}
+	var open []openProposal
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		for _, p := range g.Proposals {
+			open = append(open, openProposal{guildID, g.Config, p})
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check removal proposals: %v", err)
+		return
+	}
+
+	for _, o := range open {
+		p := o.proposal
+		voters, err := proposalVoters(s, p)
+		if err != nil {
+			log.Printf("Failed to count votes on proposal %s: %v", p.MessageID, err)
+			if now.Before(p.ExpiresAt) {
+				continue
+			}
+		}
+		outcome, err := resolveProposal(o.guildID, p, voters, now)
+		if err != nil {
+			log.Printf("Failed to resolve proposal %s: %v", p.MessageID, err)
+			continue
+		}
+
+		var key string
+		switch outcome {
+		case proposalPassed:
+			key = "propose.passed"
+		case proposalExpired:
+			key = "propose.expired"
+		case proposalInvalid:
+			key = "propose.invalid"
+		default:
+			continue
+		}
+		result := o.cfg.T(key, Args{"name": p.Name, "count": len(voters)})
+		if _, err := s.ChannelMessageEdit(p.ChannelID, p.MessageID, result); err != nil {
+			log.Printf("Failed to close proposal message %s: %v", p.MessageID, err)
+		}
+		if outcome == proposalPassed {
+			if _, err := s.ChannelMessageSend(p.ChannelID, result); err != nil {
+				log.Printf("Failed to announce removal: %v", err)
+			}
+		}
+	}
+}
+
+// handleRemovalVotesSetting implements `!settings removal-votes [N]`.
+func handleRemovalVotesSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.removal_votes", Args{"count": c.Config.removalVotes()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	n, err := strconv.Atoi(fields[0])
+	if err != nil || n < 1 || n > maxRemovalVotes || len(fields) != 1 {
+		c.Reply("settings.removal_votes_invalid", Args{"max": maxRemovalVotes})
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.RemovalVotes = n
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save removal votes: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.RemovalVotes = n
+	c.Reply("settings.removal_votes_set", Args{"count": n})
+}
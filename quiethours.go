@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// parseQuietHours parses a range of quiet hours like "22:00-07:00" into its
+// start and end as minutes of the day. A start after the end spans midnight.
+func parseQuietHours(s string) (start, end int, ok bool) {
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, false
+	}
+	minutes := func(clock string) (int, bool) {
+		t, err := time.Parse("15:04", strings.TrimSpace(clock))
+		if err != nil {
+			return 0, false
+		}
+		return t.Hour()*60 + t.Minute(), true
+	}
+	start, okStart := minutes(from)
+	end, okEnd := minutes(to)
+	if !okStart || !okEnd || start == end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// formatQuietHours renders quiet hours the way `!settings quiet` accepts them.
+func formatQuietHours(start, end int) string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", start/60, start%60, end/60, end%60)
+}
+
+// quietAt reports whether t falls in the guild's quiet hours, read on the
+// clock of its timezone.
+func (cfg GuildConfig) quietAt(t time.Time) bool {
+	start, end, ok := parseQuietHours(cfg.QuietHours)
+	if !ok {
+		return false
+	}
+	local := t.In(cfg.location())
+	m := local.Hour()*60 + local.Minute()
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// handleQuietSetting implements `!settings quiet [HH:MM-HH:MM|off]`. During
+// quiet hours scheduled posts, reminders and announcements are held until
+// the hours end, while commands are answered as usual.
+func handleQuietSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply(quietSettingKey(c.Config), Args{"value": c.Config.QuietHours, "timezone": c.Config.location().String()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	var stored string
+	if len(fields) != 1 {
+		c.Reply("settings.quiet_invalid", nil)
+		return
+	}
+	if !strings.EqualFold(fields[0], "off") {
+		start, end, ok := parseQuietHours(fields[0])
+		if !ok {
+			c.Reply("settings.quiet_invalid", nil)
+			return
+		}
+		stored = formatQuietHours(start, end)
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.QuietHours = stored
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save quiet hours: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.QuietHours = stored
+	c.Reply(quietSettingKey(c.Config), Args{"value": stored, "timezone": c.Config.location().String()})
+}
+
+// quietSettingKey returns the message describing the quiet hours setting.
+func quietSettingKey(cfg GuildConfig) string {
+	if cfg.QuietHours == "" {
+		return "settings.quiet_off"
+	}
+	return "settings.quiet_on"
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"log"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// maxRecencyWeight caps the weight of long-unvisited restaurants, in days.
+const maxRecencyWeight = 30
+
+// recencyWeight favours restaurants the guild hasn't been to for a while.
+// Never-visited restaurants get the maximum weight.
+func recencyWeight(r Restaurant, now time.Time) float64 {
+	last := r.LastVisit()
+	if last.IsZero() {
+		return maxRecencyWeight
+	}
+	days := now.Sub(last).Hours() / 24
+	return min(max(days, 1), maxRecencyWeight)
+}
+
+// uniformWeight gives every restaurant the same chance.
+func uniformWeight(Restaurant) float64 {
+	return 1
+}
+
+// ratingWeight favours better rated restaurants by the square of their
+// average, so that a 5-star restaurant comes up six times as often as a
+// 2-star one.
+func ratingWeight(avg float64) float64 {
+	return max(avg, 1) * max(avg, 1)
+}
+
+// medianRating returns the median rating of the rated restaurants, or 1 when
+// none is rated.
+func medianRating(restaurants []Restaurant, cfg GuildConfig, now time.Time) float64 {
+	var ratings []float64
+	for _, r := range restaurants {
+		if avg, ok := r.Rating(cfg, now); ok {
+			ratings = append(ratings, avg)
+		}
+	}
+	if len(ratings) == 0 {
+		return 1
+	}
+	slices.Sort(ratings)
+	mid := len(ratings) / 2
+	if len(ratings)%2 == 0 {
+		return (ratings[mid-1] + ratings[mid]) / 2
+	}
+	return ratings[mid]
+}
+
+// weightedSample picks up to n distinct restaurants at random, each draw
+// proportional to its weight.
+func weightedSample(restaurants []Restaurant, n int, weight func(Restaurant) float64) []Restaurant {
+	pool := append([]Restaurant(nil), restaurants...)
+	weights := make([]float64, len(pool))
+	total := 0.0
+	for i, r := range pool {
+		weights[i] = weight(r)
+		total += weights[i]
+	}
+
+	var picked []Restaurant
+	for len(picked) < n && len(pool) > 0 {
+		target := rand.Float64() * total
+		i := 0
+		for ; i < len(pool)-1; i++ {
+			target -= weights[i]
+			if target < 0 {
+				break
+			}
+		}
+		picked = append(picked, pool[i])
+		total -= weights[i]
+		pool = append(pool[:i], pool[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	return picked
+}
+
+// randomWeight returns the weighting `!random` picks with. `!random any`
+// turns off the guild's preferences, so every candidate has the same chance.
+func randomWeight(query *Query, cfg GuildConfig, restaurants []Restaurant, now time.Time) func(Restaurant) float64 {
+	if query.Any {
+		return uniformWeight
+	}
+	return cfg.pickWeight(restaurants, now)
+}
+
+// parsePickQuery parses the filter of a command that picks restaurants to go
+// to. Archived restaurants can never be picked.
+func parsePickQuery(c *Context) (*Query, bool) {
+	query, ferr := parseQuery(c.Args)
+	if ferr != nil {
+		c.replyFilterError(ferr)
+		return nil, false
+	}
+	if query.Archived {
+		c.Reply("random.no_archived", nil)
+		return nil, false
+	}
+	return query, true
+}
+
+// handleRandom implements `!random [filter] [@member...]`, honouring the
+// dietary profiles of the mentioned members.
+func handleRandom(c *Context) {
+	query, ok := parsePickQuery(c)
+	if !ok {
+		return
+	}
+	query.require(c.Config)
+	if !c.applyGroup(query) {
+		return
+	}
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	if len(restaurants) == 0 {
+		c.Reply("list.empty", nil)
+		return
+	}
+	candidates := query.Apply(restaurants)
+	note := query.skippedNoWaitNote(c.Config, restaurants)
+	if len(candidates) == 0 {
+		if query.Untried && len(untriedPool(restaurants)) == 0 {
+			c.Reply("untried.all_tried", nil)
+			return
+		}
+		c.replyGroupNoMatch(query, restaurants)
+		if note != "" {
+			c.Send(note)
+		}
+		return
+	}
+
+	pick := weightedSample(candidates, 1, randomWeight(query, c.Config, restaurants, time.Now()))[0]
+	if err := postPick(c.Session, c.GuildID, c.Message.ChannelID, c.Config, pick, ""); err != nil {
+		log.Printf("Failed to suggest %q: %v", pick.Name, err)
+	}
+	if note != "" {
+		c.Send(note)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// weightFixture returns restaurants rated 5, 2 and 3 and one unrated, last
+// visited 40 days, a day and 10 days ago and never.
+func weightFixture(now time.Time) []Restaurant {
+	daysAgo := func(days int) []Visit {
+		return []Visit{{Date: now.AddDate(0, 0, -days)}}
+	}
+	return []Restaurant{
+		{Name: "Alpha", Ratings: map[string]int{"1": 5}, Visits: daysAgo(40)},
+		{Name: "Bravo", Ratings: map[string]int{"1": 2}, Visits: daysAgo(1)},
+		{Name: "Charlie"},
+		{Name: "Delta", Ratings: map[string]int{"1": 3}, Visits: daysAgo(10)},
+	}
+}
+
+func TestPickWeight(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	restaurants := weightFixture(now)
+	unrated := weightFixture(now)
+	for i := range unrated {
+		unrated[i].Ratings = nil
+	}
+
+	tests := []struct {
+		name        string
+		mode        string
+		args        string
+		restaurants []Restaurant
+		// want holds the weights of Alpha, Bravo, Charlie and Delta.
+		want []float64
+	}{
+		{"recency is the default", "", "", restaurants, []float64{30, 1, 30, 10}},
+		{"recency", pickWeightRecency, "", restaurants, []float64{30, 1, 30, 10}},
+		{"uniform", pickWeightUniform, "", restaurants, []float64{1, 1, 1, 1}},
+		// Charlie is unrated and weighs as the median rating, 3.
+		{"rating", pickWeightRating, "", restaurants, []float64{25, 4, 9, 9}},
+		{"combined", pickWeightCombined, "", restaurants, []float64{750, 4, 270, 90}},
+		{"rating without ratings", pickWeightRating, "", unrated, []float64{1, 1, 1, 1}},
+		{"combined without ratings", pickWeightCombined, "", unrated, []float64{30, 1, 30, 10}},
+		{"any with rating", pickWeightRating, "any", restaurants, []float64{1, 1, 1, 1}},
+		{"any with combined", pickWeightCombined, "any", restaurants, []float64{1, 1, 1, 1}},
+		{"any with recency", pickWeightRecency, "any", restaurants, []float64{1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, ferr := parseQuery(tt.args)
+			if ferr != nil {
+				t.Fatalf("parseQuery(%q): %v", tt.args, ferr)
+			}
+			weight := randomWeight(query, GuildConfig{PickWeight: tt.mode}, tt.restaurants, now)
+			for i, r := range tt.restaurants {
+				if got := weight(r); got != tt.want[i] {
+					t.Errorf("weight(%s) = %v, want %v", r.Name, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMedianRating(t *testing.T) {
+	rated := func(ratings ...int) []Restaurant {
+		restaurants := []Restaurant{{Name: "Unrated"}}
+		for _, rating := range ratings {
+			restaurants = append(restaurants, Restaurant{Ratings: map[string]int{"1": rating}})
+		}
+		return restaurants
+	}
+	tests := []struct {
+		name        string
+		restaurants []Restaurant
+		want        float64
+	}{
+		{"no restaurants", nil, 1},
+		{"no ratings", rated(), 1},
+		{"one rating", rated(4), 4},
+		{"odd count", rated(5, 1, 3), 3},
+		{"even count", rated(5, 2, 4, 3), 3.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := medianRating(tt.restaurants, GuildConfig{}, time.Now()); got != tt.want {
+				t.Errorf("medianRating = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecencyWeight(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		visits []Visit
+		want   float64
+	}{
+		{"never visited", nil, maxRecencyWeight},
+		{"today", []Visit{{Date: now.Add(-time.Hour)}}, 1},
+		{"a week ago", []Visit{{Date: now.AddDate(0, 0, -7)}}, 7},
+		{"long ago", []Visit{{Date: now.AddDate(-1, 0, 0)}}, maxRecencyWeight},
+		{"latest visit counts", []Visit{{Date: now.AddDate(0, 0, -20)}, {Date: now.AddDate(0, 0, -2)}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recencyWeight(Restaurant{Visits: tt.visits}, now); got != tt.want {
+				t.Errorf("recencyWeight = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatingWeight(t *testing.T) {
+	tests := []struct {
+		avg, want float64
+	}{
+		{0, 1},
+		{1, 1},
+		{2, 4},
+		{4.5, 20.25},
+		{5, 25},
+	}
+	for _, tt := range tests {
+		if got := ratingWeight(tt.avg); got != tt.want {
+			t.Errorf("ratingWeight(%v) = %v, want %v", tt.avg, got, tt.want)
+		}
+	}
+}
+
+func TestWeightedSample(t *testing.T) {
+	restaurants := []Restaurant{{Name: "Alpha"}, {Name: "Bravo"}, {Name: "Charlie"}}
+	onlyBravo := func(r Restaurant) float64 {
+		if r.Name == "Bravo" {
+			return 1
+		}
+		return 0
+	}
+	for range 100 {
+		if got := weightedSample(restaurants, 1, onlyBravo); len(got) != 1 || got[0].Name != "Bravo" {
+			t.Fatalf("weightedSample picked %v, want only Bravo", got)
+		}
+	}
+	got := weightedSample(restaurants, 5, uniformWeight)
+	if len(got) != len(restaurants) {
+		t.Fatalf("weightedSample(5) picked %d restaurants, want %d", len(got), len(restaurants))
+	}
+	seen := map[string]bool{}
+	for _, r := range got {
+		if seen[r.Name] {
+			t.Errorf("weightedSample picked %s twice", r.Name)
+		}
+		seen[r.Name] = true
+	}
+}
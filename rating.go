@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxRating is the best rating a member can give.
+	maxRating = 5
+	// defaultRatingHalfLife and maxRatingHalfLife bound the rating decay setting, in months.
+	defaultRatingHalfLife = 12
+	maxRatingHalfLife     = 120
+	// averageMonth is the length of a month in rating decay.
+	averageMonth = time.Duration(365.25 / 12 * 24 * float64(time.Hour))
+)
+
+// AverageRating returns the mean of the members' ratings, reporting false when unrated.
+func (r *Restaurant) AverageRating() (float64, bool) {
+	if len(r.Ratings) == 0 {
+		return 0, false
+	}
+	sum := 0
+	for _, rating := range r.Ratings {
+		sum += rating
+	}
+	return float64(sum) / float64(len(r.Ratings)), true
+}
+
+// decayedAverage returns the mean of ratings with each weighted by
+// 0.5^(age/halfLife), so a rating halfLife old counts half as much as a new
+// one. Ratings missing from ratedAt are dated at fallback, or weigh fully
+// when fallback is zero.
+func decayedAverage(ratings map[string]int, ratedAt map[string]time.Time, fallback, now time.Time, halfLife time.Duration) (float64, bool) {
+	sum, total := 0.0, 0.0
+	for user, rating := range ratings {
+		at, ok := ratedAt[user]
+		if !ok {
+			at = fallback
+		}
+		weight := 1.0
+		if !at.IsZero() {
+			weight = math.Exp2(-max(now.Sub(at), 0).Hours() / halfLife.Hours())
+		}
+		sum += weight * float64(rating)
+		total += weight
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return sum / total, true
+}
+
+// Rating returns the average a guild ranks a restaurant by: time-decayed when
+// the guild set a half-life, the plain average otherwise.
+func (r *Restaurant) Rating(cfg GuildConfig, now time.Time) (float64, bool) {
+	if cfg.RatingHalfLifeMonths <= 0 {
+		return r.AverageRating()
+	}
+	return decayedAverage(r.Ratings, r.RatedAt, r.AddedAt, now, time.Duration(cfg.RatingHalfLifeMonths)*averageMonth)
+}
+
+// formatRating renders an average rating, e.g. "★4.5".
+func formatRating(avg float64) string {
+	return fmt.Sprintf("★%.1f", avg)
+}
+
+// setRating stores a member's rating and when it was given.
+func (r *Restaurant) setRating(userID string, rating int, now time.Time) {
+	if r.Ratings == nil {
+		r.Ratings = map[string]int{}
+	}
+	r.Ratings[userID] = rating
+	if r.RatedAt == nil {
+		r.RatedAt = map[string]time.Time{}
+	}
+	r.RatedAt[userID] = now.UTC()
+}
+
+// RateRestaurant stores a member's rating, replacing any earlier one.
+// It returns the restaurant's canonical name, average rating and number of ratings.
+func RateRestaurant(guildID, name, userID string, rating int) (string, float64, int, error) {
+	var canonical string
+	var avg float64
+	var count int
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		r.setRating(userID, rating, time.Now())
+		delete(r.GuestRatings, userID)
+		canonical, count = r.Name, len(r.Ratings)
+		avg, _ = r.AverageRating()
+		return nil
+	})
+	return canonical, avg, count, err
+}
+
+// handleRate implements `!rate "Name" 1-5`.
+func handleRate(c *Context) {
+	name, rest, ok, failed := c.parseListRef(c.Args)
+	if failed {
+		return
+	}
+	rating, err := strconv.Atoi(rest)
+	if !ok || name == "" || err != nil || rating < 1 || rating > maxRating {
+		c.Reply("rate.usage", Args{"max": maxRating})
+		return
+	}
+
+	canonical, avg, count, err := RateRestaurant(c.GuildID, name, c.Message.Author.ID, rating)
+	if err != nil {
+		log.Printf("Failed to rate restaurant: %v", err)
+		c.replyError("rate.failed", err, name)
+		return
+	}
+	c.Ack("rate.done", Args{"name": canonical, "rating": formatRating(avg), "count": count})
+}
+
+// handleRatingDecaySetting implements `!settings rating-decay [on|off|MONTHS]`.
+func handleRatingDecaySetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply(ratingDecaySettingKey(c.Config), Args{"count": c.Config.RatingHalfLifeMonths})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	months := 0
+	switch value := strings.ToLower(fields[0]); {
+	case len(fields) != 1:
+		c.Reply("settings.rating_decay_invalid", Args{"max": maxRatingHalfLife})
+		return
+	case value == "on":
+		months = defaultRatingHalfLife
+	case value != "off":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxRatingHalfLife {
+			c.Reply("settings.rating_decay_invalid", Args{"max": maxRatingHalfLife})
+			return
+		}
+		months = n
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.RatingHalfLifeMonths = months
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save rating decay: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.RatingHalfLifeMonths = months
+	c.Reply(ratingDecaySettingKey(c.Config), Args{"count": months})
+}
+
+// ratingDecaySettingKey returns the message describing the rating decay setting.
+func ratingDecaySettingKey(cfg GuildConfig) string {
+	if cfg.RatingHalfLifeMonths <= 0 {
+		return "settings.rating_decay_off"
+	}
+	return "settings.rating_decay"
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDecayedAverage(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	halfLife := 12 * averageMonth
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	tests := []struct {
+		name     string
+		ratings  map[string]int
+		ratedAt  map[string]time.Time
+		fallback time.Time
+		want     float64
+		wantOK   bool
+	}{
+		{"unrated", nil, nil, time.Time{}, 0, false},
+		{"single old rating", map[string]int{"1": 2}, map[string]time.Time{"1": ago(3 * halfLife)}, time.Time{}, 2, true},
+		// The 5 weighs 1 and the 2 weighs 1/2: (5 + 1) / 1.5.
+		{"one half-life old", map[string]int{"1": 5, "2": 2}, map[string]time.Time{"1": now, "2": ago(halfLife)}, time.Time{}, 4, true},
+		// The 2 weighs 1/4: (5 + 0.5) / 1.25.
+		{"two half-lives old", map[string]int{"1": 5, "2": 2}, map[string]time.Time{"1": now, "2": ago(2 * halfLife)}, time.Time{}, 4.4, true},
+		{"undated without fallback weighs fully", map[string]int{"1": 5, "2": 2}, map[string]time.Time{"1": now}, time.Time{}, 3.5, true},
+		{"undated dated at fallback", map[string]int{"1": 5, "2": 2}, map[string]time.Time{"1": now}, ago(halfLife), 4, true},
+		{"future rating weighs fully", map[string]int{"1": 5, "2": 2}, map[string]time.Time{"1": now.Add(time.Hour), "2": now}, time.Time{}, 3.5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := decayedAverage(tt.ratings, tt.ratedAt, tt.fallback, now, halfLife)
+			if ok != tt.wantOK || !closeTo(got, tt.want) {
+				t.Errorf("decayedAverage = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRatingWithoutDecay(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	// A restaurant as stored before ratings were dated, loaded as is.
+	var r Restaurant
+	legacy := `{"name": "Alpha", "added_at": "2020-01-01T00:00:00Z", "ratings": {"1": 5, "2": 2, "3": 4}}`
+	if err := json.Unmarshal([]byte(legacy), &r); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	want, _ := r.AverageRating()
+	for _, months := range []int{0, -1} {
+		got, ok := r.Rating(GuildConfig{RatingHalfLifeMonths: months}, now)
+		if !ok || got != want {
+			t.Errorf("Rating with half-life %d = %v, %v, want the plain average %v", months, got, ok, want)
+		}
+	}
+	// The decay dates the undated ratings at when the restaurant was added,
+	// so they all age alike and the average is unchanged.
+	if got, ok := r.Rating(GuildConfig{RatingHalfLifeMonths: defaultRatingHalfLife}, now); !ok || !closeTo(got, want) {
+		t.Errorf("Rating with decay = %v, %v, want %v", got, ok, want)
+	}
+
+	r.setRating("2", 2, now)
+	r.RatedAt["1"] = now.Add(-defaultRatingHalfLife * averageMonth)
+	if got, _ := r.Rating(GuildConfig{}, now); got != want {
+		t.Errorf("Rating without decay changed to %v after dating the ratings, want %v", got, want)
+	}
+}
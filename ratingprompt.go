@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// ratingPromptDelay is how long after a visit its attendees are asked to rate it.
+const ratingPromptDelay = 2 * time.Hour
+
+// Rating prompt modes. The empty mode posts in the channel of the visit.
+const (
+	ratingPromptChannel = "channel"
+	ratingPromptDM      = "dm"
+	ratingPromptOff     = "off"
+)
+
+// ErrVisitNotFound is returned when rating a visit that no longer exists.
+var ErrVisitNotFound = errors.New("visit not found")
+
+// RatingPrompt is a pending question to a visit's attendees about how it was.
+type RatingPrompt struct {
+	RestaurantID string `json:"restaurant_id"`
+	// VisitAt identifies the visit among the restaurant's visits.
+	VisitAt   time.Time `json:"visit_at"`
+	ChannelID string    `json:"channel_id"`
+	At        time.Time `json:"at"`
+}
+
+// ratingPromptMode returns how the guild asks for ratings after a visit.
+func (cfg GuildConfig) ratingPromptMode() string {
+	if cfg.RatingPrompt == "" {
+		return ratingPromptChannel
+	}
+	return cfg.RatingPrompt
+}
+
+// promptRating schedules the rating prompt of a visit just recorded, unless
+// the guild turned prompts off or the visit already has one.
+func (g *GuildData) promptRating(r *Restaurant, visit Visit, channelID string) {
+	if g.Config.ratingPromptMode() == ratingPromptOff || r.ID == "" || channelID == "" {
+		return
+	}
+	if slices.ContainsFunc(g.RatingPrompts, func(p RatingPrompt) bool {
+		return p.RestaurantID == r.ID && p.VisitAt.Unix() == visit.Date.Unix()
+	}) {
+		return
+	}
+	g.RatingPrompts = append(g.RatingPrompts, RatingPrompt{
+		RestaurantID: r.ID,
+		VisitAt:      visit.Date,
+		ChannelID:    channelID,
+		At:           visit.Date.Add(ratingPromptDelay),
+	})
+}
+
+// findVisit returns the restaurant with the given ID and the index of its
+// visit at the given time to the second, or -1 when either is gone.
+func (g *GuildData) findVisit(restaurantID string, at time.Time) (*Restaurant, int) {
+	i := g.findID(restaurantID)
+	if i < 0 || g.Restaurants[i].Deleted() {
+		return nil, -1
+	}
+	r := &g.Restaurants[i]
+	return r, slices.IndexFunc(r.Visits, func(v Visit) bool { return v.Date.Unix() == at.Unix() })
+}
+
+// ratingButtons is the row of star buttons rating a visit. The guild ID is
+// part of the custom ID so that the buttons also work in direct messages.
+func ratingButtons(guildID string, p RatingPrompt) discordgo.MessageComponent {
+	var buttons []discordgo.Button
+	for stars := 1; stars <= maxRating; stars++ {
+		buttons = append(buttons, discordgo.Button{
+			Label:    strconv.Itoa(stars) + "★",
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("rate:%s:%s:%d:%d", guildID, p.RestaurantID, p.VisitAt.Unix(), stars),
+		})
+	}
+	return buttonRow(buttons...)
+}
+
+// duePrompt is a rating prompt ready to be sent.
+type duePrompt struct {
+	RatingPrompt
+	name      string
+	attendees []string
+}
+
+// runRatingPrompts sends every rating prompt whose time has come, dropping
+// prompts whose visit was deleted meanwhile. Prompts due in quiet hours wait
+// for the hours to end.
+func runRatingPrompts(s *discordgo.Session, now time.Time) {
+	due := map[string]bool{}
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if g.Config.quietAt(now) {
+			return
+		}
+		for _, p := range g.RatingPrompts {
+			if !now.Before(p.At) {
+				due[guildID] = true
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check rating prompts: %v", err)
+		return
+	}
+
+	for guildID := range due {
+		// Remove the prompts before sending so that each visit is asked about once.
+		var sent []duePrompt
+		var cfg GuildConfig
+		err := updateGuild(guildID, func(g *GuildData) error {
+			cfg = g.Config
+			kept := g.RatingPrompts[:0]
+			for _, p := range g.RatingPrompts {
+				if now.Before(p.At) {
+					kept = append(kept, p)
+					continue
+				}
+				if r, v := g.findVisit(p.RestaurantID, p.VisitAt); v >= 0 {
+					sent = append(sent, duePrompt{p, r.Name, slices.Clone(r.Visits[v].Attendees)})
+				}
+			}
+			g.RatingPrompts = kept
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to remove due rating prompts in guild %s: %v", guildID, err)
+			continue
+		}
+		sort.SliceStable(sent, func(i, j int) bool { return sent[i].At.Before(sent[j].At) })
+		for _, p := range sent {
+			sendRatingPrompt(s, guildID, cfg, p)
+		}
+	}
+}
+
+// sendRatingPrompt asks a visit's attendees how it was, in the channel of the
+// visit or in direct messages depending on the guild setting.
+func sendRatingPrompt(s *discordgo.Session, guildID string, cfg GuildConfig, p duePrompt) {
+	buttons := []discordgo.MessageComponent{ratingButtons(guildID, p.RatingPrompt), waitButtons(cfg, guildID, p.RatingPrompt)}
+	if cfg.ratingPromptMode() == ratingPromptDM {
+		for _, id := range p.attendees {
+			dm, err := s.UserChannelCreate(id)
+			if err == nil {
+				_, err = s.ChannelMessageSendComplex(dm.ID, &discordgo.MessageSend{
+					Content:    cfg.T("rateprompt.ask_dm", Args{"name": p.name}),
+					Components: buttons,
+				})
+			}
+			if err != nil {
+				log.Printf("Failed to send rating prompt to %s: %v", id, err)
+			}
+		}
+		return
+	}
+
+	var mentions []string
+	for _, id := range p.attendees {
+		mentions = append(mentions, "<@"+id+">")
+	}
+	if _, err := s.ChannelMessageSendComplex(p.ChannelID, &discordgo.MessageSend{
+		Content:         strings.TrimSpace(strings.Join(mentions, " ") + " " + cfg.T("rateprompt.ask", Args{"name": p.name})),
+		Components:      buttons,
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: p.attendees},
+	}); err != nil {
+		log.Printf("Failed to send rating prompt for %s: %v", p.name, err)
+	}
+}
+
+// RateVisit stores a member's rating from a visit's prompt. Ratings from
+// members who aren't among the visit's attendees are kept but flagged as
+// guest ratings. It returns the restaurant's name and whether the rating was
+// a guest rating.
+func RateVisit(guildID, restaurantID string, visitAt time.Time, userID string, rating int) (string, bool, error) {
+	var name string
+	var guest bool
+	err := updateGuild(guildID, func(g *GuildData) error {
+		r, v := g.findVisit(restaurantID, visitAt)
+		if v < 0 {
+			return ErrVisitNotFound
+		}
+		name, guest = r.Name, !slices.Contains(r.Visits[v].Attendees, userID)
+		r.setRating(userID, rating, time.Now())
+		switch {
+		case !guest:
+			delete(r.GuestRatings, userID)
+		case r.GuestRatings == nil:
+			r.GuestRatings = map[string]bool{userID: true}
+		default:
+			r.GuestRatings[userID] = true
+		}
+		return nil
+	})
+	return name, guest, err
+}
+
+// handleRateComponent handles the star buttons of a rating prompt.
+func handleRateComponent(i *Interaction) {
+	if len(i.Args) != 4 || i.Args[0] != i.GuildID {
+		return
+	}
+	unix, err := strconv.ParseInt(i.Args[2], 10, 64)
+	rating, err2 := strconv.Atoi(i.Args[3])
+	if err != nil || err2 != nil || rating < 1 || rating > maxRating {
+		return
+	}
+	name, guest, err := RateVisit(i.GuildID, i.Args[1], time.Unix(unix, 0).UTC(), i.UserID(), rating)
+	switch {
+	case errors.Is(err, ErrVisitNotFound):
+		i.Ephemeral("rateprompt.gone", nil)
+	case err != nil:
+		log.Printf("Failed to rate visit: %v", err)
+		i.Ephemeral("rateprompt.failed", nil)
+	case guest:
+		i.Ephemeral("rateprompt.done_guest", Args{"name": name, "rating": rating})
+	default:
+		i.Ephemeral("rateprompt.done", Args{"name": name, "rating": rating})
+	}
+}
+
+// handleRatingPromptSetting implements `!settings rate-prompt [channel|dm|off]`.
+func handleRatingPromptSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.rate_prompt", Args{"value": c.Config.ratingPromptMode()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	mode := strings.ToLower(fields[0])
+	if len(fields) != 1 || (mode != ratingPromptChannel && mode != ratingPromptDM && mode != ratingPromptOff) {
+		c.Reply("settings.rate_prompt_invalid", nil)
+		return
+	}
+	stored := mode
+	if stored == ratingPromptChannel {
+		stored = ""
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.RatingPrompt = stored
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save rating prompt mode: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.RatingPrompt = stored
+	c.Reply("settings.rate_prompt", Args{"value": mode})
+}
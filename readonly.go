@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// readOnlyThreshold is how many writes of the database file in a row may fail
+// before the bot stops accepting changes.
+const readOnlyThreshold = 3
+
+// ErrReadOnly is returned for changes while the database can't be written.
+var ErrReadOnly = errors.New("the database is read-only")
+
+// readOnly tracks failed writes and the read-only mode they lead to. Reads
+// keep working from memory, while changes are refused instead of being lost.
+var readOnly struct {
+	sync.Mutex
+	failures int
+	on       bool
+	// reason is the catalog key explaining the mode, and err the write error
+	// that started it.
+	reason   string
+	err      string
+	since    time.Time
+	notified bool
+}
+
+// mutatingCommands are the commands refused at once in read-only mode.
+// Commands that only change data in some of their forms run, and fail with
+// ErrReadOnly when they get to the change.
+var mutatingCommands = map[string]bool{
+	"add": true, "remove": true, "visited": true, "tag": true, "untag": true, "set": true, "rate": true,
+	"emoji": true, "archive": true, "unarchive": true, "restore": true, "import": true, "merge": true,
+	"clear": true, "bulk-edit": true, "propose-remove": true, "remove-all": true, "remove-matching": true,
+	"seed": true, "forget-me": true, "forget": true, "dedupe": true, "spend": true, "snooze": true,
+	"away": true, "back": true, "poll": true, "battle": true, "tournament": true, "lunch": true, "photo": true,
+	"unavailable": true, "available": true, "edit": true, "revert": true, "nickname": true, "flavor": true,
+	"share": true, "holidays": true, "budget": true, "spotlight": true,
+}
+
+// readOnlyReason returns the catalog key describing why a write failed.
+func readOnlyReason(err error) string {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return "readonly.reason_disk_full"
+	case errors.Is(err, os.ErrPermission), errors.Is(err, syscall.EROFS):
+		return "readonly.reason_permission"
+	}
+	return "readonly.reason_write_failed"
+}
+
+// recordWrite counts a write of the database file, entering read-only mode
+// after readOnlyThreshold failures in a row and leaving it on success.
+func recordWrite(err error) {
+	readOnly.Lock()
+	defer readOnly.Unlock()
+	if err == nil {
+		readOnly.failures = 0
+		if readOnly.on {
+			readOnly.on = false
+			log.Printf("Database writes work again, leaving read-only mode")
+		}
+		return
+	}
+	readOnly.failures++
+	if readOnly.on || readOnly.failures < readOnlyThreshold {
+		return
+	}
+	readOnly.on, readOnly.notified = true, false
+	readOnly.reason, readOnly.err, readOnly.since = readOnlyReason(err), err.Error(), time.Now()
+	log.Printf("Database writes failed %d times in a row, entering read-only mode: %v", readOnly.failures, err)
+}
+
+// readOnlyInfo describes the read-only mode for the health endpoint.
+type readOnlyInfo struct {
+	Reason string    `json:"reason"`
+	Error  string    `json:"error"`
+	Since  time.Time `json:"since"`
+}
+
+// currentReadOnly returns the read-only mode, nil when the database can be written.
+func currentReadOnly() *readOnlyInfo {
+	readOnly.Lock()
+	defer readOnly.Unlock()
+	if !readOnly.on {
+		return nil
+	}
+	return &readOnlyInfo{Reason: readOnly.reason, Error: readOnly.err, Since: readOnly.since}
+}
+
+// checkWritable returns ErrReadOnly while the database can't be written.
+func checkWritable() error {
+	if ro := currentReadOnly(); ro != nil {
+		return fmt.Errorf("%w: %s", ErrReadOnly, ro.Error)
+	}
+	return nil
+}
+
+// refuseReadOnly tells the member that a mutating command can't run now,
+// reporting whether it did.
+func (c *Context) refuseReadOnly(name string) bool {
+	if currentReadOnly() == nil || !mutatingCommands[name] {
+		return false
+	}
+	c.replyReadOnly()
+	return true
+}
+
+// replyReadOnly tells the member that the bot is in read-only mode, and why.
+func (c *Context) replyReadOnly() {
+	c.Reply("readonly.active", Args{"reason": c.T(activeReadOnlyReason(), nil)})
+}
+
+// activeReadOnlyReason returns the catalog key of the reason the bot is in read-only mode.
+func activeReadOnlyReason() string {
+	if ro := currentReadOnly(); ro != nil {
+		return ro.Reason
+	}
+	return "readonly.reason_write_failed"
+}
+
+// runReadOnlyProbe tells the error channel once about the read-only mode and
+// tries to write the database, which leaves the mode if it succeeds.
+func runReadOnlyProbe(s *discordgo.Session, now time.Time) {
+	readOnly.Lock()
+	on, notify := readOnly.on, readOnly.on && !readOnly.notified
+	readOnly.notified = readOnly.notified || on
+	reason := readOnly.err
+	readOnly.Unlock()
+	if !on {
+		return
+	}
+	if notify {
+		reportError(s, "The database can't be written (%s). The bot refuses changes until a write succeeds or the owner runs `!readonly off`.", reason)
+	}
+	dirty.Store(true)
+	if err := Flush(); err != nil {
+		log.Printf("Database write probe failed: %v", err)
+	}
+}
+
+// handleReadOnly implements `!readonly [off]`.
+func handleReadOnly(c *Context) {
+	switch strings.ToLower(c.Args) {
+	case "":
+		if currentReadOnly() != nil {
+			c.replyReadOnly()
+		} else {
+			c.Reply("readonly.inactive", nil)
+		}
+	case "off":
+		if !c.RequireOwner() {
+			return
+		}
+		readOnly.Lock()
+		was := readOnly.on
+		readOnly.on, readOnly.failures = false, 0
+		readOnly.Unlock()
+		if was {
+			log.Printf("Read-only mode turned off by %s", c.Message.Author.ID)
+		}
+		c.Reply("readonly.off", nil)
+	default:
+		c.Reply("readonly.usage", nil)
+	}
+}
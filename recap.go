@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// recapColor is the accent color of the monthly recap embed.
+const recapColor = 0xf4a261
+
+// recap summarizes the lunches of one period.
+type recap struct {
+	Lunches int
+	// Places is the number of distinct restaurants visited.
+	Places int
+	// Added are the restaurants added to the list in the period.
+	Added []string
+	// TopRated is the best-rated restaurant visited in the period, empty if none was rated.
+	TopRated       string
+	TopRatedRating float64
+	// FirstVisits counts the visits to restaurants nobody had been to before.
+	FirstVisits int
+	// Adventurer is the member with the most visits to places new to them,
+	// empty when no attendees were recorded.
+	Adventurer      string
+	AdventurerCount int
+}
+
+// monthlyRecap aggregates the visits and additions between start and end.
+func monthlyRecap(restaurants []Restaurant, start, end time.Time) recap {
+	var out recap
+	inRange := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+	adventures := map[string]int{}
+	for _, r := range restaurants {
+		if inRange(r.AddedAt) {
+			out.Added = append(out.Added, r.Name)
+		}
+		// Find out who had been here before the period. Visits aren't
+		// necessarily stored in date order.
+		var visitedBefore bool
+		seenBefore := map[string]bool{}
+		for _, v := range r.Visits {
+			if v.Date.Before(start) {
+				visitedBefore = true
+				for _, id := range v.Attendees {
+					seenBefore[id] = true
+				}
+			}
+		}
+		visits := 0
+		for _, v := range sortedVisits(r.Visits) {
+			if !inRange(v.Date) {
+				continue
+			}
+			visits++
+			if !visitedBefore {
+				out.FirstVisits++
+				visitedBefore = true
+			}
+			for _, id := range v.Attendees {
+				if !seenBefore[id] {
+					adventures[id]++
+					seenBefore[id] = true
+				}
+			}
+		}
+		if visits == 0 {
+			continue
+		}
+		out.Lunches += visits
+		out.Places++
+		if avg, ok := r.AverageRating(); ok && (out.TopRated == "" || avg > out.TopRatedRating) {
+			out.TopRated, out.TopRatedRating = r.Name, avg
+		}
+	}
+	out.Adventurer, out.AdventurerCount = busiest(adventures)
+	return out
+}
+
+// sortedVisits returns the visits in date order.
+func sortedVisits(visits []Visit) []Visit {
+	sorted := append([]Visit(nil), visits...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	return sorted
+}
+
+// monthRange returns the start of the month containing t and of the month after it.
+func monthRange(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+// recapPeriod returns the month a `!recap YYYY-MM` argument names in now's
+// timezone, or the month of now when arg is empty.
+func recapPeriod(arg string, now time.Time) (time.Time, time.Time, bool) {
+	if arg == "" {
+		start, end := monthRange(now)
+		return start, end, true
+	}
+	month, err := time.ParseInLocation("2006-01", arg, now.Location())
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start, end := monthRange(month)
+	return start, end, true
+}
+
+// recapEmbed renders a recap of the month starting at start.
+func recapEmbed(cfg GuildConfig, start time.Time, r recap) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: cfg.T("recap.title", Args{"month": start.Format("2006-01")}),
+		Color: recapColor,
+	}
+	if r.Lunches == 0 && len(r.Added) == 0 {
+		embed.Description = cfg.T("recap.empty", nil)
+		return embed
+	}
+	field := func(key, value string) {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: cfg.T(key, nil), Value: value, Inline: true})
+	}
+	field("recap.lunches", fmt.Sprint(r.Lunches))
+	field("recap.places", fmt.Sprint(r.Places))
+	added := fmt.Sprint(len(r.Added))
+	if len(r.Added) > 0 {
+		added += "\n" + strings.Join(r.Added[:min(len(r.Added), 10)], ", ")
+	}
+	field("recap.added", added)
+	if r.TopRated != "" {
+		field("recap.top_rated", r.TopRated+" "+formatRating(r.TopRatedRating))
+	}
+	adventurous := cfg.T("recap.first_visits", Args{"count": r.FirstVisits})
+	if r.Adventurer != "" {
+		adventurous += "\n" + cfg.T("recap.adventurer", Args{"user": "<@" + r.Adventurer + ">", "count": r.AdventurerCount})
+	}
+	field("recap.adventurous", adventurous)
+	return embed
+}
+
+// guildRecap loads a guild's restaurants and summarizes the month starting at start.
+func guildRecap(guildID string, start, end time.Time) (recap, error) {
+	var out recap
+	err := viewGuild(guildID, func(g *GuildData) error {
+		out = monthlyRecap(g.active(), start, end)
+		return nil
+	})
+	return out, err
+}
+
+// handleRecap implements `!recap [YYYY-MM]`, defaulting to the current month.
+func handleRecap(c *Context) {
+	start, end, ok := recapPeriod(c.Args, time.Now().In(c.Config.location()))
+	if !ok {
+		c.Reply("recap.usage", nil)
+		return
+	}
+	r, err := guildRecap(c.GuildID, start, end)
+	if err != nil {
+		log.Printf("Failed to build recap: %v", err)
+		c.Reply("recap.failed", nil)
+		return
+	}
+	if _, err := c.SendComplex(&discordgo.MessageSend{
+		Embeds:          []*discordgo.MessageEmbed{recapEmbed(c.Config, start, r)},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	}); err != nil {
+		log.Printf("Failed to send recap: %v", err)
+	}
+}
+
+// runMonthlyRecaps posts the recap of the month that just ended in every
+// guild with a recap channel, once its quiet hours are over.
+func runMonthlyRecaps(s *discordgo.Session, now time.Time) {
+	type dueRecap struct {
+		guildID string
+		cfg     GuildConfig
+		start   time.Time
+	}
+	var due []dueRecap
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if g.Config.RecapChannelID == "" || g.Config.quietAt(now) {
+			return
+		}
+		thisMonth, _ := monthRange(now.In(g.Config.location()))
+		last := thisMonth.AddDate(0, -1, 0)
+		if g.LastRecap != last.Format("2006-01") {
+			due = append(due, dueRecap{guildID, g.Config, last})
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check monthly recaps: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		month := d.start.Format("2006-01")
+		// Mark the recap as posted first so a failing channel isn't retried every minute.
+		if err := updateGuild(d.guildID, func(g *GuildData) error {
+			g.LastRecap = month
+			return nil
+		}); err != nil {
+			log.Printf("Failed to save recap state for guild %s: %v", d.guildID, err)
+			continue
+		}
+		_, end := monthRange(d.start)
+		r, err := guildRecap(d.guildID, d.start, end)
+		if err != nil {
+			log.Printf("Failed to build recap for guild %s: %v", d.guildID, err)
+			continue
+		}
+		if _, err := s.ChannelMessageSendComplex(d.cfg.RecapChannelID, &discordgo.MessageSend{
+			Embeds:          []*discordgo.MessageEmbed{recapEmbed(d.cfg, d.start, r)},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		}); err != nil {
+			log.Printf("Failed to post recap for guild %s: %v", d.guildID, err)
+		}
+	}
+}
+
+// handleRecapSetting implements `!settings recap [#channel|off]`.
+func handleRecapSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Send(recapSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	channelID := ""
+	if !strings.EqualFold(fields[0], "off") {
+		var ok bool
+		if channelID, ok = parseChannelMention(fields[0]); !ok || len(fields) != 1 {
+			c.Reply("settings.recap_usage", nil)
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.RecapChannelID = channelID
+		// The first recap in a new channel is the one for the month in progress.
+		thisMonth, _ := monthRange(time.Now().In(g.Config.location()))
+		g.LastRecap = thisMonth.AddDate(0, -1, 0).Format("2006-01")
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save recap channel: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.RecapChannelID = channelID
+	c.Send(recapSettingLine(c.Config))
+}
+
+// recapSettingLine describes where monthly recaps are posted.
+func recapSettingLine(cfg GuildConfig) string {
+	if cfg.RecapChannelID == "" {
+		return cfg.T("settings.recap_off", nil)
+	}
+	return cfg.T("settings.recap", Args{"channel": "<#" + cfg.RecapChannelID + ">"})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recapFixture returns a guild's restaurants around April 2024, dated in loc.
+func recapFixture(loc *time.Location) []Restaurant {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, loc)
+	}
+	visit := func(date time.Time, attendees ...string) Visit {
+		return Visit{Date: date, Attendees: attendees}
+	}
+	return []Restaurant{
+		{
+			Name:    "Alpha",
+			AddedAt: at(time.January, 5, 12, 0),
+			Ratings: map[string]int{"1": 4, "2": 4},
+			// Stored out of date order, with visits on the first and last
+			// day of April and one before.
+			Visits: []Visit{
+				visit(at(time.April, 30, 23, 30), "2", "3"),
+				visit(at(time.February, 10, 12, 0), "1"),
+				visit(at(time.April, 1, 0, 30), "1", "2"),
+			},
+		},
+		{
+			Name:    "Bravo",
+			AddedAt: at(time.April, 15, 9, 0),
+			Ratings: map[string]int{"3": 5},
+			Visits:  []Visit{visit(at(time.April, 20, 12, 0), "3", "4")},
+		},
+		{
+			// Added and first visited just after April ends.
+			Name:    "Charlie",
+			AddedAt: at(time.May, 1, 0, 30),
+			Ratings: map[string]int{"1": 3},
+			Visits:  []Visit{visit(at(time.May, 1, 0, 30), "1")},
+		},
+		{
+			Name:    "Delta",
+			AddedAt: at(time.April, 2, 8, 0),
+		},
+		{
+			// Rated best but last visited just before April starts.
+			Name:    "Echo",
+			AddedAt: at(time.January, 5, 12, 0),
+			Ratings: map[string]int{"1": 5, "2": 5},
+			Visits:  []Visit{visit(at(time.March, 31, 23, 59), "1")},
+		},
+	}
+}
+
+func TestMonthlyRecap(t *testing.T) {
+	loc, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Fatalf("time.LoadLocation: %v", err)
+	}
+	restaurants := recapFixture(loc)
+
+	tests := []struct {
+		month string
+		want  recap
+	}{
+		{"2024-04", recap{
+			Lunches:        3,
+			Places:         2,
+			Added:          []string{"Bravo", "Delta"},
+			TopRated:       "Bravo",
+			TopRatedRating: 5,
+			FirstVisits:    1,
+			// 3 goes to Alpha and Bravo for the first time, 2 and 4 to one
+			// of them; 1 had been to Alpha before.
+			Adventurer:      "3",
+			AdventurerCount: 2,
+		}},
+		{"2024-05", recap{
+			Lunches:         1,
+			Places:          1,
+			Added:           []string{"Charlie"},
+			TopRated:        "Charlie",
+			TopRatedRating:  3,
+			FirstVisits:     1,
+			Adventurer:      "1",
+			AdventurerCount: 1,
+		}},
+		{"2024-03", recap{
+			Lunches:        1,
+			Places:         1,
+			TopRated:       "Echo",
+			TopRatedRating: 5,
+			// Echo's first visit is recorded without attendees before it, so
+			// it's 1's first time there too.
+			FirstVisits:     1,
+			Adventurer:      "1",
+			AdventurerCount: 1,
+		}},
+		{"2024-06", recap{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.month, func(t *testing.T) {
+			start, end, ok := recapPeriod(tt.month, time.Now().In(loc))
+			if !ok {
+				t.Fatalf("recapPeriod(%q) failed", tt.month)
+			}
+			got := monthlyRecap(restaurants, start, end)
+			if !slices.Equal(got.Added, tt.want.Added) {
+				t.Errorf("Added = %q, want %q", got.Added, tt.want.Added)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("monthlyRecap = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecapPeriod(t *testing.T) {
+	loc, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Fatalf("time.LoadLocation: %v", err)
+	}
+	// Early on the first of May in Auckland is still April in UTC.
+	now := time.Date(2024, time.April, 30, 13, 0, 0, 0, time.UTC).In(loc)
+	tests := []struct {
+		arg        string
+		start, end time.Time
+		ok         bool
+	}{
+		{"", time.Date(2024, time.May, 1, 0, 0, 0, 0, loc), time.Date(2024, time.June, 1, 0, 0, 0, 0, loc), true},
+		{"2024-04", time.Date(2024, time.April, 1, 0, 0, 0, 0, loc), time.Date(2024, time.May, 1, 0, 0, 0, 0, loc), true},
+		{"2023-12", time.Date(2023, time.December, 1, 0, 0, 0, 0, loc), time.Date(2024, time.January, 1, 0, 0, 0, 0, loc), true},
+		{"2024-13", time.Time{}, time.Time{}, false},
+		{"april", time.Time{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := recapPeriod(tt.arg, now)
+		if ok != tt.ok || !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("recapPeriod(%q) = %v, %v, %v, want %v, %v, %v", tt.arg, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxRemindersPerMember bounds the pending reminders of one member.
+const maxRemindersPerMember = 20
+
+var (
+	// ErrTooManyReminders is returned when a member already has maxRemindersPerMember reminders.
+	ErrTooManyReminders = errors.New("too many reminders")
+	// ErrReminderNotFound is returned when cancelling a reminder that doesn't exist or isn't the member's.
+	ErrReminderNotFound = errors.New("reminder not found")
+)
+
+// Reminder is a message the bot sends a member at a later time.
+type Reminder struct {
+	ID        string    `json:"id"`
+	ChannelID string    `json:"channel_id"`
+	UserID    string    `json:"user_id"`
+	Text      string    `json:"text"`
+	At        time.Time `json:"at"`
+}
+
+// AddReminder stores a reminder and returns it with its ID.
+func AddReminder(guildID string, r Reminder) (Reminder, error) {
+	r.ID = newToken()[:6]
+	r.At = r.At.UTC()
+	err := updateGuild(guildID, func(g *GuildData) error {
+		n := 0
+		for _, other := range g.Reminders {
+			if other.UserID == r.UserID {
+				n++
+			}
+		}
+		if n >= maxRemindersPerMember {
+			return ErrTooManyReminders
+		}
+		g.Reminders = append(g.Reminders, r)
+		return nil
+	})
+	return r, err
+}
+
+// CancelReminder removes one of a member's reminders.
+func CancelReminder(guildID, id, userID string) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		i := slices.IndexFunc(g.Reminders, func(r Reminder) bool { return r.ID == id && r.UserID == userID })
+		if i < 0 {
+			return ErrReminderNotFound
+		}
+		g.Reminders = slices.Delete(g.Reminders, i, i+1)
+		return nil
+	})
+}
+
+// cancelReminderButton is the row with the button that cancels a reminder.
+func cancelReminderButton(cfg GuildConfig, id string) discordgo.MessageComponent {
+	return buttonRow(discordgo.Button{Label: cfg.T("button.cancel_reminder", nil), Style: discordgo.SecondaryButton, CustomID: "remind:cancel:" + id})
+}
+
+// runReminders sends every reminder whose time has come, in the order they
+// were due. Reminders due on a holiday are moved to the next workday instead,
+// those due in quiet hours wait for the hours to end.
+func runReminders(s *discordgo.Session, now time.Time) {
+	due := map[string][]Reminder{}
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if g.Config.quietAt(now) {
+			return
+		}
+		for _, r := range g.Reminders {
+			if !now.Before(r.At) {
+				due[guildID] = append(due[guildID], r)
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check reminders: %v", err)
+		return
+	}
+
+	for guildID, reminders := range due {
+		// Remove the reminders before sending so that a failing channel isn't retried every minute.
+		var sent []Reminder
+		err := updateGuild(guildID, func(g *GuildData) error {
+			kept := g.Reminders[:0]
+			for _, r := range g.Reminders {
+				if !slices.ContainsFunc(reminders, func(d Reminder) bool { return d.ID == r.ID }) {
+					kept = append(kept, r)
+					continue
+				}
+				if holiday, ok := g.holiday(r.At); ok {
+					r.At = g.nextWorkday(r.At).UTC()
+					log.Printf("Moving reminder %s in guild %s past %s", r.ID, guildID, holiday)
+					kept = append(kept, r)
+					continue
+				}
+				sent = append(sent, r)
+			}
+			g.Reminders = kept
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to remove due reminders in guild %s: %v", guildID, err)
+			continue
+		}
+		sort.SliceStable(sent, func(i, j int) bool { return sent[i].At.Before(sent[j].At) })
+		for _, r := range sent {
+			if _, err := s.ChannelMessageSendComplex(r.ChannelID, &discordgo.MessageSend{
+				Content:         "⏰ <@" + r.UserID + "> " + r.Text,
+				AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{r.UserID}},
+			}); err != nil {
+				log.Printf("Failed to send reminder %s: %v", r.ID, err)
+			}
+		}
+	}
+}
+
+// handleReminders implements `!reminders` and `!reminders cancel ID`.
+func handleReminders(c *Context) {
+	fields := strings.Fields(c.Args)
+	userID := c.Message.Author.ID
+	if len(fields) == 2 && strings.EqualFold(fields[0], "cancel") {
+		err := CancelReminder(c.GuildID, fields[1], userID)
+		switch {
+		case errors.Is(err, ErrReminderNotFound):
+			c.Reply("reminders.not_found", Args{"id": fields[1]})
+		case err != nil:
+			log.Printf("Failed to cancel reminder: %v", err)
+			c.Reply("reminders.failed", nil)
+		default:
+			c.Reply("reminders.cancelled", nil)
+		}
+		return
+	}
+	if len(fields) != 0 {
+		c.Reply("reminders.usage", nil)
+		return
+	}
+
+	var mine []Reminder
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		for _, r := range g.Reminders {
+			if r.UserID == userID {
+				mine = append(mine, r)
+			}
+		}
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load reminders: %v", err)
+		c.Reply("reminders.failed", nil)
+		return
+	}
+	if len(mine) == 0 {
+		c.Reply("reminders.none", nil)
+		return
+	}
+	sort.Slice(mine, func(i, j int) bool { return mine[i].At.Before(mine[j].At) })
+	lines := []string{c.T("reminders.header", Args{"count": len(mine)})}
+	for _, r := range mine {
+		lines = append(lines, fmt.Sprintf("- `%s` <t:%d:f>: %s", r.ID, r.At.Unix(), r.Text))
+	}
+	c.SendQuiet(strings.Join(lines, "\n"))
+}
+
+// handleRemindComponent handles the Cancel button of a reminder.
+func handleRemindComponent(i *Interaction) {
+	if len(i.Args) != 2 || i.Args[0] != "cancel" {
+		return
+	}
+	err := CancelReminder(i.Event.GuildID, i.Args[1], i.UserID())
+	switch {
+	case errors.Is(err, ErrReminderNotFound):
+		i.Update(i.T("reminders.not_found", Args{"id": i.Args[1]}), nil)
+	case err != nil:
+		log.Printf("Failed to cancel reminder: %v", err)
+		i.Ephemeral("reminders.failed", nil)
+	default:
+		i.Update(i.T("reminders.cancelled", nil), nil)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Reply styles of command responses.
+const (
+	// replyStyleReply answers as a reply to the command without pinging its author.
+	replyStyleReply = "reply"
+	// replyStylePlain sends responses as plain channel messages.
+	replyStylePlain = "plain"
+	// replyStyleMention answers as a reply that pings the command's author.
+	replyStyleMention = "mention"
+)
+
+// replyStyles are the styles `!settings reply-style` accepts.
+var replyStyles = []string{replyStyleReply, replyStylePlain, replyStyleMention}
+
+// replyStyle returns how command responses refer to the command.
+func (cfg GuildConfig) replyStyle() string {
+	if cfg.ReplyStyle == "" {
+		return replyStyleReply
+	}
+	return cfg.ReplyStyle
+}
+
+// SendComplex sends a message to the channel the command came from, as a
+// reply to the command unless the guild prefers plain messages. Commands run
+// through the slash command are always answered plainly, as their response
+// already shows what was run.
+func (c *Context) SendComplex(msg *discordgo.MessageSend) (*discordgo.Message, error) {
+	if style := c.Config.replyStyle(); style != replyStylePlain && c.Interaction == nil {
+		// The reference doesn't fail the message when the command was deleted.
+		msg.Reference = c.Message.SoftReference()
+		if msg.AllowedMentions == nil {
+			// Other mentions keep pinging as they would without a reference.
+			msg.AllowedMentions = &discordgo.MessageAllowedMentions{Parse: []discordgo.AllowedMentionType{
+				discordgo.AllowedMentionTypeUsers, discordgo.AllowedMentionTypeRoles, discordgo.AllowedMentionTypeEveryone,
+			}}
+		}
+		msg.AllowedMentions.RepliedUser = style == replyStyleMention
+	}
+	return c.Session.ChannelMessageSendComplex(c.Message.ChannelID, msg)
+}
+
+// handleReplyStyleSetting implements `!settings reply-style [reply|plain|mention]`.
+func handleReplyStyleSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.reply_style", Args{"value": c.Config.replyStyle()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	style := strings.ToLower(fields[0])
+	if len(fields) != 1 || !slices.Contains(replyStyles, style) {
+		c.Reply("settings.reply_style_invalid", Args{"values": strings.Join(replyStyles, ", ")})
+		return
+	}
+	stored := style
+	if style == replyStyleReply {
+		stored = ""
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.ReplyStyle = stored
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save reply style: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.ReplyStyle = stored
+	c.Reply("settings.reply_style_set", Args{"value": style})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// reservationLead is how long before the next scheduled lunch a reservation reminder is sent.
+	reservationLead = 24 * time.Hour
+	// reservationSoon is when the reminder is sent if lunch is too close for reservationLead.
+	reservationSoon = 10 * time.Minute
+)
+
+// nextLunch returns the next time one of the guild's schedules runs,
+// skipping holidays.
+func (g *GuildData) nextLunch(now time.Time) (time.Time, bool) {
+	loc := g.Config.location()
+	var next time.Time
+	for _, sc := range g.Schedules {
+		at, ok := sc.next(now, loc)
+		for tries := 0; ok && tries < 366; tries++ {
+			if _, holiday := g.holiday(at); !holiday {
+				break
+			}
+			at, ok = sc.next(at.Add(time.Minute), loc)
+		}
+		if ok && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// reservationReminderTime returns when to remind a member to reserve: a day
+// before the next lunch, or shortly if lunch is today, too close or unscheduled.
+func reservationReminderTime(lunch time.Time, scheduled bool, now time.Time, loc *time.Location) time.Time {
+	soon := now.Add(reservationSoon)
+	if !scheduled {
+		return soon
+	}
+	at := lunch.Add(-reservationLead)
+	if localDate(lunch, loc) == localDate(now, loc) || at.Before(soon) {
+		return soon
+	}
+	return at
+}
+
+// followUpReservation warns in a channel that the restaurant chosen for
+// lunch needs a reservation, offering a reminder button.
+func followUpReservation(s *discordgo.Session, guildID, channelID string, cfg GuildConfig, name string) {
+	r, err := GetRestaurant(guildID, name)
+	if err != nil {
+		if !errors.Is(err, ErrRestaurantNotFound) {
+			log.Printf("Failed to check %q for a reservation: %v", name, err)
+		}
+		return
+	}
+	if !r.Reservation {
+		return
+	}
+	_, err = s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content: cfg.T("reservation.needed", Args{"name": r.Name}),
+		Components: []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: cfg.T("button.remind_reservation", nil), Style: discordgo.PrimaryButton, CustomID: "reserve:" + r.ID},
+		)},
+	})
+	if err != nil {
+		log.Printf("Failed to send reservation warning: %v", err)
+	}
+}
+
+// handleReserveComponent handles the button of a reservation warning,
+// reminding whoever clicked to book a table.
+func handleReserveComponent(i *Interaction) {
+	if len(i.Args) != 1 {
+		return
+	}
+	now := time.Now()
+	var r Restaurant
+	var lunch time.Time
+	var scheduled bool
+	err := viewGuild(i.Event.GuildID, func(g *GuildData) error {
+		idx := g.findID(i.Args[0])
+		if idx < 0 {
+			return ErrRestaurantNotFound
+		}
+		r = g.Restaurants[idx]
+		lunch, scheduled = g.nextLunch(now)
+		return nil
+	})
+	if errors.Is(err, ErrRestaurantNotFound) {
+		i.Ephemeral("reservation.gone", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load restaurant for reservation reminder: %v", err)
+		i.Ephemeral("reminders.failed", nil)
+		return
+	}
+
+	text := i.T("reservation.reminder_unscheduled", Args{"name": r.Name})
+	if scheduled {
+		text = i.T("reservation.reminder", Args{"name": r.Name, "lunch": fmt.Sprintf("<t:%d:f>", lunch.Unix())})
+	}
+	at := reservationReminderTime(lunch, scheduled, now, i.Config.location())
+	reminder, err := AddReminder(i.Event.GuildID, Reminder{ChannelID: i.Event.ChannelID, UserID: i.UserID(), Text: text, At: at})
+	if errors.Is(err, ErrTooManyReminders) {
+		i.Ephemeral("reminders.too_many", Args{"count": maxRemindersPerMember})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to add reservation reminder: %v", err)
+		i.Ephemeral("reminders.failed", nil)
+		return
+	}
+	i.EphemeralComponents(i.T("reminders.set", Args{"time": fmt.Sprintf("<t:%d:R>", at.Unix()), "id": reminder.ID}),
+		[]discordgo.MessageComponent{cancelReminderButton(i.Config, reminder.ID)})
+}
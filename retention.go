@@ -0,0 +1,201 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// retentionOff is stored in a retention setting to keep records forever.
+	retentionOff = -1
+	// maxRetentionDays is the longest retention `!settings retention` accepts.
+	maxRetentionDays = 3650
+)
+
+// Retention categories, in the order `!settings retention` lists them.
+const (
+	retentionVisits = "visits"
+	retentionAudit  = "audit"
+	retentionUsage  = "usage"
+)
+
+// retentionCategories are the kinds of records the daily pruning removes.
+// The restaurants themselves are never pruned.
+var retentionCategories = []string{retentionVisits, retentionAudit, retentionUsage}
+
+// defaultRetentionDays is the retention of each category when unset, 0 to
+// keep records forever.
+var defaultRetentionDays = map[string]int{retentionUsage: 90}
+
+// lastRetentionRun is the UTC day, as YYYY-MM-DD, of the last pruning. It is
+// only used by the scheduler, and pruning again after a restart is harmless.
+var lastRetentionRun string
+
+// retentionSetting returns a pointer to the field storing a category's retention.
+func (cfg *GuildConfig) retentionSetting(category string) *int {
+	switch category {
+	case retentionVisits:
+		return &cfg.VisitRetentionDays
+	case retentionAudit:
+		return &cfg.AuditRetentionDays
+	case retentionUsage:
+		return &cfg.UsageRetentionDays
+	}
+	return nil
+}
+
+// retentionDays returns how many days of a category's records the guild
+// keeps, 0 for all of them.
+func (cfg GuildConfig) retentionDays(category string) int {
+	switch days := *cfg.retentionSetting(category); days {
+	case 0:
+		return defaultRetentionDays[category]
+	case retentionOff:
+		return 0
+	default:
+		return days
+	}
+}
+
+// prune removes the visits, audit entries and usage days older than the
+// guild's retention, returning how many it removed per category.
+func (g *GuildData) prune(now time.Time) map[string]int {
+	counts := map[string]int{}
+	cutoff := func(category string) (time.Time, bool) {
+		days := g.Config.retentionDays(category)
+		return now.UTC().AddDate(0, 0, -days), days > 0
+	}
+	if before, ok := cutoff(retentionVisits); ok {
+		for i := range g.Restaurants {
+			r := &g.Restaurants[i]
+			n := len(r.Visits)
+			r.Visits = slices.DeleteFunc(r.Visits, func(v Visit) bool { return v.Date.Before(before) })
+			counts[retentionVisits] += n - len(r.Visits)
+		}
+	}
+	if before, ok := cutoff(retentionAudit); ok {
+		n := len(g.Audit)
+		g.Audit = slices.DeleteFunc(g.Audit, func(e AuditEntry) bool { return e.At.Before(before) })
+		counts[retentionAudit] = n - len(g.Audit)
+	}
+	if before, ok := cutoff(retentionUsage); ok {
+		n, date := len(g.Usage), before.Format("2006-01-02")
+		g.Usage = slices.DeleteFunc(g.Usage, func(d UsageDay) bool { return d.Date < date })
+		counts[retentionUsage] = n - len(g.Usage)
+	}
+	return counts
+}
+
+// pruned reports whether counts has anything removed.
+func pruned(counts map[string]int) bool {
+	for _, n := range counts {
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// runRetention prunes every guild's old records once a day.
+func runRetention(_ *discordgo.Session, now time.Time) {
+	today := now.UTC().Format("2006-01-02")
+	if lastRetentionRun == today {
+		return
+	}
+	lastRetentionRun = today
+
+	var due []string
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if pruned(g.prune(now)) {
+			due = append(due, guildID)
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check retention: %v", err)
+		return
+	}
+
+	for _, guildID := range due {
+		var counts map[string]int
+		if err := updateKnownGuild(guildID, func(g *GuildData) error {
+			counts = g.prune(now)
+			return nil
+		}); err != nil {
+			log.Printf("Failed to prune guild %s: %v", guildID, err)
+			continue
+		}
+		log.Printf("Pruned %d visits, %d audit entries and %d usage days in guild %s",
+			counts[retentionVisits], counts[retentionAudit], counts[retentionUsage], guildID)
+	}
+}
+
+// validRetention reports whether days is a valid stored retention.
+func validRetention(days int) bool {
+	return days == retentionOff || days >= 1 && days <= maxRetentionDays
+}
+
+// parseRetention parses a retention such as 365d or 365, or 0 or off to keep
+// everything.
+func parseRetention(value string) (int, bool) {
+	value = strings.ToLower(value)
+	if value == "off" {
+		return retentionOff, true
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	switch {
+	case err != nil || n < 0 || n > maxRetentionDays:
+		return 0, false
+	case n == 0:
+		return retentionOff, true
+	}
+	return n, true
+}
+
+// handleRetentionSetting implements `!settings retention [visits|audit|usage 365d|off]`.
+func handleRetentionSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.SendQuiet(retentionSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	category := strings.ToLower(fields[0])
+	if len(fields) != 2 || c.Config.retentionSetting(category) == nil {
+		c.Reply("settings.retention_usage", Args{"max": maxRetentionDays})
+		return
+	}
+	days, ok := parseRetention(fields[1])
+	if !ok {
+		c.Reply("settings.retention_usage", Args{"max": maxRetentionDays})
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		*g.Config.retentionSetting(category) = days
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save retention: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	*c.Config.retentionSetting(category) = days
+	c.SendQuiet(retentionSettingLine(c.Config))
+}
+
+// retentionSettingLine describes how long the guild keeps each category.
+func retentionSettingLine(cfg GuildConfig) string {
+	var parts []string
+	for _, category := range retentionCategories {
+		key := "settings.retention_days"
+		if cfg.retentionDays(category) == 0 {
+			key = "settings.retention_forever"
+		}
+		parts = append(parts, cfg.T(key, Args{"category": cfg.T("settings.retention_category_"+category, nil), "count": cfg.retentionDays(category)}))
+	}
+	return cfg.T("settings.retention", Args{"values": strings.Join(parts, ", ")})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+// oldGuild returns a guild with visits, audit entries and usage days from
+// 10, 100 and 400 days before now.
+func oldGuild(now time.Time) *GuildData {
+	g := &GuildData{}
+	ages := []int{10, 100, 400}
+	r := Restaurant{ID: "1", Name: "Pizza Place", AddedAt: now.AddDate(-5, 0, 0)}
+	for _, age := range ages {
+		at := now.AddDate(0, 0, -age)
+		r.Visits = append(r.Visits, Visit{Date: at, Attendees: []string{"1"}})
+		g.Audit = append(g.Audit, AuditEntry{At: at, Action: auditAdd, Name: "Pizza Place"})
+		g.Usage = append(g.Usage, UsageDay{Date: at.Format("2006-01-02"), Users: map[string]int{"1": 1}})
+	}
+	g.Restaurants = []Restaurant{r}
+	return g
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		cfg  GuildConfig
+		want map[string]int
+	}{
+		// Usage is kept for 90 days unless the guild says otherwise.
+		{"defaults", GuildConfig{}, map[string]int{retentionUsage: 2}},
+		{"all off", GuildConfig{VisitRetentionDays: retentionOff, AuditRetentionDays: retentionOff, UsageRetentionDays: retentionOff}, map[string]int{}},
+		{"a year", GuildConfig{VisitRetentionDays: 365, AuditRetentionDays: 365, UsageRetentionDays: 365}, map[string]int{retentionVisits: 1, retentionAudit: 1, retentionUsage: 1}},
+		{"a month", GuildConfig{VisitRetentionDays: 30, AuditRetentionDays: 30, UsageRetentionDays: 30}, map[string]int{retentionVisits: 2, retentionAudit: 2, retentionUsage: 2}},
+		{"a week", GuildConfig{VisitRetentionDays: 7, AuditRetentionDays: retentionOff, UsageRetentionDays: 7}, map[string]int{retentionVisits: 3, retentionUsage: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := oldGuild(now)
+			g.Config = tt.cfg
+			got := g.prune(now)
+			maps.DeleteFunc(got, func(_ string, n int) bool { return n == 0 })
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("prune = %v, want %v", got, tt.want)
+			}
+			if len(g.Restaurants) != 1 {
+				t.Errorf("prune removed restaurants: %v", g.Restaurants)
+			}
+			if n := len(g.Restaurants[0].Visits); n != 3-tt.want[retentionVisits] {
+				t.Errorf("%d visits left, want %d", n, 3-tt.want[retentionVisits])
+			}
+			if n := len(g.Audit); n != 3-tt.want[retentionAudit] {
+				t.Errorf("%d audit entries left, want %d", n, 3-tt.want[retentionAudit])
+			}
+			if n := len(g.Usage); n != 3-tt.want[retentionUsage] {
+				t.Errorf("%d usage days left, want %d", n, 3-tt.want[retentionUsage])
+			}
+			if again := g.prune(now); pruned(again) {
+				t.Errorf("pruning again removed %v", again)
+			}
+		})
+	}
+}
+
+func TestPruneKeepsRecordsAtTheCutoff(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	g := &GuildData{Config: GuildConfig{VisitRetentionDays: 30, AuditRetentionDays: 30, UsageRetentionDays: 30}}
+	cutoff := now.AddDate(0, 0, -30)
+	g.Restaurants = []Restaurant{{ID: "1", Name: "Pizza Place", Visits: []Visit{{Date: cutoff}, {Date: cutoff.Add(-time.Second)}}}}
+	g.Audit = []AuditEntry{{At: cutoff}, {At: cutoff.Add(-time.Second)}}
+	g.Usage = []UsageDay{{Date: cutoff.Format("2006-01-02")}, {Date: cutoff.AddDate(0, 0, -1).Format("2006-01-02")}}
+
+	want := map[string]int{retentionVisits: 1, retentionAudit: 1, retentionUsage: 1}
+	if got := g.prune(now); !maps.Equal(got, want) {
+		t.Errorf("prune = %v, want %v", got, want)
+	}
+}
+
+func TestRunRetention(t *testing.T) {
+	newTestDB(t)
+	now := time.Now().UTC()
+	for guildID, days := range map[string]int{"old": 30, "kept": retentionOff} {
+		err := updateGuild(guildID, func(g *GuildData) error {
+			*g = *oldGuild(now)
+			g.Config.VisitRetentionDays, g.Config.AuditRetentionDays, g.Config.UsageRetentionDays = days, days, days
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastRetentionRun = ""
+	t.Cleanup(func() { lastRetentionRun = "" })
+	runRetention(nil, now)
+
+	for guildID, left := range map[string]int{"old": 1, "kept": 3} {
+		err := viewKnownGuild(guildID, func(g *GuildData) error {
+			if n := len(g.Restaurants[0].Visits); n != left {
+				t.Errorf("guild %s: %d visits left, want %d", guildID, n, left)
+			}
+			if len(g.Audit) != left || len(g.Usage) != left {
+				t.Errorf("guild %s: %d audit entries and %d usage days left, want %d", guildID, len(g.Audit), len(g.Usage), left)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		value string
+		days  int
+		ok    bool
+	}{
+		{"365", 365, true},
+		{"365d", 365, true},
+		{"30D", 30, true},
+		{"off", retentionOff, true},
+		{"OFF", retentionOff, true},
+		{"0", retentionOff, true},
+		{"3650", 3650, true},
+		{"3651", 0, false},
+		{"-1", 0, false},
+		{"a year", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		if days, ok := parseRetention(tt.value); days != tt.days || ok != tt.ok {
+			t.Errorf("parseRetention(%q) = %d, %v, want %d, %v", tt.value, days, ok, tt.days, tt.ok)
+		}
+	}
+}
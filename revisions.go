@@ -0,0 +1,271 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRevisions is the number of revisions kept in a restaurant's history.
+const maxRevisions = 20
+
+var (
+	// ErrRevisionNotKept is returned when reverting to a revision older than
+	// the restaurant's history goes back, or one it hasn't reached.
+	ErrRevisionNotKept = errors.New("revision not in the history")
+	// ErrRevisionCurrent is returned when reverting to the current revision.
+	ErrRevisionCurrent = errors.New("already at that revision")
+)
+
+// RevisionEntry records a change to a restaurant's details.
+type RevisionEntry struct {
+	Revision int       `json:"revision"`
+	At       time.Time `json:"at"`
+	// By is the member who made the change, nil for changes from outside Discord.
+	By      *Contributor  `json:"by,omitempty"`
+	Changes []FieldChange `json:"changes"`
+	// RevertedTo is the revision a !revert restored, nil for other changes.
+	RevertedTo *int `json:"reverted_to,omitempty"`
+}
+
+// FieldChange is the change of one detail, with the values rendered the way
+// !set accepts them, "" when unset.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// detailValue is one detail of a restaurant, rendered like FieldChange values.
+type detailValue struct {
+	Field string
+	Value string
+}
+
+// details renders the details a revision records: the name, the tags and
+// every attribute.
+func (r *Restaurant) details() []detailValue {
+	values := []detailValue{{"name", r.Name}, {"tags", formatTags(r.Tags)}}
+	for _, a := range attributeRegistry {
+		values = append(values, detailValue{a.Key, a.formatValue(a.get(r))})
+	}
+	return values
+}
+
+// changedFields compares two renderings of the same restaurant's details.
+func changedFields(before, after []detailValue) []FieldChange {
+	var changes []FieldChange
+	for n, b := range before {
+		if a := after[n]; a.Value != b.Value {
+			changes = append(changes, FieldChange{Field: b.Field, Before: b.Value, After: a.Value})
+		}
+	}
+	return changes
+}
+
+// revise records a change to the restaurant's details, given as they were
+// before it, as a new revision. Changes that leave the details as they were
+// don't count. The oldest revisions beyond maxRevisions are dropped.
+func (r *Restaurant) revise(before []detailValue, by *Contributor) *RevisionEntry {
+	changes := changedFields(before, r.details())
+	if len(changes) == 0 {
+		return nil
+	}
+	r.Revision++
+	r.History = append(r.History, RevisionEntry{Revision: r.Revision, At: time.Now().UTC(), By: by, Changes: changes})
+	if extra := len(r.History) - maxRevisions; extra > 0 {
+		r.History = slices.Delete(r.History, 0, extra)
+	}
+	return &r.History[len(r.History)-1]
+}
+
+// setDetail changes one detail as rendered by details, "" clearing it.
+func (g *GuildData) setDetail(i int, field, value string) error {
+	r := &g.Restaurants[i]
+	switch field {
+	case "name":
+		if err := validateName(value, g.Config.maxNameLength()); err != nil {
+			return err
+		}
+		if j := g.find(value); j >= 0 && j != i {
+			return &NameTakenError{Name: value, Owner: g.Restaurants[j].Name}
+		}
+		r.Name = value
+		r.Aliases = slices.DeleteFunc(r.Aliases, func(a string) bool { return strings.EqualFold(a, value) })
+	case "tags":
+		tags, invalid := parseTags(strings.Fields(value))
+		if invalid != "" {
+			return fmt.Errorf("invalid tag %q", invalid)
+		}
+		r.Tags = tags
+	default:
+		a := attributeByKey(field)
+		if a == nil {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		parsed, ok := a.zero(), true
+		if value != "" {
+			parsed, ok = a.parseValue(value)
+		}
+		if !ok {
+			return fmt.Errorf("invalid %s %q", field, value)
+		}
+		a.set(r, parsed)
+	}
+	return nil
+}
+
+// RevertRestaurant restores the details that changed after a revision to
+// their values as of that revision, recording it as a new revision. It
+// returns the restaurant's canonical name and the new revision.
+func RevertRestaurant(guildID, name string, revision int, by Contributor) (string, *RevisionEntry, error) {
+	var canonical string
+	var entry *RevisionEntry
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		canonical = r.Name
+		switch {
+		case revision == r.Revision:
+			return ErrRevisionCurrent
+		case revision < 0 || revision > r.Revision || len(r.History) == 0 || revision < r.History[0].Revision-1:
+			return ErrRevisionNotKept
+		}
+		// The value of a field as of the revision is the one before the
+		// first later change of it.
+		restore := map[string]string{}
+		var order []string
+		for _, e := range r.History {
+			if e.Revision <= revision {
+				continue
+			}
+			for _, c := range e.Changes {
+				if _, ok := restore[c.Field]; !ok {
+					restore[c.Field] = c.Before
+					order = append(order, c.Field)
+				}
+			}
+		}
+		before := r.details()
+		for _, field := range order {
+			if err := g.setDetail(i, field, restore[field]); err != nil {
+				return err
+			}
+		}
+		if entry = r.revise(before, &by); entry == nil {
+			return errNoChange
+		}
+		entry.RevertedTo = &revision
+		canonical = r.Name
+		g.audit(auditEdit, canonical, &by, sourceDiscord)
+		return nil
+	})
+	return canonical, entry, err
+}
+
+// revisionLine describes a revision for !history-of and exports.
+func revisionLine(cfg GuildConfig, e RevisionEntry) string {
+	var changes []string
+	for _, c := range e.Changes {
+		changes = append(changes, fieldChangeText(c))
+	}
+	args := Args{"revision": e.Revision, "date": e.At.In(cfg.location()).Format("2006-01-02 15:04"), "changes": strings.Join(changes, "; ")}
+	key := "history_of.line"
+	if e.By != nil {
+		key, args["by"] = "history_of.line_by", formatContributor(cfg, e.By)
+	}
+	line := cfg.T(key, args)
+	if e.RevertedTo != nil {
+		line += " " + cfg.T("history_of.reverted", Args{"revision": *e.RevertedTo})
+	}
+	return line
+}
+
+// fieldChangeText renders a change as "field before → after".
+func fieldChangeText(c FieldChange) string {
+	before, after := c.Before, c.After
+	if before == "" {
+		before = "—"
+	}
+	if after == "" {
+		after = "—"
+	}
+	return fmt.Sprintf("%s %s → %s", c.Field, before, after)
+}
+
+// handleHistoryOf implements `!history-of "Name"`, listing the revisions of
+// a restaurant's details, newest first.
+func handleHistoryOf(c *Context) {
+	name, _, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("history_of.usage", nil)
+		return
+	}
+	var r Restaurant
+	err := viewGuild(c.GuildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r = g.Restaurants[i]
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to look up restaurant: %v", err)
+		c.replyError("history_of.failed", err, name)
+		return
+	}
+	if len(r.History) == 0 {
+		c.Reply("history_of.empty", Args{"name": r.Name})
+		return
+	}
+	var lines []string
+	for n := len(r.History) - 1; n >= 0; n-- {
+		lines = append(lines, "- "+revisionLine(c.Config, r.History[n]))
+	}
+	c.SendPages(c.T("history_of.header", Args{"name": r.Name, "count": len(r.History)}), lines)
+}
+
+// handleRevert implements `!revert "Name" N`, restoring the details that
+// changed after revision N.
+func handleRevert(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	name, rest, ok := parseRef(c.Args)
+	revision, err := strconv.Atoi(rest)
+	if !ok || name == "" || err != nil {
+		c.Reply("revert.usage", nil)
+		return
+	}
+	canonical, entry, err := RevertRestaurant(c.GuildID, name, revision, contributorFor(c.Message.Author))
+	var taken *NameTakenError
+	switch {
+	case errors.Is(err, ErrRevisionCurrent):
+		c.Reply("revert.current", Args{"name": canonical, "revision": revision})
+	case errors.Is(err, ErrRevisionNotKept):
+		c.Reply("revert.not_kept", Args{"name": canonical, "revision": revision})
+	case errors.Is(err, errNoChange):
+		c.Reply("revert.unchanged", Args{"name": canonical, "revision": revision})
+	case errors.As(err, &taken):
+		c.Reply("edit.name_taken", Args{"name": taken.Name, "owner": taken.Owner})
+	case errors.Is(err, ErrNameTooLong), errors.Is(err, ErrNameLineBreak), errors.Is(err, ErrNameCodeBlock):
+		c.replyNameError(err)
+	case err != nil:
+		log.Printf("Failed to revert restaurant: %v", err)
+		c.replyError("revert.failed", err, name)
+	default:
+		var changes []string
+		for _, change := range entry.Changes {
+			changes = append(changes, "- "+fieldChangeText(change))
+		}
+		c.Ack("revert.done", Args{"name": canonical, "revision": revision, "changes": strings.Join(changes, "\n")})
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Schedule kinds.
+const (
+	scheduleSuggest = "suggest"
+	schedulePoll    = "poll"
+)
+
+// maxSchedules bounds the number of schedules per guild.
+const maxSchedules = 10
+
+// weekdayNames are the day names schedules accept, indexed by time.Weekday.
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var (
+	// ErrTooManySchedules is returned when a guild already has maxSchedules schedules.
+	ErrTooManySchedules = errors.New("too many schedules")
+	// ErrScheduleNotFound is returned when removing a schedule that doesn't exist.
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+// Schedule posts a suggestion or starts a poll at a fixed time on some weekdays.
+type Schedule struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	ChannelID string `json:"channel_id"`
+	// Time is the local time of day in the guild's timezone, as HH:MM.
+	Time string `json:"time"`
+	// Days are the weekdays the schedule runs on, every day when empty.
+	Days []time.Weekday `json:"days,omitempty"`
+	// Filter restricts the restaurants the schedule picks from.
+	Filter  string    `json:"filter,omitempty"`
+	LastRun time.Time `json:"last_run"`
+	// Suggestions counts the suggestions the schedule posted.
+	Suggestions int `json:"suggestions,omitempty"`
+}
+
+// runsOn reports whether the schedule runs on a weekday.
+func (s Schedule) runsOn(day time.Weekday) bool {
+	return len(s.Days) == 0 || slices.Contains(s.Days, day)
+}
+
+// clock returns the hour and minute of the schedule.
+func (s Schedule) clock() (int, int) {
+	t, err := time.Parse("15:04", s.Time)
+	if err != nil {
+		return 0, 0
+	}
+	return t.Hour(), t.Minute()
+}
+
+// occurrence returns the time the schedule runs on the local day of t, if it runs that day.
+func (s Schedule) occurrence(t time.Time, loc *time.Location) (time.Time, bool) {
+	t = t.In(loc)
+	hour, minute := s.clock()
+	at := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, loc)
+	return at, s.runsOn(at.Weekday())
+}
+
+// previous returns the most recent run time at or before now.
+func (s Schedule) previous(now time.Time, loc *time.Location) (time.Time, bool) {
+	for d := 0; d <= 7; d++ {
+		if at, ok := s.occurrence(now.AddDate(0, 0, -d), loc); ok && !at.After(now) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// next returns the first run time at or after t.
+func (s Schedule) next(t time.Time, loc *time.Location) (time.Time, bool) {
+	for d := 0; d <= 7; d++ {
+		if at, ok := s.occurrence(t.AddDate(0, 0, d), loc); ok && !at.Before(t) {
+			return at, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseDays parses "daily", "weekdays", "weekends", ranges like "mon-fri" and
+// lists like "mon,wed,fri". Every day is returned as an empty list.
+func parseDays(s string) ([]time.Weekday, bool) {
+	switch strings.ToLower(s) {
+	case "daily":
+		return nil, true
+	case "weekdays":
+		s = "mon-fri"
+	case "weekends":
+		s = "sat,sun"
+	}
+	day := func(name string) (time.Weekday, bool) {
+		i := slices.Index(weekdayNames, strings.ToLower(name))
+		return time.Weekday(i), i >= 0
+	}
+	var days []time.Weekday
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := day(from)
+		if !ok {
+			return nil, false
+		}
+		last := first
+		if isRange {
+			if last, ok = day(to); !ok {
+				return nil, false
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			if !slices.Contains(days, d) {
+				days = append(days, d)
+			}
+			if d == last {
+				break
+			}
+		}
+	}
+	if len(days) == 7 {
+		return nil, true
+	}
+	slices.Sort(days)
+	return days, true
+}
+
+// formatDays renders schedule days the way users type them.
+func formatDays(days []time.Weekday) string {
+	if len(days) == 0 {
+		return "daily"
+	}
+	names := make([]string, len(days))
+	for i, d := range days {
+		names[i] = weekdayNames[d]
+	}
+	return strings.Join(names, ",")
+}
+
+// AddSchedule saves a new schedule.
+func AddSchedule(guildID string, s Schedule) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		if len(g.Schedules) >= maxSchedules {
+			return ErrTooManySchedules
+		}
+		g.Schedules = append(g.Schedules, s)
+		return nil
+	})
+}
+
+// RemoveSchedule deletes a schedule by ID.
+func RemoveSchedule(guildID, id string) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		i := slices.IndexFunc(g.Schedules, func(s Schedule) bool { return s.ID == id })
+		if i < 0 {
+			return ErrScheduleNotFound
+		}
+		g.Schedules = slices.Delete(g.Schedules, i, i+1)
+		return nil
+	})
+}
+
+// runSchedules posts the suggestions and polls of every schedule whose run
+// time has passed since it last ran. A schedule missed while the bot was
+// down or held by quiet hours runs once when it comes back.
+func runSchedules(s *discordgo.Session, now time.Time) {
+	type dueSchedule struct {
+		guildID  string
+		cfg      GuildConfig
+		schedule Schedule
+		snoozed  bool
+		// holiday is the name of the holiday the run falls on, if any.
+		holiday string
+		// at is the run time that came due.
+		at time.Time
+	}
+	var due []dueSchedule
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if g.Config.quietAt(now) {
+			return
+		}
+		loc := g.Config.location()
+		for _, sc := range g.Schedules {
+			if at, ok := sc.previous(now, loc); ok && at.After(sc.LastRun) {
+				holiday, _ := g.holiday(at)
+				due = append(due, dueSchedule{guildID, g.Config, sc, g.snoozed(at), holiday, at})
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check schedules: %v", err)
+		return
+	}
+	// Runs held by quiet hours follow each other in the order they were due.
+	sort.SliceStable(due, func(i, j int) bool { return due[i].at.Before(due[j].at) })
+
+	for _, d := range due {
+		err := updateGuild(d.guildID, func(g *GuildData) error {
+			for i := range g.Schedules {
+				if g.Schedules[i].ID == d.schedule.ID {
+					g.Schedules[i].LastRun = now.UTC()
+					if d.schedule.Kind != schedulePoll && !d.snoozed && d.holiday == "" {
+						g.Schedules[i].Suggestions++
+					}
+					d.schedule = g.Schedules[i]
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to save schedule %s: %v", d.schedule.ID, err)
+			continue
+		}
+		if d.snoozed {
+			continue
+		}
+		if d.holiday != "" {
+			log.Printf("Skipping schedule %s in guild %s for %s", d.schedule.ID, d.guildID, d.holiday)
+			announceHoliday(s, d.guildID, d.schedule.ChannelID, d.cfg, localDate(now, d.cfg.location()), d.holiday)
+			continue
+		}
+		if err := runSchedule(s, d.guildID, d.cfg, d.schedule, now); err != nil {
+			log.Printf("Schedule %s failed for guild %s: %v", d.schedule.ID, d.guildID, err)
+		}
+	}
+}
+
+// runSchedule posts the suggestion or poll of a schedule.
+func runSchedule(s *discordgo.Session, guildID string, cfg GuildConfig, sc Schedule, now time.Time) error {
+	query, ferr := parseQuery(sc.Filter)
+	if ferr != nil {
+		return ferr
+	}
+	query.require(cfg)
+	restaurants, err := GetRestaurants(guildID)
+	if err != nil {
+		return err
+	}
+	switch sc.Kind {
+	case schedulePoll:
+		candidates := pollCandidates(restaurants, query, now)
+		if len(candidates) < 2 {
+			return fmt.Errorf("only %d poll candidates", len(candidates))
+		}
+		if query.Anonymous && len(query.Members) < 2 {
+			return errors.New("anonymous poll without participants")
+		}
+		return postPoll(s, guildID, sc.ChannelID, cfg, candidates, query, now)
+	default:
+		candidates := query.Apply(restaurants)
+		if len(candidates) == 0 {
+			return ErrNoRestaurants
+		}
+		label := ""
+		if untriedTurn(cfg, sc.Suggestions) {
+			if pool := untriedPool(candidates); len(pool) > 0 {
+				candidates, label = pool, cfg.T("untried.label", nil)
+			}
+		}
+		pick := weightedSample(candidates, 1, cfg.pickWeight(restaurants, now))[0]
+		return postPick(s, guildID, sc.ChannelID, cfg, pick, label)
+	}
+}
+
+// scheduleLine describes a schedule in !schedule list.
+func scheduleLine(cfg GuildConfig, sc Schedule) string {
+	args := Args{"id": sc.ID, "time": sc.Time, "days": formatDays(sc.Days), "channel": "<#" + sc.ChannelID + ">"}
+	key := "schedule.line_suggest"
+	if sc.Kind == schedulePoll {
+		key = "schedule.line_poll"
+	}
+	line := cfg.T(key, args)
+	if sc.Filter != "" {
+		line += " · `" + sc.Filter + "`"
+	}
+	return line
+}
+
+// handleSchedule implements `!schedule`, `!schedule suggest|poll HH:MM [days] [filter]`
+// and `!schedule remove ID`.
+func handleSchedule(c *Context) {
+	fields := strings.Fields(c.Args)
+	if len(fields) == 0 || strings.EqualFold(fields[0], "list") {
+		var schedules []Schedule
+		if err := viewGuild(c.GuildID, func(g *GuildData) error {
+			schedules = g.Schedules
+			return nil
+		}); err != nil {
+			log.Printf("Failed to load schedules: %v", err)
+			c.Reply("schedule.failed", nil)
+			return
+		}
+		if len(schedules) == 0 {
+			c.Reply("schedule.none", nil)
+			return
+		}
+		lines := []string{c.T("schedule.header", Args{"timezone": c.Config.location().String()})}
+		for _, sc := range schedules {
+			lines = append(lines, "- "+scheduleLine(c.Config, sc))
+		}
+		c.Send(strings.Join(lines, "\n"))
+		return
+	}
+
+	kind := strings.ToLower(fields[0])
+	switch kind {
+	case "remove":
+		if !c.RequireAdmin() {
+			return
+		}
+		if len(fields) != 2 {
+			c.Reply("schedule.usage", nil)
+			return
+		}
+		err := RemoveSchedule(c.GuildID, fields[1])
+		switch {
+		case errors.Is(err, ErrScheduleNotFound):
+			c.Reply("schedule.not_found", Args{"id": fields[1]})
+		case err != nil:
+			log.Printf("Failed to remove schedule: %v", err)
+			c.Reply("schedule.failed", nil)
+		default:
+			c.Reply("schedule.removed", Args{"id": fields[1]})
+		}
+		return
+	case scheduleSuggest, schedulePoll:
+	default:
+		c.Reply("schedule.usage", nil)
+		return
+	}
+
+	if !c.RequireAdmin() {
+		return
+	}
+	if len(fields) < 2 {
+		c.Reply("schedule.usage", nil)
+		return
+	}
+	at, err := time.Parse("15:04", fields[1])
+	if err != nil {
+		c.Reply("schedule.invalid_time", Args{"time": fields[1]})
+		return
+	}
+	rest := fields[2:]
+	var days []time.Weekday
+	if len(rest) > 0 {
+		if parsed, ok := parseDays(rest[0]); ok {
+			days, rest = parsed, rest[1:]
+		}
+	}
+	filter := strings.Join(rest, " ")
+	if _, ferr := parseQuery(filter); ferr != nil {
+		c.replyFilterError(ferr)
+		return
+	}
+
+	sc := Schedule{
+		ID:        newToken()[:6],
+		Kind:      kind,
+		ChannelID: c.Message.ChannelID,
+		Time:      at.Format("15:04"),
+		Days:      days,
+		Filter:    filter,
+		LastRun:   time.Now().UTC(),
+	}
+	if err := AddSchedule(c.GuildID, sc); err != nil {
+		if errors.Is(err, ErrTooManySchedules) {
+			c.Reply("schedule.too_many", Args{"count": maxSchedules})
+			return
+		}
+		log.Printf("Failed to save schedule: %v", err)
+		c.Reply("schedule.failed", nil)
+		return
+	}
+	c.Reply("schedule.added", Args{"schedule": scheduleLine(c.Config, sc)})
+}
+
+// handleTimezoneSetting implements `!settings timezone [Area/City|UTC]`.
+func handleTimezoneSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.timezone", Args{"value": c.Config.location().String()})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	loc, err := time.LoadLocation(fields[0])
+	if err != nil || len(fields) != 1 || strings.EqualFold(fields[0], "local") {
+		c.Reply("settings.timezone_invalid", Args{"value": fields[0]})
+		return
+	}
+	timezone := loc.String()
+	if timezone == "UTC" {
+		timezone = ""
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.Timezone = timezone
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save timezone: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.Timezone = timezone
+	c.Reply("settings.timezone_set", Args{"value": loc.String()})
+}
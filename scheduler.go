@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// startScheduler runs the periodic jobs once a minute for the lifetime of the process.
+func startScheduler(s *discordgo.Session) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runScheduledJobs(s, now)
+		}
+	}()
+}
+
+// runScheduledJobs runs every job that may be due at now.
+func runScheduledJobs(s *discordgo.Session, now time.Time) {
+	runWeeklySpotlights(s, now)
+	runScheduledBackups(s, now)
+	closeDuePolls(s, now)
+	advanceLunches(s, now)
+	closeDueBattles(s, now)
+	advanceTournaments(s, now)
+	runMonthlyRecaps(s, now)
+	runReminders(s, now)
+	runRatingPrompts(s, now)
+	runReopenings(s, now)
+	runSchedules(s, now)
+	checkProposals(s, now)
+	flushUsage(now)
+	runRetention(s, now)
+	runDirectoryRefresh(s, now)
+	runReadOnlyProbe(s, now)
+}
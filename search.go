@@ -0,0 +1,190 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxPatternLength bounds glob and regex patterns.
+	maxPatternLength = 100
+)
+
+// searchMatcher reports whether a restaurant name matches a search.
+type searchMatcher func(name string) bool
+
+// parseSearch builds the matcher for a search term. Terms starting with re:
+// are regular expressions, terms containing * or ? are globs, and anything
+// else matches as a case-insensitive substring. It returns the catalog key of
+// the problem for invalid patterns.
+func parseSearch(term string) (searchMatcher, string) {
+	if pattern, ok := strings.CutPrefix(term, "re:"); ok {
+		if pattern == "" || utf8.RuneCountInString(pattern) > maxPatternLength {
+			return nil, "search.pattern_length"
+		}
+		// Go's regexp runs in time linear in the input, so a pattern can't
+		// take longer than scanning the stored names.
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, "search.invalid_regex"
+		}
+		return re.MatchString, ""
+	}
+	if strings.ContainsAny(term, "*?") {
+		if utf8.RuneCountInString(term) > maxPatternLength {
+			return nil, "search.pattern_length"
+		}
+		re, err := globPattern(term)
+		if err != nil {
+			return nil, "search.invalid_glob"
+		}
+		return re.MatchString, ""
+	}
+	term = strings.ToLower(term)
+	return func(name string) bool { return strings.Contains(strings.ToLower(name), term) }, ""
+}
+
+// isPlainSearch reports whether a search term matches as a substring rather
+// than as a pattern.
+func isPlainSearch(term string) bool {
+	return !strings.HasPrefix(term, "re:") && !strings.ContainsAny(term, "*?")
+}
+
+// Search score weights. A match of the whole name ranks above a word match,
+// which ranks above a word prefix, and the rest only break ties between them.
+const (
+	scoreWholeName  = 400
+	scoreWord       = 200
+	scoreNamePrefix = 100
+	scoreWordPrefix = 50
+	scoreTag        = 80
+	scoreTagPart    = 20
+	scoreEarliest   = 30
+	scorePerStar    = 4
+)
+
+// searchWords lowercases s and replaces everything but letters and digits
+// with single spaces, so that "Cocktails & Thai-ish" becomes "cocktails thai ish".
+func searchWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// searchScore ranks a restaurant for a plain search term: the whole name,
+// whole words and word prefixes matching count most, then tags, how early the
+// term appears in the name and the rating, 0 when unrated. An empty term,
+// as for patterns, ranks by rating alone.
+func searchScore(name string, tags []string, term string, rating float64) float64 {
+	score := rating * scorePerStar
+	term = searchWords(term)
+	if term == "" {
+		return score
+	}
+	words := searchWords(name)
+	padded := " " + words + " "
+	switch {
+	case words == term:
+		score += scoreWholeName
+	case strings.Contains(padded, " "+term+" "):
+		score += scoreWord
+	}
+	switch {
+	case strings.HasPrefix(words, term):
+		score += scoreNamePrefix
+	case strings.Contains(padded, " "+term):
+		score += scoreWordPrefix
+	}
+	if i := strings.Index(words, term); i >= 0 {
+		score += scoreEarliest * (1 - float64(i)/float64(len(words)))
+	}
+	for _, tag := range tags {
+		switch tag = searchWords(tag); {
+		case tag == term:
+			score += scoreTag
+		case strings.Contains(tag, term):
+			score += scoreTagPart
+		}
+	}
+	return score
+}
+
+// handleSearch implements `!search term`, `!search "The *"` and `!search re:^Pho`,
+// listing the best matches first.
+func handleSearch(c *Context) {
+	term := c.Args
+	if quoted, _, ok := parseQuoted(c.Args); ok {
+		term = quoted
+	}
+	if term == "" {
+		c.Reply("search.usage", nil)
+		return
+	}
+	match, problem := parseSearch(term)
+	if problem != "" {
+		c.Reply(problem, Args{"pattern": term, "max": maxPatternLength})
+		return
+	}
+
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	matches := searchMatches(c.Config, restaurants, term, match, time.Now())
+	if len(matches) == 0 {
+		c.Reply("search.none", Args{"pattern": term})
+		return
+	}
+
+	var lines []string
+	for _, r := range matches {
+		line := "- " + listEntry(r)
+		if r.IsArchived() {
+			line += " · " + archiveLine(c.Config, r.Archived)
+		}
+		lines = append(lines, line)
+	}
+	c.SendPages(c.T("search.header", Args{"count": len(matches), "pattern": term}), lines)
+}
+
+// searchMatches returns the restaurants a search for term finds, the best
+// matches first.
+func searchMatches(cfg GuildConfig, restaurants []Restaurant, term string, match searchMatcher, now time.Time) []Restaurant {
+	// Plain terms also find restaurants by their tags, and rank the matches
+	// by searchScore. Patterns rank by rating alone.
+	plain := ""
+	if isPlainSearch(term) {
+		plain = term
+	}
+	tagged := func(r Restaurant) bool {
+		return plain != "" && slices.ContainsFunc(r.Tags, func(tag string) bool { return match(tag) })
+	}
+	var matches []Restaurant
+	scores := map[string]float64{}
+	for _, r := range restaurants {
+		if slices.ContainsFunc(r.allNames(), match) || tagged(r) {
+			// Restaurants found by a nickname rank by it if it fits better.
+			rating, _ := r.Rating(cfg, now)
+			matches = append(matches, r)
+			for _, name := range r.allNames() {
+				scores[r.ID] = max(scores[r.ID], searchScore(name, r.Tags, plain, rating))
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if scores[a.ID] != scores[b.ID] {
+			return scores[a.ID] > scores[b.ID]
+		}
+		return lessFold(a.Name, b.Name)
+	})
+	return matches
+}
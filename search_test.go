@@ -0,0 +1,125 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// rated returns a restaurant with one rating of stars, unrated for 0.
+func rated(name string, stars int, tags ...string) Restaurant {
+	r := Restaurant{ID: name, Name: name, Tags: tags}
+	if stars > 0 {
+		r.Ratings = map[string]int{"1": stars}
+	}
+	return r
+}
+
+func TestSearchRanking(t *testing.T) {
+	tests := []struct {
+		name        string
+		term        string
+		restaurants []Restaurant
+		want        []string
+	}{
+		{
+			name:        "whole name before word",
+			term:        "pho",
+			restaurants: []Restaurant{rated("Best Pho", 0), rated("Pho", 0)},
+			want:        []string{"Pho", "Best Pho"},
+		},
+		{
+			name:        "word before word prefix",
+			term:        "thai",
+			restaurants: []Restaurant{rated("Thailand Express", 0), rated("Royal Thai", 0)},
+			want:        []string{"Royal Thai", "Thailand Express"},
+		},
+		{
+			name:        "name prefix before later word prefix",
+			term:        "bur",
+			restaurants: []Restaurant{rated("Best Burgers", 0), rated("Burrito Place", 0)},
+			want:        []string{"Burrito Place", "Best Burgers"},
+		},
+		{
+			name:        "word prefix before substring",
+			term:        "sta",
+			restaurants: []Restaurant{rated("Pasta Bar", 0), rated("Star Diner", 0)},
+			want:        []string{"Star Diner", "Pasta Bar"},
+		},
+		{
+			name:        "name match before tag match",
+			term:        "sushi",
+			restaurants: []Restaurant{rated("Ocean", 5, "sushi"), rated("Sushi Ya", 0)},
+			want:        []string{"Sushi Ya", "Ocean"},
+		},
+		{
+			name:        "tag match before tag part",
+			term:        "vegan",
+			restaurants: []Restaurant{rated("Green", 0, "vegan-friendly"), rated("Leaf", 0, "vegan")},
+			want:        []string{"Leaf", "Green"},
+		},
+		{
+			name:        "earlier match first",
+			term:        "ram",
+			restaurants: []Restaurant{rated("Shiro Ramen", 0), rated("Ichi Ramen", 0)},
+			want:        []string{"Ichi Ramen", "Shiro Ramen"},
+		},
+		{
+			name:        "rating breaks ties",
+			term:        "taco",
+			restaurants: []Restaurant{rated("Taco Two", 3), rated("Taco One", 5)},
+			want:        []string{"Taco One", "Taco Two"},
+		},
+		{
+			name:        "rating doesn't outrank a better match",
+			term:        "taco",
+			restaurants: []Restaurant{rated("Tacos El Rey", 5), rated("Taco", 1)},
+			want:        []string{"Taco", "Tacos El Rey"},
+		},
+		{
+			name:        "punctuation separates words",
+			term:        "thai",
+			restaurants: []Restaurant{rated("Thaicafe", 0), rated("Cocktails & Thai-ish", 0)},
+			want:        []string{"Cocktails & Thai-ish", "Thaicafe"},
+		},
+		{
+			name:        "equal scores by name",
+			term:        "grill",
+			restaurants: []Restaurant{rated("b grill", 0), rated("A grill", 0)},
+			want:        []string{"A grill", "b grill"},
+		},
+		{
+			name:        "patterns by rating",
+			term:        "*Bar",
+			restaurants: []Restaurant{rated("Salad Bar", 2), rated("Bar", 0), rated("Sushi Bar", 4)},
+			want:        []string{"Sushi Bar", "Salad Bar", "Bar"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, problem := parseSearch(tt.term)
+			if problem != "" {
+				t.Fatal(problem)
+			}
+			var got []string
+			for _, r := range searchMatches(GuildConfig{}, tt.restaurants, tt.term, match, time.Now()) {
+				got = append(got, r.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("search %q = %v, want %v", tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRankingByNickname(t *testing.T) {
+	restaurants := []Restaurant{
+		{ID: "1", Name: "Golden Dragon Palace", Aliases: []string{"dim sum"}},
+		{ID: "2", Name: "Dim Sum Express"},
+	}
+	match, _ := parseSearch("dim sum")
+	got := searchMatches(GuildConfig{}, restaurants, "dim sum", match, time.Now())
+	if len(got) != 2 || got[0].ID != "1" {
+		t.Errorf("search found %v, want the restaurant nicknamed dim sum first", got)
+	}
+}
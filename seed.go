@@ -0,0 +1,225 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// seedTag marks the restaurants added by !seed, so that `!remove-all #seeded` undoes it.
+	seedTag = "seeded"
+	// seedTimeout is how long the confirm button of a seed stays valid.
+	seedTimeout = 60 * time.Second
+)
+
+// seedEntry is a restaurant in the embedded starter lists.
+type seedEntry struct {
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags,omitempty"`
+	Price int      `json:"price,omitempty"`
+	Diet  []string `json:"diet,omitempty"`
+}
+
+//go:embed seeds/starter.json
+var starterData []byte
+
+// starterLists maps a city, or "generic", to its starter restaurants.
+var starterLists = mustLoadStarterLists()
+
+func mustLoadStarterLists() map[string][]seedEntry {
+	var lists map[string][]seedEntry
+	if err := json.Unmarshal(starterData, &lists); err != nil {
+		log.Fatalf("Failed to load starter lists: %v", err)
+	}
+	for city, entries := range lists {
+		for _, e := range entries {
+			for _, t := range e.Tags {
+				if tag, ok := parseTag("#" + t); !ok || tag != t {
+					log.Fatalf("Invalid tag %q in starter list %s", t, city)
+				}
+			}
+			for _, d := range e.Diet {
+				if !slices.Contains(dietFlags, d) {
+					log.Fatalf("Invalid diet flag %q in starter list %s", d, city)
+				}
+			}
+		}
+	}
+	return lists
+}
+
+// starterCities returns the names of the starter lists, sorted.
+func starterCities() []string {
+	var cities []string
+	for city := range starterLists {
+		cities = append(cities, city)
+	}
+	sort.Strings(cities)
+	return cities
+}
+
+// pendingSeed is a seed waiting for confirmation.
+type pendingSeed struct {
+	guildID string
+	userID  string
+	city    string
+	entries []seedEntry
+	expires time.Time
+}
+
+var (
+	// pendingSeeds stores seeds waiting for confirmation, keyed by token.
+	pendingSeeds      = make(map[string]*pendingSeed)
+	pendingSeedsMutex sync.Mutex
+)
+
+// SeedRestaurants adds the starter entries not already on the list, tagged
+// seedTag, up to the guild's list size limit, in a single write.
+func SeedRestaurants(guildID string, entries []seedEntry, by Contributor) (importResult, error) {
+	restaurants := make([]Restaurant, len(entries))
+	for i, e := range entries {
+		restaurants[i] = Restaurant{Name: e.Name, Tags: append(slices.Clone(e.Tags), seedTag), Price: e.Price, Diet: slices.Clone(e.Diet)}
+	}
+	var result importResult
+	err := updateGuild(guildID, func(g *GuildData) error {
+		result = g.importEntries(restaurants, by)
+		return nil
+	}, syncSave)
+	return result, err
+}
+
+// handleSeed implements `!seed CITY [--merge]`, previewing a starter list
+// and adding it once confirmed.
+func handleSeed(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	fields := strings.Fields(strings.ToLower(c.Args))
+	merge := slices.Contains(fields, "--merge")
+	fields = slices.DeleteFunc(fields, func(f string) bool { return f == "--merge" })
+	if len(fields) != 1 {
+		c.Reply("seed.usage", Args{"cities": strings.Join(starterCities(), ", ")})
+		return
+	}
+	city := fields[0]
+	entries, ok := starterLists[city]
+	if !ok {
+		c.Reply("seed.unknown_city", Args{"city": city, "cities": strings.Join(starterCities(), ", ")})
+		return
+	}
+
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	if len(restaurants) > 0 && !merge {
+		c.Reply("seed.not_empty", Args{"count": len(restaurants), "city": city})
+		return
+	}
+
+	token := newToken()
+	op := &pendingSeed{guildID: c.GuildID, userID: c.Message.Author.ID, city: city, entries: entries, expires: time.Now().Add(seedTimeout)}
+	pendingSeedsMutex.Lock()
+	pendingSeeds[token] = op
+	pendingSeedsMutex.Unlock()
+
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content:         seedPreview(c.Config, op, restaurants),
+		Components:      seedComponents(c.Config, token),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to send seed preview: %v", err)
+		return
+	}
+
+	time.AfterFunc(seedTimeout, func() {
+		pendingSeedsMutex.Lock()
+		_, pending := pendingSeeds[token]
+		delete(pendingSeeds, token)
+		pendingSeedsMutex.Unlock()
+		if !pending {
+			return
+		}
+		content := c.T("seed.expired", Args{"city": city})
+		components := []discordgo.MessageComponent{}
+		if _, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: msg.ID, Channel: msg.ChannelID, Content: &content, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to expire seed preview: %v", err)
+		}
+	})
+}
+
+// seedPreview lists the entries a seed would add, marking those already on the list.
+func seedPreview(cfg GuildConfig, op *pendingSeed, existing []Restaurant) string {
+	lines := []string{cfg.T("seed.preview", Args{"count": len(op.entries), "city": op.city})}
+	for _, e := range op.entries {
+		line := "- " + listEntry(Restaurant{Name: e.Name, Tags: e.Tags, Price: e.Price, Diet: e.Diet})
+		if slices.ContainsFunc(existing, func(r Restaurant) bool { return !r.Deleted() && strings.EqualFold(r.Name, e.Name) }) {
+			line += " " + cfg.T("seed.already_listed", nil)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, cfg.T("seed.confirm_hint", Args{"seconds": int(seedTimeout.Seconds()), "tag": "#" + seedTag}))
+	return strings.Join(lines, "\n")
+}
+
+// seedComponents builds the confirmation buttons of a seed.
+func seedComponents(cfg GuildConfig, token string) []discordgo.MessageComponent {
+	id := func(action string) string { return fmt.Sprintf("seed:%s:%s", token, action) }
+	return []discordgo.MessageComponent{buttonRow(
+		discordgo.Button{Label: cfg.T("button.confirm", nil), Style: discordgo.PrimaryButton, CustomID: id("confirm")},
+		discordgo.Button{Label: cfg.T("button.cancel", nil), Style: discordgo.SecondaryButton, CustomID: id("cancel")},
+	)}
+}
+
+// handleSeedComponent handles the buttons of a seed preview.
+func handleSeedComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pendingSeedsMutex.Lock()
+	op, ok := pendingSeeds[token]
+	if ok && time.Now().After(op.expires) {
+		delete(pendingSeeds, token)
+		ok = false
+	}
+	if !ok {
+		pendingSeedsMutex.Unlock()
+		i.Update(i.T("seed.expired_generic", nil), nil)
+		return
+	}
+	if i.UserID() != op.userID {
+		pendingSeedsMutex.Unlock()
+		i.Ephemeral("seed.not_yours", nil)
+		return
+	}
+	delete(pendingSeeds, token)
+	pendingSeedsMutex.Unlock()
+
+	if action != "confirm" {
+		i.Update(i.T("seed.cancelled", Args{"city": op.city}), nil)
+		return
+	}
+	result, err := SeedRestaurants(op.guildID, op.entries, contributorFor(i.Event.Member.User))
+	if err != nil {
+		log.Printf("Failed to seed restaurants: %v", err)
+		i.Update(i.T("seed.failed", nil), nil)
+		return
+	}
+	i.Update(importSummary(i.Config, i.T("seed.done", Args{"count": result.Added, "city": op.city, "tag": "#" + seedTag}), result), nil)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"cmp"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleSettings implements `!settings` and its per-key subcommands.
+func handleSettings(c *Context) {
+	key, rest, _ := strings.Cut(c.Args, " ")
+	fields := strings.Fields(rest)
+	switch strings.ToLower(key) {
+	case "":
+		sendSettingsOverview(c)
+
+	case "reset":
+		handleSettingsReset(c, fields)
+
+	case "export":
+		handleSettingsExport(c)
+
+	case "import":
+		handleSettingsImport(c)
+
+	case "language":
+		if len(fields) == 0 {
+			c.Reply("settings.language", Args{"value": c.Lang()})
+			return
+		}
+		if !c.RequireAdmin() {
+			return
+		}
+		lang := strings.ToLower(fields[0])
+		if len(fields) != 1 || !translator.HasLanguage(lang) {
+			c.Reply("settings.language_invalid", Args{"languages": strings.Join(translator.Languages(), ", ")})
+			return
+		}
+		if err := updateGuild(c.GuildID, func(g *GuildData) error {
+			g.Config.Language = lang
+			return nil
+		}); err != nil {
+			log.Printf("Failed to save language: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		c.Config.Language = lang
+		c.Reply("settings.language_set", Args{"value": lang})
+
+	case "template":
+		handleTemplateSetting(c, rest)
+
+	case "backup":
+		handleBackupSetting(c, fields)
+
+	case "office":
+		handleOfficeSetting(c, fields)
+
+	case "attribution":
+		handleAttributionSetting(c, fields)
+
+	case "limit":
+		handleLimitSetting(c, fields)
+
+	case "timezone":
+		handleTimezoneSetting(c, fields)
+
+	case "api":
+		handleAPISetting(c, fields)
+
+	case "photos":
+		handlePhotoSetting(c, fields)
+
+	case "removal-votes":
+		handleRemovalVotesSetting(c, fields)
+
+	case "random-weighting", "pick-weight":
+		handlePickWeightSetting(c, fields)
+
+	case "recap":
+		handleRecapSetting(c, fields)
+
+	case "reopen":
+		handleReopenSetting(c, fields)
+
+	case "require":
+		handleRequireSetting(c, fields)
+
+	case "holidays":
+		handleHolidaysSetting(c, fields)
+
+	case "currency":
+		handleCurrencySetting(c, fields)
+
+	case "finance-role":
+		handleFinanceRoleSetting(c, fields)
+
+	case "me":
+		handleMeSetting(c, fields)
+
+	case "untried":
+		handleUntriedSetting(c, fields)
+
+	case "rating-decay":
+		handleRatingDecaySetting(c, fields)
+
+	case "rate-prompt":
+		handleRatingPromptSetting(c, fields)
+
+	case "poll":
+		handlePollSetting(c, fields)
+
+	case "retention":
+		handleRetentionSetting(c, fields)
+
+	case "reply-style":
+		handleReplyStyleSetting(c, fields)
+
+	case "allow-bots":
+		handleAllowBotsSetting(c, fields)
+
+	case "announce":
+		handleAnnounceSetting(c, fields)
+
+	case "quiet":
+		handleQuietSetting(c, fields)
+
+	case "directory":
+		handleDirectorySetting(c, fields)
+
+	case "name-length":
+		handleNameLengthSetting(c, fields)
+
+	case "ack":
+		handleAckSetting(c, fields)
+
+	default:
+		c.Reply("settings.unknown", Args{"keys": strings.Join(settingKeys, ", ")})
+	}
+}
+
+// settingKeys are the keys `!settings` knows, in the order of its overview.
+var settingKeys = []string{
+	"language", "template", "backup", "office", "attribution", "limit", "timezone", "api", "photos", "removal-votes",
+	"random-weighting", "recap", "reopen", "require", "holidays", "currency", "finance-role", "me", "rating-decay",
+	"untried", "rate-prompt", "poll", "retention", "reply-style", "allow-bots", "announce", "quiet", "directory", "name-length",
+	"ack", "reset", "export", "import",
+}
+
+// sendSettingsOverview lists the current value of every setting.
+func sendSettingsOverview(c *Context) {
+	mode := c.Config.SpotlightMode
+	if mode == "" {
+		mode = spotlightModePin
+	}
+	backup := c.T("backup.setting_off", nil)
+	if c.Config.BackupChannelID != "" {
+		backup = c.T("backup.setting_on", Args{"channel": "<#" + c.Config.BackupChannelID + ">", "count": c.Config.backupIntervalDays()})
+	}
+	office := c.T("settings.office_none", nil)
+	if c.Config.Office != nil {
+		office = c.T("settings.office", Args{"value": c.Config.Office.String()})
+	}
+	c.SendQuiet(strings.Join([]string{
+		c.T("settings.header", nil),
+		c.T("settings.language", Args{"value": c.Lang()}),
+		c.T("settings.spotlight_mode", Args{"value": mode}),
+		c.T("settings.templates", Args{"count": len(c.Config.Templates)}),
+		c.T("settings.flavors", Args{"count": len(c.Config.Flavors)}),
+		backup,
+		office,
+		c.T("settings.attribution", Args{"value": c.Config.attributionStyle()}),
+		c.T("settings.limit", Args{"count": c.Config.maxRestaurants()}),
+		c.T("settings.timezone", Args{"value": c.Config.location().String()}),
+		apiSettingLine(c.Config),
+		photoSettingLine(c.Config),
+		c.T("settings.removal_votes", Args{"count": c.Config.removalVotes()}),
+		c.T("settings.pick_weight", Args{"value": cmp.Or(c.Config.PickWeight, pickWeightRecency)}),
+		recapSettingLine(c.Config),
+		reopenSettingLine(c.Config),
+		requireSettingLine(c.Config),
+		holidaysSettingLine(c.Config),
+		c.T("settings.currency", Args{"value": c.Config.currency()}),
+		financeRoleSettingLine(c.Config),
+		c.T(ratingDecaySettingKey(c.Config), Args{"count": c.Config.RatingHalfLifeMonths}),
+		c.T(untriedSettingKey(c.Config), Args{"count": c.Config.UntriedEvery}),
+		c.T("settings.rate_prompt", Args{"value": c.Config.ratingPromptMode()}),
+		pollSettingLine(c.Config),
+		retentionSettingLine(c.Config),
+		c.T("settings.reply_style", Args{"value": c.Config.replyStyle()}),
+		c.T(allowBotsSettingKey(c.Config), nil),
+		announceSettingLine(c.Config),
+		c.T(quietSettingKey(c.Config), Args{"value": c.Config.QuietHours, "timezone": c.Config.location().String()}),
+		c.T(directorySettingKey(c.Config), nil),
+		c.T("settings.name_length", Args{"count": c.Config.maxNameLength()}),
+		c.T("settings.ack", Args{"value": c.Config.ackMode()}),
+	}, "\n"))
+}
+
+// handleSettingsReset implements `!settings reset`, restoring the defaults of
+// everything `!settings` manages. The list size limit, which only the bot
+// owner sets, the budget and the spotlight are kept.
+func handleSettingsReset(c *Context, fields []string) {
+	if !c.RequireAdmin() {
+		return
+	}
+	if len(fields) != 0 {
+		c.Reply("settings.reset_usage", nil)
+		return
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config = g.Config.defaults()
+		return nil
+	}); err != nil {
+		log.Printf("Failed to reset settings: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config = c.Config.defaults()
+	if err := syncDirectory(c.GuildID, time.Now()); err != nil {
+		log.Printf("Failed to update the restaurant directory: %v", err)
+	}
+	c.Reply("settings.reset_done", nil)
+	sendSettingsOverview(c)
+}
+
+// defaults returns the config with every option `!settings` manages back at
+// its default.
+func (cfg GuildConfig) defaults() GuildConfig {
+	return GuildConfig{
+		MaxRestaurants:     cfg.MaxRestaurants,
+		BudgetCents:        cfg.BudgetCents,
+		SpotlightMode:      cfg.SpotlightMode,
+		SpotlightChannelID: cfg.SpotlightChannelID,
+	}
+}
+
+// handleLimitSetting implements `!settings limit [N|default]`, which only the bot owner may change.
+func handleLimitSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply("settings.limit", Args{"count": c.Config.maxRestaurants()})
+		return
+	}
+	if !c.RequireOwner() {
+		return
+	}
+	limit := 0
+	if !strings.EqualFold(fields[0], "default") {
+		n, err := strconv.Atoi(fields[0])
+		if err != nil || n < 1 || len(fields) != 1 {
+			c.Reply("settings.limit_invalid", nil)
+			return
+		}
+		limit = n
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.MaxRestaurants = limit
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save list size limit: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.MaxRestaurants = limit
+	c.Reply("settings.limit_set", Args{"count": c.Config.maxRestaurants()})
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// settingsFileVersion is the format version of settings exports.
+	settingsFileVersion = 1
+	// maxSettingsFileSize bounds the attachments `!settings import` is willing to download.
+	maxSettingsFileSize = 256 << 10
+	// settingsImportTimeout is how long the confirm button of a settings import stays valid.
+	settingsImportTimeout = 60 * time.Second
+	// maxPreviewValue bounds each value shown in a settings import preview, in runes.
+	maxPreviewValue = 60
+)
+
+// settingsFile is the JSON attachment of `!settings export`.
+type settingsFile struct {
+	Version    int         `json:"version"`
+	GuildID    string      `json:"guild_id"`
+	ExportedAt time.Time   `json:"exported_at"`
+	Settings   GuildConfig `json:"settings"`
+}
+
+// exportable returns the options a settings export carries. The list size
+// limit is left out since only the bot owner may change it.
+func (cfg GuildConfig) exportable() GuildConfig {
+	cfg.MaxRestaurants = 0
+	return cfg
+}
+
+// skippedSetting is an imported option that was left at its current value.
+type skippedSetting struct {
+	Field string
+	// Reason is the catalog key explaining why.
+	Reason string
+	Value  string
+}
+
+// sanitizeSettings checks every imported option the way its setting command
+// would, resetting the invalid ones and those referring to channels or roles
+// missing from the guild instead of rejecting the whole file.
+func sanitizeSettings(cfg GuildConfig, channelExists, roleExists func(id string) bool) (GuildConfig, []skippedSetting) {
+	var skipped []skippedSetting
+	check := func(field string, set bool, valid bool, value string, reset func()) {
+		if set && !valid {
+			skipped = append(skipped, skippedSetting{Field: field, Reason: "settings.import_invalid", Value: value})
+			reset()
+		}
+	}
+	channel := func(field string, id *string) {
+		if *id != "" && !channelExists(*id) {
+			skipped = append(skipped, skippedSetting{Field: field, Reason: "settings.import_missing_channel", Value: "<#" + *id + ">"})
+			*id = ""
+		}
+	}
+
+	check("language", cfg.Language != "", translator.HasLanguage(cfg.Language), cfg.Language, func() { cfg.Language = "" })
+	for name, text := range cfg.Templates {
+		_, known := responseTemplates[name]
+		check("templates."+name, true, known && validateTemplate(name, text) == nil, truncateRunes(text, maxPreviewValue), func() { delete(cfg.Templates, name) })
+	}
+	var flavors []string
+	for _, text := range cfg.Flavors {
+		valid := validateFlavor(text) == nil && len(flavors) < maxFlavors
+		check("flavors", true, valid, truncateRunes(text, maxPreviewValue), func() {})
+		if valid {
+			flavors = append(flavors, text)
+		}
+	}
+	cfg.Flavors = flavors
+	check("spotlight_mode", cfg.SpotlightMode != "", cfg.SpotlightMode == spotlightModePin || cfg.SpotlightMode == spotlightModeTopic, cfg.SpotlightMode, func() { cfg.SpotlightMode = "" })
+	channel("spotlight_channel_id", &cfg.SpotlightChannelID)
+	channel("backup_channel_id", &cfg.BackupChannelID)
+	check("backup_interval_days", cfg.BackupIntervalDays != 0, cfg.BackupIntervalDays >= 1 && cfg.BackupIntervalDays <= 90, fmt.Sprint(cfg.BackupIntervalDays), func() { cfg.BackupIntervalDays = 0 })
+	if cfg.Office != nil {
+		_, ok := parseLocation(cfg.Office.String())
+		check("office", true, ok, cfg.Office.String(), func() { cfg.Office = nil })
+	}
+	check("attribution_style", cfg.AttributionStyle != "", cfg.AttributionStyle == attributionMention || cfg.AttributionStyle == attributionName, cfg.AttributionStyle, func() { cfg.AttributionStyle = "" })
+	_, err := time.LoadLocation(cfg.Timezone)
+	check("timezone", cfg.Timezone != "", err == nil && !strings.EqualFold(cfg.Timezone, "local"), cfg.Timezone, func() { cfg.Timezone = "" })
+	channel("api_channel_id", &cfg.APIChannelID)
+	channel("photo_channel_id", &cfg.PhotoChannelID)
+	check("removal_votes", cfg.RemovalVotes != 0, cfg.RemovalVotes >= 1 && cfg.RemovalVotes <= maxRemovalVotes, fmt.Sprint(cfg.RemovalVotes), func() { cfg.RemovalVotes = 0 })
+	check("pick_weight", cfg.PickWeight != "", cfg.PickWeight != pickWeightRecency && slices.Contains(pickWeights, cfg.PickWeight), cfg.PickWeight, func() { cfg.PickWeight = "" })
+	channel("recap_channel_id", &cfg.RecapChannelID)
+	channel("reopen_channel_id", &cfg.ReopenChannelID)
+	channel("announce_channel_id", &cfg.AnnounceChannelID)
+	if len(cfg.RequiredPayments) > 0 {
+		methods, ok := parsePayments(strings.Join(cfg.RequiredPayments, ","))
+		check("required_payments", true, ok && len(methods) > 0, strings.Join(cfg.RequiredPayments, ", "), func() { cfg.RequiredPayments = nil })
+		if ok {
+			cfg.RequiredPayments = methods
+		}
+	}
+	_, known := publicHolidays[cfg.HolidayCountry]
+	check("holiday_country", cfg.HolidayCountry != "", known, cfg.HolidayCountry, func() { cfg.HolidayCountry = "" })
+	check("budget_cents", cfg.BudgetCents != 0, cfg.BudgetCents > 0, fmt.Sprint(cfg.BudgetCents), func() { cfg.BudgetCents = 0 })
+	check("currency", cfg.Currency != "", validCurrency(cfg.Currency), cfg.Currency, func() { cfg.Currency = "" })
+	if cfg.FinanceRoleID != "" && !roleExists(cfg.FinanceRoleID) {
+		skipped = append(skipped, skippedSetting{Field: "finance_role_id", Reason: "settings.import_missing_role", Value: cfg.FinanceRoleID})
+		cfg.FinanceRoleID = ""
+	}
+	check("untried_every", cfg.UntriedEvery != 0, cfg.UntriedEvery >= 1 && cfg.UntriedEvery <= maxUntriedEvery, fmt.Sprint(cfg.UntriedEvery), func() { cfg.UntriedEvery = 0 })
+	check("rating_half_life_months", cfg.RatingHalfLifeMonths != 0, cfg.RatingHalfLifeMonths >= 1 && cfg.RatingHalfLifeMonths <= maxRatingHalfLife, fmt.Sprint(cfg.RatingHalfLifeMonths), func() { cfg.RatingHalfLifeMonths = 0 })
+	check("rating_prompt", cfg.RatingPrompt != "", cfg.RatingPrompt == ratingPromptDM || cfg.RatingPrompt == ratingPromptOff, cfg.RatingPrompt, func() { cfg.RatingPrompt = "" })
+	check("poll_duration", cfg.PollDuration != 0, cfg.PollDuration >= minPollDuration && cfg.PollDuration <= maxPollDuration, cfg.PollDuration.String(), func() { cfg.PollDuration = 0 })
+	check("poll_quorum", cfg.PollQuorum != 0, cfg.PollQuorum >= 1 && cfg.PollQuorum <= maxPollQuorum, fmt.Sprint(cfg.PollQuorum), func() { cfg.PollQuorum = 0 })
+	check("visit_retention_days", cfg.VisitRetentionDays != 0, validRetention(cfg.VisitRetentionDays), fmt.Sprint(cfg.VisitRetentionDays), func() { cfg.VisitRetentionDays = 0 })
+	check("audit_retention_days", cfg.AuditRetentionDays != 0, validRetention(cfg.AuditRetentionDays), fmt.Sprint(cfg.AuditRetentionDays), func() { cfg.AuditRetentionDays = 0 })
+	check("usage_retention_days", cfg.UsageRetentionDays != 0, validRetention(cfg.UsageRetentionDays), fmt.Sprint(cfg.UsageRetentionDays), func() { cfg.UsageRetentionDays = 0 })
+	check("max_name_length", cfg.MaxNameLength != 0, cfg.MaxNameLength >= minNameLengthLimit && cfg.MaxNameLength <= maxNameLengthLimit, fmt.Sprint(cfg.MaxNameLength), func() { cfg.MaxNameLength = 0 })
+	check("reply_style", cfg.ReplyStyle != "", cfg.ReplyStyle != replyStyleReply && slices.Contains(replyStyles, cfg.ReplyStyle), cfg.ReplyStyle, func() { cfg.ReplyStyle = "" })
+	_, _, quietOK := parseQuietHours(cfg.QuietHours)
+	check("quiet_hours", cfg.QuietHours != "", quietOK, cfg.QuietHours, func() { cfg.QuietHours = "" })
+	check("ack", cfg.Ack != "", cfg.Ack == ackReaction, cfg.Ack, func() { cfg.Ack = "" })
+	return cfg, skipped
+}
+
+// changedSettings lists the options that differ between two configs by their
+// JSON field names, with the new values, sorted by field.
+func changedSettings(before, after GuildConfig) [][2]string {
+	fields := func(cfg GuildConfig) map[string]json.RawMessage {
+		m := map[string]json.RawMessage{}
+		data, _ := json.Marshal(cfg)
+		json.Unmarshal(data, &m)
+		return m
+	}
+	old, updated := fields(before), fields(after)
+	var keys []string
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range updated {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var changes [][2]string
+	for _, k := range keys {
+		if !bytes.Equal(old[k], updated[k]) {
+			value := "-"
+			if v, ok := updated[k]; ok {
+				value = truncateRunes(string(v), maxPreviewValue)
+			}
+			changes = append(changes, [2]string{k, value})
+		}
+	}
+	return changes
+}
+
+// parseSettingsFile decodes and checks the format of a settings export.
+func parseSettingsFile(data []byte) (*settingsFile, error) {
+	var file settingsFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("not a valid settings file: %w", err)
+	}
+	if file.Version != settingsFileVersion {
+		return nil, fmt.Errorf("unsupported settings file version %d", file.Version)
+	}
+	return &file, nil
+}
+
+// handleSettingsExport implements `!settings export`, attaching the guild's settings as JSON.
+func handleSettingsExport(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	now := time.Now().UTC()
+	data, err := json.MarshalIndent(settingsFile{Version: settingsFileVersion, GuildID: c.GuildID, ExportedAt: now, Settings: c.Config.exportable()}, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode settings: %v", err)
+		c.Reply("settings.export_failed", nil)
+		return
+	}
+	c.SendFile(c.T("settings.export_attached", nil), &discordgo.File{
+		Name:        fmt.Sprintf("settings-%s.json", now.Format("2006-01-02")),
+		ContentType: "application/json",
+		Reader:      bytes.NewReader(data),
+	})
+}
+
+// pendingSettingsImport is a settings import waiting for confirmation.
+type pendingSettingsImport struct {
+	guildID  string
+	userID   string
+	settings GuildConfig
+	expires  time.Time
+}
+
+var (
+	// pendingSettingsImports stores settings imports waiting for confirmation, keyed by token.
+	pendingSettingsImports      = make(map[string]*pendingSettingsImport)
+	pendingSettingsImportsMutex sync.Mutex
+)
+
+// handleSettingsImport implements `!settings import` with an attached export,
+// previewing the changes and applying them once confirmed.
+func handleSettingsImport(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	if len(c.Message.Attachments) != 1 {
+		c.Reply("settings.import_usage", nil)
+		return
+	}
+	data, err := downloadAttachment(c.Ctx, c.Message.Attachments[0], maxSettingsFileSize)
+	if err != nil {
+		log.Printf("Failed to download settings file: %v", err)
+		if !c.timedOut(err) {
+			c.Reply("import.download_failed", nil)
+		}
+		return
+	}
+	file, err := parseSettingsFile(data)
+	if err != nil {
+		c.Reply("import.invalid", Args{"error": err})
+		return
+	}
+
+	var roles []string
+	if guildRoles, err := c.Session.GuildRoles(c.GuildID); err != nil {
+		log.Printf("Failed to load roles of guild %s: %v", c.GuildID, err)
+	} else {
+		for _, r := range guildRoles {
+			roles = append(roles, r.ID)
+		}
+	}
+	channelExists := func(id string) bool {
+		ch, err := c.Session.State.Channel(id)
+		if err != nil {
+			ch, err = c.Session.Channel(id)
+		}
+		return err == nil && ch.GuildID == c.GuildID
+	}
+	settings, skipped := sanitizeSettings(file.Settings, channelExists, func(id string) bool { return slices.Contains(roles, id) })
+	if id := settings.AnnounceChannelID; id != "" && announceChannelProblem(c.Session, c.GuildID, id) != "" {
+		skipped = append(skipped, skippedSetting{Field: "announce_channel_id", Reason: "settings.import_invalid", Value: "<#" + id + ">"})
+		settings.AnnounceChannelID = ""
+	}
+	settings.MaxRestaurants = c.Config.MaxRestaurants
+
+	changes := changedSettings(c.Config, settings)
+	lines := []string{c.T("settings.import_preview", Args{"count": len(changes)})}
+	for _, change := range changes {
+		lines = append(lines, "- `"+change[0]+"`: "+change[1])
+	}
+	for _, s := range skipped {
+		lines = append(lines, "⚠️ "+c.T(s.Reason, Args{"field": s.Field, "value": s.Value}))
+	}
+	if len(changes) == 0 {
+		lines = append(lines, c.T("settings.import_unchanged", nil))
+		c.SendQuiet(strings.Join(lines, "\n"))
+		return
+	}
+	lines = append(lines, c.T("settings.import_confirm_hint", Args{"seconds": int(settingsImportTimeout.Seconds())}))
+
+	token := newToken()
+	pendingSettingsImportsMutex.Lock()
+	pendingSettingsImports[token] = &pendingSettingsImport{guildID: c.GuildID, userID: c.Message.Author.ID, settings: settings, expires: time.Now().Add(settingsImportTimeout)}
+	pendingSettingsImportsMutex.Unlock()
+
+	id := func(action string) string { return fmt.Sprintf("setimport:%s:%s", token, action) }
+	msg, err := c.SendComplex(&discordgo.MessageSend{
+		Content: strings.Join(lines, "\n"),
+		Components: []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: c.T("button.confirm", nil), Style: discordgo.PrimaryButton, CustomID: id("confirm")},
+			discordgo.Button{Label: c.T("button.cancel", nil), Style: discordgo.SecondaryButton, CustomID: id("cancel")},
+		)},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to send settings import preview: %v", err)
+		return
+	}
+
+	time.AfterFunc(settingsImportTimeout, func() {
+		pendingSettingsImportsMutex.Lock()
+		_, pending := pendingSettingsImports[token]
+		delete(pendingSettingsImports, token)
+		pendingSettingsImportsMutex.Unlock()
+		if !pending {
+			return
+		}
+		content := c.T("settings.import_expired", nil)
+		components := []discordgo.MessageComponent{}
+		if _, err := c.Session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: msg.ID, Channel: msg.ChannelID, Content: &content, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to expire settings import preview: %v", err)
+		}
+	})
+}
+
+// handleSettingsImportComponent handles the buttons of a settings import preview.
+func handleSettingsImportComponent(i *Interaction) {
+	if len(i.Args) != 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pendingSettingsImportsMutex.Lock()
+	op, ok := pendingSettingsImports[token]
+	if ok && time.Now().After(op.expires) {
+		delete(pendingSettingsImports, token)
+		ok = false
+	}
+	if !ok {
+		pendingSettingsImportsMutex.Unlock()
+		i.Update(i.T("settings.import_expired", nil), nil)
+		return
+	}
+	if i.UserID() != op.userID {
+		pendingSettingsImportsMutex.Unlock()
+		i.Ephemeral("settings.import_not_yours", nil)
+		return
+	}
+	delete(pendingSettingsImports, token)
+	pendingSettingsImportsMutex.Unlock()
+
+	if action != "confirm" {
+		i.Update(i.T("settings.import_cancelled", nil), nil)
+		return
+	}
+	if err := updateGuild(op.guildID, func(g *GuildData) error {
+		settings := op.settings
+		settings.MaxRestaurants = g.Config.MaxRestaurants
+		if settings.AnnounceChannelID != g.Config.AnnounceChannelID {
+			g.AnnounceAdminID, g.AnnounceWarned = op.userID, false
+		}
+		g.Config = settings
+		return nil
+	}, syncSave); err != nil {
+		log.Printf("Failed to import settings: %v", err)
+		i.Update(i.T("settings.save_failed", nil), nil)
+		return
+	}
+	if err := syncDirectory(op.guildID, time.Now()); err != nil {
+		log.Printf("Failed to update the restaurant directory: %v", err)
+	}
+	i.Update(i.T("settings.import_done", nil), nil)
+}
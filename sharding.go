@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Sharding splits the bot's guilds between gateway connections, which Discord
+// requires from 2,500 guilds on. SHARD_COUNT sets the number of shards, or
+// auto for the number Discord recommends. Without SHARD_ID the process runs
+// all shards itself. With SHARD_ID it runs that shard only and other
+// processes run the rest, sharing the database file.
+
+// identifyInterval spaces the connections of the shards a process runs, as
+// Discord only accepts one identify every five seconds.
+const identifyInterval = 5 * time.Second
+
+// gatewayShards are the shards this process runs. It stays unsharded, one
+// shard of one, unless configureShards says otherwise.
+var gatewayShards = shardInfo{IDs: []int{0}, Count: 1}
+
+// shardInfo identifies the shards a process runs.
+type shardInfo struct {
+	IDs   []int `json:"ids"`
+	Count int   `json:"count"`
+}
+
+// String renders the shards like 2/4, or 0-3/4 for a range.
+func (si shardInfo) String() string {
+	if len(si.IDs) == 1 {
+		return fmt.Sprintf("%d/%d", si.IDs[0], si.Count)
+	}
+	return fmt.Sprintf("%d-%d/%d", si.IDs[0], si.IDs[len(si.IDs)-1], si.Count)
+}
+
+// parseShardEnv reads SHARD_ID and SHARD_COUNT. id is -1 without SHARD_ID
+// and count 0 for auto.
+func parseShardEnv() (id, count int, err error) {
+	idVar, countVar := os.Getenv("SHARD_ID"), strings.ToLower(os.Getenv("SHARD_COUNT"))
+	id, count = -1, 1
+	switch {
+	case countVar == "auto":
+		count = 0
+	case countVar != "":
+		if count, err = strconv.Atoi(countVar); err != nil || count < 1 {
+			return 0, 0, fmt.Errorf("SHARD_COUNT %q is not a number of shards. Use a positive number or auto.", countVar)
+		}
+	}
+	if idVar == "" {
+		return id, count, nil
+	}
+	if count == 0 {
+		return 0, 0, errors.New("SHARD_ID needs a fixed SHARD_COUNT, as every process must agree on it. Set SHARD_COUNT to a number, or unset SHARD_ID to run all shards in this process.")
+	}
+	if id, err = strconv.Atoi(idVar); err != nil || id < 0 || id >= count {
+		return 0, 0, fmt.Errorf("SHARD_ID %q is not a shard of %d. Use a number from 0 to %d.", idVar, count, count-1)
+	}
+	return id, count, nil
+}
+
+// checkShardConfig reports sharding settings that can't work.
+func checkShardConfig() error {
+	id, count, err := parseShardEnv()
+	if err != nil {
+		return err
+	}
+	if id >= 0 && count > 1 && opLogEnabled() {
+		return errors.New("DB_OPLOG can't be used with SHARD_ID, as the processes share the database file. Unset one of them.")
+	}
+	return nil
+}
+
+// configureShards decides which shards this process runs, asking Discord
+// for the recommended count with SHARD_COUNT=auto.
+func configureShards(s *discordgo.Session) error {
+	id, count, err := parseShardEnv()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		gw, err := s.GatewayBot()
+		if err != nil {
+			return fmt.Errorf("failed to get the recommended shard count: %w", err)
+		}
+		count = max(gw.Shards, 1)
+		log.Printf("Discord recommends %d shard(s)", count)
+	}
+	if id >= 0 {
+		gatewayShards = shardInfo{IDs: []int{id}, Count: count}
+	} else {
+		gatewayShards = shardInfo{Count: count}
+		for i := range count {
+			gatewayShards.IDs = append(gatewayShards.IDs, i)
+		}
+	}
+	if count > 1 {
+		log.Printf("Running shard(s) %s", gatewayShards)
+	}
+	return nil
+}
+
+// separateShardProcesses reports whether other processes run some of the
+// shards, so that this one owns only part of the guilds in the database.
+func separateShardProcesses() bool {
+	return len(gatewayShards.IDs) < gatewayShards.Count
+}
+
+// guildShardID returns the shard Discord sends a guild's events to.
+func guildShardID(guildID string, count int) int {
+	id, err := strconv.ParseUint(guildID, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return int((id >> 22) % uint64(count))
+}
+
+// ownsGuild reports whether this process runs the shard of a guild. Only the
+// owner runs the guild's scheduled jobs and changes its data.
+func ownsGuild(guildID string) bool {
+	if !separateShardProcesses() {
+		return true
+	}
+	return guildShardID(guildID, gatewayShards.Count) == gatewayShards.IDs[0]
+}
+
+// shardSessions returns a session for every shard this process runs, dg
+// being the first. The others use its token.
+func shardSessions(dg *discordgo.Session) ([]*discordgo.Session, error) {
+	sessions := []*discordgo.Session{dg}
+	dg.ShardID, dg.ShardCount = gatewayShards.IDs[0], gatewayShards.Count
+	for _, id := range gatewayShards.IDs[1:] {
+		s, err := discordgo.New(dg.Token)
+		if err != nil {
+			return nil, err
+		}
+		s.ShardID, s.ShardCount = id, gatewayShards.Count
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
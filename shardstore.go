@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// Shard processes share the database file but each owns only its guilds.
+// They write the file in turns, each taking the other guilds from the file
+// as it is and refreshing its copy of them, so that no process overwrites
+// another's changes.
+
+const (
+	// dbLockTimeout is how long a write waits for another process's.
+	dbLockTimeout = 10 * time.Second
+	// staleDBLock is the age after which a lock is taken to be left by a
+	// crashed process. Writes hold it for far less.
+	staleDBLock = time.Minute
+)
+
+// errDBLocked is returned when another process holds the database lock for
+// longer than dbLockTimeout.
+var errDBLocked = errors.New("database file is locked by another process")
+
+// syncedShares are the share codes of the file as last written or read, to
+// tell codes this process redeemed from codes another process created since.
+// It is guarded by store's lock.
+var syncedShares map[string]bool
+
+// shareCodes returns the codes of shares as a set.
+func shareCodes(shares map[string]*Share) map[string]bool {
+	codes := make(map[string]bool, len(shares))
+	for code := range shares {
+		codes[code] = true
+	}
+	return codes
+}
+
+// lockDBFile takes the lock shard processes hold while writing the database
+// file. It is a file next to the database, created exclusively so that it
+// works on every platform.
+func lockDBFile() (unlock func(), err error) {
+	path := dbFilePath + ".lock"
+	deadline := time.Now().Add(dbLockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleDBLock {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, errDBLocked
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// readDBFile reads the database file, which is empty if it doesn't exist.
+func readDBFile() (*dbFile, error) {
+	file := &dbFile{Version: schemaVersion}
+	data, err := os.ReadFile(dbFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		err, data = nil, nil
+	}
+	if err == nil && data != nil {
+		if data, err = decryptPayload(data); err == nil {
+			err = json.Unmarshal(data, file)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if file.Guilds == nil {
+		file.Guilds = map[string]json.RawMessage{}
+	}
+	return file, nil
+}
+
+// writeSharedDB is writeDB for shard processes: it writes this process's
+// guilds into the file as the other processes left it. The caller must hold
+// writeMutex.
+func writeSharedDB() error {
+	unlock, err := lockDBFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	file, err := readDBFile()
+	if err != nil {
+		return err
+	}
+
+	store.Lock()
+	mergeDBFile(file)
+	data, err := json.MarshalIndent(file, "", "  ")
+	store.Unlock()
+	if err == nil {
+		data, err = encryptPayload(data)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dbFilePath, data); err != nil {
+		return err
+	}
+	lastWrite.Store(time.Now().UnixNano())
+	return nil
+}
+
+// mergeDBFile puts the in-memory guilds this process owns into file and
+// refreshes the others from it. Share codes created or redeemed by either
+// side are kept or dropped, and the directory contributions are taken from
+// the process owning the guild. The caller must hold store's lock.
+func mergeDBFile(file *dbFile) {
+	for id, data := range file.Guilds {
+		sh, ok := store.shards[id]
+		switch {
+		case !ok:
+			store.shards[id] = &guildShard{data: data}
+		case !ownsGuild(id) || sh.data == nil:
+			// Guilds in use are refreshed on the next write.
+			if sh.mu.TryLock() {
+				sh.setData(data)
+				sh.mu.Unlock()
+			}
+		}
+	}
+	for id, sh := range store.shards {
+		if ownsGuild(id) && sh.data != nil {
+			file.Guilds[id] = sh.data
+		}
+	}
+
+	shares := map[string]*Share{}
+	for code, share := range file.Shares {
+		if !syncedShares[code] || store.root.Shares[code] != nil {
+			shares[code] = share
+		}
+	}
+	for code, share := range store.root.Shares {
+		if _, ok := file.Shares[code]; ok || !syncedShares[code] {
+			shares[code] = share
+		}
+	}
+	store.root.Shares, file.Shares = shares, shares
+	syncedShares = shareCodes(shares)
+
+	// Each process's contributions to the directory are those of its guilds.
+	directory := map[string]*DirectoryContribution{}
+	for id, c := range file.Directory {
+		if !ownsGuild(id) {
+			directory[id] = c
+		}
+	}
+	for id, c := range store.root.Directory {
+		if ownsGuild(id) {
+			directory[id] = c
+		}
+	}
+	store.root.Directory, file.Directory = directory, directory
+
+	if len(file.Unclaimed) == 0 || len(store.root.Unclaimed) == 0 {
+		// A guild claimed the legacy list.
+		store.root.Unclaimed, file.Unclaimed = nil, nil
+	}
+	file.Version = store.root.Version
+	file.LogSeq = 0
+}
+
+// syncSharedDB writes the database now and refreshes the guilds and share
+// codes of the other shard processes.
+func syncSharedDB() error {
+	dirty.Store(true)
+	return Flush()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Guild IDs on each of two shards.
+const (
+	shard0Guild      = "8388608"  // 2 << 22
+	shard1Guild      = "4194304"  // 1 << 22
+	shard1OtherGuild = "12582912" // 3 << 22
+)
+
+// runShard makes the test process run one shard of two until the test ends.
+func runShard(t *testing.T, id int) {
+	t.Helper()
+	saved := gatewayShards
+	gatewayShards = shardInfo{IDs: []int{id}, Count: 2}
+	t.Cleanup(func() { gatewayShards = saved })
+}
+
+// addGuildToFile writes a guild into the database file at path the way
+// another shard process would.
+func addGuildToFile(t *testing.T, path, guildID string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err == nil {
+		data, err = decryptPayload(data)
+	}
+	var file dbFile
+	if err == nil {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	file.Guilds[guildID], _ = json.Marshal(GuildData{Restaurants: []Restaurant{{Name: "From " + guildID}}})
+	data, _ = json.Marshal(file)
+	if data, err = encryptPayload(data); err == nil {
+		err = writeFileAtomic(path, data)
+	}
+	if err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+// fileGuilds returns the IDs of the guilds in the database file at path.
+func fileGuilds(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err == nil {
+		data, err = decryptPayload(data)
+	}
+	var file dbFile
+	if err == nil {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	var ids []string
+	for id := range file.Guilds {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// TestInitDBSharedFile starts shard 0 while shard 1 is writing the file,
+// and checks that the startup write waits for it and keeps its guilds.
+func TestInitDBSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	runShard(t, 1)
+	initDB(path)
+	t.Cleanup(closeTestDB)
+	if err := updateGuild(shard1Guild, func(g *GuildData) error {
+		g.Restaurants = append(g.Restaurants, Restaurant{Name: "Alpha"})
+		return nil
+	}); err != nil {
+		t.Fatalf("updateGuild: %v", err)
+	}
+	if err := Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// Shard 0 starts while shard 1 holds the lock to write another guild.
+	runShard(t, 0)
+	lock := path + ".lock"
+	if err := os.WriteFile(lock, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		initDB(path)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("initDB wrote the file while another shard held its lock")
+	case <-time.After(200 * time.Millisecond):
+	}
+	addGuildToFile(t, path, shard1OtherGuild)
+	os.Remove(lock)
+	<-done
+
+	if err := updateGuild(shard0Guild, func(g *GuildData) error {
+		g.Restaurants = append(g.Restaurants, Restaurant{Name: "Bravo"})
+		return nil
+	}); err != nil {
+		t.Fatalf("updateGuild: %v", err)
+	}
+	if err := Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	want := []string{shard1OtherGuild, shard1Guild, shard0Guild}
+	slices.Sort(want)
+	if got := fileGuilds(t, path); !slices.Equal(got, want) {
+		t.Errorf("file holds guilds %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// shareTTL is how long a share code can be redeemed.
+const shareTTL = 24 * time.Hour
+
+var (
+	// ErrShareNotFound is returned when redeeming a code that is unknown, expired or already used.
+	ErrShareNotFound = errors.New("share code not found")
+	// ErrShareSameGuild is returned when redeeming a code in the guild it was made in.
+	ErrShareSameGuild = errors.New("share code is from this guild")
+)
+
+// Share is a snapshot of a guild's list waiting to be imported into another guild.
+type Share struct {
+	GuildID   string    `json:"guild_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Restaurants are the open entries at the time of the export, without IDs,
+	// attribution or any per-member data.
+	Restaurants []Restaurant `json:"restaurants"`
+}
+
+// shareCodeEncoding writes share codes without ambiguous padding.
+var shareCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newShareCode returns an unguessable 80-bit code.
+func newShareCode() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	return shareCodeEncoding.EncodeToString(b)
+}
+
+// shareable copies what describes a restaurant itself, leaving out its
+// history, ratings and who added it. Custom emojis belong to their guild and
+// are dropped.
+func shareable(r Restaurant) Restaurant {
+	s := Restaurant{Name: r.Name, Tags: slices.Clone(r.Tags)}
+	for _, a := range attributeRegistry {
+		if !a.Private {
+			a.set(&s, a.get(&r))
+		}
+	}
+	if isSingleEmoji(r.Emoji) {
+		s.Emoji = r.Emoji
+	}
+	return s
+}
+
+// pruneShares drops the codes that expired.
+func (db *database) pruneShares(now time.Time) {
+	for code, share := range db.Shares {
+		if !now.Before(share.ExpiresAt) {
+			delete(db.Shares, code)
+		}
+	}
+}
+
+// CreateShare stores a snapshot of a guild's open restaurants and returns its
+// code and the number of entries in it.
+func CreateShare(guildID string, now time.Time) (string, int, error) {
+	code := newShareCode()
+	var count int
+	err := updateDB(func(db *database) error {
+		db.pruneShares(now)
+		var snapshot []Restaurant
+		for _, r := range db.guild(guildID).open() {
+			snapshot = append(snapshot, shareable(r))
+		}
+		if len(snapshot) == 0 {
+			return ErrNoRestaurants
+		}
+		if db.Shares == nil {
+			db.Shares = map[string]*Share{}
+		}
+		db.Shares[code] = &Share{GuildID: guildID, ExpiresAt: now.Add(shareTTL), Restaurants: snapshot}
+		count = len(snapshot)
+		return nil
+	})
+	return code, count, err
+}
+
+// RedeemShare imports the snapshot behind a code into a guild and invalidates
+// the code, in a single write.
+func RedeemShare(guildID, code string, by Contributor, now time.Time) (importResult, error) {
+	var result importResult
+	if separateShardProcesses() {
+		// The code may come from a guild another process owns.
+		if err := syncSharedDB(); err != nil {
+			return result, err
+		}
+	}
+	err := updateDB(func(db *database) error {
+		db.pruneShares(now)
+		share, ok := db.Shares[code]
+		if !ok {
+			return ErrShareNotFound
+		}
+		if share.GuildID == guildID {
+			return ErrShareSameGuild
+		}
+		delete(db.Shares, code)
+		result = db.guild(guildID).importEntries(share.Restaurants, by)
+		return nil
+	}, syncSave)
+	return result, err
+}
+
+// handleShare implements `!share export-code` and `!share import CODE`.
+func handleShare(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	fields := strings.Fields(c.Args)
+	switch {
+	case len(fields) == 1 && strings.EqualFold(fields[0], "export-code"):
+		shareExport(c)
+	case len(fields) == 2 && strings.EqualFold(fields[0], "import"):
+		shareImport(c, strings.ToUpper(fields[1]))
+	default:
+		c.Reply("share.usage", nil)
+	}
+}
+
+// shareExport sends a new share code to the author by direct message.
+func shareExport(c *Context) {
+	now := time.Now()
+	code, count, err := CreateShare(c.GuildID, now)
+	if errors.Is(err, ErrNoRestaurants) {
+		c.Reply("share.empty", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to create share code: %v", err)
+		c.Reply("share.failed", nil)
+		return
+	}
+	if c.SendPrivate(c.T("share.code", Args{"count": count, "code": code, "time": fmt.Sprintf("<t:%d:R>", now.Add(shareTTL).Unix())})) {
+		c.Reply("share.code_sent", nil)
+	}
+}
+
+// shareImport redeems a share code into the current guild.
+func shareImport(c *Context, code string) {
+	result, err := RedeemShare(c.GuildID, code, c.Author(), time.Now())
+	switch {
+	case errors.Is(err, ErrShareNotFound):
+		c.Reply("share.not_found", nil)
+		return
+	case errors.Is(err, ErrShareSameGuild):
+		c.Reply("share.same_guild", nil)
+		return
+	case err != nil:
+		log.Printf("Failed to import share code: %v", err)
+		c.Reply("import.failed", nil)
+		return
+	}
+	c.Send(importSummary(c.Config, c.T("import.done", Args{"count": result.Added}), result))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minTrigramSimilarity is the trigram similarity above which two names are
+// considered near-duplicates.
+const minTrigramSimilarity = 0.6
+
+// accentFolder replaces common accented letters with their base letters.
+var accentFolder = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "ß", "ss",
+)
+
+// normalizeName folds a name for comparison: lowercase, without accents,
+// punctuation or repeated spaces.
+func normalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range accentFolder.Replace(strings.ToLower(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// levenshtein returns the edit distance between two strings in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// trigrams returns the set of three-rune substrings of a padded string.
+func trigrams(s string) map[[3]rune]bool {
+	r := []rune("  " + s + " ")
+	set := make(map[[3]rune]bool, len(r))
+	for i := 0; i+3 <= len(r); i++ {
+		set[[3]rune(r[i:i+3])] = true
+	}
+	return set
+}
+
+// trigramSimilarity returns the Jaccard similarity of two strings' trigrams.
+func trigramSimilarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	union := len(ta) + len(tb) - shared
+	if union == 0 {
+		return 1
+	}
+	return float64(shared) / float64(union)
+}
+
+// maxEditDistance is the edit distance tolerated for a normalized name of a given length.
+func maxEditDistance(length int) int {
+	switch {
+	case length <= 4:
+		return 0
+	case length <= 10:
+		return 1
+	}
+	return 2
+}
+
+// nameSimilarity scores how alike two names are, from 0 to 1, and reports
+// whether they are similar enough to be the same restaurant.
+func nameSimilarity(a, b string) (float64, bool) {
+	na, nb := normalizeName(a), normalizeName(b)
+	if na == nb {
+		return 1, true
+	}
+	score := trigramSimilarity(na, nb)
+	shortest := min(len([]rune(na)), len([]rune(nb)))
+	return score, score >= minTrigramSimilarity || levenshtein(na, nb) <= maxEditDistance(shortest)
+}
+
+// similarNames returns the names of the active restaurants similar to name, most similar first.
+func (g *GuildData) similarNames(name string) []string {
+	type match struct {
+		name  string
+		score float64
+	}
+	var matches []match
+	for _, r := range g.active() {
+		// A restaurant is as similar as its closest name or nickname.
+		best, found := 0.0, false
+		for _, n := range r.allNames() {
+			if score, ok := nameSimilarity(name, n); ok && (!found || score > best) {
+				best, found = score, true
+			}
+		}
+		if found {
+			matches = append(matches, match{r.Name, best})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.name
+	}
+	return names
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// discordLocales maps a catalog language to the Discord locales it serves.
+// Locales without a catalog fall back to English.
+var discordLocales = map[string][]discordgo.Locale{
+	"en": {discordgo.EnglishUS, discordgo.EnglishGB},
+	"de": {discordgo.German},
+}
+
+// commandNamePattern matches the names Discord accepts for commands and options.
+var commandNamePattern = regexp.MustCompile(`^[-_\p{L}\p{N}]{1,32}$`)
+
+// slashRegistration is what the bot remembers of the slash commands it
+// registered in one scope, so that it only registers them again when their
+// definitions changed. ID is the first command's.
+type slashRegistration struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"`
+}
+
+// slashRegistrations are the slash commands the bot registered: the embedded
+// global ones and those registered in single guilds, keyed by guild ID.
+type slashRegistrations struct {
+	slashRegistration
+	Guilds map[string]slashRegistration `json:"guilds,omitempty"`
+}
+
+// slashRegistrationsMutex serializes changes to the registration file.
+var slashRegistrationsMutex sync.Mutex
+
+// slashRegistrationPath returns the path of the file the registrations are
+// stored in, the database file's with the extension .commands.json. Shard
+// processes each keep their own, for the guilds they own.
+func slashRegistrationPath() string {
+	base := strings.TrimSuffix(dbFilePath, filepath.Ext(dbFilePath))
+	if separateShardProcesses() {
+		return fmt.Sprintf("%s.commands.shard-%d.json", base, gatewayShards.IDs[0])
+	}
+	return base + ".commands.json"
+}
+
+// loadSlashRegistrations reads the registrations, which are empty when they
+// can't be read. The caller holds slashRegistrationsMutex.
+func loadSlashRegistrations() slashRegistrations {
+	var regs slashRegistrations
+	data, err := os.ReadFile(slashRegistrationPath())
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &regs); err != nil {
+			log.Printf("Failed to read the slash command registration: %v", err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("Failed to read the slash command registration: %v", err)
+	}
+	if regs.Guilds == nil {
+		regs.Guilds = map[string]slashRegistration{}
+	}
+	return regs
+}
+
+// saveSlashRegistrations writes the registrations. The caller holds
+// slashRegistrationsMutex.
+func saveSlashRegistrations(regs slashRegistrations) {
+	data, err := json.Marshal(regs)
+	if err == nil {
+		err = os.WriteFile(slashRegistrationPath(), data, 0o600)
+	}
+	if err != nil {
+		log.Printf("Failed to save the slash command registration: %v", err)
+	}
+}
+
+// slashCommand builds the /lunch command, with its names and descriptions
+// translated from the message catalogs.
+func slashCommand() *discordgo.ApplicationCommand {
+	args := Args{"prefix": commandPrefix}
+	option := func(typ discordgo.ApplicationCommandOptionType, key string, required bool) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:                     typ,
+			Name:                     translator.T(defaultLanguage, key+"_name", nil),
+			NameLocalizations:        commandLocalizations(key+"_name", nil, true),
+			Description:              translator.T(defaultLanguage, key, args),
+			DescriptionLocalizations: commandLocalizations(key, args, false),
+			Required:                 required,
+		}
+	}
+	return &discordgo.ApplicationCommand{
+		Name:                     slashCommandName,
+		NameLocalizations:        ptrTo(commandLocalizations("slash.name", nil, true)),
+		Description:              translator.T(defaultLanguage, "slash.description", args),
+		DescriptionLocalizations: ptrTo(commandLocalizations("slash.description", args, false)),
+		Options: []*discordgo.ApplicationCommandOption{
+			option(discordgo.ApplicationCommandOptionString, "slash.option_command", true),
+			option(discordgo.ApplicationCommandOptionAttachment, "slash.option_file", false),
+		},
+	}
+}
+
+// ptrTo returns a pointer to a copy of v.
+func ptrTo[T any](v T) *T {
+	return &v
+}
+
+// commandLocalizations translates a command's name or description into the
+// Discord locales of every catalog that has the key. Translations Discord
+// would reject are left out, so that they fall back to English instead of
+// failing the registration.
+func commandLocalizations(key string, args Args, name bool) map[discordgo.Locale]string {
+	localized := map[discordgo.Locale]string{}
+	for _, lang := range translator.Languages() {
+		if lang == defaultLanguage {
+			continue
+		}
+		text, ok := translator.translated(lang, key, args)
+		if !ok {
+			continue
+		}
+		if name && (!commandNamePattern.MatchString(text) || strings.ToLower(text) != text) ||
+			!name && (text == "" || utf8.RuneCountInString(text) > 100) {
+			log.Printf("Ignoring invalid %s translation of %q: %q", lang, key, text)
+			continue
+		}
+		for _, locale := range discordLocales[lang] {
+			localized[locale] = text
+		}
+	}
+	return localized
+}
+
+// commandHash fingerprints a set of command definitions.
+func commandHash(cmds []*discordgo.ApplicationCommand) string {
+	data, err := json.Marshal(cmds)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// registerSlashCommands registers the slash commands globally unless those
+// registered before have the same definitions and still exist.
+func registerSlashCommands(s *discordgo.Session) {
+	cmds := slashCommands()
+	hash := commandHash(cmds)
+
+	slashRegistrationsMutex.Lock()
+	defer slashRegistrationsMutex.Unlock()
+	regs := loadSlashRegistrations()
+	if regs.Hash == hash {
+		if _, err := s.ApplicationCommand(s.State.User.ID, "", regs.ID); err == nil {
+			return
+		}
+	}
+
+	created, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, "", cmds)
+	if err != nil || len(created) == 0 {
+		log.Printf("Failed to register the slash commands: %v", err)
+		return
+	}
+	regs.slashRegistration = slashRegistration{ID: created[0].ID, Hash: hash}
+	saveSlashRegistrations(regs)
+}
+
+// localeLanguage returns the catalog language for a Discord locale, or ""
+// when there is none.
+func localeLanguage(locale discordgo.Locale) string {
+	lang, _, _ := strings.Cut(string(locale), "-")
+	if translator.HasLanguage(lang) {
+		return lang
+	}
+	return ""
+}
+
+// forLocale returns the config with replies in the user's locale, unless the
+// guild chose a language.
+func (cfg GuildConfig) forLocale(locale discordgo.Locale) GuildConfig {
+	cfg.userLanguage = localeLanguage(locale)
+	return cfg
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrNothingScheduled is returned when snoozing a day with no scheduled runs left.
+var ErrNothingScheduled = errors.New("nothing scheduled today")
+
+// localDate formats the day of t in loc as YYYY-MM-DD.
+func localDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// snoozed reports whether the guild's schedules are snoozed on the day of now.
+func (g *GuildData) snoozed(now time.Time) bool {
+	return g.SnoozedOn != "" && g.SnoozedOn == localDate(now, g.Config.location())
+}
+
+// runsLaterToday reports whether any schedule still runs today after now.
+func (g *GuildData) runsLaterToday(now time.Time) bool {
+	loc := g.Config.location()
+	next, ok := g.nextLunch(now)
+	return ok && localDate(next, loc) == localDate(now, loc)
+}
+
+// Snooze suppresses the guild's remaining scheduled suggestions and polls of
+// today, or lifts the snooze when on is false.
+func Snooze(guildID string, on bool, now time.Time) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		if !on {
+			g.SnoozedOn = ""
+			return nil
+		}
+		if !g.runsLaterToday(now) {
+			return ErrNothingScheduled
+		}
+		g.SnoozedOn = localDate(now, g.Config.location())
+		return nil
+	})
+}
+
+// handleSnooze implements `!snooze` and `!snooze off`.
+func handleSnooze(c *Context) {
+	on := true
+	switch strings.ToLower(c.Args) {
+	case "":
+	case "off":
+		on = false
+	default:
+		c.Reply("snooze.usage", nil)
+		return
+	}
+	err := Snooze(c.GuildID, on, time.Now())
+	switch {
+	case errors.Is(err, ErrNothingScheduled):
+		c.Reply("snooze.nothing", nil)
+	case err != nil:
+		log.Printf("Failed to snooze schedules: %v", err)
+		c.Reply("snooze.failed", nil)
+	case on:
+		c.Reply("snooze.done", nil)
+	default:
+		c.Reply("snooze.off", nil)
+	}
+}
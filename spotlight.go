@@ -0,0 +1,280 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Spotlight modes.
+const (
+	spotlightModePin   = "pin"
+	spotlightModeTopic = "topic"
+)
+
+// Spotlight is the current "Restaurant of the week".
+type Spotlight struct {
+	Name      string    `json:"name"`
+	ChannelID string    `json:"channel_id"`
+	MessageID string    `json:"message_id"`
+	At        time.Time `json:"at"`
+	// Mode is how the spotlight was applied: pin, topic, or empty for a plain announcement.
+	Mode string `json:"mode,omitempty"`
+	// PreviousTopic is the channel topic to restore when a topic spotlight is replaced.
+	PreviousTopic string `json:"previous_topic,omitempty"`
+}
+
+// pickSpotlight chooses the restaurant that has gone unvisited the longest,
+// skipping the current spotlight when there is an alternative.
+func pickSpotlight(g *GuildData) (Restaurant, bool) {
+	candidates := leastRecentlyVisited(g.open())
+	if len(candidates) == 0 {
+		return Restaurant{}, false
+	}
+	if g.Spotlight != nil && len(candidates) > 1 {
+		for _, r := range candidates {
+			if !strings.EqualFold(r.Name, g.Spotlight.Name) {
+				return r, true
+			}
+		}
+	}
+	return candidates[0], true
+}
+
+// RunSpotlight announces a new restaurant of the week in channelID, replacing the previous one.
+// It returns the chosen restaurant and any warnings about permissions that forced a fallback.
+func RunSpotlight(s *discordgo.Session, guildID, channelID string) (string, []string, error) {
+	var choice Restaurant
+	var found bool
+	var cfg GuildConfig
+	var previous *Spotlight
+	err := viewGuild(guildID, func(g *GuildData) error {
+		choice, found = pickSpotlight(g)
+		cfg = g.Config
+		previous = g.Spotlight
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if !found {
+		return "", nil, ErrNoRestaurants
+	}
+
+	var warnings []string
+	next := &Spotlight{Name: choice.Name, ChannelID: channelID, At: time.Now().UTC()}
+
+	// A topic spotlight replacing another one in the same channel keeps the
+	// original topic so that it can eventually be restored.
+	keepTopic := previous != nil && previous.Mode == spotlightModeTopic &&
+		cfg.SpotlightMode == spotlightModeTopic && previous.ChannelID == channelID
+	if previous != nil && !keepTopic {
+		if w := revertSpotlight(s, previous); w != "" {
+			warnings = append(warnings, cfg.T(w, nil))
+		}
+	}
+
+	msg, err := s.ChannelMessageSend(channelID, spotlightAnnouncement(cfg, choice))
+	if err != nil {
+		return "", warnings, err
+	}
+	next.MessageID = msg.ID
+
+	switch cfg.SpotlightMode {
+	case spotlightModeTopic:
+		topic := ""
+		if keepTopic {
+			topic = previous.PreviousTopic
+		} else if ch, err := s.Channel(channelID); err == nil {
+			topic = ch.Topic
+		}
+		if err := setChannelTopic(s, channelID, cfg.T("spotlight.topic", Args{"name": choice.Name})); err != nil {
+			log.Printf("Failed to set spotlight topic in %s: %v", channelID, err)
+			warnings = append(warnings, cfg.T("spotlight.warn_topic", nil))
+		} else {
+			next.Mode = spotlightModeTopic
+			next.PreviousTopic = topic
+		}
+	default:
+		if err := s.ChannelMessagePin(channelID, msg.ID); err != nil {
+			log.Printf("Failed to pin spotlight in %s: %v", channelID, err)
+			warnings = append(warnings, cfg.T("spotlight.warn_pin", nil))
+		} else {
+			next.Mode = spotlightModePin
+		}
+	}
+
+	err = updateGuild(guildID, func(g *GuildData) error {
+		g.Spotlight = next
+		return nil
+	})
+	return choice.Name, warnings, err
+}
+
+// revertSpotlight undoes the pin or topic change of a previous spotlight.
+// It returns the catalog key of a warning when that was not possible.
+func revertSpotlight(s *discordgo.Session, previous *Spotlight) string {
+	switch previous.Mode {
+	case spotlightModePin:
+		if err := s.ChannelMessageUnpin(previous.ChannelID, previous.MessageID); err != nil {
+			log.Printf("Failed to unpin previous spotlight %s: %v", previous.MessageID, err)
+			return "spotlight.warn_unpin"
+		}
+	case spotlightModeTopic:
+		if err := setChannelTopic(s, previous.ChannelID, previous.PreviousTopic); err != nil {
+			log.Printf("Failed to restore topic in %s: %v", previous.ChannelID, err)
+			return "spotlight.warn_restore_topic"
+		}
+	}
+	return ""
+}
+
+// setChannelTopic sets a channel's topic. Unlike ChannelEdit it can also clear the topic.
+func setChannelTopic(s *discordgo.Session, channelID, topic string) error {
+	endpoint := discordgo.EndpointChannel(channelID)
+	_, err := s.RequestWithBucketID("PATCH", endpoint, map[string]string{"topic": topic}, endpoint)
+	return err
+}
+
+// spotlightAnnouncement formats the weekly announcement for a restaurant.
+func spotlightAnnouncement(cfg GuildConfig, r Restaurant) string {
+	if v := r.LastVisit(); !v.IsZero() {
+		return cfg.T("spotlight.announce_visited", Args{"name": r.Name, "date": v.Format("2006-01-02")})
+	}
+	return cfg.T("spotlight.announce_new", Args{"name": r.Name})
+}
+
+// handleSpotlight implements `!spotlight`, `!spotlight show`, `!spotlight mode pin|topic`
+// and `!spotlight weekly on|off`.
+func handleSpotlight(c *Context) {
+	fields := strings.Fields(c.Args)
+	if len(fields) == 0 {
+		name, warnings, err := RunSpotlight(c.Session, c.GuildID, c.Message.ChannelID)
+		if err == ErrNoRestaurants {
+			c.Reply("list.empty", nil)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to run spotlight: %v", err)
+			c.Reply("spotlight.failed", nil)
+			return
+		}
+		log.Printf("Spotlight in guild %s is now %q", c.GuildID, name)
+		for _, w := range warnings {
+			c.Send("⚠️ " + w)
+		}
+		return
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "show":
+		var current *Spotlight
+		if err := viewGuild(c.GuildID, func(g *GuildData) error {
+			current = g.Spotlight
+			return nil
+		}); err != nil {
+			log.Printf("Failed to load spotlight: %v", err)
+			c.Reply("spotlight.load_failed", nil)
+			return
+		}
+		if current == nil {
+			c.Reply("spotlight.none", nil)
+			return
+		}
+		c.Reply("spotlight.show", Args{"name": current.Name, "date": current.At.Format("2006-01-02"), "channel": "<#" + current.ChannelID + ">"})
+
+	case "mode":
+		if !c.RequireAdmin() {
+			return
+		}
+		if len(fields) != 2 || (fields[1] != spotlightModePin && fields[1] != spotlightModeTopic) {
+			c.Reply("spotlight.mode_usage", nil)
+			return
+		}
+		if err := updateGuild(c.GuildID, func(g *GuildData) error {
+			g.Config.SpotlightMode = fields[1]
+			return nil
+		}); err != nil {
+			log.Printf("Failed to save spotlight mode: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		c.Reply("spotlight.mode_set", Args{"mode": fields[1]})
+
+	case "weekly":
+		if !c.RequireAdmin() {
+			return
+		}
+		if len(fields) != 2 || (fields[1] != "on" && fields[1] != "off") {
+			c.Reply("spotlight.weekly_usage", nil)
+			return
+		}
+		channelID := ""
+		if fields[1] == "on" {
+			channelID = c.Message.ChannelID
+		}
+		if err := updateGuild(c.GuildID, func(g *GuildData) error {
+			g.Config.SpotlightChannelID = channelID
+			return nil
+		}); err != nil {
+			log.Printf("Failed to save spotlight schedule: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		if channelID == "" {
+			c.Reply("spotlight.weekly_off", nil)
+		} else {
+			c.Reply("spotlight.weekly_on", nil)
+		}
+
+	default:
+		c.Reply("spotlight.usage", nil)
+	}
+}
+
+// spotlightWeekStart returns the most recent Monday 09:00 UTC at or before t.
+func spotlightWeekStart(t time.Time) time.Time {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 9, 0, 0, 0, time.UTC)
+	offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+	start = start.AddDate(0, 0, -offset)
+	if start.After(t) {
+		start = start.AddDate(0, 0, -7)
+	}
+	return start
+}
+
+// runWeeklySpotlights announces a new spotlight for every guild whose weekly
+// spotlight hasn't run since the start of the current week, once its quiet
+// hours are over.
+func runWeeklySpotlights(s *discordgo.Session, now time.Time) {
+	due := map[string]string{}
+	weekStart := spotlightWeekStart(now)
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if g.Config.SpotlightChannelID == "" || g.count() == 0 || g.Config.quietAt(now) {
+			return
+		}
+		if g.Spotlight != nil && !g.Spotlight.At.Before(weekStart) {
+			return
+		}
+		due[guildID] = g.Config.SpotlightChannelID
+	})
+	if err != nil {
+		log.Printf("Failed to check weekly spotlights: %v", err)
+		return
+	}
+
+	for guildID, channelID := range due {
+		name, warnings, err := RunSpotlight(s, guildID, channelID)
+		if err != nil {
+			log.Printf("Weekly spotlight failed for guild %s: %v", guildID, err)
+			continue
+		}
+		log.Printf("Weekly spotlight in guild %s is now %q", guildID, name)
+		for _, w := range warnings {
+			s.ChannelMessageSend(channelID, "⚠️ "+w)
+		}
+	}
+}
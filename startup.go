@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// errDiscordUnreachable marks a token check that couldn't reach Discord.
+var errDiscordUnreachable = errors.New("couldn't reach Discord")
+
+// checkStartup validates the configuration before the bot connects, loading
+// the encryption keys, and returns every problem found with what to do
+// about it.
+func checkStartup(token, dbPath string) []string {
+	var problems []string
+	tokenOK := true
+	if err := checkTokenFormat(token); err != nil {
+		problems = append(problems, err.Error())
+		tokenOK = false
+	}
+	if err := checkDBPath(dbPath); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := loadEncryptionKeys(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if tz := os.Getenv("TZ"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			problems = append(problems, fmt.Sprintf("TZ %q is not a known timezone. Use an IANA name like Europe/Berlin, or unset it for UTC.", tz))
+		}
+	}
+	for _, name := range []string{"OWNER_ID", "ERROR_CHANNEL_ID", "DEV_GUILD_ID"} {
+		if err := checkDiscordID(name, os.Getenv(name)); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if _, err := parseLogLevel(os.Getenv("LOG_LEVEL")); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := checkCommandScope(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := checkShardConfig(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	// Only talk to Discord when the token could be valid at all. Network
+	// problems are left to the connection retries.
+	if tokenOK {
+		err := checkToken(token)
+		switch {
+		case errors.Is(err, errDiscordUnreachable):
+			log.Printf("Warning: %v", err)
+		case err != nil:
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// checkDiscordID checks that the variable name, if set, holds a Discord ID.
+func checkDiscordID(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+		return fmt.Errorf("%s %q is not a Discord ID. Copy it with Developer Mode enabled, it is a number like 123456789012345678.", name, value)
+	}
+	return nil
+}
+
+// checkTokenFormat checks that token looks like a bot token: three
+// dot-separated parts, the first being the bot's user ID in base64.
+func checkTokenFormat(token string) error {
+	if token == "" {
+		return errors.New("DISCORD_TOKEN is not set. Copy the token from Bot > Reset Token in the developer portal.")
+	}
+	if strings.HasPrefix(token, "Bot ") {
+		return errors.New("DISCORD_TOKEN starts with \"Bot \". Set it to the token alone, the prefix is added automatically.")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return errors.New("DISCORD_TOKEN doesn't look like a bot token, which has three parts separated by dots. Make sure it is the bot token and not the client secret or application ID.")
+	}
+	id, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		id, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	}
+	if _, perr := strconv.ParseUint(string(id), 10, 64); err != nil || perr != nil {
+		return errors.New("DISCORD_TOKEN doesn't look like a bot token: its first part should encode the bot's user ID. Copy the token again from the developer portal.")
+	}
+	return nil
+}
+
+// checkToken asks Discord who the token belongs to, telling a rejected
+// token apart from a network problem.
+func checkToken(token string) error {
+	s, err := discordgo.New("Bot " + token)
+	if err != nil {
+		return fmt.Errorf("failed to create a Discord session: %v", err)
+	}
+	s.Client = &http.Client{Timeout: 10 * time.Second}
+	s.MaxRestRetries = 0
+	_, err = s.User("@me")
+	var restErr *discordgo.RESTError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusUnauthorized:
+		return errors.New("Discord rejected DISCORD_TOKEN as invalid. It may have been reset; copy a new one from Bot > Reset Token in the developer portal.")
+	case errors.As(err, &restErr):
+		return fmt.Errorf("Discord answered the token check with %s. Check https://discordstatus.com and try again.", restErr.Response.Status)
+	default:
+		return fmt.Errorf("%w to check the token: %v. Check the network connection, DNS and any proxy settings.", errDiscordUnreachable, err)
+	}
+}
+
+// checkDBPath checks that the database file can be written, by creating and
+// removing a probe file next to it.
+func checkDBPath(path string) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("the directory %s of DB_PATH doesn't exist. Create it or point DB_PATH elsewhere.", dir)
+	case err != nil:
+		return fmt.Errorf("can't access the directory %s of DB_PATH: %v", dir, err)
+	case !info.IsDir():
+		return fmt.Errorf("%s, the directory of DB_PATH, is not a directory.", dir)
+	}
+	probe, err := os.CreateTemp(dir, ".write-probe-*")
+	if err != nil {
+		return fmt.Errorf("the directory %s of DB_PATH is not writable by this user: %v. Fix its permissions or point DB_PATH elsewhere.", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("DB_PATH %s is a directory. Point it at a file, e.g. %s.", path, filepath.Join(path, "restaurants.json"))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("the database file %s is not writable by this user: %v. Fix its permissions.", path, err)
+		}
+		f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// guildStats are the numbers shown by !stats.
+type guildStats struct {
+	Restaurants int `json:"restaurants"`
+	Archived    int `json:"archived"`
+	Visits      int `json:"visits"`
+}
+
+// stats counts the open and archived restaurants accepted by keep and their visits.
+func (g *GuildData) stats(keep func(r *Restaurant) bool) guildStats {
+	var s guildStats
+	for _, r := range g.active() {
+		if !keep(&r) {
+			continue
+		}
+		s.Visits += len(r.Visits)
+		if r.IsArchived() {
+			s.Archived++
+		} else {
+			s.Restaurants++
+		}
+	}
+	return s
+}
+
+// handleStats implements `!stats`.
+func handleStats(c *Context) {
+	var stats guildStats
+	var backup *BackupRecord
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		stats = g.stats(func(*Restaurant) bool { return true })
+		backup = g.LastBackup
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load stats: %v", err)
+		c.Reply("stats.failed", nil)
+		return
+	}
+
+	lines := []string{
+		c.T("stats.header", nil),
+		c.T("stats.restaurants", Args{"count": stats.Restaurants}),
+	}
+	if stats.Archived > 0 {
+		lines = append(lines, c.T("stats.archived", Args{"count": stats.Archived}))
+	}
+	lines = append(lines, c.T("stats.visits", Args{"count": stats.Visits}))
+	if backup == nil || backup.MessageID == "" {
+		lines = append(lines, c.T("stats.backup_never", nil))
+	} else {
+		lines = append(lines, c.T("stats.backup", Args{"date": backup.At.Format("2006-01-02 15:04 MST"), "channel": "<#" + backup.ChannelID + ">"}))
+	}
+	if backup != nil && !backup.FailedAt.IsZero() {
+		lines = append(lines, c.T("stats.backup_failing", Args{"date": backup.FailedAt.Format("2006-01-02 15:04 MST")}))
+	}
+	lines = append(lines, c.T("stats.range_hint", nil))
+	c.Send(strings.Join(lines, "\n"))
+}
+
+const (
+	// statsCommandName is the name of the slash command showing stats for a time range.
+	statsCommandName = "stats"
+	// statsTopRestaurants is how many of the most visited restaurants /stats lists.
+	statsTopRestaurants = 5
+	// maxPollHistory bounds the closed polls kept for /stats.
+	maxPollHistory = 1000
+	// statsColor is the accent color of the /stats embed.
+	statsColor = 0x2a9d8f
+)
+
+// Ranges of /stats, besides custom dates.
+const (
+	statsWeek      = "week"
+	statsMonth     = "month"
+	statsLastMonth = "last-month"
+	statsQuarter   = "quarter"
+	statsAllTime   = "all"
+)
+
+// statsRanges are the choices of the range option of /stats, in menu order.
+var statsRanges = []string{statsWeek, statsMonth, statsLastMonth, statsQuarter, statsAllTime}
+
+// PollRecord is the participation in a closed poll.
+type PollRecord struct {
+	ClosedAt time.Time `json:"closed_at"`
+	// Voters is the number of members who voted, the number of votes for
+	// polls counted from reactions without a quorum.
+	Voters int `json:"voters"`
+}
+
+// pollParticipants returns how many took part in a closed poll, given its
+// votes and the distinct voters pollVotes counted, if it counted them.
+func pollParticipants(p Poll, votes []int, voters int) int {
+	if p.Anonymous || p.Quorum > 0 {
+		return voters
+	}
+	n := 0
+	for _, v := range votes {
+		n += v
+	}
+	return n
+}
+
+// recordPoll keeps the participation in a closed poll, dropping the oldest
+// records beyond maxPollHistory.
+func (g *GuildData) recordPoll(r PollRecord) {
+	g.PollHistory = append(g.PollHistory, r)
+	if extra := len(g.PollHistory) - maxPollHistory; extra > 0 {
+		g.PollHistory = g.PollHistory[extra:]
+	}
+}
+
+// periodStats are the numbers /stats shows for a time range.
+type periodStats struct {
+	Visits int
+	// Places is the number of distinct restaurants visited.
+	Places int
+	Added  int
+	Polls  int
+	// Voters is the total participation in the polls.
+	Voters int
+	Top    []visitCount
+}
+
+// visitCount is a restaurant with the number of its visits in a period.
+type visitCount struct {
+	Name   string
+	Visits int
+}
+
+// rangeStats aggregates the visits, additions and polls from start up to,
+// not including, end. A zero start or end leaves that side of the range open.
+func rangeStats(restaurants []Restaurant, polls []PollRecord, start, end time.Time) periodStats {
+	inRange := func(t time.Time) bool {
+		return (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
+	}
+	var out periodStats
+	for _, r := range restaurants {
+		if inRange(r.AddedAt) {
+			out.Added++
+		}
+		visits := 0
+		for _, v := range r.Visits {
+			if inRange(v.Date) {
+				visits++
+			}
+		}
+		if visits == 0 {
+			continue
+		}
+		out.Visits += visits
+		out.Places++
+		out.Top = append(out.Top, visitCount{r.Name, visits})
+	}
+	sort.SliceStable(out.Top, func(i, j int) bool {
+		if out.Top[i].Visits != out.Top[j].Visits {
+			return out.Top[i].Visits > out.Top[j].Visits
+		}
+		return lessFold(out.Top[i].Name, out.Top[j].Name)
+	})
+	out.Top = out.Top[:min(len(out.Top), statsTopRestaurants)]
+	for _, p := range polls {
+		if inRange(p.ClosedAt) {
+			out.Polls++
+			out.Voters += p.Voters
+		}
+	}
+	return out
+}
+
+// statsBounds returns the start and the exclusive end of a named range
+// around now, in now's location. All time has neither.
+func statsBounds(name string, now time.Time) (time.Time, time.Time) {
+	switch name {
+	case statsWeek:
+		start := weekStart(now)
+		return start, start.AddDate(0, 0, 7)
+	case statsMonth:
+		return monthRange(now)
+	case statsLastMonth:
+		start, _ := monthRange(now)
+		return monthRange(start.AddDate(0, -1, 0))
+	case statsQuarter:
+		start := time.Date(now.Year(), now.Month()-(now.Month()-1)%3, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 3, 0)
+	}
+	return time.Time{}, time.Time{}
+}
+
+// statsCommand builds the /stats command, with its names and descriptions
+// translated from the message catalogs.
+func statsCommand() *discordgo.ApplicationCommand {
+	option := func(key string) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:                     discordgo.ApplicationCommandOptionString,
+			Name:                     translator.T(defaultLanguage, key+"_name", nil),
+			NameLocalizations:        commandLocalizations(key+"_name", nil, true),
+			Description:              translator.T(defaultLanguage, key, nil),
+			DescriptionLocalizations: commandLocalizations(key, nil, false),
+		}
+	}
+	ranges := option("slash.stats_option_range")
+	for _, r := range statsRanges {
+		key := "stats.range_" + strings.ReplaceAll(r, "-", "_")
+		ranges.Choices = append(ranges.Choices, &discordgo.ApplicationCommandOptionChoice{
+			Name: translator.T(defaultLanguage, key, nil), NameLocalizations: commandLocalizations(key, nil, false), Value: r,
+		})
+	}
+	return &discordgo.ApplicationCommand{
+		Name:                     statsCommandName,
+		NameLocalizations:        ptrTo(commandLocalizations("slash.stats_name", nil, true)),
+		Description:              translator.T(defaultLanguage, "slash.stats_description", nil),
+		DescriptionLocalizations: ptrTo(commandLocalizations("slash.stats_description", nil, false)),
+		Options:                  []*discordgo.ApplicationCommandOption{ranges, option("slash.stats_option_start"), option("slash.stats_option_end")},
+	}
+}
+
+// handleStatsComponent answers /stats, routed here as custom ID stats:command.
+func handleStatsComponent(i *Interaction) {
+	if len(i.Args) == 1 && i.Args[0] == "command" {
+		handleStatsCommand(i)
+	}
+}
+
+// handleStatsCommand implements `/stats [range] [start] [end]`, the numbers
+// of a time range in the guild's timezone. Custom ranges run from the start
+// date through the end date; either may be left out.
+func handleStatsCommand(i *Interaction) {
+	var name, from, to string
+	for _, o := range i.Event.ApplicationCommandData().Options {
+		switch o.Name {
+		case "range":
+			name = o.StringValue()
+		case "start":
+			from = strings.TrimSpace(o.StringValue())
+		case "end":
+			to = strings.TrimSpace(o.StringValue())
+		}
+	}
+	loc := i.Config.location()
+	now := time.Now().In(loc)
+	var start, end time.Time
+	var label string
+	switch {
+	case from != "" || to != "":
+		if name != "" {
+			i.Ephemeral("stats.range_conflict", nil)
+			return
+		}
+		var err error
+		if from != "" {
+			if start, err = time.ParseInLocation("2006-01-02", from, loc); err != nil {
+				i.Ephemeral("stats.invalid_date", Args{"value": from})
+				return
+			}
+		}
+		if to != "" {
+			last, err := time.ParseInLocation("2006-01-02", to, loc)
+			if err != nil {
+				i.Ephemeral("stats.invalid_date", Args{"value": to})
+				return
+			}
+			end = last.AddDate(0, 0, 1)
+		}
+		if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+			i.Ephemeral("stats.start_after_end", Args{"start": from, "end": to})
+			return
+		}
+		label = i.T("stats.range_custom", Args{"start": cmp.Or(from, "…"), "end": cmp.Or(to, "…")})
+	default:
+		name = cmp.Or(name, statsAllTime)
+		if !slices.Contains(statsRanges, name) {
+			return
+		}
+		start, end = statsBounds(name, now)
+		label = i.T("stats.range_"+strings.ReplaceAll(name, "-", "_"), nil)
+		if !start.IsZero() {
+			label += fmt.Sprintf(" (%s – %s)", start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))
+		}
+	}
+
+	var stats periodStats
+	if err := viewGuild(i.GuildID, func(g *GuildData) error {
+		stats = rangeStats(g.active(), g.PollHistory, start, end)
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load stats: %v", err)
+		i.Ephemeral("stats.failed", nil)
+		return
+	}
+	err := i.Session.InteractionRespond(i.Event.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:          []*discordgo.MessageEmbed{statsEmbed(i.Config, label, stats)},
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to respond to interaction: %v", err)
+	}
+}
+
+// statsEmbed renders the stats of a time range.
+func statsEmbed(cfg GuildConfig, label string, s periodStats) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{Title: cfg.T("stats.range_title", Args{"range": label}), Color: statsColor}
+	if s.Visits == 0 && s.Added == 0 && s.Polls == 0 {
+		embed.Description = cfg.T("stats.range_empty", nil)
+		return embed
+	}
+	field := func(key, value string) {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: cfg.T(key, nil), Value: value, Inline: true})
+	}
+	field("stats.field_visits", cfg.T("stats.visits_places", Args{"count": s.Visits, "places": s.Places}))
+	field("stats.field_added", fmt.Sprint(s.Added))
+	polls := cfg.T("stats.polls", Args{"count": s.Polls})
+	if s.Polls > 0 {
+		polls += "\n" + cfg.T("stats.poll_voters", Args{"count": s.Voters, "average": fmt.Sprintf("%.1f", float64(s.Voters)/float64(s.Polls))})
+	}
+	field("stats.field_polls", polls)
+	if len(s.Top) > 0 {
+		var lines []string
+		for n, t := range s.Top {
+			lines = append(lines, cfg.T("stats.top_line", Args{"rank": n + 1, "name": t.Name, "count": t.Visits}))
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: cfg.T("stats.field_top", nil), Value: strings.Join(lines, "\n")})
+	}
+	return embed
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The database is held in memory and written to dbFilePath in the
+// background, at most once every persistInterval, so that bursts of changes
+// cost one write. A crash loses at most the changes of the last
+// persistInterval, unless the operation log is on; updates passing syncSave
+// wait for the write instead. Each
+// guild is locked on its own, so that operations in one guild don't wait for
+// another guild's, and reads share their guild's lock.
+//
+// Guilds are kept JSON encoded, and every operation gets its own copy of the
+// decoded data. Callers may therefore keep and modify what they read, and
+// changes made by a failing update are discarded, as when each operation
+// read the file. The decoded data is kept until the guild changes, as
+// copying it is much cheaper than decoding it for every command.
+
+// guildShard holds one guild's data.
+type guildShard struct {
+	// mu is held for reading by views of the guild and for writing by updates.
+	mu sync.RWMutex
+	// data is the encoded GuildData, or nil for guilds without stored data.
+	// It is only replaced while holding both mu and store's lock.
+	data []byte
+	// decoded is data decoded, nil until a view or update needs it. It is
+	// never modified, only copied, and cleared whenever data is replaced.
+	decoded atomic.Pointer[GuildData]
+}
+
+// store is the in-memory database.
+var store = struct {
+	// dbMu is held for reading by single-guild operations and for writing by
+	// updateDB, which spans guilds.
+	dbMu sync.RWMutex
+
+	// Mutex guards the fields below and guildShard.data.
+	sync.Mutex
+	shards map[string]*guildShard
+	// root holds the database apart from its guilds.
+	root database
+}{shards: map[string]*guildShard{}}
+
+// persistInterval is how often changes are written to the file.
+const persistInterval = 2 * time.Second
+
+// saveOption changes how an update is saved.
+type saveOption int
+
+// syncSave makes an update write the file before returning, for operations
+// whose success must not be lost if the bot crashes right after reporting it.
+const syncSave saveOption = 1
+
+var (
+	// writeMutex serializes writes of the database file.
+	writeMutex sync.Mutex
+	// dirty is set when the in-memory database has unsaved changes.
+	dirty atomic.Bool
+	// persistStarted starts the background writes once.
+	persistStarted sync.Once
+)
+
+// initDB loads the JSON database file, creating it if necessary, and saves it
+// in the current format.
+func initDB(filepath string) {
+	dbFilePath = filepath
+	db := &database{Version: schemaVersion, Guilds: map[string]*GuildData{}}
+	if _, err := os.Stat(dbFilePath); os.IsNotExist(err) {
+		log.Println("Creating database file:", dbFilePath)
+	} else {
+		data, err := os.ReadFile(dbFilePath)
+		if err == nil {
+			data, err = decryptPayload(data)
+		}
+		if err != nil {
+			log.Fatalf("Failed to read database file: %v", err)
+		}
+		if db, err = decodeDB(data); err != nil {
+			log.Fatalf("Failed to read database file: %v", err)
+		}
+	}
+	recoverOpLog(db)
+	if err := loadDB(db); err != nil {
+		log.Fatalf("Failed to write database file: %v", err)
+	}
+	openOpLog()
+	persistStarted.Do(func() { go persistLoop() })
+	log.Println("Database file is ready.")
+}
+
+// persistLoop writes unsaved changes every persistInterval. Failed writes are
+// retried on the next run, or by runReadOnlyProbe in read-only mode.
+func persistLoop() {
+	for range time.Tick(persistInterval) {
+		if currentReadOnly() != nil {
+			continue
+		}
+		if err := Flush(); err != nil {
+			log.Printf("Failed to save database: %v", err)
+		}
+	}
+}
+
+// Flush writes the database to the file now if it has unsaved changes. It
+// must be called before the bot exits.
+func Flush() error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	if !dirty.Swap(false) {
+		return nil
+	}
+	err := writeDB()
+	recordWrite(err)
+	if err != nil {
+		dirty.Store(true)
+		return err
+	}
+	return nil
+}
+
+// markDirty records an unsaved change, writing it at once for syncSave.
+func markDirty(opts []saveOption) error {
+	dirty.Store(true)
+	if slices.Contains(opts, syncSave) {
+		return Flush()
+	}
+	return nil
+}
+
+// loadDB replaces the in-memory database with db and saves it.
+func loadDB(db *database) error {
+	shards := map[string]*guildShard{}
+	for id, g := range db.Guilds {
+		data, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		shards[id] = &guildShard{data: data}
+	}
+	store.Lock()
+	store.shards = shards
+	store.root = database{Version: db.Version, Unclaimed: db.Unclaimed, Shares: db.Shares, Directory: db.Directory}
+	syncedShares = shareCodes(db.Shares)
+	store.Unlock()
+	return markDirty([]saveOption{syncSave})
+}
+
+// writeDB writes the in-memory database to the file, truncating the
+// operation log if it has grown past maxOpLogSize. The caller must hold
+// writeMutex.
+func writeDB() error {
+	if separateShardProcesses() {
+		return writeSharedDB()
+	}
+	opLog.Lock()
+	data, err := encodeDB()
+	compact := opLog.file != nil && opLog.size >= maxOpLogSize
+	if compact {
+		// Appends wait so that the log only loses what the file holds.
+		defer opLog.Unlock()
+	} else {
+		opLog.Unlock()
+	}
+	if err == nil {
+		data, err = encryptPayload(data)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dbFilePath, data); err != nil {
+		return err
+	}
+	lastWrite.Store(time.Now().UnixNano())
+	if compact {
+		if err := truncateOpLog(); err != nil {
+			log.Printf("Failed to truncate the operation log: %v", err)
+		}
+	}
+	return nil
+}
+
+// dbFile is the layout of the database file, with the guilds left encoded.
+type dbFile struct {
+	Version   int                               `json:"version"`
+	Guilds    map[string]json.RawMessage        `json:"guilds"`
+	Unclaimed []Restaurant                      `json:"unclaimed,omitempty"`
+	Shares    map[string]*Share                 `json:"shares,omitempty"`
+	Directory map[string]*DirectoryContribution `json:"directory,omitempty"`
+	LogSeq    int64                             `json:"log_seq,omitempty"`
+}
+
+// dbBuffer holds the file's contents encoded by encodeDB. It is reused
+// between writes, like dbEncoder's own buffers, and guarded by writeMutex.
+var (
+	dbBuffer  bytes.Buffer
+	dbEncoder = newDBEncoder(&dbBuffer)
+)
+
+// newDBEncoder returns an encoder indenting the database file.
+func newDBEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc
+}
+
+// encodeDB encodes the in-memory database as the file's contents, valid
+// until the next call. The caller must hold writeMutex and opLog. The
+// encoded guilds are never modified, only replaced, so the encoding doesn't
+// keep other operations waiting.
+func encodeDB() ([]byte, error) {
+	store.Lock()
+	guilds := make(map[string]json.RawMessage, len(store.shards))
+	for id, sh := range store.shards {
+		if sh.data != nil {
+			guilds[id] = sh.data
+		}
+	}
+	file := dbFile{store.root.Version, guilds, store.root.Unclaimed, store.root.Shares, store.root.Directory, opLog.seq}
+	store.Unlock()
+
+	dbBuffer.Reset()
+	if err := dbEncoder.Encode(file); err != nil {
+		return nil, err
+	}
+	return dbBuffer.Bytes(), nil
+}
+
+// writeFileAtomic replaces the file at path with data, so that a crash
+// leaves either the old or the new contents.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// lastWrite is when writeDB last wrote the database, in Unix nanoseconds.
+var lastWrite atomic.Int64
+
+// lastDBWrite returns when the database was last saved since the start, or
+// the zero time.
+func lastDBWrite() time.Time {
+	if ns := lastWrite.Load(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// shard returns the shard for guildID, creating an empty one if necessary.
+func shard(guildID string) *guildShard {
+	store.Lock()
+	defer store.Unlock()
+	sh, ok := store.shards[guildID]
+	if !ok {
+		sh = &guildShard{}
+		store.shards[guildID] = sh
+	}
+	return sh
+}
+
+// decode returns a copy of the shard's guild data. The caller must hold sh.mu.
+func (sh *guildShard) decode() (*GuildData, error) {
+	if g := sh.decoded.Load(); g != nil {
+		return deepCopy(g), nil
+	}
+	g := &GuildData{}
+	if sh.data != nil {
+		if err := json.Unmarshal(sh.data, g); err != nil {
+			return nil, err
+		}
+	}
+	if g.Restaurants == nil {
+		g.Restaurants = []Restaurant{}
+	}
+	sh.decoded.Store(g)
+	return deepCopy(g), nil
+}
+
+// setData replaces the shard's encoded data. The caller must hold sh.mu for
+// writing and store's lock.
+func (sh *guildShard) setData(data []byte) {
+	sh.data = data
+	sh.decoded.Store(nil)
+}
+
+// applyChange applies a change to the in-memory database: the encoded data
+// of the guilds it changed, and the new root if it changed that. The caller
+// must hold the lock of every changed shard for writing.
+func applyChange(guilds map[string][]byte, root *database) error {
+	opLog.Lock()
+	defer opLog.Unlock()
+	if err := appendOp(guilds, root); err != nil {
+		recordWrite(err)
+		return err
+	}
+
+	store.Lock()
+	defer store.Unlock()
+	for id, data := range guilds {
+		sh, ok := store.shards[id]
+		if !ok {
+			sh = &guildShard{}
+			store.shards[id] = sh
+		}
+		sh.setData(data)
+	}
+	if root != nil {
+		store.root = *root
+	}
+	return nil
+}
+
+// saveGuild stores g as a guild's data and marks the database for saving.
+// The caller must hold the guild's shard lock for writing.
+func saveGuild(guildID string, g *GuildData, opts []saveOption) error {
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(shard(guildID).data, data) {
+		// Nothing to log or write, e.g. for settings set to their value.
+		return nil
+	}
+	if err := applyChange(map[string][]byte{guildID: data}, nil); err != nil {
+		return err
+	}
+	return markDirty(opts)
+}
+
+// claimMutex keeps two guilds from claiming the unclaimed entries at once.
+var claimMutex sync.Mutex
+
+// claimUnclaimed hands the entries of the original single-list format to the
+// shard's guild if it is the first to be stored. The caller must hold sh.mu
+// for writing.
+func (sh *guildShard) claimUnclaimed(guildID string) error {
+	claimMutex.Lock()
+	defer claimMutex.Unlock()
+
+	store.Lock()
+	root := store.root
+	store.Unlock()
+	if sh.data != nil || len(root.Unclaimed) == 0 {
+		return nil
+	}
+
+	g := &GuildData{Restaurants: root.Unclaimed}
+	g.assignIDs()
+	data, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	log.Printf("Guild %s claimed %d restaurants from the legacy list", guildID, len(root.Unclaimed))
+	root.Unclaimed = nil
+	if err := applyChange(map[string][]byte{guildID: data}, &root); err != nil {
+		return err
+	}
+	return markDirty([]saveOption{syncSave})
+}
+
+// hasUnclaimed reports whether entries of the original format await a guild.
+func hasUnclaimed() bool {
+	store.Lock()
+	defer store.Unlock()
+	return len(store.root.Unclaimed) > 0
+}
+
+// errNoChange makes an update save nothing.
+var errNoChange = errors.New("no change")
+
+// viewGuild calls fn with a guild's data without saving any changes.
+func viewGuild(guildID string, fn func(g *GuildData) error) error {
+	if hasUnclaimed() {
+		if err := updateGuild(guildID, func(*GuildData) error { return errNoChange }); err != nil && !errors.Is(err, errNoChange) {
+			return err
+		}
+	}
+	store.dbMu.RLock()
+	defer store.dbMu.RUnlock()
+
+	sh := shard(guildID)
+	sh.mu.RLock()
+	g, err := sh.decode()
+	sh.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return fn(g)
+}
+
+// viewKnownGuild is like viewGuild but returns ErrUnknownGuild instead of
+// creating data for guilds the bot has never stored anything for.
+func viewKnownGuild(guildID string, fn func(g *GuildData) error) error {
+	store.dbMu.RLock()
+	defer store.dbMu.RUnlock()
+
+	sh := shard(guildID)
+	sh.mu.RLock()
+	known := sh.data != nil
+	g, err := sh.decode()
+	sh.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if !known {
+		return ErrUnknownGuild
+	}
+	return fn(g)
+}
+
+// updateKnownGuild is like updateGuild but returns ErrUnknownGuild instead of
+// creating data for guilds the bot has never stored anything for.
+func updateKnownGuild(guildID string, fn func(g *GuildData) error, opts ...saveOption) error {
+	return update(guildID, false, fn, opts)
+}
+
+// updateGuild calls fn with a guild's data and saves the result if fn succeeds.
+func updateGuild(guildID string, fn func(g *GuildData) error, opts ...saveOption) error {
+	return update(guildID, true, fn, opts)
+}
+
+// update implements updateGuild and updateKnownGuild.
+func update(guildID string, create bool, fn func(g *GuildData) error, opts []saveOption) error {
+	store.dbMu.RLock()
+	defer store.dbMu.RUnlock()
+
+	sh := shard(guildID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if create {
+		if err := sh.claimUnclaimed(guildID); err != nil {
+			return err
+		}
+	} else if sh.data == nil {
+		return ErrUnknownGuild
+	}
+	g, err := sh.decode()
+	if err != nil {
+		return err
+	}
+	if err := fn(g); err != nil {
+		return err
+	}
+	if err := checkWritable(); err != nil {
+		return err
+	}
+	return saveGuild(guildID, g, opts)
+}
+
+// updateDB calls fn with the whole database and saves the result if fn
+// succeeds. It is for the few operations that span guilds, and waits for
+// all others to finish.
+func updateDB(fn func(db *database) error, opts ...saveOption) error {
+	store.dbMu.Lock()
+	defer store.dbMu.Unlock()
+
+	store.Lock()
+	root, err := json.Marshal(store.root)
+	db := &database{}
+	if err == nil {
+		err = json.Unmarshal(root, db)
+	}
+	db.Guilds = map[string]*GuildData{}
+	shards := make(map[string]*guildShard, len(store.shards))
+	for id, sh := range store.shards {
+		shards[id] = sh
+	}
+	store.Unlock()
+	if err != nil {
+		return err
+	}
+	// Holding dbMu for writing, no other operation uses the shards.
+	for id, sh := range shards {
+		if sh.data == nil {
+			continue
+		}
+		if db.Guilds[id], err = sh.decode(); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(db); err != nil {
+		return err
+	}
+	if err := checkWritable(); err != nil {
+		return err
+	}
+
+	changed := map[string][]byte{}
+	for id, g := range db.Guilds {
+		data, err := json.Marshal(g)
+		if err != nil {
+			return err
+		}
+		if sh, ok := shards[id]; !ok || !bytes.Equal(sh.data, data) {
+			changed[id] = data
+		}
+	}
+	if err := applyChange(changed, &database{Version: db.Version, Unclaimed: db.Unclaimed, Shares: db.Shares, Directory: db.Directory}); err != nil {
+		return err
+	}
+	return markDirty(opts)
+}
+
+// forEachGuild calls fn for every known guild this process owns without
+// saving any changes. Guilds run by other shard processes are skipped, so
+// that their jobs only run once.
+func forEachGuild(fn func(guildID string, g *GuildData)) error {
+	store.dbMu.RLock()
+	defer store.dbMu.RUnlock()
+
+	store.Lock()
+	ids := make([]string, 0, len(store.shards))
+	for id, sh := range store.shards {
+		if sh.data != nil && ownsGuild(id) {
+			ids = append(ids, id)
+		}
+	}
+	store.Unlock()
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		sh := shard(id)
+		sh.mu.RLock()
+		g, err := sh.decode()
+		sh.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		fn(id, g)
+	}
+	return nil
+}
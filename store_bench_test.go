@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The targets of the hot paths at 1,000 entries, from reading the guild to
+// the formatted reply. The benchmarks fail when a run takes longer on
+// average, which flags regressions of the decoded guild cache and of the
+// sorting. They leave about twice the time a run takes on a current server,
+// for slower CI machines.
+const (
+	listTarget   = 10 * time.Millisecond
+	searchTarget = 5 * time.Millisecond
+	pickTarget   = 5 * time.Millisecond
+	addTarget    = 20 * time.Millisecond
+)
+
+// benchSizes are the list sizes the benchmarks run at.
+var benchSizes = []int{1000, 10000}
+
+// seedBenchGuild fills a guild with n synthetic restaurants with tags,
+// ratings and visits, returning its ID.
+func seedBenchGuild(b *testing.B, n int) string {
+	b.Helper()
+	newTestDB(b)
+	guildID := "bench-" + strconv.Itoa(n)
+	cuisines := []string{"pizza", "sushi", "tacos", "curry", "burgers", "ramen", "salad", "kebab"}
+	now := time.Now().UTC()
+	err := updateGuild(guildID, func(g *GuildData) error {
+		g.Config.MaxRestaurants = 2 * n
+		for i := range n {
+			r := Restaurant{
+				ID:      g.nextID(),
+				Name:    fmt.Sprintf("%s place %05d", cuisines[i%len(cuisines)], i),
+				AddedAt: now.AddDate(0, 0, -i%365),
+				Tags:    []string{cuisines[i%len(cuisines)], "lunch"},
+				Price:   1 + i%4,
+				Ratings: map[string]int{},
+			}
+			for u := range 5 {
+				r.Ratings[strconv.Itoa(u)] = 1 + (i+u)%5
+			}
+			for v := range i % 4 {
+				r.Visits = append(r.Visits, Visit{Date: now.AddDate(0, 0, -7*v-i%30), Attendees: []string{"1", "2"}})
+			}
+			g.Restaurants = append(g.Restaurants, r)
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return guildID
+}
+
+// checkTarget fails a benchmark at 1,000 entries that is slower than target.
+func checkTarget(b *testing.B, n int, target time.Duration) {
+	b.Helper()
+	if n != 1000 || b.N == 0 {
+		return
+	}
+	if per := b.Elapsed() / time.Duration(b.N); per > target {
+		b.Errorf("%v per operation, target %v", per, target)
+	}
+}
+
+func BenchmarkList(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			guildID := seedBenchGuild(b, n)
+			query, ferr := parseQuery("")
+			if ferr != nil {
+				b.Fatal(ferr)
+			}
+			b.ResetTimer()
+			for range b.N {
+				restaurants, err := GetRestaurants(guildID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				restaurants = query.Apply(restaurants)
+				query.Order(restaurants, GuildConfig{})
+				if lines := listLines(GuildConfig{}, query, restaurants, time.Now()); len(lines) != n {
+					b.Fatalf("%d lines, want %d", len(lines), n)
+				}
+			}
+			checkTarget(b, n, listTarget)
+		})
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			guildID := seedBenchGuild(b, n)
+			match, problem := parseSearch("sushi")
+			if problem != "" {
+				b.Fatal(problem)
+			}
+			b.ResetTimer()
+			for range b.N {
+				restaurants, err := GetRestaurants(guildID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if matches := searchMatches(GuildConfig{}, restaurants, "sushi", match, time.Now()); len(matches) == 0 {
+					b.Fatal("no matches")
+				}
+			}
+			checkTarget(b, n, searchTarget)
+		})
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			guildID := seedBenchGuild(b, n)
+			b.ResetTimer()
+			for i := range b.N {
+				name := fmt.Sprintf("new bistro %d", i)
+				if _, err := FindSimilar(guildID, name); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := ForceAddRestaurant(guildID, name, Contributor{ID: "1", Name: "bench"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			checkTarget(b, n, addTarget)
+		})
+	}
+}
+
+func BenchmarkRandomPick(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			guildID := seedBenchGuild(b, n)
+			query, ferr := parseQuery("")
+			if ferr != nil {
+				b.Fatal(ferr)
+			}
+			b.ResetTimer()
+			for range b.N {
+				restaurants, err := GetRestaurants(guildID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				candidates := query.Apply(restaurants)
+				weight := GuildConfig{}.pickWeight(restaurants, time.Now())
+				if picks := weightedSample(candidates, 1, weight); len(picks) != 1 {
+					b.Fatalf("%d picks, want 1", len(picks))
+				}
+			}
+			checkTarget(b, n, pickTarget)
+		})
+	}
+}
+
+// BenchmarkUpdateAcrossGuilds runs updates of different guilds in parallel,
+// which only share the database lock for reading.
+func BenchmarkUpdateAcrossGuilds(b *testing.B) {
+	newTestDB(b)
+	var next atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		guildID := "g" + strconv.FormatInt(next.Add(1), 10)
+		for pb.Next() {
+			err := updateGuild(guildID, func(g *GuildData) error {
+				g.NextID++
+				return nil
+			})
+			if err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentGuilds runs updates and views of several guilds alongside
+// updates spanning the database. Run it with -race to check the locking.
+func TestConcurrentGuilds(t *testing.T) {
+	newTestDB(t)
+	const guilds, workers, rounds = 4, 4, 50
+	var wg sync.WaitGroup
+	for gi := range guilds {
+		guildID := "g" + strconv.Itoa(gi)
+		for range workers {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for range rounds {
+					err := updateGuild(guildID, func(g *GuildData) error {
+						g.Restaurants = append(g.Restaurants, Restaurant{ID: g.nextID(), Name: "r"})
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for range rounds {
+					err := viewGuild(guildID, func(g *GuildData) error {
+						// Views may modify their copy without it showing anywhere.
+						g.Restaurants = append(g.Restaurants, Restaurant{Name: "scratch"})
+						if g.NextID != len(g.Restaurants)-1 {
+							t.Errorf("guild %s: next ID %d with %d restaurants", guildID, g.NextID, len(g.Restaurants)-1)
+						}
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range rounds {
+			err := updateDB(func(db *database) error {
+				for _, g := range db.Guilds {
+					g.Restaurants = append(g.Restaurants, Restaurant{ID: g.nextID(), Name: "all"})
+				}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		// Guilds created after some of the database-wide updates miss those.
+		if n := len(g.Restaurants); n < workers*rounds || n > workers*rounds+rounds || n != g.NextID {
+			t.Errorf("guild %s: %d restaurants, next ID %d", guildID, n, g.NextID)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
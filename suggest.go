@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// defaultShortlist is the shortlist size of `!suggest` without a number.
+	defaultShortlist = 3
+	// maxShortlist is the longest shortlist, one embed per candidate being
+	// the most Discord shows in a message.
+	maxShortlist = 10
+)
+
+// handleSuggest implements `!suggest [N] [filter] [@member...]`, drawing a
+// shortlist of N distinct restaurants to discuss, weighted like `!random`.
+// A shortlist that fits in a poll can be turned into one with a button.
+func handleSuggest(c *Context) {
+	want := defaultShortlist
+	if first, rest, _ := strings.Cut(c.Args, " "); first != "" {
+		if n, err := strconv.Atoi(first); err == nil {
+			if n < 1 {
+				c.Reply("suggest.usage", Args{"max": maxShortlist})
+				return
+			}
+			want, c.Args = min(n, maxShortlist), strings.TrimSpace(rest)
+		}
+	}
+	query, ok := parsePickQuery(c)
+	if !ok {
+		return
+	}
+	query.require(c.Config)
+	if !c.applyGroup(query) {
+		return
+	}
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	if len(restaurants) == 0 {
+		c.Reply("list.empty", nil)
+		return
+	}
+	candidates := query.Apply(restaurants)
+	if len(candidates) == 0 {
+		c.replyGroupNoMatch(query, restaurants)
+		return
+	}
+
+	now := time.Now()
+	weight := uniformWeight
+	if !query.Any {
+		weight = c.Config.pickWeight(restaurants, now)
+	}
+	picked := weightedSample(candidates, want, weight)
+	content := c.T("suggest.header", Args{"count": len(picked)})
+	if len(picked) < want {
+		content = c.T("suggest.all", Args{"count": len(picked)})
+	}
+	msg := &discordgo.MessageSend{Content: content}
+	ids := make([]string, len(picked))
+	for i, r := range picked {
+		msg.Embeds = append(msg.Embeds, suggestionEmbed(c.Config, r, now))
+		ids[i] = r.ID
+	}
+	if len(picked) >= 2 && len(picked) <= pollSize {
+		msg.Components = []discordgo.MessageComponent{buttonRow(
+			discordgo.Button{Label: c.T("button.suggest_poll", nil), Style: discordgo.PrimaryButton, CustomID: "suggest:poll:" + strings.Join(ids, ",")},
+		)}
+	}
+	if _, err := c.SendComplex(msg); err != nil {
+		log.Printf("Failed to send suggestions: %v", err)
+	}
+}
+
+// suggestionEmbed shows a candidate of a shortlist with its price, rating,
+// tags and distance from the office.
+func suggestionEmbed(cfg GuildConfig, r Restaurant, now time.Time) *discordgo.MessageEmbed {
+	var parts []string
+	if r.Price > 0 {
+		parts = append(parts, formatPrice(r.Price))
+	}
+	if avg, ok := r.Rating(cfg, now); ok {
+		parts = append(parts, formatRating(avg))
+	}
+	if len(r.Tags) > 0 {
+		parts = append(parts, formatTags(r.Tags))
+	}
+	if cfg.Office != nil && r.Location != nil {
+		parts = append(parts, cfg.T("list.distance", Args{"km": fmt.Sprintf("%.1f", cfg.Office.DistanceKm(*r.Location))}))
+	}
+	title := r.Name
+	if r.Emoji != "" {
+		title = r.Emoji + " " + r.Name
+	}
+	embed := &discordgo.MessageEmbed{
+		Title:       truncateRunes(title, 256),
+		Description: strings.Join(parts, " · "),
+		Color:       previewColor,
+		Footer:      &discordgo.MessageEmbedFooter{Text: idPrefix + r.ID},
+	}
+	if r.Link != "" {
+		embed.URL = r.Link
+	}
+	return embed
+}
+
+// handleSuggestComponent handles the Start poll button of a shortlist, whose
+// custom ID lists the IDs of its restaurants. Restaurants removed or archived
+// since are left out.
+func handleSuggestComponent(i *Interaction) {
+	if len(i.Args) != 2 || i.Args[0] != "poll" {
+		return
+	}
+	var candidates []Restaurant
+	err := viewGuild(i.GuildID, func(g *GuildData) error {
+		for _, id := range strings.Split(i.Args[1], ",") {
+			if n := g.findID(id); n >= 0 && !g.Restaurants[n].IsArchived() {
+				candidates = append(candidates, g.Restaurants[n])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to load suggestions: %v", err)
+		i.Ephemeral("list.failed", nil)
+		return
+	}
+	if len(candidates) < 2 {
+		i.Ephemeral("poll.too_few", Args{"count": len(candidates)})
+		return
+	}
+	by := contributorFor(i.Event.Member.User)
+	i.Update(i.Event.Message.Content+"\n"+i.T("suggest.poll_started", Args{"user": by.Name}), nil)
+	if err := postPoll(i.Session, i.GuildID, i.Event.ChannelID, i.Config, candidates, &Query{}, time.Now().UTC()); err != nil {
+		log.Printf("Failed to start poll: %v", err)
+		if _, err := i.Session.ChannelMessageSend(i.Event.ChannelID, i.T("poll.failed", nil)); err != nil {
+			log.Printf("Failed to report poll failure: %v", err)
+		}
+	}
+}
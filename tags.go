@@ -0,0 +1,120 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tagPattern matches a valid tag including its leading '#'.
+var tagPattern = regexp.MustCompile(`^#[\p{L}\p{N}_-]{1,32}$`)
+
+// parseTag normalizes a `#tag` token, reporting whether it is a valid tag.
+func parseTag(token string) (string, bool) {
+	if !tagPattern.MatchString(token) {
+		return "", false
+	}
+	return strings.ToLower(strings.TrimPrefix(token, "#")), true
+}
+
+// parseTags normalizes a list of `#tag` tokens, returning the first invalid token if any.
+func parseTags(tokens []string) ([]string, string) {
+	var tags []string
+	for _, token := range tokens {
+		tag, ok := parseTag(token)
+		if !ok {
+			return nil, token
+		}
+		tags = append(tags, tag)
+	}
+	return tags, ""
+}
+
+// formatTags renders tags the way users type them.
+func formatTags(tags []string) string {
+	formatted := make([]string, len(tags))
+	for i, t := range tags {
+		formatted[i] = "#" + t
+	}
+	return strings.Join(formatted, " ")
+}
+
+// TagRestaurant adds and removes tags on a restaurant on behalf of by,
+// returning its canonical name and resulting tags.
+func TagRestaurant(guildID, name string, add, remove []string, by *Contributor) (string, []string, error) {
+	var canonical string
+	var tags []string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		details := r.details()
+		for _, t := range add {
+			if !r.HasTag(t) {
+				r.Tags = append(r.Tags, t)
+			}
+		}
+		kept := r.Tags[:0]
+		for _, t := range r.Tags {
+			drop := false
+			for _, d := range remove {
+				drop = drop || t == d
+			}
+			if !drop {
+				kept = append(kept, t)
+			}
+		}
+		r.Tags = kept
+		sort.Strings(r.Tags)
+		r.revise(details, by)
+		canonical, tags = r.Name, append([]string(nil), r.Tags...)
+		return nil
+	})
+	return canonical, tags, err
+}
+
+// handleTag implements `!tag "Name" #tag...`.
+func handleTag(c *Context) {
+	editTags(c, true)
+}
+
+// handleUntag implements `!untag "Name" #tag...`.
+func handleUntag(c *Context) {
+	editTags(c, false)
+}
+
+func editTags(c *Context, add bool) {
+	name, rest, ok := parseRef(c.Args)
+	if !ok || name == "" || rest == "" {
+		c.Reply("tag.usage", nil)
+		return
+	}
+	tags, invalid := parseTags(strings.Fields(rest))
+	if invalid != "" {
+		c.Reply("tag.invalid", Args{"tag": invalid})
+		return
+	}
+
+	var canonical string
+	var result []string
+	var err error
+	by := contributorFor(c.Message.Author)
+	if add {
+		canonical, result, err = TagRestaurant(c.GuildID, name, tags, nil, &by)
+	} else {
+		canonical, result, err = TagRestaurant(c.GuildID, name, nil, tags, &by)
+	}
+	if err != nil {
+		log.Printf("Failed to update tags: %v", err)
+		c.replyError("tag.failed", err, name)
+		return
+	}
+	if len(result) == 0 {
+		c.Ack("tag.none", Args{"name": canonical})
+		return
+	}
+	c.Ack("tag.done", Args{"name": canonical, "tags": formatTags(result)})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// tagSuggestTimeout is how long the buttons of a tag suggestion stay valid.
+	tagSuggestTimeout = 2 * time.Minute
+	// maxTagSuggestions is how many tags are suggested at most, one row of buttons.
+	maxTagSuggestions = 5
+	// minTagScore is the score a tag needs to be suggested.
+	minTagScore = 0.75
+)
+
+// tagStopWords are name words too common to say anything about a restaurant.
+var tagStopWords = map[string]bool{"the": true, "and": true, "der": true, "die": true, "das": true, "und": true}
+
+// tagSuggestion is a tag suggested for a new restaurant.
+type tagSuggestion struct {
+	Tag   string
+	Score float64
+}
+
+// nameWords returns the distinct words of a name that can relate it to others.
+func nameWords(name string) []string {
+	var words []string
+	for _, w := range strings.Fields(normalizeName(name)) {
+		if utf8.RuneCountInString(w) >= 3 && !tagStopWords[w] && !slices.Contains(words, w) {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// suggestTags scores the tags of the existing restaurants for a new one by
+// the words their names share with its name. Each shared word votes for the
+// tags of the restaurants named with it in proportion to how many of them
+// carry the tag. A word only one restaurant is named with is weak evidence
+// unless it is a tag itself, like "sushi", which is also suggested directly.
+// Only the tags scoring at least minTagScore are returned, best first.
+func suggestTags(name string, restaurants []Restaurant) []tagSuggestion {
+	known := map[string]bool{}
+	for _, r := range restaurants {
+		for _, t := range r.Tags {
+			known[t] = true
+		}
+	}
+
+	scores := map[string]float64{}
+	for _, word := range nameWords(name) {
+		named, tagged := 0, map[string]int{}
+		for _, r := range restaurants {
+			if r.IsArchived() || strings.EqualFold(r.Name, name) || !slices.Contains(nameWords(r.Name), word) {
+				continue
+			}
+			named++
+			for _, t := range r.Tags {
+				tagged[t]++
+			}
+		}
+		support := 1.0
+		if named == 1 && !known[word] {
+			support = 0.5
+		}
+		for t, n := range tagged {
+			scores[t] += support * float64(n) / float64(named)
+		}
+		if known[word] {
+			scores[word]++
+		}
+	}
+
+	var suggestions []tagSuggestion
+	for t, score := range scores {
+		if score >= minTagScore {
+			suggestions = append(suggestions, tagSuggestion{t, score})
+		}
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Tag < suggestions[j].Tag
+	})
+	return suggestions[:min(len(suggestions), maxTagSuggestions)]
+}
+
+// pendingTags is a tag suggestion waiting for "Apply" or "Skip".
+type pendingTags struct {
+	guildID  string
+	userID   string
+	name     string
+	tags     []string
+	selected []bool
+	expires  time.Time
+}
+
+var (
+	// pendingTagSuggestions stores the open tag suggestions, keyed by token.
+	pendingTagSuggestions      = make(map[string]*pendingTags)
+	pendingTagSuggestionsMutex sync.Mutex
+)
+
+// tagSuggestComponents renders the toggles of a suggestion, selected tags
+// highlighted, followed by "Apply" and "Skip".
+func tagSuggestComponents(cfg GuildConfig, token string, p *pendingTags) []discordgo.MessageComponent {
+	var toggles []discordgo.Button
+	for n, t := range p.tags {
+		style := discordgo.SecondaryButton
+		if p.selected[n] {
+			style = discordgo.PrimaryButton
+		}
+		toggles = append(toggles, discordgo.Button{Label: "#" + t, Style: style, CustomID: fmt.Sprintf("tagsug:%s:toggle:%d", token, n)})
+	}
+	return []discordgo.MessageComponent{
+		buttonRow(toggles...),
+		buttonRow(
+			discordgo.Button{Label: cfg.T("button.apply", nil), Style: discordgo.SuccessButton, CustomID: "tagsug:" + token + ":apply"},
+			discordgo.Button{Label: cfg.T("button.skip", nil), Style: discordgo.SecondaryButton, CustomID: "tagsug:" + token + ":skip"},
+		),
+	}
+}
+
+// offerTags suggests tags for a restaurant just added by userID, if its name
+// relates it to tagged entries. Nothing is tagged until the suggestion is applied.
+func offerTags(s *discordgo.Session, channelID, guildID string, cfg GuildConfig, userID, name string) {
+	restaurants, err := GetRestaurants(guildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		return
+	}
+	suggestions := suggestTags(name, restaurants)
+	if len(suggestions) == 0 {
+		return
+	}
+	p := &pendingTags{guildID: guildID, userID: userID, name: name, expires: time.Now().Add(tagSuggestTimeout)}
+	for _, sug := range suggestions {
+		p.tags = append(p.tags, sug.Tag)
+		p.selected = append(p.selected, true)
+	}
+	token := newToken()
+	pendingTagSuggestionsMutex.Lock()
+	pendingTagSuggestions[token] = p
+	pendingTagSuggestionsMutex.Unlock()
+
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Content:         cfg.T("tagsuggest.prompt", Args{"name": name, "user": "<@" + userID + ">"}),
+		Components:      tagSuggestComponents(cfg, token, p),
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+	})
+	if err != nil {
+		log.Printf("Failed to suggest tags: %v", err)
+		pendingTagSuggestionsMutex.Lock()
+		delete(pendingTagSuggestions, token)
+		pendingTagSuggestionsMutex.Unlock()
+		return
+	}
+
+	// An unanswered suggestion only loses its buttons.
+	time.AfterFunc(tagSuggestTimeout, func() {
+		pendingTagSuggestionsMutex.Lock()
+		_, pending := pendingTagSuggestions[token]
+		delete(pendingTagSuggestions, token)
+		pendingTagSuggestionsMutex.Unlock()
+		if !pending {
+			return
+		}
+		components := []discordgo.MessageComponent{}
+		if _, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID: msg.ID, Channel: msg.ChannelID, Components: &components,
+		}); err != nil {
+			log.Printf("Failed to expire tag suggestion: %v", err)
+		}
+	})
+}
+
+// handleTagSuggestComponent handles the toggles and the "Apply" and "Skip"
+// buttons of a tag suggestion.
+func handleTagSuggestComponent(i *Interaction) {
+	if len(i.Args) < 2 {
+		return
+	}
+	token, action := i.Args[0], i.Args[1]
+
+	pendingTagSuggestionsMutex.Lock()
+	p, ok := pendingTagSuggestions[token]
+	if ok && time.Now().After(p.expires) {
+		delete(pendingTagSuggestions, token)
+		ok = false
+	}
+	if !ok {
+		pendingTagSuggestionsMutex.Unlock()
+		i.Update(i.T("tagsuggest.expired", nil), nil)
+		return
+	}
+	if i.UserID() != p.userID {
+		pendingTagSuggestionsMutex.Unlock()
+		i.Ephemeral("tagsuggest.not_yours", nil)
+		return
+	}
+	if action == "toggle" {
+		n := -1
+		if len(i.Args) == 3 {
+			n, _ = strconv.Atoi(i.Args[2])
+		}
+		if n >= 0 && n < len(p.tags) {
+			p.selected[n] = !p.selected[n]
+		}
+		components := tagSuggestComponents(i.Config, token, p)
+		pendingTagSuggestionsMutex.Unlock()
+		i.Update(i.Event.Message.Content, components)
+		return
+	}
+	delete(pendingTagSuggestions, token)
+	pendingTagSuggestionsMutex.Unlock()
+
+	var tags []string
+	for n, t := range p.tags {
+		if p.selected[n] {
+			tags = append(tags, t)
+		}
+	}
+	if action != "apply" || len(tags) == 0 {
+		i.Update(i.T("tagsuggest.skipped", Args{"name": p.name}), nil)
+		return
+	}
+	by := contributorFor(i.Event.Member.User)
+	name, all, err := TagRestaurant(p.guildID, p.name, tags, nil, &by)
+	if err != nil {
+		log.Printf("Failed to apply suggested tags: %v", err)
+		i.Update(i.T("tag.failed", Args{"name": p.name}), nil)
+		return
+	}
+	i.Update(i.T("tagsuggest.applied", Args{"name": name, "tags": formatTags(all)}), nil)
+}
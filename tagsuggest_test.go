@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSuggestTags(t *testing.T) {
+	tagged := func(name string, tags ...string) Restaurant {
+		return Restaurant{Name: name, Tags: tags}
+	}
+	archived := tagged("Pizzeria Vecchia", "closed")
+	archived.Archived = &Archive{At: time.Now()}
+	tests := []struct {
+		name        string
+		add         string
+		restaurants []Restaurant
+		want        []tagSuggestion
+	}{
+		{
+			name:        "empty list",
+			add:         "Pizzeria Napoli",
+			restaurants: nil,
+			want:        nil,
+		},
+		{
+			name:        "shared word votes by share",
+			add:         "Pizzeria Napoli",
+			restaurants: []Restaurant{tagged("Mario Pizzeria", "italian", "pizza"), tagged("Pizzeria Roma", "italian")},
+			want:        []tagSuggestion{{"italian", 1}},
+		},
+		{
+			name:        "one restaurant is weak evidence",
+			add:         "Dragon Express",
+			restaurants: []Restaurant{tagged("Golden Dragon", "chinese")},
+			want:        nil,
+		},
+		{
+			name:        "weak evidence adds up",
+			add:         "Golden Dragon Express",
+			restaurants: []Restaurant{tagged("Golden Dragon", "chinese")},
+			want:        []tagSuggestion{{"chinese", 1}},
+		},
+		{
+			name:        "word that is a tag",
+			add:         "Sushi Garden",
+			restaurants: []Restaurant{tagged("Ocean", "sushi", "japanese")},
+			want:        []tagSuggestion{{"sushi", 1}},
+		},
+		{
+			name:        "word that is a tag with one restaurant named with it",
+			add:         "Sushi Garden",
+			restaurants: []Restaurant{tagged("Sushi Ya", "sushi", "japanese")},
+			want:        []tagSuggestion{{"sushi", 2}, {"japanese", 1}},
+		},
+		{
+			name:        "stop words and short words",
+			add:         "The Spot of Joy",
+			restaurants: []Restaurant{tagged("The Diner", "american"), tagged("Joy of Tea", "tea"), tagged("Of", "x")},
+			want:        nil,
+		},
+		{
+			name:        "accents and case",
+			add:         "CAFÉ Central",
+			restaurants: []Restaurant{tagged("Cafe Luna", "coffee"), tagged("café sol", "coffee", "brunch")},
+			want:        []tagSuggestion{{"coffee", 1}},
+		},
+		{
+			name:        "archived and same name left out",
+			add:         "Pizzeria Roma",
+			restaurants: []Restaurant{archived, tagged("pizzeria roma", "old"), tagged("Pizzeria Uno", "italian")},
+			want:        nil,
+		},
+		{
+			name: "below the minimum score left out",
+			add:  "Noodle Bar",
+			restaurants: []Restaurant{
+				tagged("Noodle House", "noodles", "asian", "soup", "cheap", "quick", "late"),
+				tagged("Noodle Stop", "noodles", "asian", "soup", "cheap", "quick", "late"),
+				tagged("Noodle King", "noodles", "asian"),
+			},
+			want: []tagSuggestion{{"asian", 1}, {"noodles", 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := suggestTags(tt.add, tt.restaurants)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("suggestTags(%q) = %v, want %v", tt.add, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSuggestTagsLimit checks that ties are broken by tag and only the best
+// maxTagSuggestions are returned.
+func TestSuggestTagsLimit(t *testing.T) {
+	var restaurants []Restaurant
+	for _, name := range []string{"Grill One", "Grill Two"} {
+		restaurants = append(restaurants, Restaurant{Name: name, Tags: []string{"a", "b", "c", "d", "e", "f", "g"}})
+	}
+	got := suggestTags("Grill Three", restaurants)
+	want := []tagSuggestion{{"a", 1}, {"b", 1}, {"c", 1}, {"d", 1}, {"e", 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("suggestTags = %v, want %v", got, want)
+	}
+}
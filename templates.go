@@ -0,0 +1,203 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxTemplateLength bounds custom templates so they always fit in a message.
+const maxTemplateLength = 500
+
+// responseTemplates maps the names guilds use to override a response to the
+// catalog key it replaces.
+var responseTemplates = map[string]string{
+	"pong":                     "ping.pong",
+	"add_done":                 "add.done",
+	"remove_done":              "remove.done",
+	"visited_done":             "visited.done",
+	"random_pick":              "random.pick",
+	"spotlight_announce_new":   "spotlight.announce_new",
+	"spotlight_announce_visit": "spotlight.announce_visited",
+}
+
+// placeholderPattern matches a {placeholder} in a message.
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// templateNames returns the overridable template names in sorted order.
+func templateNames() []string {
+	names := make([]string, 0, len(responseTemplates))
+	for name := range responseTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// templatePlaceholders returns the placeholders supported by a template, taken
+// from every form of its default English message.
+func templatePlaceholders(name string) []string {
+	msg, _, _ := translator.lookup(defaultLanguage, responseTemplates[name])
+	seen := map[string]bool{}
+	var placeholders []string
+	for _, text := range msg {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				placeholders = append(placeholders, match[1])
+			}
+		}
+	}
+	sort.Strings(placeholders)
+	return placeholders
+}
+
+// templateError describes why a custom template was rejected as a catalog message.
+type templateError struct {
+	Key  string
+	Args Args
+}
+
+func (e *templateError) Error() string {
+	return translator.T(defaultLanguage, e.Key, e.Args)
+}
+
+// validateTemplate checks a custom template against the placeholders its
+// response supports, so that mistakes are caught when the template is set.
+func validateTemplate(name, text string) *templateError {
+	if strings.TrimSpace(text) == "" {
+		return &templateError{Key: "template.error_empty"}
+	}
+	if len(text) > maxTemplateLength {
+		return &templateError{Key: "template.error_length", Args: Args{"max": maxTemplateLength}}
+	}
+	return checkPlaceholders(text, templatePlaceholders(name))
+}
+
+// checkPlaceholders checks that text only uses the allowed placeholders and
+// has no stray braces.
+func checkPlaceholders(text string, placeholders []string) *templateError {
+	allowed := map[string]bool{}
+	for _, p := range placeholders {
+		allowed[p] = true
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !allowed[match[1]] {
+			return &templateError{Key: "template.error_placeholder", Args: Args{"placeholder": "{" + match[1] + "}"}}
+		}
+	}
+	if rest := placeholderPattern.ReplaceAllString(text, ""); strings.ContainsAny(rest, "{}") {
+		return &templateError{Key: "template.error_braces"}
+	}
+	return nil
+}
+
+// escapeMentions stops a template from pinging users, roles or everyone by
+// breaking up every @ with a zero-width space.
+func escapeMentions(text string) string {
+	return strings.ReplaceAll(text, "@", "@​")
+}
+
+// T formats a catalog message in the guild's language, using the guild's
+// custom template for it when one is set.
+func (cfg GuildConfig) T(key string, args Args) string {
+	for name, templateKey := range responseTemplates {
+		if templateKey == key {
+			if custom, ok := cfg.Templates[name]; ok {
+				return formatMessage(custom, args)
+			}
+			break
+		}
+	}
+	return translator.T(cfg.Lang(), key, args)
+}
+
+// handleTemplateSetting implements `!settings template [name ["text"|reset]]`.
+func handleTemplateSetting(c *Context, args string) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	rest = strings.TrimSpace(rest)
+
+	if name == "" {
+		lines := []string{c.T("template.header", nil)}
+		for _, n := range templateNames() {
+			key := "template.entry"
+			if _, ok := c.Config.Templates[n]; ok {
+				key = "template.entry_custom"
+			}
+			lines = append(lines, c.T(key, Args{"name": n, "placeholders": formatPlaceholders(templatePlaceholders(n))}))
+		}
+		c.Send(strings.Join(lines, "\n"))
+		return
+	}
+
+	// `!settings template reset <name>` restores the default.
+	if name == "reset" {
+		name, rest = rest, "reset"
+	}
+	if _, ok := responseTemplates[name]; !ok {
+		c.Reply("template.unknown", Args{"names": strings.Join(templateNames(), ", ")})
+		return
+	}
+
+	if rest == "" {
+		if custom, ok := c.Config.Templates[name]; ok {
+			c.Reply("template.show_custom", Args{"name": name, "template": custom})
+		} else {
+			c.Reply("template.show_default", Args{"name": name})
+		}
+		return
+	}
+
+	if !c.RequireAdmin() {
+		return
+	}
+
+	if rest == "reset" {
+		if err := updateGuild(c.GuildID, func(g *GuildData) error {
+			delete(g.Config.Templates, name)
+			return nil
+		}); err != nil {
+			log.Printf("Failed to reset template: %v", err)
+			c.Reply("settings.save_failed", nil)
+			return
+		}
+		c.Reply("template.reset", Args{"name": name})
+		return
+	}
+
+	text, _, ok := parseQuoted(rest)
+	if !ok {
+		c.Reply("template.usage", nil)
+		return
+	}
+	if err := validateTemplate(name, text); err != nil {
+		c.Reply("template.invalid", Args{"error": c.T(err.Key, err.Args), "placeholders": formatPlaceholders(templatePlaceholders(name))})
+		return
+	}
+	text = escapeMentions(text)
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		if g.Config.Templates == nil {
+			g.Config.Templates = map[string]string{}
+		}
+		g.Config.Templates[name] = text
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save template: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Reply("template.set", Args{"name": name})
+}
+
+// formatPlaceholders renders placeholder names the way they are written in templates.
+func formatPlaceholders(placeholders []string) string {
+	if len(placeholders) == 0 {
+		return "-"
+	}
+	quoted := make([]string, len(placeholders))
+	for i, p := range placeholders {
+		quoted[i] = "`{" + p + "}`"
+	}
+	return strings.Join(quoted, " ")
+}
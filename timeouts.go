@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// commandTimeout is how long a command may take before it is answered
+	// with error.timeout.
+	commandTimeout = 10 * time.Second
+	// longCommandTimeout is the deadline of the commands in longCommands.
+	longCommandTimeout = 2 * time.Minute
+)
+
+// longCommands download or send files or change many entries at once.
+var longCommands = map[string]bool{
+	"import":    true,
+	"export":    true,
+	"restore":   true,
+	"seed":      true,
+	"share":     true,
+	"bulk-edit": true,
+	"photo":     true,
+	"settings":  true,
+}
+
+// shutdownCtx is cancelled when the bot shuts down. Every command's context
+// is derived from it.
+var shutdownCtx, stopShutdown = context.WithCancel(context.Background())
+
+// commandDeadline returns how long a command may run.
+func commandDeadline(name string) time.Duration {
+	if longCommands[name] {
+		return longCommandTimeout
+	}
+	return commandTimeout
+}
+
+// stageKey is the context key of the stage a command is in.
+type stageKey struct{}
+
+// withStages returns a context recording the stage its command is in.
+func withStages(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stageKey{}, new(atomic.Pointer[string]))
+}
+
+// enterStage records that the command waits for what name describes, until
+// the returned function is called.
+func enterStage(ctx context.Context, name string) (leave func()) {
+	current, ok := ctx.Value(stageKey{}).(*atomic.Pointer[string])
+	if !ok {
+		return func() {}
+	}
+	previous := current.Swap(&name)
+	return func() { current.Store(previous) }
+}
+
+// currentStage describes what the command is waiting for, "handler" when it
+// isn't waiting for anything in particular.
+func currentStage(ctx context.Context) string {
+	if current, ok := ctx.Value(stageKey{}).(*atomic.Pointer[string]); ok {
+		if name := current.Load(); name != nil {
+			return *name
+		}
+	}
+	return "handler"
+}
+
+// runWithDeadline runs a command with its deadline, answering error.timeout
+// and logging the stage it was in if the deadline passes first. The handler
+// isn't stopped, but the calls it waits for give up with the context.
+func runWithDeadline(c *Context, name string, run func(c *Context)) {
+	ctx, cancel := context.WithTimeout(shutdownCtx, commandDeadline(name))
+	defer cancel()
+	c.Ctx = withStages(ctx)
+	// The timeout is answered from a copy, as the handler may still be
+	// changing its context, such as the config after a setting.
+	snapshot := *c
+	stop := context.AfterFunc(ctx, func() {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("Command !%s in guild %s timed out after %s in stage %s", name, snapshot.GuildID, commandDeadline(name), currentStage(snapshot.Ctx))
+			snapshot.Reply("error.timeout", nil)
+		}
+	})
+	defer stop()
+	run(c)
+}
+
+// timedOut reports whether err comes from the command running out of time,
+// which runWithDeadline has answered already.
+func (c *Context) timedOut(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) && c.Ctx.Err() != nil
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// defaultRoundDuration is how long a tournament round collects votes by default.
+	defaultRoundDuration = time.Hour
+	// maxRoundDuration bounds the configurable round duration.
+	maxRoundDuration = 7 * 24 * time.Hour
+	// maxChampions is the number of tournament champions kept per guild.
+	maxChampions = 50
+)
+
+// tournamentEmojis are the reactions members vote for either side of a match with.
+var tournamentEmojis = [2]string{"🅰️", "🅱️"}
+
+// tournamentSizes are the supported bracket sizes.
+var tournamentSizes = []int{4, 8, 16}
+
+// Tournament seedings.
+const (
+	seedTop    = "top"
+	seedRandom = "random"
+)
+
+var (
+	// ErrTournamentActive is returned when starting a tournament while one is running.
+	ErrTournamentActive = errors.New("a tournament is already running")
+	// ErrNoTournament is returned when there is no tournament to act on.
+	ErrNoTournament = errors.New("no tournament is running")
+)
+
+// Tournament is a knockout bracket between restaurants, decided by reaction
+// votes one round at a time.
+type Tournament struct {
+	// ID tells the tournament apart from a later one while a round is being closed.
+	ID        string        `json:"id"`
+	ChannelID string        `json:"channel_id"`
+	Seeding   string        `json:"seeding"`
+	Entrants  []Entrant     `json:"entrants"`
+	Rounds    [][]Match     `json:"rounds"`
+	Duration  time.Duration `json:"duration"`
+	// RoundEnds is when the current, last round closes.
+	RoundEnds time.Time   `json:"round_ends"`
+	StartedBy Contributor `json:"started_by"`
+}
+
+// Entrant is a restaurant in a tournament, seeded from 1.
+type Entrant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Seed int    `json:"seed"`
+}
+
+// Match is a pairing of two entrants, by index, within a round.
+type Match struct {
+	A         int    `json:"a"`
+	B         int    `json:"b"`
+	MessageID string `json:"message_id,omitempty"`
+	Votes     [2]int `json:"votes"`
+	// Winner is the index of the entrant that advanced, -1 while undecided.
+	Winner int `json:"winner"`
+}
+
+// Champion records the winner of a tournament.
+type Champion struct {
+	ID   string    `json:"id"`
+	Name string    `json:"name"`
+	Size int       `json:"size"`
+	At   time.Time `json:"at"`
+}
+
+// bracketOrder returns the seeds of a bracket of size n in match order, so
+// that the top seeds meet as late as possible: 1 v 8, 4 v 5, 2 v 7, 3 v 6.
+func bracketOrder(n int) []int {
+	order := []int{1}
+	for len(order) < n {
+		next := make([]int, 0, len(order)*2)
+		for _, s := range order {
+			next = append(next, s, len(order)*2+1-s)
+		}
+		order = next
+	}
+	return order
+}
+
+// seedTournament picks size entrants from candidates, by rating or at random.
+func seedTournament(candidates []Restaurant, size int, seeding string, cfg GuildConfig) []Entrant {
+	now := time.Now()
+	pool := slices.Clone(candidates)
+	rand.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+	if seeding == seedTop {
+		// Unrated restaurants rank below rated ones, in random order.
+		sort.SliceStable(pool, func(i, j int) bool {
+			ai, iok := pool[i].Rating(cfg, now)
+			aj, jok := pool[j].Rating(cfg, now)
+			if iok != jok {
+				return iok
+			}
+			return ai > aj
+		})
+	}
+	entrants := make([]Entrant, size)
+	for i, r := range pool[:size] {
+		entrants[i] = Entrant{ID: r.ID, Name: r.Name, Seed: i + 1}
+	}
+	return entrants
+}
+
+// firstRound pairs the entrants of a new tournament by seed.
+func firstRound(entrants []Entrant) []Match {
+	order := bracketOrder(len(entrants))
+	matches := make([]Match, 0, len(order)/2)
+	for i := 0; i < len(order); i += 2 {
+		matches = append(matches, Match{A: order[i] - 1, B: order[i+1] - 1, Winner: -1})
+	}
+	return matches
+}
+
+// decide sets the winner of a match from its votes. A tie goes to the better seed.
+func (m *Match) decide(entrants []Entrant) {
+	switch {
+	case m.Votes[0] > m.Votes[1]:
+		m.Winner = m.A
+	case m.Votes[1] > m.Votes[0]:
+		m.Winner = m.B
+	case entrants[m.A].Seed < entrants[m.B].Seed:
+		m.Winner = m.A
+	default:
+		m.Winner = m.B
+	}
+}
+
+// current returns the round that is being voted on.
+func (t *Tournament) current() []Match {
+	return t.Rounds[len(t.Rounds)-1]
+}
+
+// roundName returns the catalog key naming a round with the given number of matches.
+func roundName(matches int) string {
+	switch matches {
+	case 1:
+		return "tournament.round_final"
+	case 2:
+		return "tournament.round_semifinals"
+	case 4:
+		return "tournament.round_quarterfinals"
+	default:
+		return "tournament.round_of"
+	}
+}
+
+// renderBracket draws the rounds played so far as a text bracket.
+func renderBracket(cfg GuildConfig, t *Tournament) string {
+	entrant := func(i int) string {
+		e := t.Entrants[i]
+		return fmt.Sprintf("(%d) %s", e.Seed, e.Name)
+	}
+	lines := []string{"```"}
+	for r, round := range t.Rounds {
+		if r > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, cfg.T(roundName(len(round)), Args{"count": len(round) * 2}))
+		for _, m := range round {
+			line := fmt.Sprintf("  %s vs %s", entrant(m.A), entrant(m.B))
+			if m.Winner >= 0 {
+				line += fmt.Sprintf("  %d–%d → %s", m.Votes[0], m.Votes[1], t.Entrants[m.Winner].Name)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(append(lines, "```"), "\n")
+}
+
+// StartTournament creates a guild's tournament, refusing if one is running.
+func StartTournament(guildID string, t Tournament) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		if g.Tournament != nil {
+			return ErrTournamentActive
+		}
+		g.Tournament = &t
+		return nil
+	})
+}
+
+// postRound posts the bracket and a vote message for each match of the
+// current round, and saves the message IDs.
+func postRound(s *discordgo.Session, guildID string, cfg GuildConfig, t *Tournament) error {
+	round := t.current()
+	header := cfg.T("tournament.round_header", Args{
+		"round": cfg.T(roundName(len(round)), Args{"count": len(round) * 2}),
+		"time":  fmt.Sprintf("<t:%d:R>", t.RoundEnds.Unix()),
+		"a":     tournamentEmojis[0], "b": tournamentEmojis[1],
+	})
+	if _, err := s.ChannelMessageSend(t.ChannelID, header+"\n"+renderBracket(cfg, t)); err != nil {
+		return err
+	}
+	ids := make([]string, len(round))
+	for i, m := range round {
+		msg, err := s.ChannelMessageSend(t.ChannelID, fmt.Sprintf("%s %s\n%s %s",
+			tournamentEmojis[0], t.Entrants[m.A].Name, tournamentEmojis[1], t.Entrants[m.B].Name))
+		if err != nil {
+			log.Printf("Failed to post tournament match: %v", err)
+			continue
+		}
+		ids[i] = msg.ID
+		for _, emoji := range tournamentEmojis {
+			if err := s.MessageReactionAdd(msg.ChannelID, msg.ID, emoji); err != nil {
+				log.Printf("Failed to add tournament reaction: %v", err)
+			}
+		}
+	}
+	return updateGuild(guildID, func(g *GuildData) error {
+		if g.Tournament == nil || g.Tournament.ID != t.ID || len(g.Tournament.Rounds) != len(t.Rounds) {
+			return nil
+		}
+		for i, id := range ids {
+			g.Tournament.current()[i].MessageID = id
+		}
+		return nil
+	})
+}
+
+// tallyMatch counts the votes on a match message, not counting the bot's own reactions.
+func tallyMatch(msg *discordgo.Message) [2]int {
+	var votes [2]int
+	for _, reaction := range msg.Reactions {
+		for side, emoji := range tournamentEmojis {
+			if reaction.Emoji != nil && sameEmoji(reaction.Emoji, restaurantEmoji(emoji)) {
+				votes[side] = reaction.Count
+				if reaction.Me {
+					votes[side]--
+				}
+			}
+		}
+	}
+	return votes
+}
+
+// AdvanceTournament decides the current round from the votes counted for its
+// matches and either starts the next round or crowns the champion. It returns
+// the tournament as it now stands and, once it is over, the champion. Round
+// counts from 1 and guards against closing the same round twice.
+func AdvanceTournament(guildID, tournamentID string, round int, votes [][2]int, now time.Time) (*Tournament, *Champion, error) {
+	var t *Tournament
+	var champion *Champion
+	err := updateGuild(guildID, func(g *GuildData) error {
+		if g.Tournament == nil || g.Tournament.ID != tournamentID || len(g.Tournament.Rounds) != round {
+			return ErrNoTournament
+		}
+		t = g.Tournament
+		round := t.current()
+		for i := range round {
+			round[i].Votes = votes[i]
+			round[i].decide(t.Entrants)
+		}
+		if len(round) == 1 {
+			winner := t.Entrants[round[0].Winner]
+			champion = &Champion{ID: winner.ID, Name: winner.Name, Size: len(t.Entrants), At: now.UTC()}
+			g.Champions = append(g.Champions, *champion)
+			if extra := len(g.Champions) - maxChampions; extra > 0 {
+				g.Champions = g.Champions[extra:]
+			}
+			g.Tournament = nil
+			return nil
+		}
+		next := make([]Match, 0, len(round)/2)
+		for i := 0; i < len(round); i += 2 {
+			next = append(next, Match{A: round[i].Winner, B: round[i+1].Winner, Winner: -1})
+		}
+		t.Rounds = append(t.Rounds, next)
+		t.RoundEnds = now.UTC().Add(t.Duration)
+		return nil
+	})
+	return t, champion, err
+}
+
+// advanceTournaments closes every tournament round whose time is up. The state
+// is stored between rounds, so a tournament resumes after a restart.
+func advanceTournaments(s *discordgo.Session, now time.Time) {
+	type dueRound struct {
+		guildID    string
+		cfg        GuildConfig
+		tournament Tournament
+	}
+	var due []dueRound
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if t := g.Tournament; t != nil && !now.Before(t.RoundEnds) {
+			due = append(due, dueRound{guildID, g.Config, *t})
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check tournaments: %v", err)
+		return
+	}
+
+	for _, d := range due {
+		round := d.tournament.current()
+		votes := make([][2]int, len(round))
+		for i, m := range round {
+			if m.MessageID == "" {
+				continue
+			}
+			msg, err := s.ChannelMessage(d.tournament.ChannelID, m.MessageID)
+			if err != nil {
+				log.Printf("Failed to load tournament match %s: %v", m.MessageID, err)
+				continue
+			}
+			votes[i] = tallyMatch(msg)
+		}
+		t, champion, err := AdvanceTournament(d.guildID, d.tournament.ID, len(d.tournament.Rounds), votes, now)
+		if err != nil {
+			log.Printf("Failed to advance tournament in guild %s: %v", d.guildID, err)
+			continue
+		}
+		if champion != nil {
+			text := d.cfg.T("tournament.champion", Args{"name": champion.Name, "count": champion.Size}) + "\n" + renderBracket(d.cfg, t)
+			if _, err := s.ChannelMessageSend(t.ChannelID, text); err != nil {
+				log.Printf("Failed to announce tournament champion: %v", err)
+			}
+			continue
+		}
+		if err := postRound(s, d.guildID, d.cfg, t); err != nil {
+			log.Printf("Failed to post tournament round: %v", err)
+		}
+	}
+}
+
+// handleTournament implements `!tournament N [top|random] [duration]`, and
+// `!tournament status|cancel|champions`.
+func handleTournament(c *Context) {
+	fields := strings.Fields(c.Args)
+	if len(fields) == 0 {
+		c.Reply("tournament.usage", nil)
+		return
+	}
+	switch strings.ToLower(fields[0]) {
+	case "status":
+		tournamentStatus(c)
+		return
+	case "cancel":
+		cancelTournament(c)
+		return
+	case "champions":
+		listChampions(c)
+		return
+	}
+
+	size, err := strconv.Atoi(fields[0])
+	if err != nil || !slices.Contains(tournamentSizes, size) {
+		c.Reply("tournament.usage", nil)
+		return
+	}
+	seeding, duration := seedRandom, defaultRoundDuration
+	for _, f := range fields[1:] {
+		switch f = strings.ToLower(f); f {
+		case seedTop, seedRandom:
+			seeding = f
+		default:
+			d, err := time.ParseDuration(f)
+			if err != nil || d < time.Minute || d > maxRoundDuration {
+				c.Reply("tournament.usage", nil)
+				return
+			}
+			duration = d
+		}
+	}
+
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	var candidates []Restaurant
+	for _, r := range restaurants {
+		if !r.IsArchived() {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) < size {
+		c.Reply("tournament.too_few", Args{"count": len(candidates), "size": size})
+		return
+	}
+
+	entrants := seedTournament(candidates, size, seeding, c.Config)
+	t := Tournament{
+		ID:        newToken(),
+		ChannelID: c.Message.ChannelID,
+		Seeding:   seeding,
+		Entrants:  entrants,
+		Rounds:    [][]Match{firstRound(entrants)},
+		Duration:  duration,
+		RoundEnds: time.Now().UTC().Add(duration),
+		StartedBy: c.Author(),
+	}
+	if err := StartTournament(c.GuildID, t); err != nil {
+		if errors.Is(err, ErrTournamentActive) {
+			c.Reply("tournament.active", nil)
+			return
+		}
+		log.Printf("Failed to start tournament: %v", err)
+		c.Reply("tournament.failed", nil)
+		return
+	}
+	c.Reply("tournament.started", Args{"count": size, "seeding": seeding, "duration": duration.String()})
+	if err := postRound(c.Session, c.GuildID, c.Config, &t); err != nil {
+		log.Printf("Failed to post tournament round: %v", err)
+	}
+}
+
+// tournamentStatus shows the bracket of the running tournament.
+func tournamentStatus(c *Context) {
+	var t *Tournament
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		t = g.Tournament
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load tournament: %v", err)
+		c.Reply("tournament.failed", nil)
+		return
+	}
+	if t == nil {
+		c.Reply("tournament.none", nil)
+		return
+	}
+	c.Send(c.T("tournament.status", Args{"time": fmt.Sprintf("<t:%d:R>", t.RoundEnds.Unix())}) + "\n" + renderBracket(c.Config, t))
+}
+
+// cancelTournament ends the running tournament without a champion.
+func cancelTournament(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	err := updateGuild(c.GuildID, func(g *GuildData) error {
+		if g.Tournament == nil {
+			return ErrNoTournament
+		}
+		g.Tournament = nil
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrNoTournament):
+		c.Reply("tournament.none", nil)
+	case err != nil:
+		log.Printf("Failed to cancel tournament: %v", err)
+		c.Reply("tournament.failed", nil)
+	default:
+		c.Reply("tournament.cancelled", nil)
+	}
+}
+
+// listChampions shows the most recent tournament champions.
+func listChampions(c *Context) {
+	var champions []Champion
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		champions = g.Champions
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load champions: %v", err)
+		c.Reply("tournament.failed", nil)
+		return
+	}
+	if len(champions) == 0 {
+		c.Reply("tournament.no_champions", nil)
+		return
+	}
+	lines := []string{c.T("tournament.champions_header", nil)}
+	for i := len(champions) - 1; i >= max(len(champions)-10, 0); i-- {
+		ch := champions[i]
+		lines = append(lines, c.T("tournament.champion_line", Args{
+			"date": ch.At.In(c.Config.location()).Format("2006-01-02"), "name": ch.Name, "count": ch.Size,
+		}))
+	}
+	c.Send(strings.Join(lines, "\n"))
+}
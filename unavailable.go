@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxUnavailableReason bounds the length of the reason a restaurant is unavailable, in runes.
+const maxUnavailableReason = 200
+
+var (
+	// ErrNotUnavailable is returned when clearing the unavailability of an available restaurant.
+	ErrNotUnavailable = errors.New("restaurant is not unavailable")
+	// ErrPastDate is returned when marking a restaurant unavailable until a day that has passed.
+	ErrPastDate = errors.New("the date has passed")
+)
+
+// Unavailability marks a restaurant as closed for a while, unlike an
+// archived one. It stays on the list but is left out of picks and polls.
+type Unavailability struct {
+	// Until is the last day, as YYYY-MM-DD in the guild's timezone, that the
+	// restaurant is unavailable, empty until further notice.
+	Until  string    `json:"until,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// unavailableOn reports whether the restaurant is unavailable on a day,
+// given as YYYY-MM-DD.
+func (r *Restaurant) unavailableOn(day string) bool {
+	return r.Unavailable != nil && (r.Unavailable.Until == "" || day <= r.Unavailable.Until)
+}
+
+// available returns the restaurants that aren't unavailable on the day of now.
+func available(restaurants []Restaurant, cfg GuildConfig, now time.Time) []Restaurant {
+	day := localDate(now, cfg.location())
+	var kept []Restaurant
+	for _, r := range restaurants {
+		if !r.unavailableOn(day) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// SetUnavailable marks a restaurant unavailable until a day, or until
+// further notice when until is empty, replacing an earlier mark. It returns
+// the restaurant's canonical name.
+func SetUnavailable(guildID, name, until, reason string, now time.Time) (string, error) {
+	var canonical string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		canonical = g.Restaurants[i].Name
+		if until != "" && until < localDate(now, g.Config.location()) {
+			return ErrPastDate
+		}
+		g.Restaurants[i].Unavailable = &Unavailability{Until: until, Reason: reason, Since: now.UTC()}
+		return nil
+	})
+	return canonical, err
+}
+
+// ClearUnavailable makes a restaurant available again, returning its canonical name.
+func ClearUnavailable(guildID, name string) (string, error) {
+	var canonical string
+	err := updateGuild(guildID, func(g *GuildData) error {
+		i, err := g.lookup(name)
+		if err != nil {
+			return err
+		}
+		r := &g.Restaurants[i]
+		canonical = r.Name
+		if r.Unavailable == nil {
+			return ErrNotUnavailable
+		}
+		r.Unavailable = nil
+		return nil
+	})
+	return canonical, err
+}
+
+// parseUnavailable parses `until YYYY-MM-DD [reason]` or `until further
+// notice [reason]`, returning the day, empty for further notice.
+func parseUnavailable(s string) (until, reason string, ok bool) {
+	rest, found := cutPrefixFold(s, "until ")
+	if !found {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	if after, open := cutPrefixFold(rest, "further notice"); open {
+		rest = after
+	} else {
+		day, after, _ := strings.Cut(rest, " ")
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return "", "", false
+		}
+		until, rest = day, after
+	}
+	reason = strings.TrimSpace(rest)
+	if quoted, after, ok := parseQuoted(reason); ok && after == "" {
+		reason = quoted
+	}
+	return until, reason, true
+}
+
+// cutPrefixFold is strings.CutPrefix ignoring case.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// handleUnavailable implements `!unavailable "Name" until YYYY-MM-DD [reason]`
+// and `!unavailable "Name" until further notice [reason]`.
+func handleUnavailable(c *Context) {
+	name, rest, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("unavailable.usage", nil)
+		return
+	}
+	until, reason, ok := parseUnavailable(rest)
+	if !ok {
+		c.Reply("unavailable.usage", nil)
+		return
+	}
+	if len([]rune(reason)) > maxUnavailableReason {
+		c.Reply("unavailable.reason_too_long", Args{"count": maxUnavailableReason})
+		return
+	}
+	canonical, err := SetUnavailable(c.GuildID, name, until, reason, time.Now())
+	switch {
+	case errors.Is(err, ErrPastDate):
+		c.Reply("unavailable.past", Args{"date": until})
+	case err != nil:
+		log.Printf("Failed to mark restaurant unavailable: %v", err)
+		c.replyError("unavailable.failed", err, name)
+	default:
+		c.Ack("unavailable.done", Args{"name": canonical, "status": unavailableLine(c.Config, &Unavailability{Until: until, Reason: reason})})
+	}
+}
+
+// handleAvailable implements `!available "Name"`.
+func handleAvailable(c *Context) {
+	name, _, ok := parseRef(c.Args)
+	if !ok || name == "" {
+		c.Reply("unavailable.available_usage", nil)
+		return
+	}
+	canonical, err := ClearUnavailable(c.GuildID, name)
+	switch {
+	case errors.Is(err, ErrNotUnavailable):
+		c.Reply("unavailable.not_unavailable", Args{"name": canonical})
+	case err != nil:
+		log.Printf("Failed to mark restaurant available: %v", err)
+		c.replyError("unavailable.failed", err, name)
+	default:
+		c.Ack("unavailable.available", Args{"name": canonical})
+	}
+}
+
+// unavailableLine describes until when and why a restaurant is unavailable.
+func unavailableLine(cfg GuildConfig, u *Unavailability) string {
+	key := "unavailable.info_until"
+	if u.Until == "" {
+		key = "unavailable.info_open"
+	}
+	line := cfg.T(key, Args{"date": u.Until})
+	if u.Reason != "" {
+		line += " (" + u.Reason + ")"
+	}
+	return line
+}
+
+// runReopenings makes the restaurants whose unavailability ended available
+// again, announcing them in the guilds that chose a channel for it. Guilds
+// in their quiet hours are handled when the hours end.
+func runReopenings(s *discordgo.Session, now time.Time) {
+	var due []string
+	err := forEachGuild(func(guildID string, g *GuildData) {
+		if g.Config.quietAt(now) {
+			return
+		}
+		day := localDate(now, g.Config.location())
+		for _, r := range g.Restaurants {
+			if r.Unavailable != nil && !r.unavailableOn(day) {
+				due = append(due, guildID)
+				return
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to check unavailable restaurants: %v", err)
+		return
+	}
+
+	for _, guildID := range due {
+		var names []string
+		var cfg GuildConfig
+		err := updateKnownGuild(guildID, func(g *GuildData) error {
+			cfg = g.Config
+			day := localDate(now, g.Config.location())
+			for i := range g.Restaurants {
+				r := &g.Restaurants[i]
+				if r.Unavailable != nil && !r.unavailableOn(day) {
+					r.Unavailable = nil
+					if !r.Deleted() && !r.IsArchived() {
+						names = append(names, r.Name)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to clear unavailable restaurants in guild %s: %v", guildID, err)
+			continue
+		}
+		if cfg.ReopenChannelID == "" || len(names) == 0 {
+			continue
+		}
+		lines := []string{cfg.T("unavailable.reopened", Args{"count": len(names)})}
+		for _, name := range names {
+			lines = append(lines, "- "+name)
+		}
+		if _, err := s.ChannelMessageSendComplex(cfg.ReopenChannelID, &discordgo.MessageSend{
+			Content:         strings.Join(lines, "\n"),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		}); err != nil {
+			log.Printf("Failed to announce reopened restaurants in guild %s: %v", guildID, err)
+		}
+	}
+}
+
+// handleReopenSetting implements `!settings reopen #channel|off`, choosing
+// where restaurants are announced when they become available again.
+func handleReopenSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Send(reopenSettingLine(c.Config))
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	channelID := ""
+	if !strings.EqualFold(fields[0], "off") {
+		var ok bool
+		if channelID, ok = parseChannelMention(fields[0]); !ok || len(fields) != 1 {
+			c.Reply("settings.reopen_usage", nil)
+			return
+		}
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.ReopenChannelID = channelID
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save reopen channel: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.ReopenChannelID = channelID
+	c.Send(reopenSettingLine(c.Config))
+}
+
+// reopenSettingLine describes where reopened restaurants are announced.
+func reopenSettingLine(cfg GuildConfig) string {
+	if cfg.ReopenChannelID == "" {
+		return cfg.T("settings.reopen_off", nil)
+	}
+	return cfg.T("settings.reopen", Args{"channel": "<#" + cfg.ReopenChannelID + ">"})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// undoTimeout is how long the Undo button of a destructive command stays valid.
+const undoTimeout = 5 * time.Minute
+
+var (
+	// ErrUndoConflict is returned when the entries an undo would restore changed since the operation.
+	ErrUndoConflict = errors.New("the restaurants changed since the operation")
+	// ErrUndoNameTaken is returned when an undo would restore a name that is on the list again.
+	ErrUndoNameTaken = errors.New("a restored name is on the list again")
+)
+
+// snapshot holds the entries an operation changed, as they were before and
+// after it. Entries missing from After were removed outright.
+type snapshot struct {
+	Before []Restaurant
+	After  []Restaurant
+}
+
+// pendingUndo is an operation that can still be undone.
+type pendingUndo struct {
+	guildID string
+	userID  string
+	change  snapshot
+	expires time.Time
+}
+
+var (
+	// pendingUndos stores undoable operations keyed by the token in their button.
+	pendingUndos      = make(map[string]*pendingUndo)
+	pendingUndosMutex sync.Mutex
+)
+
+// sameEntry reports whether two entries are the same restaurant, even if the
+// operation changed other fields.
+func sameEntry(a, b *Restaurant) bool {
+	return a.Name == b.Name && a.AddedAt.Equal(b.AddedAt)
+}
+
+// entryIndex returns the index of the entry e is a version of, or -1.
+func (g *GuildData) entryIndex(e *Restaurant) int {
+	for i := range g.Restaurants {
+		if sameEntry(&g.Restaurants[i], e) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameState reports whether two versions of an entry are identical, comparing
+// their stored form so that times decoded from the file compare equal.
+func sameState(a, b Restaurant) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// openCount counts the entries that count towards the list size limit.
+func openCount(restaurants []Restaurant) int {
+	n := 0
+	for _, r := range restaurants {
+		if !r.Deleted() && !r.IsArchived() {
+			n++
+		}
+	}
+	return n
+}
+
+// UndoChange restores the entries of a snapshot to their state before the
+// operation. It refuses with ErrUndoConflict if any of them changed since,
+// and with ErrUndoNameTaken if a removed name was added again.
+func UndoChange(guildID string, change snapshot, by Contributor) error {
+	return updateGuild(guildID, func(g *GuildData) error {
+		var changed []int
+		for _, after := range change.After {
+			i := g.entryIndex(&after)
+			if i < 0 || !sameState(g.Restaurants[i], after) {
+				return ErrUndoConflict
+			}
+			changed = append(changed, i)
+		}
+		for _, before := range change.Before {
+			kept := false
+			for _, after := range change.After {
+				kept = kept || sameEntry(&before, &after)
+			}
+			if kept {
+				continue
+			}
+			if g.entryIndex(&before) >= 0 {
+				return ErrUndoConflict
+			}
+			if g.find(before.Name) >= 0 {
+				return ErrUndoNameTaken
+			}
+		}
+		if restored := openCount(change.Before) - openCount(change.After); restored > 0 && g.count()+restored > g.Config.maxRestaurants() {
+			return ErrListFull
+		}
+
+		// Remove the current versions and put the earlier ones back.
+		drop := make(map[int]bool, len(changed))
+		for _, i := range changed {
+			drop[i] = true
+		}
+		kept := g.Restaurants[:0]
+		for i, r := range g.Restaurants {
+			if !drop[i] {
+				kept = append(kept, r)
+			}
+		}
+		g.Restaurants = append(kept, change.Before...)
+		for _, r := range change.Before {
+			g.audit(auditUndo, r.Name, &by, sourceDiscord)
+		}
+		return nil
+	})
+}
+
+// undoButton registers an undoable operation and returns the row with its Undo button.
+func undoButton(cfg GuildConfig, guildID, userID string, change snapshot) discordgo.MessageComponent {
+	token := newToken()
+	pendingUndosMutex.Lock()
+	pendingUndos[token] = &pendingUndo{guildID: guildID, userID: userID, change: change, expires: time.Now().Add(undoTimeout)}
+	pendingUndosMutex.Unlock()
+	time.AfterFunc(undoTimeout, func() {
+		pendingUndosMutex.Lock()
+		delete(pendingUndos, token)
+		pendingUndosMutex.Unlock()
+	})
+	return buttonRow(discordgo.Button{Label: cfg.T("button.undo", nil), Style: discordgo.SecondaryButton, CustomID: "undo:" + token})
+}
+
+// disabledUndo is the Undo button of an operation that can no longer be undone.
+func disabledUndo(cfg GuildConfig) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{buttonRow(
+		discordgo.Button{Label: cfg.T("button.undo", nil), Style: discordgo.SecondaryButton, CustomID: "undo:expired", Disabled: true},
+	)}
+}
+
+// sendWithUndo sends the result of a destructive command with an Undo button.
+func (c *Context) sendWithUndo(text string, change snapshot) {
+	_, err := c.SendComplex(&discordgo.MessageSend{
+		Content:    text + "\n" + c.T("undo.hint", Args{"minutes": int(undoTimeout.Minutes())}),
+		Components: []discordgo.MessageComponent{undoButton(c.Config, c.GuildID, c.Message.Author.ID, change)},
+	})
+	if err != nil {
+		log.Printf("Failed to send message to %s: %v", c.Message.ChannelID, err)
+	}
+}
+
+// handleUndoComponent handles the Undo button of a destructive command.
+func handleUndoComponent(i *Interaction) {
+	if len(i.Args) != 1 {
+		return
+	}
+	token := i.Args[0]
+
+	pendingUndosMutex.Lock()
+	op, ok := pendingUndos[token]
+	if ok && time.Now().After(op.expires) {
+		delete(pendingUndos, token)
+		ok = false
+	}
+	if ok && i.UserID() != op.userID {
+		pendingUndosMutex.Unlock()
+		i.Ephemeral("undo.not_yours", nil)
+		return
+	}
+	delete(pendingUndos, token)
+	pendingUndosMutex.Unlock()
+
+	content := i.Event.Message.Content
+	if !ok {
+		i.Update(content+"\n"+i.T("undo.expired", nil), disabledUndo(i.Config))
+		return
+	}
+	err := UndoChange(op.guildID, op.change, contributorFor(i.Event.Member.User))
+	switch {
+	case errors.Is(err, ErrUndoConflict):
+		i.Update(content+"\n"+i.T("undo.conflict", nil), disabledUndo(i.Config))
+	case errors.Is(err, ErrUndoNameTaken):
+		i.Update(content+"\n"+i.T("undo.name_taken", nil), disabledUndo(i.Config))
+	case errors.Is(err, ErrListFull):
+		i.Update(content+"\n"+i.T("add.list_full", Args{"count": i.Config.maxRestaurants()}), disabledUndo(i.Config))
+	case err != nil:
+		log.Printf("Failed to undo: %v", err)
+		pendingUndosMutex.Lock()
+		pendingUndos[token] = op
+		pendingUndosMutex.Unlock()
+		i.Ephemeral("undo.failed", nil)
+	default:
+		i.Update(content+"\n"+i.T("undo.done", Args{"count": len(op.change.Before)}), nil)
+	}
+}
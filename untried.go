@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxUntriedEvery bounds the `!settings untried` interval.
+const maxUntriedEvery = 30
+
+// untried reports whether the guild has never been to the restaurant.
+func (r *Restaurant) untried() bool {
+	return len(r.Visits) == 0
+}
+
+// untriedPool returns the open restaurants the guild has never been to,
+// including unavailable ones, which are only closed for a while.
+func untriedPool(restaurants []Restaurant) []Restaurant {
+	var pool []Restaurant
+	for _, r := range restaurants {
+		if !r.IsArchived() && r.untried() {
+			pool = append(pool, r)
+		}
+	}
+	return pool
+}
+
+// handleUntried implements `!untried`, listing the restaurants never visited,
+// those on the list the longest first.
+func handleUntried(c *Context) {
+	restaurants, err := GetRestaurants(c.GuildID)
+	if err != nil {
+		log.Printf("Failed to get restaurants: %v", err)
+		c.Reply("list.failed", nil)
+		return
+	}
+	if len(restaurants) == 0 {
+		c.Reply("list.empty", nil)
+		return
+	}
+	pool := untriedPool(restaurants)
+	if len(pool) == 0 {
+		c.Reply("untried.all_tried", nil)
+		return
+	}
+	// Restaurants added before the date was recorded sort first.
+	sort.SliceStable(pool, func(i, j int) bool { return pool[i].AddedAt.Before(pool[j].AddedAt) })
+
+	now := time.Now()
+	today := localDate(now, c.Config.location())
+	var lines []string
+	for _, r := range pool {
+		line := "- " + listEntry(r)
+		if !r.AddedAt.IsZero() {
+			line += " · " + c.T("untried.waiting", Args{"count": int(now.Sub(r.AddedAt).Hours() / 24)})
+		}
+		if r.unavailableOn(today) {
+			line += " · " + unavailableLine(c.Config, r.Unavailable)
+		}
+		lines = append(lines, line)
+	}
+	c.SendPages(c.T("untried.header", Args{"count": len(pool)}), lines)
+}
+
+// untriedTurn reports whether a scheduled suggestion, counted from 1, is one
+// the guild wants drawn from the restaurants never visited.
+func untriedTurn(cfg GuildConfig, n int) bool {
+	return cfg.UntriedEvery > 0 && n > 0 && n%cfg.UntriedEvery == 0
+}
+
+// handleUntriedSetting implements `!settings untried N|off`, drawing every
+// Nth scheduled suggestion from the restaurants never visited.
+func handleUntriedSetting(c *Context, fields []string) {
+	if len(fields) == 0 {
+		c.Reply(untriedSettingKey(c.Config), Args{"count": c.Config.UntriedEvery})
+		return
+	}
+	if !c.RequireAdmin() {
+		return
+	}
+	every := 0
+	switch value := strings.ToLower(fields[0]); {
+	case len(fields) != 1:
+		c.Reply("settings.untried_invalid", Args{"max": maxUntriedEvery})
+		return
+	case value != "off":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxUntriedEvery {
+			c.Reply("settings.untried_invalid", Args{"max": maxUntriedEvery})
+			return
+		}
+		every = n
+	}
+	if err := updateGuild(c.GuildID, func(g *GuildData) error {
+		g.Config.UntriedEvery = every
+		return nil
+	}); err != nil {
+		log.Printf("Failed to save untried interval: %v", err)
+		c.Reply("settings.save_failed", nil)
+		return
+	}
+	c.Config.UntriedEvery = every
+	c.Reply(untriedSettingKey(c.Config), Args{"count": every})
+}
+
+// untriedSettingKey returns the message describing the untried setting.
+func untriedSettingKey(cfg GuildConfig) string {
+	if cfg.UntriedEvery <= 0 {
+		return "settings.untried_off"
+	}
+	return "settings.untried"
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// usageTrendWeeks is the number of weeks shown in the !usage trend.
+	usageTrendWeeks = 8
+	// usageBarWidth is the length of the longest bar in the !usage trend.
+	usageBarWidth = 20
+)
+
+// UsageDay counts the commands run in a guild on one UTC day.
+type UsageDay struct {
+	// Date is the day as YYYY-MM-DD.
+	Date     string         `json:"date"`
+	Commands map[string]int `json:"commands"`
+	// Users counts the commands per user ID.
+	Users map[string]int `json:"users"`
+}
+
+// add merges the counts of other into d.
+func (d *UsageDay) add(other UsageDay) {
+	if d.Commands == nil {
+		d.Commands = map[string]int{}
+	}
+	if d.Users == nil {
+		d.Users = map[string]int{}
+	}
+	for k, v := range other.Commands {
+		d.Commands[k] += v
+	}
+	for k, v := range other.Users {
+		d.Users[k] += v
+	}
+}
+
+var (
+	// pendingUsage holds the counts not yet written to the database, by guild and date.
+	pendingUsage      = map[string]map[string]*UsageDay{}
+	pendingUsageMutex sync.Mutex
+)
+
+// recordUsage counts a command invocation. The count is kept in memory until
+// the next flushUsage so that commands don't wait for an extra database write.
+func recordUsage(guildID, command, userID string, now time.Time) {
+	date := now.UTC().Format("2006-01-02")
+	pendingUsageMutex.Lock()
+	defer pendingUsageMutex.Unlock()
+	days := pendingUsage[guildID]
+	if days == nil {
+		days = map[string]*UsageDay{}
+		pendingUsage[guildID] = days
+	}
+	day := days[date]
+	if day == nil {
+		day = &UsageDay{Date: date, Commands: map[string]int{}, Users: map[string]int{}}
+		days[date] = day
+	}
+	day.Commands[command]++
+	day.Users[userID]++
+}
+
+// forgetPendingUsage drops a member from the usage counts of a guild not yet
+// written to the database, returning the number of days they were counted in.
+func forgetPendingUsage(guildID, userID string) int {
+	pendingUsageMutex.Lock()
+	defer pendingUsageMutex.Unlock()
+	n := 0
+	for _, day := range pendingUsage[guildID] {
+		if _, ok := day.Users[userID]; ok {
+			delete(day.Users, userID)
+			n++
+		}
+	}
+	return n
+}
+
+// flushUsage writes the pending usage counts to the database and drops days
+// older than the guild's usage retention.
+func flushUsage(now time.Time) {
+	pendingUsageMutex.Lock()
+	pending := pendingUsage
+	pendingUsage = map[string]map[string]*UsageDay{}
+	pendingUsageMutex.Unlock()
+
+	for guildID, days := range pending {
+		err := updateGuild(guildID, func(g *GuildData) error {
+			for _, day := range days {
+				i := slices.IndexFunc(g.Usage, func(d UsageDay) bool { return d.Date == day.Date })
+				if i < 0 {
+					g.Usage = append(g.Usage, UsageDay{Date: day.Date})
+					i = len(g.Usage) - 1
+				}
+				g.Usage[i].add(*day)
+			}
+			if days := g.Config.retentionDays(retentionUsage); days > 0 {
+				cutoff := now.UTC().AddDate(0, 0, -days).Format("2006-01-02")
+				g.Usage = slices.DeleteFunc(g.Usage, func(d UsageDay) bool { return d.Date < cutoff })
+			}
+			slices.SortFunc(g.Usage, func(a, b UsageDay) int { return strings.Compare(a.Date, b.Date) })
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to save usage for guild %s: %v", guildID, err)
+		}
+	}
+}
+
+// busiest returns the key with the highest count, ties broken alphabetically.
+func busiest(counts map[string]int) (string, int) {
+	best, most := "", 0
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		if counts[k] > most {
+			best, most = k, counts[k]
+		}
+	}
+	return best, most
+}
+
+// usageWeekStart returns the Monday of the UTC week of t.
+func usageWeekStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// handleUsage implements `!usage`, summarizing the commands run over the
+// guild's usage retention.
+func handleUsage(c *Context) {
+	if !c.RequireAdmin() {
+		return
+	}
+	now := time.Now()
+	flushUsage(now)
+	var days []UsageDay
+	if err := viewGuild(c.GuildID, func(g *GuildData) error {
+		days = g.Usage
+		return nil
+	}); err != nil {
+		log.Printf("Failed to load usage: %v", err)
+		c.Reply("usage.failed", nil)
+		return
+	}
+
+	var total UsageDay
+	weeks := make([]int, usageTrendWeeks)
+	thisWeek := usageWeekStart(now)
+	for _, d := range days {
+		total.add(d)
+		date, err := time.Parse("2006-01-02", d.Date)
+		if err != nil {
+			continue
+		}
+		week := int(thisWeek.Sub(usageWeekStart(date)).Hours() / (24 * 7))
+		if week >= 0 && week < usageTrendWeeks {
+			for _, n := range d.Commands {
+				weeks[usageTrendWeeks-1-week] += n
+			}
+		}
+	}
+	count := 0
+	for _, n := range total.Commands {
+		count += n
+	}
+	if count == 0 {
+		c.Reply("usage.empty", nil)
+		return
+	}
+
+	command, commandCount := busiest(total.Commands)
+	user, userCount := busiest(total.Users)
+	header := c.T("usage.header_all", nil)
+	if days := c.Config.retentionDays(retentionUsage); days > 0 {
+		header = c.T("usage.header", Args{"days": days})
+	}
+	lines := []string{
+		header,
+		c.T("usage.total", Args{"count": count, "commands": len(total.Commands), "users": len(total.Users)}),
+		c.T("usage.busiest_command", Args{"command": commandPrefix + command, "count": commandCount}),
+		c.T("usage.busiest_user", Args{"user": "<@" + user + ">", "count": userCount}),
+		c.T("usage.trend", nil),
+	}
+	most := slices.Max(weeks)
+	trend := []string{"```"}
+	for i, n := range weeks {
+		start := thisWeek.AddDate(0, 0, -7*(usageTrendWeeks-1-i))
+		bar := 0
+		if most > 0 {
+			bar = (n*usageBarWidth + most - 1) / most
+		}
+		trend = append(trend, fmt.Sprintf("%s %s %d", start.Format("01-02"), strings.Repeat("█", bar)+strings.Repeat("·", usageBarWidth-bar), n))
+	}
+	trend = append(trend, "```")
+	c.SendQuiet(strings.Join(append(lines, trend...), "\n"))
+}
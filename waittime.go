@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// fastWait is the longest wait in minutes of the restaurants `fast` selects.
+	fastWait = 15
+	// maxWaitReports is how many of the latest answers to the wait question
+	// the average is taken over.
+	maxWaitReports = 10
+)
+
+// waitAnswers are the answers to the wait question of a rating prompt: the
+// label's catalog key and the minutes the answer counts as.
+var waitAnswers = []struct {
+	key     string
+	minutes int
+}{
+	{"button.wait_short", 5},
+	{"button.wait_medium", 15},
+	{"button.wait_long", 25},
+}
+
+// ErrNotAttendee is returned when someone who wasn't at a visit answers its wait question.
+var ErrNotAttendee = errors.New("not an attendee of the visit")
+
+// WaitReport is an attendee's answer to how long they waited on a visit.
+type WaitReport struct {
+	UserID  string    `json:"user_id,omitempty"`
+	VisitAt time.Time `json:"visit_at"`
+	Minutes int       `json:"minutes"`
+}
+
+// WaitTime returns the restaurant's wait in minutes, the average of the
+// latest reports or else the value set with !set, reporting false when
+// neither is known.
+func (r *Restaurant) WaitTime() (int, bool) {
+	if len(r.WaitReports) == 0 {
+		return r.Wait, r.Wait > 0
+	}
+	sum := 0
+	for _, w := range r.WaitReports {
+		sum += w.Minutes
+	}
+	return int(math.Round(float64(sum) / float64(len(r.WaitReports)))), true
+}
+
+// reportWait records an attendee's answer, replacing their earlier answer
+// for the same visit and keeping the latest maxWaitReports answers.
+func (r *Restaurant) reportWait(report WaitReport) {
+	r.WaitReports = slices.DeleteFunc(r.WaitReports, func(w WaitReport) bool {
+		return w.UserID == report.UserID && w.VisitAt.Unix() == report.VisitAt.Unix()
+	})
+	r.WaitReports = append(r.WaitReports, report)
+	if extra := len(r.WaitReports) - maxWaitReports; extra > 0 {
+		r.WaitReports = slices.Delete(r.WaitReports, 0, extra)
+	}
+}
+
+// waitButtons is the row of buttons answering how long the wait of a visit
+// was, identified like the rating buttons.
+func waitButtons(cfg GuildConfig, guildID string, p RatingPrompt) discordgo.MessageComponent {
+	var buttons []discordgo.Button
+	for i, a := range waitAnswers {
+		buttons = append(buttons, discordgo.Button{
+			Label:    cfg.T(a.key, nil),
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("wait:%s:%s:%d:%d", guildID, p.RestaurantID, p.VisitAt.Unix(), i),
+		})
+	}
+	return buttonRow(buttons...)
+}
+
+// ReportWait stores an attendee's answer to a visit's wait question,
+// returning the restaurant's name and resulting wait.
+func ReportWait(guildID, restaurantID string, visitAt time.Time, userID string, minutes int) (string, int, error) {
+	var name string
+	var wait int
+	err := updateGuild(guildID, func(g *GuildData) error {
+		r, v := g.findVisit(restaurantID, visitAt)
+		if v < 0 {
+			return ErrVisitNotFound
+		}
+		name = r.Name
+		if !slices.Contains(r.Visits[v].Attendees, userID) {
+			return ErrNotAttendee
+		}
+		r.reportWait(WaitReport{UserID: userID, VisitAt: r.Visits[v].Date, Minutes: minutes})
+		wait, _ = r.WaitTime()
+		return nil
+	})
+	return name, wait, err
+}
+
+// handleWaitComponent handles the wait buttons of a rating prompt.
+func handleWaitComponent(i *Interaction) {
+	if len(i.Args) != 4 || i.Args[0] != i.GuildID {
+		return
+	}
+	unix, err := strconv.ParseInt(i.Args[2], 10, 64)
+	answer, err2 := strconv.Atoi(i.Args[3])
+	if err != nil || err2 != nil || answer < 0 || answer >= len(waitAnswers) {
+		return
+	}
+	name, wait, err := ReportWait(i.GuildID, i.Args[1], time.Unix(unix, 0).UTC(), i.UserID(), waitAnswers[answer].minutes)
+	switch {
+	case errors.Is(err, ErrVisitNotFound):
+		i.Ephemeral("rateprompt.gone", nil)
+	case errors.Is(err, ErrNotAttendee):
+		i.Ephemeral("waitprompt.not_attendee", Args{"name": name})
+	case err != nil:
+		log.Printf("Failed to report wait: %v", err)
+		i.Ephemeral("waitprompt.failed", nil)
+	default:
+		i.Ephemeral("waitprompt.done", Args{"name": name, "minutes": wait})
+	}
+}
+
+// waitNode matches restaurants whose wait is at most max minutes. Lenient
+// nodes also match restaurants without a known wait.
+type waitNode struct {
+	max     int
+	lenient bool
+}
+
+func (n waitNode) match(r *Restaurant) bool {
+	wait, ok := r.WaitTime()
+	if !ok {
+		return n.lenient
+	}
+	return wait <= n.max
+}
+
+// relaxWait returns a copy of a filter whose wait terms also match
+// restaurants without a known wait, reporting whether it has any.
+func relaxWait(n filterNode) (filterNode, bool) {
+	switch n := n.(type) {
+	case waitNode:
+		n.lenient = true
+		return n, true
+	case andNode:
+		left, l := relaxWait(n.left)
+		right, r := relaxWait(n.right)
+		return andNode{left, right}, l || r
+	case orNode:
+		left, l := relaxWait(n.left)
+		right, r := relaxWait(n.right)
+		return orNode{left, right}, l || r
+	case notNode:
+		inner, ok := relaxWait(n.inner)
+		return notNode{inner}, ok
+	}
+	return n, false
+}
+
+// skippedNoWait counts the restaurants a query leaves out only because their
+// wait isn't known.
+func (q *Query) skippedNoWait(restaurants []Restaurant) int {
+	relaxed, ok := relaxWait(q.Filter)
+	if !ok {
+		return 0
+	}
+	lenient := *q
+	lenient.Filter = relaxed
+	n := 0
+	for i := range restaurants {
+		r := &restaurants[i]
+		if _, known := r.WaitTime(); !known && lenient.Match(r) && !q.Match(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// skippedNoWaitNote tells how many restaurants a wait filter left out for
+// lack of data, "" when none.
+func (q *Query) skippedNoWaitNote(cfg GuildConfig, restaurants []Restaurant) string {
+	n := q.skippedNoWait(restaurants)
+	if n == 0 {
+		return ""
+	}
+	return cfg.T("filter.skipped_no_wait", Args{"count": n})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// weekSummaryMarker starts the weekly summary message, so that the bot can
+// find its pin again after a restart.
+const weekSummaryMarker = "📌 "
+
+// decisionRetention is how long decisions are kept, enough for the current week.
+const decisionRetention = 8 * 24 * time.Hour
+
+// Decision sources.
+const (
+	decisionPoll = "poll"
+	decisionPick = "pick"
+)
+
+// Decision is a restaurant a channel settled on, by poll or accepted pick.
+type Decision struct {
+	ChannelID string `json:"channel_id"`
+	Name      string `json:"name"`
+	// Source is decisionPoll or decisionPick.
+	Source string    `json:"source"`
+	At     time.Time `json:"at"`
+}
+
+// weekStart returns midnight of the Monday starting the week of t, in t's location.
+func weekStart(t time.Time) time.Time {
+	days := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, t.Location())
+}
+
+// RecordDecision stores a decision, dropping those past decisionRetention,
+// and returns the decisions kept for its channel.
+func RecordDecision(guildID string, d Decision) ([]Decision, error) {
+	var channel []Decision
+	err := updateGuild(guildID, func(g *GuildData) error {
+		g.Decisions = slices.DeleteFunc(g.Decisions, func(old Decision) bool { return d.At.Sub(old.At) > decisionRetention })
+		g.Decisions = append(g.Decisions, d)
+		for _, other := range g.Decisions {
+			if other.ChannelID == d.ChannelID {
+				channel = append(channel, other)
+			}
+		}
+		return nil
+	})
+	return channel, err
+}
+
+// weekSummary renders the decisions of the week containing now by day.
+func weekSummary(cfg GuildConfig, decisions []Decision, now time.Time) string {
+	loc := cfg.location()
+	start := weekStart(now.In(loc))
+	end := start.AddDate(0, 0, 7)
+	lines := []string{weekSummaryMarker + cfg.T("summary.title", Args{"date": start.Format("2006-01-02")})}
+	sorted := slices.Clone(decisions)
+	slices.SortStableFunc(sorted, func(a, b Decision) int { return a.At.Compare(b.At) })
+	for _, d := range sorted {
+		at := d.At.In(loc)
+		if at.Before(start) || !at.Before(end) {
+			continue
+		}
+		lines = append(lines, cfg.T("summary.line", Args{
+			"day":    cfg.T("summary.day_"+weekdayNames[at.Weekday()], nil),
+			"date":   at.Format("2006-01-02"),
+			"name":   d.Name,
+			"source": cfg.T("summary.source_"+d.Source, nil),
+		}))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// findWeekSummary returns the ID of the bot's pinned weekly summary in a channel, if any.
+func findWeekSummary(s *discordgo.Session, channelID string) string {
+	pins, err := s.ChannelMessagesPinned(channelID)
+	if err != nil {
+		log.Printf("Failed to list pins in %s: %v", channelID, err)
+		return ""
+	}
+	for _, m := range pins {
+		if m.Author != nil && m.Author.ID == s.State.User.ID && strings.HasPrefix(m.Content, weekSummaryMarker) {
+			return m.ID
+		}
+	}
+	return ""
+}
+
+// noteDecision records a channel's decision and updates its pinned weekly
+// summary. Without a pin to edit it posts and pins a new summary; when
+// pinning fails, for instance at the pin limit or without permission, the
+// summary stays posted unpinned and is posted again next time.
+func noteDecision(s *discordgo.Session, guildID, channelID string, cfg GuildConfig, name, source string) {
+	announceDecision(s, guildID, channelID, cfg, name, source)
+	now := time.Now()
+	decisions, err := RecordDecision(guildID, Decision{ChannelID: channelID, Name: name, Source: source, At: now.UTC()})
+	if err != nil {
+		log.Printf("Failed to record decision: %v", err)
+		return
+	}
+	text := weekSummary(cfg, decisions, now)
+	if id := findWeekSummary(s, channelID); id != "" {
+		_, err := s.ChannelMessageEdit(channelID, id, text)
+		if err == nil {
+			return
+		}
+		log.Printf("Failed to edit weekly summary in %s: %v", channelID, err)
+	}
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Content: text, AllowedMentions: &discordgo.MessageAllowedMentions{}})
+	if err != nil {
+		log.Printf("Failed to post weekly summary in %s: %v", channelID, err)
+		return
+	}
+	if err := s.ChannelMessagePin(channelID, msg.ID); err != nil {
+		log.Printf("Failed to pin weekly summary in %s, leaving it unpinned: %v", channelID, err)
+	}
+}